@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+func runCheckUpstream(args []string) int {
+	fs := flag.NewFlagSet("check-upstream", flag.ContinueOnError)
+	connectTarget := fs.String("connect", "example.com:443", "host:port to open a CONNECT tunnel to (empty to skip)")
+	getURL := fs.String("url", "http://example.com/", "URL to fetch through the upstream (empty to skip)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dynamicproxy check-upstream [flags]")
+		fmt.Fprintln(fs.Output(), "Checks the configured upstream proxy stage by stage and reports where it fails.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if errors.Is(err, config.ErrConfigURLUnreachable) {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	upstreams := proxy.DiscoverUpstreams(context.Background(), cfg)
+	if len(upstreams) == 0 {
+		upstreams = []string{""}
+	}
+	code := 0
+	for i, upstream := range upstreams {
+		if i > 0 {
+			fmt.Println()
+		}
+		cfg.UpstreamProxy = upstream
+		fmt.Printf("Checking upstream %s (auth=%s)\n", upstream, authName(cfg.ProxyAuth))
+		steps := proxy.CheckUpstream(context.Background(), cfg, *connectTarget, *getURL)
+		if !printSteps(os.Stdout, steps) {
+			code = 1
+		}
+	}
+	return code
+}
+
+// printSteps prints one line per stage and reports whether all stages passed.
+func printSteps(w io.Writer, steps []proxy.CheckStep) bool {
+	for _, step := range steps {
+		if step.Err != nil {
+			fmt.Fprintf(w, "FAIL  %-40s %8s  %v\n", step.Stage, step.Duration.Round(1e6), step.Err)
+			fmt.Fprintf(w, "\nFailed at stage: %s\n", step.Stage)
+			return false
+		}
+		fmt.Fprintf(w, "ok    %-40s %8s  %s\n", step.Stage, step.Duration.Round(1e6), step.Detail)
+	}
+	return true
+}
+
+func authName(auth string) string {
+	if auth == "" {
+		return "none"
+	}
+	return auth
+}
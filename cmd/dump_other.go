@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// dumpSignal returns SIGQUIT, as there is no SIGUSR2 to name.
+func dumpSignal(string) os.Signal {
+	return syscall.SIGQUIT
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// dumpSignal returns the signal DUMP_SIGNAL names, SIGQUIT unless it is
+// SIGUSR2.
+func dumpSignal(name string) os.Signal {
+	if name == config.DumpSignalUSR2 {
+		return syscall.SIGUSR2
+	}
+	return syscall.SIGQUIT
+}
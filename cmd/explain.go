@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	app := fs.String("app", "", "name of the local application sending the request, for APP_ROUTES")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dynamicproxy explain [-app name] <url | host:port>")
+		fmt.Fprintln(fs.Output(), "Loads the configuration and prints how the destination would be routed, without sending traffic.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if errors.Is(err, config.ErrConfigURLUnreachable) {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	method, host, err := explainTarget(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid target: %v\n", err)
+		return 2
+	}
+
+	// Keep messages such as the loaded UPSTREAM_PAC out of the explanation.
+	proxy.Info.SetOutput(os.Stderr)
+	proxy.Warn.SetOutput(os.Stderr)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	printDecision(os.Stdout, method, host, *app, proxy.Explain(ctx, method, host, *app, cfg), cfg)
+	return 0
+}
+
+// explainTarget returns the request a client would send to the proxy for
+// target: a CONNECT for https URLs and host:port targets, a plain request
+// with the URL's Host otherwise.
+func explainTarget(target string) (method, host string, err error) {
+	if !strings.Contains(target, "://") {
+		if _, _, err := net.SplitHostPort(target); err == nil {
+			return http.MethodConnect, target, nil
+		}
+		target = "http://" + target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("%q has no host", target)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https", "wss":
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		return http.MethodConnect, net.JoinHostPort(u.Hostname(), port), nil
+	case "http", "ws":
+		return http.MethodGet, u.Host, nil
+	default:
+		return "", "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+}
+
+func printDecision(w io.Writer, method, host, app string, e proxy.Explanation, cfg config.Config) {
+	d := e.Decision
+
+	fmt.Fprintf(w, "Request:   %s %s\n", method, host)
+	if app != "" {
+		fmt.Fprintf(w, "App:       %s\n", app)
+	}
+	if strings.HasPrefix(e.Rule, "app:") {
+		fmt.Fprintf(w, "Rule:      application %q (APP_ROUTES)\n", app)
+	} else if e.Rule == "pac" {
+		fmt.Fprintf(w, "Rule:      returned by %s (UPSTREAM_PAC)\n", cfg.UpstreamPAC)
+	} else if d.DirectOnly {
+		fmt.Fprintln(w, "Rule:      direct-only mode (DIRECT_ONLY)")
+	} else if d.Country != "" {
+		fmt.Fprintf(w, "Rule:      destination located in %s (GEOIP_UPSTREAM)\n", d.Country)
+	} else if d.Addr != "" {
+		fmt.Fprintf(w, "Rule:      exception %q matched resolved address %s\n", d.Rule, d.Addr)
+	} else if d.Rule != "" {
+		fmt.Fprintf(w, "Rule:      exception %q matched\n", d.Rule)
+	} else {
+		fmt.Fprintf(w, "Rule:      no exception matched (%d configured)\n", len(cfg.ProxyExceptions))
+	}
+
+	switch e.Route {
+	case "blocked":
+		fmt.Fprintln(w, "Route:     blocked (403)")
+		return
+	case "direct":
+		fmt.Fprintf(w, "Route:     direct connection to %s\n", host)
+		return
+	}
+
+	switch {
+	case len(e.Upstreams) > 0:
+		fmt.Fprintf(w, "Route:     via upstream proxy %s\n", strings.Join(e.Upstreams, ", then "))
+	case len(e.Excluded) > 0:
+		fmt.Fprintln(w, "Route:     none, every upstream is excluded (502 upstream-excluded)")
+	default:
+		fmt.Fprintln(w, "Route:     via upstream proxy (none configured)")
+	}
+	if len(e.Excluded) > 0 {
+		fmt.Fprintf(w, "Excluded:  %s (UPSTREAM_EXCEPTIONS)\n", strings.Join(e.Excluded, ", "))
+	}
+	auth := d.Auth
+	if auth == "" {
+		auth = "none"
+	}
+	fmt.Fprintf(w, "Auth:      %s\n", auth)
+	if d.RemoteDNS {
+		fmt.Fprintln(w, "DNS:       resolved by the upstream proxy only (REMOTE_DNS)")
+	}
+	if e.FailOpen {
+		fmt.Fprintln(w, "Fallback:  direct connection if the upstream is unreachable (fail-open)")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func runHealthcheck(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	addr := fs.String("addr", defaultProxyAddr(), "proxy address")
+	connectTarget := fs.String("connect", "example.com:443", "host:port to open a CONNECT tunnel to through the proxy (empty to skip)")
+	getURL := fs.String("url", "", "URL to fetch through the proxy (empty to skip)")
+	timeout := fs.Duration("timeout", 5*time.Second, "overall timeout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dynamicproxy healthcheck [flags]")
+		fmt.Fprintln(fs.Output(), "Sends a request through the running proxy and exits 0 if it succeeds, 1 otherwise.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if *connectTarget != "" {
+		if err := healthConnect(ctx, *addr, *connectTarget); err != nil {
+			fmt.Fprintf(os.Stderr, "CONNECT %s via %s: %v\n", *connectTarget, *addr, err)
+			return 1
+		}
+	}
+	if *getURL != "" {
+		if err := healthGet(ctx, *addr, *getURL); err != nil {
+			fmt.Fprintf(os.Stderr, "GET %s via %s: %v\n", *getURL, *addr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// defaultProxyAddr is the first plain listener of LISTEN_ADDR, on the
+// loopback address when it only names a port.
+func defaultProxyAddr() string {
+	cfg := config.Config{ListenAddr: config.GetEnv("LISTEN_ADDR", ":8080")}
+	addr := cfg.ProxyAddr()
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	return addr
+}
+
+func healthConnect(ctx context.Context, addr, target string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return fmt.Errorf("bad CONNECT response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy responded %s", resp.Status)
+	}
+	return nil
+}
+
+// healthGet treats any status below 500 as healthy: the destination
+// answered, whatever it had to say.
+func healthGet(ctx context.Context, addr, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("proxy responded %s", resp.Status)
+	}
+	return nil
+}
@@ -1,24 +1,306 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
 
+	"github.com/cavoq/DynamicProxy/internal/admin"
 	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/namedpipe"
 	"github.com/cavoq/DynamicProxy/internal/proxy"
+	"github.com/cavoq/DynamicProxy/internal/systemd"
+	"github.com/cavoq/DynamicProxy/internal/upgrade"
+	"github.com/cavoq/DynamicProxy/internal/version"
 )
 
+const usage = `Usage:
+  dynamicproxy                 run the proxy
+  dynamicproxy explain <url>   show how a destination would be routed
+  dynamicproxy check-upstream  diagnose connectivity and authentication to the upstream
+  dynamicproxy top             live view of a running proxy via its admin API
+  dynamicproxy healthcheck     exit 0 if a request through the running proxy succeeds
+  dynamicproxy redirect        install or remove the redirection to a transparent listener
+  dynamicproxy version         print build information
+`
+
 func main() {
-	cfg := config.LoadConfig()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "explain":
+			os.Exit(runExplain(os.Args[2:]))
+		case "check-upstream":
+			os.Exit(runCheckUpstream(os.Args[2:]))
+		case "top":
+			os.Exit(runTop(os.Args[2:]))
+		case "healthcheck":
+			os.Exit(runHealthcheck(os.Args[2:]))
+		case "redirect":
+			os.Exit(runRedirect(os.Args[2:]))
+		case "version", "-version", "--version":
+			fmt.Println(version.Get())
+			return
+		case "-h", "-help", "--help", "help":
+			fmt.Print(usage)
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+			os.Exit(2)
+		}
+	}
+	serve()
+}
 
-	if cfg.ListenAddr == "" {
-		cfg.ListenAddr = ":8080"
+func serve() {
+	cfg, err := config.Load()
+	if errors.Is(err, config.ErrConfigURLUnreachable) {
+		log.Printf("Starting without CONFIG_URL: %v", err)
+	} else if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	listeners, err := cfg.Listeners()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	for _, spec := range listeners {
+		if spec.Auth && len(cfg.ForTenant(spec.Tenant).ClientUsers) == 0 {
+			log.Fatalf("Listener %s requires authentication but CLIENT_AUTH_USERS is empty", spec.Addr)
+		}
 	}
 
+	log.Print(version.Get())
 	log.Printf("Upstream Proxy: %s", cfg.UpstreamProxy)
 	log.Printf("Proxy Exceptions: %v", cfg.ProxyExceptions)
 	log.Printf("Authentication: %s", cfg.ProxyAuth)
+	for _, tenant := range cfg.Tenants {
+		tcfg := cfg.ForTenant(tenant.Name)
+		log.Printf("Tenant %s: upstream proxy %s, proxy exceptions %v", tenant.Name, tcfg.UpstreamProxy, tcfg.ProxyExceptions)
+	}
+
+	if err := applyStartupProbe(&cfg); err != nil {
+		log.Fatalf("Startup probe failed: %v", err)
+	}
+
+	server := proxy.NewServer(cfg)
+	logs, err := openLogFiles(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logs.install(server, cfg)
+	if cfg.ConfigKV != "" {
+		source, err := config.ParseKVSource(cfg.ConfigKV, cfg.ConfigKVToken)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		log.Printf("Watching %s for config changes", source)
+		go admin.WatchKV(context.Background(), source, server)
+	}
+	if cfg.ConfigURL != "" {
+		source, err := config.URLSourceFor(cfg.ConfigURL, cfg.ConfigURLPublicKey)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		log.Printf("Polling %s for config changes every %s", source, cfg.ConfigURLInterval)
+		go admin.PollURL(context.Background(), source, cfg.ConfigURLInterval, server)
+	}
+	if len(cfg.Profiles) > 0 {
+		log.Printf("Network profile: %q", cfg.Profile)
+		go admin.WatchNetwork(context.Background(), cfg.ProfileCheckInterval, server)
+	}
+	upgrader := upgrade.New()
+	for name, f := range systemd.Listeners() {
+		upgrader.Inherit(name, f)
+	}
+
+	// Listeners are named proxy, proxy2, ... for upgrades and socket
+	// activation.
+	ls := make([]net.Listener, len(listeners))
+	for i, spec := range listeners {
+		name := "proxy"
+		if i > 0 {
+			name = fmt.Sprintf("proxy%d", i+1)
+		}
+		if ls[i], err = upgrader.Listen(name, spec.Addr); err != nil {
+			log.Fatalf("Failed to start proxy: %v", err)
+		}
+	}
+	for i, spec := range listeners[1:] {
+		go func() {
+			log.Printf("Proxy listening on %s (tls=%t, auth=%t, transparent=%t, tenant=%q)", spec.Addr, spec.TLS, spec.Auth, spec.Transparent, spec.Tenant)
+			if err := server.ServeListener(ls[i+1], spec); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Failed to start proxy: %v", err)
+			}
+		}()
+	}
+
+	if cfg.ListenPipe != "" {
+		pl, err := namedpipe.Listen(cfg.ListenPipe, cfg.ListenPipeSDDL)
+		if err != nil {
+			log.Fatalf("Failed to start proxy on named pipe: %v", err)
+		}
+		go func() {
+			log.Printf("Proxy listening on named pipe %s", cfg.ListenPipe)
+			if err := server.Serve(pl); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Failed to start proxy on named pipe: %v", err)
+			}
+		}()
+	}
+
+	var adminListeners []net.Listener
+	if cfg.AdminAddr != "" {
+		al, err := upgrader.Listen("admin", cfg.AdminAddr)
+		if err != nil {
+			log.Fatalf("Failed to start admin API: %v", err)
+		}
+		adminListeners = append(adminListeners, al)
+		go func() {
+			log.Printf("Admin API listening on %s", cfg.AdminAddr)
+			if err := admin.Serve(al, cfg, server); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("Failed to start admin API: %v", err)
+			}
+		}()
+	}
+
+	if cfg.GRPCAdminAddr != "" {
+		gl, err := upgrader.Listen("grpc", cfg.GRPCAdminAddr)
+		if err != nil {
+			log.Fatalf("Failed to start gRPC admin API: %v", err)
+		}
+		adminListeners = append(adminListeners, gl)
+		go func() {
+			log.Printf("gRPC admin API listening on %s", cfg.GRPCAdminAddr)
+			if err := admin.ServeGRPC(gl, cfg, server); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("Failed to start gRPC admin API: %v", err)
+			}
+		}()
+	}
 
-	if err := proxy.Start(cfg); err != nil {
+	drained := make(chan struct{})
+	var drainOnce sync.Once
+	done := func() { drainOnce.Do(func() { close(drained) }) }
+	dumpSig := dumpSignal(cfg.DumpSignal)
+	if upgrade.Signal != nil && upgrade.Signal == dumpSig {
+		log.Printf("DUMP_SIGNAL is %s, upgrades on that signal are off", cfg.DumpSignal)
+	} else if upgrade.Signal != nil {
+		go func() {
+			handleUpgrades(upgrader, server, adminListeners)
+			done()
+		}()
+	}
+	go handleDumps(server, dumpSig)
+	go handleReloads(server)
+	if reopenSignal != nil {
+		go handleReopens(server, logs)
+	}
+	go func() {
+		handleShutdown(server, adminListeners)
+		if cfg.SetSystemProxy {
+			restoreSystemProxy()
+		}
+		done()
+	}()
+
+	if err := upgrader.Ready(); err != nil {
+		log.Printf("Failed to notify the previous process: %v", err)
+	}
+	if cfg.SetSystemProxy {
+		for i, spec := range listeners {
+			if spec.Addr == cfg.ProxyAddr() {
+				setSystemProxy(ls[i].Addr())
+				break
+			}
+		}
+	}
+	notifySystemd(systemd.Ready, systemd.MainPID(os.Getpid()))
+	go runWatchdog()
+	log.Printf("Proxy listening on %s (tls=%t, auth=%t, transparent=%t, tenant=%q)", listeners[0].Addr, listeners[0].TLS, listeners[0].Auth, listeners[0].Transparent, listeners[0].Tenant)
+	if err := server.ServeListener(ls[0], listeners[0]); !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Failed to start proxy: %v", err)
 	}
+	<-drained
+	log.Print("Drained all connections, exiting")
+}
+
+// logFiles are the files the server writes flow records and
+// authentication audit records to.
+type logFiles struct {
+	flows   *os.File
+	tenants map[string]*os.File
+	audit   *os.File
+}
+
+// openLogFiles opens FLOW_LOG, the flow logs of tenants that have their own
+// and AUTH_AUDIT_LOG. If one fails, those already opened are closed again.
+func openLogFiles(cfg config.Config) (logFiles, error) {
+	logs := logFiles{tenants: make(map[string]*os.File)}
+	var err error
+	if cfg.FlowLog != "" {
+		if logs.flows, err = openLogFile(cfg.FlowLog); err != nil {
+			return logFiles{}, fmt.Errorf("failed to open flow log: %w", err)
+		}
+	}
+	for _, tenant := range cfg.Tenants {
+		path := cfg.ForTenant(tenant.Name).FlowLog
+		if path == cfg.FlowLog || path == "" {
+			continue
+		}
+		if logs.tenants[tenant.Name], err = openLogFile(path); err != nil {
+			logs.close()
+			return logFiles{}, fmt.Errorf("failed to open flow log of tenant %s: %w", tenant.Name, err)
+		}
+	}
+	if cfg.AuthAuditLog != "" {
+		if logs.audit, err = openLogFile(cfg.AuthAuditLog); err != nil {
+			logs.close()
+			return logFiles{}, fmt.Errorf("failed to open authentication audit log: %w", err)
+		}
+	}
+	return logs, nil
+}
+
+// install makes server write to logs. Tenants without a flow log of their
+// own share FLOW_LOG.
+func (logs logFiles) install(server *proxy.Server, cfg config.Config) {
+	if logs.flows != nil {
+		server.SetFlowLog(logs.flows)
+	}
+	for _, tenant := range cfg.Tenants {
+		path := cfg.ForTenant(tenant.Name).FlowLog
+		switch {
+		case path == cfg.FlowLog:
+		case path == "":
+			server.SetTenantFlowLog(tenant.Name, nil)
+		default:
+			server.SetTenantFlowLog(tenant.Name, logs.tenants[tenant.Name])
+		}
+	}
+	if logs.audit != nil {
+		server.SetAuthAuditLog(logs.audit)
+	}
+}
+
+// close closes the files of logs, except standard output.
+func (logs logFiles) close() {
+	for _, f := range append([]*os.File{logs.flows, logs.audit}, slices.Collect(maps.Values(logs.tenants))...) {
+		if f != nil && f != os.Stdout {
+			f.Close()
+		}
+	}
+}
+
+// openLogFile opens a FLOW_LOG or AUTH_AUDIT_LOG file for appending; "-" is
+// standard output.
+func openLogFile(path string) (*os.File, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
 }
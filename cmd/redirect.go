@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/redirect"
+)
+
+func runRedirect(args []string) int {
+	fs := flag.NewFlagSet("redirect", flag.ContinueOnError)
+	port := fs.Int("port", defaultTransparentPort(), "port of the transparent listener (default: the first ;transparent entry of LISTEN_ADDR)")
+	ports := fs.String("ports", "80,443", "comma-separated destination ports to redirect")
+	users := fs.String("users", "", "comma-separated users (names or IDs) whose connections are redirected")
+	cgroups := fs.String("cgroups", "", "comma-separated cgroup v2 paths, e.g. system.slice/build.service, whose connections are redirected")
+	interfaces := fs.String("interfaces", "", "comma-separated interfaces whose forwarded connections are redirected")
+	backend := fs.String("backend", redirect.DefaultBackend(), "nftables or iptables")
+	dryRun := fs.Bool("dry-run", false, "print the commands instead of running them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dynamicproxy redirect [flags] install|remove")
+		fmt.Fprintln(fs.Output(), "Installs or removes the nftables or iptables rules that redirect the connections of the given users, cgroups and interfaces to the transparent listener.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var cmds []redirect.Command
+	var err error
+	switch fs.Arg(0) {
+	case "install":
+		if *port == 0 {
+			fmt.Fprintln(os.Stderr, "LISTEN_ADDR has no ;transparent listener; pass its port with -port")
+			return 2
+		}
+		rules := redirect.Rules{
+			Port:       *port,
+			Users:      splitList(*users),
+			Cgroups:    splitList(*cgroups),
+			Interfaces: splitList(*interfaces),
+		}
+		for _, p := range splitList(*ports) {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid port %q\n", p)
+				return 2
+			}
+			rules.Ports = append(rules.Ports, n)
+		}
+		cmds, err = redirect.Install(*backend, rules)
+	case "remove":
+		cmds, err = redirect.Remove(*backend)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid rules: %v\n", err)
+		return 2
+	}
+
+	if *dryRun {
+		for _, c := range cmds {
+			fmt.Println(c)
+		}
+		return 0
+	}
+	if err := redirect.Run(cmds); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to %s the redirection: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+// defaultTransparentPort is the port of the first transparent listener of
+// LISTEN_ADDR, or 0 if there is none.
+func defaultTransparentPort() int {
+	cfg := config.Config{ListenAddr: config.GetEnv("LISTEN_ADDR", ":8080")}
+	listeners, _ := cfg.Listeners()
+	for _, l := range listeners {
+		if !l.Transparent {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(l.Addr); err == nil {
+			n, _ := strconv.Atoi(port)
+			return n
+		}
+	}
+	return 0
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
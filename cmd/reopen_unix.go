@@ -0,0 +1,12 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignal asks for FLOW_LOG and AUTH_AUDIT_LOG to be reopened after
+// they were rotated.
+var reopenSignal os.Signal = syscall.SIGUSR1
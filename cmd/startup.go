@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+// applyStartupProbe checks that the upstreams can be reached before the
+// proxy starts and applies STARTUP_PROBE when none can: "warn" logs and
+// starts anyway, "refuse" returns an error, "direct" starts in direct-only
+// mode and "off" skips the probe.
+func applyStartupProbe(cfg *config.Config) error {
+	policy := strings.ToLower(strings.TrimSpace(cfg.StartupProbe))
+	switch policy {
+	case "off":
+		return nil
+	case "warn", "refuse", "direct":
+	default:
+		return fmt.Errorf("invalid STARTUP_PROBE %q (expected off, warn, refuse or direct)", cfg.StartupProbe)
+	}
+	if len(cfg.Upstreams()) == 0 || cfg.DirectOnly {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TransportDialTimeout+cfg.TunnelConnectReadWriteTimeout)
+	defer cancel()
+	var failures []string
+	reachable := false
+	for _, result := range proxy.ProbeUpstreams(ctx, *cfg) {
+		if result.Healthy {
+			log.Printf("Upstream %s reachable (%v)", result.Addr, result.Latency.Round(1e6))
+			reachable = true
+			continue
+		}
+		log.Printf("Upstream %s unreachable: %s", result.Addr, result.Error)
+		failures = append(failures, result.Addr)
+	}
+	if reachable {
+		return nil
+	}
+
+	switch policy {
+	case "refuse":
+		return fmt.Errorf("no upstream reachable (%s)", strings.Join(failures, ", "))
+	case "direct":
+		log.Print("No upstream reachable, starting in direct-only mode")
+		cfg.DirectOnly = true
+	default:
+		log.Print("WARNING: no upstream reachable, requests through the upstream will fail until it is")
+	}
+	return nil
+}
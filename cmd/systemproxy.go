@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/cavoq/DynamicProxy/internal/sysproxy"
+)
+
+// setSystemProxy points the system proxy settings at the proxy listening on
+// addr. A failure is logged; the proxy keeps serving clients configured by
+// hand.
+func setSystemProxy(addr net.Addr) {
+	target := addr.String()
+	if tcp, ok := addr.(*net.TCPAddr); ok && (tcp.IP == nil || tcp.IP.IsUnspecified()) {
+		target = net.JoinHostPort("127.0.0.1", strconv.Itoa(tcp.Port))
+	}
+	if err := sysproxy.Set(target); err != nil {
+		log.Printf("Failed to set the system proxy: %v", err)
+		return
+	}
+	log.Printf("System proxy set to %s", target)
+}
+
+// restoreSystemProxy puts back the system proxy settings from before
+// setSystemProxy. It is not called after an upgrade, since the new process
+// keeps the settings in place.
+func restoreSystemProxy() {
+	if err := sysproxy.Restore(); err != nil {
+		log.Printf("Failed to restore the system proxy: %v", err)
+		return
+	}
+	log.Print("System proxy settings restored")
+}
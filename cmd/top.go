@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+func runTop(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	addr := fs.String("addr", defaultAdminAddr(), "admin API address")
+	token := fs.String("token", os.Getenv("ADMIN_TOKEN"), "admin API token (defaults to $ADMIN_TOKEN)")
+	interval := fs.Duration("interval", time.Second, "refresh interval")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dynamicproxy top [flags]")
+		fmt.Fprintln(fs.Output(), "Shows live requests, tunnels, bandwidth and errors of a running proxy.")
+		fmt.Fprintln(fs.Output(), "Keys: up/down or j/k select, x terminate selected connection, q quit.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	client := &adminClient{base: "http://" + *addr, token: *token, http: &http.Client{Timeout: 5 * time.Second}}
+	if _, err := client.activity(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reach admin API at %s: %v\n", *addr, err)
+		return 1
+	}
+
+	keys := make(chan byte, 16)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err == nil {
+			defer term.Restore(fd, state)
+		}
+		go readKeys(os.Stdin, keys)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	fmt.Print("\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\r\n")
+
+	view := &topView{lastBytes: map[uint64][2]int64{}}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		view.refresh(client)
+		fmt.Print(view.render())
+
+		select {
+		case <-interrupt:
+			return 0
+		case <-ticker.C:
+		case key := <-keys:
+			switch key {
+			case 'q', 3: // 3 is Ctrl-C in raw mode
+				return 0
+			case 'k', 'A':
+				view.move(-1)
+			case 'j', 'B':
+				view.move(1)
+			case 'x':
+				if c, ok := view.selected(); ok {
+					view.message = client.terminate(c.ID)
+				}
+			}
+		}
+	}
+}
+
+func defaultAdminAddr() string {
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" || strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + config.GetEnv("ADMIN_ADDR", ":9090")
+	}
+	return addr
+}
+
+// readKeys forwards single key presses. Arrow keys arrive as ESC [ A/B and
+// are forwarded as their final byte.
+func readKeys(r io.Reader, keys chan<- byte) {
+	buf := make([]byte, 8)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		if n >= 3 && buf[0] == 0x1b && buf[1] == '[' {
+			keys <- buf[2]
+			continue
+		}
+		for _, b := range buf[:n] {
+			keys <- b
+		}
+	}
+}
+
+type adminClient struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+type activitySnapshot struct {
+	Active []proxy.ConnInfo `json:"active"`
+	Recent []proxy.ConnInfo `json:"recent"`
+}
+
+func (c *adminClient) do(method, path string, v any) error {
+	req, err := http.NewRequest(method, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *adminClient) activity() (activitySnapshot, error) {
+	var a activitySnapshot
+	err := c.do(http.MethodGet, "/admin/activity", &a)
+	return a, err
+}
+
+func (c *adminClient) terminate(id uint64) string {
+	if err := c.do(http.MethodDelete, fmt.Sprintf("/admin/connections/%d", id), nil); err != nil {
+		return "terminate failed: " + err.Error()
+	}
+	return fmt.Sprintf("terminated connection %d", id)
+}
+
+type topView struct {
+	snapshot  activitySnapshot
+	err       error
+	message   string
+	cursor    int
+	lastPoll  time.Time
+	lastBytes map[uint64][2]int64
+	upRate    float64
+	downRate  float64
+}
+
+func (v *topView) refresh(client *adminClient) {
+	snapshot, err := client.activity()
+	v.err = err
+	if err != nil {
+		return
+	}
+	now := time.Now()
+
+	// Bandwidth is the growth of per-connection byte counters since the
+	// previous poll, including connections that finished in between.
+	var up, down int64
+	seen := map[uint64][2]int64{}
+	count := func(c proxy.ConnInfo) {
+		last := v.lastBytes[c.ID]
+		up += c.BytesSent - last[0]
+		down += c.BytesReceived - last[1]
+		seen[c.ID] = [2]int64{c.BytesSent, c.BytesReceived}
+	}
+	for _, c := range snapshot.Active {
+		count(c)
+	}
+	for _, c := range snapshot.Recent {
+		if _, tracked := v.lastBytes[c.ID]; tracked || c.Started.After(v.lastPoll) {
+			count(c)
+		}
+	}
+	if !v.lastPoll.IsZero() {
+		elapsed := now.Sub(v.lastPoll).Seconds()
+		v.upRate, v.downRate = float64(up)/elapsed, float64(down)/elapsed
+	}
+	v.snapshot, v.lastBytes, v.lastPoll = snapshot, seen, now
+	v.move(0)
+}
+
+func (v *topView) move(delta int) {
+	v.cursor = max(0, min(v.cursor+delta, len(v.snapshot.Active)-1))
+}
+
+func (v *topView) selected() (proxy.ConnInfo, bool) {
+	if v.cursor < len(v.snapshot.Active) {
+		return v.snapshot.Active[v.cursor], true
+	}
+	return proxy.ConnInfo{}, false
+}
+
+func (v *topView) render() string {
+	width, height := 120, 40
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		width, height = w, h
+	}
+
+	// Lines are clipped to the terminal width before styling so escape
+	// sequences are never cut off.
+	var lines []string
+	styled := func(style, format string, args ...any) {
+		line := fmt.Sprintf(format, args...)
+		if len(line) > width {
+			line = line[:width]
+		}
+		if style != "" {
+			line = style + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	add := func(format string, args ...any) { styled("", format, args...) }
+
+	var requests, tunnels, errors int
+	for _, c := range v.snapshot.Active {
+		if c.Kind == "tunnel" {
+			tunnels++
+		} else {
+			requests++
+		}
+	}
+	var recentErrors []proxy.ConnInfo
+	for _, c := range v.snapshot.Recent {
+		if c.Error != "" || c.Status >= 500 {
+			errors++
+			recentErrors = append(recentErrors, c)
+		}
+	}
+
+	add("dynamicproxy top - %s", time.Now().Format("15:04:05"))
+	add("requests: %d  tunnels: %d  up: %s/s  down: %s/s  recent errors: %d",
+		requests, tunnels, humanBytes(v.upRate), humanBytes(v.downRate), errors)
+	if v.err != nil {
+		styled("\x1b[31m", "error: %v", v.err)
+	} else {
+		add("%s", v.message)
+	}
+	add("")
+	styled("\x1b[7m", "%-6s %-7s %-21s %-32s %-19s %8s %10s %10s", "ID", "KIND", "CLIENT", "DESTINATION", "ROUTE", "AGE", "SENT", "RECEIVED")
+
+	errorRows := min(len(recentErrors), 5)
+	rows := max(height-len(lines)-errorRows-3, 1)
+	for i, c := range v.snapshot.Active {
+		if i >= rows {
+			add("... %d more", len(v.snapshot.Active)-rows)
+			break
+		}
+		style := ""
+		if i == v.cursor {
+			style = "\x1b[1;36m"
+		}
+		styled(style, "%-6d %-7s %-21s %-32s %-19s %8s %10s %10s", c.ID, c.Kind, truncate(c.Client, 21),
+			truncate(c.Host, 32), c.Route, c.Duration.Round(time.Second), humanBytes(float64(c.BytesSent)), humanBytes(float64(c.BytesReceived)))
+	}
+
+	add("")
+	styled("\x1b[1m", "recent errors")
+	for _, c := range recentErrors[:errorRows] {
+		add("%s %s %s %d %s", c.Started.Format("15:04:05"), c.Method, c.Host, c.Status, c.Error)
+	}
+
+	return "\x1b[H\x1b[2J" + strings.Join(lines, "\r\n")
+}
+
+func humanBytes(n float64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", n/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", n/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", n/(1<<10))
+	}
+	return fmt.Sprintf("%.0fB", n)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "…"
+}
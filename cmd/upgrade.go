@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/admin"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+	"github.com/cavoq/DynamicProxy/internal/systemd"
+	"github.com/cavoq/DynamicProxy/internal/upgrade"
+)
+
+// upgradeReadyTimeout is how long the new process may take to start serving.
+const upgradeReadyTimeout = 30 * time.Second
+
+// handleUpgrades starts the binary anew, with the listening sockets handed
+// over, each time upgrade.Signal is received. Once the new process is
+// serving, this one stops accepting, drains its connections for up to
+// DRAIN_TIMEOUT and returns.
+func handleUpgrades(upgrader *upgrade.Upgrader, server *proxy.Server, adminListeners []net.Listener) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, upgrade.Signal)
+	defer signal.Stop(signals)
+
+	for range signals {
+		log.Print("Upgrade requested, starting new process")
+		notifySystemd(systemd.Reloading)
+		if err := upgrader.Upgrade(upgradeReadyTimeout); err != nil {
+			log.Printf("Upgrade failed, keeping the current process: %v", err)
+			notifySystemd(systemd.Ready)
+			continue
+		}
+
+		log.Print("New process is serving, draining connections")
+		drain(server, adminListeners)
+		return
+	}
+}
+
+// handleShutdown waits for SIGTERM or SIGINT, then stops accepting and
+// drains the server's connections for up to DRAIN_TIMEOUT. A second signal
+// exits right away.
+func handleShutdown(server *proxy.Server, adminListeners []net.Listener) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	sig := <-signals
+	log.Printf("Shutting down on %s, draining connections", sig)
+	notifySystemd(systemd.Stopping)
+	go func() {
+		sig := <-signals
+		log.Printf("Exiting on %s without waiting for %d connections", sig, len(server.Activity().Active()))
+		os.Exit(1)
+	}()
+	drain(server, adminListeners)
+}
+
+// handleReloads reloads the configuration, as POST /admin/reload does, each
+// time SIGHUP is received.
+func handleReloads(server *proxy.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := admin.Reload(server, "SIGHUP"); err != nil {
+			log.Printf("Failed to reload config: %v", err)
+		}
+	}
+}
+
+// handleReopens reopens FLOW_LOG and AUTH_AUDIT_LOG each time reopenSignal
+// is received, so that they can be rotated by moving them away first. The
+// files in use are kept if the new ones cannot be opened.
+func handleReopens(server *proxy.Server, logs logFiles) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, reopenSignal)
+	for range signals {
+		cfg := server.Config()
+		reopened, err := openLogFiles(cfg)
+		if err != nil {
+			log.Printf("Failed to reopen logs: %v", err)
+			continue
+		}
+		reopened.install(server, cfg)
+		logs.close()
+		logs = reopened
+		log.Print("Reopened logs")
+	}
+}
+
+// handleDumps writes a diagnostic dump each time sig is received.
+func handleDumps(server *proxy.Server, sig os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+	for range signals {
+		path, err := admin.WriteDump(server)
+		if err != nil {
+			log.Printf("Diagnostic dump failed: %v", err)
+			continue
+		}
+		log.Printf("Wrote diagnostic dump to %s", path)
+	}
+}
+
+func drain(server *proxy.Server, adminListeners []net.Listener) {
+	for _, l := range adminListeners {
+		l.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), server.Config().DrainTimeout)
+	defer cancel()
+	if err := server.Drain(ctx); err != nil {
+		log.Printf("Drain incomplete: %v", err)
+	}
+}
+
+// runWatchdog sends systemd watchdog keep-alives at half the interval the
+// unit's WatchdogSec= asks for, if it is set.
+func runWatchdog() {
+	interval := systemd.WatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval / 2) {
+		notifySystemd(systemd.Watchdog)
+	}
+}
+
+func notifySystemd(state ...string) {
+	if err := systemd.Notify(state...); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
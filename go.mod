@@ -1,7 +1,19 @@
 module github.com/cavoq/DynamicProxy
 
-go 1.24
+go 1.24.0
 
 toolchain go1.24.5
 
-require github.com/Azure/go-ntlmssp v0.1.0
+require (
+	github.com/Azure/go-ntlmssp v0.1.0
+	golang.org/x/net v0.49.0
+	golang.org/x/sys v0.40.0
+	golang.org/x/term v0.39.0
+	google.golang.org/grpc v1.80.0
+	google.golang.org/protobuf v1.36.12
+)
+
+require (
+	golang.org/x/text v0.33.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260120221211-b8f7ae30c516 // indirect
+)
@@ -149,7 +149,7 @@ func startDynamicProxy(t *testing.T, upstreamURL, exceptions string) *dynamicPro
 	}
 
 	if _, err := os.Stat(absBinaryPath); err != nil {
-		build := exec.Command("go", "build", "-o", binaryPath, "./cmd/main.go")
+		build := exec.Command("go", "build", "-o", binaryPath, "./cmd")
 		build.Stdout = os.Stdout
 		build.Stderr = os.Stderr
 		if err := build.Run(); err != nil {
@@ -0,0 +1,305 @@
+// Package admin implements the authenticated HTTP API used to inspect and
+// change a running proxy. It is served on its own listener so it is never
+// reachable through the proxy port.
+package admin
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+	"github.com/cavoq/DynamicProxy/internal/version"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+type API struct {
+	server *proxy.Server
+	mux    *http.ServeMux
+}
+
+func New(server *proxy.Server) *API {
+	a := &API{server: server, mux: http.NewServeMux()}
+	a.mux.HandleFunc("GET /admin/config", a.getConfig)
+	a.mux.HandleFunc("GET /admin/exceptions", a.listExceptions)
+	a.mux.HandleFunc("POST /admin/exceptions", a.handleAddException)
+	a.mux.HandleFunc("DELETE /admin/exceptions", a.handleDeleteException)
+	a.mux.HandleFunc("PUT /admin/upstream", a.handleSetUpstream)
+	a.mux.HandleFunc("GET /admin/upstreams", a.listUpstreams)
+	a.mux.HandleFunc("PUT /admin/fail-open", a.handleSetFailOpen)
+	a.mux.HandleFunc("GET /admin/dns", a.getDNSCache)
+	a.mux.HandleFunc("DELETE /admin/dns/cache", a.handlePurgeDNSCache)
+	a.mux.HandleFunc("GET /admin/version", a.getVersion)
+	a.mux.HandleFunc("GET /admin/activity", a.getActivity)
+	a.mux.HandleFunc("GET /admin/events", a.streamEvents)
+	a.mux.HandleFunc("POST /admin/reload", a.handleReload)
+	a.mux.HandleFunc("GET /admin/connections", a.listConnections)
+	a.mux.HandleFunc("DELETE /admin/connections/{id}", a.handleCloseConnection)
+	a.mux.HandleFunc("POST /admin/dump", a.handleDump)
+	a.mux.HandleFunc("GET /admin/clients", a.listClients)
+	a.mux.HandleFunc("GET /admin/threat-feeds", a.listThreatFeeds)
+	a.mux.HandleFunc("GET /admin/latency", a.getLatency)
+	a.mux.HandleFunc("GET /admin/top", a.getTopTalkers)
+	a.mux.HandleFunc("GET /admin/decisions", a.getDecisions)
+
+	ui, _ := fs.Sub(uiFiles, "ui")
+	a.mux.Handle("GET /", http.FileServerFS(ui))
+	return a
+}
+
+// ListenAndServe serves the admin API on cfg.AdminAddr. An admin token is
+// mandatory, since the API can redirect all proxied traffic.
+func ListenAndServe(cfg config.Config, server *proxy.Server) error {
+	if cfg.AdminToken == "" {
+		return errors.New("ADMIN_TOKEN must be set to enable the admin API")
+	}
+	l, err := net.Listen("tcp", cfg.AdminAddr)
+	if err != nil {
+		return err
+	}
+	return Serve(l, cfg, server)
+}
+
+// Serve serves the admin API on l.
+func Serve(l net.Listener, cfg config.Config, server *proxy.Server) error {
+	if cfg.AdminToken == "" {
+		l.Close()
+		return errors.New("ADMIN_TOKEN must be set to enable the admin API")
+	}
+	srv := &http.Server{
+		Handler:           New(server),
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		ReadTimeout:       cfg.ServerReadTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+		IdleTimeout:       cfg.ServerIdleTimeout,
+		MaxHeaderBytes:    cfg.ServerMaxHeaderBytes,
+	}
+	return srv.Serve(l)
+}
+
+// ServeHTTP requires the admin token for everything below /admin/. The
+// dashboard's static files are public; they hold no data and ask for the
+// token themselves.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/admin/") && !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dynamicproxy-admin"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *API) authorized(r *http.Request) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && validToken(got, a.server.Config().AdminToken)
+}
+
+func (a *API) getConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, redact(a.server.Config()))
+}
+
+func (a *API) listExceptions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.Config().ProxyExceptions)
+}
+
+func (a *API) listUpstreams(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.Upstreams())
+}
+
+func (a *API) getDNSCache(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.DNSCache())
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+func (a *API) handlePurgeDNSCache(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, purgeResponse{Purged: a.server.PurgeDNSCache()})
+}
+
+func (a *API) getVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
+
+type activityResponse struct {
+	Active []proxy.ConnInfo `json:"active"`
+	Recent []proxy.ConnInfo `json:"recent"`
+}
+
+func (a *API) getActivity(w http.ResponseWriter, r *http.Request) {
+	activity := a.server.Activity()
+	writeJSON(w, http.StatusOK, activityResponse{
+		Active: activity.Active(),
+		Recent: activity.Recent(),
+	})
+}
+
+func (a *API) listConnections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.Activity().Active())
+}
+
+func (a *API) listClients(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.ClientUsage())
+}
+
+func (a *API) listThreatFeeds(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.ThreatFeeds())
+}
+
+func (a *API) getLatency(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.Latency())
+}
+
+func (a *API) getDecisions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.server.Decisions())
+}
+
+func (a *API) getTopTalkers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 0
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	top, err := a.topTalkers(query.Get("window"), limit, query.Get("by"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, top)
+}
+
+func (a *API) handleCloseConnection(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid connection id")
+		return
+	}
+	if err := a.closeConnection(id); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type dumpResponse struct {
+	File string `json:"file"`
+}
+
+func (a *API) handleDump(w http.ResponseWriter, r *http.Request) {
+	path, err := WriteDump(a.server)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("dump failed: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, dumpResponse{File: path})
+}
+
+type reloadResponse struct {
+	Changes []reloadChange `json:"changes"`
+}
+
+func (a *API) handleReload(w http.ResponseWriter, r *http.Request) {
+	changes, err := a.reload("Admin API")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("reload failed: %v", err))
+		return
+	}
+	if changes == nil {
+		changes = []reloadChange{}
+	}
+	writeJSON(w, http.StatusOK, reloadResponse{Changes: changes})
+}
+
+type exceptionRequest struct {
+	Pattern string `json:"pattern"`
+}
+
+func (a *API) handleAddException(w http.ResponseWriter, r *http.Request) {
+	var body exceptionRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+	cfg, err := a.addException(body.Pattern)
+	writeResult(w, http.StatusCreated, cfg, err)
+}
+
+func (a *API) handleDeleteException(w http.ResponseWriter, r *http.Request) {
+	cfg, err := a.deleteException(r.URL.Query().Get("pattern"))
+	writeResult(w, http.StatusOK, cfg, err)
+}
+
+type upstreamRequest struct {
+	Upstream string `json:"upstream"`
+}
+
+func (a *API) handleSetUpstream(w http.ResponseWriter, r *http.Request) {
+	var body upstreamRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+	cfg, err := a.setUpstream(body.Upstream)
+	writeResult(w, http.StatusOK, cfg, err)
+}
+
+type failOpenRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (a *API) handleSetFailOpen(w http.ResponseWriter, r *http.Request) {
+	var body failOpenRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+	cfg, err := a.setFailOpen(body.Enabled)
+	writeResult(w, http.StatusOK, cfg, err)
+}
+
+// writeResult responds with the configuration resulting from an operation,
+// or with the error mapped to an HTTP status.
+func writeResult(w http.ResponseWriter, status int, cfg config.Config, err error) {
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errInvalidInput):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, status, redact(cfg))
+	}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
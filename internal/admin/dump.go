@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+	"github.com/cavoq/DynamicProxy/internal/version"
+)
+
+// WriteDump writes a diagnostic snapshot of server, for attaching to bug
+// reports, to a timestamped file in DUMP_DIR and returns its path. It holds
+// the version, the configuration with its secrets redacted, the active
+// connections with their ages, the upstreams, the connection pools and the
+// stacks of all goroutines.
+func WriteDump(server *proxy.Server) (string, error) {
+	dir := server.Config().DumpDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	now := time.Now()
+	path := filepath.Join(dir, "dynamicproxy-dump-"+now.UTC().Format("20060102T150405.000Z")+".txt")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(f)
+	writeDump(w, server, now)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+func writeDump(w io.Writer, server *proxy.Server, now time.Time) {
+	fmt.Fprintf(w, "DynamicProxy diagnostic dump, %s\n", now.Format(time.RFC3339Nano))
+	dumpJSON(w, "Version", version.Get())
+	dumpJSON(w, "Configuration", redact(server.Config()))
+
+	active := server.Activity().Active()
+	fmt.Fprintf(w, "\n== Active connections (%d) ==\n", len(active))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tCLIENT\tMETHOD\tHOST\tROUTE\tUPSTREAM\tAGE\tSENT\tRECEIVED")
+	for _, c := range active {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", c.ID, c.Kind, c.Client, c.Method, c.Host, c.Route, c.Upstream,
+			now.Sub(c.Started).Round(time.Millisecond), c.BytesSent, c.BytesReceived)
+	}
+	tw.Flush()
+
+	dumpJSON(w, "Upstreams", server.Upstreams())
+	dumpJSON(w, "Pools", server.Pools())
+
+	fmt.Fprintf(w, "\n== Goroutines (%d) ==\n", runtime.NumGoroutine())
+	_ = pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func dumpJSON(w io.Writer, section string, v any) {
+	fmt.Fprintf(w, "\n== %s ==\n", section)
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "%s\n", data)
+}
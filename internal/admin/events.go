@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+// eventKeepAlive is how often an idle event stream gets a comment, so that
+// proxies and load balancers in between do not time it out.
+const eventKeepAlive = 15 * time.Second
+
+// streamEvents sends the connection events as server-sent events, one JSON
+// proxy.ConnEvent per message, until the client goes away. The host query
+// parameter narrows them down to destinations matching a pattern written
+// as in PROXY_EXCEPTIONS, client to one client address. Events a slow
+// client cannot keep up with are dropped.
+func (a *API) streamEvents(w http.ResponseWriter, r *http.Request) {
+	host, client := r.URL.Query().Get("host"), r.URL.Query().Get("client")
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	_ = rc.SetWriteDeadline(time.Time{})
+	events, cancel := a.server.Activity().Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			if !eventMatches(event.Conn, host, client) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+	}
+}
+
+func eventMatches(conn proxy.ConnInfo, host, client string) bool {
+	if host != "" && !config.IsException(conn.Host, []string{host}) {
+		return false
+	}
+	if client != "" && conn.Client != client {
+		ip, _, err := net.SplitHostPort(conn.Client)
+		return err == nil && ip == client
+	}
+	return true
+}
@@ -0,0 +1,366 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+	"github.com/cavoq/DynamicProxy/internal/version"
+	adminv1 "github.com/cavoq/DynamicProxy/proto/dynamicproxy/admin/v1"
+)
+
+//go:generate protoc -I ../../proto --go_out=../../proto --go_opt=paths=source_relative --go-grpc_out=../../proto --go-grpc_opt=paths=source_relative dynamicproxy/admin/v1/admin.proto
+
+type grpcService struct {
+	adminv1.UnimplementedAdminServiceServer
+	api *API
+}
+
+// NewGRPCServer returns a gRPC server exposing the admin API as
+// dynamicproxy.admin.v1.AdminService. Calls must carry the admin token as
+// "authorization: Bearer <token>" metadata.
+func NewGRPCServer(server *proxy.Server) *grpc.Server {
+	api := New(server)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := api.authorizeGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := api.authorizeGRPC(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	adminv1.RegisterAdminServiceServer(srv, &grpcService{api: api})
+	return srv
+}
+
+// ListenAndServeGRPC serves the gRPC admin API on cfg.GRPCAdminAddr.
+func ListenAndServeGRPC(cfg config.Config, server *proxy.Server) error {
+	if cfg.AdminToken == "" {
+		return errors.New("ADMIN_TOKEN must be set to enable the gRPC admin API")
+	}
+	l, err := net.Listen("tcp", cfg.GRPCAdminAddr)
+	if err != nil {
+		return err
+	}
+	return ServeGRPC(l, cfg, server)
+}
+
+// ServeGRPC serves the gRPC admin API on l.
+func ServeGRPC(l net.Listener, cfg config.Config, server *proxy.Server) error {
+	if cfg.AdminToken == "" {
+		l.Close()
+		return errors.New("ADMIN_TOKEN must be set to enable the gRPC admin API")
+	}
+	return NewGRPCServer(server).Serve(l)
+}
+
+func (a *API) authorizeGRPC(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if got, ok := strings.CutPrefix(v, "Bearer "); ok && validToken(got, a.server.Config().AdminToken) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+func (s *grpcService) GetVersion(context.Context, *adminv1.GetVersionRequest) (*adminv1.VersionInfo, error) {
+	info := version.Get()
+	return &adminv1.VersionInfo{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		Date:      info.Date,
+		GoVersion: info.GoVersion,
+		Platform:  info.Platform,
+	}, nil
+}
+
+func (s *grpcService) GetConfig(context.Context, *adminv1.GetConfigRequest) (*adminv1.Config, error) {
+	return toProtoConfig(s.api.server.Config()), nil
+}
+
+func (s *grpcService) ListExceptions(context.Context, *adminv1.ListExceptionsRequest) (*adminv1.ListExceptionsResponse, error) {
+	return &adminv1.ListExceptionsResponse{Patterns: s.api.server.Config().ProxyExceptions}, nil
+}
+
+func (s *grpcService) AddException(_ context.Context, req *adminv1.AddExceptionRequest) (*adminv1.Config, error) {
+	return toProtoResult(s.api.addException(req.GetPattern()))
+}
+
+func (s *grpcService) DeleteException(_ context.Context, req *adminv1.DeleteExceptionRequest) (*adminv1.Config, error) {
+	return toProtoResult(s.api.deleteException(req.GetPattern()))
+}
+
+func (s *grpcService) SetUpstream(_ context.Context, req *adminv1.SetUpstreamRequest) (*adminv1.Config, error) {
+	return toProtoResult(s.api.setUpstream(req.GetUpstream()))
+}
+
+func (s *grpcService) SetFailOpen(_ context.Context, req *adminv1.SetFailOpenRequest) (*adminv1.Config, error) {
+	return toProtoResult(s.api.setFailOpen(req.GetEnabled()))
+}
+
+func (s *grpcService) GetDNSCache(context.Context, *adminv1.GetDNSCacheRequest) (*adminv1.DNSCacheStats, error) {
+	stats := s.api.server.DNSCache()
+	return &adminv1.DNSCacheStats{
+		Entries:      int64(stats.Entries),
+		Hits:         stats.Hits,
+		Misses:       stats.Misses,
+		NegativeHits: stats.Negatives,
+	}, nil
+}
+
+func (s *grpcService) PurgeDNSCache(context.Context, *adminv1.PurgeDNSCacheRequest) (*adminv1.PurgeDNSCacheResponse, error) {
+	return &adminv1.PurgeDNSCacheResponse{Purged: int64(s.api.server.PurgeDNSCache())}, nil
+}
+
+func (s *grpcService) Reload(context.Context, *adminv1.ReloadRequest) (*adminv1.ReloadResponse, error) {
+	changes, err := s.api.reload("gRPC admin API")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "reload failed: %v", err)
+	}
+	resp := &adminv1.ReloadResponse{}
+	for _, c := range changes {
+		resp.Changes = append(resp.Changes, &adminv1.ConfigChange{
+			Field:           c.Field,
+			Old:             c.Old,
+			New:             c.New,
+			RestartRequired: c.RestartRequired,
+		})
+	}
+	return resp, nil
+}
+
+func (s *grpcService) GetActivity(context.Context, *adminv1.GetActivityRequest) (*adminv1.Activity, error) {
+	activity := s.api.server.Activity()
+	return &adminv1.Activity{
+		Active: toProtoConns(activity.Active()),
+		Recent: toProtoConns(activity.Recent()),
+	}, nil
+}
+
+func (s *grpcService) ListUpstreams(context.Context, *adminv1.ListUpstreamsRequest) (*adminv1.ListUpstreamsResponse, error) {
+	var upstreams []*adminv1.UpstreamHealth
+	for _, u := range s.api.server.Upstreams() {
+		health := &adminv1.UpstreamHealth{
+			Addr:    u.Addr,
+			Healthy: u.Healthy,
+			Circuit: u.Circuit,
+			Latency: durationpb.New(u.Latency),
+			Error:   u.Error,
+		}
+		if !u.LastCheck.IsZero() {
+			health.LastCheck = timestamppb.New(u.LastCheck)
+		}
+		upstreams = append(upstreams, health)
+	}
+	return &adminv1.ListUpstreamsResponse{Upstreams: upstreams}, nil
+}
+
+func (s *grpcService) ListConnections(context.Context, *adminv1.ListConnectionsRequest) (*adminv1.ListConnectionsResponse, error) {
+	return &adminv1.ListConnectionsResponse{Connections: toProtoConns(s.api.server.Activity().Active())}, nil
+}
+
+func (s *grpcService) CloseConnection(_ context.Context, req *adminv1.CloseConnectionRequest) (*adminv1.CloseConnectionResponse, error) {
+	if err := s.api.closeConnection(req.GetId()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &adminv1.CloseConnectionResponse{}, nil
+}
+
+func (s *grpcService) StreamEvents(req *adminv1.StreamEventsRequest, stream grpc.ServerStreamingServer[adminv1.ConnEvent]) error {
+	events, cancel := s.api.server.Activity().Subscribe()
+	defer cancel()
+	// Send headers right away so clients know the subscription is active.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			if !eventMatches(event.Conn, req.GetHost(), req.GetClient()) {
+				continue
+			}
+			if err := stream.Send(toProtoEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcService) ListClients(context.Context, *adminv1.ListClientsRequest) (*adminv1.ListClientsResponse, error) {
+	var clients []*adminv1.ClientUsage
+	for _, c := range s.api.server.ClientUsage() {
+		clients = append(clients, &adminv1.ClientUsage{
+			Client:        c.Client,
+			LastHour:      c.LastHour,
+			LastDay:       c.LastDay,
+			Last30Days:    c.Last30Days,
+			QuotaExceeded: c.QuotaExceeded,
+		})
+	}
+	return &adminv1.ListClientsResponse{Clients: clients}, nil
+}
+
+func (s *grpcService) ListThreatFeeds(context.Context, *adminv1.ListThreatFeedsRequest) (*adminv1.ListThreatFeedsResponse, error) {
+	var feeds []*adminv1.ThreatFeed
+	for _, f := range s.api.server.ThreatFeeds() {
+		feed := &adminv1.ThreatFeed{
+			Feed:    f.Feed,
+			Entries: int64(f.Entries),
+			Hits:    f.Hits,
+			Error:   f.Error,
+		}
+		if !f.Updated.IsZero() {
+			feed.Updated = timestamppb.New(f.Updated)
+		}
+		feeds = append(feeds, feed)
+	}
+	return &adminv1.ListThreatFeedsResponse{Feeds: feeds}, nil
+}
+
+func (s *grpcService) GetLatency(context.Context, *adminv1.GetLatencyRequest) (*adminv1.GetLatencyResponse, error) {
+	var histograms []*adminv1.LatencyHistogram
+	for _, h := range s.api.server.Latency() {
+		histogram := &adminv1.LatencyHistogram{
+			Kind:     h.Kind,
+			Route:    h.Route,
+			Upstream: h.Upstream,
+			Count:    h.Count,
+			Sum:      durationpb.New(h.Sum),
+		}
+		for _, b := range h.Buckets {
+			histogram.Buckets = append(histogram.Buckets, &adminv1.LatencyBucket{Le: durationpb.New(b.LE), Count: b.Count})
+		}
+		histograms = append(histograms, histogram)
+	}
+	return &adminv1.GetLatencyResponse{Histograms: histograms}, nil
+}
+
+func (s *grpcService) GetTopTalkers(_ context.Context, req *adminv1.GetTopTalkersRequest) (*adminv1.TopTalkers, error) {
+	top, err := s.api.topTalkers(req.GetWindow(), int(req.GetLimit()), req.GetBy())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &adminv1.TopTalkers{
+		Window:       top.Window,
+		Bytes:        top.Bytes,
+		Requests:     top.Requests,
+		Clients:      toProtoTalkers(top.Clients),
+		Destinations: toProtoTalkers(top.Destinations),
+	}, nil
+}
+
+func (s *grpcService) WriteDump(context.Context, *adminv1.WriteDumpRequest) (*adminv1.WriteDumpResponse, error) {
+	path, err := WriteDump(s.api.server)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "dump failed: %v", err)
+	}
+	return &adminv1.WriteDumpResponse{File: path}, nil
+}
+
+func (s *grpcService) GetDecisions(context.Context, *adminv1.GetDecisionsRequest) (*adminv1.GetDecisionsResponse, error) {
+	var decisions []*adminv1.DecisionCount
+	for _, d := range s.api.server.Decisions() {
+		decisions = append(decisions, &adminv1.DecisionCount{Route: d.Route, Rule: d.Rule, Count: d.Count})
+	}
+	return &adminv1.GetDecisionsResponse{Decisions: decisions}, nil
+}
+
+func toProtoResult(cfg config.Config, err error) (*adminv1.Config, error) {
+	switch {
+	case errors.Is(err, errNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errInvalidInput):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toProtoConfig(cfg), nil
+}
+
+func toProtoConfig(cfg config.Config) *adminv1.Config {
+	return &adminv1.Config{
+		UpstreamProxy:   cfg.UpstreamProxy,
+		ProxyExceptions: cfg.ProxyExceptions,
+		ListenAddr:      cfg.ListenAddr,
+		ProxyAuth:       cfg.ProxyAuth,
+		FailOpen:        cfg.FailOpen,
+		ConfigFile:      cfg.ConfigFile,
+	}
+}
+
+func toProtoConns(conns []proxy.ConnInfo) []*adminv1.ConnInfo {
+	out := make([]*adminv1.ConnInfo, 0, len(conns))
+	for _, c := range conns {
+		out = append(out, toProtoConn(c))
+	}
+	return out
+}
+
+func toProtoConn(c proxy.ConnInfo) *adminv1.ConnInfo {
+	conn := &adminv1.ConnInfo{
+		Id:            c.ID,
+		Kind:          c.Kind,
+		Client:        c.Client,
+		Method:        c.Method,
+		Host:          c.Host,
+		Route:         c.Route,
+		Status:        int32(c.Status),
+		Error:         c.Error,
+		Started:       timestamppb.New(c.Started),
+		Duration:      durationpb.New(c.Duration),
+		BytesSent:     c.BytesSent,
+		BytesReceived: c.BytesReceived,
+		Destination:   c.Destination,
+		Sni:           c.SNI,
+		Upstream:      c.Upstream,
+		Ja3:           c.JA3,
+		Ja4:           c.JA4,
+		Country:       c.Country,
+		Asn:           c.ASN,
+		Threat:        c.Threat,
+		App:           c.App,
+	}
+	if c.Setup > 0 {
+		conn.Setup = durationpb.New(c.Setup)
+	}
+	return conn
+}
+
+func toProtoTalkers(talkers []proxy.Talker) []*adminv1.Talker {
+	out := make([]*adminv1.Talker, 0, len(talkers))
+	for _, t := range talkers {
+		out = append(out, &adminv1.Talker{Name: t.Name, Bytes: t.Bytes, Requests: t.Requests})
+	}
+	return out
+}
+
+func toProtoEvent(event proxy.ConnEvent) *adminv1.ConnEvent {
+	eventType := adminv1.ConnEvent_TYPE_UNSPECIFIED
+	switch event.Type {
+	case proxy.ConnStarted:
+		eventType = adminv1.ConnEvent_TYPE_STARTED
+	case proxy.ConnFinished:
+		eventType = adminv1.ConnEvent_TYPE_FINISHED
+	}
+	return &adminv1.ConnEvent{Type: eventType, Conn: toProtoConn(event.Conn)}
+}
@@ -0,0 +1,344 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+	adminv1 "github.com/cavoq/DynamicProxy/proto/dynamicproxy/admin/v1"
+)
+
+func newTestGRPC(t *testing.T) (*proxy.Server, adminv1.AdminServiceClient) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.AdminToken = testToken
+	server := proxy.NewServer(cfg)
+
+	l := bufconn.Listen(1 << 20)
+	srv := NewGRPCServer(server)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return server, adminv1.NewAdminServiceClient(conn)
+}
+
+// getDirect sends a request through server to a target it reaches
+// directly.
+func getDirect(t *testing.T, server *proxy.Server) {
+	t.Helper()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(target.Close)
+	server.SetConfig(config.Config{ProxyExceptions: []string{target.Listener.Addr().String()}, AdminToken: testToken})
+	proxySrv := httptest.NewServer(server)
+	t.Cleanup(proxySrv.Close)
+	proxyURL, _ := url.Parse(proxySrv.URL)
+	resp, err := (&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}).Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func authContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+testToken)
+}
+
+func TestGRPCRequiresToken(t *testing.T) {
+	_, client := newTestGRPC(t)
+
+	_, err := client.GetConfig(context.Background(), &adminv1.GetConfigRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("GetConfig without token: %v; expected Unauthenticated", err)
+	}
+}
+
+func TestGRPCManageConfig(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+
+	if _, err := client.AddException(ctx, &adminv1.AddExceptionRequest{Pattern: "*.internal"}); err != nil {
+		t.Fatalf("AddException: %v", err)
+	}
+	if _, err := client.SetUpstream(ctx, &adminv1.SetUpstreamRequest{Upstream: "proxy-b:3128"}); err != nil {
+		t.Fatalf("SetUpstream: %v", err)
+	}
+	cfg, err := client.SetFailOpen(ctx, &adminv1.SetFailOpenRequest{Enabled: true})
+	if err != nil {
+		t.Fatalf("SetFailOpen: %v", err)
+	}
+	if cfg.GetUpstreamProxy() != "proxy-b:3128" || !cfg.GetFailOpen() || len(cfg.GetProxyExceptions()) != 1 {
+		t.Fatalf("unexpected config %v", cfg)
+	}
+	if got := server.Config().UpstreamProxy; got != "proxy-b:3128" {
+		t.Fatalf("server upstream = %q", got)
+	}
+
+	_, err = client.DeleteException(ctx, &adminv1.DeleteExceptionRequest{Pattern: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("DeleteException missing: %v; expected NotFound", err)
+	}
+}
+
+func TestGRPCStreamEvents(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+
+	stream, err := client.StreamEvents(ctx, &adminv1.StreamEventsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the subscription before generating traffic.
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(target.Close)
+	server.SetConfig(config.Config{ProxyExceptions: []string{target.Listener.Addr().String()}, AdminToken: testToken})
+	proxySrv := httptest.NewServer(server)
+	t.Cleanup(proxySrv.Close)
+	proxyURL, _ := url.Parse(proxySrv.URL)
+	client2 := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client2.Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for _, expected := range []adminv1.ConnEvent_Type{adminv1.ConnEvent_TYPE_STARTED, adminv1.ConnEvent_TYPE_FINISHED} {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.GetType() != expected || event.GetConn().GetHost() != target.Listener.Addr().String() {
+			t.Fatalf("unexpected event %v; expected type %v", event, expected)
+		}
+	}
+}
+
+func TestGRPCStreamEventsFilters(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+
+	subscribe := func(ctx context.Context, req *adminv1.StreamEventsRequest) grpc.ServerStreamingClient[adminv1.ConnEvent] {
+		t.Helper()
+		stream, err := client.StreamEvents(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Header(); err != nil {
+			t.Fatal(err)
+		}
+		return stream
+	}
+	matching := subscribe(ctx, &adminv1.StreamEventsRequest{Host: "127.0.0.1", Client: "127.0.0.1"})
+	quietCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	otherHost := subscribe(quietCtx, &adminv1.StreamEventsRequest{Host: "*.example.test"})
+	otherClient := subscribe(quietCtx, &adminv1.StreamEventsRequest{Client: "192.0.2.1"})
+
+	getDirect(t, server)
+
+	if event, err := matching.Recv(); err != nil || event.GetType() != adminv1.ConnEvent_TYPE_STARTED {
+		t.Fatalf("filtered stream got %v, %v; expected the started event", event, err)
+	}
+	for name, stream := range map[string]grpc.ServerStreamingClient[adminv1.ConnEvent]{"host": otherHost, "client": otherClient} {
+		if event, err := stream.Recv(); status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("stream filtered by another %s got %v, %v; expected no events", name, event, err)
+		}
+	}
+}
+
+func TestGRPCConnInfoParity(t *testing.T) {
+	conn := proxy.ConnInfo{
+		ID: 7, Kind: "tunnel", Client: "127.0.0.1:50000", Method: http.MethodConnect, Host: "example.test:443",
+		Route: "upstream", Status: http.StatusOK, Error: "reset", Started: time.Now(), Duration: time.Second,
+		BytesSent: 10, BytesReceived: 20, Destination: "10.0.0.1:3128", SNI: "example.test", Upstream: "proxy:3128",
+		Setup: time.Millisecond, JA3: "ja3", JA4: "ja4", Country: "DE", ASN: 64500, Threat: "feed", App: "git",
+	}
+	v := reflect.ValueOf(conn)
+	for i := range v.NumField() {
+		if v.Field(i).IsZero() {
+			t.Fatalf("ConnInfo.%s is not set; set it so the test covers it", v.Type().Field(i).Name)
+		}
+	}
+
+	rest, err := json.Marshal(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcJSON, err := protojson.Marshal(toProtoConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restFields, grpcFields map[string]any
+	if err := json.Unmarshal(rest, &restFields); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(grpcJSON, &grpcFields); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range restFields {
+		got, ok := grpcFields[name]
+		if !ok {
+			t.Errorf("gRPC ConnInfo lacks %s", name)
+			continue
+		}
+		if s, isString := value.(string); isString && name != "started" && got != s {
+			t.Errorf("gRPC ConnInfo %s = %v; expected %q", name, got, s)
+		}
+	}
+}
+
+func TestGRPCPurgeDNSCache(t *testing.T) {
+	_, client := newTestGRPC(t)
+	ctx := authContext(t)
+
+	if _, err := client.PurgeDNSCache(ctx, &adminv1.PurgeDNSCacheRequest{}); err != nil {
+		t.Fatalf("PurgeDNSCache: %v", err)
+	}
+	stats, err := client.GetDNSCache(ctx, &adminv1.GetDNSCacheRequest{})
+	if err != nil {
+		t.Fatalf("GetDNSCache: %v", err)
+	}
+	if stats.GetEntries() != 0 {
+		t.Fatalf("entries after purge = %d; expected 0", stats.GetEntries())
+	}
+}
+
+func TestGRPCListClients(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+	getDirect(t, server)
+
+	// Connections are accounted once they finish.
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		got, err := client.ListClients(ctx, &adminv1.ListClientsRequest{})
+		if err != nil {
+			t.Fatalf("ListClients: %v", err)
+		}
+		if clients := got.GetClients(); len(clients) == 1 && clients[0].GetClient() == "127.0.0.1" && clients[0].GetLastHour() > 0 {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("clients = %v; expected 127.0.0.1 with traffic in the last hour", clients)
+		}
+	}
+}
+
+func TestGRPCListThreatFeeds(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+	server.SetConfig(config.Config{ThreatFeeds: []string{"https://feeds.example/list.txt?key=secret"}, AdminToken: testToken})
+
+	got, err := client.ListThreatFeeds(ctx, &adminv1.ListThreatFeedsRequest{})
+	if err != nil {
+		t.Fatalf("ListThreatFeeds: %v", err)
+	}
+	if feeds := got.GetFeeds(); len(feeds) != 1 || feeds[0].GetFeed() != "https://feeds.example/list.txt" || feeds[0].GetEntries() != 0 {
+		t.Fatalf("threat feeds = %v; expected the unloaded feed without its key", feeds)
+	}
+}
+
+func TestGRPCGetLatency(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+	getDirect(t, server)
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		got, err := client.GetLatency(ctx, &adminv1.GetLatencyRequest{})
+		if err != nil {
+			t.Fatalf("GetLatency: %v", err)
+		}
+		if h := got.GetHistograms(); len(h) == 1 && h[0].GetKind() == "http" && h[0].GetRoute() == "direct" && h[0].GetCount() == 1 && len(h[0].GetBuckets()) > 0 {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("histograms = %v; expected one direct request", h)
+		}
+	}
+}
+
+func TestGRPCGetTopTalkers(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+	getDirect(t, server)
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		top, err := client.GetTopTalkers(ctx, &adminv1.GetTopTalkersRequest{Window: "5m", By: "requests"})
+		if err != nil {
+			t.Fatalf("GetTopTalkers: %v", err)
+		}
+		if clients := top.GetClients(); top.GetWindow() == "5m" && len(clients) == 1 && clients[0].GetRequests() == 1 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("top talkers = %v; expected one client with one request", top)
+		}
+	}
+
+	_, err := client.GetTopTalkers(ctx, &adminv1.GetTopTalkersRequest{Window: "2h"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("GetTopTalkers over 2h: %v; expected InvalidArgument", err)
+	}
+}
+
+func TestGRPCWriteDump(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+	dir := t.TempDir()
+	server.SetConfig(config.Config{DumpDir: dir, AdminToken: testToken})
+
+	got, err := client.WriteDump(ctx, &adminv1.WriteDumpRequest{})
+	if err != nil {
+		t.Fatalf("WriteDump: %v", err)
+	}
+	if filepath.Dir(got.GetFile()) != dir {
+		t.Fatalf("dump written to %q; expected a file in %s", got.GetFile(), dir)
+	}
+	if _, err := os.Stat(got.GetFile()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGRPCGetDecisions(t *testing.T) {
+	server, client := newTestGRPC(t)
+	ctx := authContext(t)
+	getDirect(t, server)
+
+	got, err := client.GetDecisions(ctx, &adminv1.GetDecisionsRequest{})
+	if err != nil {
+		t.Fatalf("GetDecisions: %v", err)
+	}
+	if d := got.GetDecisions(); len(d) != 1 || d[0].GetRoute() != "direct" || d[0].GetCount() != 1 {
+		t.Fatalf("decisions = %v; expected one direct request", d)
+	}
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+// kvRetryInterval is how long WatchKV waits after failing to reach the
+// key-value store.
+var kvRetryInterval = 10 * time.Second
+
+// WatchKV reloads the configuration of server, as POST /admin/reload does,
+// whenever the CONFIG_KV key changes, until ctx is done.
+func WatchKV(ctx context.Context, source *config.KVSource, server *proxy.Server) {
+	a := New(server)
+	var index uint64
+	for ctx.Err() == nil {
+		next, err := source.Watch(ctx, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			proxy.Warn.Printf("Failed to watch %s: %v", source, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(kvRetryInterval):
+			}
+			continue
+		}
+		if index != 0 && next != index {
+			if _, err := a.reload("Watch of " + source.String()); err != nil {
+				proxy.Error.Printf("Failed to reload config after %s changed: %v", source, err)
+			}
+		}
+		index = next
+	}
+}
@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+// networkFingerprint is replaced in tests.
+var networkFingerprint = config.NetworkFingerprint
+
+// WatchNetwork checks every interval whether the host moved to another
+// network and then reloads the configuration of server, as POST
+// /admin/reload does, so that PROFILES are evaluated again.
+func WatchNetwork(ctx context.Context, interval time.Duration, server *proxy.Server) {
+	a := New(server)
+	last := networkFingerprint()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fingerprint := networkFingerprint()
+		if fingerprint == last {
+			continue
+		}
+		last = fingerprint
+		before := server.Config().Profile
+		if _, err := a.reload("Network change"); err != nil {
+			proxy.Error.Printf("Failed to reload config after a network change: %v", err)
+			continue
+		}
+		if after := server.Config().Profile; after != before {
+			proxy.Info.Printf("Switched from network profile %q to %q", before, after)
+		}
+	}
+}
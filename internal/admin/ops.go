@@ -0,0 +1,284 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+// Errors returned by the operations below. The REST and gRPC front ends map
+// them to their own status codes.
+var (
+	errNotFound     = errors.New("not found")
+	errInvalidInput = errors.New("invalid input")
+	errNotPersisted = errors.New("change applied but not persisted")
+)
+
+// The operations are shared by the REST and gRPC front ends.
+
+func (a *API) addException(pattern string) (config.Config, error) {
+	patterns := config.GetExceptions(pattern)
+	if len(patterns) != 1 {
+		return config.Config{}, fmt.Errorf("%w: pattern must be a single host or wildcard pattern", errInvalidInput)
+	}
+	return a.apply("add exception "+patterns[0], func(cfg *config.Config) error {
+		if !slices.Contains(cfg.ProxyExceptions, patterns[0]) {
+			cfg.ProxyExceptions = append(cfg.ProxyExceptions, patterns[0])
+		}
+		return nil
+	})
+}
+
+func (a *API) deleteException(pattern string) (config.Config, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return config.Config{}, fmt.Errorf("%w: missing pattern", errInvalidInput)
+	}
+	return a.apply("delete exception "+pattern, func(cfg *config.Config) error {
+		i := slices.Index(cfg.ProxyExceptions, pattern)
+		if i < 0 {
+			return errNotFound
+		}
+		cfg.ProxyExceptions = slices.Delete(cfg.ProxyExceptions, i, i+1)
+		return nil
+	})
+}
+
+func (a *API) setUpstream(upstream string) (config.Config, error) {
+	upstream = strings.TrimSpace(upstream)
+	return a.apply("set upstream "+upstream, func(cfg *config.Config) error {
+		cfg.UpstreamProxy = upstream
+		for _, u := range cfg.Upstreams() {
+			if a.server.PointsToSelf(u) {
+				return fmt.Errorf("%w: upstream %s is this proxy", errInvalidInput, u)
+			}
+		}
+		return nil
+	})
+}
+
+func (a *API) setFailOpen(enabled bool) (config.Config, error) {
+	return a.apply("set fail-open "+strconv.FormatBool(enabled), func(cfg *config.Config) error {
+		cfg.FailOpen = enabled
+		return nil
+	})
+}
+
+func (a *API) closeConnection(id uint64) error {
+	if !a.server.Activity().Terminate(id) {
+		return fmt.Errorf("%w: no active connection with id %d", errNotFound, id)
+	}
+	proxy.Warn.Printf("Admin API terminated connection %d", id)
+	return nil
+}
+
+// startupSettings only take effect when the proxy starts, so a reload reports
+// changes to them but keeps the running values.
+var startupSettings = map[string]func(dst *config.Config, src config.Config){
+	"ListenAddr":              func(dst *config.Config, src config.Config) { dst.ListenAddr = src.ListenAddr },
+	"ListenPipe":              func(dst *config.Config, src config.Config) { dst.ListenPipe = src.ListenPipe },
+	"ListenPipeSDDL":          func(dst *config.Config, src config.Config) { dst.ListenPipeSDDL = src.ListenPipeSDDL },
+	"AdminAddr":               func(dst *config.Config, src config.Config) { dst.AdminAddr = src.AdminAddr },
+	"GRPCAdminAddr":           func(dst *config.Config, src config.Config) { dst.GRPCAdminAddr = src.GRPCAdminAddr },
+	"ServerReadHeaderTimeout": func(dst *config.Config, src config.Config) { dst.ServerReadHeaderTimeout = src.ServerReadHeaderTimeout },
+	"ServerReadTimeout":       func(dst *config.Config, src config.Config) { dst.ServerReadTimeout = src.ServerReadTimeout },
+	"ServerWriteTimeout":      func(dst *config.Config, src config.Config) { dst.ServerWriteTimeout = src.ServerWriteTimeout },
+	"ServerIdleTimeout":       func(dst *config.Config, src config.Config) { dst.ServerIdleTimeout = src.ServerIdleTimeout },
+	"ServerMaxHeaderBytes":    func(dst *config.Config, src config.Config) { dst.ServerMaxHeaderBytes = src.ServerMaxHeaderBytes },
+	"StartupProbe":            func(dst *config.Config, src config.Config) { dst.StartupProbe = src.StartupProbe },
+	"FlowLog":                 func(dst *config.Config, src config.Config) { dst.FlowLog = src.FlowLog },
+	"AuthAuditLog":            func(dst *config.Config, src config.Config) { dst.AuthAuditLog = src.AuthAuditLog },
+	"ConfigKV":                func(dst *config.Config, src config.Config) { dst.ConfigKV = src.ConfigKV },
+	"ConfigURL":               func(dst *config.Config, src config.Config) { dst.ConfigURL = src.ConfigURL },
+	"ConfigURLPublicKey":      func(dst *config.Config, src config.Config) { dst.ConfigURLPublicKey = src.ConfigURLPublicKey },
+	"ConfigURLInterval":       func(dst *config.Config, src config.Config) { dst.ConfigURLInterval = src.ConfigURLInterval },
+	"ProfileCheckInterval":    func(dst *config.Config, src config.Config) { dst.ProfileCheckInterval = src.ProfileCheckInterval },
+	"StrictHTTP":              func(dst *config.Config, src config.Config) { dst.StrictHTTP = src.StrictHTTP },
+}
+
+// topTalkers reports the clients and destinations with the most traffic
+// over window, 1h if empty, ranked by bytes or, if by is "requests", by
+// requests. A limit of 0 reports 10 of each.
+func (a *API) topTalkers(window string, limit int, by string) (proxy.TopTalkers, error) {
+	if window == "" {
+		window = "1h"
+	}
+	if _, ok := proxy.TalkerWindows[window]; !ok {
+		return proxy.TopTalkers{}, fmt.Errorf("%w: window must be 5m, 1h or 24h", errInvalidInput)
+	}
+	if limit < 0 {
+		return proxy.TopTalkers{}, fmt.Errorf("%w: invalid limit", errInvalidInput)
+	}
+	if limit == 0 {
+		limit = 10
+	}
+	if by != "" && by != "bytes" && by != "requests" {
+		return proxy.TopTalkers{}, fmt.Errorf("%w: by must be bytes or requests", errInvalidInput)
+	}
+	return a.server.TopTalkers(window, limit, by == "requests"), nil
+}
+
+type reloadChange struct {
+	config.Change
+	RestartRequired bool `json:"restartRequired,omitempty"`
+}
+
+// reload re-reads the config file, CONFIG_KV and the environment and
+// atomically swaps in the result, returning what changed. by names who
+// asked for it in the log.
+func (a *API) reload(by string) ([]reloadChange, error) {
+	loaded, err := config.Load()
+	if errors.Is(err, config.ErrConfigURLUnreachable) {
+		proxy.Warn.Printf("Reloading config with the last values fetched from CONFIG_URL: %v", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var changes []reloadChange
+	_, err = a.server.Update(func(cfg *config.Config) error {
+		// Changes are reported as redact shows them; a field that only
+		// differs in masked values is reported without them.
+		shown := map[string]config.Change{}
+		for _, c := range config.Diff(redact(*cfg), redact(loaded)) {
+			shown[c.Field] = c
+		}
+		for _, c := range config.Diff(*cfg, loaded) {
+			keep, restart := startupSettings[c.Field]
+			if restart {
+				keep(&loaded, *cfg)
+			}
+			if r, ok := shown[c.Field]; ok {
+				c = r
+			} else {
+				c.Old, c.New = "REDACTED", "REDACTED"
+			}
+			changes = append(changes, reloadChange{Change: c, RestartRequired: restart})
+		}
+		*cfg = loaded
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	proxy.Info.Printf("%s reloaded config (%d changes)", by, len(changes))
+	a.server.Notify(proxy.EventConfigReloaded, fmt.Sprintf("Configuration reloaded (%d changes)", len(changes)))
+	return changes, nil
+}
+
+// Reload reloads the configuration of server as POST /admin/reload does.
+// by names who asked for it in the log.
+func Reload(server *proxy.Server, by string) error {
+	_, err := New(server).reload(by)
+	return err
+}
+
+// apply applies fn to the running configuration and persists the mutable
+// settings to the config file when ADMIN_PERSIST is enabled.
+func (a *API) apply(op string, fn func(cfg *config.Config) error) (config.Config, error) {
+	cfg, err := a.server.Update(fn)
+	if err != nil {
+		return cfg, err
+	}
+	proxy.Info.Printf("Admin API %s applied (upstream=%s, exceptions=%v, failOpen=%v)",
+		op, cfg.UpstreamProxy, cfg.ProxyExceptions, cfg.FailOpen)
+
+	if cfg.AdminPersist {
+		if err := persist(cfg); err != nil {
+			proxy.Error.Printf("Admin API failed to persist config: %v", err)
+			return cfg, fmt.Errorf("%w: %v", errNotPersisted, err)
+		}
+	}
+	return cfg, nil
+}
+
+func persist(cfg config.Config) error {
+	if cfg.ConfigFile == "" {
+		return errors.New("ADMIN_PERSIST requires CONFIG_FILE to be set")
+	}
+	return config.UpdateFile(cfg.ConfigFile, map[string]string{
+		"UPSTREAM_PROXY":   cfg.UpstreamProxy,
+		"PROXY_EXCEPTIONS": strings.Join(cfg.ProxyExceptions, ","),
+		"FAIL_OPEN":        strconv.FormatBool(cfg.FailOpen),
+	})
+}
+
+func redact(cfg config.Config) config.Config {
+	if cfg.AdminToken != "" {
+		cfg.AdminToken = "REDACTED"
+	}
+	if cfg.ClientUsers != nil {
+		users := make(map[string]string, len(cfg.ClientUsers))
+		for user := range cfg.ClientUsers {
+			users[user] = "REDACTED"
+		}
+		cfg.ClientUsers = users
+	}
+	if cfg.Tenants != nil {
+		tenants := make([]config.Tenant, len(cfg.Tenants))
+		for i, tenant := range cfg.Tenants {
+			tenants[i] = config.Tenant{Name: tenant.Name, Settings: maps.Clone(tenant.Settings)}
+			if _, ok := tenant.Settings["CLIENT_AUTH_USERS"]; ok {
+				tenants[i].Settings["CLIENT_AUTH_USERS"] = "REDACTED"
+			}
+		}
+		cfg.Tenants = tenants
+	}
+	if cfg.AnonymizeKey != "" {
+		cfg.AnonymizeKey = "REDACTED"
+	}
+	if cfg.ConfigKVToken != "" {
+		cfg.ConfigKVToken = "REDACTED"
+	}
+	if cfg.InfluxToken != "" {
+		cfg.InfluxToken = "REDACTED"
+	}
+	if cfg.InfluxURL != "" {
+		cfg.InfluxURL = redactURL(cfg.InfluxURL)
+	}
+	if cfg.WebhookURLs != nil {
+		// Webhook URLs, e.g. Slack's, carry their secret in the path.
+		urls := make([]string, len(cfg.WebhookURLs))
+		for i := range urls {
+			urls[i] = "REDACTED"
+		}
+		cfg.WebhookURLs = urls
+	}
+	return cfg
+}
+
+// credentialParams are the query parameters that carry credentials, such as
+// InfluxDB 1.x's u and p.
+var credentialParams = []string{"u", "p", "password", "token"}
+
+// redactURL masks the userinfo and credential query parameters of raw.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "REDACTED"
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for _, key := range credentialParams {
+			if query.Has(key) {
+				query.Set(key, "REDACTED")
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+func validToken(got, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+// PollURL fetches CONFIG_URL every interval until ctx is done and reloads
+// the configuration of server, as POST /admin/reload does, when it changed.
+func PollURL(ctx context.Context, source *config.URLSource, interval time.Duration, server *proxy.Server) {
+	a := New(server)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, interval)
+		_, changed, err := source.Fetch(fetchCtx)
+		cancel()
+		if err != nil {
+			proxy.Warn.Printf("Failed to fetch %s: %v", source, err)
+			continue
+		}
+		if changed {
+			if _, err := a.reload("Poll of " + source.String()); err != nil {
+				proxy.Error.Printf("Failed to reload config after %s changed: %v", source, err)
+			}
+		}
+	}
+}
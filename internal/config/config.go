@@ -1,111 +1,518 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net"
+	"net/netip"
 	"net/url"
 	"os"
+	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/net/idna"
 )
 
 type Config struct {
 	UpstreamProxy   string
 	ProxyExceptions []string
 	ListenAddr      string
+	ListenPipe      string
+	ListenPipeSDDL  string
+	ListenTLSCert   string
+	ListenTLSKey    string
+	ClientUsers     map[string]string
 	ProxyAuth       string
+	FailOpen        bool
+	DirectOnly      bool
+	StartupProbe    string
+	SystemProxy     bool
+	SetSystemProxy  bool
+	ConfigFile      string
+
+	ProxyProtocolTrusted []string
+	ProxyProtocolTargets []string
+	ProxyProtocolVersion int
+
+	KubernetesSidecar bool
+	KubernetesCIDRs   []string
+
+	RetryMax     int
+	RetryBackoff time.Duration
+
+	CircuitFailureThreshold int
+	CircuitOpenDuration     time.Duration
+
+	HealthCheckInterval time.Duration
+	HealthCheckTarget   string
+
+	UpstreamRefreshInterval time.Duration
+
+	DrainTimeout time.Duration
+
+	DNSServers         []string
+	DirectDNSServers   []string
+	DNSRoutes          []DNSRoute
+	RemoteDNS          []string
+	HostMap            map[string]string
+	DNSTimeout         time.Duration
+	DNSSearch          []string
+	DNSNdots           int
+	DNSCache           bool
+	DNSCacheTTL        time.Duration
+	DNSCacheNegTTL     time.Duration
+	DisableIPv4        bool
+	DisableIPv6        bool
+	HappyEyeballsDelay time.Duration
+	OutboundBind       string
+	OutboundBindRoutes []BindRoute
+	UpstreamBinds      []BindRoute
+
+	AdminAddr     string
+	AdminToken    string
+	AdminPersist  bool
+	GRPCAdminAddr string
 
-	ServerReadHeaderTimeout      time.Duration
-	ServerReadTimeout            time.Duration
-	ServerWriteTimeout           time.Duration
-	ServerIdleTimeout            time.Duration
-	ServerMaxHeaderBytes         int
-	ClientRequestTimeout         time.Duration
-	TransportDialTimeout         time.Duration
-	TransportKeepAlive           time.Duration
-	TransportTLSHandshakeTimeout time.Duration
+	ServerReadHeaderTimeout        time.Duration
+	ServerReadTimeout              time.Duration
+	ServerWriteTimeout             time.Duration
+	ServerIdleTimeout              time.Duration
+	ServerMaxHeaderBytes           int
+	ClientRequestTimeout           time.Duration
+	TransportDialTimeout           time.Duration
+	TransportKeepAlive             time.Duration
+	TransportTLSHandshakeTimeout   time.Duration
 	TransportResponseHeaderTimeout time.Duration
 	TransportExpectContinueTimeout time.Duration
-	TransportIdleConnTimeout     time.Duration
-	TunnelConnectReadWriteTimeout time.Duration
+	TransportIdleConnTimeout       time.Duration
+	TunnelConnectReadWriteTimeout  time.Duration
+
+	TCPKeepAlive         time.Duration
+	TCPKeepAliveInterval time.Duration
+	TCPKeepAliveCount    int
+	TCPNoDelay           bool
+	TCPReadBuffer        int
+	TCPWriteBuffer       int
+
+	DestConnLimit  int
+	DestConnLimits []ConnLimit
+	DestConnWait   time.Duration
+
+	BandwidthLimit int64
+	QoSClasses     []QoSClass
+
+	MirrorUpstream  string
+	MirrorBodyLimit int
+
+	CanaryUpstream string
+	CanaryPercent  int
+	CanaryHosts    []string
+	CanaryHash     string
+
+	RecordDir string
+	ReplayDir string
+
+	FlowLog string
+
+	ChaosRules []ChaosRule
+
+	ClientQuotaDaily   int64
+	ClientQuotaMonthly int64
+
+	RouteAffinityTTL time.Duration
+
+	GeoIPDB       []string
+	GeoIPBlock    []string
+	GeoIPUpstream []string
+
+	WebhookURLs         []string
+	WebhookFormat       string
+	WebhookEvents       []string
+	WebhookAuthFailures int
+
+	StrictHTTP bool
+
+	TunnelIdleTimeout      time.Duration
+	TunnelHalfCloseTimeout time.Duration
+
+	LogAnonymize     string
+	FlowLogAnonymize string
+	AnonymizeKey     string
+
+	ThreatFeeds        []string
+	ThreatFeedAction   string
+	ThreatFeedInterval time.Duration
+
+	DestRateLimits    []RateLimit
+	DestRateLimitWait time.Duration
+
+	MemoryLimit int64
+
+	AuthAuditLog    string
+	AuthAuditWindow time.Duration
+
+	ConfigKV      string
+	ConfigKVToken string
+
+	ConfigURL          string
+	ConfigURLPublicKey string
+	ConfigURLInterval  time.Duration
+
+	Profiles             []Profile
+	Profile              string
+	ProfileCheckInterval time.Duration
+
+	UpstreamPAC         string
+	UpstreamPACInterval time.Duration
+
+	AppRoutes []AppRoute
+
+	Tenants []Tenant
+
+	UpstreamExceptions []UpstreamException
+
+	UpstreamTLSCert string
+	UpstreamTLSKey  string
+	UpstreamTLSCA   string
+
+	UpstreamHTTP2 bool
+
+	NTLMDebug  bool
+	NTLMv2Only bool
+
+	ProxyAuthSchemes []string
+	AuthCacheTTL     time.Duration
+
+	TunnelPoolIdle time.Duration
+
+	UpstreamDemoteErrorRate   int
+	UpstreamDemoteMinRequests int
+	UpstreamDemoteDuration    time.Duration
+
+	LogSampleRate int
+
+	DumpDir    string
+	DumpSignal string
+
+	InfluxURL      string
+	InfluxToken    string
+	InfluxInterval time.Duration
+
+	DecisionHeader bool
+
+	TunnelBufferSize int
+	CopyBufferSize   int
 }
 
 const (
-	defaultServerReadHeaderTimeout      = 10 * time.Second
-	defaultServerReadTimeout            = 30 * time.Second
-	defaultServerWriteTimeout           = 30 * time.Second
-	defaultServerIdleTimeout            = 120 * time.Second
-	defaultServerMaxHeaderBytes         = 1 << 20 // 1 MiB
-	defaultClientRequestTimeout         = 60 * time.Second
-	defaultTransportDialTimeout         = 10 * time.Second
-	defaultTransportKeepAlive           = 30 * time.Second
-	defaultTransportTLSHandshakeTimeout = 10 * time.Second
+	defaultServerReadHeaderTimeout        = 10 * time.Second
+	defaultServerReadTimeout              = 30 * time.Second
+	defaultServerWriteTimeout             = 30 * time.Second
+	defaultServerIdleTimeout              = 120 * time.Second
+	defaultServerMaxHeaderBytes           = 1 << 20 // 1 MiB
+	defaultClientRequestTimeout           = 60 * time.Second
+	defaultTransportDialTimeout           = 10 * time.Second
+	defaultTransportKeepAlive             = 30 * time.Second
+	defaultTransportTLSHandshakeTimeout   = 10 * time.Second
 	defaultTransportResponseHeaderTimeout = 30 * time.Second
 	defaultTransportExpectContinueTimeout = 1 * time.Second
-	defaultTransportIdleConnTimeout     = 90 * time.Second
-	defaultTunnelConnectReadWriteTimeout = 15 * time.Second
+	defaultTransportIdleConnTimeout       = 90 * time.Second
+	defaultTunnelConnectReadWriteTimeout  = 15 * time.Second
+	defaultRetryBackoff                   = 200 * time.Millisecond
+	defaultCircuitFailureThreshold        = 5
+	defaultCircuitOpenDuration            = 30 * time.Second
+	defaultHappyEyeballsDelay             = 250 * time.Millisecond
+	defaultDrainTimeout                   = 5 * time.Minute
+	defaultDNSTimeout                     = 2 * time.Second
+	defaultDestConnWait                   = 30 * time.Second
+	defaultMirrorBodyLimit                = 64 << 10
+	defaultDNSNdots                       = 1
+	defaultDNSCacheTTL                    = 30 * time.Second
+	defaultUpstreamRefreshInterval        = 30 * time.Second
+	defaultDNSCacheNegTTL                 = 5 * time.Second
+	defaultWebhookAuthFailures            = 20
+	defaultTunnelHalfCloseTimeout         = 5 * time.Minute
+	defaultThreatFeedInterval             = time.Hour
+	defaultDestRateLimitWait              = 30 * time.Second
+	defaultAuthAuditWindow                = time.Minute
+	defaultConfigURLInterval              = 15 * time.Minute
+	defaultProfileCheckInterval           = 5 * time.Second
+	defaultUpstreamPACInterval            = time.Hour
+	defaultAuthCacheTTL                   = time.Hour
+	defaultUpstreamDemoteMinRequests      = 20
+	defaultUpstreamDemoteDuration         = 5 * time.Minute
+	defaultInfluxInterval                 = 10 * time.Second
 )
 
 func LoadConfig() Config {
+	return load(os.LookupEnv)
+}
+
+// DefaultConfig returns the configuration used when no environment variables are set.
+func DefaultConfig() Config {
+	return load(func(string) (string, bool) { return "", false })
+}
+
+type lookupFunc func(key string) (string, bool)
+
+func load(lookup lookupFunc) Config {
+	config, _ := loadChecked(lookup)
+	return config
+}
+
+// loadChecked is load that also reports the settings whose values cannot be
+// parsed and were replaced by their defaults.
+func loadChecked(raw lookupFunc) (Config, error) {
+	lookup := &checkedLookup{lookupFunc: raw.expanding()}
 	config := Config{
-		UpstreamProxy:   GetEnv("UPSTREAM_PROXY", ""),
-		ProxyExceptions: []string{},
-		ListenAddr:      GetEnv("LISTEN_ADDR", ":8080"),
-		ProxyAuth:       GetEnv("PROXY_AUTH", ""),
-		ServerReadHeaderTimeout:      GetEnvDuration("SERVER_READ_HEADER_TIMEOUT", defaultServerReadHeaderTimeout),
-		ServerReadTimeout:            GetEnvDuration("SERVER_READ_TIMEOUT", defaultServerReadTimeout),
-		ServerWriteTimeout:           GetEnvDuration("SERVER_WRITE_TIMEOUT", defaultServerWriteTimeout),
-		ServerIdleTimeout:            GetEnvDuration("SERVER_IDLE_TIMEOUT", defaultServerIdleTimeout),
-		ServerMaxHeaderBytes:         GetEnvInt("SERVER_MAX_HEADER_BYTES", defaultServerMaxHeaderBytes),
-		ClientRequestTimeout:         GetEnvDuration("CLIENT_REQUEST_TIMEOUT", defaultClientRequestTimeout),
-		TransportDialTimeout:         GetEnvDuration("TRANSPORT_DIAL_TIMEOUT", defaultTransportDialTimeout),
-		TransportKeepAlive:           GetEnvDuration("TRANSPORT_KEEP_ALIVE", defaultTransportKeepAlive),
-		TransportTLSHandshakeTimeout: GetEnvDuration("TRANSPORT_TLS_HANDSHAKE_TIMEOUT", defaultTransportTLSHandshakeTimeout),
-		TransportResponseHeaderTimeout: GetEnvDuration("TRANSPORT_RESPONSE_HEADER_TIMEOUT", defaultTransportResponseHeaderTimeout),
-		TransportExpectContinueTimeout: GetEnvDuration("TRANSPORT_EXPECT_CONTINUE_TIMEOUT", defaultTransportExpectContinueTimeout),
-		TransportIdleConnTimeout:     GetEnvDuration("TRANSPORT_IDLE_CONN_TIMEOUT", defaultTransportIdleConnTimeout),
-		TunnelConnectReadWriteTimeout: GetEnvDuration("TUNNEL_CONNECT_READ_WRITE_TIMEOUT", defaultTunnelConnectReadWriteTimeout),
-	}
-
-	if exceptions := os.Getenv("PROXY_EXCEPTIONS"); exceptions != "" {
+		UpstreamProxy:                  lookup.str("UPSTREAM_PROXY", ""),
+		ProxyExceptions:                []string{},
+		ListenAddr:                     lookup.str("LISTEN_ADDR", ":8080"),
+		ListenPipe:                     lookup.str("LISTEN_PIPE", ""),
+		ListenPipeSDDL:                 lookup.str("LISTEN_PIPE_SDDL", ""),
+		ListenTLSCert:                  lookup.str("LISTEN_TLS_CERT", ""),
+		ListenTLSKey:                   lookup.str("LISTEN_TLS_KEY", ""),
+		ClientUsers:                    GetClientUsers(lookup.str("CLIENT_AUTH_USERS", "")),
+		ProxyProtocolTrusted:           GetExceptions(lookup.str("PROXY_PROTOCOL_TRUSTED", "")),
+		ProxyProtocolTargets:           GetExceptions(lookup.str("PROXY_PROTOCOL_TARGETS", "")),
+		ProxyProtocolVersion:           lookup.int("PROXY_PROTOCOL_VERSION", 1),
+		ProxyAuth:                      lookup.str("PROXY_AUTH", ""),
+		FailOpen:                       lookup.bool("FAIL_OPEN", false),
+		DirectOnly:                     lookup.bool("DIRECT_ONLY", false),
+		StartupProbe:                   lookup.str("STARTUP_PROBE", "warn"),
+		SystemProxy:                    lookup.bool("SYSTEM_PROXY", false),
+		SetSystemProxy:                 lookup.bool("SET_SYSTEM_PROXY", false),
+		KubernetesSidecar:              lookup.bool("KUBERNETES_SIDECAR", false),
+		KubernetesCIDRs:                GetExceptions(lookup.str("KUBERNETES_CIDRS", "")),
+		RetryMax:                       lookup.int("RETRY_MAX", 0),
+		RetryBackoff:                   lookup.duration("RETRY_BACKOFF", defaultRetryBackoff),
+		CircuitFailureThreshold:        lookup.int("CIRCUIT_FAILURE_THRESHOLD", defaultCircuitFailureThreshold),
+		CircuitOpenDuration:            lookup.duration("CIRCUIT_OPEN_DURATION", defaultCircuitOpenDuration),
+		HealthCheckInterval:            lookup.duration("HEALTH_CHECK_INTERVAL", 0),
+		HealthCheckTarget:              lookup.str("HEALTH_CHECK_TARGET", ""),
+		UpstreamRefreshInterval:        lookup.durationOrOff("UPSTREAM_REFRESH_INTERVAL", defaultUpstreamRefreshInterval),
+		DrainTimeout:                   lookup.duration("DRAIN_TIMEOUT", defaultDrainTimeout),
+		DNSServers:                     GetDNSServers(lookup.str("DNS_SERVERS", "")),
+		DirectDNSServers:               GetDNSServers(lookup.str("DIRECT_DNS_SERVERS", "")),
+		DNSRoutes:                      GetDNSRoutes(lookup.str("DNS_ROUTES", "")),
+		RemoteDNS:                      GetExceptions(lookup.str("REMOTE_DNS", "")),
+		HostMap:                        GetHostMap(lookup.str("HOST_MAP", "")),
+		DNSTimeout:                     lookup.duration("DNS_TIMEOUT", defaultDNSTimeout),
+		DNSSearch:                      GetExceptions(lookup.str("DNS_SEARCH", "")),
+		DNSNdots:                       lookup.int("DNS_NDOTS", defaultDNSNdots),
+		DNSCache:                       lookup.bool("DNS_CACHE", true),
+		DNSCacheTTL:                    lookup.duration("DNS_CACHE_TTL", defaultDNSCacheTTL),
+		DNSCacheNegTTL:                 lookup.duration("DNS_CACHE_NEGATIVE_TTL", defaultDNSCacheNegTTL),
+		DisableIPv4:                    lookup.bool("DISABLE_IPV4", false),
+		DisableIPv6:                    lookup.bool("DISABLE_IPV6", false),
+		HappyEyeballsDelay:             lookup.duration("HAPPY_EYEBALLS_DELAY", defaultHappyEyeballsDelay),
+		OutboundBind:                   lookup.str("OUTBOUND_BIND", ""),
+		OutboundBindRoutes:             GetBindRoutes(lookup.str("OUTBOUND_BIND_ROUTES", "")),
+		UpstreamBinds:                  GetBindRoutes(lookup.str("UPSTREAM_BIND", "")),
+		AdminAddr:                      lookup.str("ADMIN_ADDR", ""),
+		AdminToken:                     lookup.str("ADMIN_TOKEN", ""),
+		AdminPersist:                   lookup.bool("ADMIN_PERSIST", false),
+		GRPCAdminAddr:                  lookup.str("GRPC_ADMIN_ADDR", ""),
+		ServerReadHeaderTimeout:        lookup.duration("SERVER_READ_HEADER_TIMEOUT", defaultServerReadHeaderTimeout),
+		ServerReadTimeout:              lookup.duration("SERVER_READ_TIMEOUT", defaultServerReadTimeout),
+		ServerWriteTimeout:             lookup.duration("SERVER_WRITE_TIMEOUT", defaultServerWriteTimeout),
+		ServerIdleTimeout:              lookup.duration("SERVER_IDLE_TIMEOUT", defaultServerIdleTimeout),
+		ServerMaxHeaderBytes:           lookup.bufferSize("SERVER_MAX_HEADER_BYTES", defaultServerMaxHeaderBytes),
+		ClientRequestTimeout:           lookup.duration("CLIENT_REQUEST_TIMEOUT", defaultClientRequestTimeout),
+		TransportDialTimeout:           lookup.duration("TRANSPORT_DIAL_TIMEOUT", defaultTransportDialTimeout),
+		TransportKeepAlive:             lookup.duration("TRANSPORT_KEEP_ALIVE", defaultTransportKeepAlive),
+		TransportTLSHandshakeTimeout:   lookup.duration("TRANSPORT_TLS_HANDSHAKE_TIMEOUT", defaultTransportTLSHandshakeTimeout),
+		TransportResponseHeaderTimeout: lookup.duration("TRANSPORT_RESPONSE_HEADER_TIMEOUT", defaultTransportResponseHeaderTimeout),
+		TransportExpectContinueTimeout: lookup.duration("TRANSPORT_EXPECT_CONTINUE_TIMEOUT", defaultTransportExpectContinueTimeout),
+		TransportIdleConnTimeout:       lookup.duration("TRANSPORT_IDLE_CONN_TIMEOUT", defaultTransportIdleConnTimeout),
+		TunnelConnectReadWriteTimeout:  lookup.duration("TUNNEL_CONNECT_READ_WRITE_TIMEOUT", defaultTunnelConnectReadWriteTimeout),
+		TCPKeepAlive:                   lookup.durationOrOff("TCP_KEEPALIVE", 0),
+		TCPKeepAliveInterval:           lookup.duration("TCP_KEEPALIVE_INTERVAL", 0),
+		TCPKeepAliveCount:              lookup.int("TCP_KEEPALIVE_COUNT", 0),
+		TCPNoDelay:                     lookup.bool("TCP_NODELAY", true),
+		TCPReadBuffer:                  lookup.bufferSize("TCP_READ_BUFFER", 0),
+		TCPWriteBuffer:                 lookup.bufferSize("TCP_WRITE_BUFFER", 0),
+		DestConnLimit:                  lookup.int("DEST_CONN_LIMIT", 0),
+		DestConnLimits:                 GetConnLimits(lookup.str("DEST_CONN_LIMITS", "")),
+		DestConnWait:                   lookup.duration("DEST_CONN_WAIT", defaultDestConnWait),
+		BandwidthLimit:                 lookup.size("BANDWIDTH_LIMIT", 0),
+		QoSClasses:                     GetQoSClasses(lookup.str("QOS_CLASSES", "")),
+		MirrorUpstream:                 lookup.str("MIRROR_UPSTREAM", ""),
+		MirrorBodyLimit:                lookup.bufferSize("MIRROR_BODY_LIMIT", defaultMirrorBodyLimit),
+		CanaryUpstream:                 lookup.str("CANARY_UPSTREAM", ""),
+		CanaryPercent:                  lookup.int("CANARY_PERCENT", 0),
+		CanaryHosts:                    GetExceptions(lookup.str("CANARY_HOSTS", "")),
+		CanaryHash:                     strings.ToLower(lookup.str("CANARY_HASH", CanaryHashHost)),
+		RecordDir:                      lookup.str("RECORD_DIR", ""),
+		ReplayDir:                      lookup.str("REPLAY_DIR", ""),
+		FlowLog:                        lookup.str("FLOW_LOG", ""),
+		ChaosRules:                     GetChaosRules(lookup.str("CHAOS_RULES", "")),
+		ClientQuotaDaily:               lookup.size("CLIENT_QUOTA_DAILY", 0),
+		ClientQuotaMonthly:             lookup.size("CLIENT_QUOTA_MONTHLY", 0),
+		RouteAffinityTTL:               lookup.duration("ROUTE_AFFINITY_TTL", 0),
+		GeoIPDB:                        GetList(lookup.str("GEOIP_DB", "")),
+		GeoIPBlock:                     GetCountries(lookup.str("GEOIP_BLOCK", "")),
+		GeoIPUpstream:                  GetCountries(lookup.str("GEOIP_UPSTREAM", "")),
+		WebhookURLs:                    GetURLs(lookup.str("WEBHOOK_URL", "")),
+		WebhookFormat:                  strings.ToLower(lookup.str("WEBHOOK_FORMAT", WebhookFormatJSON)),
+		WebhookEvents:                  GetList(strings.ToLower(lookup.str("WEBHOOK_EVENTS", ""))),
+		WebhookAuthFailures:            lookup.intOrOff("WEBHOOK_AUTH_FAILURES", defaultWebhookAuthFailures),
+		StrictHTTP:                     lookup.bool("STRICT_HTTP", true),
+		TunnelIdleTimeout:              lookup.duration("TUNNEL_IDLE_TIMEOUT", 0),
+		TunnelHalfCloseTimeout:         lookup.durationOrOff("TUNNEL_HALF_CLOSE_TIMEOUT", defaultTunnelHalfCloseTimeout),
+		LogAnonymize:                   strings.ToLower(lookup.str("LOG_ANONYMIZE", AnonymizeOff)),
+		FlowLogAnonymize:               strings.ToLower(lookup.str("FLOW_LOG_ANONYMIZE", AnonymizeOff)),
+		AnonymizeKey:                   lookup.str("ANONYMIZE_KEY", ""),
+		ThreatFeeds:                    GetList(lookup.str("THREAT_FEEDS", "")),
+		ThreatFeedAction:               strings.ToLower(lookup.str("THREAT_FEED_ACTION", ThreatActionBlock)),
+		ThreatFeedInterval:             lookup.duration("THREAT_FEED_INTERVAL", defaultThreatFeedInterval),
+		DestRateLimits:                 GetRateLimits(lookup.str("DEST_RATE_LIMITS", "")),
+		DestRateLimitWait:              lookup.durationOrOff("DEST_RATE_LIMIT_WAIT", defaultDestRateLimitWait),
+		MemoryLimit:                    lookup.size("MEMORY_LIMIT", 0),
+		AuthAuditLog:                   lookup.str("AUTH_AUDIT_LOG", ""),
+		AuthAuditWindow:                lookup.durationOrOff("AUTH_AUDIT_WINDOW", defaultAuthAuditWindow),
+		ConfigKV:                       lookup.str("CONFIG_KV", ""),
+		ConfigKVToken:                  lookup.str("CONFIG_KV_TOKEN", ""),
+		ConfigURL:                      lookup.str("CONFIG_URL", ""),
+		ConfigURLPublicKey:             lookup.str("CONFIG_URL_PUBLIC_KEY", ""),
+		ConfigURLInterval:              lookup.duration("CONFIG_URL_INTERVAL", defaultConfigURLInterval),
+		Profiles:                       GetProfiles(lookup.str("PROFILES", "")),
+		ProfileCheckInterval:           lookup.duration("PROFILE_CHECK_INTERVAL", defaultProfileCheckInterval),
+		UpstreamPAC:                    lookup.str("UPSTREAM_PAC", ""),
+		UpstreamPACInterval:            lookup.duration("UPSTREAM_PAC_INTERVAL", defaultUpstreamPACInterval),
+		AppRoutes:                      GetAppRoutes(lookup.str("APP_ROUTES", "")),
+		Tenants:                        loadTenants(lookup.lookupFunc),
+		UpstreamExceptions:             GetUpstreamExceptions(lookup.str("UPSTREAM_EXCEPTIONS", "")),
+		UpstreamTLSCert:                lookup.str("UPSTREAM_TLS_CERT", ""),
+		UpstreamTLSKey:                 lookup.str("UPSTREAM_TLS_KEY", ""),
+		UpstreamTLSCA:                  lookup.str("UPSTREAM_TLS_CA", ""),
+		UpstreamHTTP2:                  lookup.bool("UPSTREAM_HTTP2", false),
+		NTLMDebug:                      lookup.bool("NTLM_DEBUG", false),
+		NTLMv2Only:                     lookup.bool("NTLM_V2_ONLY", false),
+		ProxyAuthSchemes:               GetAuthSchemes(lookup.str("PROXY_AUTH_SCHEMES", "")),
+		AuthCacheTTL:                   lookup.durationOrOff("AUTH_CACHE_TTL", defaultAuthCacheTTL),
+		TunnelPoolIdle:                 lookup.durationOrOff("TUNNEL_POOL_IDLE", 0),
+		UpstreamDemoteErrorRate:        lookup.int("UPSTREAM_DEMOTE_ERROR_RATE", 0),
+		UpstreamDemoteMinRequests:      lookup.int("UPSTREAM_DEMOTE_MIN_REQUESTS", defaultUpstreamDemoteMinRequests),
+		UpstreamDemoteDuration:         lookup.duration("UPSTREAM_DEMOTE_DURATION", defaultUpstreamDemoteDuration),
+		LogSampleRate:                  lookup.int("LOG_SAMPLE_RATE", 1),
+		DumpDir:                        lookup.str("DUMP_DIR", ""),
+		DumpSignal:                     strings.ToUpper(lookup.str("DUMP_SIGNAL", DumpSignalQuit)),
+		InfluxURL:                      lookup.str("INFLUX_URL", ""),
+		InfluxToken:                    lookup.str("INFLUX_TOKEN", ""),
+		InfluxInterval:                 lookup.duration("INFLUX_INTERVAL", defaultInfluxInterval),
+		DecisionHeader:                 lookup.bool("DECISION_HEADER", false),
+		TunnelBufferSize:               lookup.bufferSize("TUNNEL_BUFFER_SIZE", 0),
+		CopyBufferSize:                 lookup.bufferSize("COPY_BUFFER_SIZE", 0),
+	}
+
+	if exceptions, _ := lookup.lookupFunc("PROXY_EXCEPTIONS"); exceptions != "" {
 		config.ProxyExceptions = GetExceptions(exceptions)
 	}
 
-	return config
+	return config, errors.Join(lookup.errs...)
+}
+
+// Upstreams returns the upstream proxies listed in UpstreamProxy, in order
+// of preference.
+func (c Config) Upstreams() []string {
+	var upstreams []string
+	for _, u := range strings.Split(c.UpstreamProxy, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			upstreams = append(upstreams, u)
+		}
+	}
+	return upstreams
 }
 
 func GetEnv(key, defaultVal string) string {
-	if val, ok := os.LookupEnv(key); ok {
+	return lookupFunc(os.LookupEnv).str(key, defaultVal)
+}
+
+func GetEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	return lookupFunc(os.LookupEnv).duration(key, defaultVal)
+}
+
+func GetEnvInt(key string, defaultVal int) int {
+	return lookupFunc(os.LookupEnv).int(key, defaultVal)
+}
+
+func (lookup lookupFunc) str(key, defaultVal string) string {
+	if val, ok := lookup(key); ok {
 		return val
 	}
 	return defaultVal
 }
 
-func GetEnvDuration(key string, defaultVal time.Duration) time.Duration {
-	val, ok := os.LookupEnv(key)
+func (lookup lookupFunc) bool(key string, defaultVal bool) bool {
+	val, ok := lookup(key)
+	if !ok || strings.TrimSpace(val) == "" {
+		return defaultVal
+	}
+	parsed, err := strconv.ParseBool(strings.TrimSpace(val))
+	if err != nil {
+		return defaultVal
+	}
+	return parsed
+}
+
+func (lookup lookupFunc) duration(key string, defaultVal time.Duration) time.Duration {
+	val, ok := lookup(key)
 	if !ok || strings.TrimSpace(val) == "" {
 		return defaultVal
 	}
-	parsed, err := time.ParseDuration(val)
+	parsed, err := ParseDuration(val)
 	if err != nil || parsed <= 0 {
 		return defaultVal
 	}
 	return parsed
 }
 
-func GetEnvInt(key string, defaultVal int) int {
-	val, ok := os.LookupEnv(key)
+// durationOrOff is duration for settings that a zero or negative value
+// turns off rather than resetting them to their default.
+func (lookup lookupFunc) durationOrOff(key string, defaultVal time.Duration) time.Duration {
+	val, ok := lookup(key)
 	if !ok || strings.TrimSpace(val) == "" {
 		return defaultVal
 	}
-	parsed, err := strconv.Atoi(val)
+	parsed, err := ParseDuration(val)
+	if err != nil {
+		return defaultVal
+	}
+	return parsed
+}
+
+func (lookup lookupFunc) int(key string, defaultVal int) int {
+	val, ok := lookup(key)
+	if !ok || strings.TrimSpace(val) == "" {
+		return defaultVal
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(val))
 	if err != nil || parsed <= 0 {
 		return defaultVal
 	}
 	return parsed
 }
 
+// intOrOff is int for settings that 0 turns off rather than resetting them
+// to their default.
+func (lookup lookupFunc) intOrOff(key string, defaultVal int) int {
+	val, ok := lookup(key)
+	if !ok || strings.TrimSpace(val) == "" {
+		return defaultVal
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil || parsed < 0 {
+		return defaultVal
+	}
+	return parsed
+}
+
 func GetExceptions(s string) []string {
 	if s == "" {
 		return nil
@@ -130,41 +537,542 @@ func GetExceptions(s string) []string {
 	return list
 }
 
+// GetList parses a comma-separated list, skipping empty entries.
+func GetList(s string) []string {
+	var paths []string
+	for _, part := range strings.Split(s, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// GetURLs parses a comma-separated list of http and https URLs. Entries that
+// are not absolute URLs of either scheme are skipped.
+func GetURLs(s string) []string {
+	var urls []string
+	for _, part := range strings.Split(s, ",") {
+		u, err := url.Parse(strings.TrimSpace(part))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
+// GetCountries parses a comma-separated list of ISO 3166-1 alpha-2 country
+// codes, returned in upper case. Entries that are not two letters are
+// skipped.
+func GetCountries(s string) []string {
+	var countries []string
+	for _, part := range strings.Split(s, ",") {
+		code := strings.ToUpper(strings.TrimSpace(part))
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			continue
+		}
+		countries = append(countries, code)
+	}
+	return countries
+}
+
+// GetDNSServers parses a comma-separated list of DNS servers: plain servers
+// (host[:port], port 53 by default), DNS-over-TLS servers
+// (tls://host[:port], port 853 by default) and DNS-over-HTTPS URLs
+// (https://...).
+func GetDNSServers(s string) []string {
+	var servers []string
+	for _, part := range strings.Split(s, ",") {
+		server := strings.TrimSpace(part)
+		switch {
+		case server == "":
+			continue
+		case strings.HasPrefix(server, "https://"), strings.HasPrefix(server, "http://"):
+		case strings.HasPrefix(server, "tls://"):
+			server = "tls://" + withDefaultPort(strings.TrimPrefix(server, "tls://"), "853")
+		default:
+			server = withDefaultPort(server, "53")
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// DNSRoute sends lookups of names matching Pattern, an exception-style
+// pattern, to Servers instead of the default DNS servers.
+type DNSRoute struct {
+	Pattern string
+	Servers []string
+}
+
+// GetDNSRoutes parses a comma-separated list of pattern=server|server...
+// entries, with servers in the format of GetDNSServers.
+func GetDNSRoutes(s string) []DNSRoute {
+	var routes []DNSRoute
+	for _, part := range strings.Split(s, ",") {
+		pattern, servers, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		route := DNSRoute{Pattern: pattern, Servers: GetDNSServers(strings.ReplaceAll(servers, "|", ","))}
+		if !ok || pattern == "" || len(route.Servers) == 0 {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// BindRoute binds outbound connections to hosts matching Pattern, an
+// exception-style pattern, to Bind, a local IP address or interface name,
+// instead of OUTBOUND_BIND.
+type BindRoute struct {
+	Pattern string
+	Bind    string
+}
+
+// GetBindRoutes parses a comma-separated list of pattern=address-or-interface
+// entries.
+func GetBindRoutes(s string) []BindRoute {
+	var routes []BindRoute
+	for _, part := range strings.Split(s, ",") {
+		pattern, bind, ok := strings.Cut(part, "=")
+		route := BindRoute{Pattern: strings.TrimSpace(pattern), Bind: strings.TrimSpace(bind)}
+		if !ok || route.Pattern == "" || route.Bind == "" {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// How APP_ROUTES routes the connections of an application.
+const (
+	AppRouteDirect   = "direct"
+	AppRouteUpstream = "upstream"
+	AppRouteBlock    = "block"
+)
+
+// AppRoute routes the connections of local processes running the
+// executable App, a lowercase file name without .exe, by Route.
+type AppRoute struct {
+	App   string
+	Route string
+}
+
+// GetAppRoutes parses a comma-separated list of executable=route entries,
+// the route being direct, upstream or block. Invalid entries are skipped.
+func GetAppRoutes(s string) []AppRoute {
+	var routes []AppRoute
+	for _, part := range strings.Split(s, ",") {
+		app, route, ok := strings.Cut(part, "=")
+		r := AppRoute{
+			App:   strings.TrimSuffix(strings.ToLower(strings.TrimSpace(app)), ".exe"),
+			Route: strings.ToLower(strings.TrimSpace(route)),
+		}
+		if !ok || r.App == "" || r.Route != AppRouteDirect && r.Route != AppRouteUpstream && r.Route != AppRouteBlock {
+			continue
+		}
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+// UpstreamException keeps destinations matching Pattern, in PROXY_EXCEPTIONS
+// syntax, away from the upstream Upstream.
+type UpstreamException struct {
+	Pattern  string
+	Upstream string
+}
+
+// GetUpstreamExceptions parses a comma-separated list of pattern=upstream
+// entries. Entries without a pattern or upstream are skipped.
+func GetUpstreamExceptions(s string) []UpstreamException {
+	var exceptions []UpstreamException
+	for _, part := range strings.Split(s, ",") {
+		pattern, upstream, ok := strings.Cut(part, "=")
+		e := UpstreamException{Pattern: strings.TrimSpace(pattern), Upstream: strings.TrimSpace(upstream)}
+		if !ok || e.Pattern == "" || e.Upstream == "" {
+			continue
+		}
+		exceptions = append(exceptions, e)
+	}
+	return exceptions
+}
+
+// ExcludesUpstream reports whether an UpstreamException keeps host away
+// from upstream.
+func ExcludesUpstream(host, upstream string, exceptions []UpstreamException) bool {
+	for _, e := range exceptions {
+		if strings.EqualFold(e.Upstream, upstream) && IsException(host, []string{e.Pattern}) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthSchemes are the authentication schemes PROXY_AUTH_SCHEMES can list.
+var AuthSchemes = []string{"negotiate", "ntlm", "basic"}
+
+// GetAuthSchemes parses a comma-separated list of authentication schemes in
+// order of preference, returned in lower case. Unknown and repeated schemes
+// are skipped.
+func GetAuthSchemes(s string) []string {
+	var schemes []string
+	for _, part := range strings.Split(s, ",") {
+		scheme := strings.ToLower(strings.TrimSpace(part))
+		if !slices.Contains(AuthSchemes, scheme) || slices.Contains(schemes, scheme) {
+			continue
+		}
+		schemes = append(schemes, scheme)
+	}
+	return schemes
+}
+
+// ConnLimit caps the simultaneous connections to each destination matching
+// Pattern. A Limit of 0 means unlimited.
+type ConnLimit struct {
+	Pattern string
+	Limit   int
+}
+
+// GetConnLimits parses a comma-separated list of pattern=limit entries.
+// Entries without a non-negative number are skipped.
+func GetConnLimits(s string) []ConnLimit {
+	var limits []ConnLimit
+	for _, part := range strings.Split(s, ",") {
+		pattern, limit, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if !ok || pattern == "" || err != nil || n < 0 {
+			continue
+		}
+		limits = append(limits, ConnLimit{Pattern: pattern, Limit: n})
+	}
+	return limits
+}
+
+// RateLimit spaces the requests to each destination matching Pattern at
+// least Interval apart. An Interval of 0 means unlimited.
+type RateLimit struct {
+	Pattern  string
+	Interval time.Duration
+}
+
+// GetRateLimits parses a comma-separated list of pattern=rate entries, where
+// rate is a number of requests per second, or per the unit or duration after
+// a slash: 1/s, 10/m, 100/h, 5/30s. Entries without a valid rate are
+// skipped.
+func GetRateLimits(s string) []RateLimit {
+	var limits []RateLimit
+	for _, part := range strings.Split(s, ",") {
+		pattern, rate, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		count, unit, _ := strings.Cut(strings.TrimSpace(rate), "/")
+		n, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+		if !ok || pattern == "" || err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			continue
+		}
+		per := time.Second
+		switch unit = strings.TrimSpace(unit); unit {
+		case "", "s":
+		case "m":
+			per = time.Minute
+		case "h":
+			per = time.Hour
+		default:
+			if per, err = time.ParseDuration(unit); err != nil || per <= 0 {
+				continue
+			}
+		}
+		limit := RateLimit{Pattern: pattern}
+		if n > 0 {
+			limit.Interval = time.Duration(float64(per) / n)
+		}
+		limits = append(limits, limit)
+	}
+	return limits
+}
+
+// Keys hashed to pick the requests sent to CANARY_UPSTREAM.
+const (
+	CanaryHashHost   = "host"
+	CanaryHashClient = "client"
+)
+
+// Signals DUMP_SIGNAL can name.
+const (
+	DumpSignalQuit = "SIGQUIT"
+	DumpSignalUSR2 = "SIGUSR2"
+)
+
+// Bodies WEBHOOK_URL is sent.
+const (
+	WebhookFormatJSON  = "json"
+	WebhookFormatSlack = "slack"
+)
+
+// How LOG_ANONYMIZE and FLOW_LOG_ANONYMIZE treat client addresses.
+const (
+	AnonymizeOff      = "off"
+	AnonymizeTruncate = "truncate"
+	AnonymizeHash     = "hash"
+)
+
+// What THREAT_FEED_ACTION does with destinations listed in THREAT_FEEDS.
+const (
+	ThreatActionBlock = "block"
+	ThreatActionFlag  = "flag"
+)
+
+// QoS priorities, from the one shaped least to the one shaped most.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// QoSClass assigns the destinations matching Pattern a Priority.
+type QoSClass struct {
+	Pattern  string
+	Priority string
+}
+
+// GetQoSClasses parses a comma-separated list of pattern=priority entries.
+// Entries with an unknown priority are skipped.
+func GetQoSClasses(s string) []QoSClass {
+	var classes []QoSClass
+	for _, part := range strings.Split(s, ",") {
+		pattern, priority, ok := strings.Cut(part, "=")
+		class := QoSClass{Pattern: strings.TrimSpace(pattern), Priority: strings.ToLower(strings.TrimSpace(priority))}
+		if !ok || class.Pattern == "" {
+			continue
+		}
+		switch class.Priority {
+		case PriorityHigh, PriorityNormal, PriorityLow:
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// ChaosRule injects faults into requests to destinations matching Pattern.
+// Rates are probabilities from 0 to 1.
+type ChaosRule struct {
+	Pattern     string
+	Latency     time.Duration
+	Bandwidth   int64
+	ResetRate   float64
+	ErrorStatus int
+	ErrorRate   float64
+}
+
+// GetChaosRules parses a comma-separated list of pattern=faults entries,
+// where faults are separated by semicolons:
+//
+//	latency:<duration>         delay before the request is forwarded
+//	bandwidth:<bytes/s>        throughput cap of the connection
+//	reset:<rate>               reset the client connection
+//	error:<status>[:<rate>]    answer with status instead
+//
+// Entries with an invalid fault are skipped.
+func GetChaosRules(s string) []ChaosRule {
+	var rules []ChaosRule
+	for _, part := range strings.Split(s, ",") {
+		pattern, faults, ok := strings.Cut(part, "=")
+		rule := ChaosRule{Pattern: strings.TrimSpace(pattern)}
+		if !ok || rule.Pattern == "" {
+			continue
+		}
+		valid := true
+		for _, fault := range strings.Split(faults, ";") {
+			if !rule.parseFault(strings.TrimSpace(fault)) {
+				valid = false
+			}
+		}
+		if valid {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (r *ChaosRule) parseFault(fault string) bool {
+	kind, args, _ := strings.Cut(fault, ":")
+	var err error
+	switch strings.ToLower(kind) {
+	case "latency":
+		r.Latency, err = time.ParseDuration(args)
+		return err == nil && r.Latency >= 0
+	case "bandwidth":
+		r.Bandwidth, err = strconv.ParseInt(args, 10, 64)
+		return err == nil && r.Bandwidth > 0
+	case "reset":
+		r.ResetRate, err = strconv.ParseFloat(args, 64)
+		return err == nil && r.ResetRate >= 0 && r.ResetRate <= 1
+	case "error":
+		status, rate, hasRate := strings.Cut(args, ":")
+		r.ErrorRate = 1
+		if hasRate {
+			if r.ErrorRate, err = strconv.ParseFloat(rate, 64); err != nil || r.ErrorRate < 0 || r.ErrorRate > 1 {
+				return false
+			}
+		}
+		r.ErrorStatus, err = strconv.Atoi(status)
+		return err == nil && r.ErrorStatus >= 100 && r.ErrorStatus <= 599
+	}
+	return false
+}
+
+// GetHostMap parses a comma-separated list of name=ip[:port] overrides.
+// Names are lowercased; entries without a valid IP address are skipped.
+func GetHostMap(s string) map[string]string {
+	var hosts map[string]string
+	for _, part := range strings.Split(s, ",") {
+		name, target, ok := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		target = strings.TrimSpace(target)
+		if !ok || name == "" {
+			continue
+		}
+		ip := target
+		if host, _, err := net.SplitHostPort(target); err == nil {
+			ip = host
+		}
+		if net.ParseIP(strings.Trim(ip, "[]")) == nil {
+			continue
+		}
+		if hosts == nil {
+			hosts = make(map[string]string)
+		}
+		hosts[name] = target
+	}
+	return hosts
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
 func IsException(host string, exceptions []string) bool {
+	_, ok := MatchException(host, exceptions)
+	return ok
+}
+
+// LocalPattern is the exception pattern matching plain host names, i.e.
+// names without a dot, as in the Windows proxy bypass list.
+const LocalPattern = "<local>"
+
+// MatchException returns the first exception pattern matching host.
+func MatchException(host string, exceptions []string) (string, bool) {
 	hostCandidates := buildHostCandidates(host)
 	if len(hostCandidates) == 0 {
-		return false
+		return "", false
 	}
 
-	for _, pattern := range exceptions {
-		pattern = strings.TrimSpace(strings.TrimSuffix(pattern, "/"))
+	for _, exception := range exceptions {
+		pattern := CanonicalHost(strings.TrimSuffix(exception, "/"))
 		if pattern == "" {
 			continue
 		}
 
+		if pattern == LocalPattern {
+			if name := normalizeHostToken(stripPortOf(host)); name != "" && !strings.Contains(name, ".") && !isIPLiteral(name) {
+				return exception, true
+			}
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(pattern); err == nil {
+			for _, candidate := range hostCandidates {
+				if ip, ok := literalIP(candidate); ok && network.Contains(ip.AsSlice()) {
+					return exception, true
+				}
+			}
+			continue
+		}
+
+		// IP literals match by address, whatever their spelling.
+		if patternIP, ok := literalIP(pattern); ok {
+			for _, candidate := range hostCandidates {
+				if ip, ok := literalIP(candidate); ok && ip == patternIP {
+					return exception, true
+				}
+			}
+			continue
+		}
+
 		if strings.Contains(pattern, "*") {
 			regex := wildcardPatternToRegex(pattern)
 			for _, candidate := range hostCandidates {
 				if matched, err := regexp.MatchString(regex, candidate); err == nil && matched {
-					return true
+					return exception, true
 				}
 			}
 			continue
 		}
 
-		normalizedPattern := normalizeHostToken(pattern)
 		for _, candidate := range hostCandidates {
-			if strings.EqualFold(normalizeHostToken(candidate), normalizedPattern) {
-				return true
+			if matchDomain(pattern, candidate) {
+				return exception, true
 			}
 		}
 	}
 
+	return "", false
+}
+
+// matchDomain matches a host name pattern the way curl matches NO_PROXY
+// entries: "example.com" and ".example.com" both match example.com and its
+// subdomains, and a pattern with a port only matches that port. host is a
+// candidate of buildHostCandidates, with or without a port.
+func matchDomain(pattern, host string) bool {
+	patternName, patternPort, _ := strings.Cut(pattern, ":")
+	if strings.Contains(patternPort, ":") || strings.HasPrefix(pattern, "[") {
+		// An IPv6 address that did not parse; it can only match verbatim.
+		return strings.EqualFold(normalizeHostToken(pattern), normalizeHostToken(host))
+	}
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+	patternName = strings.TrimPrefix(patternName, ".")
+	if patternPort != port || patternName == "" {
+		return false
+	}
+	if isIPLiteral(name) {
+		return strings.EqualFold(name, patternName)
+	}
+	suffix, ok := strings.CutSuffix(strings.ToLower(name), strings.ToLower(patternName))
+	return ok && (suffix == "" || strings.HasSuffix(suffix, "."))
+}
+
+// MatchExceptionIP returns the first CIDR exception pattern containing ip.
+func MatchExceptionIP(ip net.IP, exceptions []string) (string, bool) {
+	for _, exception := range exceptions {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(exception))
+		if err == nil && network.Contains(ip) {
+			return exception, true
+		}
+	}
+	return "", false
+}
+
+// HasCIDRExceptions reports whether any exception pattern is a CIDR range,
+// i.e. whether routing may depend on the address a host resolves to.
+func HasCIDRExceptions(exceptions []string) bool {
+	for _, exception := range exceptions {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(exception)); err == nil {
+			return true
+		}
+	}
 	return false
 }
 
 func buildHostCandidates(host string) []string {
-	host = strings.TrimSpace(host)
+	host = CanonicalHost(host)
 	if host == "" {
 		return nil
 	}
@@ -176,6 +1084,11 @@ func buildHostCandidates(host string) []string {
 	return candidates
 }
 
+func stripPortOf(host string) string {
+	h, _ := splitOutPort(strings.TrimSpace(host))
+	return h
+}
+
 func splitOutPort(host string) (string, bool) {
 	h, _, err := net.SplitHostPort(host)
 	if err != nil {
@@ -184,6 +1097,66 @@ func splitOutPort(host string) (string, bool) {
 	return h, true
 }
 
+// CanonicalHost normalizes a host or host:port for matching and logging: the
+// name is lowercased, loses a trailing dot, and internationalized labels are
+// converted to punycode, so "Bücher.example." and "xn--bcher-kva.example"
+// are the same host. Labels that are not valid IDNs are only lowercased.
+func CanonicalHost(host string) string {
+	host = strings.TrimSpace(host)
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return canonicalName(host)
+	}
+	return net.JoinHostPort(canonicalName(name), port)
+}
+
+func canonicalName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if addr, err := netip.ParseAddr(strings.Trim(name, "[]")); err == nil {
+		// One spelling per address: compressed, with IPv4-mapped addresses
+		// as plain IPv4.
+		canonical := addr.Unmap().String()
+		if strings.HasPrefix(name, "[") && addr.Unmap().Is6() {
+			canonical = "[" + canonical + "]"
+		}
+		return canonical
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		if ascii, err := idna.Lookup.ToASCII(label); err == nil {
+			labels[i] = ascii
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// literalIP parses an IP address literal, bracketed or not, ignoring an
+// IPv6 zone. IPv4-mapped IPv6 addresses are returned as IPv4.
+func literalIP(host string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(normalizeHostToken(host))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+func isIPLiteral(host string) bool {
+	_, ok := literalIP(host)
+	return ok
+}
+
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
 func normalizeHostToken(token string) string {
 	token = strings.TrimSpace(token)
 	if strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]") && len(token) > 2 {
@@ -197,3 +1170,24 @@ func wildcardPatternToRegex(pattern string) string {
 	re = strings.ReplaceAll(re, `\*`, ".*")
 	return "(?i)^" + re + "$"
 }
+
+// Change describes a setting that differs between two configurations.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Diff lists the settings that differ between old and new, in field order.
+func Diff(old, new Config) []Change {
+	var changes []Change
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := range ov.NumField() {
+		o, n := fmt.Sprint(ov.Field(i).Interface()), fmt.Sprint(nv.Field(i).Interface())
+		if o == n {
+			continue
+		}
+		changes = append(changes, Change{Field: ov.Type().Field(i).Name, Old: o, New: n})
+	}
+	return changes
+}
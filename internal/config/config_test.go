@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net"
 	"os"
 	"reflect"
 	"regexp"
@@ -55,6 +56,159 @@ func TestIsException(t *testing.T) {
 	}
 }
 
+func TestIsExceptionMatchesLikeCurl(t *testing.T) {
+	tests := []struct {
+		host      string
+		exception string
+		expected  bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", true},
+		{"a.b.example.com:443", "example.com", true},
+		{"notexample.com", "example.com", false},
+		{"example.com.evil", "example.com", false},
+		{"example.com", ".example.com", true},
+		{"www.example.com", ".example.com", true},
+		{"notexample.com", ".example.com", false},
+		{"anything.test:8443", "*", true},
+		{"10.0.0.1", "*", true},
+		{"www.example.com:8080", "example.com:8080", true},
+		{"www.example.com:443", "example.com:8080", false},
+		{"www.example.com", "example.com:8080", false},
+		{"www.example.com:8080", ".example.com:8080", true},
+		{"10.0.0.1:8080", "10.0.0.1:8080", true},
+		{"110.0.0.1:8080", "0.0.1:8080", false},
+		{"example.com", ".", false},
+	}
+	for _, tt := range tests {
+		if got := IsException(tt.host, []string{tt.exception}); got != tt.expected {
+			t.Errorf("IsException(%q, [%q]) = %v; expected %v", tt.host, tt.exception, got, tt.expected)
+		}
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"Example.com.:443", "example.com:443"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"BÜCHER.example:8080", "xn--bcher-kva.example:8080"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"*.bücher.example", "*.xn--bcher-kva.example"},
+		{"[2001:DB8::1]:443", "[2001:db8::1]:443"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"[2001:db8:0:0::1]:443", "[2001:db8::1]:443"},
+		{"[::ffff:10.0.0.1]:80", "10.0.0.1:80"},
+		{"2001:DB8::1", "2001:db8::1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalHost(tt.host); got != tt.expected {
+			t.Errorf("CanonicalHost(%q) = %q; expected %q", tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestIsExceptionMatchesIDNForms(t *testing.T) {
+	tests := []struct {
+		host       string
+		exceptions []string
+	}{
+		{"xn--bcher-kva.example", []string{"bücher.example"}},
+		{"bücher.example:443", []string{"xn--bcher-kva.example"}},
+		{"shop.xn--bcher-kva.example", []string{"*.Bücher.example"}},
+		{"intranet.corp.", []string{"intranet.corp"}},
+	}
+
+	for _, tt := range tests {
+		if !IsException(tt.host, tt.exceptions) {
+			t.Errorf("IsException(%q, %v) = false; expected true", tt.host, tt.exceptions)
+		}
+	}
+}
+
+func TestIsExceptionMatchesCIDR(t *testing.T) {
+	exceptions := []string{"10.0.0.0/8", "192.168.0.0/16", "fd00::/8"}
+
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{"10.1.2.3", true},
+		{"10.1.2.3:443", true},
+		{"192.168.10.1:8080", true},
+		{"[fd12::1]:443", true},
+		{"172.16.0.1", false},
+		{"intranet.corp", false},
+	}
+
+	for _, tt := range tests {
+		if IsException(tt.host, exceptions) != tt.expected {
+			t.Errorf("IsException(%q) = %v; expected %v", tt.host, !tt.expected, tt.expected)
+		}
+	}
+
+	if rule, ok := MatchExceptionIP(net.ParseIP("192.168.1.1"), exceptions); !ok || rule != "192.168.0.0/16" {
+		t.Errorf("MatchExceptionIP(192.168.1.1) = %q, %v; expected 192.168.0.0/16", rule, ok)
+	}
+	if !HasCIDRExceptions(exceptions) || HasCIDRExceptions([]string{"localhost", "*.corp"}) {
+		t.Errorf("HasCIDRExceptions misreported CIDR patterns")
+	}
+}
+
+func TestIsExceptionMatchesIPv6Literals(t *testing.T) {
+	tests := []struct {
+		host     string
+		pattern  string
+		expected bool
+	}{
+		{"[2001:db8::1]:443", "2001:db8::1", true},
+		{"[2001:db8::1]:443", "[2001:db8::1]", true},
+		{"[2001:db8::1]:443", "2001:DB8:0:0::1", true},
+		{"[2001:db8::1]:443", "[2001:db8::1]:443", true},
+		{"[2001:db8::1]:443", "[2001:db8::1]:8443", false},
+		{"2001:db8::1", "2001:db8::1", true},
+		{"[2001:db8::2]:443", "2001:db8::1", false},
+		{"[fe80::1%eth0]:80", "fe80::/10", true},
+		{"[fe80::1%eth0]:80", "fe80::1", true},
+		{"[::ffff:10.0.0.1]:80", "10.0.0.1", true},
+		{"[::ffff:10.0.0.1]:80", "10.0.0.0/8", true},
+	}
+
+	for _, tt := range tests {
+		if got := IsException(tt.host, []string{tt.pattern}); got != tt.expected {
+			t.Errorf("IsException(%q, %q) = %v; expected %v", tt.host, tt.pattern, got, tt.expected)
+		}
+	}
+}
+
+func TestIsExceptionMatchesLocalPattern(t *testing.T) {
+	exceptions := []string{LocalPattern}
+
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{"intranet", true},
+		{"intranet:8080", true},
+		{"wiki.corp.example", false},
+		{"10.0.0.1", false},
+		{"[::1]:443", false},
+		{"[fe80::1%eth0]:443", false},
+	}
+
+	for _, tt := range tests {
+		if IsException(tt.host, exceptions) != tt.expected {
+			t.Errorf("IsException(%q) = %v; expected %v", tt.host, !tt.expected, tt.expected)
+		}
+	}
+}
+
 func TestBuildHostCandidates(t *testing.T) {
 	tests := []struct {
 		host     string
@@ -231,6 +385,42 @@ func TestLoadConfigTimeoutOverrides(t *testing.T) {
 	}
 }
 
+func TestLoadConfigOffValues(t *testing.T) {
+	t.Setenv("TCP_KEEPALIVE", "-1s")
+	t.Setenv("WEBHOOK_AUTH_FAILURES", "0")
+	t.Setenv("TUNNEL_HALF_CLOSE_TIMEOUT", "0")
+	t.Setenv("DEST_RATE_LIMIT_WAIT", "0")
+	t.Setenv("AUTH_AUDIT_WINDOW", "0")
+
+	cfg := LoadConfig()
+
+	if cfg.TCPKeepAlive != -time.Second {
+		t.Fatalf("TCPKeepAlive = %v; expected -1s to disable keep-alives", cfg.TCPKeepAlive)
+	}
+	if cfg.WebhookAuthFailures != 0 {
+		t.Fatalf("WebhookAuthFailures = %d; expected 0 to disable the event", cfg.WebhookAuthFailures)
+	}
+	if cfg.TunnelHalfCloseTimeout != 0 {
+		t.Fatalf("TunnelHalfCloseTimeout = %v; expected 0 to wait indefinitely", cfg.TunnelHalfCloseTimeout)
+	}
+	if cfg.DestRateLimitWait != 0 {
+		t.Fatalf("DestRateLimitWait = %v; expected 0 to refuse requests over the rate at once", cfg.DestRateLimitWait)
+	}
+	if cfg.AuthAuditWindow != 0 {
+		t.Fatalf("AuthAuditWindow = %v; expected 0 to write every outcome", cfg.AuthAuditWindow)
+	}
+}
+
+func TestLoadConfigDumpSignal(t *testing.T) {
+	if got := DefaultConfig().DumpSignal; got != DumpSignalQuit {
+		t.Fatalf("default DumpSignal = %q; expected %q", got, DumpSignalQuit)
+	}
+	t.Setenv("DUMP_SIGNAL", "sigusr2")
+	if got := LoadConfig().DumpSignal; got != DumpSignalUSR2 {
+		t.Fatalf("DumpSignal = %q; expected %q", got, DumpSignalUSR2)
+	}
+}
+
 func TestLoadConfigTimeoutDefaults(t *testing.T) {
 	clearEnv(t,
 		"SERVER_READ_HEADER_TIMEOUT",
@@ -299,3 +489,196 @@ func clearEnv(t *testing.T, keys ...string) {
 		}
 	}
 }
+
+func TestDiff(t *testing.T) {
+	old := DefaultConfig()
+	updated := old
+	updated.UpstreamProxy = "proxy:3128"
+	updated.ProxyExceptions = []string{"localhost"}
+	updated.TransportDialTimeout = 3 * time.Second
+
+	expected := []Change{
+		{Field: "UpstreamProxy", Old: "", New: "proxy:3128"},
+		{Field: "ProxyExceptions", Old: "[]", New: "[localhost]"},
+		{Field: "TransportDialTimeout", Old: "10s", New: "3s"},
+	}
+	if got := Diff(old, updated); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Diff = %#v; expected %#v", got, expected)
+	}
+
+	empty := old
+	empty.ProxyExceptions = nil
+	if got := Diff(old, empty); len(got) != 0 {
+		t.Fatalf("Diff between empty and nil exceptions = %#v; expected none", got)
+	}
+}
+
+func TestUpstreams(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"proxy-a:8080", []string{"proxy-a:8080"}},
+		{"proxy-a:8080, proxy-b:3128,", []string{"proxy-a:8080", "proxy-b:3128"}},
+	}
+
+	for _, tt := range tests {
+		cfg := Config{UpstreamProxy: tt.input}
+		if got := cfg.Upstreams(); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Upstreams() for %q = %v; expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestGetDNSServers(t *testing.T) {
+	input := "10.0.0.53, 10.0.1.53:5353, ,2001:db8::53, [2001:db8::54]:53, tls://1.1.1.1, tls://dns.example:8853, https://dns.example/dns-query"
+	expected := []string{"10.0.0.53:53", "10.0.1.53:5353", "[2001:db8::53]:53", "[2001:db8::54]:53", "tls://1.1.1.1:853", "tls://dns.example:8853", "https://dns.example/dns-query"}
+
+	if got := GetDNSServers(input); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetDNSServers(%q) = %v; expected %v", input, got, expected)
+	}
+}
+
+func TestGetDNSRoutes(t *testing.T) {
+	input := "*.corp.example=10.0.0.53|10.0.0.54:5353, intranet=tls://10.0.0.53, broken, empty="
+	expected := []DNSRoute{
+		{Pattern: "*.corp.example", Servers: []string{"10.0.0.53:53", "10.0.0.54:5353"}},
+		{Pattern: "intranet", Servers: []string{"tls://10.0.0.53:853"}},
+	}
+	if got := GetDNSRoutes(input); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetDNSRoutes(%q) = %v; expected %v", input, got, expected)
+	}
+}
+
+func TestGetBindRoutes(t *testing.T) {
+	input := "*.corp.example=eth1, 10.0.0.0/8=10.1.2.3, broken, empty="
+	expected := []BindRoute{
+		{Pattern: "*.corp.example", Bind: "eth1"},
+		{Pattern: "10.0.0.0/8", Bind: "10.1.2.3"},
+	}
+	if got := GetBindRoutes(input); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetBindRoutes(%q) = %v; expected %v", input, got, expected)
+	}
+}
+
+func TestGetAppRoutes(t *testing.T) {
+	input := "git=direct, Firefox.EXE = Upstream,torrent=block,curl=proxy,=direct,broken"
+	expected := []AppRoute{
+		{App: "git", Route: AppRouteDirect},
+		{App: "firefox", Route: AppRouteUpstream},
+		{App: "torrent", Route: AppRouteBlock},
+	}
+	if got := GetAppRoutes(input); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetAppRoutes(%q) = %v; expected %v", input, got, expected)
+	}
+}
+
+func TestGetAuthSchemes(t *testing.T) {
+	input := " Negotiate,ntlm,kerberos,NTLM,,basic"
+	expected := []string{"negotiate", "ntlm", "basic"}
+	if got := GetAuthSchemes(input); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetAuthSchemes(%q) = %v; expected %v", input, got, expected)
+	}
+}
+
+func TestGetUpstreamExceptions(t *testing.T) {
+	got := GetUpstreamExceptions(" *.partner.com = proxy-b:3128,10.0.0.0/8=proxy-b:3128,bad,=proxy-c:3128,intranet=")
+	expected := []UpstreamException{
+		{Pattern: "*.partner.com", Upstream: "proxy-b:3128"},
+		{Pattern: "10.0.0.0/8", Upstream: "proxy-b:3128"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetUpstreamExceptions = %+v; expected %+v", got, expected)
+	}
+
+	tests := []struct {
+		host, upstream string
+		expected       bool
+	}{
+		{"api.partner.com:443", "proxy-b:3128", true},
+		{"api.partner.com", "PROXY-B:3128", true},
+		{"api.partner.com", "proxy-a:3128", false},
+		{"10.1.2.3:80", "proxy-b:3128", true},
+		{"example.com", "proxy-b:3128", false},
+	}
+	for _, tt := range tests {
+		if got := ExcludesUpstream(tt.host, tt.upstream, expected); got != tt.expected {
+			t.Errorf("ExcludesUpstream(%q, %q) = %v; expected %v", tt.host, tt.upstream, got, tt.expected)
+		}
+	}
+}
+
+func TestGetConnLimits(t *testing.T) {
+	got := GetConnLimits(" *.cdn.example = 20 ,intranet=0,bad,neg=-1,nan=x,=3")
+	expected := []ConnLimit{{Pattern: "*.cdn.example", Limit: 20}, {Pattern: "intranet", Limit: 0}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetConnLimits = %+v; expected %+v", got, expected)
+	}
+}
+
+func TestGetRateLimits(t *testing.T) {
+	got := GetRateLimits("partner-api.example=1, *.example.org = 10/m,slow=0.5,hourly=100/h,window=5/30s,off=0,bad,neg=-1,unit=1/d,nan=NaN,=3")
+	expected := []RateLimit{
+		{Pattern: "partner-api.example", Interval: time.Second},
+		{Pattern: "*.example.org", Interval: 6 * time.Second},
+		{Pattern: "slow", Interval: 2 * time.Second},
+		{Pattern: "hourly", Interval: 36 * time.Second},
+		{Pattern: "window", Interval: 6 * time.Second},
+		{Pattern: "off"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetRateLimits = %+v; expected %+v", got, expected)
+	}
+}
+
+func TestGetQoSClasses(t *testing.T) {
+	got := GetQoSClasses("*.zoom.us=HIGH, download.example = low,bad,x=urgent,=high")
+	expected := []QoSClass{{Pattern: "*.zoom.us", Priority: PriorityHigh}, {Pattern: "download.example", Priority: PriorityLow}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetQoSClasses = %+v; expected %+v", got, expected)
+	}
+}
+
+func TestGetChaosRules(t *testing.T) {
+	got := GetChaosRules("*.slow=latency:500ms;bandwidth:1024, flaky=reset:0.1;error:503:0.25,down=error:502,bad=latency:x,odd=error:700,rare=reset:2,=error:500")
+	expected := []ChaosRule{
+		{Pattern: "*.slow", Latency: 500 * time.Millisecond, Bandwidth: 1024},
+		{Pattern: "flaky", ResetRate: 0.1, ErrorStatus: 503, ErrorRate: 0.25},
+		{Pattern: "down", ErrorStatus: 502, ErrorRate: 1},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetChaosRules = %+v; expected %+v", got, expected)
+	}
+}
+
+func TestGetURLs(t *testing.T) {
+	got := GetURLs(" https://hooks.slack.com/services/T0/B0/x ,http://alerts.internal:8080/hook,ftp://x,/relative,, https://")
+	expected := []string{"https://hooks.slack.com/services/T0/B0/x", "http://alerts.internal:8080/hook"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetURLs = %+v; expected %+v", got, expected)
+	}
+}
+
+func TestGetCountries(t *testing.T) {
+	got := GetCountries(" de ,FR,usa,1x,,x, Cn")
+	expected := []string{"DE", "FR", "CN"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetCountries = %+v; expected %+v", got, expected)
+	}
+}
+
+func TestGetHostMap(t *testing.T) {
+	input := "App.Example=10.0.0.5, api.example.=10.0.0.6:8443, v6.example=[2001:db8::1]:443, bad.example=not-an-ip, =10.0.0.7, broken"
+	expected := map[string]string{
+		"app.example": "10.0.0.5",
+		"api.example": "10.0.0.6:8443",
+		"v6.example":  "[2001:db8::1]:443",
+	}
+	if got := GetHostMap(input); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetHostMap(%q) = %v; expected %v", input, got, expected)
+	}
+	if got := GetHostMap(""); got != nil {
+		t.Fatalf("GetHostMap(\"\") = %v; expected nil", got)
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// expandedKeys are the settings whose values may refer to other settings or
+// environment variables as ${NAME}, or ${NAME:-default} for a default used
+// when NAME is unset or empty, so that one config file serves several
+// environments.
+var expandedKeys = []string{
+	"UPSTREAM_PROXY",
+	"PROXY_EXCEPTIONS",
+	"UPSTREAM_EXCEPTIONS",
+	"MIRROR_UPSTREAM",
+	"CANARY_UPSTREAM",
+	"CANARY_HOSTS",
+}
+
+// expanding returns lookup with the values of expandedKeys expanded.
+func (lookup lookupFunc) expanding() lookupFunc {
+	return func(key string) (string, bool) {
+		val, ok := lookup(key)
+		if ok && slices.Contains(expandedKeys, key) {
+			val = lookup.expand(val)
+		}
+		return val, ok
+	}
+}
+
+// expand replaces ${NAME} and ${NAME:-default} in s with the value of NAME.
+// Values are not expanded again, and a "${" without a closing brace is kept
+// as it is.
+func (lookup lookupFunc) expand(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		name, defaultVal, _ := strings.Cut(s[start+2:start+end], ":-")
+		val, _ := lookup(strings.TrimSpace(name))
+		if val == "" {
+			val = defaultVal
+		}
+		b.WriteString(s[:start])
+		b.WriteString(val)
+		s = s[start+end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{"DOMAIN": "corp.example", "PORT": "", "HOST": "proxy"}
+	lookup := lookupFunc(func(key string) (string, bool) {
+		val, ok := env[key]
+		return val, ok
+	})
+	tests := []struct {
+		in, expected string
+	}{
+		{"plain", "plain"},
+		{"${HOST}.${DOMAIN}:8080", "proxy.corp.example:8080"},
+		{"${ HOST }", "proxy"},
+		{"${PORT:-3128}", "3128"},
+		{"${MISSING:-fallback}", "fallback"},
+		{"${MISSING}x", "x"},
+		{"$HOST ${HOST", "$HOST ${HOST"},
+		{"pa$$word@${HOST}", "pa$$word@proxy"},
+	}
+	for _, tt := range tests {
+		if got := lookup.expand(tt.in); got != tt.expected {
+			t.Errorf("expand(%q) = %q; expected %q", tt.in, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadExpandsRuleValues(t *testing.T) {
+	env := map[string]string{
+		"ENVIRONMENT":                 "staging",
+		"DOMAIN":                      "corp.example",
+		"LISTEN_ADDR":                 ":8080,:3128;tenant=ci",
+		"UPSTREAM_PROXY":              "proxy.${ENVIRONMENT}.${DOMAIN}:${PROXY_PORT:-8080}",
+		"PROXY_EXCEPTIONS":            "localhost,*.${DOMAIN}",
+		"UPSTREAM_EXCEPTIONS":         "*.partner.com=proxy.${ENVIRONMENT}.${DOMAIN}:8080",
+		"TENANT_CI_UPSTREAM_PROXY":    "ci.${DOMAIN}:3128",
+		"FLOW_LOG":                    "/var/log/${ENVIRONMENT}.log",
+		"TENANT_CI_CLIENT_AUTH_USERS": "runner:${TOKEN}",
+	}
+	cfg := load(func(key string) (string, bool) {
+		val, ok := env[key]
+		return val, ok
+	})
+	if cfg.UpstreamProxy != "proxy.staging.corp.example:8080" {
+		t.Errorf("UpstreamProxy = %q; expected it expanded", cfg.UpstreamProxy)
+	}
+	if expected := []string{"localhost", "*.corp.example"}; !reflect.DeepEqual(cfg.ProxyExceptions, expected) {
+		t.Errorf("ProxyExceptions = %q; expected %q", cfg.ProxyExceptions, expected)
+	}
+	if expected := []UpstreamException{{Pattern: "*.partner.com", Upstream: "proxy.staging.corp.example:8080"}}; !reflect.DeepEqual(cfg.UpstreamExceptions, expected) {
+		t.Errorf("UpstreamExceptions = %+v; expected %+v", cfg.UpstreamExceptions, expected)
+	}
+	if got := cfg.ForTenant("ci").UpstreamProxy; got != "ci.corp.example:3128" {
+		t.Errorf("UpstreamProxy of tenant ci = %q; expected it expanded", got)
+	}
+	if cfg.FlowLog != "/var/log/${ENVIRONMENT}.log" || cfg.ForTenant("ci").ClientUsers["runner"] != "${TOKEN}" {
+		t.Errorf("settings other than rules and upstreams were expanded")
+	}
+}
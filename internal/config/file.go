@@ -0,0 +1,189 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Load builds the configuration from the environment and, if CONFIG_FILE is
+// set, from that file. The file uses the same keys as the environment
+// variables, one KEY=VALUE pair per line; environment variables take
+// precedence over values from the file. If CONFIG_KV names a Consul or etcd
+// key, or CONFIG_URL a URL, its value is read in the same format and takes
+// precedence over the file, CONFIG_KV over CONFIG_URL. If CONFIG_URL cannot
+// be reached, the config is returned along with an error wrapping
+// ErrConfigURLUnreachable. If PROFILES are defined, the settings of the
+// first one matching the current network take precedence over all of these.
+func Load() (Config, error) {
+	path := strings.TrimSpace(os.Getenv("CONFIG_FILE"))
+	var fileValues, urlValues, kvValues map[string]string
+	if path != "" {
+		var err error
+		if fileValues, err = ReadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+	lookup := func(key string) (string, bool) {
+		if val, ok := os.LookupEnv(key); ok {
+			return val, true
+		}
+		if val, ok := kvValues[key]; ok {
+			return val, true
+		}
+		if val, ok := urlValues[key]; ok {
+			return val, true
+		}
+		val, ok := fileValues[key]
+		return val, ok
+	}
+	if source, _ := lookup("CONFIG_KV"); strings.TrimSpace(source) != "" {
+		token, _ := lookup("CONFIG_KV_TOKEN")
+		kv, err := ParseKVSource(source, token)
+		if err != nil {
+			return Config{}, err
+		}
+		if kvValues, err = kv.Read(); err != nil {
+			return Config{}, err
+		}
+	}
+	var urlErr error
+	if rawURL, _ := lookup("CONFIG_URL"); strings.TrimSpace(rawURL) != "" {
+		publicKey, _ := lookup("CONFIG_URL_PUBLIC_KEY")
+		source, err := URLSourceFor(rawURL, publicKey)
+		if err != nil {
+			return Config{}, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), urlFetchTimeout)
+		urlValues, _, urlErr = source.Fetch(ctx)
+		cancel()
+		if urlErr != nil && !errors.Is(urlErr, ErrConfigURLUnreachable) {
+			return Config{}, urlErr
+		}
+	}
+
+	var profile string
+	if profiles := GetProfiles(lookupFunc(lookup).str("PROFILES", "")); len(profiles) > 0 {
+		profile = detectProfile(profiles)
+	}
+	config, err := loadChecked(profileLookup(lookup, profile))
+	if err != nil {
+		return Config{}, err
+	}
+	config.ConfigFile = path
+	config.Profile = profile
+	applyKubernetes(&config)
+	if err := applySystemProxy(&config); err != nil {
+		return config, err
+	}
+	return config, urlErr
+}
+
+// ReadFile parses a KEY=VALUE config file. Blank lines and lines starting
+// with '#' are ignored, and values may be wrapped in single or double quotes.
+func ReadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return parseValues(data, path)
+}
+
+// parseValues parses KEY=VALUE lines read from name.
+func parseValues(data []byte, name string) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		key, val, ok, err := parseLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		if ok {
+			values[key] = val
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return values, nil
+}
+
+// UpdateFile rewrites the given keys in a KEY=VALUE config file, keeping
+// comments, ordering and unrelated keys intact. Keys not yet present are
+// appended, and the file is created if it does not exist. A symlinked file
+// is rewritten where the link points, and an existing file keeps its mode.
+func UpdateFile(path string, values map[string]string) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	pending := maps.Clone(values)
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if key, _, ok, _ := parseLine(line); ok {
+			if val, found := pending[key]; found {
+				line = key + "=" + val
+				delete(pending, key)
+			}
+		}
+		out.WriteString(line + "\n")
+	}
+	for _, k := range slices.Sorted(maps.Keys(pending)) {
+		out.WriteString(k + "=" + pending[k] + "\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dynamicproxy-config-*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+	}
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
+	return nil
+}
+
+func parseLine(line string) (key, val string, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+	line = strings.TrimPrefix(line, "export ")
+	key, val, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return "", "", false, fmt.Errorf("expected KEY=VALUE, got %q", line)
+	}
+	val = strings.TrimSpace(val)
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		val = val[1 : len(val)-1]
+	}
+	return key, val, true, nil
+}
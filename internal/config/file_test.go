@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.env")
+	content := "# comment\n\nUPSTREAM_PROXY=proxy:3128\nexport PROXY_AUTH=ntlm\nPROXY_EXCEPTIONS=\"localhost, *.corp\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	expected := map[string]string{
+		"UPSTREAM_PROXY":   "proxy:3128",
+		"PROXY_AUTH":       "ntlm",
+		"PROXY_EXCEPTIONS": "localhost, *.corp",
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("values[%q] = %q; expected %q", k, values[k], v)
+		}
+	}
+}
+
+func TestReadFileRejectsMalformedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.env")
+	if err := os.WriteFile(path, []byte("UPSTREAM_PROXY\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path); err == nil {
+		t.Fatal("expected error for line without '='")
+	}
+}
+
+func TestUpdateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.env")
+	if err := os.WriteFile(path, []byte("# keep me\nUPSTREAM_PROXY=old:3128\nLISTEN_ADDR=:9090\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := UpdateFile(path, map[string]string{"UPSTREAM_PROXY": "new:3128", "FAIL_OPEN": "true"})
+	if err != nil {
+		t.Fatalf("UpdateFile error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	expected := "# keep me\nUPSTREAM_PROXY=new:3128\nLISTEN_ADDR=:9090\nFAIL_OPEN=true\n"
+	if string(data) != expected {
+		t.Fatalf("file content = %q; expected %q", data, expected)
+	}
+}
+
+func TestUpdateFileKeepsModeAndSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "shared.env")
+	if err := os.WriteFile(target, []byte("FAIL_OPEN=false\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(target, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "config.env")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	if err := UpdateFile(link, map[string]string{"FAIL_OPEN": "true"}); err != nil {
+		t.Fatalf("UpdateFile error: %v", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("config.env is no longer a symlink (%v)", err)
+	}
+	data, _ := os.ReadFile(target)
+	if string(data) != "FAIL_OPEN=true\n" {
+		t.Fatalf("target content = %q; expected the update written through the link", data)
+	}
+	if info, _ := os.Stat(target); runtime.GOOS != "windows" && info.Mode().Perm() != 0o640 {
+		t.Fatalf("target mode = %v; expected 0640 kept", info.Mode().Perm())
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.env")
+	if err := os.WriteFile(path, []byte("UPSTREAM_PROXY=file:3128\nPROXY_AUTH=ntlm\nFAIL_OPEN=true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clearEnv(t, "PROXY_AUTH", "FAIL_OPEN")
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("UPSTREAM_PROXY", "env:3128")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if cfg.UpstreamProxy != "env:3128" {
+		t.Fatalf("UpstreamProxy = %q; expected env value", cfg.UpstreamProxy)
+	}
+	if cfg.ProxyAuth != "ntlm" || !cfg.FailOpen {
+		t.Fatalf("file values not applied: auth=%q failOpen=%v", cfg.ProxyAuth, cfg.FailOpen)
+	}
+	if cfg.ConfigFile != path {
+		t.Fatalf("ConfigFile = %q; expected %q", cfg.ConfigFile, path)
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Paths and lookups used to detect the cluster, replaced in tests.
+var (
+	resolvConfPath = "/etc/resolv.conf"
+	interfaceAddrs = net.InterfaceAddrs
+)
+
+// applyKubernetes adds the cluster's networks and DNS domain to the
+// exceptions if KUBERNETES_SIDECAR is set and the proxy runs in a pod, so
+// in-cluster traffic goes direct instead of through the upstream.
+func applyKubernetes(cfg *Config) {
+	if !cfg.KubernetesSidecar || os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return
+	}
+	for _, pattern := range kubernetesExceptions(cfg.KubernetesCIDRs, os.Getenv("KUBERNETES_SERVICE_HOST")) {
+		if !slices.Contains(cfg.ProxyExceptions, pattern) {
+			cfg.ProxyExceptions = append(cfg.ProxyExceptions, pattern)
+		}
+	}
+}
+
+// kubernetesExceptions returns the exceptions for the cluster: plain names
+// and names under the cluster domain, and cidrs, or if there are none, the
+// networks around the API server's service IP and the pod's own addresses.
+// Clusters differ in their CIDRs, so the detected ones are /16 (/64 for
+// IPv6) guesses that KUBERNETES_CIDRS overrides.
+func kubernetesExceptions(cidrs []string, apiServer string) []string {
+	exceptions := []string{LocalPattern}
+	if domain := clusterDomain(); domain != "" {
+		exceptions = append(exceptions, "*."+domain)
+	}
+	if len(cidrs) > 0 {
+		return append(exceptions, cidrs...)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(apiServer); ip != nil {
+		ips = append(ips, ip)
+	}
+	if addrs, err := interfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.IsGlobalUnicast() {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	for _, ip := range ips {
+		bits, size := 16, 32
+		if ip.To4() == nil {
+			bits, size = 64, 128
+		}
+		network := (&net.IPNet{IP: ip.Mask(net.CIDRMask(bits, size)), Mask: net.CIDRMask(bits, size)}).String()
+		if !slices.Contains(exceptions, network) {
+			exceptions = append(exceptions, network)
+		}
+	}
+	return exceptions
+}
+
+// clusterDomain returns the cluster DNS domain, e.g. cluster.local, taken
+// from the "svc.<domain>" entry kubelet puts in the pod's search list.
+func clusterDomain() string {
+	for _, domain := range searchDomains() {
+		if rest, ok := strings.CutPrefix(domain, "svc."); ok && rest != "" {
+			return rest
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func stubCluster(t *testing.T, resolvConf string, addrs ...string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(path, []byte(resolvConf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	oldPath, oldAddrs := resolvConfPath, interfaceAddrs
+	t.Cleanup(func() { resolvConfPath, interfaceAddrs = oldPath, oldAddrs })
+	resolvConfPath = path
+	interfaceAddrs = func() ([]net.Addr, error) {
+		var list []net.Addr
+		for _, a := range addrs {
+			ip, ipnet, err := net.ParseCIDR(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: ipnet.Mask})
+		}
+		return list, nil
+	}
+}
+
+const podResolvConf = "search shop.svc.cluster.local svc.cluster.local cluster.local corp.example\nnameserver 10.96.0.10\noptions ndots:5\n"
+
+func TestKubernetesExceptions(t *testing.T) {
+	stubCluster(t, podResolvConf, "127.0.0.1/8", "10.244.1.17/24", "fd00:10:244::11/64")
+	got := kubernetesExceptions(nil, "10.96.0.1")
+	expected := []string{"<local>", "*.cluster.local", "10.96.0.0/16", "10.244.0.0/16", "fd00:10:244::/64"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("kubernetesExceptions = %v; expected %v", got, expected)
+	}
+
+	got = kubernetesExceptions([]string{"10.0.0.0/8"}, "10.96.0.1")
+	expected = []string{"<local>", "*.cluster.local", "10.0.0.0/8"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("kubernetesExceptions with KUBERNETES_CIDRS = %v; expected %v", got, expected)
+	}
+}
+
+func TestApplyKubernetes(t *testing.T) {
+	stubCluster(t, podResolvConf)
+	cfg := DefaultConfig()
+	cfg.ProxyExceptions = []string{"*.internal"}
+	cfg.KubernetesSidecar = true
+	cfg.KubernetesCIDRs = []string{"10.0.0.0/8"}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	applyKubernetes(&cfg)
+	if !reflect.DeepEqual(cfg.ProxyExceptions, []string{"*.internal"}) {
+		t.Fatalf("exceptions outside a pod = %v; expected them unchanged", cfg.ProxyExceptions)
+	}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	applyKubernetes(&cfg)
+	applyKubernetes(&cfg)
+	expected := []string{"*.internal", "<local>", "*.cluster.local", "10.0.0.0/8"}
+	if !reflect.DeepEqual(cfg.ProxyExceptions, expected) {
+		t.Fatalf("exceptions in a pod = %v; expected %v", cfg.ProxyExceptions, expected)
+	}
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key-value stores CONFIG_KV can read from.
+const (
+	KVConsul = "consul"
+	KVEtcd   = "etcd"
+)
+
+const (
+	// kvReadTimeout bounds reading CONFIG_KV while loading the config.
+	kvReadTimeout = 10 * time.Second
+	// kvWait is how long a Consul blocking query waits for a change.
+	kvWait = 5 * time.Minute
+)
+
+// KVSource is a Consul or etcd key holding KEY=VALUE lines like
+// CONFIG_FILE, so that a central team can manage the configuration, above
+// all routing rules and exceptions, of many instances at once.
+type KVSource struct {
+	// Kind is KVConsul or KVEtcd.
+	Kind string
+	// Endpoint is the base URL of the Consul agent or etcd gRPC gateway.
+	Endpoint string
+	Key      string
+	// Token is sent as X-Consul-Token to Consul and as Authorization to
+	// etcd.
+	Token  string
+	Client *http.Client
+}
+
+// ParseKVSource parses a CONFIG_KV value: consul://host:port/key or
+// etcd://host:port/key, with consul+https:// and etcd+https:// for TLS.
+func ParseKVSource(raw, token string) (*KVSource, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONFIG_KV: %w", err)
+	}
+	kind, scheme, _ := strings.Cut(u.Scheme, "+")
+	if scheme == "" {
+		scheme = "http"
+	}
+	if kind != KVConsul && kind != KVEtcd || scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("invalid CONFIG_KV %q: expected consul:// or etcd://", raw)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid CONFIG_KV %q: expected %s://host:port/key", raw, kind)
+	}
+	return &KVSource{
+		Kind:     kind,
+		Endpoint: scheme + "://" + u.Host,
+		Key:      key,
+		Token:    token,
+		Client:   &http.Client{},
+	}, nil
+}
+
+func (s *KVSource) String() string {
+	return s.Kind + "://" + strings.TrimPrefix(strings.TrimPrefix(s.Endpoint, "http://"), "https://") + "/" + s.Key
+}
+
+// Read returns the values stored under the key. A missing key holds none.
+func (s *KVSource) Read() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kvReadTimeout)
+	defer cancel()
+	data, _, err := s.get(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return parseValues(data, s.String())
+}
+
+// Watch blocks until the key changes after index and returns the index of
+// the change. With index 0 it returns the current index at once. For
+// Consul, Watch may also return index unchanged after a while.
+func (s *KVSource) Watch(ctx context.Context, index uint64) (uint64, error) {
+	if s.Kind == KVEtcd && index != 0 {
+		return s.watchEtcd(ctx, index)
+	}
+	_, index, err := s.get(ctx, index)
+	return index, err
+}
+
+// get returns the value of the key and its index: Consul's modify index or
+// etcd's revision. For Consul, a non-zero index makes it wait for a change.
+func (s *KVSource) get(ctx context.Context, index uint64) ([]byte, uint64, error) {
+	if s.Kind == KVEtcd {
+		return s.getEtcd(ctx)
+	}
+	u := s.Endpoint + "/v1/kv/" + s.Key + "?raw"
+	if index != 0 {
+		u += "&index=" + strconv.FormatUint(index, 10) + "&wait=" + kvWait.String()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if s.Token != "" {
+		req.Header.Set("X-Consul-Token", s.Token)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", s, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", s, err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return nil, 0, fmt.Errorf("failed to read %s: %s", s, resp.Status)
+	}
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if resp.StatusCode == http.StatusNotFound {
+		data = nil
+	}
+	return data, next, nil
+}
+
+// etcdHeader is the response header of etcd's JSON gateway, which encodes
+// 64-bit integers as strings.
+type etcdHeader struct {
+	Revision uint64 `json:"revision,string"`
+}
+
+func (s *KVSource) getEtcd(ctx context.Context) ([]byte, uint64, error) {
+	var resp struct {
+		Header etcdHeader `json:"header"`
+		KVs    []struct {
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+	body, err := s.postEtcd(ctx, "/v3/kv/range", map[string]any{"key": []byte(s.Key)})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", s, err)
+	}
+	var data []byte
+	if len(resp.KVs) > 0 {
+		data = resp.KVs[0].Value
+	}
+	return data, resp.Header.Revision, nil
+}
+
+// watchEtcd streams etcd's watch of the key from after revision until an
+// event arrives.
+func (s *KVSource) watchEtcd(ctx context.Context, revision uint64) (uint64, error) {
+	body, err := s.postEtcd(ctx, "/v3/watch", map[string]any{
+		"create_request": map[string]any{"key": []byte(s.Key), "start_revision": strconv.FormatUint(revision+1, 10)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	dec := json.NewDecoder(body)
+	for {
+		var msg struct {
+			Result struct {
+				Header          etcdHeader        `json:"header"`
+				Events          []json.RawMessage `json:"events"`
+				Canceled        bool              `json:"canceled"`
+				CompactRevision uint64            `json:"compact_revision,string"`
+			} `json:"result"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			return 0, fmt.Errorf("failed to watch %s: %w", s, err)
+		}
+		switch {
+		case len(msg.Result.Events) > 0:
+			return msg.Result.Header.Revision, nil
+		case msg.Result.Canceled, msg.Result.CompactRevision != 0:
+			// The revision was compacted away; read the key afresh.
+			return 0, nil
+		}
+	}
+}
+
+func (s *KVSource) postEtcd(ctx context.Context, path string, request any) (io.ReadCloser, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", s.Token)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read %s: %s", s, resp.Status)
+	}
+	return resp.Body, nil
+}
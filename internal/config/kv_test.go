@@ -0,0 +1,184 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseKVSource(t *testing.T) {
+	tests := []struct {
+		raw      string
+		kind     string
+		endpoint string
+		key      string
+		wantErr  bool
+	}{
+		{"consul://127.0.0.1:8500/dynamicproxy/config", KVConsul, "http://127.0.0.1:8500", "dynamicproxy/config", false},
+		{"etcd+https://etcd.internal:2379/proxy", KVEtcd, "https://etcd.internal:2379", "proxy", false},
+		{"consul://127.0.0.1:8500/", "", "", "", true},
+		{"zookeeper://zk:2181/proxy", "", "", "", true},
+		{"consul+ftp://consul:8500/proxy", "", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseKVSource(tt.raw, "")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseKVSource(%q) = %+v; expected an error", tt.raw, got)
+			}
+			continue
+		}
+		if err != nil || got.Kind != tt.kind || got.Endpoint != tt.endpoint || got.Key != tt.key {
+			t.Errorf("ParseKVSource(%q) = %+v, %v; expected %s at %s key %s", tt.raw, got, err, tt.kind, tt.endpoint, tt.key)
+		}
+	}
+}
+
+// fakeKV is a Consul or etcd server holding one key.
+type fakeKV struct {
+	mu      sync.Mutex
+	value   string
+	index   uint64
+	changed chan struct{}
+}
+
+func newFakeKV(value string) *fakeKV {
+	return &fakeKV{value: value, index: 7, changed: make(chan struct{})}
+}
+
+func (kv *fakeKV) set(value string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.value = value
+	kv.index++
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+func (kv *fakeKV) get() (string, uint64, chan struct{}) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.value, kv.index, kv.changed
+}
+
+func (kv *fakeKV) consul(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/dynamicproxy/config" || r.Header.Get("X-Consul-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		value, index, changed := kv.get()
+		if wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); wait == index {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			value, index, _ = kv.get()
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+		fmt.Fprint(w, value)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (kv *fakeKV) etcd(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, index, changed := kv.get()
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			var req struct{ Key []byte }
+			json.NewDecoder(r.Body).Decode(&req)
+			fmt.Fprintf(w, `{"header":{"revision":"%d"},"kvs":[{"key":%q,"value":%q}]}`,
+				index, base64.StdEncoding.EncodeToString(req.Key), base64.StdEncoding.EncodeToString([]byte(value)))
+		case "/v3/watch":
+			fmt.Fprintf(w, `{"result":{"header":{"revision":"%d"},"created":true}}`+"\n", index)
+			w.(http.Flusher).Flush()
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			_, index, _ = kv.get()
+			fmt.Fprintf(w, `{"result":{"header":{"revision":"%d"},"events":[{"kv":{}}]}}`+"\n", index)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestKVSourceReadAndWatch(t *testing.T) {
+	for _, kind := range []string{KVConsul, KVEtcd} {
+		kv := newFakeKV("PROXY_EXCEPTIONS=a.example\n")
+		srv := kv.consul(t)
+		if kind == KVEtcd {
+			srv = kv.etcd(t)
+		}
+		source, err := ParseKVSource(kind+"://"+strings.TrimPrefix(srv.URL, "http://")+"/dynamicproxy/config", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values, err := source.Read()
+		if err != nil || values["PROXY_EXCEPTIONS"] != "a.example" {
+			t.Fatalf("%s: Read = %v, %v; expected the stored exceptions", kind, values, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		index, err := source.Watch(ctx, 0)
+		if err != nil || index != 7 {
+			t.Fatalf("%s: Watch(0) = %d, %v; expected the current index 7", kind, index, err)
+		}
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			kv.set("PROXY_EXCEPTIONS=b.example\n")
+		}()
+		if index, err = source.Watch(ctx, index); err != nil || index != 8 {
+			t.Fatalf("%s: Watch(7) = %d, %v; expected the change at 8", kind, index, err)
+		}
+		if values, _ := source.Read(); values["PROXY_EXCEPTIONS"] != "b.example" {
+			t.Errorf("%s: Read after change = %v", kind, values)
+		}
+	}
+}
+
+func TestLoadKVOverridesFile(t *testing.T) {
+	kv := newFakeKV("UPSTREAM_PROXY=kv:3128\nPROXY_EXCEPTIONS=*.internal\n")
+	srv := kv.consul(t)
+	path := filepath.Join(t.TempDir(), "config.env")
+	content := "UPSTREAM_PROXY=file:3128\nFAIL_OPEN=true\nCONFIG_KV_TOKEN=secret\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clearEnv(t, "UPSTREAM_PROXY", "PROXY_EXCEPTIONS", "FAIL_OPEN", "CONFIG_KV_TOKEN")
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("CONFIG_KV", "consul://"+strings.TrimPrefix(srv.URL, "http://")+"/dynamicproxy/config")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if cfg.UpstreamProxy != "kv:3128" || len(cfg.ProxyExceptions) != 1 || cfg.ProxyExceptions[0] != "*.internal" || !cfg.FailOpen {
+		t.Fatalf("config = upstream %q, exceptions %v, failOpen %v; expected the key's values over the file's",
+			cfg.UpstreamProxy, cfg.ProxyExceptions, cfg.FailOpen)
+	}
+
+	t.Setenv("CONFIG_KV_TOKEN", "wrong")
+	if _, err := Load(); err == nil {
+		t.Fatal("Load succeeded without access to CONFIG_KV")
+	}
+}
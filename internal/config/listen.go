@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Listener is one entry of LISTEN_ADDR: [tls://]host:port followed by
+// options separated by ';', e.g. "tls://:8443;auth;proxyprotocol;tenant=ci".
+type Listener struct {
+	Addr string
+	// TLS serves the proxy over TLS with LISTEN_TLS_CERT and LISTEN_TLS_KEY.
+	TLS bool
+	// Auth requires clients to authenticate as one of CLIENT_AUTH_USERS.
+	Auth bool
+	// ProxyProtocol expects a PROXY protocol header from a load balancer in
+	// front of every connection.
+	ProxyProtocol bool
+	// Transparent takes connections redirected to the listener by nftables
+	// or iptables (Linux only) and tunnels them to their original
+	// destination, instead of expecting proxy requests.
+	Transparent bool
+	// Tenant names the Tenant whose policy applies to the listener, if any.
+	Tenant string
+}
+
+// ParseListener parses a single LISTEN_ADDR entry.
+func ParseListener(spec string) (Listener, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ";")
+	var l Listener
+	addr := strings.TrimSpace(parts[0])
+	if rest, ok := strings.CutPrefix(addr, "tls://"); ok {
+		l.TLS = true
+		addr = rest
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return Listener{}, fmt.Errorf("invalid listen address %q: %w", spec, err)
+	}
+	l.Addr = addr
+	for _, opt := range parts[1:] {
+		opt = strings.ToLower(strings.TrimSpace(opt))
+		if name, ok := strings.CutPrefix(opt, "tenant="); ok {
+			if !profileName.MatchString(name) {
+				return Listener{}, fmt.Errorf("invalid tenant %q for listen address %q", name, spec)
+			}
+			l.Tenant = name
+			continue
+		}
+		switch opt {
+		case "auth":
+			l.Auth = true
+		case "proxyprotocol":
+			l.ProxyProtocol = true
+		case "transparent":
+			l.Transparent = true
+		case "":
+		default:
+			return Listener{}, fmt.Errorf("unknown option %q for listen address %q", opt, spec)
+		}
+	}
+	if l.Transparent && (l.TLS || l.Auth || l.ProxyProtocol) {
+		return Listener{}, fmt.Errorf("transparent listen address %q cannot use TLS, auth or proxyprotocol", spec)
+	}
+	return l, nil
+}
+
+// Listeners parses the comma-separated list of listeners in ListenAddr,
+// :8080 if there are none.
+func (c Config) Listeners() ([]Listener, error) {
+	var listeners []Listener
+	for _, spec := range strings.Split(c.ListenAddr, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		l, err := ParseListener(spec)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		listeners = []Listener{{Addr: ":8080"}}
+	}
+	return listeners, nil
+}
+
+// ProxyAddr returns the address of the first plain listener, the one to
+// point clients at when there is no better choice, e.g. in the PAC file.
+// Transparent listeners do not take proxy requests and are never chosen
+// while there is another.
+func (c Config) ProxyAddr() string {
+	listeners, err := c.Listeners()
+	if err != nil {
+		return strings.TrimSpace(strings.Split(c.ListenAddr, ",")[0])
+	}
+	for _, l := range listeners {
+		if !l.TLS && !l.Auth && !l.Transparent {
+			return l.Addr
+		}
+	}
+	for _, l := range listeners {
+		if !l.Transparent {
+			return l.Addr
+		}
+	}
+	return listeners[0].Addr
+}
+
+// GetClientUsers parses a comma-separated list of user:password pairs.
+// Entries without a user name are skipped.
+func GetClientUsers(s string) map[string]string {
+	var users map[string]string
+	for _, part := range strings.Split(s, ",") {
+		user, password, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || user == "" {
+			continue
+		}
+		if users == nil {
+			users = make(map[string]string)
+		}
+		users[user] = password
+	}
+	return users
+}
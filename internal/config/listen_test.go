@@ -0,0 +1,87 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseListener(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected Listener
+		wantErr  bool
+	}{
+		{spec: ":8080", expected: Listener{Addr: ":8080"}},
+		{spec: " [::1]:8080 ", expected: Listener{Addr: "[::1]:8080"}},
+		{spec: "tls://:8443", expected: Listener{Addr: ":8443", TLS: true}},
+		{spec: "0.0.0.0:8081;auth", expected: Listener{Addr: "0.0.0.0:8081", Auth: true}},
+		{spec: "tls://:8443; AUTH", expected: Listener{Addr: ":8443", TLS: true, Auth: true}},
+		{spec: ":8080;proxyprotocol", expected: Listener{Addr: ":8080", ProxyProtocol: true}},
+		{spec: "127.0.0.1:3128;auth;tenant=CI", expected: Listener{Addr: "127.0.0.1:3128", Auth: true, Tenant: "ci"}},
+		{spec: ":8080;tenant=a-b", wantErr: true},
+		{spec: "localhost", wantErr: true},
+		{spec: ":8080;sometimes", wantErr: true},
+		{spec: "127.0.0.1:3129;transparent", expected: Listener{Addr: "127.0.0.1:3129", Transparent: true}},
+		{spec: ":3129;transparent;tenant=ci", expected: Listener{Addr: ":3129", Transparent: true, Tenant: "ci"}},
+		{spec: "tls://:3129;transparent", wantErr: true},
+		{spec: ":3129;transparent;auth", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseListener(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseListener(%q) error = %v; wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseListener(%q) = %+v; expected %+v", tt.spec, got, tt.expected)
+		}
+	}
+}
+
+func TestListeners(t *testing.T) {
+	cfg := Config{ListenAddr: "127.0.0.1:8080, [::1]:8080, tls://:8443;auth"}
+	listeners, err := cfg.Listeners()
+	if err != nil {
+		t.Fatalf("Listeners = %v", err)
+	}
+	expected := []Listener{{Addr: "127.0.0.1:8080"}, {Addr: "[::1]:8080"}, {Addr: ":8443", TLS: true, Auth: true}}
+	if !reflect.DeepEqual(listeners, expected) {
+		t.Fatalf("Listeners = %+v; expected %+v", listeners, expected)
+	}
+
+	if listeners, _ := (Config{}).Listeners(); !reflect.DeepEqual(listeners, []Listener{{Addr: ":8080"}}) {
+		t.Fatalf("Listeners of an empty LISTEN_ADDR = %+v; expected :8080", listeners)
+	}
+	if _, err := (Config{ListenAddr: ":8080,bogus"}).Listeners(); err == nil {
+		t.Fatal("Listeners with an invalid entry succeeded")
+	}
+}
+
+func TestProxyAddr(t *testing.T) {
+	tests := []struct {
+		listen   string
+		expected string
+	}{
+		{":8080", ":8080"},
+		{"tls://:8443;auth, 127.0.0.1:8080", "127.0.0.1:8080"},
+		{"tls://:8443", ":8443"},
+		{":3129;transparent, tls://:8443;auth", ":8443"},
+		{":3129;transparent, 127.0.0.1:8080", "127.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		if got := (Config{ListenAddr: tt.listen}).ProxyAddr(); got != tt.expected {
+			t.Errorf("ProxyAddr(%q) = %q; expected %q", tt.listen, got, tt.expected)
+		}
+	}
+}
+
+func TestGetClientUsers(t *testing.T) {
+	got := GetClientUsers("alice:s3cret, bob:pa:ss, :nouser, broken")
+	expected := map[string]string{"alice": "s3cret", "bob": "pa:ss"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("GetClientUsers = %v; expected %v", got, expected)
+	}
+	if got := GetClientUsers(""); got != nil {
+		t.Fatalf("GetClientUsers(\"\") = %v; expected nil", got)
+	}
+}
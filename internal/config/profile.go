@@ -0,0 +1,245 @@
+package config
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conditions a network profile can be selected by.
+const (
+	// ProfileDNSSuffix holds if a DNS search domain is or ends in the value.
+	ProfileDNSSuffix = "dns-suffix"
+	// ProfileGatewayMAC holds if the default gateway has the MAC address.
+	ProfileGatewayMAC = "gateway-mac"
+	// ProfileReachable holds if a TCP connection to host:port succeeds.
+	ProfileReachable = "reachable"
+)
+
+// profileProbeTimeout bounds each reachable: probe.
+const profileProbeTimeout = 2 * time.Second
+
+// Paths and probes used to detect the network, replaced in tests.
+var (
+	procRoutePath = "/proc/net/route"
+	procARPPath   = "/proc/net/arp"
+	probeDial     = func(addr string) error {
+		conn, err := net.DialTimeout("tcp", addr, profileProbeTimeout)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+)
+
+// Profile is a named set of settings selected by the network the proxy
+// finds itself in, e.g. an upstream with NTLM in the office and direct
+// connections at home. Its settings are PROFILE_<NAME>_<KEY> variables.
+type Profile struct {
+	Name       string
+	Conditions []ProfileCondition
+}
+
+// ProfileCondition is one condition of a profile, all of which must hold.
+type ProfileCondition struct {
+	Kind  string
+	Value string
+}
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// GetProfiles parses PROFILES: comma-separated name=conditions entries, the
+// conditions separated by ';' and written kind:value. A profile without
+// conditions always matches, as a fallback after the others. Invalid
+// entries are skipped.
+func GetProfiles(s string) []Profile {
+	var profiles []Profile
+	for _, part := range strings.Split(s, ",") {
+		name, conditions, _ := strings.Cut(part, "=")
+		profile := Profile{Name: strings.ToLower(strings.TrimSpace(name))}
+		if !profileName.MatchString(profile.Name) {
+			continue
+		}
+		valid := true
+		for _, condition := range strings.Split(conditions, ";") {
+			if condition = strings.TrimSpace(condition); condition == "" {
+				continue
+			}
+			kind, value, _ := strings.Cut(condition, ":")
+			c := ProfileCondition{Kind: strings.ToLower(strings.TrimSpace(kind)), Value: strings.TrimSpace(value)}
+			switch c.Kind {
+			case ProfileDNSSuffix:
+				c.Value = strings.ToLower(strings.Trim(c.Value, "."))
+			case ProfileGatewayMAC:
+				mac, err := net.ParseMAC(c.Value)
+				if err != nil {
+					valid = false
+				}
+				c.Value = mac.String()
+			case ProfileReachable:
+				if _, _, err := net.SplitHostPort(c.Value); err != nil {
+					valid = false
+				}
+			default:
+				valid = false
+			}
+			profile.Conditions = append(profile.Conditions, c)
+		}
+		if valid {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// profileLookup returns lookup with the settings of profile, if any,
+// taking precedence.
+func profileLookup(lookup lookupFunc, profile string) lookupFunc {
+	if profile == "" {
+		return lookup
+	}
+	prefix := "PROFILE_" + strings.ToUpper(profile) + "_"
+	return func(key string) (string, bool) {
+		if val, ok := lookup(prefix + key); ok {
+			return val, true
+		}
+		return lookup(key)
+	}
+}
+
+// detectProfile returns the name of the first of profiles whose conditions
+// all hold in the current network, or "" if none does.
+func detectProfile(profiles []Profile) string {
+	var once sync.Once
+	var domains []string
+	var gatewayMAC string
+	network := func() {
+		domains = searchDomains()
+		gatewayMAC = defaultGatewayMAC()
+	}
+	for _, p := range profiles {
+		matched := true
+		for _, c := range p.Conditions {
+			switch c.Kind {
+			case ProfileDNSSuffix:
+				once.Do(network)
+				matched = slices.ContainsFunc(domains, func(d string) bool {
+					return d == c.Value || strings.HasSuffix(d, "."+c.Value)
+				})
+			case ProfileGatewayMAC:
+				once.Do(network)
+				matched = gatewayMAC != "" && gatewayMAC == c.Value
+			case ProfileReachable:
+				matched = probeDial(c.Value) == nil
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// NetworkFingerprint summarizes the addresses, DNS search domains and
+// default gateway of the host, so that a change of network can be noticed
+// by polling it.
+func NetworkFingerprint() string {
+	var parts []string
+	if addrs, err := interfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			parts = append(parts, addr.String())
+		}
+	}
+	slices.Sort(parts)
+	parts = append(parts, searchDomains()...)
+	if gateway := defaultGateway(); gateway != nil {
+		parts = append(parts, "gw="+gateway.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// searchDomains returns the DNS search domains from resolv.conf, lower case
+// without the trailing dot.
+func searchDomains() []string {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "search" && fields[0] != "domain" {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			domains = append(domains, strings.ToLower(strings.TrimSuffix(domain, ".")))
+		}
+	}
+	return domains
+}
+
+// defaultGateway returns the IPv4 default gateway from the Linux routing
+// table, or nil if there is none or the table cannot be read.
+func defaultGateway() net.IP {
+	f, err := os.Open(procRoutePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags ..., addresses in little-endian hex.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		if !ip.IsUnspecified() {
+			return ip
+		}
+	}
+	return nil
+}
+
+// defaultGatewayMAC returns the MAC address of the default gateway from the
+// Linux ARP cache, or "" if it is unknown.
+func defaultGatewayMAC() string {
+	gateway := defaultGateway()
+	if gateway == nil {
+		return ""
+	}
+	f, err := os.Open(procARPPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !gateway.Equal(net.ParseIP(fields[0])) {
+			continue
+		}
+		if mac, err := net.ParseMAC(fields[3]); err == nil {
+			return mac.String()
+		}
+	}
+	return ""
+}
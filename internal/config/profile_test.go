@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetProfiles(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Profile
+	}{
+		{
+			"office=dns-suffix:Corp.Example.;reachable:proxy.corp.example:8080, customer=gateway-mac:00-11-22-AA-BB-CC, home=",
+			[]Profile{
+				{Name: "office", Conditions: []ProfileCondition{{ProfileDNSSuffix, "corp.example"}, {ProfileReachable, "proxy.corp.example:8080"}}},
+				{Name: "customer", Conditions: []ProfileCondition{{ProfileGatewayMAC, "00:11:22:aa:bb:cc"}}},
+				{Name: "home"},
+			},
+		},
+		{"bad-name=dns-suffix:corp.example", nil},
+		{"office=ssid:corp", nil},
+		{"office=gateway-mac:nope,lab=reachable:no-port", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := GetProfiles(tt.input); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("GetProfiles(%q) = %+v; expected %+v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func stubNetwork(t *testing.T, resolvConf, route, arp string, reachable ...string) {
+	t.Helper()
+	stubCluster(t, resolvConf, "192.168.1.20/24")
+	dir := t.TempDir()
+	oldRoute, oldARP, oldDial := procRoutePath, procARPPath, probeDial
+	t.Cleanup(func() { procRoutePath, procARPPath, probeDial = oldRoute, oldARP, oldDial })
+	procRoutePath, procARPPath = filepath.Join(dir, "route"), filepath.Join(dir, "arp")
+	for path, content := range map[string]string{procRoutePath: route, procARPPath: arp} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	probeDial = func(addr string) error {
+		for _, r := range reachable {
+			if r == addr {
+				return nil
+			}
+		}
+		return errors.New("unreachable")
+	}
+}
+
+const (
+	testRoute = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\n" +
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\n" +
+		"eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\n"
+	testARP = "IP address       HW type     Flags       HW address            Mask     Device\n" +
+		"192.168.1.1      0x1         0x2         00:11:22:aa:bb:cc     *        eth0\n"
+)
+
+func TestDetectProfile(t *testing.T) {
+	profiles := GetProfiles("office=dns-suffix:corp.example;reachable:proxy.corp.example:8080,customer=gateway-mac:00:11:22:aa:bb:cc,home=")
+	tests := []struct {
+		name       string
+		resolvConf string
+		reachable  []string
+		expected   string
+	}{
+		{"office", "search eu.corp.example\n", []string{"proxy.corp.example:8080"}, "office"},
+		{"office suffix, proxy down", "search eu.corp.example\n", nil, "customer"},
+		{"customer gateway", "search home.arpa\n", nil, "customer"},
+	}
+	for _, tt := range tests {
+		stubNetwork(t, tt.resolvConf, testRoute, testARP, tt.reachable...)
+		if got := detectProfile(profiles); got != tt.expected {
+			t.Errorf("%s: detectProfile = %q; expected %q", tt.name, got, tt.expected)
+		}
+	}
+
+	stubNetwork(t, "search home.arpa\n", "", "")
+	if got := detectProfile(profiles); got != "home" {
+		t.Errorf("detectProfile without a known gateway = %q; expected the fallback home", got)
+	}
+	if got := detectProfile(profiles[:2]); got != "" {
+		t.Errorf("detectProfile without a fallback = %q; expected none", got)
+	}
+}
+
+func TestNetworkFingerprint(t *testing.T) {
+	stubNetwork(t, "search corp.example\n", testRoute, testARP)
+	office := NetworkFingerprint()
+	stubNetwork(t, "search home.arpa\n", testRoute, testARP)
+	if home := NetworkFingerprint(); home == office {
+		t.Errorf("fingerprint %q unchanged after the search domains changed", home)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	stubNetwork(t, "search corp.example\n", testRoute, testARP)
+	clearEnv(t, "CONFIG_FILE", "CONFIG_KV", "CONFIG_URL", "FAIL_OPEN")
+	t.Setenv("PROFILES", "office=dns-suffix:corp.example,home=")
+	t.Setenv("UPSTREAM_PROXY", "")
+	t.Setenv("PROFILE_OFFICE_UPSTREAM_PROXY", "proxy.corp.example:8080")
+	t.Setenv("PROFILE_OFFICE_PROXY_AUTH", "ntlm")
+	t.Setenv("PROFILE_HOME_DIRECT_ONLY", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if cfg.Profile != "office" || cfg.UpstreamProxy != "proxy.corp.example:8080" || cfg.ProxyAuth != "ntlm" || cfg.DirectOnly {
+		t.Fatalf("config = profile %q, upstream %q, auth %q, direct %v; expected the office profile",
+			cfg.Profile, cfg.UpstreamProxy, cfg.ProxyAuth, cfg.DirectOnly)
+	}
+
+	stubNetwork(t, "search home.arpa\n", testRoute, testARP)
+	if cfg, _ = Load(); cfg.Profile != "home" || cfg.UpstreamProxy != "" || !cfg.DirectOnly {
+		t.Fatalf("config = profile %q, upstream %q, direct %v; expected the home profile", cfg.Profile, cfg.UpstreamProxy, cfg.DirectOnly)
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/cavoq/DynamicProxy/internal/sysproxy"
+)
+
+// applySystemProxy fills in the upstream and exceptions from the operating
+// system's proxy settings if SYSTEM_PROXY is set. An explicit UPSTREAM_PROXY
+// takes precedence; the system bypass list is added to PROXY_EXCEPTIONS.
+func applySystemProxy(cfg *Config) error {
+	if !cfg.SystemProxy {
+		return nil
+	}
+	settings, err := sysproxy.Read()
+	if err != nil {
+		return fmt.Errorf("SYSTEM_PROXY: %w", err)
+	}
+	if cfg.UpstreamProxy == "" {
+		cfg.UpstreamProxy = settings.Proxy
+	}
+	for _, pattern := range settings.Bypass {
+		// Skip patterns already present, e.g. persisted by the admin API.
+		if !slices.Contains(cfg.ProxyExceptions, pattern) {
+			cfg.ProxyExceptions = append(cfg.ProxyExceptions, pattern)
+		}
+	}
+	return nil
+}
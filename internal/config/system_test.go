@@ -0,0 +1,27 @@
+//go:build !windows
+
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/sysproxy"
+)
+
+func TestApplySystemProxyUnsupported(t *testing.T) {
+	// Hide any desktop proxy settings of the machine running the tests.
+	t.Setenv("PATH", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CURRENT_DESKTOP", "")
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	cfg := DefaultConfig()
+	if err := applySystemProxy(&cfg); err != nil {
+		t.Fatalf("applySystemProxy without SYSTEM_PROXY = %v; expected nil", err)
+	}
+	cfg.SystemProxy = true
+	if err := applySystemProxy(&cfg); !errors.Is(err, sysproxy.ErrNotSupported) {
+		t.Fatalf("applySystemProxy = %v; expected ErrNotSupported", err)
+	}
+}
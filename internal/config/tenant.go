@@ -0,0 +1,88 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// TenantKeys are the settings a tenant can set for its listeners. All other
+// settings are shared by every listener.
+var TenantKeys = []string{
+	"UPSTREAM_PROXY",
+	"PROXY_AUTH",
+	"PROXY_EXCEPTIONS",
+	"DIRECT_ONLY",
+	"FAIL_OPEN",
+	"CLIENT_AUTH_USERS",
+	"FLOW_LOG",
+}
+
+// Tenant is the policy of the listeners with the tenant=<name> option, so
+// that one process can serve e.g. a locked-down port for CI next to a
+// permissive one on localhost. Its settings are TENANT_<NAME>_<KEY>
+// variables for the TenantKeys; keys it does not set fall back to the
+// global value.
+type Tenant struct {
+	Name     string
+	Settings map[string]string
+}
+
+// loadTenants reads the settings of every tenant named by a listener in
+// LISTEN_ADDR.
+func loadTenants(lookup lookupFunc) []Tenant {
+	listeners, _ := Config{ListenAddr: lookup.str("LISTEN_ADDR", "")}.Listeners()
+	var tenants []Tenant
+	for _, l := range listeners {
+		if l.Tenant == "" || tenantIndex(tenants, l.Tenant) >= 0 {
+			continue
+		}
+		tenant := Tenant{Name: l.Tenant, Settings: map[string]string{}}
+		prefix := "TENANT_" + strings.ToUpper(l.Tenant) + "_"
+		for _, key := range TenantKeys {
+			if val, ok := lookup(prefix + key); ok {
+				if slices.Contains(expandedKeys, key) {
+					val = lookup.expand(val)
+				}
+				tenant.Settings[key] = val
+			}
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants
+}
+
+func tenantIndex(tenants []Tenant, name string) int {
+	for i, t := range tenants {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ForTenant returns the configuration of the listeners of tenant name: c
+// with the tenant's settings taking precedence. It returns c unchanged for
+// unknown tenants.
+func (c Config) ForTenant(name string) Config {
+	i := tenantIndex(c.Tenants, name)
+	if i < 0 {
+		return c
+	}
+	lookup := lookupFunc(func(key string) (string, bool) {
+		val, ok := c.Tenants[i].Settings[key]
+		return val, ok
+	})
+	c.UpstreamProxy = lookup.str("UPSTREAM_PROXY", c.UpstreamProxy)
+	c.ProxyAuth = lookup.str("PROXY_AUTH", c.ProxyAuth)
+	if exceptions, ok := lookup("PROXY_EXCEPTIONS"); ok {
+		c.ProxyExceptions = GetExceptions(exceptions)
+	}
+	c.DirectOnly = lookup.bool("DIRECT_ONLY", c.DirectOnly)
+	c.FailOpen = lookup.bool("FAIL_OPEN", c.FailOpen)
+	if users, ok := lookup("CLIENT_AUTH_USERS"); ok {
+		c.ClientUsers = GetClientUsers(users)
+	}
+	c.FlowLog = lookup.str("FLOW_LOG", c.FlowLog)
+	c.Tenants = nil
+	return c
+}
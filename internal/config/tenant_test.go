@@ -0,0 +1,54 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTenants(t *testing.T) {
+	env := map[string]string{
+		"LISTEN_ADDR":                 ":8080, 127.0.0.1:3128;auth;tenant=ci, [::1]:3128;tenant=ci",
+		"UPSTREAM_PROXY":              "proxy-a:3128",
+		"PROXY_EXCEPTIONS":            "localhost,*.internal",
+		"CLIENT_AUTH_USERS":           "alice:s3cret",
+		"FLOW_LOG":                    "/var/log/flows.log",
+		"TENANT_CI_UPSTREAM_PROXY":    "proxy-ci:3128",
+		"TENANT_CI_PROXY_EXCEPTIONS":  "",
+		"TENANT_CI_CLIENT_AUTH_USERS": "runner:token",
+		"TENANT_CI_FLOW_LOG":          "-",
+		"TENANT_OTHER_UPSTREAM_PROXY": "proxy-other:3128",
+		"TENANT_CI_LISTEN_TLS_CERT":   "ignored.pem",
+	}
+	cfg := load(func(key string) (string, bool) {
+		val, ok := env[key]
+		return val, ok
+	})
+
+	expected := []Tenant{{Name: "ci", Settings: map[string]string{
+		"UPSTREAM_PROXY":    "proxy-ci:3128",
+		"PROXY_EXCEPTIONS":  "",
+		"CLIENT_AUTH_USERS": "runner:token",
+		"FLOW_LOG":          "-",
+	}}}
+	if !reflect.DeepEqual(cfg.Tenants, expected) {
+		t.Fatalf("Tenants = %+v; expected %+v", cfg.Tenants, expected)
+	}
+
+	ci := cfg.ForTenant("ci")
+	if ci.UpstreamProxy != "proxy-ci:3128" || len(ci.ProxyExceptions) != 0 || ci.FlowLog != "-" || ci.Tenants != nil {
+		t.Errorf("ForTenant(ci) = upstream %q, exceptions %v, flow log %q, tenants %v; expected the tenant's settings",
+			ci.UpstreamProxy, ci.ProxyExceptions, ci.FlowLog, ci.Tenants)
+	}
+	if !reflect.DeepEqual(ci.ClientUsers, map[string]string{"runner": "token"}) {
+		t.Errorf("ForTenant(ci).ClientUsers = %v; expected only the tenant's users", ci.ClientUsers)
+	}
+	if ci.ListenTLSCert != "" || ci.ProxyAuth != cfg.ProxyAuth {
+		t.Errorf("ForTenant(ci) changed settings tenants cannot set")
+	}
+	if cfg.UpstreamProxy != "proxy-a:3128" || len(cfg.ProxyExceptions) != 2 {
+		t.Errorf("ForTenant changed the global config: upstream %q, exceptions %v", cfg.UpstreamProxy, cfg.ProxyExceptions)
+	}
+	if other := cfg.ForTenant("other"); !reflect.DeepEqual(other, cfg) {
+		t.Errorf("ForTenant of a tenant without listeners = %+v; expected the global config", other)
+	}
+}
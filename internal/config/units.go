@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ParseDuration parses a duration like time.ParseDuration, e.g. "30s" or
+// "1h30m", and additionally accepts days, e.g. "7d" or "1d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var days time.Duration
+	if i := strings.IndexByte(s, 'd'); i >= 0 {
+		n, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		days = time.Duration(n * float64(24*time.Hour))
+		if s = s[i+1:]; s == "" {
+			return days, nil
+		}
+		if days < 0 {
+			s = "-" + s
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
+}
+
+// Units of ParseSize: KB, MB, GB and TB are powers of 1000, KiB, MiB, GiB
+// and TiB powers of 1024.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a number of bytes with an optional unit, e.g. "4096",
+// "100MB" or "1.5 GiB".
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsSpace(r) })
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if err != nil || !ok || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which is out of range.
+	if n *= unit; n >= math.MaxInt64 || n < math.MinInt64 {
+		return 0, fmt.Errorf("size %q out of range", s)
+	}
+	return int64(n), nil
+}
+
+// errNegative is reported for settings given a negative value, which none
+// of them takes.
+var errNegative = errors.New("must not be negative")
+
+// checkedLookup is the lookup of load: it collects an error for every
+// setting whose value cannot be parsed, where the lookupFunc helpers fall
+// back to the default.
+type checkedLookup struct {
+	lookupFunc
+	errs []error
+}
+
+func (l *checkedLookup) invalid(key string, err error) {
+	l.errs = append(l.errs, fmt.Errorf("invalid %s: %w", key, err))
+}
+
+func (l *checkedLookup) value(key string) (string, bool) {
+	val, ok := l.lookupFunc(key)
+	val = strings.TrimSpace(val)
+	return val, ok && val != ""
+}
+
+func (l *checkedLookup) duration(key string, defaultVal time.Duration) time.Duration {
+	if val, ok := l.value(key); ok {
+		if d, err := ParseDuration(val); err != nil {
+			l.invalid(key, err)
+		} else if d < 0 {
+			l.invalid(key, errNegative)
+		}
+	}
+	return l.lookupFunc.duration(key, defaultVal)
+}
+
+func (l *checkedLookup) durationOrOff(key string, defaultVal time.Duration) time.Duration {
+	if val, ok := l.value(key); ok {
+		if _, err := ParseDuration(val); err != nil {
+			l.invalid(key, err)
+		}
+	}
+	return l.lookupFunc.durationOrOff(key, defaultVal)
+}
+
+func (l *checkedLookup) int(key string, defaultVal int) int {
+	if val, ok := l.value(key); ok {
+		if n, err := strconv.Atoi(val); err != nil {
+			l.invalid(key, err)
+		} else if n < 0 {
+			l.invalid(key, errNegative)
+		}
+	}
+	return l.lookupFunc.int(key, defaultVal)
+}
+
+func (l *checkedLookup) intOrOff(key string, defaultVal int) int {
+	if val, ok := l.value(key); ok {
+		if n, err := strconv.Atoi(val); err != nil {
+			l.invalid(key, err)
+		} else if n < 0 {
+			l.invalid(key, errNegative)
+		}
+	}
+	return l.lookupFunc.intOrOff(key, defaultVal)
+}
+
+func (l *checkedLookup) size(key string, defaultVal int64) int64 {
+	l.checkSize(key, math.MaxInt64)
+	return l.lookupFunc.size(key, defaultVal)
+}
+
+func (l *checkedLookup) bufferSize(key string, defaultVal int) int {
+	l.checkSize(key, math.MaxInt)
+	return l.lookupFunc.bufferSize(key, defaultVal)
+}
+
+func (l *checkedLookup) checkSize(key string, max int64) {
+	if val, ok := l.value(key); ok {
+		if n, err := ParseSize(val); err != nil {
+			l.invalid(key, err)
+		} else if n < 0 {
+			l.invalid(key, errNegative)
+		} else if n > max {
+			l.invalid(key, fmt.Errorf("size %q out of range", val))
+		}
+	}
+}
+
+// size is int64 for numbers of bytes, which may carry a unit.
+func (lookup lookupFunc) size(key string, defaultVal int64) int64 {
+	val, ok := lookup(key)
+	if !ok || strings.TrimSpace(val) == "" {
+		return defaultVal
+	}
+	parsed, err := ParseSize(val)
+	if err != nil || parsed <= 0 {
+		return defaultVal
+	}
+	return parsed
+}
+
+// bufferSize is size for the sizes of buffers held in memory, which must
+// fit an int.
+func (lookup lookupFunc) bufferSize(key string, defaultVal int) int {
+	parsed := lookup.size(key, int64(defaultVal))
+	if parsed > math.MaxInt {
+		return defaultVal
+	}
+	return int(parsed)
+}
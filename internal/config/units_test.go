@@ -0,0 +1,128 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{in: "30s", expected: 30 * time.Second},
+		{in: " 5m ", expected: 5 * time.Minute},
+		{in: "1h30m", expected: 90 * time.Minute},
+		{in: "7d", expected: 7 * 24 * time.Hour},
+		{in: "1d12h", expected: 36 * time.Hour},
+		{in: "0.5d", expected: 12 * time.Hour},
+		{in: "-1d2h", expected: -26 * time.Hour},
+		{in: "30", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "1d2", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("ParseDuration(%q) = %v, %v; expected %v, error %v", tt.in, got, err, tt.expected, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected int64
+		wantErr  bool
+	}{
+		{in: "4096", expected: 4096},
+		{in: "100B", expected: 100},
+		{in: "64k", expected: 64000},
+		{in: "100MB", expected: 100_000_000},
+		{in: "100mb", expected: 100_000_000},
+		{in: "1.5 GiB", expected: 3 << 29},
+		{in: "64KiB", expected: 64 << 10},
+		{in: "2TB", expected: 2_000_000_000_000},
+		{in: "", wantErr: true},
+		{in: "MB", wantErr: true},
+		{in: "10 parsecs", wantErr: true},
+		{in: "1e30TB", wantErr: true},
+		{in: "8EiB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, %v; expected %d, error %v", tt.in, got, err, tt.expected, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadReportsInvalidValues(t *testing.T) {
+	env := map[string]string{
+		"SERVER_READ_TIMEOUT": "1d",
+		"MEMORY_LIMIT":        "512MiB",
+		"MIRROR_BODY_LIMIT":   "1MB",
+		"RETRY_MAX":           "3",
+		"CLIENT_QUOTA_DAILY":  "",
+	}
+	lookup := func(key string) (string, bool) {
+		val, ok := env[key]
+		return val, ok
+	}
+	cfg, err := loadChecked(lookup)
+	if err != nil {
+		t.Fatalf("loadChecked = %v", err)
+	}
+	if cfg.ServerReadTimeout != 24*time.Hour || cfg.MemoryLimit != 512<<20 || cfg.MirrorBodyLimit != 1_000_000 || cfg.RetryMax != 3 {
+		t.Errorf("config = read timeout %v, memory limit %d, mirror body limit %d, retries %d; expected the given values",
+			cfg.ServerReadTimeout, cfg.MemoryLimit, cfg.MirrorBodyLimit, cfg.RetryMax)
+	}
+
+	env["SERVER_READ_TIMEOUT"] = "30"
+	env["MEMORY_LIMIT"] = "lots"
+	env["RETRY_MAX"] = "three"
+	cfg, err = loadChecked(lookup)
+	if err == nil {
+		t.Fatal("loadChecked with invalid values succeeded")
+	}
+	for _, key := range []string{"SERVER_READ_TIMEOUT", "MEMORY_LIMIT", "RETRY_MAX"} {
+		if !strings.Contains(err.Error(), "invalid "+key) {
+			t.Errorf("loadChecked error %q does not name %s", err, key)
+		}
+	}
+	if defaults := DefaultConfig(); cfg.ServerReadTimeout != defaults.ServerReadTimeout || cfg.MemoryLimit != 0 {
+		t.Errorf("invalid values were not replaced by their defaults")
+	}
+}
+
+func TestLoadReportsNegativeValues(t *testing.T) {
+	for key, val := range map[string]string{
+		"SERVER_READ_TIMEOUT":   "-30s",
+		"CLIENT_QUOTA_MONTHLY":  "-1GB",
+		"TUNNEL_BUFFER_SIZE":    "-4KiB",
+		"RETRY_MAX":             "-1",
+		"WEBHOOK_AUTH_FAILURES": "-5",
+	} {
+		_, err := loadChecked(func(k string) (string, bool) { return val, k == key })
+		if err == nil || !strings.Contains(err.Error(), "invalid "+key) {
+			t.Errorf("loadChecked with %s=%s = %v; expected it reported as invalid", key, val, err)
+		}
+	}
+}
+
+func TestLoadLargeSizes(t *testing.T) {
+	env := map[string]string{"CLIENT_QUOTA_MONTHLY": "2TB", "MEMORY_LIMIT": "4GiB"}
+	cfg, err := loadChecked(func(key string) (string, bool) {
+		val, ok := env[key]
+		return val, ok
+	})
+	if err != nil {
+		t.Fatalf("loadChecked = %v", err)
+	}
+	if cfg.ClientQuotaMonthly != 2_000_000_000_000 || cfg.MemoryLimit != 4<<30 {
+		t.Errorf("monthly quota %d, memory limit %d; expected 2TB and 4GiB", cfg.ClientQuotaMonthly, cfg.MemoryLimit)
+	}
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrConfigURLUnreachable is returned by Load along with a usable config
+// when CONFIG_URL could not be fetched. The config then holds the values
+// last fetched from it, if any.
+var ErrConfigURLUnreachable = errors.New("CONFIG_URL unreachable")
+
+const (
+	// urlFetchTimeout bounds fetching CONFIG_URL and its signature.
+	urlFetchTimeout = 30 * time.Second
+	// maxConfigURLSize bounds the config and signature fetched.
+	maxConfigURLSize = 1 << 20
+)
+
+// URLSource is an HTTPS URL serving KEY=VALUE lines like CONFIG_FILE, so
+// that roaming laptops pick up fresh bypass lists wherever they are. With a
+// public key, the config must come with an Ed25519 signature of it, base64
+// encoded at the same URL with .sig appended to the path.
+type URLSource struct {
+	URL       string
+	PublicKey ed25519.PublicKey
+	Client    *http.Client
+
+	mu     sync.Mutex
+	etag   string
+	data   []byte
+	values map[string]string
+}
+
+var (
+	urlSourcesMu sync.Mutex
+	urlSources   = map[string]*URLSource{}
+)
+
+// URLSourceFor returns the source for a CONFIG_URL and
+// CONFIG_URL_PUBLIC_KEY. Sources are shared, so that what Load fetched
+// before is only fetched again if it changed.
+func URLSourceFor(rawURL, publicKey string) (*URLSource, error) {
+	rawURL, publicKey = strings.TrimSpace(rawURL), strings.TrimSpace(publicKey)
+	urlSourcesMu.Lock()
+	defer urlSourcesMu.Unlock()
+	if s, ok := urlSources[rawURL+" "+publicKey]; ok {
+		return s, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("invalid CONFIG_URL %q: expected an https:// URL", rawURL)
+	}
+	s := &URLSource{URL: rawURL, Client: &http.Client{Timeout: urlFetchTimeout}}
+	if publicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid CONFIG_URL_PUBLIC_KEY: expected a base64 Ed25519 public key")
+		}
+		s.PublicKey = key
+	}
+	if u.Scheme == "http" && s.PublicKey == nil {
+		return nil, fmt.Errorf("invalid CONFIG_URL %q: plain http requires CONFIG_URL_PUBLIC_KEY", rawURL)
+	}
+	urlSources[rawURL+" "+publicKey] = s
+	return s, nil
+}
+
+// String returns the URL without credentials or query.
+func (s *URLSource) String() string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return "CONFIG_URL"
+	}
+	u.User, u.RawQuery = nil, ""
+	return u.String()
+}
+
+// Fetch returns the values served at the URL and whether they changed since
+// the last fetch, sending the last ETag so that an unchanged config is not
+// downloaded again. If the URL cannot be reached, Fetch returns the values
+// last fetched and an error wrapping ErrConfigURLUnreachable.
+func (s *URLSource) Fetch(ctx context.Context) (map[string]string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return s.values, false, err
+	}
+	if s.etag != "" && s.values != nil {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return s.values, false, fmt.Errorf("%w: %w", ErrConfigURLUnreachable, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return s.values, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return s.values, false, fmt.Errorf("%w: %s answered %s", ErrConfigURLUnreachable, s, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigURLSize))
+	if err != nil {
+		return s.values, false, fmt.Errorf("%w: %w", ErrConfigURLUnreachable, err)
+	}
+	if err := s.verify(ctx, data); err != nil {
+		return s.values, false, err
+	}
+	values, err := parseValues(data, s.String())
+	if err != nil {
+		return s.values, false, err
+	}
+	changed := s.values == nil || !bytes.Equal(data, s.data)
+	s.etag, s.data, s.values = resp.Header.Get("ETag"), data, values
+	return values, changed, nil
+}
+
+// verify checks the signature of data if a public key is set.
+func (s *URLSource) verify(ctx context.Context, data []byte) error {
+	if s.PublicKey == nil {
+		return nil
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+	u.Path += ".sig"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigURLUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch the signature of %s: %s", s, resp.Status)
+	}
+	encoded, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigURLSize))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigURLUnreachable, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || !ed25519.Verify(s.PublicKey, data, sig) {
+		return fmt.Errorf("config from %s does not match its signature", s)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestURLSourceFor(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(nil)
+	key := base64.StdEncoding.EncodeToString(publicKey)
+	tests := []struct {
+		url     string
+		key     string
+		wantErr bool
+	}{
+		{"https://config.example/proxy.env", "", false},
+		{"http://config.example/proxy.env", key, false},
+		{"http://config.example/proxy.env", "", true},
+		{"https://config.example/proxy.env", "bm90IGEga2V5", true},
+		{"ftp://config.example/proxy.env", "", true},
+		{"config.example/proxy.env", "", true},
+	}
+	for _, tt := range tests {
+		_, err := URLSourceFor(tt.url, tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("URLSourceFor(%q, %q) error = %v; expected error %v", tt.url, tt.key, err, tt.wantErr)
+		}
+	}
+}
+
+func TestURLSourceFetch(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	content := "PROXY_EXCEPTIONS=a.example\n"
+	signature := ""
+	var downloads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/proxy.env":
+			etag := `"` + base64.RawURLEncoding.EncodeToString([]byte(content)) + `"`
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads++
+			w.Header().Set("ETag", etag)
+			w.Write([]byte(content))
+		case "/proxy.env.sig":
+			w.Write([]byte(signature))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	sign := func() {
+		signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(content)))
+	}
+	sign()
+
+	source, err := URLSourceFor(srv.URL+"/proxy.env", base64.StdEncoding.EncodeToString(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	steps := []struct {
+		name    string
+		update  func()
+		want    string
+		changed bool
+		err     bool
+	}{
+		{"first fetch", func() {}, "a.example", true, false},
+		{"unchanged", func() {}, "a.example", false, false},
+		{"changed", func() { content = "PROXY_EXCEPTIONS=b.example\n"; sign() }, "b.example", true, false},
+		{"tampered", func() { content = "PROXY_EXCEPTIONS=evil.example\n" }, "b.example", false, true},
+	}
+	for _, s := range steps {
+		s.update()
+		values, changed, err := source.Fetch(ctx)
+		if values["PROXY_EXCEPTIONS"] != s.want || changed != s.changed || (err != nil) != s.err {
+			t.Errorf("%s: Fetch = %v, %v, %v; expected %s, changed %v, error %v", s.name, values, changed, err, s.want, s.changed, s.err)
+		}
+	}
+	if downloads != 3 {
+		t.Errorf("config downloaded %d times; expected 3 with one 304", downloads)
+	}
+
+	srv.Close()
+	values, _, err := source.Fetch(ctx)
+	if !errors.Is(err, ErrConfigURLUnreachable) || values["PROXY_EXCEPTIONS"] != "b.example" {
+		t.Errorf("Fetch from a closed server = %v, %v; expected the last values and ErrConfigURLUnreachable", values, err)
+	}
+}
+
+func TestLoadConfigURL(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("UPSTREAM_PROXY=url:3128\n"))
+	}))
+	defer srv.Close()
+	clearEnv(t, "UPSTREAM_PROXY", "CONFIG_FILE", "CONFIG_KV", "CONFIG_URL_PUBLIC_KEY")
+	t.Setenv("CONFIG_URL", srv.URL+"/proxy.env")
+	source, err := URLSourceFor(srv.URL+"/proxy.env", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Client = srv.Client()
+
+	cfg, err := Load()
+	if err != nil || cfg.UpstreamProxy != "url:3128" {
+		t.Fatalf("Load = upstream %q, %v; expected the URL's upstream", cfg.UpstreamProxy, err)
+	}
+
+	t.Setenv("CONFIG_URL", "https://"+strings.TrimPrefix(srv.URL, "https://")+"/unreachable.env")
+	srv.Close()
+	cfg, err = Load()
+	if !errors.Is(err, ErrConfigURLUnreachable) || cfg.UpstreamProxy != "" {
+		t.Fatalf("Load with CONFIG_URL unreachable = upstream %q, %v; expected the config without it and ErrConfigURLUnreachable", cfg.UpstreamProxy, err)
+	}
+}
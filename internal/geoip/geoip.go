@@ -0,0 +1,363 @@
+// Package geoip reads MaxMind DB files (the format of GeoLite2 and GeoIP2
+// databases) to find the country and autonomous system of an IP address.
+// Only the fields the proxy uses are decoded.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataStart marks the metadata section at the end of a database.
+var metadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// maxDepth bounds the nesting of decoded values, so that a corrupt
+// database cannot recurse forever through pointers.
+const maxDepth = 32
+
+var errCorrupt = errors.New("geoip: corrupt database")
+
+// Record is what a database knows about an address. Country databases fill
+// in Country, ASN databases ASN and Organization, and City databases
+// Country.
+type Record struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country the address is
+	// located in, or registered to if its location is unknown.
+	Country      string `json:"country,omitempty"`
+	ASN          uint32 `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// Reader looks addresses up in a database held in memory.
+type Reader struct {
+	// Type is the database_type of the metadata, e.g. "GeoLite2-Country".
+	Type string
+
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	data       []byte
+	// ipv4Start is the node IPv4 addresses start from in an IPv6 tree.
+	ipv4Start uint
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// New parses a database held in buf.
+func New(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataStart)
+	if i < 0 {
+		return nil, errors.New("geoip: not a MaxMind DB file")
+	}
+	meta := buf[i+len(metadataStart):]
+	v, _, err := decoder{buf: meta}.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, errCorrupt
+	}
+	r := &Reader{
+		buf:        buf,
+		nodeCount:  uint(toUint(m["node_count"])),
+		recordSize: uint(toUint(m["record_size"])),
+		ipVersion:  uint(toUint(m["ip_version"])),
+	}
+	r.Type, _ = m["database_type"].(string)
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported IP version %d", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, errCorrupt
+	}
+	r.data = buf[treeSize+dataSectionSeparator : i]
+
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < r.nodeCount; j++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Lookup returns what the database knows about addr.
+func (r *Reader) Lookup(addr netip.Addr) (Record, bool, error) {
+	addr = addr.Unmap()
+	node, bits := uint(0), addr.AsSlice()
+	switch {
+	case addr.Is4() && r.ipVersion == 6:
+		node = r.ipv4Start
+	case addr.Is6() && r.ipVersion == 4:
+		return Record{}, false, nil
+	}
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		node = r.record(node, bits[i/8]>>(7-i%8)&1)
+	}
+	if node <= r.nodeCount {
+		return Record{}, false, nil
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return Record{}, false, errCorrupt
+	}
+	v, _, err := decoder{buf: r.data}.decode(offset, 0)
+	if err != nil {
+		return Record{}, false, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return Record{}, false, errCorrupt
+	}
+
+	var rec Record
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := m[key].(map[string]any); ok {
+			if code, ok := country["iso_code"].(string); ok && code != "" {
+				rec.Country = code
+				break
+			}
+		}
+	}
+	rec.ASN = uint32(toUint(m["autonomous_system_number"]))
+	rec.Organization, _ = m["autonomous_system_organization"].(string)
+	return rec, true, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node uint, bit byte) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder decodes values of the data section (or metadata) in buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset after it.
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errCorrupt
+	}
+	ctrl, offset, err := d.byte(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		ptr, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr, depth+1)
+		return v, next, err
+	}
+	if typ == typeExtended {
+		var ext byte
+		if ext, offset, err = d.byte(offset); err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + int(ext)
+	}
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			var k, v any
+			if k, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			if v, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			var v any
+			if v, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	b := d.buf[offset : offset+size]
+	offset += size
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if typ == typeInt32 {
+			return int64(int32(n)), offset, nil
+		}
+		return n, offset, nil
+	}
+	return nil, 0, fmt.Errorf("geoip: unknown data type %d", typ)
+}
+
+func (d decoder) byte(offset uint) (byte, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	return d.buf[offset], offset + 1, nil
+}
+
+// size decodes the payload size in ctrl and the bytes following it.
+func (d decoder) size(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	var extra uint
+	for _, c := range d.buf[offset : offset+n] {
+		extra = extra<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return size, offset + n, nil
+}
+
+// pointer decodes the pointer starting with ctrl and returns the offset it
+// points to and the offset after it.
+func (d decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3&0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	var ptr uint
+	if n < 4 {
+		ptr = uint(ctrl & 0x7)
+	}
+	for _, c := range d.buf[offset : offset+n] {
+		ptr = ptr<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		ptr += 2048
+	case 3:
+		ptr += 526336
+	}
+	return ptr, offset + n, nil
+}
+
+func toUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		if n > 0 {
+			return uint64(n)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,214 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// pointer encodes as a data section pointer to the offset it holds.
+type pointer uint
+
+func encode(v any) []byte {
+	ctrl := func(typ, size int) []byte {
+		var extra []byte
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		if typ > 7 {
+			return append([]byte{byte(size), byte(typ - 7)}, extra...)
+		}
+		return append([]byte{byte(typ<<5 | size)}, extra...)
+	}
+	uintBytes := func(n uint64) []byte {
+		b := binary.BigEndian.AppendUint64(nil, n)
+		return bytes.TrimLeft(b, "\x00")
+	}
+	switch v := v.(type) {
+	case string:
+		return append(ctrl(typeString, len(v)), v...)
+	case uint16:
+		b := uintBytes(uint64(v))
+		return append(ctrl(typeUint16, len(b)), b...)
+	case uint32:
+		b := uintBytes(uint64(v))
+		return append(ctrl(typeUint32, len(b)), b...)
+	case pointer:
+		return []byte{typePointer<<5 | byte(v>>8), byte(v)}
+	case map[string]any:
+		out := ctrl(typeMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			out = append(out, encode(k)...)
+			out = append(out, encode(v[k])...)
+		}
+		return out
+	}
+	panic("cannot encode value")
+}
+
+type trieNode struct {
+	child [2]*trieNode
+	data  [2]int
+}
+
+// buildDB builds an IPv6 database mapping each prefix to the data section
+// offset given for it.
+func buildDB(t *testing.T, recordSize int, prefixes map[string]int, data []byte) []byte {
+	t.Helper()
+	root := &trieNode{data: [2]int{-1, -1}}
+	for p, offset := range prefixes {
+		prefix := netip.MustParsePrefix(p)
+		addr, bits := prefix.Addr().As16(), prefix.Bits()
+		if prefix.Addr().Is4() {
+			addr = [16]byte{}
+			v4 := prefix.Addr().As4()
+			copy(addr[12:], v4[:])
+			bits += 96
+		}
+		node := root
+		for i := 0; i < bits; i++ {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				node.data[bit] = offset
+				break
+			}
+			if node.child[bit] == nil {
+				node.child[bit] = &trieNode{data: [2]int{-1, -1}}
+			}
+			node = node.child[bit]
+		}
+	}
+
+	var nodes []*trieNode
+	index := map[*trieNode]int{}
+	for queue := []*trieNode{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.child {
+			if c != nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+	count := len(nodes)
+
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]uint32
+		for bit := range 2 {
+			switch {
+			case n.child[bit] != nil:
+				records[bit] = uint32(index[n.child[bit]])
+			case n.data[bit] >= 0:
+				records[bit] = uint32(count + dataSectionSeparator + n.data[bit])
+			default:
+				records[bit] = uint32(count)
+			}
+		}
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(records[0]>>16), byte(records[0]>>8), byte(records[0]),
+				byte(records[1]>>16), byte(records[1]>>8), byte(records[1]))
+		case 28:
+			tree = append(tree, byte(records[0]>>16), byte(records[0]>>8), byte(records[0]),
+				byte(records[0]>>20&0xf0|records[1]>>24&0x0f),
+				byte(records[1]>>16), byte(records[1]>>8), byte(records[1]))
+		default:
+			tree = binary.BigEndian.AppendUint32(tree, records[0])
+			tree = binary.BigEndian.AppendUint32(tree, records[1])
+		}
+	}
+
+	buf := append(tree, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataStart...)
+	return append(buf, encode(map[string]any{
+		"node_count":    uint32(count),
+		"record_size":   uint16(recordSize),
+		"ip_version":    uint16(6),
+		"database_type": "Test",
+	})...)
+}
+
+func TestLookup(t *testing.T) {
+	country := encode(map[string]any{"country": map[string]any{"iso_code": "DE"}})
+	asn := encode(map[string]any{
+		"autonomous_system_number":       uint32(13335),
+		"autonomous_system_organization": "CLOUDFLARENET",
+	})
+	// The inner map of the country record starts after the outer map's
+	// control byte and the "country" key.
+	registered := encode(map[string]any{"registered_country": pointer(1 + len(encode("country")))})
+	data := slices.Concat(country, asn, registered)
+	prefixes := map[string]int{
+		"1.2.3.0/24":    0,
+		"2001:db8::/32": len(country),
+		"10.0.0.0/8":    len(country) + len(asn),
+	}
+
+	tests := []struct {
+		addr  string
+		want  Record
+		found bool
+	}{
+		{"1.2.3.4", Record{Country: "DE"}, true},
+		{"::ffff:1.2.3.200", Record{Country: "DE"}, true},
+		{"1.2.4.1", Record{}, false},
+		{"2001:db8:1::1", Record{ASN: 13335, Organization: "CLOUDFLARENET"}, true},
+		{"2001:db9::1", Record{}, false},
+		{"10.20.30.40", Record{Country: "DE"}, true},
+	}
+	for _, size := range []int{24, 28, 32} {
+		r, err := New(buildDB(t, size, prefixes, data))
+		if err != nil {
+			t.Fatalf("New (record size %d): %v", size, err)
+		}
+		if r.Type != "Test" {
+			t.Errorf("Type = %q; expected Test", r.Type)
+		}
+		for _, tt := range tests {
+			got, found, err := r.Lookup(netip.MustParseAddr(tt.addr))
+			if err != nil {
+				t.Fatalf("Lookup(%s) (record size %d): %v", tt.addr, size, err)
+			}
+			if got != tt.want || found != tt.found {
+				t.Errorf("Lookup(%s) (record size %d) = %+v, %v; expected %+v, %v", tt.addr, size, got, found, tt.want, tt.found)
+			}
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	data := encode(map[string]any{"country": map[string]any{"iso_code": "FR"}})
+	if err := os.WriteFile(path, buildDB(t, 24, map[string]int{"192.0.2.0/24": 0}, data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if rec, _, _ := r.Lookup(netip.MustParseAddr("192.0.2.1")); rec.Country != "FR" {
+		t.Errorf("Lookup(192.0.2.1) = %+v; expected FR", rec)
+	}
+
+	if _, err := New([]byte("not a database")); err == nil {
+		t.Error("New accepted a file without metadata")
+	}
+	corrupt := append(slices.Clone(metadataStart), encode(map[string]any{
+		"node_count": uint32(1000), "record_size": uint16(24), "ip_version": uint16(6),
+	})...)
+	if _, err := New(corrupt); err == nil {
+		t.Error("New accepted a search tree larger than the file")
+	}
+}
@@ -0,0 +1,15 @@
+// Package namedpipe serves the proxy on a Windows named pipe, which only
+// local processes can open and whose access is controlled by an ACL instead
+// of by who can reach a TCP port.
+package namedpipe
+
+import "errors"
+
+// ErrNotSupported is returned by Listen on platforms without named pipes.
+var ErrNotSupported = errors.New("named pipes are only supported on Windows")
+
+// Addr is the path of a named pipe, e.g. \\.\pipe\dynamicproxy.
+type Addr string
+
+func (a Addr) Network() string { return "pipe" }
+func (a Addr) String() string  { return string(a) }
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package namedpipe
+
+import "net"
+
+// Listen is only supported on Windows.
+func Listen(path, sddl string) (net.Listener, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,367 @@
+package namedpipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const bufferSize = 64 << 10
+
+// Listen creates the named pipe path. sddl is the security descriptor of
+// the pipe in SDDL form; if empty, only the current user, administrators and
+// SYSTEM may connect. Remote clients are always rejected.
+func Listen(path, sddl string) (net.Listener, error) {
+	if sddl == "" {
+		var err error
+		if sddl, err = defaultSDDL(); err != nil {
+			return nil, err
+		}
+	}
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipe security descriptor %q: %w", sddl, err)
+	}
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &listener{
+		path: path,
+		name: name,
+		sa: &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		},
+	}
+	// The first instance fails if another process already owns the name.
+	if l.next, err = l.create(windows.FILE_FLAG_FIRST_PIPE_INSTANCE); err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "pipe", Addr: Addr(path), Err: err}
+	}
+	return l, nil
+}
+
+// defaultSDDL grants full access to SYSTEM, administrators and the user
+// running the proxy, and nobody else.
+func defaultSDDL() (string, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the current user: %w", err)
+	}
+	return "D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GA;;;" + user.User.Sid.String() + ")", nil
+}
+
+type listener struct {
+	path string
+	name *uint16
+	sa   *windows.SecurityAttributes
+
+	mu       sync.Mutex
+	next     windows.Handle // the instance waiting for the next client
+	closed   bool
+	acceptMu sync.Mutex
+}
+
+func (l *listener) create(flags uint32) (windows.Handle, error) {
+	return windows.CreateNamedPipe(l.name,
+		windows.PIPE_ACCESS_DUPLEX|windows.FILE_FLAG_OVERLAPPED|flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, bufferSize, bufferSize, 0, l.sa)
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	l.acceptMu.Lock()
+	defer l.acceptMu.Unlock()
+	for {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return nil, l.opError(net.ErrClosed)
+		}
+		h := l.next
+		l.mu.Unlock()
+
+		err := l.connect(h)
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return nil, l.opError(net.ErrClosed)
+		}
+		if errors.Is(err, windows.ERROR_NO_DATA) {
+			// The client went away before we saw it; reuse the instance.
+			_ = windows.DisconnectNamedPipe(h)
+			l.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			l.mu.Unlock()
+			return nil, l.opError(err)
+		}
+		// Put up the next instance before handing this one out, so that
+		// clients never find the pipe busy between two Accepts.
+		next, err := l.create(0)
+		if err != nil {
+			l.mu.Unlock()
+			windows.CloseHandle(h)
+			return nil, l.opError(err)
+		}
+		l.next = next
+		l.mu.Unlock()
+		return newConn(h, Addr(l.path))
+	}
+}
+
+// connect waits for a client to open h. Close cancels the wait.
+func (l *listener) connect(h windows.Handle) error {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(event)
+	o := &windows.Overlapped{HEvent: event}
+	err = windows.ConnectNamedPipe(h, o)
+	switch {
+	case errors.Is(err, windows.ERROR_PIPE_CONNECTED):
+		return nil
+	case errors.Is(err, windows.ERROR_IO_PENDING):
+		// A Close that came in before the wait was started found nothing
+		// to cancel.
+		l.mu.Lock()
+		if l.closed {
+			_ = windows.CancelIoEx(h, o)
+		}
+		l.mu.Unlock()
+		var n uint32
+		return windows.GetOverlappedResult(h, o, &n, true)
+	}
+	return err
+}
+
+func (l *listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	h := l.next
+	_ = windows.CancelIoEx(h, nil)
+	l.mu.Unlock()
+
+	// Wait for a pending Accept to notice before closing its handle.
+	l.acceptMu.Lock()
+	defer l.acceptMu.Unlock()
+	return windows.CloseHandle(h)
+}
+
+func (l *listener) Addr() net.Addr { return Addr(l.path) }
+
+func (l *listener) opError(err error) error {
+	return &net.OpError{Op: "accept", Net: "pipe", Addr: Addr(l.path), Err: err}
+}
+
+// conn is a connected pipe instance. Reads and writes use overlapped I/O so
+// that deadlines and Close can cancel them.
+type conn struct {
+	h      windows.Handle
+	addr   Addr
+	closed atomic.Bool
+	read   direction
+	write  direction
+}
+
+// direction serializes the operations in one direction and tracks the one in
+// flight, so that its deadline or Close can cancel it.
+type direction struct {
+	opMu  sync.Mutex
+	event windows.Handle
+
+	mu       sync.Mutex
+	pending  *windows.Overlapped
+	timer    *time.Timer
+	deadline time.Time
+	expired  bool
+}
+
+func newConn(h windows.Handle, addr Addr) (*conn, error) {
+	c := &conn{h: h, addr: addr}
+	for _, d := range []*direction{&c.read, &c.write} {
+		event, err := windows.CreateEvent(nil, 1, 0, nil)
+		if err != nil {
+			c.closeHandles()
+			return nil, err
+		}
+		d.event = event
+	}
+	return c, nil
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.do(&c.read, func(o *windows.Overlapped) error {
+		return windows.ReadFile(c.h, b, nil, o)
+	})
+	if errors.Is(err, windows.ERROR_BROKEN_PIPE) || errors.Is(err, windows.ERROR_PIPE_NOT_CONNECTED) {
+		return 0, io.EOF
+	}
+	if err != nil {
+		return n, c.opError("read", err)
+	}
+	return n, nil
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := c.do(&c.write, func(o *windows.Overlapped) error {
+			return windows.WriteFile(c.h, b[written:], nil, o)
+		})
+		written += n
+		if err != nil {
+			return written, c.opError("write", err)
+		}
+	}
+	return written, nil
+}
+
+// do runs one overlapped operation and waits for it, returning
+// os.ErrDeadlineExceeded or net.ErrClosed if it was cancelled.
+func (c *conn) do(d *direction, op func(*windows.Overlapped) error) (int, error) {
+	d.opMu.Lock()
+	defer d.opMu.Unlock()
+
+	o := &windows.Overlapped{HEvent: d.event}
+	d.mu.Lock()
+	if c.closed.Load() {
+		d.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	if d.expired {
+		d.mu.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+	d.pending = o
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.pending = nil
+		d.mu.Unlock()
+	}()
+
+	err := op(o)
+	if errors.Is(err, windows.ERROR_IO_PENDING) {
+		// A deadline or Close that came in before the operation was
+		// started found nothing to cancel.
+		d.mu.Lock()
+		if d.expired || c.closed.Load() {
+			_ = windows.CancelIoEx(c.h, o)
+		}
+		d.mu.Unlock()
+		err = nil
+	}
+	var n uint32
+	if err == nil {
+		err = windows.GetOverlappedResult(c.h, o, &n, true)
+	}
+	if errors.Is(err, windows.ERROR_OPERATION_ABORTED) {
+		if c.closed.Load() {
+			return int(n), net.ErrClosed
+		}
+		return int(n), os.ErrDeadlineExceeded
+	}
+	return int(n), err
+}
+
+func (d *direction) setDeadline(c *conn, t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.deadline = t
+	d.expired = false
+	if t.IsZero() {
+		return
+	}
+	expire := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if !d.deadline.Equal(t) {
+			return
+		}
+		d.expired = true
+		if d.pending != nil {
+			_ = windows.CancelIoEx(c.h, d.pending)
+		}
+	}
+	if wait := time.Until(t); wait > 0 {
+		d.timer = time.AfterFunc(wait, expire)
+		return
+	}
+	d.expired = true
+	if d.pending != nil {
+		_ = windows.CancelIoEx(c.h, d.pending)
+	}
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.read.setDeadline(c, t)
+	c.write.setDeadline(c, t)
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.read.setDeadline(c, t)
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.write.setDeadline(c, t)
+	return nil
+}
+
+func (c *conn) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	for _, d := range []*direction{&c.read, &c.write} {
+		d.mu.Lock()
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		if d.pending != nil {
+			_ = windows.CancelIoEx(c.h, d.pending)
+		}
+		d.mu.Unlock()
+	}
+	// Wait for cancelled operations to finish with the handles.
+	c.read.opMu.Lock()
+	c.write.opMu.Lock()
+	defer c.read.opMu.Unlock()
+	defer c.write.opMu.Unlock()
+	return c.closeHandles()
+}
+
+func (c *conn) closeHandles() error {
+	for _, d := range []*direction{&c.read, &c.write} {
+		if d.event != 0 {
+			windows.CloseHandle(d.event)
+		}
+	}
+	return windows.CloseHandle(c.h)
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.addr }
+func (c *conn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *conn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "pipe", Addr: c.addr, Err: err}
+}
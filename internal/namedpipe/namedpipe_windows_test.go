@@ -0,0 +1,129 @@
+package namedpipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+func testPipe() string {
+	return fmt.Sprintf(`\\.\pipe\dynamicproxy-test-%d-%d`, os.Getpid(), time.Now().UnixNano())
+}
+
+func dial(t *testing.T, path string) *os.File {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	return os.NewFile(uintptr(h), path)
+}
+
+func TestListenerEcho(t *testing.T) {
+	path := testPipe()
+	l, err := Listen(path, "")
+	if err != nil {
+		t.Fatalf("Listen = %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		client := dial(t, path)
+		msg := fmt.Sprintf("hello %d", i)
+		if _, err := client.Write([]byte(msg)); err != nil {
+			t.Fatalf("Write = %v", err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(client, buf); err != nil || string(buf) != msg {
+			t.Fatalf("read %q, %v; expected %q", buf, err, msg)
+		}
+		client.Close()
+	}
+}
+
+func TestListenNameInUse(t *testing.T) {
+	path := testPipe()
+	l, err := Listen(path, "")
+	if err != nil {
+		t.Fatalf("Listen = %v", err)
+	}
+	defer l.Close()
+	if l2, err := Listen(path, ""); err == nil {
+		l2.Close()
+		t.Fatal("second Listen on the same pipe succeeded")
+	}
+}
+
+func TestConnDeadlineAndClose(t *testing.T) {
+	path := testPipe()
+	l, err := Listen(path, "")
+	if err != nil {
+		t.Fatalf("Listen = %v", err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	client := dial(t, path)
+	defer client.Close()
+	c := <-accepted
+
+	_ = c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read past the deadline = %v; expected os.ErrDeadlineExceeded", err)
+	}
+
+	_ = c.SetReadDeadline(time.Time{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Read during Close = %v; expected net.ErrClosed", err)
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := Listen(testPipe(), "")
+	if err != nil {
+		t.Fatalf("Listen = %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	l.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Accept during Close = %v; expected net.ErrClosed", err)
+	}
+}
@@ -0,0 +1,592 @@
+package pac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// globals returns the functions PAC files may call: the standard PAC
+// functions and the few JavaScript built-ins they commonly use.
+func (s *Script) globals() *scope {
+	g := newScope(nil)
+	for name, v := range map[string]value{
+		"undefined": undefined,
+		"NaN":       math.NaN(),
+		"Infinity":  math.Inf(1),
+
+		"isPlainHostName": fn1(func(host string) value { return !strings.Contains(host, ".") }),
+		"dnsDomainIs": fn2(func(host, domain string) value {
+			return strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain))
+		}),
+		"localHostOrDomainIs": fn2(func(host, hostdom string) value {
+			host, hostdom = strings.ToLower(host), strings.ToLower(hostdom)
+			return host == hostdom || !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+".")
+		}),
+		"isResolvable": fn1(func(host string) value {
+			_, ok := s.resolve(host)
+			return ok
+		}),
+		"dnsResolve": fn1(func(host string) value {
+			if addr, ok := s.resolve(host); ok {
+				return addr
+			}
+			return nil
+		}),
+		"myIpAddress": builtin(func([]value) (value, error) {
+			return s.myIPAddress(), nil
+		}),
+		"isInNet":         builtin(s.isInNet),
+		"dnsDomainLevels": fn1(func(host string) value { return float64(strings.Count(host, ".")) }),
+		"shExpMatch":      fn2(func(str, pattern string) value { return shExpMatch(str, pattern) }),
+		"convert_addr": fn1(func(addr string) value {
+			ip := net.ParseIP(addr).To4()
+			if ip == nil {
+				return 0.0
+			}
+			return float64(binary.BigEndian.Uint32(ip))
+		}),
+		"weekdayRange": builtin(s.weekdayRange),
+		"timeRange":    builtin(s.timeRange),
+		"alert": builtin(func(args []value) (value, error) {
+			if s.Alert != nil && len(args) > 0 {
+				s.Alert(toString(args[0]))
+			}
+			return undefined, nil
+		}),
+
+		"parseInt": builtin(func(args []value) (value, error) {
+			str := strings.TrimSpace(toString(arg(args, 0)))
+			sign := ""
+			if str != "" && (str[0] == '-' || str[0] == '+') {
+				sign, str = str[:1], str[1:]
+			}
+			base := 0
+			if len(args) > 1 {
+				base = int(toNumber(args[1]))
+			}
+			if (base == 0 || base == 16) && len(str) > 1 && str[0] == '0' && (str[1] == 'x' || str[1] == 'X') {
+				base, str = 16, str[2:]
+			}
+			if base == 0 {
+				base = 10
+			}
+			end := 0
+			for end < len(str) && digitValue(str[end]) < base {
+				end++
+			}
+			n, err := strconv.ParseInt(sign+str[:end], base, 64)
+			if err != nil {
+				return math.NaN(), nil
+			}
+			return float64(n), nil
+		}),
+		"parseFloat": fn1(func(str string) value { return toNumber(str) }),
+		"isNaN":      builtin(func(args []value) (value, error) { return math.IsNaN(toNumber(arg(args, 0))), nil }),
+		"String":     builtin(func(args []value) (value, error) { return toString(arg(args, 0)), nil }),
+		"Number":     builtin(func(args []value) (value, error) { return toNumber(arg(args, 0)), nil }),
+		"Boolean":    builtin(func(args []value) (value, error) { return truthy(arg(args, 0)), nil }),
+		"Array": builtin(func(args []value) (value, error) {
+			if len(args) == 1 {
+				if n, ok := args[0].(float64); ok {
+					if n < 0 || n != math.Trunc(n) || n > maxArrayGap {
+						return nil, fmt.Errorf("invalid array length %s", toString(n))
+					}
+					a := &arrayValue{elems: make([]value, int(n))}
+					for i := range a.elems {
+						a.elems[i] = undefined
+					}
+					return a, nil
+				}
+			}
+			return &arrayValue{elems: args}, nil
+		}),
+		"RegExp": builtin(func(args []value) (value, error) {
+			flags := ""
+			if len(args) > 1 {
+				flags = toString(args[1])
+			}
+			return newRegexp(toString(arg(args, 0)), flags)
+		}),
+	} {
+		g.vars[name] = v
+	}
+	return g
+}
+
+func arg(args []value, i int) value {
+	if i < len(args) {
+		return args[i]
+	}
+	return undefined
+}
+
+func fn1(f func(string) value) builtin {
+	return func(args []value) (value, error) {
+		return f(toString(arg(args, 0))), nil
+	}
+}
+
+func fn2(f func(string, string) value) builtin {
+	return func(args []value) (value, error) {
+		return f(toString(arg(args, 0)), toString(arg(args, 1))), nil
+	}
+}
+
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 36
+}
+
+// shExpMatch matches str against a shell expression, in which * matches any
+// text and ? any character.
+func shExpMatch(str, pattern string) bool {
+	// On a mismatch, let the last * match one more character and go on.
+	s, p, star, mark := 0, 0, -1, 0
+	for s < len(str) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == str[s]):
+			s++
+			p++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, s
+			p++
+		case star >= 0:
+			mark++
+			p, s = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func (s *Script) isInNet(args []value) (value, error) {
+	host := toString(arg(args, 0))
+	addr := host
+	if net.ParseIP(host) == nil {
+		resolved, ok := s.resolve(host)
+		if !ok {
+			return false, nil
+		}
+		addr = resolved
+	}
+	ip := net.ParseIP(addr).To4()
+	pattern := net.ParseIP(toString(arg(args, 1))).To4()
+	mask := net.ParseIP(toString(arg(args, 2))).To4()
+	if ip == nil || pattern == nil || mask == nil {
+		return false, nil
+	}
+	m := net.IPMask(mask)
+	return ip.Mask(m).Equal(pattern.Mask(m)), nil
+}
+
+func (s *Script) resolve(host string) (string, bool) {
+	if ip := net.ParseIP(host); ip != nil {
+		return host, true
+	}
+	if s.Resolve != nil {
+		return s.Resolve(host)
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return "", false
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			return addr, true
+		}
+	}
+	if len(addrs) == 0 {
+		return "", false
+	}
+	return addrs[0], true
+}
+
+func (s *Script) myIPAddress() string {
+	if s.MyIPAddress != nil {
+		return s.MyIPAddress()
+	}
+	// Connecting a UDP socket sends nothing but picks the address of the
+	// interface with the default route.
+	conn, err := net.Dial("udp4", "192.0.2.1:53")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+func (s *Script) now(args []value) ([]value, time.Time) {
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	if len(args) > 0 && toString(args[len(args)-1]) == "GMT" {
+		return args[:len(args)-1], now.UTC()
+	}
+	return args, now
+}
+
+var weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// weekdayRange(wd1[, wd2][, "GMT"]) holds on wd1, or from wd1 through wd2.
+func (s *Script) weekdayRange(args []value) (value, error) {
+	args, now := s.now(args)
+	if len(args) == 0 {
+		return false, nil
+	}
+	day := func(v value) (int, error) {
+		for i, name := range weekdays {
+			if strings.EqualFold(toString(v), name) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("weekdayRange: invalid weekday %q", toString(v))
+	}
+	from, err := day(args[0])
+	if err != nil {
+		return nil, err
+	}
+	to := from
+	if len(args) > 1 {
+		if to, err = day(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	return inRange(int(now.Weekday()), from, to), nil
+}
+
+// timeRange(h1[, h2][, "GMT"]), timeRange(h1, m1, h2, m2[, "GMT"]) and
+// timeRange(h1, m1, s1, h2, m2, s2[, "GMT"]) hold from the first time
+// through the second, wrapping around midnight.
+func (s *Script) timeRange(args []value) (value, error) {
+	args, now := s.now(args)
+	n := make([]int, len(args))
+	for i, a := range args {
+		n[i] = int(toNumber(a))
+	}
+	secs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	switch len(n) {
+	case 1:
+		return now.Hour() == n[0], nil
+	case 2:
+		return inRange(now.Hour(), n[0], n[1]), nil
+	case 4:
+		return inRange(secs, n[0]*3600+n[1]*60, n[2]*3600+n[3]*60+59), nil
+	case 6:
+		return inRange(secs, n[0]*3600+n[1]*60+n[2], n[3]*3600+n[4]*60+n[5]), nil
+	}
+	return nil, fmt.Errorf("timeRange: unsupported arguments")
+}
+
+// inRange reports whether from <= x <= to, wrapping around if to < from.
+func inRange(x, from, to int) bool {
+	if from <= to {
+		return from <= x && x <= to
+	}
+	return x >= from || x <= to
+}
+
+// getMember returns the property name of v, binding methods to v.
+func getMember(v value, name string) (value, error) {
+	switch v := v.(type) {
+	case string:
+		return stringMember(v, name), nil
+	case *arrayValue:
+		return arrayMember(v, name), nil
+	case *regexpValue:
+		switch name {
+		case "test":
+			return builtin(func(args []value) (value, error) {
+				return v.re.MatchString(toString(arg(args, 0))), nil
+			}), nil
+		case "exec":
+			return builtin(func(args []value) (value, error) {
+				return match(toString(arg(args, 0)), v, false), nil
+			}), nil
+		case "source":
+			return strings.TrimPrefix(v.re.String(), "(?i)"), nil
+		}
+		return undefined, nil
+	case *objectValue:
+		if x, ok := v.values[name]; ok {
+			return x, nil
+		}
+		if name == "hasOwnProperty" {
+			return builtin(func(args []value) (value, error) {
+				_, ok := v.values[toString(arg(args, 0))]
+				return ok, nil
+			}), nil
+		}
+		return undefined, nil
+	case nil, undefinedValue:
+		return nil, fmt.Errorf("cannot read property %q of %s", name, toString(v))
+	}
+	return undefined, nil
+}
+
+func stringMember(str, name string) value {
+	method := func(f func(args []value) value) value {
+		return builtin(func(args []value) (value, error) { return f(args), nil })
+	}
+	switch name {
+	case "length":
+		return float64(len(str))
+	case "toLowerCase":
+		return method(func([]value) value { return strings.ToLower(str) })
+	case "toUpperCase":
+		return method(func([]value) value { return strings.ToUpper(str) })
+	case "trim":
+		return method(func([]value) value { return strings.TrimSpace(str) })
+	case "indexOf":
+		return method(func(args []value) value {
+			from := clamp(toNumber(arg(args, 1)), len(str))
+			i := strings.Index(str[from:], toString(arg(args, 0)))
+			if i < 0 {
+				return -1.0
+			}
+			return float64(from + i)
+		})
+	case "lastIndexOf":
+		return method(func(args []value) value { return float64(strings.LastIndex(str, toString(arg(args, 0)))) })
+	case "includes":
+		return method(func(args []value) value { return strings.Contains(str, toString(arg(args, 0))) })
+	case "startsWith":
+		return method(func(args []value) value { return strings.HasPrefix(str, toString(arg(args, 0))) })
+	case "endsWith":
+		return method(func(args []value) value { return strings.HasSuffix(str, toString(arg(args, 0))) })
+	case "charAt":
+		return method(func(args []value) value {
+			i := int(toNumber(arg(args, 0)))
+			if i < 0 || i >= len(str) {
+				return ""
+			}
+			return str[i : i+1]
+		})
+	case "charCodeAt":
+		return method(func(args []value) value {
+			i := int(toNumber(arg(args, 0)))
+			if i < 0 || i >= len(str) {
+				return math.NaN()
+			}
+			return float64(str[i])
+		})
+	case "substring":
+		return method(func(args []value) value {
+			start := clamp(toNumber(arg(args, 0)), len(str))
+			end := len(str)
+			if e := arg(args, 1); e != undefined {
+				end = clamp(toNumber(e), len(str))
+			}
+			if start > end {
+				start, end = end, start
+			}
+			return str[start:end]
+		})
+	case "substr":
+		return method(func(args []value) value {
+			start := relative(toNumber(arg(args, 0)), len(str))
+			end := len(str)
+			if n := arg(args, 1); n != undefined {
+				end = min(start+clamp(toNumber(n), len(str)), len(str))
+			}
+			return str[start:end]
+		})
+	case "slice":
+		return method(func(args []value) value {
+			start := relative(toNumber(arg(args, 0)), len(str))
+			end := len(str)
+			if e := arg(args, 1); e != undefined {
+				end = relative(toNumber(e), len(str))
+			}
+			if start > end {
+				return ""
+			}
+			return str[start:end]
+		})
+	case "split":
+		return method(func(args []value) value {
+			a := &arrayValue{}
+			var parts []string
+			switch sep := arg(args, 0).(type) {
+			case undefinedValue:
+				parts = []string{str}
+			case *regexpValue:
+				parts = sep.re.Split(str, -1)
+			default:
+				parts = strings.Split(str, toString(sep))
+			}
+			for _, p := range parts {
+				a.elems = append(a.elems, p)
+			}
+			return a
+		})
+	case "concat":
+		return method(func(args []value) value {
+			for _, a := range args {
+				s := toString(a)
+				if len(str)+len(s) > maxBytes {
+					panic(errTooLarge)
+				}
+				str += s
+			}
+			return str
+		})
+	case "match":
+		return method(func(args []value) value {
+			re, ok := arg(args, 0).(*regexpValue)
+			if !ok {
+				return nil
+			}
+			return match(str, re, re.global)
+		})
+	case "search":
+		return method(func(args []value) value {
+			if re, ok := arg(args, 0).(*regexpValue); ok {
+				if loc := re.re.FindStringIndex(str); loc != nil {
+					return float64(loc[0])
+				}
+			}
+			return -1.0
+		})
+	case "replace":
+		return method(func(args []value) value {
+			repl := toString(arg(args, 1))
+			switch pattern := arg(args, 0).(type) {
+			case *regexpValue:
+				n := 1
+				if pattern.global {
+					n = maxMatches
+				}
+				matches := pattern.re.FindAllStringSubmatchIndex(str, n)
+				if pattern.global && len(matches) == n {
+					panic(errTooLarge)
+				}
+				// Replacements may repeat the match, so the result is
+				// built and checked one replacement at a time.
+				var dst []byte
+				last := 0
+				for _, loc := range matches {
+					dst = append(dst, str[last:loc[0]]...)
+					dst = pattern.re.ExpandString(dst, repl, str, loc)
+					last = loc[1]
+					if len(dst) > maxBytes {
+						panic(errTooLarge)
+					}
+				}
+				return string(dst) + str[last:]
+			default:
+				if len(str)+len(repl) > maxBytes {
+					panic(errTooLarge)
+				}
+				return strings.Replace(str, toString(pattern), repl, 1)
+			}
+		})
+	case "toString", "valueOf":
+		return method(func([]value) value { return str })
+	}
+	return undefined
+}
+
+func arrayMember(a *arrayValue, name string) value {
+	method := func(f func(args []value) value) value {
+		return builtin(func(args []value) (value, error) { return f(args), nil })
+	}
+	switch name {
+	case "length":
+		return float64(len(a.elems))
+	case "indexOf":
+		return method(func(args []value) value {
+			for i, e := range a.elems {
+				if strictEqual(e, arg(args, 0)) {
+					return float64(i)
+				}
+			}
+			return -1.0
+		})
+	case "includes":
+		return method(func(args []value) value {
+			for _, e := range a.elems {
+				if strictEqual(e, arg(args, 0)) {
+					return true
+				}
+			}
+			return false
+		})
+	case "join":
+		return method(func(args []value) value {
+			sep := ","
+			if s := arg(args, 0); s != undefined {
+				sep = toString(s)
+			}
+			return joinArray(a, sep)
+		})
+	case "push":
+		return method(func(args []value) value {
+			a.elems = append(a.elems, args...)
+			return float64(len(a.elems))
+		})
+	case "toString":
+		return method(func([]value) value { return toString(a) })
+	}
+	return undefined
+}
+
+// match returns the match of re in str as an array of the match and its
+// groups, or with global all matches, or null if there are none.
+func match(str string, re *regexpValue, global bool) value {
+	a := &arrayValue{}
+	if global {
+		for _, m := range re.re.FindAllString(str, -1) {
+			a.elems = append(a.elems, m)
+		}
+	} else {
+		m := re.re.FindStringSubmatchIndex(str)
+		for i := 0; i+1 < len(m); i += 2 {
+			if m[i] < 0 {
+				a.elems = append(a.elems, undefined)
+				continue
+			}
+			a.elems = append(a.elems, str[m[i]:m[i+1]])
+		}
+	}
+	if len(a.elems) == 0 {
+		return nil
+	}
+	return a
+}
+
+// clamp converts n to an index between 0 and length.
+func clamp(n float64, length int) int {
+	if math.IsNaN(n) || n < 0 {
+		return 0
+	}
+	if n > float64(length) {
+		return length
+	}
+	return int(n)
+}
+
+// relative converts n to an index between 0 and length, counting negative
+// values from the end.
+func relative(n float64, length int) int {
+	if n < 0 {
+		n += float64(length)
+	}
+	return clamp(n, length)
+}
@@ -0,0 +1,926 @@
+package pac
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxSteps bounds the statements and calls one evaluation runs, so that
+	// a script that loops forever cannot hang requests.
+	maxSteps = 1_000_000
+	// maxDepth bounds the nesting of function calls.
+	maxDepth = 200
+	// maxBytes bounds the strings, arrays and objects one evaluation
+	// creates, and so the length of any one string, so that a script
+	// cannot exhaust the proxy's memory.
+	maxBytes = 16 << 20
+	// maxArrayGap bounds how far beyond the end of an array an element may
+	// be set, or how long Array(n) makes an array, since the elements in
+	// between are filled in.
+	maxArrayGap = 1024
+	// maxMatches bounds the matches a global replace replaces.
+	maxMatches = 1 << 16
+	// elemSize is what an element of an array or object is charged.
+	elemSize = 16
+)
+
+var (
+	errTooLong  = errors.New("script ran too long")
+	errTooLarge = errors.New("script used too much memory")
+)
+
+// value is a JavaScript value: undefinedValue, nil for null, bool, float64,
+// string, *arrayValue, *objectValue, *regexpValue, *closure or builtin.
+type value any
+
+type undefinedValue struct{}
+
+var undefined value = undefinedValue{}
+
+type arrayValue struct{ elems []value }
+
+type objectValue struct {
+	keys   []string
+	values map[string]value
+}
+
+type regexpValue struct {
+	re     *regexp.Regexp
+	global bool
+}
+
+type closure struct {
+	fn    *funcLit
+	scope *scope
+}
+
+type builtin func(args []value) (value, error)
+
+type scope struct {
+	vars   map[string]value
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]value), parent: parent}
+}
+
+func (s *scope) lookup(name string) (*scope, bool) {
+	for ; s != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// control is how a statement completed.
+type control int
+
+const (
+	normal control = iota
+	returned
+	broke
+	continued
+)
+
+// interp evaluates one call of FindProxyForURL.
+type interp struct {
+	globals *scope
+	steps   int
+	depth   int
+	bytes   int
+}
+
+func (in *interp) step() error {
+	return in.stepN(1)
+}
+
+func (in *interp) stepN(n int) error {
+	in.steps += n
+	if in.steps > maxSteps {
+		return errTooLong
+	}
+	return nil
+}
+
+// alloc charges the memory of a string, array or object v that was
+// created against maxBytes.
+func (in *interp) alloc(v value) error {
+	switch v := v.(type) {
+	case string:
+		return in.allocBytes(len(v))
+	case *arrayValue:
+		return in.allocBytes(len(v.elems) * elemSize)
+	case *objectValue:
+		return in.allocBytes(len(v.keys) * elemSize)
+	}
+	return nil
+}
+
+func (in *interp) allocBytes(n int) error {
+	in.bytes += n
+	if in.bytes > maxBytes {
+		return errTooLarge
+	}
+	return nil
+}
+
+// declare hoists the functions and variables declared in body into s, as
+// JavaScript makes them visible throughout the function.
+func declare(body []stmt, s *scope) {
+	var walk func(st stmt)
+	walk = func(st stmt) {
+		switch st := st.(type) {
+		case *varStmt:
+			for _, name := range st.names {
+				if _, ok := s.vars[name]; !ok {
+					s.vars[name] = undefined
+				}
+			}
+		case *funcDecl:
+			s.vars[st.name] = &closure{fn: st.fn, scope: s}
+		case *blockStmt:
+			for _, st := range st.body {
+				walk(st)
+			}
+		case *ifStmt:
+			walk(st.then)
+			walk(st.els)
+		case *forStmt:
+			walk(st.init)
+			walk(st.body)
+		case *forInStmt:
+			if _, ok := s.vars[st.name]; !ok {
+				s.vars[st.name] = undefined
+			}
+			walk(st.body)
+		case *whileStmt:
+			walk(st.body)
+		case *switchStmt:
+			for _, c := range st.cases {
+				for _, st := range c.body {
+					walk(st)
+				}
+			}
+		}
+	}
+	for _, st := range body {
+		walk(st)
+	}
+}
+
+func (in *interp) execAll(body []stmt, s *scope) (control, value, error) {
+	for _, st := range body {
+		ctl, v, err := in.exec(st, s)
+		if err != nil || ctl != normal {
+			return ctl, v, err
+		}
+	}
+	return normal, nil, nil
+}
+
+func (in *interp) exec(st stmt, s *scope) (control, value, error) {
+	if err := in.step(); err != nil {
+		return normal, nil, err
+	}
+	switch st := st.(type) {
+	case nil, *emptyStmt, *funcDecl:
+		return normal, nil, nil
+	case *varStmt:
+		for i, name := range st.names {
+			if st.inits[i] == nil {
+				continue
+			}
+			v, err := in.eval(st.inits[i], s)
+			if err != nil {
+				return normal, nil, err
+			}
+			in.set(name, v, s)
+		}
+		return normal, nil, nil
+	case *exprStmt:
+		_, err := in.eval(st.x, s)
+		return normal, nil, err
+	case *blockStmt:
+		return in.execAll(st.body, s)
+	case *returnStmt:
+		if st.value == nil {
+			return returned, undefined, nil
+		}
+		v, err := in.eval(st.value, s)
+		return returned, v, err
+	case *ifStmt:
+		cond, err := in.eval(st.cond, s)
+		if err != nil {
+			return normal, nil, err
+		}
+		if truthy(cond) {
+			return in.exec(st.then, s)
+		}
+		return in.exec(st.els, s)
+	case *whileStmt:
+		return in.loop(nil, st.cond, nil, st.body, s)
+	case *forStmt:
+		return in.loop(st.init, st.cond, st.post, st.body, s)
+	case *forInStmt:
+		return in.forIn(st, s)
+	case *switchStmt:
+		return in.execSwitch(st, s)
+	case *breakStmt:
+		return broke, nil, nil
+	case *continueStmt:
+		return continued, nil, nil
+	}
+	return normal, nil, fmt.Errorf("unsupported statement %T", st)
+}
+
+func (in *interp) loop(init stmt, cond, post expr, body stmt, s *scope) (control, value, error) {
+	if _, _, err := in.exec(init, s); err != nil {
+		return normal, nil, err
+	}
+	for {
+		if cond != nil {
+			v, err := in.eval(cond, s)
+			if err != nil {
+				return normal, nil, err
+			}
+			if !truthy(v) {
+				return normal, nil, nil
+			}
+		}
+		ctl, v, err := in.exec(body, s)
+		switch {
+		case err != nil:
+			return normal, nil, err
+		case ctl == returned:
+			return ctl, v, nil
+		case ctl == broke:
+			return normal, nil, nil
+		}
+		if post != nil {
+			if _, err := in.eval(post, s); err != nil {
+				return normal, nil, err
+			}
+		}
+	}
+}
+
+func (in *interp) forIn(st *forInStmt, s *scope) (control, value, error) {
+	x, err := in.eval(st.x, s)
+	if err != nil {
+		return normal, nil, err
+	}
+	var keys []string
+	switch x := x.(type) {
+	case *arrayValue:
+		for i := range x.elems {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	case *objectValue:
+		keys = slices.Clone(x.keys)
+	}
+	for _, key := range keys {
+		in.set(st.name, key, s)
+		ctl, v, err := in.exec(st.body, s)
+		switch {
+		case err != nil:
+			return normal, nil, err
+		case ctl == returned:
+			return ctl, v, nil
+		case ctl == broke:
+			return normal, nil, nil
+		}
+	}
+	return normal, nil, nil
+}
+
+func (in *interp) execSwitch(st *switchStmt, s *scope) (control, value, error) {
+	x, err := in.eval(st.x, s)
+	if err != nil {
+		return normal, nil, err
+	}
+	start := -1
+	for i, c := range st.cases {
+		if c.match == nil {
+			continue
+		}
+		m, err := in.eval(c.match, s)
+		if err != nil {
+			return normal, nil, err
+		}
+		if strictEqual(x, m) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		start = slices.IndexFunc(st.cases, func(c switchCase) bool { return c.match == nil })
+	}
+	if start < 0 {
+		return normal, nil, nil
+	}
+	// Cases fall through until a break.
+	for _, c := range st.cases[start:] {
+		ctl, v, err := in.execAll(c.body, s)
+		switch {
+		case err != nil:
+			return normal, nil, err
+		case ctl == broke:
+			return normal, nil, nil
+		case ctl != normal:
+			return ctl, v, nil
+		}
+	}
+	return normal, nil, nil
+}
+
+// set assigns a variable, creating a global one if it was never declared.
+func (in *interp) set(name string, v value, s *scope) {
+	if owner, ok := s.lookup(name); ok {
+		owner.vars[name] = v
+		return
+	}
+	in.globals.vars[name] = v
+}
+
+func (in *interp) eval(x expr, s *scope) (value, error) {
+	switch x := x.(type) {
+	case *literal:
+		return x.v, nil
+	case *ident:
+		if owner, ok := s.lookup(x.name); ok {
+			return owner.vars[x.name], nil
+		}
+		return nil, fmt.Errorf("%s is not defined", x.name)
+	case *arrayLit:
+		a := &arrayValue{}
+		for _, e := range x.elems {
+			v, err := in.eval(e, s)
+			if err != nil {
+				return nil, err
+			}
+			a.elems = append(a.elems, v)
+		}
+		return a, in.alloc(a)
+	case *objectLit:
+		o := newObject()
+		for i, key := range x.keys {
+			v, err := in.eval(x.values[i], s)
+			if err != nil {
+				return nil, err
+			}
+			o.set(key, v)
+		}
+		return o, in.alloc(o)
+	case *funcLit:
+		return &closure{fn: x, scope: s}, nil
+	case *unaryExpr:
+		return in.evalUnary(x, s)
+	case *binaryExpr:
+		return in.evalBinary(x, s)
+	case *condExpr:
+		cond, err := in.eval(x.cond, s)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return in.eval(x.then, s)
+		}
+		return in.eval(x.els, s)
+	case *assignExpr:
+		v, err := in.eval(x.value, s)
+		if err != nil {
+			return nil, err
+		}
+		if x.op != "=" {
+			old, err := in.eval(x.target, s)
+			if err != nil {
+				return nil, err
+			}
+			if v, err = arithmetic(strings.TrimSuffix(x.op, "="), old, v); err != nil {
+				return nil, err
+			}
+			if err := in.alloc(v); err != nil {
+				return nil, err
+			}
+		}
+		return v, in.assign(x.target, v, s)
+	case *updateExpr:
+		old, err := in.eval(x.target, s)
+		if err != nil {
+			return nil, err
+		}
+		n := toNumber(old)
+		v := n + 1
+		if x.op == "--" {
+			v = n - 1
+		}
+		if err := in.assign(x.target, v, s); err != nil {
+			return nil, err
+		}
+		if x.prefix {
+			return v, nil
+		}
+		return n, nil
+	case *callExpr:
+		return in.evalCall(x, s)
+	case *memberExpr:
+		obj, err := in.eval(x.x, s)
+		if err != nil {
+			return nil, err
+		}
+		return getMember(obj, x.name)
+	case *indexExpr:
+		obj, err := in.eval(x.x, s)
+		if err != nil {
+			return nil, err
+		}
+		index, err := in.eval(x.index, s)
+		if err != nil {
+			return nil, err
+		}
+		return getIndex(obj, index)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", x)
+}
+
+func (in *interp) assign(target expr, v value, s *scope) error {
+	switch t := target.(type) {
+	case *ident:
+		in.set(t.name, v, s)
+		return nil
+	case *memberExpr:
+		obj, err := in.eval(t.x, s)
+		if err != nil {
+			return err
+		}
+		return in.setIndex(obj, t.name, v)
+	case *indexExpr:
+		obj, err := in.eval(t.x, s)
+		if err != nil {
+			return err
+		}
+		index, err := in.eval(t.index, s)
+		if err != nil {
+			return err
+		}
+		return in.setIndex(obj, index, v)
+	}
+	return errors.New("invalid assignment target")
+}
+
+func (in *interp) evalUnary(x *unaryExpr, s *scope) (value, error) {
+	if x.op == "typeof" {
+		if id, ok := x.x.(*ident); ok {
+			if _, ok := s.lookup(id.name); !ok {
+				return "undefined", nil
+			}
+		}
+	}
+	v, err := in.eval(x.x, s)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "!":
+		return !truthy(v), nil
+	case "-":
+		return -toNumber(v), nil
+	case "+":
+		return toNumber(v), nil
+	case "void":
+		return undefined, nil
+	}
+	return typeOf(v), nil
+}
+
+func (in *interp) evalBinary(x *binaryExpr, s *scope) (value, error) {
+	a, err := in.eval(x.x, s)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "&&":
+		if !truthy(a) {
+			return a, nil
+		}
+		return in.eval(x.y, s)
+	case "||":
+		if truthy(a) {
+			return a, nil
+		}
+		return in.eval(x.y, s)
+	}
+	b, err := in.eval(x.y, s)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case ",":
+		return b, nil
+	case "===":
+		return strictEqual(a, b), nil
+	case "!==":
+		return !strictEqual(a, b), nil
+	case "==":
+		return looseEqual(a, b), nil
+	case "!=":
+		return !looseEqual(a, b), nil
+	case "<", ">", "<=", ">=":
+		return compare(x.op, a, b), nil
+	case "in":
+		switch b := b.(type) {
+		case *objectValue:
+			_, ok := b.values[toString(a)]
+			return ok, nil
+		case *arrayValue:
+			i, err := strconv.Atoi(toString(a))
+			return err == nil && i >= 0 && i < len(b.elems), nil
+		}
+		return nil, fmt.Errorf("cannot use 'in' on %s", typeOf(b))
+	}
+	v, err := arithmetic(x.op, a, b)
+	if err != nil {
+		return nil, err
+	}
+	return v, in.alloc(v)
+}
+
+func arithmetic(op string, a, b value) (value, error) {
+	if op == "+" {
+		a, b = toPrimitive(a), toPrimitive(b)
+		_, aString := a.(string)
+		_, bString := b.(string)
+		if aString || bString {
+			x, y := toString(a), toString(b)
+			if len(x)+len(y) > maxBytes {
+				return nil, errTooLarge
+			}
+			return x + y, nil
+		}
+	}
+	x, y := toNumber(a), toNumber(b)
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		return x / y, nil
+	case "%":
+		return math.Mod(x, y), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", op)
+}
+
+func compare(op string, a, b value) bool {
+	a, b = toPrimitive(a), toPrimitive(b)
+	as, aString := a.(string)
+	bs, bString := b.(string)
+	var c int
+	if aString && bString {
+		c = strings.Compare(as, bs)
+	} else {
+		x, y := toNumber(a), toNumber(b)
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return false
+		}
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	}
+	switch op {
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	}
+	return c >= 0
+}
+
+func (in *interp) evalCall(x *callExpr, s *scope) (value, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+	fn, err := in.eval(x.fn, s)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]value, len(x.args))
+	for i, arg := range x.args {
+		if args[i], err = in.eval(arg, s); err != nil {
+			return nil, err
+		}
+	}
+	// The arguments are charged as well, as push adds them to an array
+	// and closures get them as theirs.
+	if err := in.allocBytes(len(args) * elemSize); err != nil {
+		return nil, err
+	}
+	switch fn := fn.(type) {
+	case builtin:
+		v, err := fn(args)
+		if err != nil {
+			return nil, err
+		}
+		return v, in.alloc(v)
+	case *closure:
+		return in.call(fn, args)
+	}
+	return nil, fmt.Errorf("%s is not a function", describe(x.fn))
+}
+
+func (in *interp) call(c *closure, args []value) (value, error) {
+	if in.depth >= maxDepth {
+		return nil, errTooLong
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+	s := newScope(c.scope)
+	for i, name := range c.fn.params {
+		s.vars[name] = undefined
+		if i < len(args) {
+			s.vars[name] = args[i]
+		}
+	}
+	s.vars["arguments"] = &arrayValue{elems: args}
+	declare(c.fn.body, s)
+	ctl, v, err := in.execAll(c.fn.body, s)
+	if err != nil {
+		return nil, err
+	}
+	if ctl != returned {
+		return undefined, nil
+	}
+	return v, nil
+}
+
+// describe names a called expression in errors.
+func describe(x expr) string {
+	switch x := x.(type) {
+	case *ident:
+		return x.name
+	case *memberExpr:
+		return describe(x.x) + "." + x.name
+	}
+	return "expression"
+}
+
+func newObject() *objectValue {
+	return &objectValue{values: make(map[string]value)}
+}
+
+func (o *objectValue) set(key string, v value) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func getIndex(obj, index value) (value, error) {
+	if a, ok := obj.(*arrayValue); ok {
+		if i, ok := arrayIndex(index); ok {
+			if i < len(a.elems) {
+				return a.elems[i], nil
+			}
+			return undefined, nil
+		}
+	}
+	if str, ok := obj.(string); ok {
+		if i, ok := arrayIndex(index); ok {
+			if i < len(str) {
+				return str[i : i+1], nil
+			}
+			return undefined, nil
+		}
+	}
+	return getMember(obj, toString(index))
+}
+
+func (in *interp) setIndex(obj, index, v value) error {
+	switch obj := obj.(type) {
+	case *arrayValue:
+		i, ok := arrayIndex(index)
+		if !ok {
+			return fmt.Errorf("invalid array index %s", toString(index))
+		}
+		if grow := i + 1 - len(obj.elems); grow > 0 {
+			if grow > maxArrayGap {
+				return fmt.Errorf("array index %d is too far beyond the end of the array", i)
+			}
+			if err := in.stepN(grow); err != nil {
+				return err
+			}
+			if err := in.allocBytes(grow * elemSize); err != nil {
+				return err
+			}
+			for len(obj.elems) <= i {
+				obj.elems = append(obj.elems, undefined)
+			}
+		}
+		obj.elems[i] = v
+		return nil
+	case *objectValue:
+		key := toString(index)
+		if err := in.allocBytes(len(key) + elemSize); err != nil {
+			return err
+		}
+		obj.set(key, v)
+		return nil
+	}
+	return fmt.Errorf("cannot set property %s of %s", toString(index), typeOf(obj))
+}
+
+func arrayIndex(index value) (int, bool) {
+	n := toNumber(index)
+	if n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func truthy(v value) bool {
+	switch v := v.(type) {
+	case nil, undefinedValue:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func typeOf(v value) string {
+	switch v.(type) {
+	case undefinedValue:
+		return "undefined"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *closure, builtin:
+		return "function"
+	}
+	return "object"
+}
+
+// toPrimitive converts arrays and objects to strings, as + and comparisons
+// do.
+func toPrimitive(v value) value {
+	switch v.(type) {
+	case *arrayValue, *objectValue, *regexpValue, *closure, builtin:
+		return toString(v)
+	}
+	return v
+}
+
+func toNumber(v value) float64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0
+		}
+		if n, err := parseNumber(v); err == nil {
+			return n
+		}
+		return math.NaN()
+	case *arrayValue:
+		return toNumber(toString(v))
+	}
+	return math.NaN()
+}
+
+func toString(v value) string {
+	switch v := v.(type) {
+	case undefinedValue:
+		return "undefined"
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case *arrayValue:
+		return joinArray(v, ",")
+	case *regexpValue:
+		return "/" + v.re.String() + "/"
+	case *closure, builtin:
+		return "function"
+	}
+	return "[object Object]"
+}
+
+// joinArray converts the elements of a to strings and joins them with sep,
+// as Array.prototype.join does.
+//
+// Having no error result, it panics with errTooLarge when the strings it
+// builds, including those of nested arrays, grow beyond maxBytes or the
+// arrays are nested too deeply, which FindProxyForURL recovers.
+func joinArray(a *arrayValue, sep string) string {
+	return (&joiner{}).join(a, sep)
+}
+
+type joiner struct {
+	// seen holds the arrays being joined, which are joined as empty
+	// strings when nested in themselves.
+	seen    []*arrayValue
+	written int
+}
+
+func (j *joiner) join(a *arrayValue, sep string) string {
+	if slices.Contains(j.seen, a) {
+		return ""
+	}
+	if len(j.seen) >= maxDepth {
+		panic(errTooLarge)
+	}
+	j.seen = append(j.seen, a)
+	defer func() { j.seen = j.seen[:len(j.seen)-1] }()
+	var b strings.Builder
+	for i, e := range a.elems {
+		n := b.Len()
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		switch e := e.(type) {
+		case nil, undefinedValue:
+		case *arrayValue:
+			b.WriteString(j.join(e, ","))
+		default:
+			b.WriteString(toString(e))
+		}
+		if j.written += b.Len() - n; j.written > maxBytes {
+			panic(errTooLarge)
+		}
+	}
+	return b.String()
+}
+
+func strictEqual(a, b value) bool {
+	switch a := a.(type) {
+	case *arrayValue, *objectValue, *regexpValue, *closure:
+		return a == b
+	case builtin:
+		return false
+	case float64:
+		b, ok := b.(float64)
+		return ok && a == b
+	}
+	return a == b
+}
+
+func looseEqual(a, b value) bool {
+	isNullish := func(v value) bool { return v == nil || v == undefined }
+	switch {
+	case isNullish(a) || isNullish(b):
+		return isNullish(a) && isNullish(b)
+	case typeOf(a) == typeOf(b):
+		return strictEqual(a, b)
+	}
+	a, b = toPrimitive(a), toPrimitive(b)
+	if _, ok := a.(string); ok {
+		if _, ok := b.(string); ok {
+			return a == b
+		}
+	}
+	return toNumber(a) == toNumber(b)
+}
@@ -0,0 +1,267 @@
+package pac
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokRegexp
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	// text is the identifier, punctuator, unescaped string or regular
+	// expression source.
+	text string
+	// flags are the flags of a regular expression literal.
+	flags string
+	num   float64
+	line  int
+	// newline is set if a line break precedes the token, which ends a
+	// statement missing its semicolon.
+	newline bool
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of script"
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokRegexp:
+		return "/" + t.text + "/" + t.flags
+	}
+	return strconv.Quote(t.text)
+}
+
+// punctuators are the operators and delimiters understood, longest first.
+var punctuators = []string{
+	"===", "!==",
+	"==", "!=", "<=", ">=", "&&", "||", "++", "--", "+=", "-=", "*=", "/=", "%=",
+	"{", "}", "(", ")", "[", "]", ";", ",", ".", "<", ">", "+", "-", "*", "/", "%", "!", "?", ":", "=",
+}
+
+// keywordsBeforeExpr are the keywords after which a slash starts a regular
+// expression rather than a division.
+var keywordsBeforeExpr = map[string]bool{
+	"return": true, "typeof": true, "case": true, "in": true, "else": true, "new": true, "void": true,
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line, newline := 1, false
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			newline = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			comment := src[i : i+2+end+2]
+			if n := strings.Count(comment, "\n"); n > 0 {
+				line += n
+				newline = true
+			}
+			i += len(comment)
+			continue
+		case c >= utf8.RuneSelf:
+			// A non-breaking space or byte order mark is whitespace; other
+			// non-ASCII text only occurs in strings and comments.
+			r, size := utf8.DecodeRuneInString(src[i:])
+			if r != '\u00a0' && r != '\ufeff' && r != '\u2028' && r != '\u2029' {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, r)
+			}
+			i += size
+			continue
+		}
+
+		tok := token{line: line, newline: newline}
+		newline = false
+		switch {
+		case isIdentStart(c):
+			j := i
+			for j < len(src) && (isIdentStart(src[j]) || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tok.kind, tok.text = tokIdent, src[i:j]
+			i = j
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i
+			for j < len(src) && (isIdentStart(src[j]) || src[j] >= '0' && src[j] <= '9' || src[j] == '.' ||
+				(src[j] == '+' || src[j] == '-') && (src[j-1] == 'e' || src[j-1] == 'E') && !strings.HasPrefix(src[i:], "0x")) {
+				j++
+			}
+			n, err := parseNumber(src[i:j])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid number %q", line, src[i:j])
+			}
+			tok.kind, tok.text, tok.num = tokNumber, src[i:j], n
+			i = j
+		case c == '"' || c == '\'':
+			s, n, err := unquote(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			tok.kind, tok.text = tokString, s
+			i += n
+		case c == '/' && regexpAllowed(tokens):
+			source, flags, n, err := scanRegexp(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			tok.kind, tok.text, tok.flags = tokRegexp, source, flags
+			i += n
+		default:
+			for _, p := range punctuators {
+				if strings.HasPrefix(src[i:], p) {
+					tok.kind, tok.text = tokPunct, p
+					break
+				}
+			}
+			if tok.kind != tokPunct {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+			}
+			i += len(tok.text)
+		}
+		tokens = append(tokens, tok)
+	}
+	return append(tokens, token{kind: tokEOF, line: line, newline: true}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
+
+func parseNumber(s string) (float64, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		n, err := strconv.ParseUint(s[2:], 16, 64)
+		return float64(n), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// regexpAllowed reports whether a slash following tokens starts a regular
+// expression, i.e. whether an expression is expected there.
+func regexpAllowed(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	prev := tokens[len(tokens)-1]
+	switch prev.kind {
+	case tokNumber, tokString, tokRegexp:
+		return false
+	case tokIdent:
+		return keywordsBeforeExpr[prev.text]
+	}
+	return prev.text != ")" && prev.text != "]"
+}
+
+// unquote reads the string literal at the start of s and returns its value
+// and length.
+func unquote(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(s) {
+			break
+		}
+		switch e := s[i]; e {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case '0':
+			b.WriteByte(0)
+		case '\n':
+			// A line continuation.
+		case 'x', 'u':
+			size := 2
+			if e == 'u' {
+				size = 4
+			}
+			if i+size >= len(s) {
+				return "", 0, fmt.Errorf("invalid escape in string")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape in string")
+			}
+			b.WriteRune(rune(r))
+			i += size
+		default:
+			b.WriteByte(e)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// scanRegexp reads the regular expression literal at the start of s and
+// returns its source, flags and length.
+func scanRegexp(s string) (string, string, int, error) {
+	inClass := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return "", "", 0, fmt.Errorf("unterminated regular expression")
+		case '/':
+			if inClass {
+				continue
+			}
+			j := i + 1
+			for j < len(s) && isIdentStart(s[j]) {
+				j++
+			}
+			return s[1:i], s[i+1 : j], j, nil
+		}
+	}
+	return "", "", 0, fmt.Errorf("unterminated regular expression")
+}
@@ -0,0 +1,152 @@
+// Package pac evaluates proxy auto-config (PAC) files, the JavaScript
+// function FindProxyForURL(url, host) with which networks tell clients
+// which proxy to use for a destination.
+//
+// The interpreter covers the JavaScript PAC files are written in: functions,
+// var declarations, if, for, while and switch statements, the usual
+// operators, strings, arrays, objects and regular expressions, and the
+// standard PAC functions. Scripts relying on more (e.g. try/catch, Date or
+// dateRange) fail to parse or evaluate with an error.
+package pac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Script is a parsed PAC file. Its hooks may be set before the first call
+// to FindProxyForURL and are left alone afterwards, so that a Script can be
+// used from several goroutines.
+type Script struct {
+	prog []stmt
+
+	// Resolve returns an address of host, preferably IPv4, for dnsResolve,
+	// isResolvable and isInNet. It defaults to the system resolver.
+	Resolve func(host string) (string, bool)
+	// MyIPAddress returns the address of this host for myIpAddress. It
+	// defaults to the address of the interface with the default route.
+	MyIPAddress func() string
+	// Now returns the time for weekdayRange and timeRange.
+	Now func() time.Time
+	// Alert receives the messages of alert calls.
+	Alert func(message string)
+}
+
+// Parse parses the PAC file src, which must define FindProxyForURL.
+func Parse(src string) (*Script, error) {
+	prog, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if !defines(prog, "FindProxyForURL") {
+		return nil, errors.New("no FindProxyForURL function")
+	}
+	return &Script{prog: prog}, nil
+}
+
+// defines reports whether prog declares name at the top level.
+func defines(prog []stmt, name string) bool {
+	for _, st := range prog {
+		switch st := st.(type) {
+		case *funcDecl:
+			if st.name == name {
+				return true
+			}
+		case *varStmt:
+			for i, n := range st.names {
+				if _, ok := st.inits[i].(*funcLit); ok && n == name {
+					return true
+				}
+			}
+		case *exprStmt:
+			if a, ok := st.x.(*assignExpr); ok {
+				if id, ok := a.target.(*ident); ok && id.name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// FindProxyForURL runs the script for url and host and returns its result,
+// e.g. "PROXY proxy1:8080; PROXY proxy2:8080; DIRECT". Every call starts
+// from a fresh run of the script, so calls do not affect each other.
+func (s *Script) FindProxyForURL(url, host string) (_ string, err error) {
+	defer func() {
+		// Helpers without an error result panic with errTooLarge.
+		if r := recover(); r != nil {
+			if r != errTooLarge {
+				panic(r)
+			}
+			err = errTooLarge
+		}
+	}()
+	in := &interp{globals: s.globals()}
+	g := newScope(in.globals)
+	in.globals = g
+	declare(s.prog, g)
+	if _, _, err := in.execAll(s.prog, g); err != nil {
+		return "", err
+	}
+	fn, ok := g.vars["FindProxyForURL"].(*closure)
+	if !ok {
+		return "", errors.New("FindProxyForURL is not a function")
+	}
+	result, err := in.call(fn, []value{url, host})
+	if err != nil {
+		return "", err
+	}
+	switch result.(type) {
+	case string, nil, undefinedValue:
+	default:
+		return "", fmt.Errorf("FindProxyForURL returned %s instead of a string", typeOf(result))
+	}
+	if result == nil || result == undefined {
+		return "", nil
+	}
+	return result.(string), nil
+}
+
+// Proxy is an entry of the list FindProxyForURL returns.
+type Proxy struct {
+	// Type is DIRECT, PROXY, HTTP, HTTPS, SOCKS, SOCKS4 or SOCKS5.
+	Type string
+	// Addr is the host:port of the proxy, empty for DIRECT.
+	Addr string
+}
+
+func (p Proxy) String() string {
+	if p.Addr == "" {
+		return p.Type
+	}
+	return p.Type + " " + p.Addr
+}
+
+// ParseResult splits a FindProxyForURL result into its entries, to be
+// tried in order. An empty result means DIRECT; malformed entries are
+// skipped.
+func ParseResult(result string) []Proxy {
+	var proxies []Proxy
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		p := Proxy{Type: strings.ToUpper(fields[0])}
+		switch {
+		case p.Type == "DIRECT" && len(fields) == 1:
+		case p.Type != "DIRECT" && len(fields) == 2:
+			p.Addr = fields[1]
+		default:
+			continue
+		}
+		proxies = append(proxies, p)
+	}
+	if len(proxies) == 0 && strings.TrimSpace(result) == "" {
+		return []Proxy{{Type: "DIRECT"}}
+	}
+	return proxies
+}
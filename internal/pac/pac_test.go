@@ -0,0 +1,218 @@
+package pac
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const corporatePAC = `
+// Corporate proxy configuration.
+var proxies = "PROXY proxy1.corp:8080; PROXY proxy2.corp:8080";
+var bypass = ["*.intranet.corp", "build-??.corp", "localhost"];
+
+function isBypassed(host) {
+  for (var i = 0; i < bypass.length; i++) {
+    if (shExpMatch(host, bypass[i])) return true;
+  }
+  return false
+}
+
+function FindProxyForURL(url, host) {
+  host = host.toLowerCase();
+  if (isPlainHostName(host) || isBypassed(host))
+    return "DIRECT";
+  if (isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0"))
+    return "DIRECT";
+  if (dnsDomainIs(host, ".partner.example") && url.substring(0, 5) == "http:")
+    return "PROXY partner-gw.corp:3128";
+  if (/^(www\.)?video\./.test(host)) {
+    return "PROXY media.corp:8080; DIRECT";
+  }
+  switch (host) {
+    case "legacy.example":
+    case "old.example":
+      return "PROXY legacy.corp:80";
+  }
+  return proxies + "; DIRECT";
+}
+`
+
+func TestFindProxyForURL(t *testing.T) {
+	script, err := Parse(corporatePAC)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	script.Resolve = func(host string) (string, bool) {
+		switch host {
+		case "db.example":
+			return "10.1.2.3", true
+		case "api.example":
+			return "203.0.113.7", true
+		}
+		return "", false
+	}
+	tests := []struct {
+		url, host string
+		want      string
+	}{
+		{"http://wiki/", "wiki", "DIRECT"},
+		{"https://Portal.Intranet.Corp/", "Portal.Intranet.Corp", "DIRECT"},
+		{"https://build-07.corp/", "build-07.corp", "DIRECT"},
+		{"https://build-107.corp/", "build-107.corp", "PROXY proxy1.corp:8080; PROXY proxy2.corp:8080; DIRECT"},
+		{"https://db.example/", "db.example", "DIRECT"},
+		{"http://shop.partner.example/", "shop.partner.example", "PROXY partner-gw.corp:3128"},
+		{"https://shop.partner.example/", "shop.partner.example", "PROXY proxy1.corp:8080; PROXY proxy2.corp:8080; DIRECT"},
+		{"https://www.video.example/", "www.video.example", "PROXY media.corp:8080; DIRECT"},
+		{"https://old.example/", "old.example", "PROXY legacy.corp:80"},
+		{"https://api.example/", "api.example", "PROXY proxy1.corp:8080; PROXY proxy2.corp:8080; DIRECT"},
+	}
+	for _, tt := range tests {
+		if got, err := script.FindProxyForURL(tt.url, tt.host); err != nil || got != tt.want {
+			t.Errorf("FindProxyForURL(%q, %q) = %q, %v; expected %q", tt.url, tt.host, got, err, tt.want)
+		}
+	}
+}
+
+func TestJavaScriptSubset(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`return "a" + 1 + 2;`, "a12"},
+		{`return String(1 + 2 * 3 - 4 / 2);`, "5"},
+		{`var s = "a.b.c".split("."); return s.join("-") + s.length;`, "a-b-c3"},
+		{`return host.substr(-7) + "|" + host.slice(0, 3) + "|" + host.indexOf(".");`, "example|www|3"},
+		{`var n = 0; while (n < 5) { n++; if (n == 2) continue; if (n == 4) break; } return "" + n;`, "4"},
+		{`var m = {"a.example": "PROXY a:1"}; return m[host.substring(4)] || "DIRECT";`, "PROXY a:1"},
+		{`var m = {x: 1, y: 2}, keys = ""; for (var k in m) keys += k; return keys;`, "xy"},
+		{`return 1 == "1" && null == undefined && !(0 === "0") ? "loose" : "strict";`, "loose"},
+		{`return typeof nothing + typeof 1 + typeof "" + typeof null;`, "undefinednumberstringobject"},
+		{`var re = new RegExp("^WWW\\.", "i"); return re.test(host) ? "yes" : "no";`, "yes"},
+		{`return host.replace(/w/g, "v");`, "vvv.a.example"},
+		{`var f = function (x) { return x * 2; }; return "" + f(21);`, "42"},
+		{`return "" + parseInt("0x1f", 16) + parseInt("12px");`, "3112"},
+		{`var a = []; a.push("x"); a[2] = "z"; return a.join("/");`, "x//z"},
+		{`return [1, 2].indexOf(2) + "" + convert_addr("0.0.1.0");`, "1256"},
+		{`var a = [1]; a[1] = a; a[3] = [2, 3]; return a + "|" + Array(2).length;`, "1,,,2,3|2"},
+	}
+	for _, tt := range tests {
+		script, err := Parse("function FindProxyForURL(url, host) {\n" + tt.body + "\n}")
+		if err != nil {
+			t.Errorf("Parse(%s) error: %v", tt.body, err)
+			continue
+		}
+		if got, err := script.FindProxyForURL("https://www.a.example/", "www.a.example"); err != nil || got != tt.want {
+			t.Errorf("%s = %q, %v; expected %q", tt.body, got, err, tt.want)
+		}
+	}
+}
+
+func TestPACFunctions(t *testing.T) {
+	tests := []struct {
+		call string
+		want bool
+	}{
+		{`shExpMatch("http://a.example/x", "*.example/*")`, true},
+		{`shExpMatch("a.example", "?.example")`, true},
+		{`shExpMatch("ab.example", "?.example")`, false},
+		{`dnsDomainIs("www.example.com", ".example.com")`, true},
+		{`dnsDomainIs("www.example.org", ".example.com")`, false},
+		{`localHostOrDomainIs("www", "www.example.com")`, true},
+		{`localHostOrDomainIs("www.example.org", "www.example.com")`, false},
+		{`isInNet("192.168.1.20", "192.168.0.0", "255.255.0.0")`, true},
+		{`isInNet("192.169.1.20", "192.168.0.0", "255.255.0.0")`, false},
+		{`dnsDomainLevels("a.b.c") == 2`, true},
+		{`myIpAddress() == "10.9.8.7"`, true},
+		{`weekdayRange("MON", "FRI")`, true},
+		{`weekdayRange("SAT", "SUN")`, false},
+		{`timeRange(9, 17)`, true},
+		{`timeRange(22, 6)`, false},
+		{`timeRange(10, 30, 10, 31)`, true},
+	}
+	for _, tt := range tests {
+		script, err := Parse("function FindProxyForURL(url, host) { return " + tt.call + " ? \"yes\" : \"no\"; }")
+		if err != nil {
+			t.Fatalf("Parse(%s) error: %v", tt.call, err)
+		}
+		script.MyIPAddress = func() string { return "10.9.8.7" }
+		// A Wednesday.
+		script.Now = func() time.Time { return time.Date(2024, 5, 15, 10, 30, 45, 0, time.Local) }
+		got, err := script.FindProxyForURL("", "")
+		if err != nil || (got == "yes") != tt.want {
+			t.Errorf("%s = %q, %v; expected %v", tt.call, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`function Other() { return "DIRECT"; }`, "no FindProxyForURL"},
+		{`function FindProxyForURL(url, host) { return "DIRECT"`, "unexpected end of script"},
+		{`function FindProxyForURL(url, host) { try { return "DIRECT"; } catch (e) {} }`, "not supported"},
+		{"function FindProxyForURL(url, host) {\n  return 'DIRECT;\n}", "line 2: unterminated string"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v; expected %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestEvaluationErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`return undefinedFunction(host);`, "undefinedFunction is not defined"},
+		{`var x; return x.length;`, "cannot read property"},
+		{`while (true) {}`, "too long"},
+		{`function f() { return f(); } return f();`, "too long"},
+		{`return 42;`, "returned number"},
+		{`var s = "x"; for (var i = 0; i < 40; i++) { s = s + s; } return s;`, "too much memory"},
+		{`var s = "x"; for (var i = 0; i < 40; i++) { s += s; } return s;`, "too much memory"},
+		{`var s = "xxxxxxxxxx"; for (var i = 0; i < 10; i++) s = s.replace(/x/g, "$0$0$0$0$0$0$0$0$0$0"); return s;`, "too much memory"},
+		{`var a = ["x"]; for (var i = 0; i < 40; i++) a = [a, a]; return a + "";`, "too much memory"},
+		{`var a = []; for (var i = 0; i < 100000; i++) a.push("0123456789abcdef0123456789abcdef", a.join()); return "";`, "too much memory"},
+		{`var a = []; a[2147483647] = 1; return "DIRECT";`, "too far beyond the end"},
+		{`var a = Array(-1); return "DIRECT";`, "invalid array length"},
+	}
+	for _, tt := range tests {
+		script, err := Parse("function FindProxyForURL(url, host) {\n" + tt.body + "\n}")
+		if err != nil {
+			t.Fatalf("Parse(%s) error: %v", tt.body, err)
+		}
+		if _, err := script.FindProxyForURL("http://a/", "a"); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v; expected %q", tt.body, err, tt.want)
+		}
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	tests := []struct {
+		result string
+		want   []Proxy
+	}{
+		{"PROXY a:8080; PROXY b:8080; DIRECT", []Proxy{{"PROXY", "a:8080"}, {"PROXY", "b:8080"}, {"DIRECT", ""}}},
+		{"  proxy a:3128 ;socks5 s:1080", []Proxy{{"PROXY", "a:3128"}, {"SOCKS5", "s:1080"}}},
+		{"", []Proxy{{"DIRECT", ""}}},
+		{"PROXY; DIRECT", []Proxy{{"DIRECT", ""}}},
+		{"garbage", nil},
+	}
+	for _, tt := range tests {
+		got := ParseResult(tt.result)
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseResult(%q) = %v; expected %v", tt.result, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseResult(%q) = %v; expected %v", tt.result, got, tt.want)
+				break
+			}
+		}
+	}
+}
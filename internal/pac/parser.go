@@ -0,0 +1,767 @@
+package pac
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Statements.
+type (
+	stmt any
+
+	varStmt struct {
+		names []string
+		inits []expr
+	}
+	funcDecl struct {
+		name string
+		fn   *funcLit
+	}
+	ifStmt struct {
+		cond      expr
+		then, els stmt
+	}
+	returnStmt struct{ value expr }
+	blockStmt  struct{ body []stmt }
+	exprStmt   struct{ x expr }
+	forStmt    struct {
+		init stmt
+		cond expr
+		post expr
+		body stmt
+	}
+	forInStmt struct {
+		name string
+		x    expr
+		body stmt
+	}
+	whileStmt struct {
+		cond expr
+		body stmt
+	}
+	switchStmt struct {
+		x     expr
+		cases []switchCase
+	}
+	switchCase struct {
+		// match is nil for the default case.
+		match expr
+		body  []stmt
+	}
+	breakStmt    struct{}
+	continueStmt struct{}
+	emptyStmt    struct{}
+)
+
+// Expressions.
+type (
+	expr any
+
+	literal   struct{ v value }
+	ident     struct{ name string }
+	arrayLit  struct{ elems []expr }
+	objectLit struct {
+		keys   []string
+		values []expr
+	}
+	funcLit struct {
+		name   string
+		params []string
+		body   []stmt
+	}
+	unaryExpr struct {
+		op string
+		x  expr
+	}
+	binaryExpr struct {
+		op   string
+		x, y expr
+	}
+	condExpr struct {
+		cond, then, els expr
+	}
+	assignExpr struct {
+		// op is "=" or a compound assignment such as "+=".
+		op     string
+		target expr
+		value  expr
+	}
+	updateExpr struct {
+		// op is "++" or "--".
+		op     string
+		prefix bool
+		target expr
+	}
+	callExpr struct {
+		fn   expr
+		args []expr
+	}
+	memberExpr struct {
+		x    expr
+		name string
+	}
+	indexExpr struct {
+		x, index expr
+	}
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) ([]stmt, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	var prog []stmt
+	for p.peek().kind != tokEOF {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		prog = append(prog, s)
+	}
+	return prog, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuator or keyword text.
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokPunct || t.kind == tokIdent) && t.text == text
+}
+
+// accept consumes the next token if it is text.
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	return fmt.Errorf("line %d: unexpected %s", t.line, t)
+}
+
+func (p *parser) identifier() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent || reserved[t.text] {
+		return "", p.unexpected()
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// reserved are the keywords that cannot name a variable.
+var reserved = map[string]bool{
+	"var": true, "let": true, "const": true, "function": true, "if": true, "else": true,
+	"return": true, "for": true, "while": true, "do": true, "break": true, "continue": true,
+	"switch": true, "case": true, "default": true, "in": true, "typeof": true, "new": true,
+	"true": true, "false": true, "null": true, "void": true, "try": true, "catch": true, "throw": true,
+}
+
+// endStatement consumes the semicolon ending a statement, which may be left
+// out before a closing brace, the end of the script or a line break.
+func (p *parser) endStatement() error {
+	if p.accept(";") || p.is("}") || p.peek().kind == tokEOF || p.peek().newline {
+		return nil
+	}
+	return p.unexpected()
+}
+
+func (p *parser) statement() (stmt, error) {
+	t := p.peek()
+	if t.kind == tokPunct {
+		switch t.text {
+		case "{":
+			return p.block()
+		case ";":
+			p.pos++
+			return &emptyStmt{}, nil
+		}
+	}
+	if t.kind != tokIdent {
+		return p.expressionStatement()
+	}
+	switch t.text {
+	case "var", "let", "const":
+		s, err := p.varDeclaration()
+		if err != nil {
+			return nil, err
+		}
+		return s, p.endStatement()
+	case "function":
+		p.pos++
+		fn, err := p.function()
+		if err != nil {
+			return nil, err
+		}
+		if fn.name == "" {
+			return nil, fmt.Errorf("line %d: function without a name", t.line)
+		}
+		return &funcDecl{name: fn.name, fn: fn}, nil
+	case "if":
+		p.pos++
+		cond, err := p.parenExpression()
+		if err != nil {
+			return nil, err
+		}
+		s := &ifStmt{cond: cond}
+		if s.then, err = p.statement(); err != nil {
+			return nil, err
+		}
+		if p.accept("else") {
+			if s.els, err = p.statement(); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case "return":
+		p.pos++
+		s := &returnStmt{}
+		if !p.is(";") && !p.is("}") && p.peek().kind != tokEOF && !p.peek().newline {
+			var err error
+			if s.value, err = p.expression(); err != nil {
+				return nil, err
+			}
+		}
+		return s, p.endStatement()
+	case "for":
+		p.pos++
+		return p.forStatement()
+	case "while":
+		p.pos++
+		cond, err := p.parenExpression()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		return &whileStmt{cond: cond, body: body}, nil
+	case "switch":
+		p.pos++
+		return p.switchStatement()
+	case "break":
+		p.pos++
+		return &breakStmt{}, p.endStatement()
+	case "continue":
+		p.pos++
+		return &continueStmt{}, p.endStatement()
+	case "do", "try", "catch", "throw", "with", "class":
+		return nil, fmt.Errorf("line %d: %q statements are not supported", t.line, t.text)
+	}
+	return p.expressionStatement()
+}
+
+func (p *parser) expressionStatement() (stmt, error) {
+	x, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &exprStmt{x: x}, p.endStatement()
+}
+
+func (p *parser) block() (*blockStmt, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	b := &blockStmt{}
+	for !p.accept("}") {
+		if p.peek().kind == tokEOF {
+			return nil, p.unexpected()
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		b.body = append(b.body, s)
+	}
+	return b, nil
+}
+
+func (p *parser) varDeclaration() (*varStmt, error) {
+	p.pos++
+	s := &varStmt{}
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		var init expr
+		if p.accept("=") {
+			if init, err = p.assignment(); err != nil {
+				return nil, err
+			}
+		}
+		s.names, s.inits = append(s.names, name), append(s.inits, init)
+		if !p.accept(",") {
+			return s, nil
+		}
+	}
+}
+
+func (p *parser) forStatement() (stmt, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	// for (var name in x) and for (name in x)
+	declared := p.is("var") || p.is("let") || p.is("const")
+	n := 0
+	if declared {
+		n = 1
+	}
+	if p.peekAt(n).kind == tokIdent && p.peekAt(n+1).text == "in" {
+		p.pos += n
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		x, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		body, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		return &forInStmt{name: name, x: x, body: body}, nil
+	}
+
+	s := &forStmt{}
+	var err error
+	switch {
+	case declared:
+		s.init, err = p.varDeclaration()
+	case !p.is(";"):
+		var x expr
+		x, err = p.expression()
+		s.init = &exprStmt{x: x}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	if !p.is(";") {
+		if s.cond, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	if !p.is(")") {
+		if s.post, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if s.body, err = p.statement(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *parser) switchStatement() (stmt, error) {
+	x, err := p.parenExpression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	s := &switchStmt{x: x}
+	for !p.accept("}") {
+		var c switchCase
+		switch {
+		case p.accept("case"):
+			if c.match, err = p.expression(); err != nil {
+				return nil, err
+			}
+		case p.accept("default"):
+		default:
+			return nil, p.unexpected()
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		for !p.is("case") && !p.is("default") && !p.is("}") {
+			if p.peek().kind == tokEOF {
+				return nil, p.unexpected()
+			}
+			body, err := p.statement()
+			if err != nil {
+				return nil, err
+			}
+			c.body = append(c.body, body)
+		}
+		s.cases = append(s.cases, c)
+	}
+	return s, nil
+}
+
+// function parses a function after the function keyword.
+func (p *parser) function() (*funcLit, error) {
+	fn := &funcLit{}
+	if p.peek().kind == tokIdent && !p.is("(") {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		fn.name = name
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.accept(")") {
+		if len(fn.params) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		fn.params = append(fn.params, name)
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	fn.body = body.body
+	return fn, nil
+}
+
+func (p *parser) parenExpression() (expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	x, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return x, p.expect(")")
+}
+
+// expression parses a comma-separated sequence, which evaluates to its last
+// expression.
+func (p *parser) expression() (expr, error) {
+	x, err := p.assignment()
+	for err == nil && p.accept(",") {
+		var y expr
+		y, err = p.assignment()
+		x = &binaryExpr{op: ",", x: x, y: y}
+	}
+	return x, err
+}
+
+func (p *parser) assignment() (expr, error) {
+	x, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "+=", "-=", "*=", "/=", "%="} {
+		if p.accept(op) {
+			switch x.(type) {
+			case *ident, *memberExpr, *indexExpr:
+			default:
+				return nil, fmt.Errorf("line %d: invalid assignment target", p.peek().line)
+			}
+			value, err := p.assignment()
+			if err != nil {
+				return nil, err
+			}
+			return &assignExpr{op: op, target: x, value: value}, nil
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) conditional() (expr, error) {
+	cond, err := p.binary(0)
+	if err != nil || !p.accept("?") {
+		return cond, err
+	}
+	then, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	return &condExpr{cond: cond, then: then, els: els}, nil
+}
+
+// binaryLevels are the binary operators from lowest to highest precedence.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"===", "!==", "==", "!="},
+	{"<=", ">=", "<", ">", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	x, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range binaryLevels[level] {
+			if p.is(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	for _, op := range []string{"!", "-", "+", "typeof", "void"} {
+		if p.accept(op) {
+			x, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &unaryExpr{op: op, x: x}, nil
+		}
+	}
+	for _, op := range []string{"++", "--"} {
+		if p.accept(op) {
+			x, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &updateExpr{op: op, prefix: true, target: x}, nil
+		}
+	}
+	x, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"++", "--"} {
+		if !p.peek().newline && p.accept(op) {
+			return &updateExpr{op: op, target: x}, nil
+		}
+	}
+	return x, nil
+}
+
+// postfix parses a primary expression followed by calls, property accesses
+// and indexing.
+func (p *parser) postfix() (expr, error) {
+	// new only applies to the built-in constructors, which work the same
+	// when called without it.
+	p.accept("new")
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("line %d: unexpected %s", t.line, t)
+			}
+			x = &memberExpr{x: x, name: t.text}
+		case p.accept("["):
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexExpr{x: x, index: index}
+		case p.accept("("):
+			call := &callExpr{fn: x}
+			for !p.accept(")") {
+				if len(call.args) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				arg, err := p.assignment()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+			}
+			x = call
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literal{v: t.num}, nil
+	case tokString:
+		return &literal{v: t.text}, nil
+	case tokRegexp:
+		return compileRegexp(t)
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literal{v: true}, nil
+		case "false":
+			return &literal{v: false}, nil
+		case "null":
+			return &literal{v: nil}, nil
+		case "function":
+			return p.function()
+		}
+		if reserved[t.text] {
+			return nil, fmt.Errorf("line %d: unexpected %s", t.line, t)
+		}
+		return &ident{name: t.text}, nil
+	case tokPunct:
+		switch t.text {
+		case "(":
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			a := &arrayLit{}
+			for !p.accept("]") {
+				if len(a.elems) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+					if p.accept("]") {
+						break
+					}
+				}
+				elem, err := p.assignment()
+				if err != nil {
+					return nil, err
+				}
+				a.elems = append(a.elems, elem)
+			}
+			return a, nil
+		case "{":
+			return p.object()
+		}
+	}
+	return nil, fmt.Errorf("line %d: unexpected %s", t.line, t)
+}
+
+func (p *parser) object() (expr, error) {
+	o := &objectLit{}
+	for !p.accept("}") {
+		if len(o.keys) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.accept("}") {
+				break
+			}
+		}
+		t := p.next()
+		var key string
+		switch t.kind {
+		case tokIdent, tokString:
+			key = t.text
+		case tokNumber:
+			key = toString(t.num)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %s", t.line, t)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		o.keys, o.values = append(o.keys, key), append(o.values, v)
+	}
+	return o, nil
+}
+
+// compileRegexp translates a regular expression literal to Go syntax, which
+// agrees with JavaScript for the patterns PAC files use.
+func compileRegexp(t token) (expr, error) {
+	re, err := newRegexp(t.text, t.flags)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", t.line, err)
+	}
+	return &literal{v: re}, nil
+}
+
+func newRegexp(source, flags string) (*regexpValue, error) {
+	prefix := ""
+	if strings.Contains(flags, "i") {
+		prefix = "(?i)"
+	}
+	re, err := regexp.Compile(prefix + source)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported regular expression /%s/: %v", source, err)
+	}
+	return &regexpValue{re: re, global: strings.Contains(flags, "g")}, nil
+}
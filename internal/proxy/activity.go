@@ -0,0 +1,439 @@
+package proxy
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/geoip"
+)
+
+const recentActivitySize = 200
+
+// ConnInfo describes a proxied HTTP request or CONNECT tunnel.
+type ConnInfo struct {
+	ID       uint64        `json:"id"`
+	Kind     string        `json:"kind"`
+	Client   string        `json:"client"`
+	Method   string        `json:"method"`
+	Host     string        `json:"host"`
+	Route    string        `json:"route"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// BytesSent counts bytes from the client to the destination and
+	// BytesReceived bytes from the destination to the client.
+	BytesSent     int64 `json:"bytesSent"`
+	BytesReceived int64 `json:"bytesReceived"`
+	// Destination is the address connected to, the destination itself or
+	// an upstream, and SNI the server name a tunnel's TLS client asked for.
+	Destination string `json:"destination,omitempty"`
+	SNI         string `json:"sni,omitempty"`
+	// Upstream is the configured upstream that carried the connection.
+	Upstream string `json:"upstream,omitempty"`
+	// Setup is how long it took to get the response headers, or to
+	// establish the tunnel.
+	Setup time.Duration `json:"setup,omitempty"`
+	// JA3 and JA4 fingerprint the TLS client of a tunnel by its ClientHello.
+	JA3 string `json:"ja3,omitempty"`
+	JA4 string `json:"ja4,omitempty"`
+	// Country and ASN locate the destination host when GEOIP_DB is set.
+	Country string `json:"country,omitempty"`
+	ASN     uint32 `json:"asn,omitempty"`
+	// Threat names the THREAT_FEEDS feed listing the destination.
+	Threat string `json:"threat,omitempty"`
+	// App is the executable of the local client process when APP_ROUTES
+	// is set.
+	App string `json:"app,omitempty"`
+}
+
+// ConnEvent reports that a connection started or finished.
+type ConnEvent struct {
+	Type string   `json:"type"`
+	Conn ConnInfo `json:"conn"`
+}
+
+const (
+	ConnStarted  = "started"
+	ConnFinished = "finished"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber. Events
+// for subscribers that fall further behind are dropped.
+const subscriberBuffer = 256
+
+// Activity keeps track of in-flight connections and a bounded history of
+// recently completed ones.
+type Activity struct {
+	mu          sync.Mutex
+	nextID      uint64
+	active      map[uint64]*trackedConn
+	recent      []ConnInfo
+	head        int
+	subscribers map[chan ConnEvent]struct{}
+}
+
+type trackedConn struct {
+	mu      sync.Mutex
+	info    ConnInfo
+	cancel  context.CancelFunc
+	closers []io.Closer
+
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+type trackedConnKey struct{}
+
+func NewActivity() *Activity {
+	return &Activity{
+		active:      map[uint64]*trackedConn{},
+		recent:      make([]ConnInfo, 0, recentActivitySize),
+		subscribers: map[chan ConnEvent]struct{}{},
+	}
+}
+
+// Subscribe returns a channel receiving connection events until cancel is called.
+func (a *Activity) Subscribe() (events <-chan ConnEvent, cancel func()) {
+	ch := make(chan ConnEvent, subscriberBuffer)
+	a.mu.Lock()
+	a.subscribers[ch] = struct{}{}
+	a.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			a.mu.Lock()
+			delete(a.subscribers, ch)
+			a.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish must be called with a.mu held.
+func (a *Activity) publish(event ConnEvent) {
+	for ch := range a.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Active returns the in-flight connections, oldest first.
+func (a *Activity) Active() []ConnInfo {
+	a.mu.Lock()
+	conns := make([]ConnInfo, 0, len(a.active))
+	for _, c := range a.active {
+		conns = append(conns, c.snapshot())
+	}
+	a.mu.Unlock()
+
+	slices.SortFunc(conns, func(x, y ConnInfo) int { return cmp.Compare(x.ID, y.ID) })
+	return conns
+}
+
+// Recent returns recently completed connections, newest first.
+func (a *Activity) Recent() []ConnInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make([]ConnInfo, 0, len(a.recent))
+	for i := range a.recent {
+		idx := (a.head - 1 - i + len(a.recent)) % len(a.recent)
+		out = append(out, a.recent[idx])
+	}
+	return out
+}
+
+func (a *Activity) begin(req *http.Request) (*trackedConn, *http.Request) {
+	kind := "http"
+	if req.Method == http.MethodConnect {
+		kind = "tunnel"
+	}
+
+	a.mu.Lock()
+	a.nextID++
+	c := &trackedConn{info: ConnInfo{
+		ID:      a.nextID,
+		Kind:    kind,
+		Client:  req.RemoteAddr,
+		Method:  req.Method,
+		Host:    req.Host,
+		Started: time.Now(),
+	}}
+	a.active[c.info.ID] = c
+	a.publish(ConnEvent{Type: ConnStarted, Conn: c.info})
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithValue(req.Context(), trackedConnKey{}, c))
+	c.cancel = cancel
+	req = req.WithContext(ctx)
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingReadCloser{ReadCloser: req.Body, n: &c.sent}
+	}
+	return c, req
+}
+
+// Terminate aborts the in-flight request or tunnel with the given ID. It
+// reports whether such a connection was found.
+func (a *Activity) Terminate(id uint64) bool {
+	a.mu.Lock()
+	c, ok := a.active[id]
+	a.mu.Unlock()
+	if !ok {
+		return false
+	}
+	c.close()
+	return true
+}
+
+func (a *Activity) end(c *trackedConn) ConnInfo {
+	c.cancel()
+	info := c.snapshot()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.active, info.ID)
+	if len(a.recent) < recentActivitySize {
+		a.recent = append(a.recent, info)
+	} else {
+		a.recent[a.head] = info
+	}
+	a.head = (a.head + 1) % recentActivitySize
+	a.publish(ConnEvent{Type: ConnFinished, Conn: info})
+	return info
+}
+
+func trackedConnFrom(req *http.Request) *trackedConn {
+	c, _ := req.Context().Value(trackedConnKey{}).(*trackedConn)
+	return c
+}
+
+func (c *trackedConn) snapshot() ConnInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := c.info
+	info.Duration = time.Since(info.Started)
+	info.BytesSent = c.sent.Load()
+	info.BytesReceived = c.received.Load()
+	return info
+}
+
+// close cancels the request context and closes all attached connections.
+func (c *trackedConn) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	closers := c.closers
+	c.mu.Unlock()
+	c.cancel()
+	for _, closer := range closers {
+		_ = closer.Close()
+	}
+}
+
+// attach registers connections to be closed when the tracked connection is
+// terminated.
+func (c *trackedConn) attach(closers ...io.Closer) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.closers = append(c.closers, closers...)
+	c.mu.Unlock()
+}
+
+// countSent wraps the client side of a tunnel so that bytes read from it are
+// counted as sent.
+func (c *trackedConn) countSent(conn net.Conn) net.Conn {
+	if c == nil {
+		return conn
+	}
+	return &countingConn{Conn: conn, n: &c.sent}
+}
+
+// countReceived wraps the destination side of a tunnel so that bytes read
+// from it are counted as received.
+func (c *trackedConn) countReceived(conn net.Conn) net.Conn {
+	if c == nil {
+		return conn
+	}
+	return &countingConn{Conn: conn, n: &c.received}
+}
+
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// NetConn returns the wrapped connection.
+func (c *countingConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// The setters below are no-ops on a nil receiver so that the exported
+// handler functions keep working when called outside of a Server.
+
+func (c *trackedConn) setRoute(route string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Route = route
+	c.mu.Unlock()
+}
+
+func (c *trackedConn) setStatus(status int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Status = status
+	c.mu.Unlock()
+}
+
+func (c *trackedConn) setDestination(addr string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Destination = addr
+	c.mu.Unlock()
+}
+
+func (c *trackedConn) setUpstream(addr string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Upstream = addr
+	c.mu.Unlock()
+}
+
+// setupDone records that the response headers arrived or the tunnel was
+// established.
+func (c *trackedConn) setupDone() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Setup = time.Since(c.info.Started)
+	c.mu.Unlock()
+}
+
+func (c *trackedConn) setGeo(geo geoip.Record) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Country, c.info.ASN = geo.Country, geo.ASN
+	c.mu.Unlock()
+}
+
+func (c *trackedConn) setThreat(feed string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Threat = feed
+	c.mu.Unlock()
+}
+
+func (c *trackedConn) setApp(app string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.App = app
+	c.mu.Unlock()
+}
+
+func (c *trackedConn) setClientHello(hello clientHelloInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.SNI = hello.serverName
+	c.info.JA3 = hello.ja3
+	c.info.JA4 = hello.ja4
+	info := c.info
+	c.mu.Unlock()
+	if hello.ja3 != "" && requestLogs.sample() {
+		Info.Printf("TLS client %s to %s: SNI %q, JA3 %s, JA4 %s", logClient(info.Client), info.Host, hello.serverName, hello.ja3, hello.ja4)
+	}
+}
+
+func (c *trackedConn) setError(err error) {
+	if c == nil || err == nil {
+		return
+	}
+	c.mu.Lock()
+	c.info.Error = err.Error()
+	c.mu.Unlock()
+}
+
+// statusRecorder captures the status code written by a handler while still
+// allowing the connection to be hijacked for tunnels.
+type statusRecorder struct {
+	http.ResponseWriter
+	conn *trackedConn
+
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.wroteHeader = true
+	r.conn.setStatus(status)
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.conn.received.Add(int64(n))
+	return n, err
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	r.hijacked = true
+	return hj.Hijack()
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// affinityDirect pins a host to a direct connection after it failed open.
+const affinityDirect = ""
+
+// affinity remembers the route each host last took successfully, so that
+// for ROUTE_AFFINITY_TTL its requests keep taking it instead of flapping
+// between upstreams as their health changes. It outlives configuration
+// reloads; pins to upstreams no longer configured are ignored.
+type affinity struct {
+	mu   sync.Mutex
+	pins map[string]routePin
+	now  func() time.Time
+}
+
+type routePin struct {
+	upstream string
+	expires  time.Time
+}
+
+func newAffinity() *affinity {
+	return &affinity{pins: make(map[string]routePin), now: time.Now}
+}
+
+// pinned returns the route host is pinned to, if any.
+func (a *affinity) pinned(host string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := hostName(host)
+	pin, ok := a.pins[key]
+	if ok && !a.now().Before(pin.expires) {
+		delete(a.pins, key)
+		return "", false
+	}
+	return pin.upstream, ok
+}
+
+// pin records that host was reached through upstream, or directly if
+// upstream is affinityDirect. An existing pin is kept until it expires.
+func (a *affinity) pin(host, upstream string, cfg config.Config) {
+	if a == nil || cfg.RouteAffinityTTL <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := hostName(host)
+	now := a.now()
+	if pin, ok := a.pins[key]; ok && now.Before(pin.expires) {
+		return
+	}
+	a.pins[key] = routePin{upstream: upstream, expires: now.Add(cfg.RouteAffinityTTL)}
+	// Drop expired pins now and then, so hosts seen once do not pile up.
+	if len(a.pins)%1024 == 0 {
+		for k, pin := range a.pins {
+			if !now.Before(pin.expires) {
+				delete(a.pins, k)
+			}
+		}
+	}
+}
+
+// preferredFor returns the upstreams in the order host's requests try them:
+// the one host is pinned to first, then as preferred.
+func (t requestTransports) preferredFor(host string, cfg config.Config) []upstreamTransport {
+	upstreams := t.preferred()
+	if cfg.RouteAffinityTTL <= 0 {
+		return upstreams
+	}
+	pinned, ok := t.affinity.pinned(host)
+	if !ok {
+		return upstreams
+	}
+	if i := slices.IndexFunc(upstreams, func(u upstreamTransport) bool { return u.addr == pinned }); i > 0 {
+		u := upstreams[i]
+		upstreams = slices.Insert(slices.Delete(upstreams, i, i+1), 0, u)
+	}
+	return upstreams
+}
+
+// pinnedDirect reports whether host failed open earlier and should keep
+// going direct without trying the upstreams first.
+func (t requestTransports) pinnedDirect(host string, cfg config.Config) bool {
+	if cfg.RouteAffinityTTL <= 0 || !canFailOpen(host, cfg) {
+		return false
+	}
+	pinned, ok := t.affinity.pinned(host)
+	return ok && pinned == affinityDirect
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestAffinity(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RouteAffinityTTL = time.Minute
+	cfg.FailOpen = true
+
+	now := time.Unix(1700000000, 0)
+	a := newAffinity()
+	a.now = func() time.Time { return now }
+	transports := requestTransports{
+		upstreams: []upstreamTransport{{addr: "a:8080"}, {addr: "b:8080"}, {addr: "c:8080"}},
+		affinity:  a,
+	}
+	first := func(host string) string {
+		return transports.preferredFor(host, cfg)[0].addr
+	}
+
+	if got := first("example.com:443"); got != "a:8080" {
+		t.Fatalf("unpinned host starts with %s, want a:8080", got)
+	}
+	a.pin("example.com:443", "c:8080", cfg)
+	if got := first("example.com"); got != "c:8080" {
+		t.Fatalf("pinned host starts with %s, want c:8080", got)
+	}
+	if got := len(transports.preferredFor("example.com", cfg)); got != 3 {
+		t.Fatalf("pinned host tries %d upstreams, want 3", got)
+	}
+	if got := first("other.example"); got != "a:8080" {
+		t.Errorf("other host starts with %s, want a:8080", got)
+	}
+
+	// A later success elsewhere does not move the pin before it expires.
+	a.pin("example.com", "b:8080", cfg)
+	if got := first("example.com"); got != "c:8080" {
+		t.Errorf("pin moved to %s before expiring", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := first("example.com"); got != "a:8080" {
+		t.Errorf("expired pin still starts with %s", got)
+	}
+
+	a.pin("direct.example", affinityDirect, cfg)
+	if !transports.pinnedDirect("direct.example:443", cfg) {
+		t.Error("host pinned direct is not pinnedDirect")
+	}
+	if transports.pinnedDirect("example.com", cfg) {
+		t.Error("unpinned host is pinnedDirect")
+	}
+	noFailOpen := cfg
+	noFailOpen.FailOpen = false
+	if transports.pinnedDirect("direct.example", noFailOpen) {
+		t.Error("host pinned direct without FAIL_OPEN")
+	}
+
+	disabled := cfg
+	disabled.RouteAffinityTTL = 0
+	a.pin("new.example", "b:8080", disabled)
+	if _, ok := a.pinned("new.example"); ok {
+		t.Error("host pinned with ROUTE_AFFINITY_TTL=0")
+	}
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// processAnonymizeKey keys the pseudonyms of ANONYMIZE=hash when no
+// ANONYMIZE_KEY is set, so they are stable only for the life of the process.
+var processAnonymizeKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}()
+
+// urlPattern matches URLs in log text, capturing the scheme, user info,
+// the rest of the authority and path, and the query and fragment.
+var urlPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)([^/\s"'@]*@)?([^\s"'?#]*)([?#][^\s"']*)?`)
+
+// anonymizer removes personal data from what a log sink records: client
+// addresses and user names, and the user info and query of URLs. A nil
+// anonymizer leaves everything as it is.
+type anonymizer struct {
+	mode string
+	key  []byte
+}
+
+func newAnonymizer(mode, key string) *anonymizer {
+	if mode != config.AnonymizeTruncate && mode != config.AnonymizeHash {
+		return nil
+	}
+	a := &anonymizer{mode: mode, key: processAnonymizeKey}
+	if key != "" {
+		a.key = []byte(key)
+	}
+	return a
+}
+
+// client anonymizes a client address (with or without port) or user name.
+// Truncating keeps the network of an address, /24 for IPv4 and /48 for
+// IPv6, and drops user names; hashing replaces either with a pseudonym.
+func (a *anonymizer) client(client string) string {
+	if a == nil || client == "" {
+		return client
+	}
+	host := client
+	if h, _, err := net.SplitHostPort(client); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	switch {
+	case a.mode == config.AnonymizeHash:
+		mac := hmac.New(sha256.New, a.key)
+		mac.Write([]byte(host))
+		return "anon-" + hex.EncodeToString(mac.Sum(nil)[:6])
+	case err != nil:
+		return "user"
+	case addr.Unmap().Is4():
+		return netip.PrefixFrom(addr.Unmap(), 24).Masked().Addr().String()
+	default:
+		return netip.PrefixFrom(addr.WithZone(""), 48).Masked().Addr().String()
+	}
+}
+
+// text strips the user info, query and fragment of the URLs in s, as found
+// in the errors of HTTP requests.
+func (a *anonymizer) text(s string) string {
+	if a == nil {
+		return s
+	}
+	return urlPattern.ReplaceAllString(s, "$1$3")
+}
+
+// logAnonymizer applies LOG_ANONYMIZE to the Info, Warn and Error logs and
+// to webhook messages.
+var logAnonymizer atomic.Pointer[anonymizer]
+
+// logClient returns client as the logs may show it.
+func logClient(client string) string {
+	return logAnonymizer.Load().client(client)
+}
+
+// logError returns err as the logs may show it.
+func logError(err error) any {
+	a := logAnonymizer.Load()
+	if a == nil || err == nil {
+		return err
+	}
+	return a.text(err.Error())
+}
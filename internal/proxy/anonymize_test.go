@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestAnonymizerClient(t *testing.T) {
+	truncate := newAnonymizer(config.AnonymizeTruncate, "")
+	hash := newAnonymizer(config.AnonymizeHash, "secret")
+
+	tests := []struct {
+		client   string
+		truncate string
+	}{
+		{"192.0.2.171:51544", "192.0.2.0"},
+		{"192.0.2.171", "192.0.2.0"},
+		{"[2001:db8:aaaa:bbbb::1]:443", "2001:db8:aaaa::"},
+		{"[::ffff:192.0.2.171]:80", "192.0.2.0"},
+		{"alice", "user"},
+	}
+	for _, tt := range tests {
+		if got := truncate.client(tt.client); got != tt.truncate {
+			t.Errorf("truncate %q = %q; expected %q", tt.client, got, tt.truncate)
+		}
+		got := hash.client(tt.client)
+		if !strings.HasPrefix(got, "anon-") || strings.Contains(got, tt.truncate) {
+			t.Errorf("hash %q = %q; expected a pseudonym", tt.client, got)
+		}
+	}
+	if hash.client("192.0.2.171:1") != hash.client("192.0.2.171:2") {
+		t.Error("hash pseudonym depends on the port")
+	}
+	if hash.client("192.0.2.171") == newAnonymizer(config.AnonymizeHash, "other").client("192.0.2.171") {
+		t.Error("hash pseudonym does not depend on ANONYMIZE_KEY")
+	}
+
+	off := newAnonymizer(config.AnonymizeOff, "")
+	if got := off.client("192.0.2.171:51544"); got != "192.0.2.171:51544" {
+		t.Errorf("off = %q; expected the client unchanged", got)
+	}
+}
+
+func TestAnonymizerText(t *testing.T) {
+	a := newAnonymizer(config.AnonymizeTruncate, "")
+	in := `Get "http://alice@example.com/search?q=private#top": dial tcp 192.0.2.1:80: connection refused`
+	want := `Get "http://example.com/search": dial tcp 192.0.2.1:80: connection refused`
+	if got := a.text(in); got != want {
+		t.Errorf("text = %q; expected %q", got, want)
+	}
+}
+
+func TestFlowLogAnonymized(t *testing.T) {
+	var buf bytes.Buffer
+	l := &flowLog{w: &buf}
+	l.write(ConnInfo{Client: "192.0.2.171:51544", Host: "example.com", Error: `Get "http://example.com/?token=x": EOF`},
+		newAnonymizer(config.AnonymizeTruncate, ""))
+
+	var record flowRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Client != "192.0.2.0" || strings.Contains(record.Error, "token") {
+		t.Errorf("flow record = %+v; expected the client truncated and the query stripped", record)
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// errAppLookupUnsupported is returned by processOwning on platforms where
+// the process behind a connection cannot be found.
+var errAppLookupUnsupported = errors.New("finding the process of a connection is not supported on this platform")
+
+type connOwnerKey struct{}
+
+// connOwner finds the local process that opened a client connection, once
+// per connection and only when asked, as that means searching the process
+// table.
+type connOwner struct {
+	conn net.Conn
+
+	once sync.Once
+	app  string
+}
+
+// withConnOwner is the ConnContext of the proxy's HTTP servers.
+func withConnOwner(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connOwnerKey{}, &connOwner{conn: c})
+}
+
+// appOf returns the executable name of the local process that sent req, or
+// "" if it came from another host or cannot be found.
+func appOf(req *http.Request) string {
+	owner, ok := req.Context().Value(connOwnerKey{}).(*connOwner)
+	if !ok {
+		return ""
+	}
+	owner.once.Do(func() {
+		client, ok1 := owner.conn.RemoteAddr().(*net.TCPAddr)
+		server, ok2 := owner.conn.LocalAddr().(*net.TCPAddr)
+		if !ok1 || !ok2 || !client.IP.IsLoopback() && !client.IP.Equal(server.IP) {
+			return
+		}
+		exe, err := processOwning(client, server)
+		if err != nil {
+			Warn.Printf("Failed to find the application of client %s: %v", client, err)
+			return
+		}
+		owner.app = strings.TrimSuffix(strings.ToLower(filepath.Base(exe)), ".exe")
+	})
+	return owner.app
+}
+
+// withApp applies APP_ROUTES to req: it answers requests of blocked
+// applications with 403 Forbidden, returning false, and otherwise returns t
+// with the route of the application, if any.
+func (t requestTransports) withApp(w http.ResponseWriter, req *http.Request, cfg config.Config) (requestTransports, bool) {
+	if len(cfg.AppRoutes) == 0 {
+		return t, true
+	}
+	app := appOf(req)
+	if app == "" {
+		return t, true
+	}
+	trackedConnFrom(req).setApp(app)
+	route, ok := appRoute(app, cfg)
+	if !ok {
+		return t, true
+	}
+	if route == config.AppRouteBlock {
+		Warn.Printf("Blocked %s %s from %s: application %s", req.Method, req.Host, logClient(usageClient(req)), app)
+		t.decisions.decide(w, routeBlocked, "app:"+app, cfg)
+		w.Header().Set(ErrorHeader, "app-blocked")
+		http.Error(w, "Application blocked", http.StatusForbidden)
+		return t, false
+	}
+	t.appRoute, t.app = route, app
+	return t, true
+}
+
+// appRoute returns the APP_ROUTES route of app, if there is one.
+func appRoute(app string, cfg config.Config) (string, bool) {
+	for _, r := range cfg.AppRoutes {
+		if r.App == app {
+			return r.Route, true
+		}
+	}
+	return "", false
+}
+
+// goesDirect reports whether a request for host goes direct rather than
+// through an upstream.
+func (t requestTransports) goesDirect(host string, cfg config.Config) bool {
+	route, _ := t.route(host, cfg)
+	return route == routeDirect
+}
+
+// route returns whether a request for host goes direct or upstream, and the
+// rule that decided it: APP_ROUTES, UPSTREAM_PAC or Decide.
+func (t requestTransports) route(host string, cfg config.Config) (route, rule string) {
+	switch t.appRoute {
+	case config.AppRouteDirect:
+		return routeDirect, "app:" + t.app
+	case config.AppRouteUpstream:
+		return routeUpstream, "app:" + t.app
+	}
+	switch {
+	case t.pacDirect:
+		return routeDirect, "pac"
+	case t.pacRouted:
+		return routeUpstream, "pac"
+	}
+	d := Decide(host, cfg)
+	return d.Route, d.Reason()
+}
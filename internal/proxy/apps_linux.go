@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procRoot is where the process table is read from, replaced in tests.
+var procRoot = "/proc"
+
+// processOwning returns the executable of the local process whose TCP
+// socket connects client to server. Processes of other users are only
+// found when running as root or with CAP_SYS_PTRACE.
+func processOwning(client, server *net.TCPAddr) (string, error) {
+	inode, err := socketInode(client, server)
+	if err != nil {
+		return "", err
+	}
+	pids, err := os.ReadDir(procRoot)
+	if err != nil {
+		return "", err
+	}
+	link := "socket:[" + inode + "]"
+	for _, pid := range pids {
+		if _, err := strconv.Atoi(pid.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join(procRoot, pid.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name())); err != nil || target != link {
+				continue
+			}
+			if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+				return strings.TrimSuffix(exe, " (deleted)"), nil
+			}
+			comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+			return strings.TrimSpace(string(comm)), err
+		}
+	}
+	return "", fmt.Errorf("no process has socket %s open", inode)
+}
+
+// socketInode finds the inode of the socket connecting client to server in
+// /proc/net/tcp and /proc/net/tcp6.
+func socketInode(client, server *net.TCPAddr) (string, error) {
+	for _, table := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(procRoot, "net", table))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when
+			// retrnsmt uid timeout inode ...
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 || !procAddrIs(fields[1], client) || !procAddrIs(fields[2], server) {
+				continue
+			}
+			f.Close()
+			return fields[9], nil
+		}
+		f.Close()
+	}
+	return "", fmt.Errorf("no socket connects %s to %s", client, server)
+}
+
+// procAddrIs reports whether a /proc/net/tcp address, hex in host byte
+// order per 32-bit word with a big-endian port, e.g. 0100007F:1F90 for
+// 127.0.0.1:8080, is addr.
+func procAddrIs(s string, addr *net.TCPAddr) bool {
+	host, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return false
+	}
+	if p, err := strconv.ParseUint(port, 16, 16); err != nil || int(p) != addr.Port {
+		return false
+	}
+	raw, err := hex.DecodeString(host)
+	if err != nil || len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return false
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return ip.Equal(addr.IP)
+}
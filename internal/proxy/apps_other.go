@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+
+package proxy
+
+import "net"
+
+// processOwning is only available on Linux and Windows.
+func processOwning(client, server *net.TCPAddr) (string, error) {
+	return "", errAppLookupUnsupported
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestAppRoutes(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		t.Skip("finding the process of a connection is not supported on " + runtime.GOOS)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := strings.TrimSuffix(strings.ToLower(filepath.Base(exe)), ".exe")
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer backend.Close()
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	dead.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = dead.Addr().String()
+	cfg.AppRoutes = []config.AppRoute{{App: "other", Route: config.AppRouteBlock}, {App: app, Route: config.AppRouteDirect}}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "direct" {
+		t.Fatalf("GET from %s = %d %q; expected it to go direct past the unreachable upstream", app, resp.StatusCode, body)
+	}
+	var recorded string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && recorded == ""; time.Sleep(10 * time.Millisecond) {
+		for _, c := range server.Activity().Recent() {
+			recorded = c.App
+		}
+	}
+	if recorded != app {
+		t.Errorf("connection recorded from application %q; expected %s", recorded, app)
+	}
+
+	cfg.AppRoutes = []config.AppRoute{{App: app, Route: config.AppRouteBlock}}
+	server.SetConfig(cfg)
+	resp, err = client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get(ErrorHeader) != "app-blocked" {
+		t.Errorf("GET from blocked %s = %d %q; expected 403 app-blocked", app, resp.StatusCode, resp.Header.Get(ErrorHeader))
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetExtendedTcpTable = windows.NewLazySystemDLL("iphlpapi.dll").NewProc("GetExtendedTcpTable")
+
+const (
+	// tcpTableOwnerPIDAll asks GetExtendedTcpTable for all connections with
+	// their owning process.
+	tcpTableOwnerPIDAll = 5
+	// Sizes of MIB_TCPROW_OWNER_PID and MIB_TCP6ROW_OWNER_PID.
+	tcpRowSize  = 24
+	tcp6RowSize = 56
+)
+
+// processOwning returns the executable of the local process whose TCP
+// socket connects client to server.
+func processOwning(client, server *net.TCPAddr) (string, error) {
+	pid, err := tcpOwner(client, server)
+	if err != nil {
+		return "", err
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return "", fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+	defer windows.CloseHandle(h)
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &n); err != nil {
+		return "", fmt.Errorf("failed to query the image of process %d: %w", pid, err)
+	}
+	return windows.UTF16ToString(buf[:n]), nil
+}
+
+// tcpOwner finds the process owning the connection from client to server in
+// the TCP table of client's address family.
+func tcpOwner(client, server *net.TCPAddr) (uint32, error) {
+	family, rowSize := windows.AF_INET, tcpRowSize
+	if client.IP.To4() == nil {
+		family, rowSize = windows.AF_INET6, tcp6RowSize
+	}
+	var table []byte
+	size := uint32(0)
+	for {
+		var p unsafe.Pointer
+		if len(table) > 0 {
+			p = unsafe.Pointer(&table[0])
+		}
+		r, _, _ := procGetExtendedTcpTable.Call(uintptr(p), uintptr(unsafe.Pointer(&size)), 0, uintptr(family), tcpTableOwnerPIDAll, 0)
+		if r == 0 {
+			break
+		}
+		if windows.Errno(r) != windows.ERROR_INSUFFICIENT_BUFFER {
+			return 0, fmt.Errorf("GetExtendedTcpTable: %w", windows.Errno(r))
+		}
+		table = make([]byte, size)
+	}
+	if len(table) < 4 {
+		return 0, fmt.Errorf("no socket connects %s to %s", client, server)
+	}
+	entries := int(binary.LittleEndian.Uint32(table))
+	for i := 0; i < entries; i++ {
+		off := 4 + i*rowSize
+		if off+rowSize > len(table) {
+			break
+		}
+		row := table[off : off+rowSize]
+		var local, remote *net.TCPAddr
+		var pid uint32
+		if family == windows.AF_INET {
+			// dwState, dwLocalAddr, dwLocalPort, dwRemoteAddr, dwRemotePort,
+			// dwOwningPid; addresses and ports in network byte order.
+			local = &net.TCPAddr{IP: net.IP(row[4:8]), Port: int(binary.BigEndian.Uint16(row[8:10]))}
+			remote = &net.TCPAddr{IP: net.IP(row[12:16]), Port: int(binary.BigEndian.Uint16(row[16:18]))}
+			pid = binary.LittleEndian.Uint32(row[20:24])
+		} else {
+			// ucLocalAddr, dwLocalScopeId, dwLocalPort, ucRemoteAddr,
+			// dwRemoteScopeId, dwRemotePort, dwState, dwOwningPid.
+			local = &net.TCPAddr{IP: net.IP(row[0:16]), Port: int(binary.BigEndian.Uint16(row[20:22]))}
+			remote = &net.TCPAddr{IP: net.IP(row[24:40]), Port: int(binary.BigEndian.Uint16(row[44:46]))}
+			pid = binary.LittleEndian.Uint32(row[52:56])
+		}
+		if local.Port == client.Port && remote.Port == server.Port && local.IP.Equal(client.IP) && remote.IP.Equal(server.IP) {
+			return pid, nil
+		}
+	}
+	return 0, fmt.Errorf("no socket connects %s to %s", client, server)
+}
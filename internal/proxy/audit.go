@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// Sides of an authentication recorded in AUTH_AUDIT_LOG: a client
+// authenticating to this proxy, or this proxy to its upstream.
+const (
+	authSideClient   = "client"
+	authSideUpstream = "upstream"
+)
+
+// authEvent is an AUTH_AUDIT_LOG entry.
+type authEvent struct {
+	Time time.Time `json:"time"`
+	Side string    `json:"side"`
+	// Scheme is the authentication scheme, such as basic or ntlm.
+	Scheme  string `json:"scheme"`
+	Account string `json:"account,omitempty"`
+	// Source is the IP address of the client, and Upstream the upstream
+	// authenticated to.
+	Source   string `json:"source"`
+	Upstream string `json:"upstream,omitempty"`
+	Success  bool   `json:"success"`
+	Reason   string `json:"reason,omitempty"`
+	// Repeated counts the identical outcomes left out since the last time
+	// this one was written.
+	Repeated int `json:"repeated,omitempty"`
+}
+
+// authAudit writes authentication outcomes to AUTH_AUDIT_LOG. Outcomes seen
+// again within AUTH_AUDIT_WINDOW are only counted, so that a client retrying
+// with a wrong password, or every request of an authenticated one, does not
+// flood the stream.
+type authAudit struct {
+	mu   sync.Mutex
+	w    io.Writer
+	now  func() time.Time
+	seen map[authEvent]*auditedOutcome
+}
+
+type auditedOutcome struct {
+	until    time.Time
+	repeated int
+}
+
+func newAuthAudit() *authAudit {
+	return &authAudit{now: time.Now, seen: make(map[authEvent]*auditedOutcome)}
+}
+
+// record writes e unless the same outcome was written less than window ago.
+func (a *authAudit) record(e authEvent, window time.Duration) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.w == nil {
+		return
+	}
+	now := a.now()
+	key := e
+	seen := a.seen[key]
+	if window > 0 && seen != nil && now.Before(seen.until) {
+		seen.repeated++
+		return
+	}
+	if seen != nil {
+		e.Repeated = seen.repeated
+	}
+	if window > 0 {
+		a.seen[key] = &auditedOutcome{until: now.Add(window)}
+		if len(a.seen) > 4096 {
+			for k, o := range a.seen {
+				if now.After(o.until) && o.repeated == 0 {
+					delete(a.seen, k)
+				}
+			}
+		}
+	} else {
+		delete(a.seen, key)
+	}
+	e.Time = now
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		Warn.Printf("Failed to write authentication audit record: %v", err)
+	}
+}
+
+// clientAuth records the outcome of req's Basic proxy authentication as
+// user, err being what clientUser returned.
+func (a *authAudit) clientAuth(req *http.Request, user string, err error, cfg config.Config) {
+	e := authEvent{
+		Side:    authSideClient,
+		Scheme:  "none",
+		Account: user,
+		Source:  clientIP(req),
+		Success: err == nil,
+	}
+	if header := req.Header.Get("Proxy-Authorization"); header != "" {
+		scheme, _, _ := strings.Cut(header, " ")
+		e.Scheme = strings.ToLower(scheme)
+	}
+	if err != nil {
+		e.Reason = err.Error()
+	}
+	a.record(e, cfg.AuthAuditWindow)
+}
+
+// upstreamAuth records how the upstream addr took the credentials of
+// PROXY_AUTH for a request from req's client, going by the status it
+// answered with. Without PROXY_AUTH only its demands for credentials are
+// recorded.
+func (a *authAudit) upstreamAuth(req *http.Request, addr string, status int, cfg config.Config) {
+	if cfg.ProxyAuth == "" && status != http.StatusProxyAuthRequired {
+		return
+	}
+	e := authEvent{
+		Side:     authSideUpstream,
+		Scheme:   strings.ToLower(cfg.ProxyAuth),
+		Source:   clientIP(req),
+		Upstream: addr,
+		Success:  status != http.StatusProxyAuthRequired,
+	}
+	if e.Scheme == "" {
+		e.Scheme = "none"
+	}
+	if user, _, ok := req.BasicAuth(); ok {
+		e.Account = user
+	}
+	if !e.Success {
+		e.Reason = fmt.Sprintf("upstream answered %d %s", status, http.StatusText(status))
+	}
+	a.record(e, cfg.AuthAuditWindow)
+}
+
+// SetAuthAuditLog makes the server write a JSON line for each outcome of
+// client and upstream proxy authentication to w.
+func (s *Server) SetAuthAuditLog(w io.Writer) {
+	s.audit.mu.Lock()
+	s.audit.w = w
+	s.audit.mu.Unlock()
+}
+
+// clientIP returns the IP address req came from.
+func clientIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// authEvents returns the audit records written to b.
+func authEvents(t *testing.T, b *syncBuffer) []authEvent {
+	t.Helper()
+	var events []authEvent
+	for _, line := range b.lines() {
+		if line == "" {
+			continue
+		}
+		var e authEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad audit record %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestAuthAuditCollapsesRepeats(t *testing.T) {
+	now := time.Unix(0, 0)
+	var out syncBuffer
+	audit := newAuthAudit()
+	audit.now = func() time.Time { return now }
+	audit.w = &out
+
+	failure := authEvent{Side: authSideClient, Scheme: "basic", Account: "alice", Source: "10.0.0.1", Reason: "wrong password"}
+	other := failure
+	other.Source = "10.0.0.2"
+	steps := []struct {
+		event   authEvent
+		advance time.Duration
+	}{
+		{failure, 0},
+		{failure, time.Second},
+		{failure, time.Second},
+		{other, 0},
+		{failure, time.Minute},
+	}
+	for _, s := range steps {
+		now = now.Add(s.advance)
+		audit.record(s.event, time.Minute)
+	}
+
+	events := authEvents(t, &out)
+	if len(events) != 3 {
+		t.Fatalf("records = %+v; expected 3", events)
+	}
+	if events[0].Repeated != 0 || events[1].Source != "10.0.0.2" || events[2].Repeated != 2 || !events[2].Time.Equal(now) {
+		t.Errorf("records = %+v; expected the last to count 2 repeats", events)
+	}
+
+	// Without a window every outcome is written.
+	audit.record(failure, 0)
+	audit.record(failure, 0)
+	if n := len(authEvents(t, &out)); n != 5 {
+		t.Errorf("%d records; expected 5 without AUTH_AUDIT_WINDOW", n)
+	}
+}
+
+func TestServerAuditsClientAuth(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.ClientUsers = map[string]string{"alice": "s3cret"}
+	server, addr := serveListener(t, cfg, config.Listener{Auth: true})
+	var out syncBuffer
+	server.SetAuthAuditLog(&out)
+
+	for _, user := range []*url.Userinfo{nil, url.UserPassword("alice", "wrong"), url.UserPassword("alice", "s3cret"), url.UserPassword("alice", "s3cret")} {
+		proxyURL := &url.URL{Scheme: "http", Host: addr, User: user}
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	expected := []authEvent{
+		{Side: authSideClient, Scheme: "none", Source: "127.0.0.1", Reason: "no credentials"},
+		{Side: authSideClient, Scheme: "basic", Account: "alice", Source: "127.0.0.1", Reason: "wrong password"},
+		{Side: authSideClient, Scheme: "basic", Account: "alice", Source: "127.0.0.1", Success: true},
+	}
+	events := authEvents(t, &out)
+	if len(events) != len(expected) {
+		t.Fatalf("records = %+v; expected %+v", events, expected)
+	}
+	for i, e := range events {
+		e.Time = time.Time{}
+		if e != expected[i] {
+			t.Errorf("record %d = %+v; expected %+v", i, e, expected[i])
+		}
+	}
+}
+
+func TestServerAuditsUpstreamAuth(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Proxy-Authenticate", "Basic")
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer upstream.Close()
+	upstreamAddr := upstream.Listener.Addr().String()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = upstreamAddr
+	cfg.AuthAuditWindow = 0
+	server := NewServer(cfg)
+	var out syncBuffer
+	server.SetAuthAuditLog(&out)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+	proxyURL := &url.URL{Scheme: "http", Host: l.Addr().String()}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Get("http://example.test/")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get("https://example.test/"); err == nil {
+		t.Fatal("CONNECT through an upstream demanding credentials succeeded")
+	}
+
+	events := authEvents(t, &out)
+	if len(events) != 2 {
+		t.Fatalf("records = %+v; expected the GET and the CONNECT", events)
+	}
+	for _, e := range events {
+		if e.Side != authSideUpstream || e.Scheme != "none" || e.Upstream != upstreamAddr || e.Success || e.Reason != "upstream answered 407 Proxy Authentication Required" {
+			t.Errorf("record = %+v; expected a failed authentication to %s", e, upstreamAddr)
+		}
+	}
+}
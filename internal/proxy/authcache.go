@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authCache remembers, per destination, the NTLM and Negotiate schemes its
+// last challenge offered. The ntlmssp.Negotiator always sends a request
+// without credentials first to learn them; once they are known, that
+// request is answered with the remembered challenge instead of being sent,
+// which saves a round trip on every new connection.
+type authCache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]authCacheEntry
+}
+
+type authCacheEntry struct {
+	schemes []string
+	expires time.Time
+}
+
+func newAuthCache(ttl time.Duration) *authCache {
+	return &authCache{ttl: ttl, hosts: map[string]authCacheEntry{}}
+}
+
+type authCredentialsKey struct{}
+
+// credentials wraps the negotiator rt, marking the requests it will
+// authenticate: only those may be answered from the cache.
+func (c *authCache) credentials(rt http.RoundTripper) http.RoundTripper {
+	if c.ttl <= 0 {
+		return rt
+	}
+	return authCacheCredentials{RoundTripper: rt}
+}
+
+// challenges wraps rt, the transport below the negotiator, in the cache.
+func (c *authCache) challenges(rt http.RoundTripper) http.RoundTripper {
+	if c.ttl <= 0 {
+		return rt
+	}
+	return authCacheChallenges{RoundTripper: rt, cache: c}
+}
+
+type authCacheCredentials struct {
+	http.RoundTripper
+}
+
+func (a authCacheCredentials) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, _, ok := req.BasicAuth(); ok {
+		req = req.WithContext(context.WithValue(req.Context(), authCredentialsKey{}, true))
+	}
+	return a.RoundTripper.RoundTrip(req)
+}
+
+func (a authCacheCredentials) CloseIdleConnections() {
+	closeIdle(a.RoundTripper)
+}
+
+type authCacheChallenges struct {
+	http.RoundTripper
+	cache *authCache
+}
+
+func (a authCacheChallenges) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	authorization := req.Header.Get("Authorization")
+	credentials, _ := req.Context().Value(authCredentialsKey{}).(bool)
+	if credentials && authorization == "" {
+		if schemes, ok := a.cache.get(host); ok {
+			if req.Body != nil {
+				// The negotiator waits for the body to be closed before
+				// sending it again.
+				req.Body.Close()
+			}
+			resp := &http.Response{
+				Status:     "401 Unauthorized",
+				StatusCode: http.StatusUnauthorized,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     http.Header{},
+				Body:       http.NoBody,
+				Request:    req,
+			}
+			for _, scheme := range schemes {
+				resp.Header.Add("WWW-Authenticate", scheme)
+			}
+			return resp, nil
+		}
+	}
+	resp, err := a.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	schemes := challengeSchemes(resp.Header.Values("WWW-Authenticate"))
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		a.cache.forget(host)
+	case resp.StatusCode != http.StatusUnauthorized:
+	case credentials && authorization == "" && len(schemes) > 0:
+		a.cache.put(host, schemes)
+	case authorization != "":
+		// Forget the destination when the handshake failed or it no
+		// longer offers the remembered scheme.
+		msg, ok := ntlmToken(authorization)
+		if !ok {
+			break
+		}
+		if m, err := parseNTLM(msg); len(schemes) == 0 || err == nil && m.kind == ntlmAuthenticate {
+			a.cache.forget(host)
+		}
+	}
+	return resp, nil
+}
+
+func (a authCacheChallenges) CloseIdleConnections() {
+	closeIdle(a.RoundTripper)
+}
+
+// challengeSchemes returns the NTLM and Negotiate schemes of challenges.
+func challengeSchemes(challenges []string) []string {
+	var schemes []string
+	for _, challenge := range challenges {
+		scheme, _, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+		if scheme == "NTLM" || scheme == "Negotiate" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+func (c *authCache) get(host string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.hosts[host]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.hosts, host)
+		return nil, false
+	}
+	return entry.schemes, true
+}
+
+func (c *authCache) put(host string, schemes []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hosts[host] = authCacheEntry{schemes: schemes, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *authCache) forget(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.hosts, host)
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestAuthCache(t *testing.T) {
+	hits, reject := 0, false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		msg, _ := ntlmToken(r.Header.Get("Authorization"))
+		m, err := parseNTLM(msg)
+		switch {
+		case err != nil:
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+		case m.kind == ntlmNegotiate:
+			w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(ntlmTestChallenge("CORP", "corp.example")))
+			w.WriteHeader(http.StatusUnauthorized)
+		case reject:
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyAuth = "ntlm"
+	transport := newUpstreamTransport(cfg, upstream.Listener.Addr().String())
+	tests := []struct {
+		name   string
+		reject bool
+		hits   int
+		status int
+	}{
+		{"cold", false, 3, http.StatusOK},
+		{"cached", false, 2, http.StatusOK},
+		{"rejected", true, 2, http.StatusUnauthorized},
+		{"forgotten", false, 3, http.StatusOK},
+	}
+	for _, tt := range tests {
+		hits, reject = 0, tt.reject
+		req, _ := http.NewRequest(http.MethodPost, "http://intranet.test/upload", strings.NewReader("payload"))
+		req.SetBasicAuth(`CORP\alice`, "s3cret")
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || hits != tt.hits {
+			t.Errorf("%s: %d after %d requests to the destination; expected %d after %d", tt.name, resp.StatusCode, hits, tt.status, tt.hits)
+		}
+		if tt.status == http.StatusOK && string(body) != "payload" {
+			t.Errorf("%s: destination received %q; expected the request body", tt.name, body)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// authSchemes keeps only the most preferred of the authentication schemes
+// in the challenges of responses to requests sent by rt, so that the NTLM
+// negotiator answers with that scheme and never with one not in schemes.
+type authSchemes struct {
+	http.RoundTripper
+	schemes []string
+}
+
+// withAuthSchemes wraps rt in authSchemes if PROXY_AUTH_SCHEMES is set.
+func withAuthSchemes(rt http.RoundTripper, schemes []string) http.RoundTripper {
+	if len(schemes) == 0 {
+		return rt
+	}
+	return authSchemes{RoundTripper: rt, schemes: schemes}
+}
+
+func (a authSchemes) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := a.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if challenges := resp.Header.Values("WWW-Authenticate"); len(challenges) > 0 {
+		resp.Header.Del("WWW-Authenticate")
+		if challenge, ok := preferredChallenge(challenges, a.schemes); ok {
+			resp.Header.Set("WWW-Authenticate", challenge)
+		}
+	}
+	return resp, nil
+}
+
+func (a authSchemes) CloseIdleConnections() {
+	closeIdle(a.RoundTripper)
+}
+
+// preferredChallenge returns the challenge whose scheme comes first in
+// schemes, or false if none of them is offered.
+func preferredChallenge(challenges, schemes []string) (string, bool) {
+	best, rank := "", len(schemes)
+	for _, challenge := range challenges {
+		scheme, _, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+		if i := slices.Index(schemes, strings.ToLower(scheme)); i >= 0 && i < rank {
+			best, rank = strings.TrimSpace(challenge), i
+		}
+	}
+	return best, rank < len(schemes)
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestPreferredChallenge(t *testing.T) {
+	challenges := []string{`Basic realm="corp"`, "NTLM", "Negotiate"}
+	tests := []struct {
+		schemes  []string
+		expected string
+	}{
+		{[]string{"negotiate", "ntlm"}, "Negotiate"},
+		{[]string{"ntlm", "negotiate"}, "NTLM"},
+		{[]string{"basic", "ntlm"}, `Basic realm="corp"`},
+		{[]string{"kerberos"}, ""},
+	}
+	for _, tt := range tests {
+		got, ok := preferredChallenge(challenges, tt.schemes)
+		if got != tt.expected || ok != (tt.expected != "") {
+			t.Errorf("preferredChallenge(%v) = %q, %v; expected %q", tt.schemes, got, ok, tt.expected)
+		}
+	}
+}
+
+func TestProxyAuthSchemes(t *testing.T) {
+	var sent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			sent, _, _ = strings.Cut(auth, " ")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Add("WWW-Authenticate", `Basic realm="corp"`)
+		w.Header().Add("WWW-Authenticate", "NTLM")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		schemes  string
+		expected string
+	}{
+		{"", "NTLM"},
+		{"basic,ntlm", "Basic"},
+		{"negotiate,ntlm", "NTLM"},
+		{"negotiate", ""},
+	}
+	for _, tt := range tests {
+		sent = ""
+		cfg := config.DefaultConfig()
+		cfg.ProxyAuth = "ntlm"
+		cfg.ProxyAuthSchemes = config.GetAuthSchemes(tt.schemes)
+		req, _ := http.NewRequest(http.MethodGet, "http://intranet.test/", nil)
+		req.SetBasicAuth(`CORP\alice`, "s3cret")
+		resp, err := newUpstreamTransport(cfg, upstream.Listener.Addr().String()).RoundTrip(req)
+		if err != nil {
+			t.Fatalf("PROXY_AUTH_SCHEMES=%q: %v", tt.schemes, err)
+		}
+		resp.Body.Close()
+		if sent != tt.expected {
+			t.Errorf("PROXY_AUTH_SCHEMES=%q: authenticated with %q; expected %q", tt.schemes, sent, tt.expected)
+		}
+	}
+}
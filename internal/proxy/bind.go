@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// bindRoute is an OUTBOUND_BIND_ROUTES entry: connections to hosts matching
+// pattern are dialed by dialAddr.
+type bindRoute struct {
+	pattern  string
+	dialAddr func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// boundDialer returns the function connecting to a single IP address from
+// bind, a local IP address or an interface name, or from anywhere if bind
+// is empty.
+func boundDialer(dialer net.Dialer, bind string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if bind == "" {
+		return dialer.DialContext
+	}
+	if ip := net.ParseIP(bind); ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		return dialer.DialContext
+	}
+	dialer.Control = bindToDevice(bind)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// Look the interface up on every dial, its addresses may change.
+		local, err := interfaceAddr(bind, addr)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		d := dialer
+		d.LocalAddr = &net.TCPAddr{IP: local}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// interfaceAddr returns an address of the interface name in the family of
+// the IP address in addr.
+func interfaceAddr(name, addr string) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("outbound bind: %w", err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("outbound bind: %w", err)
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	v4 := net.ParseIP(host).To4() != nil
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && (ipnet.IP.To4() != nil) == v4 && !ipnet.IP.IsLinkLocalUnicast() {
+			return ipnet.IP, nil
+		}
+	}
+	family := "IPv6"
+	if v4 {
+		family = "IPv4"
+	}
+	return nil, fmt.Errorf("outbound bind: interface %s has no %s address", name, family)
+}
+
+func newBindRoutes(dialer net.Dialer, routes []config.BindRoute) []bindRoute {
+	var out []bindRoute
+	for _, route := range routes {
+		out = append(out, bindRoute{pattern: route.Pattern, dialAddr: boundDialer(dialer, route.Bind)})
+	}
+	return out
+}
+
+// newUpstreamDialer returns the dialer for connections to the upstream addr.
+// The first UPSTREAM_BIND entry matching addr decides where they are made
+// from, ahead of OUTBOUND_BIND_ROUTES.
+func newUpstreamDialer(cfg config.Config, addr string) *outboundDialer {
+	d := newDialer(cfg)
+	for _, route := range cfg.UpstreamBinds {
+		if config.IsException(addr, []string{route.Pattern}) {
+			d.dialAddr = boundDialer(netDialer(cfg), route.Bind)
+			d.binds = nil
+			break
+		}
+	}
+	return d
+}
+
+// bound returns d dialing from the source of the first OUTBOUND_BIND_ROUTES
+// entry matching host, or d itself if none matches.
+func (d *outboundDialer) bound(host string) *outboundDialer {
+	for _, route := range d.binds {
+		if config.IsException(host, []string{route.pattern}) {
+			bound := *d
+			bound.dialAddr = route.dialAddr
+			return &bound
+		}
+	}
+	return d
+}
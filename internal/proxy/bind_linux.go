@@ -0,0 +1,18 @@
+package proxy
+
+import "syscall"
+
+// bindToDevice makes sockets egress through the interface name regardless
+// of the routing table, as multi-homed hosts need. It requires
+// CAP_NET_RAW on kernels before 5.7.
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
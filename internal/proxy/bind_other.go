@@ -0,0 +1,11 @@
+//go:build !linux
+
+package proxy
+
+import "syscall"
+
+// bindToDevice is only available on Linux; elsewhere binding to the
+// interface's address has to do.
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
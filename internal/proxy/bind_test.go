@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestDialerBindsSourceAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs the whole of 127.0.0.0/8 on the loopback interface")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	cfg := config.DefaultConfig()
+	cfg.DisableIPv6 = true
+	cfg.OutboundBind = "127.0.0.3"
+	cfg.OutboundBindRoutes = []config.BindRoute{{Pattern: "localhost", Bind: "127.0.0.2"}}
+	d := newDialer(cfg)
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"127.0.0.1", "127.0.0.3"},
+		{"localhost", "127.0.0.2"},
+	}
+	for _, tt := range tests {
+		conn, err := d.dial(net.JoinHostPort(tt.host, port))
+		if err != nil {
+			t.Fatalf("dial %s: %v", tt.host, err)
+		}
+		accepted, err := l.Accept()
+		if err != nil {
+			t.Fatalf("accept: %v", err)
+		}
+		source, _, _ := net.SplitHostPort(accepted.RemoteAddr().String())
+		accepted.Close()
+		conn.Close()
+		if source != tt.expected {
+			t.Errorf("connection to %s came from %s; expected %s", tt.host, source, tt.expected)
+		}
+	}
+}
+
+func TestUpstreamDialerBindsPerUpstream(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs the whole of 127.0.0.0/8 on the loopback interface")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	upstream := l.Addr().String()
+
+	cfg := config.DefaultConfig()
+	cfg.DisableIPv6 = true
+	cfg.OutboundBind = "127.0.0.3"
+	cfg.OutboundBindRoutes = []config.BindRoute{{Pattern: "127.0.0.1", Bind: "127.0.0.4"}}
+	cfg.UpstreamBinds = []config.BindRoute{{Pattern: "127.0.0.1:1", Bind: "127.0.0.5"}, {Pattern: upstream, Bind: "127.0.0.2"}}
+
+	tests := []struct {
+		name     string
+		dialer   *outboundDialer
+		expected string
+	}{
+		{"matching upstream", newUpstreamDialer(cfg, upstream), "127.0.0.2"},
+		{"destination", newDialer(cfg), "127.0.0.4"},
+	}
+	for _, tt := range tests {
+		conn, err := tt.dialer.dial(upstream)
+		if err != nil {
+			t.Fatalf("%s: dial: %v", tt.name, err)
+		}
+		accepted, err := l.Accept()
+		if err != nil {
+			t.Fatalf("accept: %v", err)
+		}
+		source, _, _ := net.SplitHostPort(accepted.RemoteAddr().String())
+		accepted.Close()
+		conn.Close()
+		if source != tt.expected {
+			t.Errorf("%s: connection came from %s; expected %s", tt.name, source, tt.expected)
+		}
+	}
+}
+
+func TestInterfaceAddr(t *testing.T) {
+	if _, err := interfaceAddr("no-such-interface0", "192.0.2.1:80"); err == nil {
+		t.Fatal("interfaceAddr of a missing interface succeeded")
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback == 0 {
+			continue
+		}
+		ip, err := interfaceAddr(ifi.Name, "127.0.0.1:80")
+		if err != nil {
+			t.Fatalf("interfaceAddr(%s) = %v", ifi.Name, err)
+		}
+		if ip.To4() == nil {
+			t.Fatalf("interfaceAddr(%s) for an IPv4 destination = %s", ifi.Name, ip)
+		}
+		if _, err := interfaceAddr(ifi.Name, "[2001:db8::1]:80"); err != nil && !strings.Contains(err.Error(), "no IPv6 address") {
+			t.Fatalf("interfaceAddr(%s) for an IPv6 destination = %v", ifi.Name, err)
+		}
+		return
+	}
+	t.Skip("no loopback interface")
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// errBodyConsumed is returned for a request body that cannot be sent again
+// because part of it was already sent.
+var errBodyConsumed = errors.New("request body already sent")
+
+// requestBody streams the body of a proxied request to the destination or
+// upstream as the client sends it, without holding it in memory. Until
+// anything was read from it, e.g. when connecting to an upstream failed, it
+// can be sent again, to the next upstream or directly. It is left open for
+// the server to close once the request is done, so that a failed attempt
+// does not close it for the next one.
+type requestBody struct {
+	body io.ReadCloser
+	read atomic.Bool
+}
+
+// streamBody gives req a requestBody, if it has a body.
+func streamBody(req *http.Request) *http.Request {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req
+	}
+	if _, ok := req.Body.(*requestBody); ok {
+		return req
+	}
+	req.Body = &requestBody{body: req.Body}
+	return req
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	b.read.Store(true)
+	return b.body.Read(p)
+}
+
+func (b *requestBody) Close() error {
+	return nil
+}
+
+// getBody hands out b again as long as nothing was read from it.
+func (b *requestBody) getBody() (io.ReadCloser, error) {
+	if b.read.Load() {
+		return nil, errBodyConsumed
+	}
+	return b, nil
+}
+
+// bodyUnsent reports whether req can be sent again, since it has no body or
+// nothing of its requestBody was read yet.
+func bodyUnsent(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	b, ok := req.Body.(*requestBody)
+	return ok && !b.read.Load()
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestCloneRequestGetBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "http://example.test/upload", strings.NewReader("payload"))
+	req = streamBody(req)
+	out := CloneRequest(req)
+	if out.GetBody == nil || out.ContentLength != int64(len("payload")) {
+		t.Fatalf("GetBody set: %t, ContentLength = %d", out.GetBody != nil, out.ContentLength)
+	}
+	if _, err := out.GetBody(); err != nil {
+		t.Errorf("GetBody before reading: %v", err)
+	}
+	out.Body.Close()
+	data, _ := io.ReadAll(out.Body)
+	if string(data) != "payload" {
+		t.Errorf("body after Close = %q; expected it left open", data)
+	}
+	if _, err := out.GetBody(); !errors.Is(err, errBodyConsumed) {
+		t.Errorf("GetBody after reading: %v; expected %v", err, errBodyConsumed)
+	}
+	if bodyUnsent(req) {
+		t.Error("body reported unsent after reading")
+	}
+}
+
+func TestStreamsRequestBody(t *testing.T) {
+	firstChunk := make(chan struct{})
+	received := make(chan int, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(r.Body, buf); err != nil {
+			t.Errorf("read first chunk: %v", err)
+		}
+		close(firstChunk)
+		rest, _ := io.Copy(io.Discard, r.Body)
+		received <- len(buf) + int(rest)
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.DirectOnly = true
+	front := httptest.NewServer(NewServer(cfg))
+	defer front.Close()
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+
+	// The rest of the body is only sent once the backend got the first
+	// chunk, which it cannot if the proxy waits for the whole body.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("first"))
+		select {
+		case <-firstChunk:
+			pw.Write(bytes.Repeat([]byte("x"), 1<<20))
+			pw.Close()
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(errors.New("backend did not get the first chunk"))
+		}
+	}()
+	resp, err := client.Post(backend.URL, "application/octet-stream", pr)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if n := <-received; n != 5+1<<20 {
+		t.Errorf("backend received %d bytes; expected %d", n, 5+1<<20)
+	}
+}
+
+func TestUploadFailsOverToNextUpstream(t *testing.T) {
+	received := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = deadAddr(t) + "," + upstream.Listener.Addr().String()
+	front := httptest.NewServer(NewServer(cfg))
+	defer front.Close()
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+
+	resp, err := client.Post("http://example.test/upload", "text/plain", strings.NewReader("artifact"))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d; expected 200", resp.StatusCode)
+	}
+	if got := <-received; got != "artifact" {
+		t.Errorf("upstream received %q; expected %q", got, "artifact")
+	}
+}
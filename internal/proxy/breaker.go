@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// errCircuitOpen is returned when every upstream's circuit is open, so the
+// request fails fast instead of waiting out a dial timeout.
+var errCircuitOpen = errors.New("all upstream circuits are open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker is the circuit breaker of one upstream. It opens after
+// CIRCUIT_FAILURE_THRESHOLD consecutive connection failures and, once
+// CIRCUIT_OPEN_DURATION has passed, lets a single probe through (half-open)
+// whose outcome closes or re-opens it.
+type breaker struct {
+	addr string
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func newBreaker(addr string) *breaker {
+	return &breaker{addr: addr, now: time.Now}
+}
+
+// allow reports whether a request may be sent to the upstream.
+func (b *breaker) allow(cfg config.Config) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < cfg.CircuitOpenDuration {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		Info.Printf("Circuit for upstream %s is half-open, probing", b.addr)
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != circuitClosed {
+		Info.Printf("Circuit for upstream %s closed", b.addr)
+	}
+	b.state = circuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure(cfg config.Config) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= cfg.CircuitFailureThreshold) {
+		Warn.Printf("Circuit for upstream %s opened after %d consecutive failures", b.addr, b.failures)
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *breaker) currentState() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerSet holds one breaker per upstream address. It outlives
+// configuration swaps so an upstream's history survives a reload.
+type breakerSet struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerSet() *breakerSet {
+	return &breakerSet{breakers: map[string]*breaker{}}
+}
+
+func (s *breakerSet) get(addr string) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[addr]
+	if !ok {
+		b = newBreaker(addr)
+		s.breakers[addr] = b
+	}
+	return b
+}
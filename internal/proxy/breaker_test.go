@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CircuitFailureThreshold = 2
+	cfg.CircuitOpenDuration = time.Minute
+
+	now := time.Now()
+	b := newBreaker("proxy:8080")
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		name  string
+		do    func()
+		allow bool
+		state circuitState
+	}{
+		{"first failure keeps circuit closed", func() { b.failure(cfg) }, true, circuitClosed},
+		{"threshold opens circuit", func() { b.failure(cfg) }, false, circuitOpen},
+		{"open duration not elapsed", func() { now = now.Add(30 * time.Second) }, false, circuitOpen},
+		{"failed probe re-opens circuit", func() {
+			now = now.Add(31 * time.Second)
+			if !b.allow(cfg) {
+				t.Fatal("expected probe to be allowed")
+			}
+			b.failure(cfg)
+		}, false, circuitOpen},
+		{"successful probe closes circuit", func() {
+			now = now.Add(time.Minute)
+			if !b.allow(cfg) {
+				t.Fatal("expected probe to be allowed")
+			}
+			b.success()
+		}, true, circuitClosed},
+	}
+
+	for _, step := range steps {
+		step.do()
+		if got := b.currentState(); got != step.state {
+			t.Fatalf("%s: state = %v; expected %v", step.name, got, step.state)
+		}
+		if got := b.allow(cfg); got != step.allow {
+			t.Fatalf("%s: allow = %v; expected %v", step.name, got, step.allow)
+		}
+	}
+}
+
+func TestBreakerAllowsSingleProbe(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CircuitFailureThreshold = 1
+
+	now := time.Now()
+	b := newBreaker("proxy:8080")
+	b.now = func() time.Time { return now }
+	b.failure(cfg)
+	now = now.Add(cfg.CircuitOpenDuration)
+
+	if !b.allow(cfg) {
+		t.Fatal("expected first probe to be allowed")
+	}
+	if b.allow(cfg) {
+		t.Fatal("expected concurrent probe to be rejected")
+	}
+}
+
+func TestServerFailsOverToNextUpstream(t *testing.T) {
+	dead := deadAddr(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "via backup")
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = dead + "," + upstream.Listener.Addr().String()
+	cfg.CircuitFailureThreshold = 2
+	server := NewServer(cfg)
+	front := httptest.NewServer(server)
+	defer front.Close()
+
+	frontURL, _ := url.Parse(front.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(frontURL)}}
+	for i := range 3 {
+		resp, err := client.Get("http://example.test/")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status = %d; expected 200", i, resp.StatusCode)
+		}
+	}
+
+	if got := server.breakers.get(dead).currentState(); got != circuitOpen {
+		t.Fatalf("circuit for dead upstream = %v; expected open", got)
+	}
+}
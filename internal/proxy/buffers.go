@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"io"
+	"sync"
+)
+
+// bufferPools holds a *sync.Pool of buffers for each size in use.
+var bufferPools sync.Map
+
+// copyBuffer copies src to dst like io.Copy, through a pooled buffer of size
+// bytes if size is set. io.Copy's own 32 KiB buffer, and the copying the
+// kernel can do between sockets, are only used with no size set, since
+// they would ignore it.
+func copyBuffer(dst io.Writer, src io.Reader, size int) (int64, error) {
+	if size <= 0 {
+		return io.Copy(dst, src)
+	}
+	pool, ok := bufferPools.Load(size)
+	if !ok {
+		pool, _ = bufferPools.LoadOrStore(size, &sync.Pool{New: func() any {
+			buf := make([]byte, size)
+			return &buf
+		}})
+	}
+	buf := pool.(*sync.Pool).Get().(*[]byte)
+	defer pool.(*sync.Pool).Put(buf)
+	// Hide io.ReaderFrom and io.WriterTo, which bypass the buffer.
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
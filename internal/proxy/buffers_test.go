@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// chunkWriter records the size of each write.
+type chunkWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestCopyBuffer(t *testing.T) {
+	data := strings.Repeat("0123456789", 10)
+	tests := []struct {
+		size     int
+		maxWrite int
+	}{
+		{0, len(data)},
+		{16, 16},
+		{1000, len(data)},
+	}
+	for _, tt := range tests {
+		// strings.Reader implements io.WriterTo, which must not bypass the
+		// buffer.
+		var w chunkWriter
+		n, err := copyBuffer(&w, strings.NewReader(data), tt.size)
+		if err != nil || n != int64(len(data)) || w.String() != data {
+			t.Errorf("size %d: copied %d bytes, %v", tt.size, n, err)
+		}
+		for _, size := range w.writes {
+			if size > tt.maxWrite {
+				t.Errorf("size %d: wrote %d bytes at once; expected at most %d", tt.size, size, tt.maxWrite)
+			}
+		}
+	}
+	if _, ok := bufferPools.Load(16); !ok {
+		t.Error("no pool kept for 16 byte buffers")
+	}
+}
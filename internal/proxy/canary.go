@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// withCanary returns t with CANARY_UPSTREAM tried first if req falls into
+// the canary split. The regular upstreams follow, so requests fail over to
+// them when the canary cannot be reached.
+func (t requestTransports) withCanary(req *http.Request, cfg config.Config) requestTransports {
+	if t.canary == nil || !inCanary(req, cfg) {
+		return t
+	}
+	t.upstreams = append([]upstreamTransport{*t.canary}, t.upstreams...)
+	return t
+}
+
+// inCanary reports whether req is one of the CANARY_PERCENT percent of the
+// requests matching CANARY_HOSTS that go through the canary. The choice is
+// a hash of the destination host or, with CANARY_HASH=client, of the client
+// address, so a host or client sticks to the same upstream.
+func inCanary(req *http.Request, cfg config.Config) bool {
+	if len(cfg.CanaryHosts) > 0 && !config.IsException(req.Host, cfg.CanaryHosts) {
+		return false
+	}
+	key := req.Host
+	if cfg.CanaryHash == config.CanaryHashClient {
+		key = req.RemoteAddr
+	}
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		key = host
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32()%100) < cfg.CanaryPercent
+}
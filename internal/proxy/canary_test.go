@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestInCanary(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CanaryPercent = 10
+
+	canary := 0
+	for i := 0; i < 1000; i++ {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://host%d.example/", i), nil)
+		in := inCanary(req, cfg)
+		if in != inCanary(req, cfg) {
+			t.Fatalf("inCanary(%s) is not stable", req.Host)
+		}
+		if in {
+			canary++
+		}
+	}
+	if canary < 60 || canary > 140 {
+		t.Errorf("%d of 1000 hosts in a 10%% canary; expected about 100", canary)
+	}
+
+	tests := []struct {
+		name     string
+		percent  int
+		hosts    []string
+		hash     string
+		host     string
+		client   string
+		expected bool
+	}{
+		{"no canary", 0, nil, config.CanaryHashHost, "example.com", "10.0.0.1:1234", false},
+		{"everything", 100, nil, config.CanaryHashHost, "example.com", "10.0.0.1:1234", true},
+		{"matching host", 100, []string{"*.corp"}, config.CanaryHashHost, "wiki.corp:443", "10.0.0.1:1234", true},
+		{"other host", 100, []string{"*.corp"}, config.CanaryHashHost, "example.com", "10.0.0.1:1234", false},
+		{"by client", 100, nil, config.CanaryHashClient, "example.com", "10.0.0.1:1234", true},
+	}
+	for _, tt := range tests {
+		cfg.CanaryPercent, cfg.CanaryHosts, cfg.CanaryHash = tt.percent, tt.hosts, tt.hash
+		req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/", nil)
+		req.RemoteAddr = tt.client
+		if got := inCanary(req, cfg); got != tt.expected {
+			t.Errorf("%s: inCanary = %v; expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestInCanaryHashesClientWithoutPort(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CanaryPercent = 50
+	cfg.CanaryHash = config.CanaryHashClient
+
+	for i := 0; i < 20; i++ {
+		client := fmt.Sprintf("10.0.0.%d", i)
+		a := httptest.NewRequest(http.MethodGet, "http://a.example/", nil)
+		a.RemoteAddr = client + ":1000"
+		b := httptest.NewRequest(http.MethodGet, "http://b.example/", nil)
+		b.RemoteAddr = client + ":2000"
+		if inCanary(a, cfg) != inCanary(b, cfg) {
+			t.Fatalf("client %s was split between upstreams", client)
+		}
+	}
+}
+
+// fakeUpstream answers every proxied request with its name.
+func fakeUpstream(t *testing.T, name string) string {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func TestCanaryRoutesThroughCanaryUpstream(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = fakeUpstream(t, "primary")
+	cfg.CanaryUpstream = fakeUpstream(t, "canary")
+	cfg.CanaryPercent = 100
+	cfg.CanaryHosts = []string{"*.canary.test"}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"http://www.canary.test/", "canary"},
+		{"http://www.example.test/", "primary"},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.target)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.target, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.expected {
+			t.Errorf("GET %s went through %q; expected %q", tt.target, body, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// chaosRand decides whether a fault with a rate is injected; tests replace it.
+var chaosRand = rand.Float64
+
+// chaosRule returns the first CHAOS_RULES entry matching host.
+func chaosRule(host string, cfg config.Config) (config.ChaosRule, bool) {
+	for _, rule := range cfg.ChaosRules {
+		if config.IsException(host, []string{rule.Pattern}) {
+			return rule, true
+		}
+	}
+	return config.ChaosRule{}, false
+}
+
+// injectFaults applies the CHAOS_RULES entry matching req's destination. It
+// returns the request to forward, capped to the rule's bandwidth, or false
+// if the request has been answered with a fault instead.
+func injectFaults(w http.ResponseWriter, req *http.Request, cfg config.Config) (*http.Request, bool) {
+	rule, ok := chaosRule(req.Host, cfg)
+	if !ok {
+		return req, true
+	}
+	conn := trackedConnFrom(req)
+
+	if rule.Latency > 0 {
+		timer := time.NewTimer(rule.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return req, false
+		}
+	}
+	if rule.ResetRate > 0 && chaosRand() < rule.ResetRate {
+		Info.Printf("Chaos: resetting %s %s", req.Method, req.Host)
+		conn.setError(errors.New("chaos: connection reset"))
+		resetClient(w)
+		return req, false
+	}
+	if rule.ErrorStatus != 0 && chaosRand() < rule.ErrorRate {
+		Info.Printf("Chaos: answering %s %s with %d", req.Method, req.Host, rule.ErrorStatus)
+		conn.setError(fmt.Errorf("chaos: injected %d", rule.ErrorStatus))
+		w.Header().Set(ErrorHeader, "chaos")
+		http.Error(w, http.StatusText(rule.ErrorStatus), rule.ErrorStatus)
+		return req, false
+	}
+	if rule.Bandwidth > 0 {
+		req = withShapedStream(req, &shapedStream{shaper: newShaper(), priority: config.PriorityNormal, limit: rule.Bandwidth})
+	}
+	return req, true
+}
+
+// resetClient aborts the client connection with a TCP reset rather than an
+// orderly close.
+func resetClient(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	client, _, err := hj.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tc, ok := tcpConn(client); ok {
+		_ = tc.SetLinger(0)
+	}
+	client.Close()
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestInjectFaults(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 40<<10))
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+
+	defer func(f func() float64) { chaosRand = f }(chaosRand)
+	chaosRand = func() float64 { return 0.5 }
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	cfg.HostMap = map[string]string{
+		"slow.test": "127.0.0.1", "reset.test": "127.0.0.1", "error.test": "127.0.0.1",
+		"lucky.test": "127.0.0.1", "narrow.test": "127.0.0.1",
+	}
+	cfg.ChaosRules = []config.ChaosRule{
+		{Pattern: "slow.test", Latency: 200 * time.Millisecond},
+		{Pattern: "reset.test", ResetRate: 1},
+		{Pattern: "error.test", ErrorStatus: http.StatusServiceUnavailable, ErrorRate: 0.6},
+		{Pattern: "lucky.test", ErrorStatus: http.StatusServiceUnavailable, ErrorRate: 0.4},
+		{Pattern: "narrow.test", Bandwidth: 100 << 10},
+	}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+
+	tests := []struct {
+		host       string
+		status     int
+		reason     string
+		reset      bool
+		minElapsed time.Duration
+	}{
+		{"slow.test", http.StatusOK, "", false, 200 * time.Millisecond},
+		{"reset.test", 0, "", true, 0},
+		{"error.test", http.StatusServiceUnavailable, "chaos", false, 0},
+		{"lucky.test", http.StatusOK, "", false, 0},
+		// 40 KiB at 100 KiB/s, less the 16 KiB burst.
+		{"narrow.test", http.StatusOK, "", false, 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		resp, err := client.Get("http://" + net.JoinHostPort(tt.host, port) + "/")
+		if tt.reset {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("GET %s succeeded; expected the connection to be reset", tt.host)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.host, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		elapsed := time.Since(start)
+		if resp.StatusCode != tt.status || resp.Header.Get(ErrorHeader) != tt.reason {
+			t.Errorf("GET %s = %d %q; expected %d %q", tt.host, resp.StatusCode, resp.Header.Get(ErrorHeader), tt.status, tt.reason)
+		}
+		if elapsed < tt.minElapsed {
+			t.Errorf("GET %s took %v; expected at least %v", tt.host, elapsed, tt.minElapsed)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// CheckStep is the outcome of one stage of an upstream check.
+type CheckStep struct {
+	Stage    string
+	Duration time.Duration
+	Detail   string
+	Err      error
+}
+
+// CheckUpstream walks through the stages of talking to the upstream proxy
+// (the first one, if several are configured):
+// name resolution, TCP connect, the TLS handshake with https:// upstreams,
+// a CONNECT to connectTarget, or its SOCKS4 counterpart with socks4:// and
+// socks4a:// upstreams, and a plain GET
+// for getURL through the upstream transport (including its authentication
+// handshake). It stops at the first failing stage, which is the last step
+// returned. An empty connectTarget or getURL skips that stage.
+func CheckUpstream(ctx context.Context, cfg config.Config, connectTarget, getURL string) []CheckStep {
+	var steps []CheckStep
+	run := func(stage string, fn func() (string, error)) bool {
+		start := time.Now()
+		detail, err := fn()
+		steps = append(steps, CheckStep{Stage: stage, Duration: time.Since(start), Detail: detail, Err: err})
+		return err == nil
+	}
+
+	if len(cfg.Upstreams()) == 0 {
+		return []CheckStep{{Stage: "config", Err: errors.New("no upstream proxy configured (UPSTREAM_PROXY)")}}
+	}
+	upstream := cfg.Upstreams()[0]
+	hostport, useTLS := splitUpstream(upstream)
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return []CheckStep{{Stage: "config", Err: fmt.Errorf("invalid upstream proxy address %q: %w", upstream, err)}}
+	}
+
+	var addrs []string
+	if !run("resolve", func() (string, error) {
+		addrs, err = newDialer(cfg).lookupHost(ctx, host)
+		return strings.Join(addrs, ", "), err
+	}) {
+		return steps
+	}
+
+	if !run("tcp connect", func() (string, error) {
+		dialer := &net.Dialer{Timeout: cfg.TransportDialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return "connected to " + conn.RemoteAddr().String(), nil
+	}) {
+		return steps
+	}
+
+	if useTLS && !run("tls handshake", func() (string, error) {
+		conn, err := dialUpstreamTLS(ctx, upstream, cfg, nil)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		state := conn.ConnectionState()
+		detail := tls.VersionName(state.Version) + ", verified " + state.ServerName
+		if cfg.UpstreamTLSCert != "" {
+			detail += ", client certificate presented"
+		}
+		return detail, nil
+	}) {
+		return steps
+	}
+
+	connectStage := "CONNECT "
+	if s, ok := parseSOCKSUpstream(upstream); ok {
+		connectStage = "SOCKS4 CONNECT "
+		if s.remoteDNS {
+			connectStage = "SOCKS4a CONNECT "
+		}
+	}
+	if connectTarget != "" && !run(connectStage+connectTarget, func() (string, error) {
+		return checkConnect(ctx, cfg, upstream, connectTarget)
+	}) {
+		return steps
+	}
+
+	if getURL != "" {
+		run("GET "+getURL, func() (string, error) {
+			return checkGet(ctx, cfg, getURL)
+		})
+	}
+	return steps
+}
+
+func checkConnect(ctx context.Context, cfg config.Config, upstream, target string) (string, error) {
+	if s, ok := parseSOCKSUpstream(upstream); ok {
+		conn, err := s.dial(ctx, target, cfg)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return "request granted", nil
+	}
+	conn, err := dialUpstreamConn(ctx, upstream, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(cfg.TunnelConnectReadWriteTimeout))
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target); err != nil {
+		return "", err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return "", fmt.Errorf("bad CONNECT response: %w", err)
+	}
+	return describeResponse(resp)
+}
+
+func checkGet(ctx context.Context, cfg config.Config, target string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{
+		Transport: NewUpstreamTransport(cfg),
+		Timeout:   cfg.ClientRequestTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	return describeResponse(resp)
+}
+
+// describeResponse treats any status below 400 as success, since a redirect
+// or similar still proves the upstream forwarded the request.
+func describeResponse(resp *http.Response) (string, error) {
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		schemes := resp.Header.Values("Proxy-Authenticate")
+		return "", fmt.Errorf("authentication failed: %s (upstream offers: %s)", resp.Status, strings.Join(schemes, ", "))
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("upstream responded %s", resp.Status)
+	}
+	return resp.Status, nil
+}
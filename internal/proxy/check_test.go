@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestCheckUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			w.Header().Set("Proxy-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = upstream.Listener.Addr().String()
+
+	steps := CheckUpstream(context.Background(), cfg, "", "http://example.invalid/")
+	if len(steps) != 3 {
+		t.Fatalf("steps = %+v; expected resolve, tcp connect and GET", steps)
+	}
+	for _, step := range steps {
+		if step.Err != nil {
+			t.Fatalf("stage %s failed: %v", step.Stage, step.Err)
+		}
+	}
+
+	steps = CheckUpstream(context.Background(), cfg, "example.invalid:443", "http://example.invalid/")
+	last := steps[len(steps)-1]
+	if last.Stage != "CONNECT example.invalid:443" || last.Err == nil || !strings.Contains(last.Err.Error(), "NTLM") {
+		t.Fatalf("last step = %+v; expected CONNECT authentication failure", last)
+	}
+}
+
+func TestCheckUpstreamTLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+	}))
+	t.Cleanup(upstream.Close)
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = "https://" + upstream.Listener.Addr().String()
+	cfg.UpstreamTLSCA = ca
+
+	steps := CheckUpstream(context.Background(), cfg, "example.invalid:443", "http://example.invalid/")
+	var stages []string
+	for _, step := range steps {
+		if step.Err != nil {
+			t.Fatalf("stage %s failed: %v", step.Stage, step.Err)
+		}
+		stages = append(stages, step.Stage)
+	}
+	expected := []string{"resolve", "tcp connect", "tls handshake", "CONNECT example.invalid:443", "GET http://example.invalid/"}
+	if strings.Join(stages, ",") != strings.Join(expected, ",") {
+		t.Errorf("stages = %q; expected %q", stages, expected)
+	}
+
+	cfg.UpstreamTLSCA = ""
+	steps = CheckUpstream(context.Background(), cfg, "example.invalid:443", "")
+	if last := steps[len(steps)-1]; last.Stage != "tls handshake" || last.Err == nil {
+		t.Errorf("last step = %+v; expected the handshake with an untrusted upstream to fail", last)
+	}
+}
+
+func TestCheckUpstreamSOCKS(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(backend.Close)
+	socks, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { socks.Close() })
+	go func() {
+		for {
+			conn, err := socks.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS4(conn, backend.Listener.Addr().String(), func(string, string) {})
+		}
+	}()
+
+	target := backend.Listener.Addr().String()
+	tests := []struct {
+		upstream string
+		stages   []string
+		failed   bool
+	}{
+		{"socks4://" + socks.Addr().String(), []string{"resolve", "tcp connect", "SOCKS4 CONNECT " + target, "GET http://" + target + "/"}, false},
+		{"socks4a://alice@" + socks.Addr().String(), []string{"resolve", "tcp connect", "SOCKS4a CONNECT " + target, "GET http://" + target + "/"}, false},
+		{"socks4a://blocked@" + socks.Addr().String(), []string{"resolve", "tcp connect", "SOCKS4a CONNECT " + target}, true},
+	}
+	for _, tt := range tests {
+		cfg := config.DefaultConfig()
+		cfg.UpstreamProxy = tt.upstream
+		steps := CheckUpstream(context.Background(), cfg, target, "http://"+target+"/")
+		var stages []string
+		for i, step := range steps {
+			stages = append(stages, step.Stage)
+			if failed := step.Err != nil; failed != (tt.failed && i == len(steps)-1) {
+				t.Errorf("%s: stage %s failed: %v", tt.upstream, step.Stage, step.Err)
+			}
+		}
+		if strings.Join(stages, ",") != strings.Join(tt.stages, ",") {
+			t.Errorf("%s: stages = %q; expected %q", tt.upstream, stages, tt.stages)
+		}
+	}
+}
+
+func TestCheckUpstreamNotConfigured(t *testing.T) {
+	steps := CheckUpstream(context.Background(), config.DefaultConfig(), "example.com:443", "")
+	if len(steps) != 1 || steps[0].Stage != "config" || steps[0].Err == nil {
+		t.Fatalf("steps = %+v; expected config failure", steps)
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// requireAuth wraps next so that requests must carry Basic proxy credentials
+// of one of CLIENT_AUTH_USERS. The PAC file is served without, since clients
+// fetch it before they know they need credentials.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !isPACRequest(req) {
+			cfg := s.stateFor(req).cfg
+			user, err := clientUser(req, cfg.ClientUsers)
+			s.audit.clientAuth(req, user, err, cfg)
+			if err != nil {
+				Warn.Printf("Rejected unauthenticated %s %s from %s", req.Method, req.Host, logClient(req.RemoteAddr))
+				s.webhooks.authFailure(usageClient(req))
+				w.Header().Set("Proxy-Authenticate", `Basic realm="DynamicProxy"`)
+				w.Header().Set(ErrorHeader, "auth-required")
+				http.Error(w, http.StatusText(http.StatusProxyAuthRequired), http.StatusProxyAuthRequired)
+				return
+			}
+			req = withClientUser(req, user)
+		}
+		// The credentials are for this proxy, not for whatever is next.
+		req.Header.Del("Proxy-Authorization")
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Reasons clientUser rejects credentials for.
+var (
+	errNoCredentials        = errors.New("no credentials")
+	errUnsupportedScheme    = errors.New("unsupported scheme")
+	errMalformedCredentials = errors.New("malformed credentials")
+	errUnknownUser          = errors.New("unknown user")
+	errWrongPassword        = errors.New("wrong password")
+)
+
+// clientUser returns the user authenticated by req's Proxy-Authorization
+// header. On error, user is the user the client claimed to be, if any.
+func clientUser(req *http.Request, users map[string]string) (user string, err error) {
+	header := req.Header.Get("Proxy-Authorization")
+	if header == "" {
+		return "", errNoCredentials
+	}
+	scheme, credentials, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Basic") {
+		return "", errUnsupportedScheme
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return "", errMalformedCredentials
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", errMalformedCredentials
+	}
+	expected, known := users[user]
+	switch {
+	case !known:
+		return user, errUnknownUser
+	case subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1:
+		return user, errWrongPassword
+	}
+	return user, nil
+}
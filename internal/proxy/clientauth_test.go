@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func serveListener(t *testing.T, cfg config.Config, listener config.Listener) (*Server, string) {
+	t.Helper()
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.ServeListener(l, listener) }()
+	t.Cleanup(func() { server.Close() })
+	return server, l.Addr().String()
+}
+
+func TestServeListenerAuth(t *testing.T) {
+	var gotAuth string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotAuth = req.Header.Get("Proxy-Authorization")
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.ClientUsers = map[string]string{"alice": "s3cret"}
+	_, addr := serveListener(t, cfg, config.Listener{Auth: true})
+
+	tests := []struct {
+		name     string
+		user     *url.Userinfo
+		expected int
+	}{
+		{"no credentials", nil, http.StatusProxyAuthRequired},
+		{"wrong password", url.UserPassword("alice", "wrong"), http.StatusProxyAuthRequired},
+		{"unknown user", url.UserPassword("bob", "s3cret"), http.StatusProxyAuthRequired},
+		{"valid", url.UserPassword("alice", "s3cret"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		proxyURL := &url.URL{Scheme: "http", Host: addr, User: tt.user}
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.expected {
+			t.Errorf("%s: status = %d; expected %d", tt.name, resp.StatusCode, tt.expected)
+		}
+		if resp.StatusCode == http.StatusProxyAuthRequired && resp.Header.Get("Proxy-Authenticate") == "" {
+			t.Errorf("%s: 407 without Proxy-Authenticate", tt.name)
+		}
+	}
+	if gotAuth != "" {
+		t.Errorf("backend received Proxy-Authorization %q; expected it to be stripped", gotAuth)
+	}
+
+	resp, err := http.Get("http://" + addr + pacPath)
+	if err != nil {
+		t.Fatalf("PAC request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("PAC status = %d; expected it to be served without credentials", resp.StatusCode)
+	}
+}
+
+func TestServeListenerTLS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	// Reuse the backend's certificate, which is valid for 127.0.0.1.
+	cert := backend.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.ListenTLSCert = filepath.Join(dir, "cert.pem")
+	cfg.ListenTLSKey = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(cfg.ListenTLSCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.ListenTLSKey, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, addr := serveListener(t, cfg, config.Listener{TLS: true})
+
+	transport := backend.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(&url.URL{Scheme: "https", Host: addr})
+	resp, err := (&http.Client{Transport: transport}).Get(backend.URL)
+	if err != nil {
+		t.Fatalf("request through TLS listener failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("response = %d %q; expected 200 \"ok\"", resp.StatusCode, body)
+	}
+}
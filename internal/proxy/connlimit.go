@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// errConnLimit is returned when a request waited DEST_CONN_WAIT for a free
+// connection slot to its destination without getting one.
+var errConnLimit = errors.New("destination connection limit reached")
+
+// connLimiter counts the connections open to each destination host, so
+// browsers opening dozens of connections do not trip per-user connection
+// caps of the upstream. It outlives configuration reloads: connections
+// opened under the old limits still count against the new ones.
+type connLimiter struct {
+	mu     sync.Mutex
+	active map[string]int
+	// released is closed, and replaced, whenever a slot is freed.
+	released chan struct{}
+}
+
+func newConnLimiter() *connLimiter {
+	return &connLimiter{active: make(map[string]int), released: make(chan struct{})}
+}
+
+// destLimit returns the connection limit for host: that of the first
+// matching DEST_CONN_LIMITS entry, or DEST_CONN_LIMIT. 0 means unlimited.
+func destLimit(host string, cfg config.Config) int {
+	for _, limit := range cfg.DestConnLimits {
+		if config.IsException(host, []string{limit.Pattern}) {
+			return limit.Limit
+		}
+	}
+	return cfg.DestConnLimit
+}
+
+// acquire waits until fewer than limit connections are open to key and
+// takes a slot, or returns errConnLimit once ctx is done.
+func (l *connLimiter) acquire(ctx context.Context, key string, limit int) error {
+	for {
+		l.mu.Lock()
+		if l.active[key] < limit {
+			l.active[key]++
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return errConnLimit
+		}
+	}
+}
+
+func (l *connLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[key]--; l.active[key] <= 0 {
+		delete(l.active, key)
+	}
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// limit holds a connection slot to the destination of req until the returned
+// function is called. It writes a 503 response and returns false if no slot
+// became free within DEST_CONN_WAIT.
+func (l *connLimiter) limit(w http.ResponseWriter, req *http.Request, cfg config.Config) (func(), bool) {
+	host, _, _ := net.SplitHostPort(targetAddr(req))
+	limit := destLimit(host, cfg)
+	if limit <= 0 {
+		return func() {}, true
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), cfg.DestConnWait)
+	defer cancel()
+	if err := l.acquire(ctx, host, limit); err != nil {
+		Warn.Printf("No connection slot for %s within %s (limit %d)", host, cfg.DestConnWait, limit)
+		trackedConnFrom(req).setError(err)
+		w.Header().Set(ErrorHeader, "connection-limit")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return func() { l.release(host) }, true
+}
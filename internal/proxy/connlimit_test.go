@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestDestLimit(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DestConnLimit = 6
+	cfg.DestConnLimits = []config.ConnLimit{{Pattern: "*.cdn.example", Limit: 20}, {Pattern: "intranet", Limit: 0}}
+
+	tests := []struct {
+		host     string
+		expected int
+	}{
+		{"www.example.com", 6},
+		{"img.cdn.example", 20},
+		{"intranet", 0},
+	}
+
+	for _, tt := range tests {
+		if got := destLimit(tt.host, cfg); got != tt.expected {
+			t.Errorf("destLimit(%q) = %d; expected %d", tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestConnLimiterWaitsForSlot(t *testing.T) {
+	l := newConnLimiter()
+	ctx := context.Background()
+	if err := l.acquire(ctx, "example.com", 1); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if err := l.acquire(ctx, "other.example", 1); err != nil {
+		t.Fatalf("acquire for another host: %v", err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(short, "example.com", 1); err != errConnLimit {
+		t.Fatalf("acquire over the limit = %v; expected errConnLimit", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.acquire(ctx, "example.com", 1) }()
+	time.Sleep(10 * time.Millisecond)
+	l.release("example.com")
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("acquire after release: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("acquire did not return after a slot was released")
+	}
+}
+
+func TestServerLimitsConnectionsPerDestination(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer backend.Close()
+	go func() {
+		// Keep tunnels open until the client closes its end.
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.DestConnLimit = 1
+	cfg.DestConnWait = 50 * time.Millisecond
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	connect := func() (net.Conn, *http.Response) {
+		t.Helper()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial proxy: %v", err)
+		}
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", backend.Addr(), backend.Addr())
+		resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+		if err != nil {
+			t.Fatalf("read CONNECT response: %v", err)
+		}
+		return conn, resp
+	}
+
+	first, resp := connect()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("first CONNECT status = %d; expected 200", resp.StatusCode)
+	}
+
+	second, resp := connect()
+	second.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second CONNECT status = %d; expected 503", resp.StatusCode)
+	}
+	if got := resp.Header.Get(ErrorHeader); got != "connection-limit" {
+		t.Fatalf("%s = %q; expected connection-limit", ErrorHeader, got)
+	}
+
+	first.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, resp := connect()
+		conn.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("CONNECT status after closing the first tunnel = %d; expected 200", resp.StatusCode)
+		}
+	}
+}
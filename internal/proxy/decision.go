@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// Decision is the routing outcome for a destination host.
+type Decision struct {
+	Host string
+	// Route is "direct" or "upstream".
+	Route string
+	// Rule is the exception pattern that sent the host direct, if any.
+	Rule string
+	// Addr is the resolved address that matched a CIDR Rule, if any.
+	Addr string
+	// DirectOnly is set when all traffic goes direct because of DIRECT_ONLY.
+	DirectOnly bool
+	// RemoteDNS is set when an upstream-routed host is left for the
+	// upstream to resolve because it matches REMOTE_DNS.
+	RemoteDNS bool
+	// Country is set when the host was sent upstream because it is located
+	// in a GEOIP_UPSTREAM country.
+	Country  string
+	Upstream string
+	Auth     string
+}
+
+// Decide determines how a request for host (as in the Host header or
+// CONNECT target) is routed under cfg.
+func Decide(host string, cfg config.Config) Decision {
+	d := Decision{Host: config.CanonicalHost(host)}
+	if cfg.DirectOnly {
+		d.Route = routeDirect
+		d.DirectOnly = true
+		return d
+	}
+	if len(cfg.GeoIPUpstream) > 0 {
+		if geo, ok := locate(host, cfg); ok && slices.Contains(cfg.GeoIPUpstream, geo.Country) {
+			d.Route = routeUpstream
+			d.Country = geo.Country
+			d.Upstream = cfg.UpstreamProxy
+			d.Auth = cfg.ProxyAuth
+			return d
+		}
+	}
+	if rule, ok := config.MatchException(host, cfg.ProxyExceptions); ok {
+		d.Route = routeDirect
+		d.Rule = rule
+		return d
+	}
+	if rule, addr, ok := matchResolved(host, cfg); ok {
+		d.Route = routeDirect
+		d.Rule = rule
+		d.Addr = addr
+		return d
+	}
+	d.Route = routeUpstream
+	d.RemoteDNS = resolvesRemotely(host, cfg)
+	d.Upstream = cfg.UpstreamProxy
+	d.Auth = cfg.ProxyAuth
+	return d
+}
+
+func (d Decision) Direct() bool {
+	return d.Route == routeDirect
+}
+
+// Reason names what decided the route: the exception pattern, "direct-only",
+// "geoip:" and the GEOIP_UPSTREAM country, or "default" for hosts sent to
+// the upstream because no exception matched.
+func (d Decision) Reason() string {
+	switch {
+	case d.DirectOnly:
+		return "direct-only"
+	case d.Country != "":
+		return "geoip:" + d.Country
+	case d.Rule != "":
+		return d.Rule
+	}
+	return "default"
+}
+
+// matchResolved matches the addresses host resolves to against the CIDR
+// exceptions. Nothing is resolved unless there are CIDR exceptions, and hosts
+// given as IP addresses were already matched by MatchException.
+func matchResolved(host string, cfg config.Config) (rule, addr string, ok bool) {
+	if !config.HasCIDRExceptions(cfg.ProxyExceptions) || resolvesRemotely(host, cfg) {
+		return "", "", false
+	}
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	name = strings.Trim(name, "[]")
+	if name == "" || net.ParseIP(name) != nil {
+		return "", "", false
+	}
+	for _, a := range resolveName(name, cfg) {
+		if ip := net.ParseIP(a); ip != nil {
+			if rule, ok := config.MatchExceptionIP(ip, cfg.ProxyExceptions); ok {
+				return rule, a, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// hostName returns host without its port and IPv6 brackets.
+func hostName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		return name
+	}
+	return strings.Trim(host, "[]")
+}
+
+// literalAddr returns the address host (with or without port) spells out,
+// if it is an IP address.
+func literalAddr(host string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(hostName(host))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+// resolveName returns the addresses the direct dialer would connect to for
+// name, honoring HOST_MAP, or nil if it does not resolve.
+func resolveName(name string, cfg config.Config) []string {
+	d := newDirectDialer(cfg)
+	if mapped, _ := d.mapHost(name, ""); net.ParseIP(mapped) != nil {
+		return []string{mapped}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TransportDialTimeout)
+	defer cancel()
+	addrs, err := d.lookupHost(ctx, name)
+	if err != nil {
+		return nil
+	}
+	return addrs
+}
+
+// resolvesRemotely reports whether host matches REMOTE_DNS, i.e. must never
+// be resolved locally so that only the upstream sees the lookup. IP
+// addresses need no resolution.
+func resolvesRemotely(host string, cfg config.Config) bool {
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	if net.ParseIP(strings.Trim(name, "[]")) != nil {
+		return false
+	}
+	return config.IsException(host, cfg.RemoteDNS)
+}
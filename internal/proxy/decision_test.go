@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestDecide(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = "corporate.proxy:8080"
+	cfg.ProxyAuth = "ntlm"
+	cfg.ProxyExceptions = []string{"localhost", "*.example.com"}
+
+	tests := []struct {
+		host     string
+		expected Decision
+	}{
+		{"api.example.com:443", Decision{Host: "api.example.com:443", Route: "direct", Rule: "*.example.com"}},
+		{"localhost:8080", Decision{Host: "localhost:8080", Route: "direct", Rule: "localhost"}},
+		{"golang.org", Decision{Host: "golang.org", Route: "upstream", Upstream: "corporate.proxy:8080", Auth: "ntlm"}},
+	}
+
+	for _, tt := range tests {
+		if got := Decide(tt.host, cfg); got != tt.expected {
+			t.Errorf("Decide(%q) = %+v; expected %+v", tt.host, got, tt.expected)
+		}
+	}
+
+	cfg.DirectOnly = true
+	expected := Decision{Host: "golang.org", Route: "direct", DirectOnly: true}
+	if got := Decide("golang.org", cfg); got != expected {
+		t.Errorf("Decide in direct-only mode = %+v; expected %+v", got, expected)
+	}
+}
+
+func TestDecideByResolvedAddress(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = "corporate.proxy:8080"
+	cfg.DNSServers = []string{startDNSServer(t)}
+	cfg.HostMap = map[string]string{"partner.example": "203.0.113.7"}
+	cfg.ProxyExceptions = []string{"127.0.0.0/8", "203.0.113.0/24"}
+
+	tests := []struct {
+		host     string
+		expected Decision
+	}{
+		{"intranet.corp:443", Decision{Host: "intranet.corp:443", Route: "direct", Rule: "127.0.0.0/8", Addr: "127.0.0.1"}},
+		{"partner.example", Decision{Host: "partner.example", Route: "direct", Rule: "203.0.113.0/24", Addr: "203.0.113.7"}},
+		{"127.0.0.2:80", Decision{Host: "127.0.0.2:80", Route: "direct", Rule: "127.0.0.0/8"}},
+		{"198.51.100.1", Decision{Host: "198.51.100.1", Route: "upstream", Upstream: "corporate.proxy:8080"}},
+	}
+
+	for _, tt := range tests {
+		if got := Decide(tt.host, cfg); got != tt.expected {
+			t.Errorf("Decide(%q) = %+v; expected %+v", tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestDecideLeavesRemoteDNSHostsUnresolved(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = "corporate.proxy:8080"
+	cfg.DNSServers = []string{startDNSServer(t)}
+	cfg.ProxyExceptions = []string{"127.0.0.0/8"}
+	cfg.RemoteDNS = []string{"*.partner.example"}
+	cfg.FailOpen = true
+
+	expected := Decision{Host: "api.partner.example:443", Route: "upstream", RemoteDNS: true, Upstream: "corporate.proxy:8080"}
+	if got := Decide("api.partner.example:443", cfg); got != expected {
+		t.Errorf("Decide = %+v; expected %+v", got, expected)
+	}
+	if got := Decide("127.0.0.5", cfg); got.RemoteDNS || !got.Direct() {
+		t.Errorf("Decide(127.0.0.5) = %+v; expected IP addresses to be matched directly", got)
+	}
+	if canFailOpen("api.partner.example:443", cfg) {
+		t.Errorf("expected REMOTE_DNS hosts never to fail open")
+	}
+	if !canFailOpen("www.example.org:443", cfg) {
+		t.Errorf("expected other hosts to fail open")
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// DecisionHeader names the route of a request or tunnel and the rule that
+// chose it, e.g. "direct; rule=*.corp.example", on responses to clients
+// when DECISION_HEADER is set.
+const DecisionHeader = "X-DynamicProxy-Decision"
+
+// routeBlocked is the route of requests refused by THREAT_FEEDS,
+// GEOIP_BLOCK or APP_ROUTES.
+const routeBlocked = "blocked"
+
+// DecisionCount is how many requests and tunnels a rule sent direct,
+// upstream or refused.
+type DecisionCount struct {
+	Route string `json:"route"`
+	Rule  string `json:"rule"`
+	Count int64  `json:"count"`
+}
+
+type decisionKey struct {
+	route, rule string
+}
+
+// decisionCounts counts routing decisions per route and rule since the
+// server started. Like the breakers, it outlives configuration reloads.
+type decisionCounts struct {
+	mu     sync.Mutex
+	counts map[decisionKey]int64
+}
+
+func newDecisionCounts() *decisionCounts {
+	return &decisionCounts{counts: make(map[decisionKey]int64)}
+}
+
+// decide counts that rule sent a request or tunnel route and, with
+// DECISION_HEADER, names the decision on the response w is about to write.
+func (d *decisionCounts) decide(w http.ResponseWriter, route, rule string, cfg config.Config) {
+	if cfg.DecisionHeader {
+		w.Header().Set(DecisionHeader, route+"; rule="+rule)
+	}
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.counts[decisionKey{route, rule}]++
+	d.mu.Unlock()
+}
+
+func (d *decisionCounts) snapshot() []DecisionCount {
+	d.mu.Lock()
+	out := make([]DecisionCount, 0, len(d.counts))
+	for k, n := range d.counts {
+		out = append(out, DecisionCount{Route: k.route, Rule: k.rule, Count: n})
+	}
+	d.mu.Unlock()
+	slices.SortFunc(out, func(a, b DecisionCount) int {
+		return cmp.Or(cmp.Compare(a.Route, b.Route), cmp.Compare(a.Rule, b.Rule))
+	})
+	return out
+}
+
+// Decisions reports how many requests and tunnels each rule sent direct,
+// upstream or refused since the server started.
+func (s *Server) Decisions() []DecisionCount {
+	return s.decided.snapshot()
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestDecisionReason(t *testing.T) {
+	tests := []struct {
+		decision Decision
+		expected string
+	}{
+		{Decision{Route: routeDirect, DirectOnly: true}, "direct-only"},
+		{Decision{Route: routeDirect, Rule: "*.corp.example"}, "*.corp.example"},
+		{Decision{Route: routeUpstream, Country: "DE"}, "geoip:DE"},
+		{Decision{Route: routeUpstream}, "default"},
+	}
+	for _, tt := range tests {
+		if got := tt.decision.Reason(); got != tt.expected {
+			t.Errorf("Reason of %+v = %q; expected %q", tt.decision, got, tt.expected)
+		}
+	}
+}
+
+func TestDecisionCounts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = backend.Listener.Addr().String()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.DecisionHeader = true
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	proxyURL, _ := url.Parse("http://" + l.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{backend.URL, "direct; rule=127.0.0.1"},
+		{"http://intranet.test/", "upstream; rule=default"},
+		{"http://intranet.test/again", "upstream; rule=default"},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.url, err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get(DecisionHeader); got != tt.expected {
+			t.Errorf("GET %s: %s %q; expected %q", tt.url, DecisionHeader, got, tt.expected)
+		}
+	}
+
+	got := fmt.Sprint(server.Decisions())
+	if expected := "[{direct 127.0.0.1 1} {upstream default 2}]"; got != expected {
+		t.Errorf("decisions = %s; expected %s", got, expected)
+	}
+}
+
+func TestDecisionHeaderOff(t *testing.T) {
+	rec := httptest.NewRecorder()
+	counts := newDecisionCounts()
+	counts.decide(rec, routeBlocked, "app:curl", config.DefaultConfig())
+	if got := rec.Header().Get(DecisionHeader); got != "" {
+		t.Errorf("%s = %q without DECISION_HEADER", DecisionHeader, got)
+	}
+	if got := fmt.Sprint(counts.snapshot()); got != "[{blocked app:curl 1}]" {
+		t.Errorf("decisions = %s", got)
+	}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// demoteWindow is how long outcomes are counted towards an upstream's
+// error rate before the count starts over.
+const demoteWindow = time.Minute
+
+// demotions tracks the share of requests and tunnels through each upstream
+// that fail, with a 5xx response or an error, and demotes an upstream whose
+// share reaches UPSTREAM_DEMOTE_ERROR_RATE percent of at least
+// UPSTREAM_DEMOTE_MIN_REQUESTS within a minute: for UPSTREAM_DEMOTE_DURATION
+// it is tried after the others, though still before the ones that failed
+// their health check. Like the breakers, it outlives configuration reloads.
+type demotions struct {
+	mu        sync.Mutex
+	upstreams map[string]*upstreamErrors
+	now       func() time.Time
+	notify    func(event, subject, message string)
+}
+
+type upstreamErrors struct {
+	windowStart     time.Time
+	requests, fails int
+	demotedUntil    time.Time
+	demotions       int
+}
+
+func newDemotions() *demotions {
+	return &demotions{upstreams: make(map[string]*upstreamErrors), now: time.Now}
+}
+
+// record counts the outcome of a request or tunnel through addr.
+func (d *demotions) record(addr string, failed bool, cfg config.Config) {
+	if d == nil || cfg.UpstreamDemoteErrorRate <= 0 {
+		return
+	}
+	now := d.now()
+	d.mu.Lock()
+	u := d.upstreams[addr]
+	if u == nil {
+		u = &upstreamErrors{windowStart: now}
+		d.upstreams[addr] = u
+	}
+	if now.Sub(u.windowStart) > demoteWindow {
+		u.windowStart, u.requests, u.fails = now, 0, 0
+	}
+	u.requests++
+	if failed {
+		u.fails++
+	}
+	if u.requests < cfg.UpstreamDemoteMinRequests || u.fails*100 < cfg.UpstreamDemoteErrorRate*u.requests || now.Before(u.demotedUntil) {
+		d.mu.Unlock()
+		return
+	}
+	msg := fmt.Sprintf("Upstream %s demoted for %s: %d of %d requests failed", addr, cfg.UpstreamDemoteDuration, u.fails, u.requests)
+	u.demotedUntil = now.Add(cfg.UpstreamDemoteDuration)
+	u.demotions++
+	u.windowStart, u.requests, u.fails = now, 0, 0
+	d.mu.Unlock()
+	Warn.Print(msg)
+	if d.notify != nil {
+		d.notify(EventUpstreamDemoted, addr, msg)
+	}
+}
+
+// demoted reports whether addr is demoted.
+func (d *demotions) demoted(addr string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u := d.upstreams[addr]
+	return u != nil && d.now().Before(u.demotedUntil)
+}
+
+// report adds addr's error rate and demotion to its health.
+func (d *demotions) report(health *UpstreamHealth) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u := d.upstreams[health.Addr]
+	if u == nil {
+		return
+	}
+	if u.requests > 0 {
+		health.ErrorRate = float64(u.fails) / float64(u.requests)
+	}
+	if d.now().Before(u.demotedUntil) {
+		health.DemotedUntil = u.demotedUntil
+	}
+	health.Demotions = u.demotions
+}
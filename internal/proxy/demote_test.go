@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestUpstreamDemotion(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.UpstreamDemoteErrorRate = 50
+	cfg.UpstreamDemoteMinRequests = 4
+	cfg.UpstreamDemoteDuration = 5 * time.Minute
+
+	now := time.Unix(1_700_000_000, 0)
+	d := newDemotions()
+	d.now = func() time.Time { return now }
+	var events []string
+	d.notify = func(event, subject, _ string) { events = append(events, event+" "+subject) }
+	transports := requestTransports{
+		upstreams: []upstreamTransport{{addr: "proxy-a:3128"}, {addr: "proxy-b:3128"}},
+		demotions: d,
+	}
+	first := func() string { return transports.preferred()[0].addr }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		fails   []bool
+		first   string
+	}{
+		{"too few requests", 0, []bool{true, true, true}, "proxy-a:3128"},
+		{"window expired", 2 * time.Minute, []bool{true, false, false, false}, "proxy-a:3128"},
+		{"error rate reached", 0, []bool{true, true, false, true}, "proxy-b:3128"},
+		{"still demoted", 4 * time.Minute, nil, "proxy-b:3128"},
+		{"demotion over", 2 * time.Minute, nil, "proxy-a:3128"},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		for _, failed := range tt.fails {
+			d.record("proxy-a:3128", failed, cfg)
+		}
+		if got := first(); got != tt.first {
+			t.Errorf("%s: %s is tried first; expected %s", tt.name, got, tt.first)
+		}
+	}
+	if len(events) != 1 || events[0] != EventUpstreamDemoted+" proxy-a:3128" {
+		t.Errorf("events = %q; expected one demotion of proxy-a:3128", events)
+	}
+
+	health := UpstreamHealth{Addr: "proxy-a:3128"}
+	d.record("proxy-a:3128", true, cfg)
+	d.report(&health)
+	if health.Demotions != 1 || health.ErrorRate != 1 || !health.DemotedUntil.IsZero() {
+		t.Errorf("health = %+v; expected one past demotion and an error rate of 1", health)
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+// PoolStats reports the connections the server keeps open for reuse and
+// the contents of its DNS cache. The idle connections of the request
+// transports are not observable and not included.
+type PoolStats struct {
+	// Generation counts the configurations installed since startup.
+	Generation    uint64        `json:"generation"`
+	SpareTunnels  int           `json:"spareTunnels"`
+	UpstreamHTTP2 int           `json:"upstreamHTTP2"`
+	DNSCache      DNSCacheStats `json:"dnsCache"`
+}
+
+// Pools reports the server's connection pools, for diagnostics.
+func (s *Server) Pools() PoolStats {
+	stats := PoolStats{Generation: s.state.Load().generation, DNSCache: resolveCache.stats()}
+	s.tunnels.mu.Lock()
+	stats.SpareTunnels = len(s.tunnels.spares)
+	s.tunnels.mu.Unlock()
+	upstreamH2.mu.Lock()
+	stats.UpstreamHTTP2 = len(upstreamH2.conns)
+	upstreamH2.mu.Unlock()
+	return stats
+}
@@ -0,0 +1,372 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// outboundDialer opens every outbound connection of the proxy, to
+// destinations and upstreams alike. Host names are resolved through
+// DNS_SERVERS if set, or the host resolver otherwise, and the resulting
+// addresses are raced Happy Eyeballs style (RFC 8305).
+type outboundDialer struct {
+	timeout     time.Duration
+	delay       time.Duration
+	disableIPv4 bool
+	disableIPv6 bool
+	resolvers   []serverResolver
+	routes      []dnsRoute
+	dnsTimeout  time.Duration
+	dnsSearch   []string
+	dnsNdots    int
+	// hosts maps names to ip[:port] ahead of DNS; only direct dialers have it.
+	hosts map[string]string
+	// cache is nil when DNS_CACHE is disabled.
+	cache       *dnsCache
+	cacheTTL    time.Duration
+	cacheNegTTL time.Duration
+	// dialAddr connects to a single IP address, from OUTBOUND_BIND if set.
+	dialAddr func(ctx context.Context, network, addr string) (net.Conn, error)
+	binds    []bindRoute
+}
+
+type serverResolver struct {
+	server   string
+	resolver *net.Resolver
+}
+
+// dnsRoute is a DNS_ROUTES entry: names matching pattern are resolved by
+// resolvers instead of the dialer's default ones.
+type dnsRoute struct {
+	pattern   string
+	resolvers []serverResolver
+}
+
+func newServerResolvers(servers []string) []serverResolver {
+	var resolvers []serverResolver
+	for _, server := range servers {
+		resolvers = append(resolvers, serverResolver{server: server, resolver: newServerResolver(server)})
+	}
+	return resolvers
+}
+
+func newDialer(cfg config.Config) *outboundDialer {
+	dialer := netDialer(cfg)
+	d := &outboundDialer{
+		timeout:     cfg.TransportDialTimeout,
+		delay:       cfg.HappyEyeballsDelay,
+		disableIPv4: cfg.DisableIPv4,
+		disableIPv6: cfg.DisableIPv6,
+		dnsTimeout:  cfg.DNSTimeout,
+		dnsSearch:   cfg.DNSSearch,
+		dnsNdots:    cfg.DNSNdots,
+		dialAddr:    boundDialer(dialer, cfg.OutboundBind),
+		binds:       newBindRoutes(dialer, cfg.OutboundBindRoutes),
+		cacheTTL:    cfg.DNSCacheTTL,
+		cacheNegTTL: cfg.DNSCacheNegTTL,
+	}
+	if cfg.DNSCache {
+		d.cache = resolveCache
+	}
+	d.resolvers = newServerResolvers(cfg.DNSServers)
+	for _, route := range cfg.DNSRoutes {
+		d.routes = append(d.routes, dnsRoute{pattern: route.Pattern, resolvers: newServerResolvers(route.Servers)})
+	}
+	return d
+}
+
+func netDialer(cfg config.Config) net.Dialer {
+	return net.Dialer{Timeout: cfg.TransportDialTimeout, KeepAlive: cfg.TransportKeepAlive}
+}
+
+// newDirectDialer returns the dialer for connections straight to a
+// destination, which consult HOST_MAP and then resolve through
+// DIRECT_DNS_SERVERS when set.
+func newDirectDialer(cfg config.Config) *outboundDialer {
+	if len(cfg.DirectDNSServers) > 0 {
+		cfg.DNSServers = cfg.DirectDNSServers
+	}
+	d := newDialer(cfg)
+	d.hosts = cfg.HostMap
+	return d
+}
+
+// dial connects to addr within TRANSPORT_DIAL_TIMEOUT.
+func (d *outboundDialer) dial(addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), "tcp", addr)
+}
+
+func (d *outboundDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	d = d.bound(host)
+	if host == "" {
+		return d.dialAddr(ctx, network, addr)
+	}
+	host, port = d.mapHost(host, port)
+
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := d.lookupHost(ctx, host)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		for _, a := range addrs {
+			if ip := net.ParseIP(a); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	ips = d.interleave(network, ips)
+	if len(ips) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("no usable address for %s (IPv4 disabled: %t, IPv6 disabled: %t)", host, d.disableIPv4, d.disableIPv6)}
+	}
+	conn, err := d.race(ctx, network, port, ips)
+	if err != nil {
+		// The addresses may be stale, e.g. after a DNS-based failover:
+		// resolve again on the next attempt.
+		d.forget(host)
+	}
+	return conn, err
+}
+
+// forget drops the cached resolution of host.
+func (d *outboundDialer) forget(host string) {
+	if d.cache != nil {
+		d.cache.delete(d.routed(host).cacheKey(host))
+	}
+}
+
+// mapHost applies HOST_MAP to host:port. A mapping without a port keeps the
+// requested one.
+func (d *outboundDialer) mapHost(host, port string) (string, string) {
+	target, ok := d.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+	if !ok {
+		return host, port
+	}
+	if h, p, err := net.SplitHostPort(target); err == nil {
+		return h, p
+	}
+	return strings.Trim(target, "[]"), port
+}
+
+// interleave drops addresses of disabled families and alternates between
+// IPv6 and IPv4, starting with IPv6, as RFC 8305 recommends.
+func (d *outboundDialer) interleave(network string, ips []net.IP) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if !d.disableIPv4 && network != "tcp6" {
+				v4 = append(v4, ip)
+			}
+		} else if !d.disableIPv6 && network != "tcp4" {
+			v6 = append(v6, ip)
+		}
+	}
+	out := make([]net.IP, 0, len(v4)+len(v6))
+	for i := range max(len(v4), len(v6)) {
+		if i < len(v6) {
+			out = append(out, v6[i])
+		}
+		if i < len(v4) {
+			out = append(out, v4[i])
+		}
+	}
+	return out
+}
+
+// race starts a connection attempt to each address in turn, launching the
+// next one when the previous attempt fails or HAPPY_EYEBALLS_DELAY passes
+// without an answer. The first connection established wins; the others are
+// cancelled.
+func (d *outboundDialer) race(ctx context.Context, network, port string, ips []net.IP) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(ips))
+	next, pending := 0, 0
+	start := func() {
+		addr := net.JoinHostPort(ips[next].String(), port)
+		next++
+		pending++
+		go func() {
+			conn, err := d.dialAddr(ctx, network, addr)
+			results <- result{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(d.delay)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go func(n int) {
+					for range n {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(ips) {
+				start()
+				timer.Reset(d.delay)
+			}
+		case <-timer.C:
+			if next < len(ips) {
+				start()
+				timer.Reset(d.delay)
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+// lookupHost resolves host through the DNS_ROUTES entry matching it, if any,
+// answering from the DNS cache when possible.
+// Answers from DNS servers are cached for the TTL of their records, those of
+// the host resolver for DNS_CACHE_TTL, and "no such host" answers for
+// DNS_CACHE_NEGATIVE_TTL. Other failures are not cached.
+func (d *outboundDialer) lookupHost(ctx context.Context, host string) ([]string, error) {
+	d = d.routed(host)
+	if d.cache == nil {
+		return d.resolve(ctx, host)
+	}
+	key := d.cacheKey(host)
+	if addrs, err, ok := d.cache.get(key); ok {
+		return addrs, err
+	}
+
+	rec := &ttlRecorder{}
+	addrs, err := d.resolve(withTTLRecorder(ctx, rec), host)
+	switch {
+	case err == nil:
+		ttl := d.cacheTTL
+		if len(d.resolvers) > 0 {
+			ttl, _ = rec.result()
+		}
+		d.cache.put(key, addrs, nil, ttl)
+	case isNotFound(err):
+		d.cache.put(key, nil, err, d.cacheNegTTL)
+	}
+	return addrs, err
+}
+
+// routed returns d resolving through the servers of the first DNS_ROUTES
+// entry matching host, or d itself if none matches.
+func (d *outboundDialer) routed(host string) *outboundDialer {
+	for _, route := range d.routes {
+		if config.IsException(host, []string{route.pattern}) {
+			routed := *d
+			routed.resolvers = route.resolvers
+			return &routed
+		}
+	}
+	return d
+}
+
+// cacheKey identifies a lookup of host: the same name may resolve
+// differently through other DNS servers or search domains.
+func (d *outboundDialer) cacheKey(host string) string {
+	var b strings.Builder
+	for _, r := range d.resolvers {
+		b.WriteString(r.server)
+		b.WriteByte(',')
+	}
+	fmt.Fprintf(&b, "%v/%d %s", d.dnsSearch, d.dnsNdots, host)
+	return b.String()
+}
+
+// resolve resolves host through the configured DNS servers, applying
+// DNS_SEARCH and DNS_NDOTS rather than the host's resolv.conf. Without DNS
+// servers the host resolver is used.
+func (d *outboundDialer) resolve(ctx context.Context, host string) ([]string, error) {
+	if len(d.resolvers) == 0 {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+	var err error
+	for _, name := range d.searchNames(host) {
+		var addrs []string
+		addrs, err = d.lookupName(ctx, name)
+		if err == nil || !isNotFound(err) {
+			return addrs, err
+		}
+	}
+	return nil, err
+}
+
+// searchNames lists the fully qualified names to try for host, like a stub
+// resolver: names with at least DNS_NDOTS dots are tried as is before the
+// search domains are appended, other names after.
+func (d *outboundDialer) searchNames(host string) []string {
+	if strings.HasSuffix(host, ".") {
+		return []string{host}
+	}
+	var names []string
+	for _, domain := range d.dnsSearch {
+		names = append(names, host+"."+strings.Trim(domain, ".")+".")
+	}
+	if strings.Count(host, ".") >= d.dnsNdots {
+		return append([]string{host + "."}, names...)
+	}
+	return append(names, host+".")
+}
+
+// lookupName resolves a fully qualified name through the configured DNS
+// servers in order, moving on to the next server when one fails or does not
+// answer within DNS_TIMEOUT. An authoritative "no such host" answer is
+// returned right away.
+func (d *outboundDialer) lookupName(ctx context.Context, name string) ([]string, error) {
+	var errs []error
+	for _, r := range d.resolvers {
+		queryCtx, cancel := context.WithTimeout(ctx, d.dnsTimeout)
+		addrs, err := r.resolver.LookupHost(queryCtx, name)
+		cancel()
+		if err == nil {
+			return addrs, nil
+		}
+		if isNotFound(err) {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		Warn.Printf("DNS server %s failed to resolve %s, trying next: %v", r.server, name, err)
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,292 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// startDNSServer answers A queries for every name with 127.0.0.1 and
+// returns NXDOMAIN for names in missing.
+func startDNSServer(t *testing.T, missing ...string) string {
+	return serveDNS(t, func(q dnsmessage.Question) ([]dnsmessage.Resource, dnsmessage.RCode) {
+		for _, name := range missing {
+			if q.Name.String() == name+"." {
+				return nil, dnsmessage.RCodeNameError
+			}
+		}
+		if q.Type != dnsmessage.TypeA {
+			return nil, dnsmessage.RCodeSuccess
+		}
+		return []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+		}}, dnsmessage.RCodeSuccess
+	})
+}
+
+// serveDNS starts a UDP DNS server answering every question with answer.
+func serveDNS(t *testing.T, answer func(q dnsmessage.Question) ([]dnsmessage.Resource, dnsmessage.RCode)) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+				continue
+			}
+			msg.Header.Response = true
+			msg.Header.Authoritative = true
+			msg.Answers, msg.Header.RCode = answer(msg.Questions[0])
+			out, err := msg.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = pc.WriteTo(out, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func deadDNSServer(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	return addr
+}
+
+func TestDialerFailsOverBetweenDNSServers(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Addr().String())
+
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{deadDNSServer(t), startDNSServer(t)}
+
+	conn, err := newDialer(cfg).dial(net.JoinHostPort("service.corp.test", port))
+	if err != nil {
+		t.Fatalf("dial via second DNS server: %v", err)
+	}
+	conn.Close()
+}
+
+func TestDialerStopsAtNotFound(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{startDNSServer(t, "missing.corp.test"), startDNSServer(t)}
+
+	_, err := newDialer(cfg).lookupHost(context.Background(), "missing.corp.test")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("lookup error = %v; expected not found from the first server", err)
+	}
+}
+
+func TestDialerInterleavesFamilies(t *testing.T) {
+	ips := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("2001:db8::1")}
+
+	tests := []struct {
+		name     string
+		dialer   outboundDialer
+		network  string
+		expected []string
+	}{
+		{"both families", outboundDialer{}, "tcp", []string{"2001:db8::1", "192.0.2.1", "192.0.2.2"}},
+		{"IPv6 disabled", outboundDialer{disableIPv6: true}, "tcp", []string{"192.0.2.1", "192.0.2.2"}},
+		{"IPv4 disabled", outboundDialer{disableIPv4: true}, "tcp", []string{"2001:db8::1"}},
+		{"tcp4 network", outboundDialer{}, "tcp4", []string{"192.0.2.1", "192.0.2.2"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, ip := range tt.dialer.interleave(tt.network, ips) {
+			got = append(got, ip.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: interleave = %v; expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestDialerRacesAddresses(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Addr().String())
+
+	// The IPv6 address hangs until cancelled, like a broken IPv6 route.
+	hung := make(chan error, 1)
+	d := newDialer(config.DefaultConfig())
+	d.delay = 20 * time.Millisecond
+	d.dialAddr = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasPrefix(addr, "[") {
+			<-ctx.Done()
+			hung <- ctx.Err()
+			return nil, ctx.Err()
+		}
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	start := time.Now()
+	conn, err := d.race(context.Background(), "tcp", port, []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("race: %v", err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("race took %v; expected the IPv4 attempt after ~20ms", elapsed)
+	}
+	select {
+	case <-hung:
+	case <-time.After(time.Second):
+		t.Fatal("hung IPv6 attempt was not cancelled")
+	}
+}
+
+func TestDialerRejectsDisabledFamily(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DisableIPv4 = true
+	if _, err := newDialer(cfg).dial("127.0.0.1:80"); err == nil {
+		t.Fatal("expected dialing an IPv4 address to fail with IPv4 disabled")
+	}
+}
+
+func TestDialerSearchNames(t *testing.T) {
+	d := outboundDialer{dnsSearch: []string{"corp.test", ".lab.test."}, dnsNdots: 1}
+
+	tests := []struct {
+		host     string
+		expected []string
+	}{
+		{"api", []string{"api.corp.test.", "api.lab.test.", "api."}},
+		{"api.eu", []string{"api.eu.", "api.eu.corp.test.", "api.eu.lab.test."}},
+		{"example.com.", []string{"example.com."}},
+	}
+
+	for _, tt := range tests {
+		if got := d.searchNames(tt.host); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("searchNames(%q) = %v; expected %v", tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestDialerTriesSearchDomains(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{startDNSServer(t, "api.corp.test")}
+	cfg.DNSSearch = []string{"corp.test"}
+
+	addrs, err := newDialer(cfg).lookupHost(context.Background(), "api")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Fatalf("addrs = %v; expected [127.0.0.1] from the bare name", addrs)
+	}
+}
+
+func TestDialerResolvesOverHTTPS(t *testing.T) {
+	dns := startDNSServer(t)
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		conn, err := net.Dial("udp", dns)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write(query)
+		answer := make([]byte, 512)
+		n, err := conn.Read(answer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(answer[:n])
+	}))
+	defer doh.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.DirectDNSServers = []string{doh.URL + "/dns-query"}
+	cfg.DNSServers = []string{deadDNSServer(t)}
+
+	addrs, err := newDirectDialer(cfg).lookupHost(context.Background(), "example.test")
+	if err != nil {
+		t.Fatalf("lookupHost over DoH: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Fatalf("addrs = %v; expected [127.0.0.1]", addrs)
+	}
+	if _, err := newDialer(cfg).lookupHost(context.Background(), "example.test"); err == nil {
+		t.Fatalf("expected the upstream dialer to keep using DNS_SERVERS")
+	}
+}
+
+func TestDirectDialerUsesHostMap(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer target.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{deadDNSServer(t)}
+	cfg.HostMap = map[string]string{"staging.example": target.Addr().String()}
+
+	conn, err := newDirectDialer(cfg).dial("Staging.Example.:443")
+	if err != nil {
+		t.Fatalf("dial mapped host: %v", err)
+	}
+	conn.Close()
+	if _, err := newDialer(cfg).dial("staging.example:443"); err == nil {
+		t.Fatalf("expected the upstream dialer to ignore HOST_MAP")
+	}
+}
+
+func TestDialerRoutesLookupsByPattern(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{deadDNSServer(t)}
+	cfg.DNSRoutes = []config.DNSRoute{{Pattern: "*.corp.example", Servers: []string{startDNSServer(t)}}}
+	d := newDialer(cfg)
+
+	if addrs, err := d.lookupHost(context.Background(), "wiki.corp.example"); err != nil || len(addrs) != 1 {
+		t.Fatalf("lookupHost(wiki.corp.example) = %v, %v; expected the internal server's answer", addrs, err)
+	}
+	if _, err := d.lookupHost(context.Background(), "www.example.org"); err == nil {
+		t.Fatalf("expected other names to use DNS_SERVERS")
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// newServerResolver returns a resolver that sends every query to server,
+// which is a plain DNS server (host:port), a DNS-over-TLS server
+// (tls://host:port) or a DNS-over-HTTPS URL.
+func newServerResolver(server string) *net.Resolver {
+	var dial func(ctx context.Context, network string) (net.Conn, error)
+	switch {
+	case strings.HasPrefix(server, "https://"), strings.HasPrefix(server, "http://"):
+		client := &http.Client{}
+		dial = func(ctx context.Context, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, client: client, url: server}, nil
+		}
+	case strings.HasPrefix(server, "tls://"):
+		addr := strings.TrimPrefix(server, "tls://")
+		host, _, _ := net.SplitHostPort(addr)
+		dial = func(ctx context.Context, _ string) (net.Conn, error) {
+			d := tls.Dialer{Config: &tls.Config{ServerName: host}}
+			return d.DialContext(ctx, "tcp", addr)
+		}
+	default:
+		dial = func(ctx context.Context, network string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		}
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			conn, err := dial(ctx, network)
+			if err != nil {
+				return nil, err
+			}
+			return recordTTLs(ctx, conn), nil
+		},
+	}
+}
+
+// dohConn carries the Go resolver's DNS-over-TCP exchange (two-byte length
+// prefix, then the message) over DNS-over-HTTPS (RFC 8484): each query
+// written is POSTed to the DoH endpoint and the answer is read back.
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	url      string
+	deadline time.Time
+	answer   bytes.Reader
+}
+
+const maxDNSMessage = 65535
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+		return 0, errors.New("doh: expected a single length-prefixed DNS message")
+	}
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(b[2:]))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("doh: %s answered %s", c.url, resp.Status)
+	}
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessage+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(msg) > maxDNSMessage {
+		return 0, errors.New("doh: answer too large")
+	}
+	answer := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	c.answer.Reset(append(answer, msg...))
+	return len(b), nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	return c.answer.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.url) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.url) }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { c.deadline = t; return nil }
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "doh" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxDNSCacheEntries bounds the cache; expired entries are evicted first,
+// then arbitrary ones.
+const maxDNSCacheEntries = 4096
+
+// resolveCache holds the resolutions of every outbound dialer, so that
+// health checks and dials to the same destinations share lookups across
+// configuration reloads.
+var resolveCache = newDNSCache()
+
+// DNSCacheStats describes the DNS cache.
+type DNSCacheStats struct {
+	Entries   int    `json:"entries"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Negatives uint64 `json:"negative_hits"`
+}
+
+type dnsCache struct {
+	mu        sync.Mutex
+	entries   map[string]dnsCacheEntry
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	negatives atomic.Uint64
+	now       func() time.Time
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{entries: make(map[string]dnsCacheEntry), now: time.Now}
+}
+
+// get returns the cached answer for key: its addresses, or the "no such
+// host" error of a negative answer.
+func (c *dnsCache) get(key string) ([]string, error, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	switch {
+	case !ok:
+		c.misses.Add(1)
+		return nil, nil, false
+	case e.err != nil:
+		c.negatives.Add(1)
+	default:
+		c.hits.Add(1)
+	}
+	return e.addrs, e.err, true
+}
+
+func (c *dnsCache) put(key string, addrs []string, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.entries) >= maxDNSCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < maxDNSCacheEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = dnsCacheEntry{addrs: addrs, err: err, expires: now.Add(ttl)}
+}
+
+func (c *dnsCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// purge drops every entry and returns how many there were.
+func (c *dnsCache) purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	clear(c.entries)
+	return n
+}
+
+func (c *dnsCache) stats() DNSCacheStats {
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	return DNSCacheStats{Entries: n, Hits: c.hits.Load(), Misses: c.misses.Load(), Negatives: c.negatives.Load()}
+}
+
+// ttlRecorder collects the smallest TTL of the address and SRV records in the DNS
+// answers read during a lookup, so the result can be cached for as long as
+// its records are valid.
+type ttlRecorder struct {
+	mu   sync.Mutex
+	ttl  uint32
+	seen bool
+}
+
+type ttlRecorderKey struct{}
+
+func withTTLRecorder(ctx context.Context, rec *ttlRecorder) context.Context {
+	return context.WithValue(ctx, ttlRecorderKey{}, rec)
+}
+
+func ttlRecorderFrom(ctx context.Context) *ttlRecorder {
+	rec, _ := ctx.Value(ttlRecorderKey{}).(*ttlRecorder)
+	return rec
+}
+
+func (r *ttlRecorder) observe(msg []byte) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		return
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return
+	}
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			return
+		}
+		if h.Type == dnsmessage.TypeA || h.Type == dnsmessage.TypeAAAA || h.Type == dnsmessage.TypeCNAME || h.Type == dnsmessage.TypeSRV {
+			r.mu.Lock()
+			if !r.seen || h.TTL < r.ttl {
+				r.ttl, r.seen = h.TTL, true
+			}
+			r.mu.Unlock()
+		}
+		if err := p.SkipAnswer(); err != nil {
+			return
+		}
+	}
+}
+
+// result returns the recorded TTL, or ok=false if no record was seen.
+func (r *ttlRecorder) result() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.ttl) * time.Second, r.seen
+}
+
+// recordTTLs wraps a connection to a DNS server so that the answers read
+// from it are passed to the lookup's ttlRecorder, if any.
+func recordTTLs(ctx context.Context, conn net.Conn) net.Conn {
+	rec := ttlRecorderFrom(ctx)
+	if rec == nil {
+		return conn
+	}
+	if uc, ok := conn.(*net.UDPConn); ok {
+		// The resolver tells datagram from stream transports by
+		// net.PacketConn, so the wrapper must stay one.
+		return &packetTTLConn{UDPConn: uc, rec: rec}
+	}
+	return &streamTTLConn{Conn: conn, rec: rec}
+}
+
+type packetTTLConn struct {
+	*net.UDPConn
+	rec *ttlRecorder
+}
+
+func (c *packetTTLConn) Read(b []byte) (int, error) {
+	n, err := c.UDPConn.Read(b)
+	if n > 0 {
+		c.rec.observe(b[:n])
+	}
+	return n, err
+}
+
+// streamTTLConn reassembles the length-prefixed messages of DNS over TCP,
+// TLS and HTTPS.
+type streamTTLConn struct {
+	net.Conn
+	rec *ttlRecorder
+	buf []byte
+}
+
+func (c *streamTTLConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.buf = append(c.buf, b[:n]...)
+	for len(c.buf) >= 2 {
+		size := 2 + int(binary.BigEndian.Uint16(c.buf))
+		if len(c.buf) < size {
+			break
+		}
+		c.rec.observe(c.buf[2:size])
+		c.buf = c.buf[size:]
+	}
+	return n, err
+}
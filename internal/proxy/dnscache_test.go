@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestDNSCacheExpiresEntries(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newDNSCache()
+	c.now = func() time.Time { return now }
+
+	c.put("a", []string{"127.0.0.1"}, nil, time.Minute)
+	c.put("b", nil, nil, 0)
+	if addrs, _, ok := c.get("a"); !ok || len(addrs) != 1 {
+		t.Fatalf("get(a) = %v, %v; expected a cached address", addrs, ok)
+	}
+	if _, _, ok := c.get("b"); ok {
+		t.Fatalf("expected an entry with a zero TTL not to be cached")
+	}
+	now = now.Add(time.Minute)
+	if _, _, ok := c.get("a"); ok {
+		t.Fatalf("expected the entry to expire after its TTL")
+	}
+	if s := c.stats(); s.Hits != 1 || s.Misses != 2 || s.Entries != 0 {
+		t.Fatalf("stats = %+v; expected 1 hit, 2 misses, no entries", s)
+	}
+}
+
+func TestTTLRecorderKeepsSmallestAddressTTL(t *testing.T) {
+	name := dnsmessage.MustNewName("example.test.")
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{Response: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+		Answers: []dnsmessage.Resource{
+			{Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300}, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}},
+			{Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60}, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 2}}},
+			{Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 1}, Body: &dnsmessage.TXTResource{TXT: []string{"x"}}},
+		},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec ttlRecorder
+	rec.observe(packed)
+	if ttl, ok := rec.result(); !ok || ttl != time.Minute {
+		t.Fatalf("result() = %v, %v; expected 1m0s", ttl, ok)
+	}
+}
+
+func TestDialerCachesLookups(t *testing.T) {
+	server := startDNSServer(t, "missing.test")
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{server}
+	d := newDialer(cfg)
+	d.cache = newDNSCache()
+
+	for range 2 {
+		if _, err := d.lookupHost(context.Background(), "cached.test"); err != nil {
+			t.Fatalf("lookupHost: %v", err)
+		}
+		if _, err := d.lookupHost(context.Background(), "missing.test"); err == nil {
+			t.Fatalf("expected missing.test not to resolve")
+		}
+	}
+	if s := d.cache.stats(); s.Hits != 1 || s.Negatives != 1 || s.Misses != 2 {
+		t.Fatalf("stats = %+v; expected one hit and one negative hit", s)
+	}
+
+	// Once a DNS server is gone, answers still come from the cache.
+	d.resolvers = []serverResolver{{server: server, resolver: newServerResolver(deadDNSServer(t))}}
+	if addrs, err := d.lookupHost(context.Background(), "cached.test"); err != nil || len(addrs) != 1 || net.ParseIP(addrs[0]) == nil {
+		t.Fatalf("lookupHost = %v, %v; expected the cached address", addrs, err)
+	}
+}
+
+func TestDialerForgetsResolutionAfterFailedDial(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{startDNSServer(t)}
+	d := newDialer(cfg)
+	d.cache = newDNSCache()
+
+	_, port, _ := net.SplitHostPort(deadAddr(t))
+	if _, err := d.dial(net.JoinHostPort("moved.test", port)); err == nil {
+		t.Fatalf("expected the dial to a closed port to fail")
+	}
+	if s := d.cache.stats(); s.Misses != 1 || s.Entries != 0 {
+		t.Fatalf("stats = %+v; expected the failed resolution to be dropped", s)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// ErrorHeader carries a short reason on responses for requests the proxy
+// could not complete, so clients and dashboards can tell a slow upstream
+// from a broken one.
+const ErrorHeader = "X-DynamicProxy-Error"
+
+// errUpstreamRejected is returned when the upstream answers a CONNECT with
+// anything but 200.
+var errUpstreamRejected = errors.New("upstream CONNECT failed")
+
+// errUpstreamAuth is wrapped in errUpstreamRejected when the upstream
+// answers a CONNECT with 407.
+var errUpstreamAuth = errors.New("407 Proxy Authentication Required")
+
+// classifyError maps a failure to reach the destination to the status code
+// sent to the client and the reason reported in ErrorHeader.
+func classifyError(err error) (int, string) {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return http.StatusServiceUnavailable, "circuit-open"
+	case errors.Is(err, errUpstreamsExcluded):
+		return http.StatusBadGateway, "upstream-excluded"
+	case errors.Is(err, errNTLMv1):
+		return http.StatusForbidden, "ntlmv1-refused"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout, "timeout"
+	case errors.As(err, &dnsErr):
+		return http.StatusBadGateway, "dns-failure"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return http.StatusBadGateway, "connection-refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return http.StatusBadGateway, "connection-reset"
+	case errors.Is(err, errUpstreamRejected):
+		return http.StatusBadGateway, "upstream-rejected"
+	case isUpstreamUnreachable(err):
+		return http.StatusBadGateway, "upstream-unreachable"
+	}
+	return http.StatusBadGateway, "bad-gateway"
+}
+
+func writeProxyError(w http.ResponseWriter, err error) {
+	status, reason := classifyError(err)
+	w.Header().Set(ErrorHeader, reason)
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		reason string
+	}{
+		{"circuit open", errCircuitOpen, http.StatusServiceUnavailable, "circuit-open"},
+		{"timeout", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, http.StatusGatewayTimeout, "timeout"},
+		{"dns", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}}, http.StatusBadGateway, "dns-failure"},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, http.StatusBadGateway, "connection-refused"},
+		{"reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, http.StatusBadGateway, "connection-reset"},
+		{"rejected", fmt.Errorf("%w: 407 Proxy Authentication Required", errUpstreamRejected), http.StatusBadGateway, "upstream-rejected"},
+		{"unreachable", &net.OpError{Op: "proxyconnect", Err: fmt.Errorf("no route")}, http.StatusBadGateway, "upstream-unreachable"},
+		{"other", fmt.Errorf("malformed response"), http.StatusBadGateway, "bad-gateway"},
+	}
+
+	for _, tt := range tests {
+		status, reason := classifyError(tt.err)
+		if status != tt.status || reason != tt.reason {
+			t.Errorf("%s: classifyError = %d %q; expected %d %q", tt.name, status, reason, tt.status, tt.reason)
+		}
+	}
+}
+
+func TestProxyRequestTimeoutReturns504(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ClientRequestTimeout = 20 * time.Millisecond
+
+	rec := httptest.NewRecorder()
+	ProxyRequest(rec, httptest.NewRequest(http.MethodGet, backend.URL, nil), NewDirectTransport(cfg), cfg)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d; expected %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	if got := rec.Header().Get(ErrorHeader); got != "timeout" {
+		t.Errorf("%s = %q; expected %q", ErrorHeader, got, "timeout")
+	}
+}
+
+func TestValidConnectTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		valid  bool
+	}{
+		{"example.com:443", true},
+		{"10.0.0.1:443", true},
+		{"[2001:db8::1]:443", true},
+		{"[fe80::1%eth0]:443", true},
+		{"example.com", false},
+		{"2001:db8::1:443", false},
+		{"[2001:db8::zz]:443", false},
+		{"example.com:0", false},
+		{"example.com:65536", false},
+		{"example.com:https", false},
+		{":443", false},
+	}
+
+	for _, tt := range tests {
+		if err := validConnectTarget(tt.target); (err == nil) != tt.valid {
+			t.Errorf("validConnectTarget(%q) = %v; expected valid=%v", tt.target, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// Explanation is how the proxy would route a request, as found by Explain.
+type Explanation struct {
+	// Decision is the outcome of Decide, which stands unless APP_ROUTES or
+	// UPSTREAM_PAC decided the route.
+	Decision Decision
+	// Route is "direct", "upstream" or "blocked", and Rule what decided it,
+	// as in the X-DynamicProxy-Decision header.
+	Route string
+	Rule  string
+	// Upstreams are the upstreams tried in order, as picked by
+	// UPSTREAM_PAC or the configuration and the canary, without those
+	// UPSTREAM_EXCEPTIONS keeps the destination away from.
+	Upstreams []string
+	// Excluded are the upstreams UPSTREAM_EXCEPTIONS took out.
+	Excluded []string
+	// FailOpen is set if the request goes direct when the upstreams cannot
+	// be reached, by FAIL_OPEN or the PAC file.
+	FailOpen bool
+}
+
+// Explain finds how a request with method for host, sent by the local
+// application app ("" if unknown), would be routed under cfg. It takes the
+// steps a proxied request takes, discovering the upstreams and loading
+// UPSTREAM_PAC, but sends no traffic to the destination.
+func Explain(ctx context.Context, method, host, app string, cfg config.Config) Explanation {
+	host = config.CanonicalHost(host)
+	req := &http.Request{Method: method, Host: host, URL: &url.URL{Scheme: "http", Host: host, Path: "/"}, Header: http.Header{}}
+	if method == http.MethodConnect {
+		req.URL = &url.URL{Host: host}
+	}
+	req = req.WithContext(ctx)
+
+	e := Explanation{Decision: Decide(host, cfg)}
+	t := newRequestTransports(cfg, upstreamAddrs(cfg), nil, nil)
+	if route, ok := appRoute(app, cfg); ok {
+		if route == config.AppRouteBlock {
+			e.Route, e.Rule = routeBlocked, "app:"+app
+			return e
+		}
+		t.appRoute, t.app = route, app
+	}
+	if cfg.UpstreamPAC != "" {
+		t.pac = newUpstreamPAC()
+		t.pac.refresh(ctx, cfg)
+	}
+	t = t.withPAC(req, cfg).withCanary(req, cfg)
+	picked := t.upstreams
+	t = t.withUpstreamExceptions(req, cfg)
+
+	e.Route, e.Rule = t.route(host, cfg)
+	if e.Route == routeDirect {
+		return e
+	}
+	for _, u := range picked {
+		if slices.ContainsFunc(t.upstreams, func(kept upstreamTransport) bool { return kept.addr == u.addr }) {
+			e.Upstreams = append(e.Upstreams, u.addr)
+		} else {
+			e.Excluded = append(e.Excluded, u.addr)
+		}
+	}
+	e.FailOpen = t.failsOpen(host, cfg)
+	return e
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestExplain(t *testing.T) {
+	script := `function FindProxyForURL(url, host) {
+  if (host == "pac-direct.test") return "DIRECT";
+  if (host == "pac-proxy.test") return "PROXY sales.proxy:3128; DIRECT";
+  return "PROXY corporate.proxy:8080";
+}`
+	path := filepath.Join(t.TempDir(), "corp.pac")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := config.DefaultConfig()
+	base.UpstreamProxy = "a.proxy:8080,b.proxy:8080"
+	base.ProxyExceptions = []string{"*.example.com"}
+
+	tests := []struct {
+		name      string
+		host      string
+		app       string
+		set       func(*config.Config)
+		route     string
+		rule      string
+		upstreams []string
+		excluded  []string
+		failOpen  bool
+	}{
+		{name: "proxy exceptions", host: "api.example.com:443", route: routeDirect, rule: "*.example.com"},
+		{name: "no exception", host: "golang.org:443", route: routeUpstream, rule: "default", upstreams: []string{"a.proxy:8080", "b.proxy:8080"}},
+		{name: "fail open", host: "golang.org:443", set: func(c *config.Config) { c.FailOpen = true }, route: routeUpstream, rule: "default", upstreams: []string{"a.proxy:8080", "b.proxy:8080"}, failOpen: true},
+		{name: "app direct", host: "golang.org:443", app: "git", set: func(c *config.Config) {
+			c.AppRoutes = []config.AppRoute{{App: "git", Route: config.AppRouteDirect}}
+		}, route: routeDirect, rule: "app:git"},
+		{name: "app upstream", host: "api.example.com:443", app: "git", set: func(c *config.Config) {
+			c.AppRoutes = []config.AppRoute{{App: "git", Route: config.AppRouteUpstream}}
+		}, route: routeUpstream, rule: "app:git", upstreams: []string{"a.proxy:8080", "b.proxy:8080"}},
+		{name: "app blocked", host: "golang.org:443", app: "git", set: func(c *config.Config) {
+			c.AppRoutes = []config.AppRoute{{App: "git", Route: config.AppRouteBlock}}
+		}, route: routeBlocked, rule: "app:git"},
+		{name: "other app", host: "golang.org:443", app: "curl", set: func(c *config.Config) {
+			c.AppRoutes = []config.AppRoute{{App: "git", Route: config.AppRouteBlock}}
+		}, route: routeUpstream, rule: "default", upstreams: []string{"a.proxy:8080", "b.proxy:8080"}},
+		{name: "pac direct", host: "pac-direct.test:443", set: func(c *config.Config) { c.UpstreamPAC = path }, route: routeDirect, rule: "pac"},
+		{name: "pac proxy", host: "pac-proxy.test:443", set: func(c *config.Config) { c.UpstreamPAC = path }, route: routeUpstream, rule: "pac", upstreams: []string{"sales.proxy:3128"}, failOpen: true},
+		{name: "pac configured upstream", host: "golang.org:443", set: func(c *config.Config) {
+			c.UpstreamPAC = path
+			c.UpstreamProxy = "corporate.proxy:8080"
+		}, route: routeUpstream, rule: "pac", upstreams: []string{"corporate.proxy:8080"}},
+		{name: "upstream exceptions", host: "api.partner.test:443", set: func(c *config.Config) {
+			c.UpstreamExceptions = []config.UpstreamException{{Pattern: "*.partner.test", Upstream: "a.proxy:8080"}}
+		}, route: routeUpstream, rule: "default", upstreams: []string{"b.proxy:8080"}, excluded: []string{"a.proxy:8080"}},
+		{name: "all upstreams excluded", host: "secret.test:443", set: func(c *config.Config) {
+			c.UpstreamExceptions = []config.UpstreamException{{Pattern: "secret.test", Upstream: "a.proxy:8080"}, {Pattern: "secret.test", Upstream: "b.proxy:8080"}}
+		}, route: routeUpstream, rule: "default", excluded: []string{"a.proxy:8080", "b.proxy:8080"}},
+		{name: "canary", host: "golang.org:443", set: func(c *config.Config) {
+			c.CanaryUpstream = "canary.proxy:8080"
+			c.CanaryPercent = 100
+		}, route: routeUpstream, rule: "default", upstreams: []string{"canary.proxy:8080", "a.proxy:8080", "b.proxy:8080"}},
+	}
+	for _, tt := range tests {
+		cfg := base
+		if tt.set != nil {
+			tt.set(&cfg)
+		}
+		got := Explain(context.Background(), http.MethodConnect, tt.host, tt.app, cfg)
+		if got.Route != tt.route || got.Rule != tt.rule {
+			t.Errorf("%s: route %s (%s); expected %s (%s)", tt.name, got.Route, got.Rule, tt.route, tt.rule)
+		}
+		if !slices.Equal(got.Upstreams, tt.upstreams) || !slices.Equal(got.Excluded, tt.excluded) {
+			t.Errorf("%s: upstreams %v, excluded %v; expected %v, %v", tt.name, got.Upstreams, got.Excluded, tt.upstreams, tt.excluded)
+		}
+		if got.FailOpen != tt.failOpen {
+			t.Errorf("%s: fail-open %v; expected %v", tt.name, got.FailOpen, tt.failOpen)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// flowRecord is the FLOW_LOG entry of a finished request or tunnel.
+type flowRecord struct {
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	DurationMS    int64     `json:"durationMs"`
+	Kind          string    `json:"kind"`
+	Client        string    `json:"client"`
+	Method        string    `json:"method"`
+	Host          string    `json:"host"`
+	Destination   string    `json:"destination,omitempty"`
+	SNI           string    `json:"sni,omitempty"`
+	JA3           string    `json:"ja3,omitempty"`
+	JA4           string    `json:"ja4,omitempty"`
+	Country       string    `json:"country,omitempty"`
+	ASN           uint32    `json:"asn,omitempty"`
+	Threat        string    `json:"threat,omitempty"`
+	App           string    `json:"app,omitempty"`
+	Route         string    `json:"route"`
+	Status        int       `json:"status,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	BytesSent     int64     `json:"bytesSent"`
+	BytesReceived int64     `json:"bytesReceived"`
+}
+
+// flowLog writes one JSON line per finished connection.
+type flowLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// write records info, anonymized by anon.
+func (l *flowLog) write(info ConnInfo, anon *anonymizer) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(flowRecord{
+		Start:         info.Started,
+		End:           info.Started.Add(info.Duration),
+		DurationMS:    info.Duration.Milliseconds(),
+		Kind:          info.Kind,
+		Client:        anon.client(info.Client),
+		Method:        info.Method,
+		Host:          info.Host,
+		Destination:   info.Destination,
+		SNI:           info.SNI,
+		JA3:           info.JA3,
+		JA4:           info.JA4,
+		Country:       info.Country,
+		ASN:           info.ASN,
+		Threat:        info.Threat,
+		App:           info.App,
+		Route:         info.Route,
+		Status:        info.Status,
+		Error:         anon.text(info.Error),
+		BytesSent:     info.BytesSent,
+		BytesReceived: info.BytesReceived,
+	})
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		Warn.Printf("Failed to write flow record: %v", err)
+	}
+}
+
+// SetFlowLog makes the server write a JSON line describing every finished
+// request and tunnel to w.
+func (s *Server) SetFlowLog(w io.Writer) {
+	s.flows.Store(&flowLog{w: w})
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+func TestFlowLog(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendAddr := strings.TrimPrefix(backend.URL, "https://")
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	server := NewServer(cfg)
+	var flows syncBuffer
+	server.SetFlowLog(&flows)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:             http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()}),
+		TLSClientConfig:   &tls.Config{ServerName: "www.example.test", InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}}
+	resp, err := client.Get(backend.URL + "/")
+	if err != nil {
+		t.Fatalf("GET through tunnel: %v", err)
+	}
+	resp.Body.Close()
+
+	var record flowRecord
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if line := flows.lines()[0]; line != "" {
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("flow record %q: %v", line, err)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no flow record written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if record.Kind != "tunnel" || record.Host != backendAddr || record.Destination != backendAddr || record.SNI != "www.example.test" || record.Route != routeDirect {
+		t.Errorf("flow record = %+v; expected a direct tunnel to %s with SNI www.example.test", record, backendAddr)
+	}
+	if record.JA3 == "" || record.JA4 == "" {
+		t.Errorf("flow record = %+v; expected the client's JA3 and JA4 fingerprints", record)
+	}
+	if record.BytesSent == 0 || record.BytesReceived == 0 || record.End.Before(record.Start) {
+		t.Errorf("flow record = %+v; expected traffic in both directions", record)
+	}
+}
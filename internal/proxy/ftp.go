@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// ftpTransport fetches ftp:// URLs by translating GET and HEAD requests
+// into FTP commands, in passive mode: files are returned as they are,
+// directories, requested with a trailing slash, as the text of LIST.
+// Credentials are taken from the URL or the request's basic
+// authentication, and default to anonymous.
+type ftpTransport struct {
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// ftpConn is the control connection of an FTP session.
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// stop ends closing conn once the request's context is done.
+	stop func() bool
+}
+
+func (t ftpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return ftpResponse(req, http.StatusMethodNotAllowed, "Only GET and HEAD are supported for ftp:// URLs"), nil
+	}
+	path, _, _ := strings.Cut(req.URL.Path, ";type=")
+	if strings.ContainsAny(path, "\r\n") {
+		return ftpResponse(req, http.StatusBadRequest, "Invalid FTP path"), nil
+	}
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "21")
+	}
+	conn, err := t.dial(req.Context(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &ftpConn{conn: conn, text: textproto.NewConn(conn), dial: t.dial}
+	c.stop = context.AfterFunc(req.Context(), func() { conn.Close() })
+	resp, err := c.fetch(req, strings.TrimPrefix(path, "/"))
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	if _, ok := resp.Body.(*ftpBody); !ok {
+		c.close()
+	}
+	return resp, nil
+}
+
+// fetch logs in and retrieves path, relative to the login directory.
+func (c *ftpConn) fetch(req *http.Request, path string) (*http.Response, error) {
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return ftpError(req, err)
+	}
+	user, pass := "anonymous", "anonymous@"
+	if u := req.URL.User; u != nil {
+		user = u.Username()
+		pass, _ = u.Password()
+	} else if u, p, ok := req.BasicAuth(); ok {
+		user, pass = u, p
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		_, _, err = c.cmd(2, "PASS %s", pass)
+	}
+	if err != nil {
+		return ftpError(req, err)
+	}
+	if _, _, err := c.cmd(2, "TYPE I"); err != nil {
+		return ftpError(req, err)
+	}
+
+	dir, file := "", path
+	if path == "" || strings.HasSuffix(path, "/") {
+		dir, file = path, ""
+	}
+	if dir != "" {
+		if _, _, err := c.cmd(2, "CWD %s", dir); err != nil {
+			return ftpError(req, err)
+		}
+	}
+	resp := ftpResponse(req, http.StatusOK, "")
+	if file == "" {
+		resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if req.Method == http.MethodHead {
+			return resp, nil
+		}
+		return c.transfer(req, resp, "LIST")
+	}
+	resp.Header.Set("Content-Type", "application/octet-stream")
+	if _, msg, err := c.cmd(2, "SIZE %s", file); err == nil {
+		if size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64); err == nil {
+			resp.ContentLength = size
+			resp.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+	}
+	if req.Method == http.MethodHead {
+		return resp, nil
+	}
+	resp, err = c.transfer(req, resp, "RETR %s", file)
+	var ftpErr *textproto.Error
+	if errors.As(err, &ftpErr) && ftpErr.Code == 550 {
+		// Send directories requested without a trailing slash to the
+		// listing.
+		if _, _, cwdErr := c.cmd(2, "CWD %s", file); cwdErr == nil {
+			resp = ftpResponse(req, http.StatusMovedPermanently, "")
+			resp.Header.Set("Location", req.URL.Path+"/")
+			return resp, nil
+		}
+	}
+	if err != nil {
+		return ftpError(req, err)
+	}
+	return resp, nil
+}
+
+// transfer opens a passive data connection and sends the command, which
+// is answered on it, as the body of resp.
+func (c *ftpConn) transfer(req *http.Request, resp *http.Response, format string, args ...any) (*http.Response, error) {
+	data, err := c.openData(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.cmd(1, format, args...); err != nil {
+		data.Close()
+		return nil, err
+	}
+	resp.Body = &ftpBody{data: data, ctrl: c}
+	return resp, nil
+}
+
+var epsvPort = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`)
+var pasvAddr = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// openData connects to the port the server opens for passive mode, on the
+// host of the control connection: addresses in PASV replies are ignored,
+// as they are often private ones behind NAT.
+func (c *ftpConn) openData(ctx context.Context) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	var port int
+	if _, msg, err := c.cmd(2, "EPSV"); err == nil {
+		if m := epsvPort.FindStringSubmatch(msg); m != nil {
+			port, _ = strconv.Atoi(m[1])
+		}
+	} else if _, msg, err := c.cmd(2, "PASV"); err == nil {
+		if m := pasvAddr.FindStringSubmatch(msg); m != nil {
+			hi, _ := strconv.Atoi(m[5])
+			lo, _ := strconv.Atoi(m[6])
+			port = hi<<8 | lo
+		}
+	} else {
+		return nil, err
+	}
+	if port <= 0 || port > 65535 {
+		return nil, errors.New("FTP server did not open a passive data port")
+	}
+	return c.dial(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// cmd sends a command and reads its reply, which must start with the
+// digits of expect unless expect is 0.
+func (c *ftpConn) cmd(expect int, format string, args ...any) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expect)
+}
+
+func (c *ftpConn) close() {
+	c.stop()
+	_ = c.text.PrintfLine("QUIT")
+	c.conn.Close()
+}
+
+// ftpBody is a file or listing read from a data connection. Closing it
+// ends the session.
+type ftpBody struct {
+	data net.Conn
+	ctrl *ftpConn
+}
+
+func (b *ftpBody) Read(p []byte) (int, error) {
+	return b.data.Read(p)
+}
+
+func (b *ftpBody) Close() error {
+	err := b.data.Close()
+	b.ctrl.close()
+	return err
+}
+
+// ftpError turns the error replies of FTP servers into HTTP responses.
+func ftpError(req *http.Request, err error) (*http.Response, error) {
+	var ftpErr *textproto.Error
+	if !errors.As(err, &ftpErr) {
+		return nil, err
+	}
+	status := http.StatusBadGateway
+	switch {
+	case ftpErr.Code == 530:
+		status = http.StatusUnauthorized
+	case ftpErr.Code == 550:
+		status = http.StatusNotFound
+	case ftpErr.Code >= 400 && ftpErr.Code < 500:
+		status = http.StatusServiceUnavailable
+	}
+	resp := ftpResponse(req, status, fmt.Sprintf("FTP server replied: %d %s\n", ftpErr.Code, ftpErr.Msg))
+	if status == http.StatusUnauthorized {
+		resp.Header.Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", "FTP "+req.URL.Hostname()))
+	}
+	return resp, nil
+}
+
+func ftpResponse(req *http.Request, status int, body string) *http.Response {
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+	if body != "" {
+		resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		resp.ContentLength = int64(len(body))
+		resp.Body = io.NopCloser(strings.NewReader(body))
+	}
+	return resp
+}
+
+// ftpViaUpstream forwards ftp:// requests to the upstream proxy addr, which
+// fetches them itself, as proxies like Squid do.
+type ftpViaUpstream struct {
+	addr string
+	cfg  config.Config
+}
+
+func (f ftpViaUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := dialUpstreamConn(req.Context(), f.addr, f.cfg)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	stop := context.AfterFunc(req.Context(), func() { conn.Close() })
+	outbound := *req
+	outbound.Close = true
+	if err := outbound.WriteProxy(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body = &upstreamBody{ReadCloser: resp.Body, conn: conn, stop: stop}
+	return resp, nil
+}
+
+// upstreamBody closes the connection to the upstream with the body read
+// from it.
+type upstreamBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop func() bool
+}
+
+func (b *upstreamBody) Close() error {
+	b.stop()
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
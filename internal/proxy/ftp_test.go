@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// serveFTP answers the commands of one FTP session for a server with the
+// directory pub holding hello.txt.
+func serveFTP(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 ready")
+	var data net.Listener
+	send := func(payload string) {
+		text.PrintfLine("150 opening data connection")
+		if data != nil {
+			if c, err := data.Accept(); err == nil {
+				io.WriteString(c, payload)
+				c.Close()
+			}
+			data.Close()
+			data = nil
+		}
+		text.PrintfLine("226 done")
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch {
+		case cmd == "USER":
+			text.PrintfLine("331 password please")
+		case cmd == "PASS" && arg == "wrong":
+			text.PrintfLine("530 login incorrect")
+		case cmd == "PASS":
+			text.PrintfLine("230 logged in")
+		case cmd == "TYPE":
+			text.PrintfLine("200 binary")
+		case cmd == "CWD" && (arg == "pub" || arg == "pub/"):
+			text.PrintfLine("250 ok")
+		case cmd == "SIZE" && arg == "pub/hello.txt":
+			text.PrintfLine("213 5")
+		case cmd == "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			text.PrintfLine("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case cmd == "RETR" && arg == "pub/hello.txt":
+			send("hello")
+		case cmd == "LIST":
+			send("-rw-r--r-- 1 ftp ftp 5 Jan 01 00:00 hello.txt\r\n")
+		case cmd == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("550 no such file")
+		}
+	}
+}
+
+func TestFTPOverHTTP(t *testing.T) {
+	ftp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ftp.Close()
+	go func() {
+		for {
+			conn, err := ftp.Accept()
+			if err != nil {
+				return
+			}
+			go serveFTP(conn)
+		}
+	}()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "upstream fetched %s", r.URL)
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = upstream.Listener.Addr().String()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	base := "ftp://" + ftp.Addr().String()
+	tests := []struct {
+		url      string
+		password string
+		status   int
+		body     string
+	}{
+		{base + "/pub/hello.txt", "", http.StatusOK, "hello"},
+		{base + "/pub/hello.txt;type=i", "", http.StatusOK, "hello"},
+		{base + "/pub/", "", http.StatusOK, "hello.txt\r\n"},
+		{base + "/pub", "", http.StatusOK, "hello.txt\r\n"},
+		{base + "/pub/missing.txt", "", http.StatusNotFound, "550 no such file"},
+		{base + "/pub/hello.txt", "wrong", http.StatusUnauthorized, "530 login incorrect"},
+		{"ftp://files.test/pub/hello.txt", "", http.StatusOK, "upstream fetched ftp://files.test/pub/hello.txt"},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial proxy: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		if tt.password != "" {
+			req.SetBasicAuth("user", tt.password)
+		}
+		req.WriteProxy(conn)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			conn.Close()
+			t.Fatalf("GET %s: %v", tt.url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		conn.Close()
+		if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.body) {
+			t.Errorf("GET %s = %d %q; expected %d with %q", tt.url, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+}
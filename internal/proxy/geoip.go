@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/geoip"
+)
+
+// geoDBCheckInterval is how often an open GEOIP_DB file is checked for
+// updates, so that refreshed databases are picked up without a restart.
+const geoDBCheckInterval = time.Minute
+
+// geoDatabases holds the GEOIP_DB files opened so far, across reloads.
+var geoDatabases = &geoDBs{dbs: make(map[string]*geoDB), now: time.Now}
+
+type geoDBs struct {
+	mu  sync.Mutex
+	dbs map[string]*geoDB
+	now func() time.Time
+}
+
+type geoDB struct {
+	reader  *geoip.Reader
+	modTime time.Time
+	checked time.Time
+}
+
+// get returns the database at path, reopening it if the file changed. A
+// database that cannot be opened is retried after geoDBCheckInterval.
+func (g *geoDBs) get(path string) *geoip.Reader {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	db, ok := g.dbs[path]
+	now := g.now()
+	if ok && now.Sub(db.checked) < geoDBCheckInterval {
+		return db.reader
+	}
+	if !ok {
+		db = &geoDB{}
+		g.dbs[path] = db
+	}
+	db.checked = now
+	info, err := os.Stat(path)
+	if err != nil {
+		if db.reader != nil || !ok {
+			Warn.Printf("GeoIP database %s unavailable: %v", path, err)
+		}
+		db.reader = nil
+		return nil
+	}
+	if db.reader != nil && info.ModTime().Equal(db.modTime) {
+		return db.reader
+	}
+	reader, err := geoip.Open(path)
+	if err != nil {
+		Warn.Printf("Failed to open GeoIP database: %v", err)
+		return db.reader
+	}
+	Info.Printf("Loaded GeoIP database %s (%s)", path, reader.Type)
+	db.reader, db.modTime = reader, info.ModTime()
+	return reader
+}
+
+// geoLookup returns what the GEOIP_DB databases know about addr. It is a
+// variable so that tests can do without database files.
+var geoLookup = func(addr netip.Addr, cfg config.Config) (geoip.Record, bool) {
+	var rec geoip.Record
+	found := false
+	for _, path := range cfg.GeoIPDB {
+		reader := geoDatabases.get(path)
+		if reader == nil {
+			continue
+		}
+		r, ok, err := reader.Lookup(addr)
+		if err != nil {
+			Warn.Printf("GeoIP lookup of %s in %s failed: %v", addr, path, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		if rec.Country == "" {
+			rec.Country = r.Country
+		}
+		if rec.ASN == 0 {
+			rec.ASN, rec.Organization = r.ASN, r.Organization
+		}
+	}
+	return rec, found
+}
+
+// locate returns the country and autonomous system of the address host
+// resolves to. Hosts left to the upstream to resolve are not located.
+func locate(host string, cfg config.Config) (geoip.Record, bool) {
+	if len(cfg.GeoIPDB) == 0 {
+		return geoip.Record{}, false
+	}
+	addr, ok := literalAddr(host)
+	if !ok {
+		if resolvesRemotely(host, cfg) {
+			return geoip.Record{}, false
+		}
+		addrs := resolveName(hostName(host), cfg)
+		if len(addrs) == 0 {
+			return geoip.Record{}, false
+		}
+		if addr, ok = literalAddr(addrs[0]); !ok {
+			return geoip.Record{}, false
+		}
+	}
+	return geoLookup(addr, cfg)
+}
+
+// geoBlocked answers requests for destinations located in a GEOIP_BLOCK
+// country with 403 Forbidden and reports whether it did.
+func geoBlocked(w http.ResponseWriter, req *http.Request, geo geoip.Record, cfg config.Config, decisions *decisionCounts) bool {
+	if geo.Country == "" || !slices.Contains(cfg.GeoIPBlock, geo.Country) {
+		return false
+	}
+	Warn.Printf("Blocked %s %s: destination located in %s", req.Method, req.Host, geo.Country)
+	decisions.decide(w, routeBlocked, "geoip:"+geo.Country, cfg)
+	w.Header().Set(ErrorHeader, "geo-blocked")
+	http.Error(w, "Destination blocked", http.StatusForbidden)
+	return true
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/geoip"
+)
+
+func stubGeoLookup(t *testing.T, countries map[string]string) {
+	t.Helper()
+	orig := geoLookup
+	t.Cleanup(func() { geoLookup = orig })
+	geoLookup = func(addr netip.Addr, cfg config.Config) (geoip.Record, bool) {
+		country, ok := countries[addr.String()]
+		return geoip.Record{Country: country}, ok
+	}
+}
+
+func TestDecideGeoIP(t *testing.T) {
+	stubGeoLookup(t, map[string]string{"192.0.2.1": "DE", "127.0.0.1": "US"})
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	cfg.GeoIPDB = []string{"test.mmdb"}
+	cfg.GeoIPUpstream = []string{"DE"}
+	cfg.HostMap = map[string]string{"mapped.test": "192.0.2.1"}
+
+	tests := []struct {
+		host    string
+		route   string
+		country string
+	}{
+		{"192.0.2.1:443", routeUpstream, "DE"},
+		{"mapped.test", routeUpstream, "DE"},
+		{"127.0.0.1:8080", routeDirect, ""},
+	}
+	for _, tt := range tests {
+		d := Decide(tt.host, cfg)
+		if d.Route != tt.route || d.Country != tt.country {
+			t.Errorf("Decide(%s) = %s (country %q); expected %s (country %q)", tt.host, d.Route, d.Country, tt.route, tt.country)
+		}
+	}
+
+	cfg.RemoteDNS = []string{"mapped.test"}
+	if d := Decide("mapped.test", cfg); d.Route != routeDirect {
+		t.Errorf("Decide(mapped.test) with REMOTE_DNS = %s; expected the host not to be located", d.Route)
+	}
+}
+
+func TestGeoBlock(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	stubGeoLookup(t, map[string]string{"192.0.2.1": "DE", "127.0.0.1": "US"})
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	cfg.GeoIPDB = []string{"test.mmdb"}
+	cfg.GeoIPBlock = []string{"DE"}
+	cfg.HostMap = map[string]string{"blocked.test": "192.0.2.1"}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+	proxyURL := &url.URL{Scheme: "http", Host: l.Addr().String()}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", backend.URL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET %s = %d; expected 200", backend.URL, resp.StatusCode)
+	}
+
+	resp, err = client.Get("http://blocked.test/")
+	if err != nil {
+		t.Fatalf("GET blocked.test: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get(ErrorHeader) != "geo-blocked" {
+		t.Errorf("GET blocked.test = %d %q; expected 403 geo-blocked", resp.StatusCode, resp.Header.Get(ErrorHeader))
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "CONNECT 192.0.2.1:443 HTTP/1.1\r\nHost: 192.0.2.1:443\r\n\r\n")
+	buf := make([]byte, 128)
+	n, _ := conn.Read(buf)
+	if !strings.HasPrefix(string(buf[:n]), "HTTP/1.1 403") {
+		t.Errorf("CONNECT 192.0.2.1:443 = %q; expected 403", buf[:n])
+	}
+
+	conn.Close()
+
+	var countries []string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		countries = countries[:0]
+		for _, c := range server.Activity().Recent() {
+			countries = append(countries, c.Country)
+		}
+		if len(countries) == 3 {
+			break
+		}
+	}
+	slices.Sort(countries)
+	if !slices.Equal(countries, []string{"DE", "DE", "US"}) {
+		t.Errorf("recent connections located in %v; expected US and twice DE", countries)
+	}
+}
+
+func TestGeoDBsMissingFile(t *testing.T) {
+	g := &geoDBs{dbs: make(map[string]*geoDB), now: func() time.Time { return time.Unix(0, 0) }}
+	if r := g.get(filepath.Join(t.TempDir(), "missing.mmdb")); r != nil {
+		t.Errorf("get(missing) = %v; expected nil", r)
+	}
+}
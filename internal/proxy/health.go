@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// UpstreamHealth is the last known state of one configured upstream.
+type UpstreamHealth struct {
+	Addr string `json:"addr"`
+	// Healthy is true until a health check fails.
+	Healthy   bool          `json:"healthy"`
+	Circuit   string        `json:"circuit"`
+	LastCheck time.Time     `json:"lastCheck,omitzero"`
+	Latency   time.Duration `json:"latency"`
+	Error     string        `json:"error,omitempty"`
+	// ErrorRate is the share of failed requests and tunnels within the
+	// last minute, and DemotedUntil is set while UPSTREAM_DEMOTE_ERROR_RATE
+	// has the upstream demoted.
+	ErrorRate    float64   `json:"errorRate"`
+	DemotedUntil time.Time `json:"demotedUntil,omitzero"`
+	Demotions    int       `json:"demotions"`
+}
+
+// healthChecker keeps the results of the background upstream probes.
+type healthChecker struct {
+	mu      sync.Mutex
+	results map[string]UpstreamHealth
+}
+
+func newHealthChecker() *healthChecker {
+	return &healthChecker{results: map[string]UpstreamHealth{}}
+}
+
+// healthy reports whether addr passed its last check. Upstreams that were
+// never checked count as healthy, as do all upstreams without a checker.
+func (h *healthChecker) healthy(addr string) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result, ok := h.results[addr]
+	return !ok || result.Healthy
+}
+
+func (h *healthChecker) result(addr string) UpstreamHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if result, ok := h.results[addr]; ok {
+		return result
+	}
+	return UpstreamHealth{Addr: addr, Healthy: true}
+}
+
+// checkAll probes every upstream in cfg concurrently, records the results and
+// returns those of the upstreams whose health changed.
+func (h *healthChecker) checkAll(ctx context.Context, cfg config.Config, upstreams []string) []UpstreamHealth {
+	var changed []UpstreamHealth
+	for _, result := range probeAll(ctx, cfg, upstreams) {
+		h.mu.Lock()
+		previous, known := h.results[result.Addr]
+		h.results[result.Addr] = result
+		h.mu.Unlock()
+		if known && previous.Healthy != result.Healthy {
+			changed = append(changed, result)
+			if result.Healthy {
+				Info.Printf("Upstream %s is healthy again", result.Addr)
+			} else {
+				Warn.Printf("Upstream %s failed its health check: %s", result.Addr, result.Error)
+			}
+		}
+	}
+	return changed
+}
+
+// ProbeUpstreams checks every configured upstream once, the same way the
+// background health checks do.
+func ProbeUpstreams(ctx context.Context, cfg config.Config) []UpstreamHealth {
+	return probeAll(ctx, cfg, DiscoverUpstreams(ctx, cfg))
+}
+
+func probeAll(ctx context.Context, cfg config.Config, upstreams []string) []UpstreamHealth {
+	results := make([]UpstreamHealth, len(upstreams))
+	var wg sync.WaitGroup
+	for i, addr := range upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probeUpstream(ctx, addr, cfg)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// probeUpstream dials addr and, if HEALTH_CHECK_TARGET is set, opens a
+// CONNECT tunnel to it through the upstream.
+func probeUpstream(ctx context.Context, addr string, cfg config.Config) UpstreamHealth {
+	result := UpstreamHealth{Addr: addr, LastCheck: time.Now()}
+	var conn net.Conn
+	var err error
+	if cfg.HealthCheckTarget != "" {
+		conn, err = DialViaUpstream(addr, cfg.HealthCheckTarget, cfg)
+	} else {
+		conn, err = dialUpstreamConn(ctx, addr, cfg)
+	}
+	result.Latency = time.Since(result.LastCheck)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.Healthy = true
+	return result
+}
+
+// preferred returns the upstreams with healthy ones first and demoted ones
+// after them, otherwise keeping the configured order.
+func (t requestTransports) preferred() []upstreamTransport {
+	upstreams := slices.Clone(t.upstreams)
+	slices.SortStableFunc(upstreams, func(a, b upstreamTransport) int {
+		return t.healthRank(a.addr) - t.healthRank(b.addr)
+	})
+	return upstreams
+}
+
+func (t requestTransports) healthRank(addr string) int {
+	switch {
+	case !t.health.healthy(addr):
+		return 2
+	case t.demotions.demoted(addr):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func deadAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestProbeUpstream(t *testing.T) {
+	live := httptest.NewServer(http.NotFoundHandler())
+	defer live.Close()
+	cfg := config.DefaultConfig()
+
+	if got := probeUpstream(context.Background(), live.Listener.Addr().String(), cfg); !got.Healthy {
+		t.Errorf("live upstream unhealthy: %s", got.Error)
+	}
+	if got := probeUpstream(context.Background(), deadAddr(t), cfg); got.Healthy || got.Error == "" {
+		t.Errorf("dead upstream = %+v; expected unhealthy with error", got)
+	}
+}
+
+func TestServerPrefersHealthyUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "via backup")
+	}))
+	defer upstream.Close()
+
+	dead := deadAddr(t)
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = dead + "," + upstream.Listener.Addr().String()
+	cfg.HealthCheckInterval = 10 * time.Millisecond
+
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.health.healthy(dead) {
+		if time.Now().After(deadline) {
+			t.Fatal("dead upstream never marked unhealthy")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	proxyURL, _ := url.Parse("http://" + l.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get("http://example.test/")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d; expected 200", resp.StatusCode)
+	}
+
+	if failures := server.breakers.get(dead).failures; failures != 0 {
+		t.Fatalf("unhealthy upstream was tried %d times; expected it to be skipped", failures)
+	}
+}
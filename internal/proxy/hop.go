@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// hopHeaders are the hop-by-hop headers of RFC 7230, section 6.1: they
+// describe the connection between a client and the proxy, or the proxy and
+// the next server, and are not forwarded. HTTP/1.0 clients send
+// Keep-Alive and Proxy-Connection to ask for persistent connections.
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "TE", "Upgrade"}
+
+// removeHopHeaders removes the hop-by-hop headers from h, along with those
+// its Connection header names. A protocol upgrade and TE: trailers are
+// asked for again on the next hop.
+func removeHopHeaders(h http.Header) {
+	upgrade := ""
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			name = textproto.TrimString(name)
+			if strings.EqualFold(name, "upgrade") {
+				upgrade = h.Get("Upgrade")
+			}
+			if name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	trailers := headerHasToken(h, "TE", "trailers")
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+	if upgrade != "" {
+		h.Set("Connection", "Upgrade")
+		h.Set("Upgrade", upgrade)
+	}
+	if trailers {
+		h.Set("TE", "trailers")
+	}
+}
+
+// headerHasToken reports whether the comma-separated values of header in h
+// contain token.
+func headerHasToken(h http.Header, header, token string) bool {
+	for _, v := range h.Values(header) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(textproto.TrimString(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestRemoveHopHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected http.Header
+	}{
+		{
+			"HTTP/1.0 keep-alive",
+			http.Header{"Connection": {"keep-alive"}, "Keep-Alive": {"timeout=5"}, "Proxy-Connection": {"keep-alive"}, "Accept": {"*/*"}},
+			http.Header{"Accept": {"*/*"}},
+		},
+		{
+			"named by Connection",
+			http.Header{"Connection": {"close, X-Hop"}, "X-Hop": {"1"}, "X-End": {"2"}},
+			http.Header{"X-End": {"2"}},
+		},
+		{
+			"upgrade",
+			http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}},
+			http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}},
+		},
+		{
+			"upgrade not asked for",
+			http.Header{"Upgrade": {"websocket"}},
+			http.Header{},
+		},
+		{
+			"TE",
+			http.Header{"Te": {"gzip, trailers"}},
+			http.Header{"Te": {"trailers"}},
+		},
+	}
+	for _, tt := range tests {
+		removeHopHeaders(tt.header)
+		if fmt.Sprint(tt.header) != fmt.Sprint(tt.expected) {
+			t.Errorf("%s: got %v; expected %v", tt.name, tt.header, tt.expected)
+		}
+	}
+}
+
+func TestHTTP10Client(t *testing.T) {
+	var got *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("Keep-Alive", "timeout=5")
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.DirectOnly = true
+	cfg.StrictHTTP = false
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	send := func(request string) *http.Response {
+		t.Helper()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial proxy: %v", err)
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, request)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("read response: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	// The absolute-form request line names the destination, which HTTP/1.0
+	// clients may not repeat in a Host header.
+	resp := send("GET " + backend.URL + "/page HTTP/1.0\r\nConnection: keep-alive, X-Client-Hop\r\nKeep-Alive: 300\r\nProxy-Connection: keep-alive\r\nX-Client-Hop: 1\r\nX-End-To-End: 2\r\n\r\n")
+	if resp.StatusCode != http.StatusOK || got == nil {
+		t.Fatalf("status = %d; expected the request to reach the backend", resp.StatusCode)
+	}
+	if got.Host != backend.Listener.Addr().String() || got.URL.Path != "/page" {
+		t.Errorf("backend got %s%s; expected %s/page", got.Host, got.URL.Path, backend.Listener.Addr())
+	}
+	for _, name := range []string{"Keep-Alive", "Proxy-Connection", "X-Client-Hop"} {
+		if v := got.Header.Get(name); v != "" {
+			t.Errorf("backend got %s: %s; expected it removed", name, v)
+		}
+	}
+	if got.Header.Get("X-End-To-End") != "2" || got.Close {
+		t.Errorf("backend got X-End-To-End %q, close %t; expected 2 on a persistent connection", got.Header.Get("X-End-To-End"), got.Close)
+	}
+	if v := resp.Header.Get("Keep-Alive"); v != "" {
+		t.Errorf("client got Keep-Alive: %s from the backend", v)
+	}
+
+	// Without STRICT_HTTP, a Host header that differs is ignored, as RFC
+	// 7230 asks of proxies.
+	got = nil
+	resp = send("GET " + backend.URL + "/other HTTP/1.1\r\nHost: elsewhere.test\r\nConnection: close\r\n\r\n")
+	if resp.StatusCode != http.StatusOK || got == nil || got.Host != backend.Listener.Addr().String() {
+		t.Errorf("status = %d; expected the request to reach the backend as %s", resp.StatusCode, backend.Listener.Addr())
+	}
+
+	resp = send("GET /page HTTP/1.0\r\n\r\n")
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get(ErrorHeader) != "bad-target" {
+		t.Errorf("request without a host = %d %s; expected 400 bad-target", resp.StatusCode, resp.Header.Get(ErrorHeader))
+	}
+}
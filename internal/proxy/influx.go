@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// influxCheckInterval is how often the exporter checks whether INFLUX_URL
+// was set by a reload while it is not exporting.
+const influxCheckInterval = 10 * time.Second
+
+// influxTimeout bounds each push.
+const influxTimeout = 10 * time.Second
+
+// maxInfluxDatagram bounds the UDP packets lines are sent in, to stay below
+// common MTUs.
+const maxInfluxDatagram = 1400
+
+// runInfluxExport pushes the core metrics to INFLUX_URL every
+// INFLUX_INTERVAL until the server is stopped.
+func (s *Server) runInfluxExport() {
+	for {
+		cfg := s.state.Load().cfg
+		wait := influxCheckInterval
+		if cfg.InfluxURL != "" {
+			if err := pushInflux(cfg, s.influxLines(time.Now())); err != nil {
+				Warn.Printf("Exporting metrics to %s failed: %v", feedName(cfg.InfluxURL), err)
+			}
+			wait = cfg.InfluxInterval
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// influxLines returns the core metrics in InfluxDB line protocol, each
+// tagged with the host name: connections, setup latency, upstream health,
+// routing decisions, the DNS cache and the connection pools.
+func (s *Server) influxLines(now time.Time) []string {
+	host, _ := os.Hostname()
+	tags := influxTags("host", host)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	var lines []string
+	line := func(measurement, tags string, fields ...string) {
+		lines = append(lines, measurement+tags+" "+strings.Join(fields, ",")+" "+ts)
+	}
+
+	var requests, tunnels int
+	for _, c := range s.activity.Active() {
+		if c.Kind == "tunnel" {
+			tunnels++
+		} else {
+			requests++
+		}
+	}
+	line("dynamicproxy_connections", tags, influxInt("requests", requests), influxInt("tunnels", tunnels), influxInt("goroutines", runtime.NumGoroutine()))
+
+	for _, h := range s.latency.snapshot() {
+		fields := []string{influxInt("count", int(h.Count)), influxFloat("sum", h.Sum.Seconds())}
+		for _, b := range h.Buckets {
+			fields = append(fields, influxInt("le_"+b.LE.String(), int(b.Count)))
+		}
+		line("dynamicproxy_setup_latency", tags+influxTags("kind", h.Kind, "route", h.Route, "upstream", h.Upstream), fields...)
+	}
+
+	for _, u := range s.Upstreams() {
+		line("dynamicproxy_upstream", tags+influxTags("upstream", u.Addr),
+			influxBool("healthy", u.Healthy), influxString("circuit", u.Circuit), influxFloat("check_latency", u.Latency.Seconds()),
+			influxFloat("error_rate", u.ErrorRate), influxBool("demoted", !u.DemotedUntil.IsZero()), influxInt("demotions", u.Demotions))
+	}
+
+	for _, d := range s.Decisions() {
+		line("dynamicproxy_decisions", tags+influxTags("route", d.Route, "rule", d.Rule), influxInt("count", int(d.Count)))
+	}
+
+	pools := s.Pools()
+	line("dynamicproxy_dns_cache", tags, influxInt("entries", pools.DNSCache.Entries), influxInt("hits", int(pools.DNSCache.Hits)),
+		influxInt("misses", int(pools.DNSCache.Misses)), influxInt("negative_hits", int(pools.DNSCache.Negatives)))
+	line("dynamicproxy_pools", tags, influxInt("spare_tunnels", pools.SpareTunnels), influxInt("upstream_http2", pools.UpstreamHTTP2),
+		influxInt("config_generation", int(pools.Generation)))
+	return lines
+}
+
+// pushInflux sends lines to INFLUX_URL: udp://host:port for a UDP
+// listener, or the URL of the write endpoint of InfluxDB or Telegraf.
+func pushInflux(cfg config.Config, lines []string) error {
+	u, err := url.Parse(cfg.InfluxURL)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), influxTimeout)
+	defer cancel()
+	if u.Scheme == "udp" {
+		conn, err := newDirectDialer(cfg).DialContext(ctx, "udp", u.Host)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		for _, packet := range influxPackets(lines) {
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.InfluxURL, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if cfg.InfluxToken != "" {
+		req.Header.Set("Authorization", "Token "+cfg.InfluxToken)
+	}
+	resp, err := (&http.Client{Transport: NewDirectTransport(cfg)}).Do(req)
+	if err != nil {
+		// The error names the URL, with the credentials of a 1.x query.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = feedName(urlErr.URL)
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// influxPackets packs lines into datagrams of at most maxInfluxDatagram
+// bytes, except for single lines that are longer.
+func influxPackets(lines []string) [][]byte {
+	var packets [][]byte
+	var buf bytes.Buffer
+	for _, l := range lines {
+		if buf.Len() > 0 && buf.Len()+len(l)+1 > maxInfluxDatagram {
+			packets = append(packets, bytes.Clone(buf.Bytes()))
+			buf.Reset()
+		}
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxTags formats key/value pairs as tags. Empty values are left out,
+// as line protocol does not allow them.
+func influxTags(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			b.WriteString("," + kv[i] + "=" + influxTagEscaper.Replace(kv[i+1]))
+		}
+	}
+	return b.String()
+}
+
+func influxInt(key string, v int) string {
+	return key + "=" + strconv.Itoa(v) + "i"
+}
+
+func influxFloat(key string, v float64) string {
+	return key + "=" + strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func influxBool(key string, v bool) string {
+	return key + "=" + strconv.FormatBool(v)
+}
+
+func influxString(key, v string) string {
+	return key + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
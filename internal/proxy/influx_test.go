@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestInfluxLines(t *testing.T) {
+	server := NewServer(config.DefaultConfig())
+	defer server.Close()
+	server.latency.observe(ConnInfo{Kind: "http", Route: routeUpstream, Upstream: "proxy a:3128", Setup: time.Millisecond})
+
+	lines := server.influxLines(time.Unix(0, 42))
+	measurements := make(map[string]string)
+	for _, line := range lines {
+		if !strings.HasSuffix(line, " 42") {
+			t.Errorf("line %q does not end with the timestamp", line)
+		}
+		measurements[line[:strings.IndexAny(line, ", ")]] = line
+	}
+	for _, m := range []string{"dynamicproxy_connections", "dynamicproxy_setup_latency", "dynamicproxy_dns_cache", "dynamicproxy_pools"} {
+		if _, ok := measurements[m]; !ok {
+			t.Errorf("no %s in %q", m, lines)
+		}
+	}
+	if line := measurements["dynamicproxy_setup_latency"]; !strings.Contains(line, `,kind=http,route=upstream,upstream=proxy\ a:3128 count=1i,`) {
+		t.Errorf("setup latency line %q", line)
+	}
+}
+
+func TestInfluxEscaping(t *testing.T) {
+	if got, expected := influxTags("a", "x,y=z w", "empty", ""), `,a=x\,y\=z\ w`; got != expected {
+		t.Errorf("influxTags = %q; expected %q", got, expected)
+	}
+	if got, expected := influxString("circuit", `half "open" \`), `circuit="half \"open\" \\"`; got != expected {
+		t.Errorf("influxString = %q; expected %q", got, expected)
+	}
+}
+
+func TestPushInfluxHTTP(t *testing.T) {
+	received := make(chan string, 1)
+	var auth string
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.InfluxURL = influx.URL + "/api/v2/write?org=ops&bucket=proxy"
+	cfg.InfluxToken = "t0ken"
+	if err := pushInflux(cfg, []string{"m1 v=1i 1", "m2 v=2i 1"}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if got := <-received; got != "m1 v=1i 1\nm2 v=2i 1\n" || auth != "Token t0ken" {
+		t.Errorf("received %q with authorization %q", got, auth)
+	}
+
+	cfg.InfluxURL = influx.URL + "/missing"
+	influx.Config.Handler = http.NotFoundHandler()
+	if err := pushInflux(cfg, []string{"m v=1i 1"}); err == nil {
+		t.Error("push to a failing endpoint succeeded")
+	}
+
+	influx.Close()
+	cfg.InfluxURL = influx.URL + "/write?db=proxy&u=writer&p=s3cret"
+	if err := pushInflux(cfg, []string{"m v=1i 1"}); err == nil || strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("push to a closed endpoint = %v; expected an error without the password", err)
+	}
+}
+
+func TestPushInfluxUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer pc.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.InfluxURL = "udp://" + pc.LocalAddr().String()
+	long := "m v=\"" + strings.Repeat("x", maxInfluxDatagram) + "\" 1"
+	if err := pushInflux(cfg, []string{"m v=1i 1", long}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2*maxInfluxDatagram)
+	for _, expected := range []string{"m v=1i 1\n", long + "\n"} {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if string(buf[:n]) != expected {
+			t.Errorf("datagram %q; expected %q", buf[:n], expected)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the setup latency histograms.
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyHistogram counts how long requests took to their response headers,
+// or tunnels to be established, for one kind of connection and route and,
+// for the upstream route, one upstream.
+type LatencyHistogram struct {
+	Kind     string        `json:"kind"`
+	Route    string        `json:"route"`
+	Upstream string        `json:"upstream,omitempty"`
+	Count    int64         `json:"count"`
+	Sum      time.Duration `json:"sum"`
+	// Buckets are cumulative, as in Prometheus: each counts the setups
+	// that took at most LE. Count includes the slower ones.
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+type LatencyBucket struct {
+	LE    time.Duration `json:"le"`
+	Count int64         `json:"count"`
+}
+
+type latencyKey struct {
+	kind, route, upstream string
+}
+
+// latencyTracker records the setup latency of finished connections.
+type latencyTracker struct {
+	mu         sync.Mutex
+	histograms map[latencyKey]*LatencyHistogram
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{histograms: make(map[latencyKey]*LatencyHistogram)}
+}
+
+// observe records info's setup latency. Connections that failed before
+// getting a response or tunnel, and replayed ones, are not counted.
+func (t *latencyTracker) observe(info ConnInfo) {
+	if info.Setup <= 0 || info.Route == "" || info.Route == routeReplay {
+		return
+	}
+	key := latencyKey{info.Kind, info.Route, info.Upstream}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.histograms[key]
+	if h == nil {
+		h = &LatencyHistogram{Kind: key.kind, Route: key.route, Upstream: key.upstream, Buckets: make([]LatencyBucket, len(latencyBuckets))}
+		for i, le := range latencyBuckets {
+			h.Buckets[i].LE = le
+		}
+		t.histograms[key] = h
+	}
+	h.Count++
+	h.Sum += info.Setup
+	for i := range h.Buckets {
+		if info.Setup <= h.Buckets[i].LE {
+			h.Buckets[i].Count++
+		}
+	}
+}
+
+func (t *latencyTracker) snapshot() []LatencyHistogram {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]LatencyHistogram, 0, len(t.histograms))
+	for _, h := range t.histograms {
+		c := *h
+		c.Buckets = slices.Clone(h.Buckets)
+		out = append(out, c)
+	}
+	slices.SortFunc(out, func(a, b LatencyHistogram) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Route, b.Route), cmp.Compare(a.Upstream, b.Upstream))
+	})
+	return out
+}
+
+// Latency reports the setup latency histograms of requests and tunnels by
+// route and upstream, since the server started.
+func (s *Server) Latency() []LatencyHistogram {
+	return s.latency.snapshot()
+}
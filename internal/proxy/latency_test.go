@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := newLatencyTracker()
+	for _, info := range []ConnInfo{
+		{Kind: "http", Route: routeDirect, Setup: 3 * time.Millisecond},
+		{Kind: "http", Route: routeDirect, Setup: 40 * time.Millisecond},
+		{Kind: "http", Route: routeUpstream, Upstream: "proxy-a:3128", Setup: 300 * time.Millisecond},
+		{Kind: "tunnel", Route: routeUpstream, Upstream: "proxy-a:3128", Setup: 20 * time.Second},
+		{Kind: "http", Route: routeUpstream, Upstream: "proxy-b:3128"},
+		{Kind: "http", Route: routeReplay, Setup: time.Millisecond},
+	} {
+		tracker.observe(info)
+	}
+
+	got := tracker.snapshot()
+	tests := []struct {
+		kind, route, upstream string
+		count                 int64
+		// within are the setups of at most 5ms, 50ms and 1s.
+		within [3]int64
+	}{
+		{"http", routeDirect, "", 2, [3]int64{1, 2, 2}},
+		{"http", routeUpstream, "proxy-a:3128", 1, [3]int64{0, 0, 1}},
+		{"tunnel", routeUpstream, "proxy-a:3128", 1, [3]int64{0, 0, 0}},
+	}
+	if len(got) != len(tests) {
+		t.Fatalf("got %d histograms; expected %d: %+v", len(got), len(tests), got)
+	}
+	for i, tt := range tests {
+		h := got[i]
+		if h.Kind != tt.kind || h.Route != tt.route || h.Upstream != tt.upstream || h.Count != tt.count {
+			t.Errorf("histogram %d = %s %s %s with %d; expected %s %s %s with %d", i, h.Kind, h.Route, h.Upstream, h.Count, tt.kind, tt.route, tt.upstream, tt.count)
+		}
+		within := [3]int64{h.Buckets[0].Count, h.Buckets[3].Count, h.Buckets[7].Count}
+		if within != tt.within {
+			t.Errorf("histogram %d buckets %v; expected %v", i, within, tt.within)
+		}
+	}
+}
+
+func TestLatencyPerUpstream(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = backend.Listener.Addr().String()
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET http://intranet.test/ HTTP/1.1\r\nHost: intranet.test\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	for deadline := time.Now().Add(2 * time.Second); len(server.Latency()) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no latency recorded")
+		}
+	}
+	got := server.Latency()
+	if len(got) != 1 || got[0].Kind != "http" || got[0].Route != routeUpstream || got[0].Upstream != cfg.UpstreamProxy || got[0].Count != 1 {
+		t.Errorf("latency = %+v; expected one request through %s", got, cfg.UpstreamProxy)
+	}
+}
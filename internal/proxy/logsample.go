@@ -0,0 +1,20 @@
+package proxy
+
+import "sync/atomic"
+
+// logSampler applies LOG_SAMPLE_RATE to the Info lines logged for every
+// request and tunnel: only the first of every rate of them is logged.
+// Warnings and errors, which cover failed and denied requests, are never
+// sampled.
+type logSampler struct {
+	rate atomic.Int64
+	seen atomic.Uint64
+}
+
+var requestLogs logSampler
+
+// sample reports whether the next line is to be logged.
+func (s *logSampler) sample() bool {
+	rate := s.rate.Load()
+	return rate <= 1 || (s.seen.Add(1)-1)%uint64(rate) == 0
+}
@@ -0,0 +1,28 @@
+package proxy
+
+import "testing"
+
+func TestLogSampler(t *testing.T) {
+	tests := []struct {
+		rate   int64
+		logged int
+	}{
+		{0, 10},
+		{1, 10},
+		{3, 4},
+		{20, 1},
+	}
+	for _, tt := range tests {
+		var s logSampler
+		s.rate.Store(tt.rate)
+		logged := 0
+		for range 10 {
+			if s.sample() {
+				logged++
+			}
+		}
+		if logged != tt.logged {
+			t.Errorf("rate %d logged %d of 10 lines; expected %d", tt.rate, logged, tt.logged)
+		}
+	}
+}
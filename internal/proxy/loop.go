@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// viaToken identifies this process in the Via headers it adds, so a request
+// that comes back around through any chain of proxies is recognised.
+var viaToken = newViaToken()
+
+func newViaToken() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return "dynamicproxy-" + hex.EncodeToString(b)
+}
+
+// viaValue is the Via entry this proxy adds for a request of the given
+// protocol version.
+func viaValue(major, minor int) string {
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	return fmt.Sprintf("%d.%d %s", major, minor, viaToken)
+}
+
+// seenBefore reports whether req already passed through this proxy.
+func seenBefore(req *http.Request) bool {
+	for _, via := range req.Header.Values("Via") {
+		for _, hop := range strings.Split(via, ",") {
+			if fields := strings.Fields(hop); len(fields) >= 2 && fields[1] == viaToken {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// targetAddr returns the host:port req is addressed to.
+func targetAddr(req *http.Request) string {
+	if _, _, err := net.SplitHostPort(req.Host); err == nil {
+		return req.Host
+	}
+	port := "80"
+	switch req.URL.Scheme {
+	case "https":
+		port = "443"
+	case "ftp":
+		port = "21"
+	}
+	return net.JoinHostPort(strings.Trim(req.Host, "[]"), port)
+}
+
+func writeLoopDetected(w http.ResponseWriter, req *http.Request, reason string) {
+	Error.Printf("Loop detected for %s %s: %s", req.Method, req.Host, reason)
+	trackedConnFrom(req).setError(fmt.Errorf("loop detected: %s", reason))
+	w.Header().Set(ErrorHeader, "loop-detected")
+	http.Error(w, "Loop detected: "+reason, http.StatusLoopDetected)
+}
+
+// pointsToListener reports whether addr (host:port) reaches one of listeners.
+// Only addresses on a listening port are resolved, so ordinary requests never
+// pay for the lookup.
+func pointsToListener(addr string, listeners []net.Addr) bool {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return false
+	}
+
+	var candidates []*net.TCPAddr
+	for _, l := range listeners {
+		if tcp, ok := l.(*net.TCPAddr); ok && tcp.Port == port {
+			candidates = append(candidates, tcp)
+		}
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+
+	ips, err := lookupIPs(host)
+	if err != nil {
+		return false
+	}
+	for _, l := range candidates {
+		for _, ip := range ips {
+			if l.IP.IsUnspecified() && isLocalIP(ip) || l.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func lookupIPs(host string) ([]net.IP, error) {
+	if host == "" {
+		return []net.IP{net.IPv4zero}, nil
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return net.DefaultResolver.LookupIP(ctx, "ip", host)
+}
+
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestSeenBefore(t *testing.T) {
+	tests := []struct {
+		via      []string
+		expected bool
+	}{
+		{nil, false},
+		{[]string{"1.1 corporate-proxy"}, false},
+		{[]string{"1.1 " + viaToken}, true},
+		{[]string{"1.0 fred, 1.1 " + viaToken + " (DynamicProxy)"}, true},
+		{[]string{"1.1 other", "1.1 " + viaToken}, true},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://example.test/", nil)
+		for _, v := range tt.via {
+			req.Header.Add("Via", v)
+		}
+		if got := seenBefore(req); got != tt.expected {
+			t.Errorf("seenBefore(Via %q) = %v; expected %v", tt.via, got, tt.expected)
+		}
+	}
+}
+
+func TestPointsToListener(t *testing.T) {
+	loopback := []net.Addr{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}}
+	wildcard := []net.Addr{&net.TCPAddr{IP: net.IPv4zero, Port: 8080}}
+
+	tests := []struct {
+		addr      string
+		listeners []net.Addr
+		expected  bool
+	}{
+		{"127.0.0.1:8080", loopback, true},
+		{"localhost:8080", loopback, true},
+		{"127.0.0.1:8081", loopback, false},
+		{"192.0.2.10:8080", loopback, false},
+		{"127.0.0.1:8080", wildcard, true},
+		{"[::1]:8080", wildcard, true},
+		{"192.0.2.10:8080", wildcard, false},
+		{"example.com", wildcard, false},
+	}
+
+	for _, tt := range tests {
+		if got := pointsToListener(tt.addr, tt.listeners); got != tt.expected {
+			t.Errorf("pointsToListener(%q, %v) = %v; expected %v", tt.addr, tt.listeners, got, tt.expected)
+		}
+	}
+}
+
+func TestServerDetectsLoops(t *testing.T) {
+	server := NewServer(config.DefaultConfig())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	self := l.Addr().String()
+	proxyURL, _ := url.Parse("http://" + self)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	get := func(target string, header http.Header) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		req.Header = header
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	tests := []struct {
+		name     string
+		upstream string
+		target   string
+		header   http.Header
+	}{
+		{"Via header", "", "http://example.test/", http.Header{"Via": {"1.1 " + viaToken}}},
+		{"destination is the proxy", "", "http://" + self + "/", nil},
+		{"upstream is the proxy", self, "http://example.test/", nil},
+	}
+
+	for _, tt := range tests {
+		cfg := config.DefaultConfig()
+		cfg.UpstreamProxy = tt.upstream
+		server.SetConfig(cfg)
+		resp := get(tt.target, tt.header)
+		if resp.StatusCode != http.StatusLoopDetected {
+			t.Errorf("%s: status = %d; expected %d", tt.name, resp.StatusCode, http.StatusLoopDetected)
+		}
+		if got := resp.Header.Get(ErrorHeader); got != "loop-detected" {
+			t.Errorf("%s: %s = %q; expected loop-detected", tt.name, ErrorHeader, got)
+		}
+	}
+}
+
+func TestCloneRequestAddsVia(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/", nil)
+	req.Header.Set("Via", "1.0 fred")
+
+	got := CloneRequest(req).Header.Values("Via")
+	if len(got) != 2 || got[0] != "1.0 fred" || !strings.HasSuffix(got[1], viaToken) {
+		t.Fatalf("Via = %q; expected fred followed by this proxy", got)
+	}
+	if len(req.Header.Values("Via")) != 1 {
+		t.Fatal("CloneRequest modified the original request headers")
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// memoryCheckInterval is how often memory use is compared to
+	// MEMORY_LIMIT.
+	memoryCheckInterval = time.Second
+	// memoryResumePercent is the share of MEMORY_LIMIT memory use has to
+	// fall below before new requests are accepted again, so that the proxy
+	// does not flap around the limit.
+	memoryResumePercent = 90
+	// memoryRetryAfter is what requests refused under memory pressure are
+	// told to wait.
+	memoryRetryAfter = "5"
+)
+
+// processMemory returns the memory the Go runtime holds from the operating
+// system, which is close to the resident size of the process. It is a
+// variable so that tests can simulate memory pressure.
+var processMemory = func() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	var total, released uint64
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		total = samples[0].Value.Uint64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		released = samples[1].Value.Uint64()
+	}
+	return total - released
+}
+
+// memoryGuard sheds load while memory use is above MEMORY_LIMIT.
+type memoryGuard struct {
+	shedding atomic.Bool
+	// limit is the MEMORY_LIMIT the garbage collector was last told about.
+	limit int64
+}
+
+// check compares memory use to limit and reports whether shedding started
+// or stopped, along with the memory in use.
+func (g *memoryGuard) check(limit int64) (changed bool, used uint64) {
+	if limit != g.limit {
+		if limit > 0 {
+			debug.SetMemoryLimit(limit)
+		} else if g.limit > 0 {
+			debug.SetMemoryLimit(-1)
+		}
+		g.limit = limit
+	}
+	if limit <= 0 {
+		return g.shedding.Swap(false), 0
+	}
+	used = processMemory()
+	switch {
+	case used > uint64(limit):
+		return !g.shedding.Swap(true), used
+	case used < uint64(limit)/100*memoryResumePercent:
+		return g.shedding.Swap(false), used
+	}
+	return false, used
+}
+
+// runMemoryGuard checks memory use every memoryCheckInterval until the
+// server is stopped. Once MEMORY_LIMIT is exceeded, new requests are refused
+// and caches and idle connections are dropped, so that the process gets
+// back below the limit instead of being killed with every tunnel it holds.
+func (s *Server) runMemoryGuard() {
+	for {
+		state := s.state.Load()
+		changed, used := s.memory.check(state.cfg.MemoryLimit)
+		if changed && s.memory.shedding.Load() {
+			Warn.Printf("Memory use of %d bytes exceeds MEMORY_LIMIT of %d, refusing new requests", used, state.cfg.MemoryLimit)
+			s.webhooks.notify(EventMemoryPressure, "", fmt.Sprintf("Memory use of %d bytes exceeds the limit of %d, refusing new requests", used, state.cfg.MemoryLimit))
+			resolveCache.purge()
+			state.closeIdleConnections()
+			debug.FreeOSMemory()
+		} else if changed {
+			Info.Printf("Memory use of %d bytes is below MEMORY_LIMIT again, accepting new requests", used)
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(memoryCheckInterval):
+		}
+	}
+}
+
+// overloaded answers req with 503 Service Unavailable while memory use is
+// above MEMORY_LIMIT and reports whether it did.
+func (s *Server) overloaded(w http.ResponseWriter, req *http.Request) bool {
+	if !s.memory.shedding.Load() {
+		return false
+	}
+	Warn.Printf("Refused %s %s from %s: memory use above MEMORY_LIMIT", req.Method, req.Host, logClient(usageClient(req)))
+	w.Header().Set("Retry-After", memoryRetryAfter)
+	w.Header().Set(ErrorHeader, "overloaded")
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	return true
+}
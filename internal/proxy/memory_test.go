@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func stubProcessMemory(t *testing.T, used *uint64) {
+	t.Helper()
+	orig := processMemory
+	limit := debug.SetMemoryLimit(-1)
+	t.Cleanup(func() {
+		processMemory = orig
+		debug.SetMemoryLimit(limit)
+	})
+	processMemory = func() uint64 { return *used }
+}
+
+func TestMemoryGuardCheck(t *testing.T) {
+	var used uint64
+	stubProcessMemory(t, &used)
+	g := &memoryGuard{}
+
+	steps := []struct {
+		limit    int64
+		used     uint64
+		changed  bool
+		shedding bool
+	}{
+		{1000, 500, false, false},
+		{1000, 1200, true, true},
+		{1000, 1300, false, true},
+		// Between 90% and 100% of the limit nothing changes.
+		{1000, 950, false, true},
+		{1000, 850, true, false},
+		{1000, 950, false, false},
+		{1000, 1001, true, true},
+		{0, 5000, true, false},
+	}
+	for i, s := range steps {
+		used = s.used
+		changed, _ := g.check(s.limit)
+		if changed != s.changed || g.shedding.Load() != s.shedding {
+			t.Errorf("step %d: check(%d) with %d used = %v, shedding %v; expected %v, %v",
+				i, s.limit, s.used, changed, g.shedding.Load(), s.changed, s.shedding)
+		}
+	}
+}
+
+func TestServerRefusesRequestsUnderMemoryPressure(t *testing.T) {
+	used := uint64(2000)
+	stubProcessMemory(t, &used)
+	cfg := config.DefaultConfig()
+	cfg.MemoryLimit = 1000
+	server := NewServer(cfg)
+	server.memory.check(cfg.MemoryLimit)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.test/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get(ErrorHeader) != "overloaded" || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("response under memory pressure = %d %s=%q; expected 503 overloaded with Retry-After", rec.Code, ErrorHeader, rec.Header().Get(ErrorHeader))
+	}
+
+	used = 100
+	server.memory.check(cfg.MemoryLimit)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.test/", nil))
+	if rec.Header().Get(ErrorHeader) == "overloaded" {
+		t.Errorf("request refused after memory use dropped below the limit")
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// MirrorTruncatedHeader is set on mirrored requests whose body was cut off at
+// MIRROR_BODY_LIMIT.
+const MirrorTruncatedHeader = "X-DynamicProxy-Mirror-Truncated"
+
+// maxMirrorsInFlight bounds the mirrored requests waiting for the shadow
+// upstream. Requests beyond it are not mirrored, so a slow shadow can never
+// hold back the primary traffic.
+const maxMirrorsInFlight = 64
+
+// mirror copies plain-HTTP requests to MIRROR_UPSTREAM, e.g. a replacement
+// proxy under test, and discards its responses.
+type mirror struct {
+	transport http.RoundTripper
+	slots     chan struct{}
+}
+
+func newMirror(cfg config.Config) *mirror {
+	if cfg.MirrorUpstream == "" {
+		return nil
+	}
+	return &mirror{transport: newUpstreamTransport(cfg, cfg.MirrorUpstream), slots: make(chan struct{}, maxMirrorsInFlight)}
+}
+
+// send mirrors req in the background. Up to MIRROR_BODY_LIMIT bytes of the
+// body are read ahead and handed to both the mirror and, followed by the
+// rest of the body, the primary request.
+func (m *mirror) send(req *http.Request, cfg config.Config) {
+	if m == nil {
+		return
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		Warn.Printf("Not mirroring %s %s: %d mirrored requests in flight", req.Method, req.Host, maxMirrorsInFlight)
+		return
+	}
+
+	var body []byte
+	truncated := false
+	if req.Body != nil && req.Body != http.NoBody {
+		head, err := io.ReadAll(io.LimitReader(req.Body, int64(cfg.MirrorBodyLimit)+1))
+		req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), req.Body), Closer: req.Body}
+		if err != nil {
+			<-m.slots
+			return
+		}
+		body, truncated = head, len(head) > cfg.MirrorBodyLimit
+		if truncated {
+			body = head[:cfg.MirrorBodyLimit]
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), cfg.ClientRequestTimeout)
+	out := CloneRequest(req.WithContext(ctx))
+	out.Body = http.NoBody
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	out.ContentLength = int64(len(body))
+	out.Header.Del("Content-Length")
+	if truncated {
+		out.Header.Set(MirrorTruncatedHeader, strconv.Itoa(cfg.MirrorBodyLimit))
+	}
+
+	go func() {
+		defer func() { <-m.slots }()
+		defer cancel()
+		resp, err := m.transport.RoundTrip(out)
+		if err != nil {
+			Warn.Printf("Mirroring %s %s to %s failed: %v", req.Method, req.Host, cfg.MirrorUpstream, logError(err))
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
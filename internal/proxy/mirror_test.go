@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+type mirroredRequest struct {
+	url       string
+	body      string
+	truncated string
+}
+
+func TestMirrorCopiesRequests(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, "primary got "+string(body))
+	}))
+	defer primary.Close()
+
+	mirrored := make(chan mirroredRequest, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- mirroredRequest{url: r.URL.String(), body: string(body), truncated: r.Header.Get(MirrorTruncatedHeader)}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer shadow.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.MirrorUpstream = strings.TrimPrefix(shadow.URL, "http://")
+	cfg.MirrorBodyLimit = 4
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+	resp, err := client.Post(primary.URL+"/upload", "text/plain", strings.NewReader("abcdefgh"))
+	if err != nil {
+		t.Fatalf("POST through proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "primary got abcdefgh" {
+		t.Fatalf("primary response = %d %q; expected 200 %q", resp.StatusCode, body, "primary got abcdefgh")
+	}
+
+	select {
+	case got := <-mirrored:
+		expected := mirroredRequest{url: primary.URL + "/upload", body: "abcd", truncated: "4"}
+		if got != expected {
+			t.Fatalf("mirrored request = %+v; expected %+v", got, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("request was not mirrored")
+	}
+}
+
+func TestMirrorDisabled(t *testing.T) {
+	if m := newMirror(config.DefaultConfig()); m != nil {
+		t.Fatalf("newMirror without MIRROR_UPSTREAM = %v; expected nil", m)
+	}
+	// A nil mirror leaves requests alone.
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("body"))
+	body := req.Body
+	(*mirror)(nil).send(req, config.DefaultConfig())
+	if req.Body != body {
+		t.Fatalf("send on a nil mirror replaced the request body")
+	}
+}
@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// errNTLMv1 is returned for requests that would authenticate with NTLMv1
+// while NTLM_V2_ONLY is set.
+var errNTLMv1 = errors.New("refusing NTLMv1 authentication")
+
+// ntlmInspector looks at the NTLM messages of the requests sent by rt and
+// the challenges in their responses. With debug set it logs every message
+// of the handshake, leaving out challenges, responses and session keys;
+// with v2Only it refuses to send NTLMv1 authenticate messages, whether
+// built by the NTLM upstream authentication or passed through from clients.
+type ntlmInspector struct {
+	http.RoundTripper
+	debug  bool
+	v2Only bool
+}
+
+// withNTLMInspector wraps rt in an ntlmInspector if NTLM_DEBUG or
+// NTLM_V2_ONLY is set.
+func withNTLMInspector(rt http.RoundTripper, cfg config.Config) http.RoundTripper {
+	if !cfg.NTLMDebug && !cfg.NTLMv2Only {
+		return rt
+	}
+	return ntlmInspector{RoundTripper: rt, debug: cfg.NTLMDebug, v2Only: cfg.NTLMv2Only}
+}
+
+func (n ntlmInspector) RoundTrip(req *http.Request) (*http.Response, error) {
+	authenticating := false
+	for _, header := range []string{"Authorization", "Proxy-Authorization"} {
+		msg, ok := ntlmToken(req.Header.Get(header))
+		if !ok {
+			continue
+		}
+		m, err := parseNTLM(msg)
+		if err != nil {
+			if n.debug {
+				Warn.Printf("NTLM %s to %s: %v", header, req.URL.Host, err)
+			}
+			continue
+		}
+		if n.debug {
+			Info.Printf("NTLM %s to %s: %s", header, req.URL.Host, m)
+		}
+		if m.kind == ntlmAuthenticate {
+			authenticating = true
+			if n.v2Only && m.v1 {
+				Warn.Printf("Refusing NTLMv1 authentication of %s to %s", m.user, req.URL.Host)
+				return nil, errNTLMv1
+			}
+		}
+	}
+	resp, err := n.RoundTripper.RoundTrip(req)
+	if err != nil || !n.debug {
+		return resp, err
+	}
+	for _, header := range []string{"WWW-Authenticate", "Proxy-Authenticate"} {
+		for _, value := range resp.Header.Values(header) {
+			msg, ok := ntlmToken(value)
+			if !ok {
+				continue
+			}
+			if m, err := parseNTLM(msg); err != nil {
+				Warn.Printf("NTLM %s from %s: %v", header, req.URL.Host, err)
+			} else {
+				Info.Printf("NTLM %s from %s: %s", header, req.URL.Host, m)
+			}
+		}
+	}
+	if authenticating && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusProxyAuthRequired) {
+		Warn.Printf("NTLM authentication to %s failed: %s", req.URL.Host, resp.Status)
+	}
+	return resp, err
+}
+
+func (n ntlmInspector) CloseIdleConnections() {
+	closeIdle(n.RoundTripper)
+}
+
+// ntlmToken returns the NTLM message of an NTLM or Negotiate authorization
+// or challenge header value. Negotiate tokens that are not NTLM, such as
+// Kerberos ones, are ignored.
+func ntlmToken(value string) ([]byte, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok || !strings.EqualFold(scheme, "NTLM") && !strings.EqualFold(scheme, "Negotiate") {
+		return nil, false
+	}
+	msg, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil || !bytes.HasPrefix(msg, ntlmSignature) {
+		return nil, false
+	}
+	return msg, true
+}
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+const (
+	ntlmNegotiate    = 1
+	ntlmChallenge    = 2
+	ntlmAuthenticate = 3
+)
+
+// ntlmMessage is what an NTLM message tells about the handshake, without
+// its secrets.
+type ntlmMessage struct {
+	kind        uint32
+	flags       uint32
+	domain      string
+	user        string
+	workstation string
+	target      string
+	targetInfo  []string
+	version     string
+	// v1 is set for authenticate messages with an NTLMv1 response.
+	v1 bool
+}
+
+func (m ntlmMessage) String() string {
+	var b strings.Builder
+	switch m.kind {
+	case ntlmNegotiate:
+		fmt.Fprintf(&b, "negotiate, domain %q, workstation %q", m.domain, m.workstation)
+	case ntlmChallenge:
+		fmt.Fprintf(&b, "challenge, target %q, target info [%s]", m.target, strings.Join(m.targetInfo, " "))
+		if m.flags&ntlmFlagLMKey != 0 {
+			b.WriteString(", requests the LM session key")
+		}
+	case ntlmAuthenticate:
+		protocol := "NTLMv2"
+		if m.v1 {
+			protocol = "NTLMv1"
+		}
+		fmt.Fprintf(&b, "authenticate with %s, user %q, domain %q, workstation %q", protocol, m.user, m.domain, m.workstation)
+	}
+	fmt.Fprintf(&b, ", flags %s", ntlmFlagNames(m.flags))
+	if m.version != "" {
+		fmt.Fprintf(&b, ", version %s", m.version)
+	}
+	return b.String()
+}
+
+// parseNTLM reads an NTLM message as laid out in MS-NLMP section 2.2.1.
+func parseNTLM(msg []byte) (ntlmMessage, error) {
+	var m ntlmMessage
+	if len(msg) < 12 || !bytes.HasPrefix(msg, ntlmSignature) {
+		return m, errors.New("not an NTLM message")
+	}
+	m.kind = binary.LittleEndian.Uint32(msg[8:])
+	var flagsAt, versionAt int
+	switch m.kind {
+	case ntlmNegotiate:
+		flagsAt, versionAt = 12, 32
+	case ntlmChallenge:
+		flagsAt, versionAt = 20, 48
+	case ntlmAuthenticate:
+		flagsAt, versionAt = 60, 64
+	default:
+		return m, fmt.Errorf("unknown NTLM message type %d", m.kind)
+	}
+	if len(msg) < flagsAt+4 {
+		return m, fmt.Errorf("truncated NTLM message type %d", m.kind)
+	}
+	m.flags = binary.LittleEndian.Uint32(msg[flagsAt:])
+	unicode := m.flags&ntlmFlagUnicode != 0
+	var err error
+	str := func(at int, unicode bool) string {
+		field, ferr := ntlmField(msg, at)
+		if ferr != nil {
+			err = ferr
+		}
+		return ntlmString(field, unicode)
+	}
+	switch m.kind {
+	case ntlmNegotiate:
+		// The names are OEM strings, present only with their flags.
+		if m.flags&ntlmFlagDomainSupplied != 0 {
+			m.domain = str(16, false)
+		}
+		if m.flags&ntlmFlagWorkstationSupplied != 0 {
+			m.workstation = str(24, false)
+		}
+	case ntlmChallenge:
+		m.target = str(12, unicode)
+		info, ferr := ntlmField(msg, 40)
+		if ferr != nil {
+			err = ferr
+		}
+		m.targetInfo = ntlmTargetInfo(info)
+	case ntlmAuthenticate:
+		nt, ferr := ntlmField(msg, 20)
+		if ferr != nil {
+			err = ferr
+		}
+		// NTLMv1 responses are always 24 bytes; NTLMv2 ones carry the
+		// client challenge and target info after a 16 byte proof.
+		m.v1 = len(nt) == 24
+		m.domain = str(28, unicode)
+		m.user = str(36, unicode)
+		m.workstation = str(44, unicode)
+	}
+	if m.flags&ntlmFlagVersion != 0 && len(msg) >= versionAt+8 {
+		v := msg[versionAt:]
+		m.version = fmt.Sprintf("%d.%d.%d", v[0], v[1], binary.LittleEndian.Uint16(v[2:]))
+	}
+	return m, err
+}
+
+// ntlmField returns the payload a length, maximum length and offset field
+// at msg[at:] points to.
+func ntlmField(msg []byte, at int) ([]byte, error) {
+	if len(msg) < at+8 {
+		return nil, errors.New("truncated NTLM message")
+	}
+	length := int(binary.LittleEndian.Uint16(msg[at:]))
+	offset := int(binary.LittleEndian.Uint32(msg[at+4:]))
+	if length == 0 {
+		return nil, nil
+	}
+	if offset > len(msg) || length > len(msg)-offset {
+		return nil, errors.New("NTLM message field out of bounds")
+	}
+	return msg[offset : offset+length], nil
+}
+
+func ntlmString(b []byte, unicode bool) string {
+	if !unicode {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// ntlmAVNames are the AV_PAIR IDs of the target info of a challenge.
+var ntlmAVNames = map[uint16]string{
+	1:  "NbComputerName",
+	2:  "NbDomainName",
+	3:  "DnsComputerName",
+	4:  "DnsDomainName",
+	5:  "DnsTreeName",
+	6:  "Flags",
+	7:  "Timestamp",
+	8:  "SingleHost",
+	9:  "TargetName",
+	10: "ChannelBindings",
+}
+
+// ntlmTargetInfo lists the AV_PAIRs of info, with the values of the names.
+func ntlmTargetInfo(info []byte) []string {
+	var pairs []string
+	for len(info) >= 4 {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == 0 || len(info) < 4+length {
+			break
+		}
+		value := info[4 : 4+length]
+		info = info[4+length:]
+		name, ok := ntlmAVNames[id]
+		switch {
+		case !ok:
+			pairs = append(pairs, fmt.Sprintf("AV%d", id))
+		case id <= 5 || id == 9:
+			pairs = append(pairs, fmt.Sprintf("%s=%s", name, ntlmString(value, true)))
+		default:
+			pairs = append(pairs, name)
+		}
+	}
+	return pairs
+}
+
+const (
+	ntlmFlagUnicode             = 1 << 0
+	ntlmFlagLMKey               = 1 << 7
+	ntlmFlagDomainSupplied      = 1 << 12
+	ntlmFlagWorkstationSupplied = 1 << 13
+	ntlmFlagVersion             = 1 << 25
+)
+
+// ntlmFlagBits names the NEGOTIATE flags of MS-NLMP section 2.2.2.5.
+var ntlmFlagBits = []struct {
+	bit  uint32
+	name string
+}{
+	{1 << 0, "UNICODE"},
+	{1 << 1, "OEM"},
+	{1 << 2, "REQUEST_TARGET"},
+	{1 << 4, "SIGN"},
+	{1 << 5, "SEAL"},
+	{1 << 6, "DATAGRAM"},
+	{1 << 7, "LM_KEY"},
+	{1 << 9, "NTLM"},
+	{1 << 11, "ANONYMOUS"},
+	{1 << 12, "OEM_DOMAIN_SUPPLIED"},
+	{1 << 13, "OEM_WORKSTATION_SUPPLIED"},
+	{1 << 15, "ALWAYS_SIGN"},
+	{1 << 16, "TARGET_TYPE_DOMAIN"},
+	{1 << 17, "TARGET_TYPE_SERVER"},
+	{1 << 19, "EXTENDED_SESSIONSECURITY"},
+	{1 << 20, "IDENTIFY"},
+	{1 << 22, "REQUEST_NON_NT_SESSION_KEY"},
+	{1 << 23, "TARGET_INFO"},
+	{1 << 25, "VERSION"},
+	{1 << 29, "128"},
+	{1 << 30, "KEY_EXCH"},
+	{1 << 31, "56"},
+}
+
+func ntlmFlagNames(flags uint32) string {
+	var names []string
+	for _, f := range ntlmFlagBits {
+		if flags&f.bit != 0 {
+			names = append(names, f.name)
+			flags &^= f.bit
+		}
+	}
+	if flags != 0 {
+		names = append(names, fmt.Sprintf("0x%x", flags))
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// ntlmTestChallenge builds a challenge message for target with the DNS
+// domain name in its target info.
+func ntlmTestChallenge(target, dnsDomain string) []byte {
+	utf16le := func(s string) []byte {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = binary.LittleEndian.AppendUint16(b, u)
+		}
+		return b
+	}
+	name := utf16le(target)
+	info := binary.LittleEndian.AppendUint16(nil, 4)
+	info = binary.LittleEndian.AppendUint16(info, uint16(len(utf16le(dnsDomain))))
+	info = append(info, utf16le(dnsDomain)...)
+	info = append(info, 0, 0, 0, 0)
+
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmChallenge)
+	binary.LittleEndian.PutUint16(msg[12:], uint16(len(name)))
+	binary.LittleEndian.PutUint16(msg[14:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(msg[16:], 48)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmFlagUnicode|1<<9|1<<19|1<<23)
+	copy(msg[24:], "\x01\x02\x03\x04\x05\x06\x07\x08")
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(info)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(info)))
+	binary.LittleEndian.PutUint32(msg[44:], uint32(48+len(name)))
+	msg = append(msg, name...)
+	return append(msg, info...)
+}
+
+// ntlmTestV1Authenticate builds an authenticate message with a 24 byte
+// NTLMv1 response.
+func ntlmTestV1Authenticate() []byte {
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmAuthenticate)
+	binary.LittleEndian.PutUint16(msg[20:], 24)
+	binary.LittleEndian.PutUint16(msg[22:], 24)
+	binary.LittleEndian.PutUint32(msg[24:], 64)
+	binary.LittleEndian.PutUint16(msg[36:], 5)
+	binary.LittleEndian.PutUint16(msg[38:], 5)
+	binary.LittleEndian.PutUint32(msg[40:], 88)
+	msg = append(msg, make([]byte, 24)...)
+	return append(msg, "alice"...)
+}
+
+func TestParseNTLM(t *testing.T) {
+	negotiate, err := ntlmssp.NewNegotiateMessage("CORP", "WS1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := ntlmTestChallenge("CORP", "corp.example")
+	authenticate, err := ntlmssp.NewAuthenticateMessage(challenge, `CORP\alice`, "s3cret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		msg      []byte
+		expected []string
+		v1       bool
+	}{
+		{"negotiate", negotiate, []string{`negotiate, domain "CORP", workstation "WS1"`, "OEM_DOMAIN_SUPPLIED"}, false},
+		{"challenge", challenge, []string{`challenge, target "CORP"`, "DnsDomainName=corp.example", "EXTENDED_SESSIONSECURITY"}, false},
+		{"authenticate", authenticate, []string{`authenticate with NTLMv2, user "alice", domain "CORP"`}, false},
+		{"v1 authenticate", ntlmTestV1Authenticate(), []string{`authenticate with NTLMv1, user "alice"`}, true},
+	}
+	for _, tt := range tests {
+		m, err := parseNTLM(tt.msg)
+		if err != nil {
+			t.Errorf("%s: parseNTLM: %v", tt.name, err)
+			continue
+		}
+		got := m.String()
+		for _, s := range tt.expected {
+			if !strings.Contains(got, s) {
+				t.Errorf("%s: %q does not contain %q", tt.name, got, s)
+			}
+		}
+		if m.v1 != tt.v1 {
+			t.Errorf("%s: v1 = %v; expected %v", tt.name, m.v1, tt.v1)
+		}
+		if strings.Contains(got, "s3cret") {
+			t.Errorf("%s: %q leaks the password", tt.name, got)
+		}
+	}
+
+	if _, err := parseNTLM(challenge[:30]); err == nil {
+		t.Error("parseNTLM accepted a truncated challenge")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNTLMv2Only(t *testing.T) {
+	sent := 0
+	inspector := ntlmInspector{RoundTripper: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent++
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+	}), v2Only: true}
+
+	challenge := ntlmTestChallenge("CORP", "corp.example")
+	v2, err := ntlmssp.NewAuthenticateMessage(challenge, `CORP\alice`, "s3cret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		header string
+		msg    []byte
+		sent   int
+		err    error
+	}{
+		{"v2 to destination", "Authorization", v2, 1, nil},
+		{"v1 to destination", "Authorization", ntlmTestV1Authenticate(), 0, errNTLMv1},
+		{"v1 to upstream", "Proxy-Authorization", ntlmTestV1Authenticate(), 0, errNTLMv1},
+	}
+	for _, tt := range tests {
+		sent = 0
+		req, _ := http.NewRequest(http.MethodGet, "http://intranet.test/", nil)
+		req.Header.Set(tt.header, "NTLM "+base64.StdEncoding.EncodeToString(tt.msg))
+		_, err := inspector.RoundTrip(req)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: RoundTrip = %v; expected %v", tt.name, err, tt.err)
+		}
+		if sent != tt.sent {
+			t.Errorf("%s: request sent %d times; expected %d", tt.name, sent, tt.sent)
+		}
+	}
+}
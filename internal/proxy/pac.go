@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+const pacPath = "/proxy.pac"
+
+// isPACRequest reports whether req asks for the PAC file, i.e. is an
+// origin-form GET for /proxy.pac sent to the proxy itself rather than a
+// proxied request.
+func isPACRequest(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		req.URL.Host == "" && req.URL.Path == pacPath
+}
+
+func servePAC(w http.ResponseWriter, req *http.Request, cfg config.Config) {
+	proxyAddr := req.Host
+	if proxyAddr == "" {
+		proxyAddr = cfg.ProxyAddr()
+	}
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = fmt.Fprint(w, GeneratePAC(proxyAddr, cfg))
+}
+
+// GeneratePAC returns a proxy auto-config script that sends traffic to the
+// proxy at proxyAddr, except for destinations matching cfg.ProxyExceptions,
+// which go DIRECT just like the proxy itself would route them.
+func GeneratePAC(proxyAddr string, cfg config.Config) string {
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	for _, pattern := range cfg.ProxyExceptions {
+		if cond := pacCondition(pattern); cond != "" {
+			fmt.Fprintf(&b, "  if (%s) return \"DIRECT\";\n", cond)
+		}
+	}
+	result := "PROXY " + proxyAddr
+	if cfg.FailOpen {
+		result += "; DIRECT"
+	}
+	fmt.Fprintf(&b, "  return %s;\n}\n", jsString(result))
+	return b.String()
+}
+
+// pacCondition translates an exception pattern into a PAC expression.
+// Patterns with a port have to be matched against the URL, since PAC only
+// passes the bare host name. IPv6 ranges are left out, as PAC has no portable
+// way to match them.
+func pacCondition(pattern string) string {
+	pattern = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(pattern, "/")))
+	if pattern == "" {
+		return ""
+	}
+	if pattern == config.LocalPattern {
+		return "isPlainHostName(host)"
+	}
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		if network.IP.To4() == nil {
+			return ""
+		}
+		mask := net.IP(network.Mask).String()
+		return fmt.Sprintf("isInNet(dnsResolve(host), %s, %s)", jsString(network.IP.String()), jsString(mask))
+	}
+	if host, port, err := net.SplitHostPort(pattern); err == nil {
+		host = config.CanonicalHost(host)
+		if strings.Contains(host, ":") {
+			return fmt.Sprintf("shExpMatch(url, %s)", jsString("*://["+host+"]:"+port+"/*"))
+		}
+		if host = strings.TrimPrefix(host, "."); strings.Contains(host, "*") || net.ParseIP(host) != nil {
+			return fmt.Sprintf("shExpMatch(url, %s)", jsString("*://"+host+":"+port+"/*"))
+		}
+		return fmt.Sprintf("shExpMatch(url, %s) || shExpMatch(url, %s)", jsString("*://"+host+":"+port+"/*"), jsString("*://*."+host+":"+port+"/*"))
+	}
+	host := config.CanonicalHost(strings.TrimSuffix(strings.TrimPrefix(pattern, "["), "]"))
+	if strings.Contains(host, "*") {
+		return fmt.Sprintf("shExpMatch(host, %s)", jsString(host))
+	}
+	if net.ParseIP(host) != nil {
+		return fmt.Sprintf("host == %s", jsString(host))
+	}
+	// Names match their subdomains too, as in curl's NO_PROXY.
+	host = strings.TrimPrefix(host, ".")
+	return fmt.Sprintf("host == %s || dnsDomainIs(host, %s)", jsString(host), jsString("."+host))
+}
+
+func jsString(s string) string {
+	out, _ := json.Marshal(s)
+	return string(out)
+}
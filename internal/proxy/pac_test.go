@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestGeneratePAC(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"localhost", "*.Example.com", ".corp.example", "internal.local:8443", "[::1]", "10.0.0.0/8", "fd00::/8", "<local>"}
+
+	expected := `function FindProxyForURL(url, host) {
+  if (host == "localhost" || dnsDomainIs(host, ".localhost")) return "DIRECT";
+  if (shExpMatch(host, "*.example.com")) return "DIRECT";
+  if (host == "corp.example" || dnsDomainIs(host, ".corp.example")) return "DIRECT";
+  if (shExpMatch(url, "*://internal.local:8443/*") || shExpMatch(url, "*://*.internal.local:8443/*")) return "DIRECT";
+  if (host == "::1") return "DIRECT";
+  if (isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0")) return "DIRECT";
+  if (isPlainHostName(host)) return "DIRECT";
+  return "PROXY 127.0.0.1:8080";
+}
+`
+	if got := GeneratePAC("127.0.0.1:8080", cfg); got != expected {
+		t.Fatalf("GeneratePAC =\n%s\nexpected\n%s", got, expected)
+	}
+
+	cfg.ProxyExceptions = nil
+	cfg.FailOpen = true
+	expected = "function FindProxyForURL(url, host) {\n  return \"PROXY 127.0.0.1:8080; DIRECT\";\n}\n"
+	if got := GeneratePAC("127.0.0.1:8080", cfg); got != expected {
+		t.Fatalf("GeneratePAC with fail-open =\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestServerServesPAC(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"localhost"}
+	srv := httptest.NewServer(NewServer(cfg))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/proxy.pac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ns-proxy-autoconfig" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	expected := GeneratePAC(srv.Listener.Addr().String(), cfg)
+	if string(body) != expected {
+		t.Fatalf("PAC body =\n%s\nexpected\n%s", body, expected)
+	}
+}
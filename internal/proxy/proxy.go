@@ -2,15 +2,22 @@ package proxy
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/netip"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cavoq/DynamicProxy/internal/config"
@@ -24,87 +31,281 @@ var (
 	Error = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix)
 )
 
+const (
+	routeDirect   = "direct"
+	routeUpstream = "upstream"
+	routeFailOpen = "direct (fail-open)"
+	routeReplay   = "replay"
+)
+
 type requestTransports struct {
-	direct   http.RoundTripper
-	upstream http.RoundTripper
+	direct    http.RoundTripper
+	upstreams []upstreamTransport
+	breakers  *breakerSet
+	health    *healthChecker
+	demotions *demotions
+	mirror    *mirror
+	canary    *upstreamTransport
+	affinity  *affinity
+	tunnels   *tunnelPool
+	threats   *threatFeeds
+	audit     *authAudit
+	pac       *upstreamPAC
+	decisions *decisionCounts
+	// pacUpstreams are the transports to the proxies UPSTREAM_PAC named
+	// that are not configured upstreams.
+	pacUpstreams *sync.Map
+	// pacRouted, pacDirect and pacFailOpen are set by withPAC.
+	pacRouted, pacDirect, pacFailOpen bool
+	// appRoute is the APP_ROUTES route of app, the application sending the
+	// request, if any.
+	appRoute, app string
+}
+
+type upstreamTransport struct {
+	addr      string
+	transport http.RoundTripper
+}
+
+func newRequestTransports(cfg config.Config, upstreams []string, breakers *breakerSet, health *healthChecker) requestTransports {
+	transports := requestTransports{direct: NewDirectTransport(cfg), breakers: breakers, health: health, mirror: newMirror(cfg), pacUpstreams: &sync.Map{}}
+	for _, addr := range orUpstreamProxy(cfg, upstreams) {
+		transports.upstreams = append(transports.upstreams, upstreamTransport{addr: addr, transport: newUpstreamTransport(cfg, addr)})
+	}
+	if cfg.CanaryUpstream != "" && cfg.CanaryPercent > 0 {
+		transports.canary = &upstreamTransport{addr: cfg.CanaryUpstream, transport: newUpstreamTransport(cfg, cfg.CanaryUpstream)}
+	}
+	return transports
+}
+
+// upstreamAddrs discovers the upstreams in order of preference.
+func upstreamAddrs(cfg config.Config) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TransportDialTimeout)
+	defer cancel()
+	return orUpstreamProxy(cfg, DiscoverUpstreams(ctx, cfg))
+}
+
+// orUpstreamProxy returns upstreams, or if there are none the (empty)
+// UPSTREAM_PROXY value as is, so requests fail the same way they always have.
+func orUpstreamProxy(cfg config.Config, upstreams []string) []string {
+	if len(upstreams) > 0 {
+		return upstreams
+	}
+	return []string{cfg.UpstreamProxy}
 }
 
 func Start(cfg config.Config) error {
 	Info.Printf("Starting proxy on %s (upstream=%s, auth=%s, exceptions=%v)",
 		cfg.ListenAddr, cfg.UpstreamProxy, cfg.ProxyAuth, cfg.ProxyExceptions)
-	transports := requestTransports{
-		direct:   NewDirectTransport(cfg),
-		upstream: NewUpstreamTransport(cfg),
-	}
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRequestWithTransports(w, r, cfg, transports)
-	})
-	server := &http.Server{
-		Addr:              cfg.ListenAddr,
-		Handler:           handler,
-		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
-		ReadTimeout:       cfg.ServerReadTimeout,
-		WriteTimeout:      cfg.ServerWriteTimeout,
-		IdleTimeout:       cfg.ServerIdleTimeout,
-		MaxHeaderBytes:    cfg.ServerMaxHeaderBytes,
-	}
-	return server.ListenAndServe()
+	return NewServer(cfg).ListenAndServe()
 }
 
 func HandleRequest(w http.ResponseWriter, req *http.Request, cfg config.Config) {
-	transports := requestTransports{
-		direct:   NewDirectTransport(cfg),
-		upstream: NewUpstreamTransport(cfg),
-	}
-	handleRequestWithTransports(w, req, cfg, transports)
+	req.Host = config.CanonicalHost(req.Host)
+	handleRequestWithTransports(w, req, cfg, newRequestTransports(cfg, upstreamAddrs(cfg), newBreakerSet(), nil))
 }
 
 func handleRequestWithTransports(w http.ResponseWriter, req *http.Request, cfg config.Config, transports requestTransports) {
-	Info.Printf("Processing request %s %s", req.Method, req.Host)
+	if requestLogs.sample() {
+		Info.Printf("Processing request %s %s", req.Method, req.Host)
+	}
+	if seenBefore(req) {
+		writeLoopDetected(w, req, "request already passed through this proxy (Via "+viaToken+")")
+		return
+	}
+	req, ok := injectFaults(w, req, cfg)
+	if !ok {
+		return
+	}
+	if cfg.ReplayDir != "" {
+		replay(w, req, cfg)
+		return
+	}
+	if transports, ok = transports.withApp(w, req, cfg); !ok {
+		return
+	}
+	transports = transports.withPAC(req, cfg).withCanary(req, cfg).withUpstreamExceptions(req, cfg)
+	if req.Method == http.MethodConnect {
+		if err := validConnectTarget(req.Host); err != nil {
+			Warn.Printf("Rejecting CONNECT %s: %v", req.Host, err)
+			trackedConnFrom(req).setError(err)
+			w.Header().Set(ErrorHeader, "bad-target")
+			http.Error(w, "Bad CONNECT target: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if req.Host == "" {
+		// An HTTP/1.0 client sent an origin-form request line without a
+		// Host header; HTTP/1.1 requires one.
+		Warn.Printf("Rejecting %s %s: no destination host", req.Method, req.URL)
+		trackedConnFrom(req).setError(errors.New("no destination host"))
+		w.Header().Set(ErrorHeader, "bad-target")
+		http.Error(w, "Bad request: no destination host in the request line or Host header", http.StatusBadRequest)
+		return
+	}
+	if threatBlocked(w, req, cfg, transports.threats, transports.decisions) {
+		return
+	}
+	if len(cfg.GeoIPDB) > 0 {
+		geo, _ := locate(req.Host, cfg)
+		trackedConnFrom(req).setGeo(geo)
+		if geoBlocked(w, req, geo, cfg, transports.decisions) {
+			return
+		}
+	}
+	route, rule := transports.route(req.Host, cfg)
+	transports.decisions.decide(w, route, rule, cfg)
 	if req.Method == http.MethodConnect {
-		HandleHttps(w, req, cfg)
+		establishTunnel(w, req, cfg, route != routeDirect, transports)
 	} else {
 		handleHttpWithTransports(w, req, cfg, transports)
 	}
 }
 
+// validConnectTarget checks that a CONNECT target is host:port with a usable
+// port, and that IPv6 literals are bracketed so the port is unambiguous.
+func validConnectTarget(target string) error {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	if host == "" {
+		return errors.New("missing host")
+	}
+	if strings.Contains(host, ":") {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return fmt.Errorf("invalid IPv6 address %q", host)
+		}
+	}
+	return nil
+}
+
 func HandleHttps(w http.ResponseWriter, req *http.Request, cfg config.Config) {
-	useUpstream := !Bypass(req.Host, cfg.ProxyExceptions)
+	useUpstream := !Decide(req.Host, cfg).Direct()
 	EstablishTunnel(w, req, cfg, useUpstream)
 }
 
 func HandleHttp(w http.ResponseWriter, req *http.Request, cfg config.Config) {
-	transports := requestTransports{
-		direct:   NewDirectTransport(cfg),
-		upstream: NewUpstreamTransport(cfg),
-	}
-	handleHttpWithTransports(w, req, cfg, transports)
+	handleHttpWithTransports(w, req, cfg, newRequestTransports(cfg, upstreamAddrs(cfg), newBreakerSet(), nil))
 }
 
 func handleHttpWithTransports(w http.ResponseWriter, req *http.Request, cfg config.Config, transports requestTransports) {
-	var transport http.RoundTripper
-	if Bypass(req.Host, cfg.ProxyExceptions) {
-		transport = transports.direct
-	} else {
-		transport = transports.upstream
+	conn := trackedConnFrom(req)
+	if cfg.RecordDir != "" {
+		if rec := startRecording(w, req, cfg); rec != nil {
+			w = rec
+			defer rec.finish()
+		}
+	}
+	transports.mirror.send(req, cfg)
+	req = streamBody(req)
+	if conn != nil {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { conn.setDestination(info.Conn.RemoteAddr().String()) },
+		}))
+	}
+	if transports.goesDirect(req.Host, cfg) {
+		conn.setRoute(routeDirect)
+		if sendsProxyProtocol(req.Host, cfg) {
+			tr := proxyProtocolTransport(req, cfg)
+			defer tr.CloseIdleConnections()
+			ProxyRequest(w, req, tr, cfg)
+			return
+		}
+		ProxyRequest(w, req, transports.direct, cfg)
+		return
+	}
+
+	if transports.pinnedDirect(req.Host, cfg) {
+		conn.setRoute(routeFailOpen)
+		resp, err := roundTrip(req, transports.direct, cfg)
+		writeResponse(w, req, resp, err, cfg)
+		return
+	}
+
+	conn.setRoute(routeUpstream)
+	resp, err := roundTripUpstream(req, transports, cfg)
+	if err != nil && transports.failsOpen(req.Host, cfg) && isUpstreamUnreachable(err) && bodyUnsent(req) {
+		Warn.Printf("Upstream unreachable for %s %s, failing open to direct connection: %v", req.Method, req.Host, logError(err))
+		conn.setRoute(routeFailOpen)
+		resp, err = roundTrip(req, transports.direct, cfg)
+		if err == nil {
+			transports.affinity.pin(req.Host, affinityDirect, cfg)
+		}
+	}
+	writeResponse(w, req, resp, err, cfg)
+}
+
+// roundTripUpstream sends req through the first upstream whose circuit allows
+// it, trying healthy upstreams first, and moves on to the next upstream when
+// one cannot be reached, unless part of the request body was already sent.
+func roundTripUpstream(req *http.Request, transports requestTransports, cfg config.Config) (*http.Response, error) {
+	err := transports.errNoUpstream()
+	for _, u := range transports.preferredFor(req.Host, cfg) {
+		b := transports.breakers.get(u.addr)
+		if !b.allow(cfg) {
+			continue
+		}
+		var resp *http.Response
+		resp, err = roundTrip(req, u.transport, cfg)
+		transports.demotions.record(u.addr, err != nil || resp.StatusCode >= http.StatusInternalServerError, cfg)
+		if err == nil || !isUpstreamUnreachable(err) {
+			b.success()
+			if err == nil {
+				trackedConnFrom(req).setUpstream(u.addr)
+				transports.affinity.pin(req.Host, u.addr, cfg)
+				transports.audit.upstreamAuth(req, u.addr, resp.StatusCode, cfg)
+			}
+			return resp, err
+		}
+		b.failure(cfg)
+		if !bodyUnsent(req) {
+			return nil, err
+		}
+		Warn.Printf("Upstream %s unreachable for %s %s: %v", u.addr, req.Method, req.Host, logError(err))
 	}
-	ProxyRequest(w, req, transport, cfg)
+	return nil, err
 }
 
 func ProxyRequest(w http.ResponseWriter, req *http.Request, transport http.RoundTripper, cfg config.Config) {
+	resp, err := roundTrip(req, transport, cfg)
+	writeResponse(w, req, resp, err, cfg)
+}
+
+func roundTrip(req *http.Request, transport http.RoundTripper, cfg config.Config) (*http.Response, error) {
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   cfg.ClientRequestTimeout,
 	}
-	outbound := CloneRequest(req)
-	resp, err := client.Do(outbound)
+	return roundTripWithRetry(req, client, cfg)
+}
+
+func writeResponse(w http.ResponseWriter, req *http.Request, resp *http.Response, err error, cfg config.Config) {
 	if err != nil {
-		Error.Printf("ProxyRequest error for %s %s: %v", req.Method, req.Host, err)
-		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		Error.Printf("ProxyRequest error for %s %s: %v", req.Method, req.Host, logError(err))
+		trackedConnFrom(req).setError(err)
+		writeProxyError(w, err)
 		return
 	}
+	trackedConnFrom(req).setupDone()
 	defer resp.Body.Close()
-	CopyResponse(w, resp)
+	resp.Body = shapeBody(req, resp.Body)
+	CopyResponse(w, resp, cfg.CopyBufferSize)
+}
+
+// isUpstreamUnreachable reports whether err means no connection to the
+// upstream proxy could be established, as opposed to a failure further along.
+func isUpstreamUnreachable(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, errCircuitOpen) || (errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect"))
+}
+
+// canFailOpen reports whether host may fall back to a direct connection.
+// Hosts matching REMOTE_DNS never do, as that would resolve them locally.
+func canFailOpen(host string, cfg config.Config) bool {
+	return cfg.FailOpen && !resolvesRemotely(host, cfg)
 }
 
 func Bypass(host string, exceptions []string) bool {
@@ -112,27 +313,54 @@ func Bypass(host string, exceptions []string) bool {
 }
 
 func NewDirectTransport(cfg config.Config) http.RoundTripper {
-	return newTransport(cfg, nil)
+	return withNTLMInspector(newTransport(cfg, nil), cfg)
 }
 
+// NewUpstreamTransport returns a transport through the first configured upstream.
 func NewUpstreamTransport(cfg config.Config) http.RoundTripper {
-	proxyURL, err := url.Parse("http://" + cfg.UpstreamProxy)
-	if err != nil {
-		Error.Printf("Invalid upstream proxy url %q: %v", cfg.UpstreamProxy, err)
-		return NewDirectTransport(cfg)
+	return newUpstreamTransport(cfg, upstreamAddrs(cfg)[0])
+}
+
+func newUpstreamTransport(cfg config.Config, addr string) http.RoundTripper {
+	var base *http.Transport
+	hostport, useTLS := splitUpstream(addr)
+	if s, ok := parseSOCKSUpstream(addr); ok {
+		// Requests are sent as to the destination, over a SOCKS
+		// connection to it.
+		base = newTransport(cfg, nil)
+		base.DialContext = func(ctx context.Context, _, target string) (net.Conn, error) {
+			return s.dial(ctx, target, cfg)
+		}
+	} else {
+		proxyURL, err := url.Parse("http://" + hostport)
+		if err != nil {
+			Error.Printf("Invalid upstream proxy url %q: %v", addr, err)
+			return NewDirectTransport(cfg)
+		}
+		base = newTransport(cfg, proxyURL)
+		base.RegisterProtocol("ftp", ftpViaUpstream{addr: addr, cfg: cfg})
+	}
+	if useTLS {
+		// Plain HTTP to the proxy, over the TLS connection to it.
+		base.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialUpstreamConn(ctx, addr, cfg)
+		}
 	}
-	base := newTransport(cfg, proxyURL)
 	if strings.EqualFold(cfg.ProxyAuth, "ntlm") {
 		base.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{} // Disable HTTP/2 for NTLM
-		return ntlmssp.Negotiator{RoundTripper: base}
+		cache := newAuthCache(cfg.AuthCacheTTL)
+		return cache.credentials(ntlmssp.Negotiator{
+			RoundTripper:   cache.challenges(withAuthSchemes(withNTLMInspector(base, cfg), cfg.ProxyAuthSchemes)),
+			AllowBasicAuth: slices.Contains(cfg.ProxyAuthSchemes, "basic"),
+		})
 	}
-	return base
+	return withNTLMInspector(base, cfg)
 }
 
 func newTransport(cfg config.Config, proxyURL *url.URL) *http.Transport {
-	dialer := &net.Dialer{
-		Timeout:   cfg.TransportDialTimeout,
-		KeepAlive: cfg.TransportKeepAlive,
+	dialer := newDirectDialer(cfg)
+	if proxyURL != nil {
+		dialer = newUpstreamDialer(cfg, proxyURL.Host)
 	}
 	tr := &http.Transport{
 		DialContext:           dialer.DialContext,
@@ -145,22 +373,53 @@ func newTransport(cfg config.Config, proxyURL *url.URL) *http.Transport {
 	}
 	if proxyURL != nil {
 		tr.Proxy = http.ProxyURL(proxyURL)
+	} else {
+		// Over the transport's own connections, which SOCKS upstreams
+		// replace.
+		tr.RegisterProtocol("ftp", ftpTransport{dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return tr.DialContext(ctx, network, addr)
+		}})
 	}
 	return tr
 }
 
 func EstablishTunnel(w http.ResponseWriter, req *http.Request, cfg config.Config, useUpstream bool) {
+	establishTunnel(w, req, cfg, useUpstream, newRequestTransports(cfg, upstreamAddrs(cfg), newBreakerSet(), nil))
+}
+
+func establishTunnel(w http.ResponseWriter, req *http.Request, cfg config.Config, useUpstream bool, transports requestTransports) {
 	var backend net.Conn
 	var err error
 
-	if useUpstream {
-		backend, err = DialViaUpstream(cfg.UpstreamProxy, req.Host, cfg)
-	} else {
-		backend, err = net.DialTimeout("tcp", req.Host, cfg.TransportDialTimeout)
+	conn := trackedConnFrom(req)
+	switch {
+	case useUpstream && transports.pinnedDirect(req.Host, cfg):
+		conn.setRoute(routeFailOpen)
+		backend, err = newDirectDialer(cfg).dial(req.Host)
+	case useUpstream:
+		conn.setRoute(routeUpstream)
+		backend, err = dialUpstream(req, cfg, transports)
+		if err != nil && transports.failsOpen(req.Host, cfg) && isUpstreamUnreachable(err) {
+			Warn.Printf("Upstream unreachable for CONNECT %s, failing open to direct connection: %v", req.Host, err)
+			conn.setRoute(routeFailOpen)
+			backend, err = newDirectDialer(cfg).dial(req.Host)
+			if err == nil {
+				transports.affinity.pin(req.Host, affinityDirect, cfg)
+			}
+		}
+	default:
+		conn.setRoute(routeDirect)
+		backend, err = newDirectDialer(cfg).dial(req.Host)
+		if err == nil && sendsProxyProtocol(req.Host, cfg) {
+			if err = writeProxyHeader(backend, req.RemoteAddr, cfg); err != nil {
+				backend.Close()
+			}
+		}
 	}
 	if err != nil {
 		Error.Printf("Tunnel connection failed to %s: %v", req.Host, err)
-		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		conn.setError(err)
+		writeProxyError(w, err)
 		return
 	}
 
@@ -172,29 +431,97 @@ func EstablishTunnel(w http.ResponseWriter, req *http.Request, cfg config.Config
 		return
 	}
 
-	clientConn, _, err := hj.Hijack()
+	clientConn, rw, err := hj.Hijack()
 	if err != nil {
 		backend.Close()
 		Error.Printf("Hijack failed for %s: %v", req.Host, err)
+		conn.setError(err)
 		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		return
 	}
 
-	_, _ = fmt.Fprint(clientConn, "HTTP/1.1 200 Connection Established\r\n\r\n")
-	Pipe(clientConn, backend)
+	clientConn = withBuffered(clientConn, rw.Reader)
+	tuneTunnelConn(clientConn, cfg)
+	tuneTunnelConn(backend, cfg)
+	established := "HTTP/1.1 200 Connection Established\r\n"
+	if decision := w.Header().Get(DecisionHeader); decision != "" {
+		established += DecisionHeader + ": " + decision + "\r\n"
+	}
+	_, _ = fmt.Fprint(clientConn, established+"\r\n")
+	conn.setupDone()
+	conn.setStatus(http.StatusOK)
+	conn.setDestination(backend.RemoteAddr().String())
+	conn.attach(clientConn, backend)
+	clientConn, backend = withIdleTimeout(clientConn, backend, cfg)
+	Pipe(shapeConn(req, conn.sniffSNI(conn.countSent(clientConn))), shapeConn(req, conn.countReceived(backend)), cfg.TunnelHalfCloseTimeout, cfg.TunnelBufferSize)
+}
+
+// dialUpstream opens a CONNECT tunnel to req's target in the same upstream
+// order as roundTripUpstream.
+func dialUpstream(req *http.Request, cfg config.Config, transports requestTransports) (net.Conn, error) {
+	target := req.Host
+	err := transports.errNoUpstream()
+	for _, u := range transports.preferredFor(target, cfg) {
+		addr := u.addr
+		b := transports.breakers.get(addr)
+		if !b.allow(cfg) {
+			continue
+		}
+		conn := transports.tunnels.take(addr, target)
+		if conn == nil {
+			conn, err = DialViaUpstream(addr, target, cfg)
+		}
+		if errors.Is(err, errUpstreamAuth) {
+			transports.audit.upstreamAuth(req, addr, http.StatusProxyAuthRequired, cfg)
+		}
+		// A refused CONNECT is the upstream's answer, not its failure.
+		transports.demotions.record(addr, conn == nil && !errors.Is(err, errUpstreamRejected), cfg)
+		if conn != nil || !isUpstreamUnreachable(err) {
+			b.success()
+			if conn != nil {
+				trackedConnFrom(req).setUpstream(addr)
+				transports.affinity.pin(target, addr, cfg)
+				transports.tunnels.used(addr, target, cfg)
+				return conn, nil
+			}
+			return nil, err
+		}
+		b.failure(cfg)
+		Warn.Printf("Upstream %s unreachable for CONNECT %s: %v", addr, target, err)
+	}
+	return nil, err
 }
 
 func DialViaUpstream(proxyAddr, target string, cfg config.Config) (net.Conn, error) {
-	conn, err := net.DialTimeout("tcp", proxyAddr, cfg.TransportDialTimeout)
+	if s, ok := parseSOCKSUpstream(proxyAddr); ok {
+		return s.dial(context.Background(), target, cfg)
+	}
+	if _, useTLS := splitUpstream(proxyAddr); useTLS && cfg.UpstreamHTTP2 {
+		cc, conn, err := upstreamH2.get(context.Background(), proxyAddr, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("upstream dial failed: %w", err)
+		}
+		if cc != nil {
+			return connectH2(cc, target, cfg)
+		}
+		return connectVia(conn, target, cfg)
+	}
+	conn, err := dialUpstreamConn(context.Background(), proxyAddr, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("upstream dial failed: %w", err)
 	}
+	return connectVia(conn, target, cfg)
+}
+
+// connectVia sends a CONNECT for target over conn, the connection to an
+// upstream proxy, and returns conn as the tunnel once it is established.
+func connectVia(conn net.Conn, target string, cfg config.Config) (net.Conn, error) {
 	if err := conn.SetDeadline(time.Now().Add(cfg.TunnelConnectReadWriteTimeout)); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to set upstream CONNECT deadline: %w", err)
 	}
 
-	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\nVia: %s\r\n\r\n", target, target, viaValue(1, 1))
 	if _, err := conn.Write([]byte(connectReq)); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to send CONNECT: %w", err)
@@ -207,54 +534,114 @@ func DialViaUpstream(proxyAddr, target string, cfg config.Config) (net.Conn, err
 		return nil, fmt.Errorf("bad CONNECT response: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", errUpstreamRejected, errUpstreamAuth)
+	}
 	if resp.StatusCode != http.StatusOK {
 		conn.Close()
-		return nil, fmt.Errorf("upstream CONNECT failed: %s", resp.Status)
+		return nil, fmt.Errorf("%w: %s", errUpstreamRejected, resp.Status)
 	}
 	if err := conn.SetDeadline(time.Time{}); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to clear upstream CONNECT deadline: %w", err)
 	}
 
-	return conn, nil
+	// Keep whatever the destination sent right after the response.
+	return withBuffered(conn, br), nil
 }
 
+// CloneRequest returns the request to send for req, the request of a client.
+// The body is shared, not copied: a requestBody is streamed, and can be
+// requested again with GetBody while nothing of it was sent.
+//
+// req.Host is the destination: the Go server takes it from an absolute-form
+// request line in preference to the Host header, as RFC 7230 asks of
+// proxies. The hop-by-hop headers of the client's connection are not
+// forwarded, and the connection to the destination or upstream is kept
+// alive even for HTTP/1.0 clients or those that asked to close theirs.
 func CloneRequest(req *http.Request) *http.Request {
 	outbound := req.Clone(req.Context())
 	outbound.RequestURI = ""
+	outbound.Close = false
+	if b, ok := req.Body.(*requestBody); ok {
+		outbound.GetBody = b.getBody
+	}
 	if outbound.URL.Scheme == "" {
 		outbound.URL.Scheme = "http"
 	}
 	outbound.URL.Host = req.Host
+	removeHopHeaders(outbound.Header)
+	outbound.Header.Add("Via", viaValue(req.ProtoMajor, req.ProtoMinor))
 	return outbound
 }
 
-func CopyResponse(w http.ResponseWriter, resp *http.Response) {
+// CopyResponse writes resp to w, copying its body through a buffer of
+// bufferSize bytes, or io.Copy's default if it is 0. The hop-by-hop headers
+// of the connection resp came over are left out; the server picks those of
+// the client's connection.
+func CopyResponse(w http.ResponseWriter, resp *http.Response, bufferSize int) {
+	removeHopHeaders(resp.Header)
 	for k, vs := range resp.Header {
 		for _, v := range vs {
 			w.Header().Add(k, v)
 		}
 	}
 	w.WriteHeader(resp.StatusCode)
-	_, err := io.Copy(w, resp.Body)
+	_, err := copyBuffer(w, resp.Body, bufferSize)
 	if err != nil {
 		Error.Printf("Error copying response body: %v", err)
 	}
 }
 
-func Pipe(a, b net.Conn) {
-	go func() {
-		defer a.Close()
-		defer b.Close()
-		if _, err := io.Copy(a, b); err != nil {
-			Warn.Printf("Pipe error (a->b): %v", err)
+// Pipe copies data between a and b in both directions and returns once both
+// directions are done. When one side finishes sending, the write side of the
+// other is shut down and the opposite direction keeps running, so protocols
+// that half-close their connection see the rest of the answer; if it carries
+// no data for halfCloseTimeout, both connections are closed. They are also
+// closed on errors, if a half-close cannot be passed on, and when Pipe
+// returns. Each direction is copied through a buffer of bufferSize bytes, or
+// io.Copy's default if it is 0.
+func Pipe(a, b net.Conn, halfCloseTimeout time.Duration, bufferSize int) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	// linger is started once one direction is done and reset by data in the
+	// other.
+	var linger atomic.Pointer[time.Timer]
+	defer func() {
+		if t := linger.Load(); t != nil {
+			t.Stop()
 		}
 	}()
-	go func() {
-		defer a.Close()
-		defer b.Close()
-		if _, err := io.Copy(b, a); err != nil {
-			Warn.Printf("Pipe error (b->a): %v", err)
+	pipe := func(dst, src net.Conn, direction string) {
+		defer wg.Done()
+		closeBoth := true
+		defer func() {
+			if closeBoth {
+				a.Close()
+				b.Close()
+			}
+		}()
+		defer recoverPipe(a, b)
+		if _, err := copyBuffer(dst, &lingerReader{Reader: src, linger: &linger, timeout: halfCloseTimeout}, bufferSize); err != nil {
+			Warn.Printf("Pipe error (%s): %v", direction, err)
+			return
 		}
-	}()
+		if !closeWrite(dst) {
+			return
+		}
+		closeBoth = false
+		if halfCloseTimeout > 0 {
+			linger.CompareAndSwap(nil, time.AfterFunc(halfCloseTimeout, func() {
+				Info.Printf("Closing tunnel %s <-> %s: half-closed and idle for %s", logClient(a.RemoteAddr().String()), b.RemoteAddr(), halfCloseTimeout)
+				a.Close()
+				b.Close()
+			}))
+		}
+	}
+	go pipe(a, b, "a->b")
+	go pipe(b, a, "b->a")
+	wg.Wait()
+	a.Close()
+	b.Close()
 }
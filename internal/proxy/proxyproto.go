@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxyproto"
+)
+
+// sendsProxyProtocol reports whether direct connections to host start with
+// a PROXY protocol header carrying the client's address.
+func sendsProxyProtocol(host string, cfg config.Config) bool {
+	return len(cfg.ProxyProtocolTargets) > 0 && config.IsException(host, cfg.ProxyProtocolTargets)
+}
+
+// writeProxyHeader sends the PROXY protocol header for a connection from
+// client (host:port) to backend.
+func writeProxyHeader(backend net.Conn, client string, cfg config.Config) error {
+	var h proxyproto.Header
+	if addr, err := net.ResolveTCPAddr("tcp", client); err == nil && addr.IP != nil {
+		if dst, ok := backend.RemoteAddr().(*net.TCPAddr); ok {
+			h = proxyproto.Header{Source: addr, Destination: dst}
+		}
+	}
+	return proxyproto.WriteHeader(backend, h, cfg.ProxyProtocolVersion)
+}
+
+// proxyProtocolTransport returns a transport whose connections start with a
+// PROXY protocol header for req's client. They are not reused, since the
+// header only describes this client.
+func proxyProtocolTransport(req *http.Request, cfg config.Config) *http.Transport {
+	tr := newTransport(cfg, nil)
+	dial := tr.DialContext
+	tr.DisableKeepAlives = true
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeProxyHeader(conn, req.RemoteAddr, cfg); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	return tr
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxyproto"
+)
+
+// proxyProtocolBackend serves HTTP after a PROXY protocol header and reports
+// the client address of each header it reads.
+func proxyProtocolBackend(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	clients := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				h, err := proxyproto.ReadHeader(r)
+				if err != nil {
+					clients <- "error: " + err.Error()
+					return
+				}
+				clients <- h.Source.String()
+				if _, err := http.ReadRequest(r); err == nil {
+					io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), clients
+}
+
+func TestProxyProtocolToTargets(t *testing.T) {
+	backend, clients := proxyProtocolBackend(t)
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.ProxyProtocolTargets = []string{"127.0.0.1"}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+	resp, err := client.Get("http://" + backend + "/")
+	if err != nil {
+		t.Fatalf("GET through proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET status = %d; expected 200", resp.StatusCode)
+	}
+	if got := <-clients; !strings.HasPrefix(got, "127.0.0.1:") {
+		t.Fatalf("header source for GET = %q; expected the client's loopback address", got)
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", backend, backend)
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT failed: %v %v", resp, err)
+	}
+	if got, expected := <-clients, conn.LocalAddr().String(); got != expected {
+		t.Fatalf("header source for CONNECT = %q; expected %q", got, expected)
+	}
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// errRateLimit is returned for requests that would have had to wait longer
+// than DEST_RATE_LIMIT_WAIT for their turn under DEST_RATE_LIMITS.
+var errRateLimit = errors.New("destination rate limit reached")
+
+// rateLimiter spaces the requests to each destination host by the interval
+// of its DEST_RATE_LIMITS entry, so that many clients sharing the proxy do
+// not overwhelm a fragile API between them. Like connLimiter it outlives
+// configuration reloads.
+type rateLimiter struct {
+	mu sync.Mutex
+	// next is when each host may be sent its next request.
+	next map[string]time.Time
+	now  func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{next: make(map[string]time.Time), now: time.Now}
+}
+
+// destRate returns the interval between requests to host: that of the first
+// matching DEST_RATE_LIMITS entry, or 0 for unlimited.
+func destRate(host string, cfg config.Config) time.Duration {
+	for _, limit := range cfg.DestRateLimits {
+		if config.IsException(host, []string{limit.Pattern}) {
+			return limit.Interval
+		}
+	}
+	return 0
+}
+
+// reserve books the next turn of key and returns how long to wait for it,
+// or false without booking if that is longer than maxWait.
+func (l *rateLimiter) reserve(key string, interval, maxWait time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	turn := now
+	if next := l.next[key]; next.After(now) {
+		turn = next
+	}
+	wait := turn.Sub(now)
+	if wait > maxWait {
+		return wait, false
+	}
+	l.next[key] = turn.Add(interval)
+	if len(l.next) > 1024 {
+		for k, t := range l.next {
+			if t.Before(now) {
+				delete(l.next, k)
+			}
+		}
+	}
+	return wait, true
+}
+
+// limit delays req until its destination's turn under DEST_RATE_LIMITS. It
+// writes a 429 response and returns false if that turn is further away than
+// DEST_RATE_LIMIT_WAIT, or if the client went away while waiting.
+func (l *rateLimiter) limit(w http.ResponseWriter, req *http.Request, cfg config.Config) bool {
+	host, _, _ := net.SplitHostPort(targetAddr(req))
+	interval := destRate(host, cfg)
+	if interval <= 0 {
+		return true
+	}
+	wait, ok := l.reserve(host, interval, cfg.DestRateLimitWait)
+	if !ok {
+		Warn.Printf("Rejected %s %s from %s: rate limit of one request per %s reached", req.Method, req.Host, logClient(usageClient(req)), interval)
+		trackedConnFrom(req).setError(errRateLimit)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.Header().Set(ErrorHeader, "rate-limited")
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return false
+	}
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		trackedConnFrom(req).setError(req.Context().Err())
+		return false
+	}
+}
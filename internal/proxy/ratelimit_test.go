@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestDestRate(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DestRateLimits = []config.RateLimit{
+		{Pattern: "open.partner.example", Interval: 0},
+		{Pattern: "*.partner.example", Interval: time.Second},
+	}
+	tests := []struct {
+		host string
+		want time.Duration
+	}{
+		{"api.partner.example", time.Second},
+		{"open.partner.example", 0},
+		{"example.com", 0},
+	}
+	for _, tt := range tests {
+		if got := destRate(tt.host, cfg); got != tt.want {
+			t.Errorf("destRate(%s) = %s; expected %s", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+
+	steps := []struct {
+		key     string
+		advance time.Duration
+		wait    time.Duration
+		ok      bool
+	}{
+		{"a", 0, 0, true},
+		{"a", 0, time.Second, true},
+		{"a", 0, 2 * time.Second, true},
+		// Further than maxWait away: refused without taking a turn.
+		{"a", 0, 3 * time.Second, false},
+		{"b", 0, 0, true},
+		{"a", 2500 * time.Millisecond, 500 * time.Millisecond, true},
+		{"a", 10 * time.Second, 0, true},
+	}
+	for i, s := range steps {
+		now = now.Add(s.advance)
+		wait, ok := l.reserve(s.key, time.Second, 2*time.Second)
+		if wait != s.wait || ok != s.ok {
+			t.Errorf("step %d: reserve(%s) = %s, %v; expected %s, %v", i, s.key, wait, ok, s.wait, s.ok)
+		}
+	}
+}
+
+func TestServerRateLimitsDestination(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	cfg.DestRateLimits = []config.RateLimit{{Pattern: "127.0.0.1", Interval: 100 * time.Millisecond}}
+	cfg.DestRateLimitWait = time.Second
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+	proxyURL := &url.URL{Scheme: "http", Host: l.Addr().String()}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	get := func() *http.Response {
+		t.Helper()
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("GET %s: %v", backend.URL, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	start := time.Now()
+	for range 3 {
+		if resp := get(); resp.StatusCode != http.StatusOK {
+			t.Fatalf("queued request = %d; expected 200", resp.StatusCode)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("3 requests at 10 per second took %s; expected at least 200ms", elapsed)
+	}
+
+	cfg.DestRateLimits = []config.RateLimit{{Pattern: "127.0.0.1", Interval: time.Hour}}
+	cfg.DestRateLimitWait = 0
+	server.SetConfig(cfg)
+	time.Sleep(100 * time.Millisecond)
+	get()
+	resp := get()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get(ErrorHeader) != "rate-limited" || resp.Header.Get("Retry-After") != "3600" {
+		t.Errorf("request over the rate = %d %s=%q Retry-After=%q; expected 429 rate-limited after 3600s",
+			resp.StatusCode, ErrorHeader, resp.Header.Get(ErrorHeader), resp.Header.Get("Retry-After"))
+	}
+}
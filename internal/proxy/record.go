@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// recordingKey names the recording of req: a hash of its method and URL.
+// Requests differing only in headers or body share a recording.
+func recordingKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + requestURL(req)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func requestURL(req *http.Request) string {
+	scheme := req.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + req.Host + req.URL.RequestURI()
+}
+
+// recordingWriter passes a response through to the client and writes it to
+// RECORD_DIR, after the head of the request it answers. The recording is
+// only kept if the whole response reached the client; responses the proxy
+// generated itself, like errors reaching the destination, are not recorded.
+type recordingWriter struct {
+	http.ResponseWriter
+	req  *http.Request
+	file *os.File
+	path string
+
+	wroteHeader bool
+	skip        bool
+	err         error
+}
+
+// startRecording returns a writer recording the response to req, or nil if
+// the recording cannot be created.
+func startRecording(w http.ResponseWriter, req *http.Request, cfg config.Config) *recordingWriter {
+	if err := os.MkdirAll(cfg.RecordDir, 0o755); err != nil {
+		Warn.Printf("Not recording %s %s: %v", req.Method, req.Host, err)
+		return nil
+	}
+	file, err := os.CreateTemp(cfg.RecordDir, ".recording-*")
+	if err != nil {
+		Warn.Printf("Not recording %s %s: %v", req.Method, req.Host, err)
+		return nil
+	}
+	r := &recordingWriter{ResponseWriter: w, req: req, file: file, path: filepath.Join(cfg.RecordDir, recordingKey(req)+".http")}
+	_, r.err = fmt.Fprintf(file, "%s %s HTTP/1.1\r\n", req.Method, requestURL(req))
+	r.writeHeader(req.Header, "Content-Length", "Transfer-Encoding", "Proxy-Authorization")
+	return r
+}
+
+func (r *recordingWriter) writeHeader(h http.Header, exclude ...string) {
+	h = h.Clone()
+	for _, key := range exclude {
+		h.Del(key)
+	}
+	if r.err == nil {
+		r.err = h.Write(r.file)
+	}
+	if r.err == nil {
+		_, r.err = r.file.WriteString("\r\n")
+	}
+}
+
+func (r *recordingWriter) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.skip = r.Header().Get(ErrorHeader) != ""
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.file, "HTTP/1.1 %03d %s\r\n", status, http.StatusText(status))
+	}
+	r.writeHeader(r.Header())
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recordingWriter) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(p)
+	if err != nil {
+		r.err = err
+	}
+	if r.err == nil {
+		_, r.err = r.file.Write(p[:n])
+	}
+	return n, err
+}
+
+func (r *recordingWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish keeps the recording, replacing an earlier one of the same request,
+// or discards it.
+func (r *recordingWriter) finish() {
+	err := r.file.Close()
+	if r.err != nil || err != nil || !r.wroteHeader || r.skip || r.req.Context().Err() != nil {
+		os.Remove(r.file.Name())
+		return
+	}
+	if err := os.Rename(r.file.Name(), r.path); err != nil {
+		Warn.Printf("Failed to save recording of %s %s: %v", r.req.Method, r.req.Host, err)
+		os.Remove(r.file.Name())
+		return
+	}
+	Info.Printf("Recorded %s %s to %s", r.req.Method, requestURL(r.req), r.path)
+}
+
+// replay answers req from its recording in REPLAY_DIR without contacting the
+// network. Requests that were not recorded, and all CONNECT tunnels, fail
+// with 502 and ErrorHeader "not-recorded".
+func replay(w http.ResponseWriter, req *http.Request, cfg config.Config) {
+	conn := trackedConnFrom(req)
+	conn.setRoute(routeReplay)
+	if req.Method == http.MethodConnect {
+		writeNotRecorded(w, req, errors.New("tunnels cannot be replayed"))
+		return
+	}
+	path := filepath.Join(cfg.ReplayDir, recordingKey(req)+".http")
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = fmt.Errorf("no recording of %s %s", req.Method, requestURL(req))
+		}
+		writeNotRecorded(w, req, err)
+		return
+	}
+	defer file.Close()
+
+	br := bufio.NewReader(file)
+	if _, err := http.ReadRequest(br); err != nil {
+		writeNotRecorded(w, req, fmt.Errorf("bad recording %s: %w", path, err))
+		return
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		writeNotRecorded(w, req, fmt.Errorf("bad recording %s: %w", path, err))
+		return
+	}
+	defer resp.Body.Close()
+	CopyResponse(w, resp, cfg.CopyBufferSize)
+}
+
+func writeNotRecorded(w http.ResponseWriter, req *http.Request, err error) {
+	Warn.Printf("Replay of %s %s failed: %v", req.Method, req.Host, err)
+	trackedConnFrom(req).setError(err)
+	w.Header().Set(ErrorHeader, "not-recorded")
+	http.Error(w, "Not recorded: "+err.Error(), http.StatusBadGateway)
+}
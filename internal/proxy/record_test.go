@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Backend", "yes")
+		io.WriteString(w, "hello "+r.URL.RawQuery)
+	}))
+	dir := t.TempDir()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.RecordDir = dir
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+
+	get := func(target string) (*http.Response, string) {
+		t.Helper()
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(body)
+	}
+
+	get(backend.URL + "/greet?a=1")
+	get(backend.URL + "/missing")
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.http"))
+	if len(recordings) != 2 {
+		t.Fatalf("recordings = %v; expected 2", recordings)
+	}
+
+	// Replay with the backend gone.
+	backend.Close()
+	cfg.RecordDir = ""
+	cfg.ReplayDir = dir
+	server.SetConfig(cfg)
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+		reason string
+	}{
+		{backend.URL + "/greet?a=1", http.StatusOK, "hello a=1", ""},
+		{backend.URL + "/missing", http.StatusNotFound, "404 page not found\n", ""},
+		{backend.URL + "/greet?a=2", http.StatusBadGateway, "", "not-recorded"},
+	}
+	for _, tt := range tests {
+		resp, body := get(tt.target)
+		if resp.StatusCode != tt.status {
+			t.Errorf("replayed GET %s status = %d; expected %d", tt.target, resp.StatusCode, tt.status)
+		}
+		if tt.body != "" && body != tt.body {
+			t.Errorf("replayed GET %s body = %q; expected %q", tt.target, body, tt.body)
+		}
+		if got := resp.Header.Get(ErrorHeader); got != tt.reason {
+			t.Errorf("replayed GET %s %s = %q; expected %q", tt.target, ErrorHeader, got, tt.reason)
+		}
+	}
+	if resp, _ := get(backend.URL + "/greet?a=1"); resp.Header.Get("X-Backend") != "yes" {
+		t.Errorf("replayed response lost its headers: %v", resp.Header)
+	}
+}
+
+func TestRecordingSkipsProxyErrors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RecordDir = dir
+
+	req := httptest.NewRequest(http.MethodGet, "http://unreachable.test/", nil)
+	rec := startRecording(httptest.NewRecorder(), req, cfg)
+	if rec == nil {
+		t.Fatalf("startRecording failed")
+	}
+	rec.Header().Set(ErrorHeader, "dns-failure")
+	http.Error(rec, "Bad Gateway", http.StatusBadGateway)
+	rec.finish()
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Fatalf("directory after a proxy error = %v; expected it empty", entries)
+	}
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverRequest stops a panic while handling req from taking down the
+// process. It logs the stack trace and answers 500 if nothing was sent yet.
+// A response already under way is aborted so the client cannot mistake it
+// for a complete one, and a hijacked tunnel is closed. It must be deferred
+// directly.
+func recoverRequest(w *statusRecorder, req *http.Request) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if r == http.ErrAbortHandler {
+		panic(r)
+	}
+	Error.Printf("Panic handling %s %s from %s: %v\n%s", req.Method, req.Host, logClient(req.RemoteAddr), r, debug.Stack())
+	w.conn.setError(fmt.Errorf("panic: %v", r))
+	switch {
+	case w.hijacked:
+		w.conn.close()
+	case w.wroteHeader:
+		panic(http.ErrAbortHandler)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// recoverPipe stops a panic in one direction of a tunnel from taking down the
+// process. It must be deferred directly.
+func recoverPipe(a, b net.Conn) {
+	if r := recover(); r != nil {
+		Error.Printf("Panic in tunnel %s <-> %s: %v\n%s", logClient(a.RemoteAddr().String()), b.RemoteAddr(), r, debug.Stack())
+	}
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func panicWith(w *statusRecorder, req *http.Request, before func()) (rethrown any) {
+	defer func() { rethrown = recover() }()
+	defer recoverRequest(w, req)
+	before()
+	panic("boom")
+}
+
+func TestRecoverRequest(t *testing.T) {
+	conn, req := NewActivity().begin(httptest.NewRequest(http.MethodGet, "http://example.test/", nil))
+
+	rec := httptest.NewRecorder()
+	w := &statusRecorder{ResponseWriter: rec, conn: conn}
+	if rethrown := panicWith(w, req, func() {}); rethrown != nil {
+		t.Fatalf("panic escaped: %v", rethrown)
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d; expected %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	rec = httptest.NewRecorder()
+	w = &statusRecorder{ResponseWriter: rec, conn: conn}
+	rethrown := panicWith(w, req, func() {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("partial"))
+	})
+	if rethrown != http.ErrAbortHandler {
+		t.Fatalf("recovered %v after response started; expected http.ErrAbortHandler", rethrown)
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// roundTripWithRetry sends req and retries idempotent requests that failed
+// with a transient error or a 502/503, up to cfg.RetryMax times with
+// jittered exponential backoff.
+func roundTripWithRetry(req *http.Request, client *http.Client, cfg config.Config) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(CloneRequest(req))
+		if attempt >= cfg.RetryMax || !isRetryable(req, resp, err) {
+			return resp, err
+		}
+
+		delay := retryDelay(cfg.RetryBackoff, attempt)
+		if err != nil {
+			Warn.Printf("Retrying %s %s in %v (attempt %d/%d): %v", req.Method, req.Host, delay, attempt+1, cfg.RetryMax, logError(err))
+		} else {
+			Warn.Printf("Retrying %s %s in %v (attempt %d/%d): %s", req.Method, req.Host, delay, attempt+1, cfg.RetryMax, resp.Status)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	if err != nil {
+		return isTransient(err)
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// isTransient reports whether err is a network failure that may succeed on
+// a second attempt. Cancellation by the client is never transient.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// retryDelay returns base*2^attempt scaled by a random factor in [0.5, 1.5).
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	d := base << attempt
+	return time.Duration(float64(d) * (0.5 + rand.Float64()))
+}
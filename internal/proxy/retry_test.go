@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestProxyRequestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		failures int32
+		retryMax int
+		status   int
+		attempts int32
+	}{
+		{"recovers after 503s", http.MethodGet, 2, 3, http.StatusOK, 3},
+		{"gives up after RETRY_MAX", http.MethodHead, 5, 2, http.StatusServiceUnavailable, 3},
+		{"disabled by default", http.MethodGet, 1, 0, http.StatusServiceUnavailable, 1},
+		{"POST is not retried", http.MethodPost, 1, 3, http.StatusServiceUnavailable, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer backend.Close()
+
+			cfg := config.DefaultConfig()
+			cfg.RetryMax = tt.retryMax
+			cfg.RetryBackoff = time.Millisecond
+
+			req := httptest.NewRequest(tt.method, backend.URL, nil)
+			if tt.method == http.MethodPost {
+				req = httptest.NewRequest(tt.method, backend.URL, strings.NewReader("payload"))
+			}
+			rec := httptest.NewRecorder()
+			ProxyRequest(rec, req, NewDirectTransport(cfg), cfg)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d; expected %d", rec.Code, tt.status)
+			}
+			if got := attempts.Load(); got != tt.attempts {
+				t.Errorf("attempts = %d; expected %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestProxyRequestRetriesDialFailure(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	addr := backend.URL
+	backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.RetryMax = 2
+	cfg.RetryBackoff = time.Millisecond
+
+	var dials atomic.Int32
+	transport := NewDirectTransport(cfg).(*http.Transport)
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dials.Add(1)
+		return dial(ctx, network, address)
+	}
+
+	rec := httptest.NewRecorder()
+	ProxyRequest(rec, httptest.NewRequest(http.MethodGet, addr, nil), transport, cfg)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d; expected %d", rec.Code, http.StatusBadGateway)
+	}
+	if got := dials.Load(); got != 3 {
+		t.Errorf("dials = %d; expected 3", got)
+	}
+}
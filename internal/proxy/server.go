@@ -0,0 +1,609 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxyproto"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// Server is a proxy instance whose configuration can be replaced while it is serving.
+type Server struct {
+	state    atomic.Pointer[serverState]
+	updateMu sync.Mutex
+	activity *Activity
+	breakers *breakerSet
+	health   *healthChecker
+	demoted  *demotions
+	decided  *decisionCounts
+	conns    *connLimiter
+	rates    *rateLimiter
+	shaper   *shaper
+	flows    atomic.Pointer[flowLog]
+	usage    *usageTracker
+	latency  *latencyTracker
+	talkers  *talkers
+	affinity *affinity
+	tunnels  *tunnelPool
+	webhooks *notifier
+	threats  *threatFeeds
+	memory   *memoryGuard
+	audit    *authAudit
+	pac      *upstreamPAC
+
+	// tenantFlows maps tenants with a flow log of their own to it.
+	tenantFlows sync.Map
+
+	loopsOnce     sync.Once
+	configChanged chan struct{}
+	done          chan struct{}
+
+	mu        sync.Mutex
+	servers   []*http.Server
+	listeners []net.Addr
+	closed    bool
+}
+
+type serverState struct {
+	cfg        config.Config
+	transports requestTransports
+	// generation counts the states installed before this one.
+	generation uint64
+	// upstreams are the upstreams in order of preference, with SRV entries
+	// resolved. They are discovered again at refreshAt, if set.
+	upstreams []string
+	refreshAt time.Time
+
+	upstreamLoopOnce sync.Once
+	upstreamLoop     string
+
+	// tenants holds the state of each tenant, built from cfg.ForTenant.
+	tenants map[string]*serverState
+}
+
+func NewServer(cfg config.Config) *Server {
+	s := &Server{
+		activity:      NewActivity(),
+		breakers:      newBreakerSet(),
+		health:        newHealthChecker(),
+		demoted:       newDemotions(),
+		decided:       newDecisionCounts(),
+		conns:         newConnLimiter(),
+		rates:         newRateLimiter(),
+		memory:        &memoryGuard{},
+		shaper:        newShaper(),
+		usage:         newUsageTracker(),
+		latency:       newLatencyTracker(),
+		talkers:       newTalkers(),
+		affinity:      newAffinity(),
+		tunnels:       newTunnelPool(),
+		threats:       newThreatFeeds(),
+		audit:         newAuthAudit(),
+		pac:           newUpstreamPAC(),
+		configChanged: make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	logAnonymizer.Store(newAnonymizer(cfg.LogAnonymize, cfg.AnonymizeKey))
+	requestLogs.rate.Store(int64(cfg.LogSampleRate))
+	s.webhooks = newNotifier(func() config.Config { return s.state.Load().cfg }, s.done)
+	s.threats.notify = s.webhooks.notify
+	s.demoted.notify = s.webhooks.notify
+	s.state.Store(s.newState(cfg))
+	return s
+}
+
+func (s *Server) newState(cfg config.Config) *serverState {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TransportDialTimeout)
+	defer cancel()
+	upstreams, refresh := discoverUpstreams(ctx, cfg)
+	return s.newStateWith(cfg, upstreams, refresh)
+}
+
+func (s *Server) newStateWith(cfg config.Config, upstreams []string, refresh time.Duration) *serverState {
+	state := &serverState{
+		cfg:        cfg,
+		transports: newRequestTransports(cfg, upstreams, s.breakers, s.health),
+		upstreams:  upstreams,
+	}
+	state.transports.demotions = s.demoted
+	state.transports.affinity = s.affinity
+	state.transports.tunnels = s.tunnels
+	state.transports.threats = s.threats
+	state.transports.audit = s.audit
+	state.transports.pac = s.pac
+	state.transports.decisions = s.decided
+	if refresh > 0 {
+		state.refreshAt = time.Now().Add(refresh)
+	}
+	for _, tenant := range cfg.Tenants {
+		if state.tenants == nil {
+			state.tenants = make(map[string]*serverState)
+		}
+		state.tenants[tenant.Name] = s.newState(cfg.ForTenant(tenant.Name))
+	}
+	return state
+}
+
+// closeIdleConnections closes the idle connections of the state and of its
+// tenants.
+func (state *serverState) closeIdleConnections() {
+	state.transports.closeIdleConnections()
+	for _, tenant := range state.tenants {
+		tenant.transports.closeIdleConnections()
+	}
+}
+
+// Config returns a copy of the configuration currently in effect.
+func (s *Server) Config() config.Config {
+	cfg := s.state.Load().cfg
+	cfg.ProxyExceptions = append([]string(nil), cfg.ProxyExceptions...)
+	return cfg
+}
+
+// SetConfig atomically replaces the configuration. Requests already in flight
+// finish with the configuration they started with.
+func (s *Server) SetConfig(cfg config.Config) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	s.swap(cfg)
+}
+
+// Update applies fn to a copy of the current configuration and swaps the
+// result in. Concurrent updates are serialized, so read-modify-write changes
+// are never lost. If fn returns an error the configuration is left unchanged.
+func (s *Server) Update(fn func(cfg *config.Config) error) (config.Config, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	cfg := s.Config()
+	if err := fn(&cfg); err != nil {
+		return s.Config(), err
+	}
+	s.swap(cfg)
+	return cfg, nil
+}
+
+func (s *Server) swap(cfg config.Config) {
+	s.install(s.newState(cfg))
+}
+
+func (s *Server) install(state *serverState) {
+	logAnonymizer.Store(newAnonymizer(state.cfg.LogAnonymize, state.cfg.AnonymizeKey))
+	requestLogs.rate.Store(int64(state.cfg.LogSampleRate))
+	state.generation = s.state.Load().generation + 1
+	old := s.state.Swap(state)
+	old.closeIdleConnections()
+	select {
+	case s.configChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Activity returns the tracker for in-flight and recently completed connections.
+func (s *Server) Activity() *Activity {
+	return s.activity
+}
+
+// Upstreams reports the health check result and circuit state of every
+// configured upstream.
+func (s *Server) Upstreams() []UpstreamHealth {
+	var upstreams []UpstreamHealth
+	for _, addr := range s.state.Load().upstreams {
+		health := s.health.result(addr)
+		health.Circuit = s.breakers.get(addr).currentState().String()
+		s.demoted.report(&health)
+		upstreams = append(upstreams, health)
+	}
+	return upstreams
+}
+
+// DNSCache reports the size and hit counters of the DNS cache.
+func (s *Server) DNSCache() DNSCacheStats {
+	return resolveCache.stats()
+}
+
+// PurgeDNSCache drops every cached resolution and returns how many there were.
+func (s *Server) PurgeDNSCache() int {
+	n := resolveCache.purge()
+	Info.Printf("Purged %d DNS cache entries", n)
+	return n
+}
+
+// runHealthChecks probes the upstreams every HEALTH_CHECK_INTERVAL until the
+// server is stopped. A configuration change triggers an immediate round.
+func (s *Server) runHealthChecks() {
+	for {
+		cfg := s.state.Load().cfg
+		var next <-chan time.Time
+		if cfg.HealthCheckInterval > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.HealthCheckInterval)
+			for _, result := range s.health.checkAll(ctx, cfg, s.state.Load().upstreams) {
+				if result.Healthy {
+					s.webhooks.notify(EventUpstreamHealthy, result.Addr, fmt.Sprintf("Upstream %s is healthy again", result.Addr))
+				} else {
+					s.webhooks.notify(EventUpstreamUnhealthy, result.Addr, fmt.Sprintf("Upstream %s failed its health check: %s", result.Addr, result.Error))
+				}
+			}
+			cancel()
+			next = time.After(cfg.HealthCheckInterval)
+		}
+		select {
+		case <-s.done:
+			return
+		case <-s.configChanged:
+		case <-next:
+		}
+	}
+}
+
+// runDiscovery resolves SRV upstreams again when their records expire and,
+// if the set of upstreams changed, swaps in transports for the new set.
+func (s *Server) runDiscovery() {
+	ticker := time.NewTicker(minSRVRefresh)
+	defer ticker.Stop()
+	var current *serverState
+	var due time.Time
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		state := s.state.Load()
+		if state != current {
+			current, due = state, state.refreshAt
+		}
+		if due.IsZero() || time.Now().Before(due) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), state.cfg.TransportDialTimeout)
+		upstreams, refresh := discoverUpstreams(ctx, state.cfg)
+		cancel()
+		due = time.Now().Add(refresh)
+		if sameUpstreams(upstreams, state.upstreams) {
+			continue
+		}
+		s.updateMu.Lock()
+		if s.state.Load() == state {
+			Info.Printf("Discovered upstreams changed: %v", upstreams)
+			s.install(s.newStateWith(state.cfg, upstreams, refresh))
+		}
+		s.updateMu.Unlock()
+	}
+}
+
+// upstreamRefreshCheckInterval is how often the upstream refresh checks
+// whether UPSTREAM_REFRESH_INTERVAL was set by a reload while it is off.
+const upstreamRefreshCheckInterval = 10 * time.Second
+
+// runUpstreamRefresh resolves the upstreams' host names every
+// UPSTREAM_REFRESH_INTERVAL (or when their DNS cache entry expires, if later)
+// and closes the idle connections to an upstream whose addresses changed, so
+// that a DNS-based failover of the upstream is followed without a restart.
+// An interval of zero or less turns it off.
+func (s *Server) runUpstreamRefresh() {
+	known := make(map[string][]string)
+	for {
+		wait := s.state.Load().cfg.UpstreamRefreshInterval
+		if wait <= 0 {
+			wait = upstreamRefreshCheckInterval
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(wait):
+		}
+
+		state := s.state.Load()
+		if state.cfg.UpstreamRefreshInterval <= 0 {
+			continue
+		}
+		d := newDialer(state.cfg)
+		for _, upstream := range state.upstreams {
+			host, _, err := net.SplitHostPort(upstream)
+			if err != nil || net.ParseIP(host) != nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), state.cfg.TransportDialTimeout)
+			addrs, err := d.lookupHost(ctx, host)
+			cancel()
+			if err != nil {
+				continue
+			}
+			addrs = slices.Sorted(slices.Values(addrs))
+			if previous, ok := known[host]; ok && !slices.Equal(previous, addrs) {
+				Info.Printf("Upstream %s now resolves to %v (was %v), reconnecting", upstream, addrs, previous)
+				state.transports.closeIdleUpstream(upstream)
+			}
+			known[host] = addrs
+		}
+	}
+}
+
+// sameUpstreams reports whether a and b list the same upstreams, in any
+// order: SRV targets of equal priority are shuffled on every resolution.
+func sameUpstreams(a, b []string) bool {
+	return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	state := s.stateFor(req)
+	if isPACRequest(req) {
+		servePAC(w, req, state.cfg)
+		return
+	}
+	req.Host = config.CanonicalHost(req.Host)
+	client := usageClient(req)
+	conn, req := s.activity.begin(req)
+	defer func() {
+		info := s.activity.end(conn)
+		s.usage.add(client, info.BytesSent+info.BytesReceived)
+		s.latency.observe(info)
+		s.talkers.add(client, hostName(info.Host), info.BytesSent+info.BytesReceived)
+		s.flowLogFor(tenantOf(req)).write(info, newAnonymizer(state.cfg.FlowLogAnonymize, state.cfg.AnonymizeKey))
+	}()
+	rec := &statusRecorder{ResponseWriter: w, conn: conn}
+	defer recoverRequest(rec, req)
+	if s.overloaded(rec, req) {
+		return
+	}
+	if s.usage.overQuota(client, state.cfg) {
+		s.webhooks.notify(EventQuotaExceeded, client, fmt.Sprintf("Client %s exceeded its quota", logClient(client)))
+		writeQuotaExceeded(rec, req, client)
+		return
+	}
+	if reason := s.loopReason(req, state); reason != "" {
+		writeLoopDetected(rec, req, reason)
+		return
+	}
+	if !s.rates.limit(rec, req, state.cfg) {
+		return
+	}
+	release, ok := s.conns.limit(rec, req, state.cfg)
+	if !ok {
+		return
+	}
+	defer release()
+	req, done := s.shaper.begin(req, state.cfg)
+	defer done()
+	handleRequestWithTransports(rec, req, state.cfg, state.transports)
+}
+
+// PointsToSelf reports whether addr, host:port or an upstream address,
+// reaches one of the server's own listeners, e.g. an upstream that would
+// route requests back to it.
+func (s *Server) PointsToSelf(addr string) bool {
+	addr, _ = splitUpstream(addr)
+	return pointsToListener(addr, s.listenAddrs())
+}
+
+func (s *Server) listenAddrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]net.Addr(nil), s.listeners...)
+}
+
+// loopReason explains why req would loop back into this proxy, or returns
+// "" if it would not. Whether an upstream points back here is only checked
+// once per configuration.
+func (s *Server) loopReason(req *http.Request, state *serverState) string {
+	if target := targetAddr(req); !resolvesRemotely(target, state.cfg) && s.PointsToSelf(target) {
+		return fmt.Sprintf("destination %s is this proxy", target)
+	}
+	if Decide(req.Host, state.cfg).Direct() {
+		return ""
+	}
+	state.upstreamLoopOnce.Do(func() {
+		for _, upstream := range state.upstreams {
+			if s.PointsToSelf(upstream) {
+				state.upstreamLoop = fmt.Sprintf("upstream %s is this proxy", upstream)
+				return
+			}
+		}
+	})
+	return state.upstreamLoop
+}
+
+// Serve accepts proxy connections on l until the server is shut down.
+func (s *Server) Serve(l net.Listener) error {
+	return s.serve(l, s)
+}
+
+// ServeListener is like Serve for one of the configured listeners: it reads
+// PROXY protocol headers, takes redirected connections, terminates TLS,
+// requires client authentication and applies the policy of a tenant if the
+// listener asks for them.
+func (s *Server) ServeListener(l net.Listener, listener config.Listener) error {
+	cfg := s.state.Load().cfg
+	var handler http.Handler = s
+	if listener.Auth {
+		handler = s.requireAuth(s)
+	}
+	if listener.Tenant != "" {
+		handler = withTenant(handler, listener.Tenant)
+	}
+	if listener.ProxyProtocol {
+		trusted, err := parseNetworks(cfg.ProxyProtocolTrusted)
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("PROXY_PROTOCOL_TRUSTED: %w", err)
+		}
+		l = &proxyproto.Listener{Listener: l, Timeout: cfg.ServerReadHeaderTimeout, Trusted: trusted}
+	}
+	if listener.Transparent {
+		if runtime.GOOS != "linux" {
+			l.Close()
+			return fmt.Errorf("%s: %w", listener.Addr, errTransparentUnsupported)
+		}
+		l = transparentListener{Listener: l}
+	}
+	if listener.TLS {
+		cert, err := tls.LoadX509KeyPair(cfg.ListenTLSCert, cfg.ListenTLSKey)
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("failed to load the TLS certificate for %s: %w", listener.Addr, err)
+		}
+		// HTTP/2 has no room for hijacked CONNECT tunnels.
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"http/1.1"}})
+	}
+	return s.serve(l, handler)
+}
+
+// parseNetworks parses CIDRs and plain IP addresses.
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range list {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address or network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (s *Server) serve(l net.Listener, handler http.Handler) error {
+	cfg := s.state.Load().cfg
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		ReadTimeout:       cfg.ServerReadTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+		IdleTimeout:       cfg.ServerIdleTimeout,
+		MaxHeaderBytes:    cfg.ServerMaxHeaderBytes,
+		ConnContext:       withConnOwner,
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return http.ErrServerClosed
+	}
+	s.servers = append(s.servers, srv)
+	s.listeners = append(s.listeners, l.Addr())
+	s.mu.Unlock()
+	if cfg.StrictHTTP {
+		l = &strictListener{Listener: l, maxHeaderBytes: cfg.ServerMaxHeaderBytes}
+	}
+	s.loopsOnce.Do(func() {
+		go s.runHealthChecks()
+		go s.runDiscovery()
+		go s.runUpstreamRefresh()
+		go s.runThreatFeeds()
+		go s.runUpstreamPAC()
+		go s.runMemoryGuard()
+		go s.runInfluxExport()
+	})
+
+	return srv.Serve(l)
+}
+
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.state.Load().cfg.ProxyAddr())
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Shutdown gracefully stops all listeners started through Serve.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, srv := range s.stopServers() {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	s.state.Load().closeIdleConnections()
+	return errors.Join(errs...)
+}
+
+// Drain stops accepting connections and waits until all in-flight requests
+// and tunnels have finished or ctx is done, whichever comes first.
+func (s *Server) Drain(ctx context.Context) error {
+	err := s.Shutdown(ctx)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for len(s.activity.Active()) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d connections still active: %w", len(s.activity.Active()), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return err
+}
+
+// Close immediately stops all listeners started through Serve.
+func (s *Server) Close() error {
+	var errs []error
+	for _, srv := range s.stopServers() {
+		errs = append(errs, srv.Close())
+	}
+	s.state.Load().closeIdleConnections()
+	return errors.Join(errs...)
+}
+
+func (s *Server) stopServers() []*http.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		close(s.done)
+	}
+	s.closed = true
+	return append([]*http.Server(nil), s.servers...)
+}
+
+func (t requestTransports) closeIdleConnections() {
+	rts := []http.RoundTripper{t.direct}
+	for _, u := range t.upstreams {
+		rts = append(rts, u.transport)
+	}
+	if t.mirror != nil {
+		rts = append(rts, t.mirror.transport)
+	}
+	if t.canary != nil {
+		rts = append(rts, t.canary.transport)
+	}
+	for _, rt := range rts {
+		closeIdle(rt)
+	}
+	t.tunnels.closeAll()
+}
+
+// closeIdleUpstream closes the idle connections to the upstream addr, so that
+// new requests dial it again.
+func (t requestTransports) closeIdleUpstream(addr string) {
+	for _, u := range t.upstreams {
+		if u.addr == addr {
+			closeIdle(u.transport)
+		}
+	}
+}
+
+func closeIdle(rt http.RoundTripper) {
+	if n, ok := rt.(ntlmssp.Negotiator); ok {
+		rt = n.RoundTripper
+	}
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
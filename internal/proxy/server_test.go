@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestServerDrainWaitsForTunnels(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer client.Close()
+	fmt.Fprintf(client, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", backend.Addr(), backend.Addr())
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT failed: %v %v", resp, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain with open tunnel = %v; expected deadline exceeded", err)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- server.Drain(context.Background()) }()
+	client.Close()
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("Drain = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Drain did not return after the tunnel closed")
+	}
+}
+
+func TestUpstreamRefreshInterval(t *testing.T) {
+	for _, tt := range []struct {
+		interval time.Duration
+		resolves bool
+	}{
+		{0, false},
+		{-time.Second, false},
+		{10 * time.Millisecond, true},
+	} {
+		var queries atomic.Int64
+		dns := serveDNS(t, func(q dnsmessage.Question) ([]dnsmessage.Resource, dnsmessage.RCode) {
+			queries.Add(1)
+			return nil, dnsmessage.RCodeNameError
+		})
+		cfg := config.DefaultConfig()
+		cfg.UpstreamProxy = "upstream.test:3128"
+		cfg.DNSServers = []string{dns}
+		cfg.UpstreamRefreshInterval = tt.interval
+		server := NewServer(cfg)
+		done := make(chan struct{})
+		go func() {
+			server.runUpstreamRefresh()
+			close(done)
+		}()
+		time.Sleep(200 * time.Millisecond)
+		server.Close()
+		<-done
+		if got := queries.Load() > 0; got != tt.resolves {
+			t.Errorf("interval %v: %d queries; expected resolving %v", tt.interval, queries.Load(), tt.resolves)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// priorityWeights are the relative shares of BANDWIDTH_LIMIT the QoS
+// priorities get while they compete for it.
+var priorityWeights = map[string]float64{
+	config.PriorityHigh:   4,
+	config.PriorityNormal: 2,
+	config.PriorityLow:    1,
+}
+
+// shapeChunk bounds a single shaped read, so one stream cannot take the
+// bandwidth of the others in one large burst.
+const shapeChunk = 16 << 10
+
+// shaper limits the combined throughput of tunnels and response bodies to
+// BANDWIDTH_LIMIT. The limit is shared between the QoS priorities that have
+// open streams in proportion to their weights, and each priority's share is
+// enforced by its own token bucket.
+type shaper struct {
+	mu      sync.Mutex
+	open    map[string]int
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// shapedStream is the shaping state of one request, carried in its context.
+// A request may be shaped by several streams, e.g. BANDWIDTH_LIMIT and a
+// CHAOS_RULES bandwidth cap, and is held to the slowest.
+type shapedStream struct {
+	shaper   *shaper
+	priority string
+	limit    int64
+}
+
+type shapedStreamKey struct{}
+
+func newShaper() *shaper {
+	return &shaper{open: make(map[string]int), buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// qosPriority returns the priority of the first QOS_CLASSES entry matching
+// host, or normal.
+func qosPriority(host string, cfg config.Config) string {
+	for _, class := range cfg.QoSClasses {
+		if config.IsException(host, []string{class.Pattern}) {
+			return class.Priority
+		}
+	}
+	return config.PriorityNormal
+}
+
+// begin registers req as an open stream of its destination's priority. The
+// returned function unregisters it. Without a bandwidth limit req is
+// returned unchanged.
+func (s *shaper) begin(req *http.Request, cfg config.Config) (*http.Request, func()) {
+	if cfg.BandwidthLimit <= 0 {
+		return req, func() {}
+	}
+	stream := &shapedStream{shaper: s, priority: qosPriority(req.Host, cfg), limit: cfg.BandwidthLimit}
+	s.mu.Lock()
+	s.open[stream.priority]++
+	s.mu.Unlock()
+	return withShapedStream(req, stream), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.open[stream.priority]--; s.open[stream.priority] <= 0 {
+			delete(s.open, stream.priority)
+		}
+	}
+}
+
+// rate returns the bytes per second currently granted to priority. Callers
+// must hold s.mu.
+func (s *shaper) rate(priority string, limit int64) float64 {
+	var total float64
+	for p := range s.open {
+		total += priorityWeights[p]
+	}
+	if total == 0 {
+		return float64(limit)
+	}
+	return float64(limit) * priorityWeights[priority] / total
+}
+
+// take accounts n bytes to priority and waits until its bucket is no longer
+// in debt. It returns early with ctx's error if ctx is done first.
+func (s *shaper) take(ctx context.Context, priority string, limit int64, n int) error {
+	s.mu.Lock()
+	rate := s.rate(priority, limit)
+	// Allow bursts of a tenth of a second.
+	burst := max(rate/10, shapeChunk)
+	now := s.now()
+	b := s.buckets[priority]
+	if b == nil {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[priority] = b
+	}
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rate, burst)
+	b.last = now
+	b.tokens -= float64(n)
+	wait := time.Duration(-b.tokens / rate * float64(time.Second))
+	s.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func withShapedStream(req *http.Request, stream *shapedStream) *http.Request {
+	streams := shapedStreamsFrom(req)
+	streams = append(streams[:len(streams):len(streams)], stream)
+	return req.WithContext(context.WithValue(req.Context(), shapedStreamKey{}, streams))
+}
+
+func shapedStreamsFrom(req *http.Request) []*shapedStream {
+	streams, _ := req.Context().Value(shapedStreamKey{}).([]*shapedStream)
+	return streams
+}
+
+// shapeConn limits the rate data is read from one side of req's tunnel.
+func shapeConn(req *http.Request, conn net.Conn) net.Conn {
+	for _, stream := range shapedStreamsFrom(req) {
+		conn = &shapedConn{Conn: conn, ctx: req.Context(), stream: stream}
+	}
+	return conn
+}
+
+// shapeBody limits the rate the response body to req is read.
+func shapeBody(req *http.Request, body io.ReadCloser) io.ReadCloser {
+	for _, stream := range shapedStreamsFrom(req) {
+		body = &shapedReadCloser{ReadCloser: body, ctx: req.Context(), stream: stream}
+	}
+	return body
+}
+
+func (s *shapedStream) read(ctx context.Context, r io.Reader, p []byte) (int, error) {
+	if len(p) > shapeChunk {
+		p = p[:shapeChunk]
+	}
+	n, err := r.Read(p)
+	if n > 0 {
+		if werr := s.shaper.take(ctx, s.priority, s.limit, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+type shapedConn struct {
+	net.Conn
+	ctx    context.Context
+	stream *shapedStream
+}
+
+func (c *shapedConn) Read(p []byte) (int, error) {
+	return c.stream.read(c.ctx, c.Conn, p)
+}
+
+// NetConn returns the wrapped connection.
+func (c *shapedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+type shapedReadCloser struct {
+	io.ReadCloser
+	ctx    context.Context
+	stream *shapedStream
+}
+
+func (r *shapedReadCloser) Read(p []byte) (int, error) {
+	return r.stream.read(r.ctx, r.ReadCloser, p)
+}
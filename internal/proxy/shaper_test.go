@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestQoSPriority(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.QoSClasses = []config.QoSClass{
+		{Pattern: "*.zoom.us", Priority: config.PriorityHigh},
+		{Pattern: "download.example", Priority: config.PriorityLow},
+	}
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"us02web.zoom.us:443", config.PriorityHigh},
+		{"download.example", config.PriorityLow},
+		{"www.example.com", config.PriorityNormal},
+	}
+
+	for _, tt := range tests {
+		if got := qosPriority(tt.host, cfg); got != tt.expected {
+			t.Errorf("qosPriority(%q) = %q; expected %q", tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestShaperSharesByPriority(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BandwidthLimit = 1000
+	cfg.QoSClasses = []config.QoSClass{
+		{Pattern: "meet.example", Priority: config.PriorityHigh},
+		{Pattern: "bulk.example", Priority: config.PriorityLow},
+	}
+	s := newShaper()
+
+	_, doneHigh := s.begin(httptest.NewRequest("CONNECT", "meet.example:443", nil), cfg)
+	if got := s.rate(config.PriorityHigh, cfg.BandwidthLimit); got != 1000 {
+		t.Errorf("rate of the only open priority = %v; expected 1000", got)
+	}
+
+	_, doneLow := s.begin(httptest.NewRequest("CONNECT", "bulk.example:443", nil), cfg)
+	if got := s.rate(config.PriorityHigh, cfg.BandwidthLimit); got != 800 {
+		t.Errorf("high rate = %v; expected 800", got)
+	}
+	if got := s.rate(config.PriorityLow, cfg.BandwidthLimit); got != 200 {
+		t.Errorf("low rate = %v; expected 200", got)
+	}
+
+	doneHigh()
+	if got := s.rate(config.PriorityLow, cfg.BandwidthLimit); got != 1000 {
+		t.Errorf("low rate after high finished = %v; expected 1000", got)
+	}
+	doneLow()
+	if len(s.open) != 0 {
+		t.Errorf("open streams after all finished = %v; expected none", s.open)
+	}
+}
+
+func TestShaperWithoutLimit(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	shaped, done := newShaper().begin(req, config.DefaultConfig())
+	defer done()
+	if shaped != req || shapedStreamsFrom(shaped) != nil {
+		t.Fatalf("begin without BANDWIDTH_LIMIT changed the request")
+	}
+}
+
+func TestShaperTake(t *testing.T) {
+	s := newShaper()
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := s.take(ctx, config.PriorityNormal, 1<<20, shapeChunk); err != nil {
+		t.Fatalf("take within the burst: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.take(canceled, config.PriorityNormal, 1<<20, 1<<20); err != context.Canceled {
+		t.Fatalf("take beyond the burst with a canceled context = %v; expected context.Canceled", err)
+	}
+
+	// A second later the debt has been paid off.
+	now = now.Add(time.Second)
+	start := time.Now()
+	if err := s.take(ctx, config.PriorityNormal, 1<<20, 1); err != nil {
+		t.Fatalf("take after refill: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("take after refill waited %v", elapsed)
+	}
+}
+
+func TestShapeBodyLimitsRate(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BandwidthLimit = 200 << 10
+	req, done := newShaper().begin(httptest.NewRequest("GET", "http://example.com/", nil), cfg)
+	defer done()
+
+	// 20 KiB pass within the burst, the next 40 KiB take about 200ms.
+	body := shapeBody(req, io.NopCloser(strings.NewReader(strings.Repeat("x", 60<<10))))
+	start := time.Now()
+	n, err := io.Copy(io.Discard, body)
+	if err != nil || n != 60<<10 {
+		t.Fatalf("copy = %d, %v; expected %d bytes", n, err, 60<<10)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("60 KiB at 200 KiB/s took %v; expected at least 150ms", elapsed)
+	}
+}
@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TLS extensions read from the ClientHello.
+const (
+	extServerName          = 0
+	extSupportedGroups     = 10
+	extPointFormats        = 11
+	extSignatureAlgorithms = 13
+	extALPN                = 16
+	extSupportedVersions   = 43
+)
+
+// maxClientHello bounds the bytes buffered while looking for the
+// ClientHello of a tunnel.
+const maxClientHello = 16 << 10
+
+// sniConn records the server name (SNI) and the JA3 and JA4 fingerprints of
+// the TLS ClientHello a client sends into a tunnel. Data passes through
+// unchanged; it is only inspected until the ClientHello has been seen or the
+// stream turned out not to be TLS.
+type sniConn struct {
+	net.Conn
+	conn *trackedConn
+	buf  []byte
+	done bool
+}
+
+// sniffSNI wraps the client side of a tunnel to record its ClientHello.
+func (c *trackedConn) sniffSNI(conn net.Conn) net.Conn {
+	if c == nil {
+		return conn
+	}
+	return &sniConn{Conn: conn, conn: c}
+}
+
+func (c *sniConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.done && n > 0 {
+		c.buf = append(c.buf, p[:n]...)
+		hello, complete := parseClientHello(c.buf)
+		if complete || len(c.buf) >= maxClientHello {
+			c.done = true
+			c.buf = nil
+			c.conn.setClientHello(hello)
+		}
+	}
+	return n, err
+}
+
+// NetConn returns the wrapped connection.
+func (c *sniConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// clientHelloInfo is what a tunnel's TLS ClientHello tells about the client.
+type clientHelloInfo struct {
+	serverName string
+	ja3        string
+	ja4        string
+}
+
+// parseClientHello reads the TLS ClientHello at the start of data. complete
+// is false while more data is needed to tell; once it is true, a zero
+// clientHelloInfo means data is not TLS.
+func parseClientHello(data []byte) (hello clientHelloInfo, complete bool) {
+	if len(data) < 5 {
+		return hello, false
+	}
+	if data[0] != 0x16 { // handshake record
+		return hello, true
+	}
+	record := int(data[3])<<8 | int(data[4])
+	if len(data) < 5+record {
+		return hello, false
+	}
+	r := tlsReader(data[5 : 5+record])
+	if r.u8() != 0x01 { // ClientHello
+		return hello, true
+	}
+	r = tlsReader(r.bytes(int(r.u24())))
+	if len(r) < 2+32 {
+		return hello, true
+	}
+	f := helloFields{version: r.u16()}
+	r.skip(32)           // random
+	r.bytes(int(r.u8())) // session ID
+	suites := tlsReader(r.bytes(int(r.u16())))
+	for len(suites) > 1 {
+		f.ciphers = append(f.ciphers, suites.u16())
+	}
+	r.bytes(int(r.u8())) // compression methods
+	extensions := tlsReader(r.bytes(int(r.u16())))
+	for len(extensions) > 3 {
+		typ := extensions.u16()
+		ext := tlsReader(extensions.bytes(int(extensions.u16())))
+		f.extensions = append(f.extensions, typ)
+		switch typ {
+		case extServerName:
+			names := tlsReader(ext.bytes(int(ext.u16())))
+			for len(names) > 0 {
+				kind := names.u8()
+				host := names.bytes(int(names.u16()))
+				if kind == 0 && hello.serverName == "" { // host_name
+					hello.serverName = string(host)
+				}
+			}
+		case extSupportedGroups:
+			groups := tlsReader(ext.bytes(int(ext.u16())))
+			for len(groups) > 1 {
+				f.groups = append(f.groups, groups.u16())
+			}
+		case extPointFormats:
+			for _, format := range ext.bytes(int(ext.u8())) {
+				f.pointFormats = append(f.pointFormats, uint16(format))
+			}
+		case extSignatureAlgorithms:
+			algs := tlsReader(ext.bytes(int(ext.u16())))
+			for len(algs) > 1 {
+				f.sigAlgs = append(f.sigAlgs, algs.u16())
+			}
+		case extALPN:
+			protocols := tlsReader(ext.bytes(int(ext.u16())))
+			f.alpn = string(protocols.bytes(int(protocols.u8())))
+		case extSupportedVersions:
+			versions := tlsReader(ext.bytes(int(ext.u8())))
+			for len(versions) > 1 {
+				if v := versions.u16(); !isGREASE(v) && v > f.maxVersion {
+					f.maxVersion = v
+				}
+			}
+		}
+	}
+	hello.ja3, hello.ja4 = f.ja3(), f.ja4()
+	return hello, true
+}
+
+// helloFields are the ClientHello fields the JA3 and JA4 fingerprints are
+// made of, in the order the client sent them.
+type helloFields struct {
+	version      uint16
+	maxVersion   uint16
+	ciphers      []uint16
+	extensions   []uint16
+	groups       []uint16
+	pointFormats []uint16
+	sigAlgs      []uint16
+	alpn         string
+}
+
+// isGREASE reports whether v is one of the reserved values of RFC 8701 that
+// clients send at random to keep servers tolerant, which fingerprints leave
+// out.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// withoutGREASE returns values without GREASE values.
+func withoutGREASE(values []uint16) []uint16 {
+	var out []uint16
+	for _, v := range values {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ja3 returns the JA3 fingerprint: the MD5 of the TLS version, cipher
+// suites, extensions, supported groups and point formats in decimal.
+func (f helloFields) ja3() string {
+	join := func(values []uint16) string {
+		s := make([]string, 0, len(values))
+		for _, v := range withoutGREASE(values) {
+			s = append(s, strconv.Itoa(int(v)))
+		}
+		return strings.Join(s, "-")
+	}
+	sum := md5.Sum([]byte(strconv.Itoa(int(f.version)) + "," + join(f.ciphers) + "," +
+		join(f.extensions) + "," + join(f.groups) + "," + join(f.pointFormats)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ja4 returns the JA4 fingerprint: the TLS version, whether a server name
+// was sent, the number of cipher suites and extensions and the first ALPN
+// protocol, followed by truncated hashes of the sorted cipher suites and of
+// the sorted extensions with the signature algorithms.
+func (f helloFields) ja4() string {
+	version := f.maxVersion
+	if version == 0 {
+		version = f.version
+	}
+	versions := map[uint16]string{0x0304: "13", 0x0303: "12", 0x0302: "11", 0x0301: "10", 0x0300: "s3"}
+	v, ok := versions[version]
+	if !ok {
+		v = "00"
+	}
+	ciphers := withoutGREASE(f.ciphers)
+	extensions := withoutGREASE(f.extensions)
+	sni := "i"
+	if slices.Contains(extensions, extServerName) {
+		sni = "d"
+	}
+	alpn := "00"
+	if a := f.alpn; a != "" {
+		first, last := a[0], a[len(a)-1]
+		if isAlphanumeric(first) && isAlphanumeric(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			h := hex.EncodeToString([]byte(a))
+			alpn = string([]byte{h[0], h[len(h)-1]})
+		}
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", v, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	hash := func(s string) string {
+		if s == "" {
+			return "000000000000"
+		}
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])[:12]
+	}
+	hexList := func(values []uint16) string {
+		s := make([]string, 0, len(values))
+		for _, v := range values {
+			s = append(s, fmt.Sprintf("%04x", v))
+		}
+		return strings.Join(s, ",")
+	}
+	slices.Sort(ciphers)
+	extensions = slices.DeleteFunc(extensions, func(e uint16) bool { return e == extServerName || e == extALPN })
+	slices.Sort(extensions)
+	c := hexList(extensions)
+	if algs := hexList(withoutGREASE(f.sigAlgs)); algs != "" && c != "" {
+		c += "_" + algs
+	}
+	return a + "_" + hash(hexList(ciphers)) + "_" + hash(c)
+}
+
+func isAlphanumeric(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// tlsReader reads big-endian fields of a TLS message. Reads past the end
+// return zeros and empty slices.
+type tlsReader []byte
+
+func (r *tlsReader) bytes(n int) []byte {
+	if n > len(*r) {
+		n = len(*r)
+	}
+	b := (*r)[:n]
+	*r = (*r)[n:]
+	return b
+}
+
+func (r *tlsReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *tlsReader) uint(n int) uint32 {
+	b := r.bytes(n)
+	if len(b) < n {
+		return 0
+	}
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func (r *tlsReader) u8() uint8   { return uint8(r.uint(1)) }
+func (r *tlsReader) u16() uint16 { return uint16(r.uint(2)) }
+func (r *tlsReader) u24() uint32 { return r.uint(3) }
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+)
+
+// clientHello returns the first bytes a TLS client asking for serverName
+// sends.
+func clientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		c := tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		c.Handshake()
+		client.Close()
+	}()
+	buf := make([]byte, 64<<10)
+	n, err := io.ReadAtLeast(server, buf, 5)
+	if err != nil {
+		t.Fatalf("read ClientHello: %v", err)
+	}
+	return buf[:n]
+}
+
+func TestParseClientHello(t *testing.T) {
+	hello := clientHello(t, "www.example.test")
+	noSNI := clientHello(t, "10.0.0.1")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		sni      string
+		complete bool
+	}{
+		{"ClientHello", hello, "www.example.test", true},
+		{"partial ClientHello", hello[:len(hello)/2], "", false},
+		{"record header only", hello[:3], "", false},
+		{"IP address, no SNI", noSNI, "", true},
+		{"plain HTTP", []byte("GET / HTTP/1.1\r\n\r\n"), "", true},
+		{"garbage handshake", []byte{0x16, 3, 1, 0, 4, 1, 0xff, 0xff, 0xff}, "", true},
+	}
+	for _, tt := range tests {
+		hello, complete := parseClientHello(tt.data)
+		if hello.serverName != tt.sni || complete != tt.complete {
+			t.Errorf("%s: parseClientHello = %q, %v; expected %q, %v", tt.name, hello.serverName, complete, tt.sni, tt.complete)
+		}
+	}
+
+	got, _ := parseClientHello(hello)
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(got.ja3) {
+		t.Errorf("JA3 = %q; expected an MD5 sum", got.ja3)
+	}
+	if !regexp.MustCompile(`^t13d\d{4}(h2|00)_[0-9a-f]{12}_[0-9a-f]{12}$`).MatchString(got.ja4) {
+		t.Errorf("JA4 = %q; expected a TLS 1.3 fingerprint with SNI", got.ja4)
+	}
+	if got, _ := parseClientHello(noSNI); got.ja4[3] != 'i' {
+		t.Errorf("JA4 without SNI = %q; expected 'i' in place of 'd'", got.ja4)
+	}
+}
+
+// tlsVector appends a length-prefixed vector of size bytes to b.
+func tlsVector(b []byte, size int, data []byte) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(len(data)>>(8*i)))
+	}
+	return append(b, data...)
+}
+
+func uint16s(values ...uint16) []byte {
+	var b []byte
+	for _, v := range values {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+func TestClientHelloFingerprints(t *testing.T) {
+	extension := func(b []byte, typ uint16, data []byte) []byte {
+		return tlsVector(append(b, uint16s(typ)...), 2, data)
+	}
+	var extensions []byte
+	extensions = extension(extensions, 0x1a1a, nil) // GREASE
+	extensions = extension(extensions, extServerName, tlsVector(nil, 2, tlsVector([]byte{0}, 2, []byte("a.test"))))
+	extensions = extension(extensions, extSupportedGroups, tlsVector(nil, 2, uint16s(0x2a2a, 0x001d, 0x0017)))
+	extensions = extension(extensions, extPointFormats, tlsVector(nil, 1, []byte{0}))
+	extensions = extension(extensions, extSignatureAlgorithms, tlsVector(nil, 2, uint16s(0x0403, 0x0804)))
+	extensions = extension(extensions, extALPN, tlsVector(nil, 2, append(tlsVector(nil, 1, []byte("h2")), tlsVector(nil, 1, []byte("http/1.1"))...)))
+	extensions = extension(extensions, extSupportedVersions, tlsVector(nil, 1, uint16s(0x3a3a, 0x0304, 0x0303)))
+
+	body := uint16s(0x0303)
+	body = append(body, make([]byte, 32)...) // random
+	body = tlsVector(body, 1, nil)           // session ID
+	body = tlsVector(body, 2, uint16s(0x0a0a, 0x1301, 0xc02b))
+	body = tlsVector(body, 1, []byte{0}) // compression methods
+	body = tlsVector(body, 2, extensions)
+	record := tlsVector([]byte{0x16, 3, 1}, 2, tlsVector([]byte{0x01}, 3, body))
+
+	hello, complete := parseClientHello(record)
+	if !complete || hello.serverName != "a.test" {
+		t.Fatalf("parseClientHello = %+v, %v; expected SNI a.test", hello, complete)
+	}
+	// JA3 of "771,4865-49195,0-10-11-13-16-43,29-23,0".
+	if want := "87991a9b84cb5b4bc5f84c5ecad46032"; hello.ja3 != want {
+		t.Errorf("JA3 = %s; expected %s", hello.ja3, want)
+	}
+	if want := "t13d0206h2_777cda164f4b_fb71836bce29"; hello.ja4 != want {
+		t.Errorf("JA4 = %s; expected %s", hello.ja4, want)
+	}
+}
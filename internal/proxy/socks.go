@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// socksUpstream is an upstream written as socks4://[user@]host[:port] or
+// socks4a://[user@]host[:port], for jump boxes that only speak SOCKS4. The
+// port defaults to 1080 and user is sent as the SOCKS user ID. SOCKS4a
+// servers resolve destinations themselves; for SOCKS4 they are resolved
+// locally, to IPv4 addresses.
+type socksUpstream struct {
+	hostport  string
+	userID    string
+	remoteDNS bool
+}
+
+// socksGranted is the SOCKS4 reply code of granted requests.
+const socksGranted = 90
+
+var socksReplies = map[byte]string{
+	91: "request rejected or failed",
+	92: "identd on the client is unreachable",
+	93: "identd could not confirm the user ID",
+}
+
+// parseSOCKSUpstream returns the SOCKS upstream addr names, or false if
+// addr is not a socks4:// or socks4a:// upstream.
+func parseSOCKSUpstream(addr string) (socksUpstream, bool) {
+	var s socksUpstream
+	rest, ok := strings.CutPrefix(addr, "socks4a://")
+	if ok {
+		s.remoteDNS = true
+	} else if rest, ok = strings.CutPrefix(addr, "socks4://"); !ok {
+		return s, false
+	}
+	rest = strings.TrimSuffix(rest, "/")
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		s.userID, rest = rest[:i], rest[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(rest); err != nil {
+		rest = net.JoinHostPort(strings.Trim(rest, "[]"), "1080")
+	}
+	s.hostport = rest
+	return s, true
+}
+
+// dial connects to target through the SOCKS server. Handshake failures
+// are reported as errUpstreamRejected, like refused CONNECTs.
+func (s socksUpstream) dial(ctx context.Context, target string, cfg config.Config) (net.Conn, error) {
+	req, err := s.request(ctx, target, cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newUpstreamDialer(cfg, s.hostport).DialContext(ctx, "tcp", s.hostport)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(cfg.TunnelConnectReadWriteTimeout)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set SOCKS handshake deadline: %w", err)
+	}
+	if _, err := conn.Write(req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send SOCKS request: %w", err)
+	}
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("bad SOCKS reply: %w", err)
+	}
+	if reply[1] != socksGranted {
+		conn.Close()
+		reason, ok := socksReplies[reply[1]]
+		if !ok {
+			reason = "reply code " + strconv.Itoa(int(reply[1]))
+		}
+		return nil, fmt.Errorf("%w: SOCKS4 %s", errUpstreamRejected, reason)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to clear SOCKS handshake deadline: %w", err)
+	}
+	return conn, nil
+}
+
+// request builds the SOCKS4 CONNECT request for target. SOCKS4a requests
+// carry host names after the user ID, with the invalid address 0.0.0.1.
+func (s socksUpstream) request(ctx context.Context, target string, cfg config.Config) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", target)
+	}
+	ip, err := netip.ParseAddr(host)
+	name := ""
+	switch {
+	case err == nil:
+	case s.remoteDNS:
+		ip, name = netip.AddrFrom4([4]byte{0, 0, 0, 1}), host
+	case resolvesRemotely(host, cfg):
+		return nil, fmt.Errorf("%s must be resolved by the upstream, which needs a socks4a:// upstream", host)
+	default:
+		if ip, err = s.resolve(ctx, host, cfg); err != nil {
+			return nil, err
+		}
+	}
+	ip = ip.Unmap()
+	if !ip.Is4() {
+		return nil, errors.New("SOCKS4 upstreams only connect to IPv4 addresses")
+	}
+	req := []byte{4, 1, byte(port >> 8), byte(port)}
+	req = append(req, ip.AsSlice()...)
+	req = append(append(req, s.userID...), 0)
+	if name != "" {
+		req = append(append(req, name...), 0)
+	}
+	return req, nil
+}
+
+// resolve returns the first IPv4 address of host.
+func (s socksUpstream) resolve(ctx context.Context, host string, cfg config.Config) (netip.Addr, error) {
+	addrs, err := newDirectDialer(cfg).lookupHost(ctx, host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	for _, a := range addrs {
+		if ip, err := netip.ParseAddr(a); err == nil && ip.Unmap().Is4() {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("%s has no IPv4 address to reach it through SOCKS4", host)
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// serveSOCKS4 answers one SOCKS4 or SOCKS4a request, connecting every
+// destination to backend, and reports the requested destination and user.
+func serveSOCKS4(conn net.Conn, backend string, requested func(dest, user string)) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(br, head); err != nil || head[0] != 4 || head[1] != 1 {
+		return
+	}
+	user, err := br.ReadString(0)
+	if err != nil {
+		return
+	}
+	user = strings.TrimSuffix(user, "\x00")
+	dest := net.IP(head[4:8]).String()
+	if head[4] == 0 && head[5] == 0 && head[6] == 0 && head[7] != 0 {
+		if dest, err = br.ReadString(0); err != nil {
+			return
+		}
+		dest = strings.TrimSuffix(dest, "\x00")
+	}
+	requested(dest, user)
+	if user == "blocked" {
+		conn.Write([]byte{0, 91, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	out, err := net.Dial("tcp", backend)
+	if err != nil {
+		conn.Write([]byte{0, 91, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer out.Close()
+	conn.Write([]byte{0, 90, 0, 0, 0, 0, 0, 0})
+	go io.Copy(out, br)
+	io.Copy(conn, out)
+}
+
+func TestSOCKS4Upstream(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fetched "+r.URL.Path)
+	}))
+	defer backend.Close()
+	socks, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer socks.Close()
+	var mu sync.Mutex
+	var dest, user string
+	go func() {
+		for {
+			conn, err := socks.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS4(conn, backend.Listener.Addr().String(), func(d, u string) {
+				mu.Lock()
+				dest, user = d, u
+				mu.Unlock()
+			})
+		}
+	}()
+
+	cfg := config.DefaultConfig()
+	tests := []struct {
+		upstream string
+		target   string
+		dest     string
+		user     string
+		err      error
+	}{
+		{"socks4://" + socks.Addr().String(), "127.0.0.1:80", "127.0.0.1", "", nil},
+		{"socks4://alice@" + socks.Addr().String(), "localhost:80", "127.0.0.1", "alice", nil},
+		{"socks4a://alice@" + socks.Addr().String(), "jump.test:80", "jump.test", "alice", nil},
+		{"socks4a://blocked@" + socks.Addr().String(), "jump.test:80", "jump.test", "blocked", errUpstreamRejected},
+	}
+	for _, tt := range tests {
+		conn, err := DialViaUpstream(tt.upstream, tt.target, cfg)
+		mu.Lock()
+		gotDest, gotUser := dest, user
+		mu.Unlock()
+		if gotDest != tt.dest || gotUser != tt.user {
+			t.Errorf("%s to %s requested %q as %q; expected %q as %q", tt.upstream, tt.target, gotDest, gotUser, tt.dest, tt.user)
+		}
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s to %s: %v; expected %v", tt.upstream, tt.target, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s to %s: %v", tt.upstream, tt.target, err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "http://"+tt.target+"/tunnel", nil)
+		req.Write(conn)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			conn.Close()
+			t.Fatalf("request through the tunnel: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		conn.Close()
+		if string(body) != "fetched /tunnel" {
+			t.Errorf("%s to %s read %q through the tunnel", tt.upstream, tt.target, body)
+		}
+	}
+
+	transport := newUpstreamTransport(cfg, "socks4a://"+socks.Addr().String())
+	req, _ := http.NewRequest(http.MethodGet, "http://intranet.test/page", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("GET through SOCKS4a: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if string(body) != "fetched /page" || dest != "intranet.test" {
+		t.Errorf("GET through SOCKS4a requested %q and read %q", dest, body)
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// srvPrefix marks an UPSTREAM_PROXY entry naming an SRV record, e.g.
+// srv:_proxy._tcp.corp.example.com, whose targets are the upstreams.
+const srvPrefix = "srv:"
+
+// minSRVRefresh bounds how often SRV records are re-resolved, however short
+// their TTL.
+const minSRVRefresh = time.Second
+
+// DiscoverUpstreams lists the upstreams in order of preference, replacing
+// each SRV entry of UPSTREAM_PROXY with the targets of its records.
+func DiscoverUpstreams(ctx context.Context, cfg config.Config) []string {
+	addrs, _ := discoverUpstreams(ctx, cfg)
+	return addrs
+}
+
+// discoverUpstreams is DiscoverUpstreams, also returning when the SRV
+// records should be resolved again: after their shortest TTL, or after
+// DNS_CACHE_NEGATIVE_TTL if a lookup failed. Without SRV entries refresh is 0.
+func discoverUpstreams(ctx context.Context, cfg config.Config) (addrs []string, refresh time.Duration) {
+	d := newDialer(cfg)
+	for _, upstream := range cfg.Upstreams() {
+		name, ok := strings.CutPrefix(upstream, srvPrefix)
+		if !ok {
+			addrs = append(addrs, upstream)
+			continue
+		}
+		records, ttl, err := d.lookupSRV(ctx, name)
+		if err != nil {
+			Warn.Printf("Failed to discover upstreams from SRV record %s: %v", name, err)
+			ttl = cfg.DNSCacheNegTTL
+		}
+		for _, r := range orderSRV(records, rand.IntN) {
+			addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+		ttl = max(ttl, minSRVRefresh)
+		if refresh == 0 || ttl < refresh {
+			refresh = ttl
+		}
+	}
+	return addrs, refresh
+}
+
+// orderSRV sorts records by priority and, within a priority, in the weighted
+// random order of RFC 2782, so that heavier targets tend to come first.
+func orderSRV(records []*net.SRV, intN func(int) int) []*net.SRV {
+	records = slices.Clone(records)
+	slices.SortStableFunc(records, func(a, b *net.SRV) int { return int(a.Priority) - int(b.Priority) })
+	var ordered []*net.SRV
+	for len(records) > 0 {
+		end := 1
+		for end < len(records) && records[end].Priority == records[0].Priority {
+			end++
+		}
+		group := records[:end]
+		for len(group) > 0 {
+			total := 0
+			for _, r := range group {
+				total += int(r.Weight)
+			}
+			i := 0
+			if total > 0 {
+				for n := intN(total + 1); i < len(group)-1; i++ {
+					if n -= int(group[i].Weight); n <= 0 {
+						break
+					}
+				}
+			}
+			ordered = append(ordered, group[i])
+			group = slices.Delete(group, i, i+1)
+		}
+		records = records[end:]
+	}
+	return ordered
+}
+
+// lookupSRV resolves the SRV records of name like lookupHost, without
+// caching. With DNS servers the TTL of the records is returned, with the host
+// resolver DNS_CACHE_TTL.
+func (d *outboundDialer) lookupSRV(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+	d = d.routed(name)
+	if len(d.resolvers) == 0 {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		return records, d.cacheTTL, err
+	}
+	var errs []error
+	for _, r := range d.resolvers {
+		rec := &ttlRecorder{}
+		queryCtx, cancel := context.WithTimeout(withTTLRecorder(ctx, rec), d.dnsTimeout)
+		_, records, err := r.resolver.LookupSRV(queryCtx, "", "", name)
+		cancel()
+		if err == nil {
+			ttl, _ := rec.result()
+			return records, ttl, nil
+		}
+		if isNotFound(err) || ctx.Err() != nil {
+			return nil, 0, err
+		}
+		Warn.Printf("DNS server %s failed to resolve SRV %s, trying next: %v", r.server, name, err)
+		errs = append(errs, err)
+	}
+	return nil, 0, errors.Join(errs...)
+}
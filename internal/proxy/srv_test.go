@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "backup.", Priority: 20, Weight: 0},
+		{Target: "light.", Priority: 10, Weight: 10},
+		{Target: "heavy.", Priority: 10, Weight: 90},
+	}
+
+	tests := []struct {
+		pick     int
+		expected []string
+	}{
+		{pick: 5, expected: []string{"light.", "heavy.", "backup."}},
+		{pick: 50, expected: []string{"heavy.", "light.", "backup."}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, r := range orderSRV(records, func(int) int { return tt.pick }) {
+			got = append(got, r.Target)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("orderSRV with pick %d = %v; expected %v", tt.pick, got, tt.expected)
+		}
+	}
+}
+
+func TestDiscoverUpstreamsFromSRV(t *testing.T) {
+	server := serveDNS(t, func(q dnsmessage.Question) ([]dnsmessage.Resource, dnsmessage.RCode) {
+		if q.Type != dnsmessage.TypeSRV || q.Name.String() != "_proxy._tcp.corp.example." {
+			return nil, dnsmessage.RCodeNameError
+		}
+		srv := func(target string, priority uint16, ttl uint32) dnsmessage.Resource {
+			return dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.SRVResource{Priority: priority, Weight: 0, Port: 3128, Target: dnsmessage.MustNewName(target)},
+			}
+		}
+		return []dnsmessage.Resource{srv("proxy-b.corp.example.", 20, 300), srv("proxy-a.corp.example.", 10, 120)}, dnsmessage.RCodeSuccess
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.DNSServers = []string{server}
+	cfg.UpstreamProxy = "srv:_proxy._tcp.corp.example, static.proxy:8080, srv:_missing._tcp.corp.example"
+
+	addrs, refresh := discoverUpstreams(context.Background(), cfg)
+	expected := []string{"proxy-a.corp.example:3128", "proxy-b.corp.example:3128", "static.proxy:8080"}
+	if !reflect.DeepEqual(addrs, expected) {
+		t.Fatalf("discoverUpstreams = %v; expected %v", addrs, expected)
+	}
+	if refresh != cfg.DNSCacheNegTTL {
+		t.Fatalf("refresh = %v; expected the failed lookup to be retried after %v", refresh, cfg.DNSCacheNegTTL)
+	}
+
+	cfg.UpstreamProxy = "srv:_proxy._tcp.corp.example"
+	if _, refresh := discoverUpstreams(context.Background(), cfg); refresh != 2*time.Minute {
+		t.Fatalf("refresh = %v; expected the shortest record TTL", refresh)
+	}
+}
+
+func TestSameUpstreamsIgnoresOrder(t *testing.T) {
+	if !sameUpstreams([]string{"a:1", "b:1"}, []string{"b:1", "a:1"}) {
+		t.Errorf("expected reordered upstreams to be the same")
+	}
+	if sameUpstreams([]string{"a:1"}, []string{"a:1", "b:1"}) {
+		t.Errorf("expected an added upstream to differ")
+	}
+}
@@ -0,0 +1,371 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// rejectedHead replaces a request head that failed the strict checks. It is
+// not a valid request line, so net/http answers it with 400 Bad Request and
+// closes the connection, in order after any responses still being written.
+const rejectedHead = "REJECTED\r\n\r\n"
+
+// maxHeadSlack is how far a request head may exceed SERVER_MAX_HEADER_BYTES
+// before the strict checks give up on it; net/http allows the same slack and
+// then answers 431 itself.
+const maxHeadSlack = 4096
+
+// strictListener checks the requests on every accepted connection with
+// checkRequestHead before net/http sees them.
+type strictListener struct {
+	net.Listener
+	maxHeaderBytes int
+}
+
+func (l *strictListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newStrictConn(conn, l.maxHeaderBytes), nil
+}
+
+// States of a strictConn: where in the request stream it is.
+const (
+	stateHead = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateChunkEnd
+	stateTrailer
+	// stateOpaque passes everything through, e.g. tunnels after CONNECT.
+	stateOpaque
+)
+
+// strictConn follows the framing of the requests read from it, so that it
+// can check each request head before releasing it to net/http. Bodies are
+// passed through as they are.
+type strictConn struct {
+	net.Conn
+	r       *bufio.Reader
+	maxHead int
+
+	state     int
+	remaining int64
+	// line is the part of the current line read so far, head the lines of
+	// the current head, and pending what was checked but not read yet.
+	line    []byte
+	head    []byte
+	pending []byte
+	err     error
+}
+
+func newStrictConn(conn net.Conn, maxHeaderBytes int) *strictConn {
+	return &strictConn{Conn: conn, r: bufio.NewReader(conn), maxHead: maxHeaderBytes + maxHeadSlack}
+}
+
+// NetConn returns the wrapped connection.
+func (c *strictConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *strictConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		switch c.state {
+		case stateOpaque:
+			return c.r.Read(p)
+		case stateBody, stateChunkData:
+			if c.remaining == 0 && c.state == stateBody {
+				c.state = stateHead
+				continue
+			}
+			if c.remaining == 0 {
+				c.state = stateChunkEnd
+				continue
+			}
+			if int64(len(p)) > c.remaining {
+				p = p[:c.remaining]
+			}
+			n, err := c.r.Read(p)
+			c.remaining -= int64(n)
+			return n, err
+		default:
+			line, err := c.readLine()
+			if err != nil {
+				return 0, err
+			}
+			c.pending = c.handleLine(line)
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readLine returns the next line including its line ending. Partial lines
+// are kept across read timeouts, which net/http uses to interrupt its
+// background reads. A line too long to check is returned as is, and the
+// connection is passed through from then on.
+func (c *strictConn) readLine() ([]byte, error) {
+	for {
+		frag, err := c.r.ReadSlice('\n')
+		c.line = append(c.line, frag...)
+		switch {
+		case err == nil:
+		case errors.Is(err, bufio.ErrBufferFull) && len(c.head)+len(c.line) <= c.maxHead:
+			continue
+		case errors.Is(err, bufio.ErrBufferFull):
+			c.state = stateOpaque
+		default:
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return nil, err
+			}
+			// Let net/http see whatever arrived before the error.
+			c.err = err
+			c.state = stateOpaque
+		}
+		line := c.line
+		c.line = nil
+		return line, nil
+	}
+}
+
+// handleLine advances the state with line and returns the bytes to release.
+func (c *strictConn) handleLine(line []byte) []byte {
+	if c.state == stateOpaque {
+		head := append(c.head, line...)
+		c.head = nil
+		return head
+	}
+	switch c.state {
+	case stateHead:
+		c.head = append(c.head, line...)
+		if len(c.head) > c.maxHead {
+			c.state = stateOpaque
+			return c.handleLine(nil)
+		}
+		if len(c.head) == len(line) && string(line) == "\r\n" {
+			// Empty lines before a request line are allowed.
+			c.head = nil
+			return line
+		}
+		if string(line) != "\r\n" && string(line) != "\n" {
+			return nil
+		}
+		head := c.head
+		c.head = nil
+		framing, err := checkRequestHead(string(head))
+		if err != nil {
+			Warn.Printf("Rejecting request from %s: %v", logClient(c.RemoteAddr().String()), logError(err))
+			c.err = io.EOF
+			return []byte(rejectedHead)
+		}
+		switch {
+		case framing.opaque:
+			c.state = stateOpaque
+		case framing.chunked:
+			c.state = stateChunkSize
+		case framing.length > 0:
+			c.state, c.remaining = stateBody, framing.length
+		}
+		return head
+	case stateChunkSize:
+		size, _, _ := strings.Cut(strings.TrimSuffix(string(line), "\r\n"), ";")
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+		switch {
+		case err != nil || n < 0:
+			// net/http rejects the body itself.
+			c.state = stateOpaque
+		case n == 0:
+			c.state = stateTrailer
+		default:
+			c.state, c.remaining = stateChunkData, n
+		}
+	case stateChunkEnd:
+		c.state = stateChunkSize
+		if string(line) != "\r\n" {
+			c.state = stateOpaque
+		}
+	case stateTrailer:
+		if string(line) == "\r\n" {
+			c.state = stateHead
+		}
+	}
+	return line
+}
+
+// requestFraming is how the body of a request is delimited.
+type requestFraming struct {
+	length  int64
+	chunked bool
+	// opaque is set for requests after which the connection no longer
+	// carries HTTP requests, i.e. CONNECT and protocol upgrades.
+	opaque bool
+}
+
+// checkRequestHead rejects request heads that HTTP implementations are
+// known to disagree on, which is what request smuggling exploits: folded or
+// malformed header lines, bare CR or LF line endings, conflicting
+// Content-Length and Transfer-Encoding headers and request targets that
+// can be read in more than one way.
+func checkRequestHead(head string) (requestFraming, error) {
+	var framing requestFraming
+	lines := strings.SplitAfter(head, "\n")
+	// The last element is the empty string after the final line ending.
+	lines = lines[:len(lines)-1]
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "\r\n") {
+			return framing, errors.New("line not terminated by CRLF")
+		}
+		lines[i] = strings.TrimSuffix(line, "\r\n")
+		if strings.ContainsAny(lines[i], "\r\x00") {
+			return framing, errors.New("bare CR or NUL in request head")
+		}
+	}
+	lines = lines[:len(lines)-1]
+	if len(lines) == 0 {
+		return framing, errors.New("missing request line")
+	}
+
+	parts := strings.Split(lines[0], " ")
+	if len(parts) != 3 {
+		return framing, fmt.Errorf("malformed request line %q", lines[0])
+	}
+	method, target, version := parts[0], parts[1], parts[2]
+	if !isToken(method) {
+		return framing, fmt.Errorf("invalid method %q", method)
+	}
+	if version != "HTTP/1.1" && version != "HTTP/1.0" {
+		return framing, fmt.Errorf("unsupported version %q", version)
+	}
+	targetHost, err := checkRequestTarget(method, target)
+	if err != nil {
+		return framing, err
+	}
+
+	var hosts, lengths, encodings []string
+	upgrade := false
+	for _, line := range lines[1:] {
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			return framing, errors.New("folded header line")
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !isToken(name) {
+			return framing, fmt.Errorf("malformed header line %q", line)
+		}
+		value = strings.Trim(value, " \t")
+		switch strings.ToLower(name) {
+		case "host":
+			hosts = append(hosts, value)
+		case "content-length":
+			lengths = append(lengths, value)
+		case "transfer-encoding":
+			encodings = append(encodings, value)
+		case "upgrade":
+			upgrade = true
+		}
+	}
+
+	if len(hosts) > 1 {
+		return framing, errors.New("multiple Host headers")
+	}
+	if len(hosts) == 1 && targetHost != "" && !sameAuthority(hosts[0], targetHost, target) {
+		return framing, fmt.Errorf("Host header %q does not match request target %q", hosts[0], target)
+	}
+	switch {
+	case len(lengths) > 0 && len(encodings) > 0:
+		return framing, errors.New("both Content-Length and Transfer-Encoding")
+	case len(lengths) > 1:
+		return framing, errors.New("multiple Content-Length headers")
+	case len(lengths) == 1:
+		n, err := strconv.ParseInt(lengths[0], 10, 64)
+		if err != nil || n < 0 || strings.TrimLeft(lengths[0], "0123456789") != "" {
+			return framing, fmt.Errorf("invalid Content-Length %q", lengths[0])
+		}
+		framing.length = n
+	case len(encodings) > 1 || len(encodings) == 1 && !strings.EqualFold(encodings[0], "chunked"):
+		return framing, fmt.Errorf("unsupported Transfer-Encoding %q", strings.Join(encodings, ", "))
+	case len(encodings) == 1 && version == "HTTP/1.0":
+		return framing, errors.New("Transfer-Encoding in an HTTP/1.0 request")
+	case len(encodings) == 1:
+		framing.chunked = true
+	}
+	framing.opaque = method == "CONNECT" || upgrade
+	return framing, nil
+}
+
+// checkRequestTarget checks that target has the form method calls for and
+// returns the authority it names, if any.
+func checkRequestTarget(method, target string) (string, error) {
+	if strings.ContainsAny(target, "#\\") {
+		return "", fmt.Errorf("ambiguous request target %q", target)
+	}
+	for _, r := range target {
+		if r <= ' ' || r >= 0x7f {
+			return "", fmt.Errorf("invalid character in request target %q", target)
+		}
+	}
+	switch {
+	case method == "CONNECT":
+		if strings.ContainsAny(target, "/?@") {
+			return "", fmt.Errorf("CONNECT target %q is not host:port", target)
+		}
+		return target, nil
+	case target == "*":
+		if method != "OPTIONS" {
+			return "", fmt.Errorf("request target * for %s", method)
+		}
+		return "", nil
+	case strings.HasPrefix(target, "/"):
+		if strings.HasPrefix(target, "//") {
+			return "", fmt.Errorf("ambiguous request target %q", target)
+		}
+		return "", nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Opaque != "" {
+		return "", fmt.Errorf("malformed request target %q", target)
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("credentials in request target %q", target)
+	}
+	return u.Host, nil
+}
+
+// sameAuthority reports whether the Host header names the authority of an
+// absolute-form or CONNECT target, allowing for an omitted default port.
+func sameAuthority(host, authority, target string) bool {
+	trim := func(h string) string {
+		h = strings.ToLower(h)
+		switch {
+		case strings.HasPrefix(strings.ToLower(target), "http://"):
+			return strings.TrimSuffix(h, ":80")
+		case strings.HasPrefix(strings.ToLower(target), "https://"), !strings.Contains(target, "://"):
+			return strings.TrimSuffix(h, ":443")
+		}
+		return h
+	}
+	return trim(host) == trim(authority)
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r >= 0x7f || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
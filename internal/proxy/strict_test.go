@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestCheckRequestHead(t *testing.T) {
+	tests := []struct {
+		name    string
+		head    string
+		wantErr bool
+		framing requestFraming
+	}{
+		{"absolute form", "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\n\r\n", false, requestFraming{}},
+		{"default port", "GET http://example.com:80/ HTTP/1.1\r\nHost: example.com\r\n\r\n", false, requestFraming{}},
+		{"content length", "POST http://example.com/ HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\n", false, requestFraming{length: 5}},
+		{"chunked", "POST http://example.com/ HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: Chunked\r\n\r\n", false, requestFraming{chunked: true}},
+		{"connect", "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n", false, requestFraming{opaque: true}},
+		{"upgrade", "GET http://example.com/ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", false, requestFraming{opaque: true}},
+		{"origin form", "GET /proxy.pac HTTP/1.1\r\nHost: proxy\r\n\r\n", false, requestFraming{}},
+		{"options asterisk", "OPTIONS * HTTP/1.1\r\nHost: example.com\r\n\r\n", false, requestFraming{}},
+
+		{"length and chunked", "POST http://example.com/ HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n", true, requestFraming{}},
+		{"two lengths", "POST http://example.com/ HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\n", true, requestFraming{}},
+		{"signed length", "POST http://example.com/ HTTP/1.1\r\nHost: example.com\r\nContent-Length: +5\r\n\r\n", true, requestFraming{}},
+		{"gzip encoding", "POST http://example.com/ HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: gzip, chunked\r\n\r\n", true, requestFraming{}},
+		{"obfuscated encoding", "POST http://example.com/ HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: xchunked\r\n\r\n", true, requestFraming{}},
+		{"chunked HTTP/1.0", "POST http://example.com/ HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n", true, requestFraming{}},
+		{"folded header", "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\nX-Long: a\r\n b\r\n\r\n", true, requestFraming{}},
+		{"space before colon", "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\nContent-Length : 5\r\n\r\n", true, requestFraming{}},
+		{"bare LF", "GET http://example.com/ HTTP/1.1\nHost: example.com\r\n\r\n", true, requestFraming{}},
+		{"bare CR", "GET http://example.com/ HTTP/1.1\r\nHost: example.com\rX: y\r\n\r\n", true, requestFraming{}},
+		{"host mismatch", "GET http://example.com/ HTTP/1.1\r\nHost: internal.example\r\n\r\n", true, requestFraming{}},
+		{"two hosts", "GET /x HTTP/1.1\r\nHost: a\r\nHost: b\r\n\r\n", true, requestFraming{}},
+		{"userinfo", "GET http://internal@example.com/ HTTP/1.1\r\nHost: example.com\r\n\r\n", true, requestFraming{}},
+		{"fragment", "GET http://example.com/#x HTTP/1.1\r\nHost: example.com\r\n\r\n", true, requestFraming{}},
+		{"double slash", "GET //example.com/ HTTP/1.1\r\nHost: example.com\r\n\r\n", true, requestFraming{}},
+		{"connect path", "CONNECT example.com:443/x HTTP/1.1\r\n\r\n", true, requestFraming{}},
+		{"extra space", "GET  http://example.com/ HTTP/1.1\r\n\r\n", true, requestFraming{}},
+		{"HTTP/0.9", "GET http://example.com/ HTTP/0.9\r\n\r\n", true, requestFraming{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			framing, err := checkRequestHead(tt.head)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkRequestHead error = %v; expected error %v", err, tt.wantErr)
+			}
+			if err == nil && framing != tt.framing {
+				t.Errorf("checkRequestHead framing = %+v; expected %+v", framing, tt.framing)
+			}
+		})
+	}
+}
+
+func TestStrictHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+string(body))
+	}))
+	defer backend.Close()
+	host := strings.TrimPrefix(backend.URL, "http://")
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	send := func(raw string) []*http.Response {
+		t.Helper()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial proxy: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, raw)
+		var responses []*http.Response
+		r := bufio.NewReader(conn)
+		for {
+			resp, err := http.ReadResponse(r, nil)
+			if err != nil {
+				return responses
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body = io.NopCloser(strings.NewReader(string(body)))
+			responses = append(responses, resp)
+		}
+	}
+
+	// Pipelined requests with both kinds of bodies are framed correctly.
+	responses := send("POST http://" + host + "/ HTTP/1.1\r\nHost: " + host + "\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"3\r\nabc\r\n2;ext=1\r\nde\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+		"POST http://" + host + "/ HTTP/1.1\r\nHost: " + host + "\r\nContent-Length: 3\r\n\r\nxyz" +
+		"GET http://" + host + "/ HTTP/1.1\r\nHost: " + host + "\r\nConnection: close\r\n\r\n")
+	var got []string
+	for _, resp := range responses {
+		body, _ := io.ReadAll(resp.Body)
+		got = append(got, string(body))
+	}
+	if strings.Join(got, "|") != "POST abcde|POST xyz|GET " {
+		t.Errorf("pipelined responses = %q; expected the three requests answered in order", got)
+	}
+
+	// A smuggled request after an ambiguous one is never forwarded.
+	responses = send("POST http://" + host + "/ HTTP/1.1\r\nHost: " + host + "\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"0\r\n\r\nGET http://" + host + "/smuggled HTTP/1.1\r\nHost: " + host + "\r\n\r\n")
+	if len(responses) != 1 || responses[0].StatusCode != http.StatusBadRequest {
+		t.Fatalf("responses to Content-Length with Transfer-Encoding = %d; expected a single 400", len(responses))
+	}
+
+	// A bad request pipelined after a good one is answered after it.
+	responses = send("GET http://" + host + "/ HTTP/1.1\r\nHost: " + host + "\r\n\r\n" +
+		"GET http://" + host + "/ HTTP/1.1\r\nHost: " + host + "\r\nX-Folded: a\r\n b\r\n\r\n")
+	if len(responses) != 2 || responses[0].StatusCode != http.StatusOK || responses[1].StatusCode != http.StatusBadRequest {
+		t.Fatalf("responses to a good and a folded request = %d; expected 200 then 400", len(responses))
+	}
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Traffic is counted in minute buckets covering the longest window
+// reported, a day.
+const (
+	talkerBucket  = time.Minute
+	talkerBuckets = 24 * 60
+)
+
+// maxTalkersPerBucket bounds the clients and destinations counted
+// separately per minute; the traffic of further ones is counted as
+// talkerOther.
+const maxTalkersPerBucket = 1000
+
+const talkerOther = "(other)"
+
+// TalkerWindows are the windows TopTalkers reports on.
+var TalkerWindows = map[string]time.Duration{
+	"5m":  5 * time.Minute,
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+// Talker is the traffic of a client or destination over a window.
+type Talker struct {
+	Name     string `json:"name"`
+	Bytes    int64  `json:"bytes"`
+	Requests int64  `json:"requests"`
+}
+
+// TopTalkers are the clients and destinations with the most traffic over
+// a window.
+type TopTalkers struct {
+	Window       string   `json:"window"`
+	Bytes        int64    `json:"bytes"`
+	Requests     int64    `json:"requests"`
+	Clients      []Talker `json:"clients"`
+	Destinations []Talker `json:"destinations"`
+}
+
+type talkerCount struct {
+	bytes, requests int64
+}
+
+type talkerBucketCounts struct {
+	// minute is the minute, since the Unix epoch, the bucket counts.
+	minute       int64
+	clients      map[string]talkerCount
+	destinations map[string]talkerCount
+}
+
+// talkers aggregates the traffic of finished requests and tunnels per client
+// and destination host in a ring of minute buckets.
+type talkers struct {
+	mu      sync.Mutex
+	buckets [talkerBuckets]*talkerBucketCounts
+	now     func() time.Time
+}
+
+func newTalkers() *talkers {
+	return &talkers{now: time.Now}
+}
+
+func (t *talkers) add(client, destination string, bytes int64) {
+	minute := t.now().Unix() / int64(talkerBucket/time.Second)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := minute % talkerBuckets
+	b := t.buckets[i]
+	if b == nil || b.minute != minute {
+		b = &talkerBucketCounts{minute: minute, clients: make(map[string]talkerCount), destinations: make(map[string]talkerCount)}
+		t.buckets[i] = b
+	}
+	countTalker(b.clients, client, bytes)
+	countTalker(b.destinations, destination, bytes)
+}
+
+func countTalker(counts map[string]talkerCount, name string, bytes int64) {
+	if _, ok := counts[name]; !ok && len(counts) >= maxTalkersPerBucket {
+		name = talkerOther
+	}
+	c := counts[name]
+	c.bytes += bytes
+	c.requests++
+	counts[name] = c
+}
+
+// top returns the limit clients and destinations with the most bytes, or
+// requests if byRequests is set, over the window ending now.
+func (t *talkers) top(window string, limit int, byRequests bool) TopTalkers {
+	minutes := int64(TalkerWindows[window] / talkerBucket)
+	now := t.now().Unix() / int64(talkerBucket/time.Second)
+	clients := make(map[string]talkerCount)
+	destinations := make(map[string]talkerCount)
+	report := TopTalkers{Window: window}
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b == nil || b.minute <= now-minutes || b.minute > now {
+			continue
+		}
+		for name, c := range b.clients {
+			report.Bytes += c.bytes
+			report.Requests += c.requests
+			clients[name] = talkerCount{clients[name].bytes + c.bytes, clients[name].requests + c.requests}
+		}
+		for name, c := range b.destinations {
+			destinations[name] = talkerCount{destinations[name].bytes + c.bytes, destinations[name].requests + c.requests}
+		}
+	}
+	t.mu.Unlock()
+	report.Clients = topTalkers(clients, limit, byRequests)
+	report.Destinations = topTalkers(destinations, limit, byRequests)
+	return report
+}
+
+func topTalkers(counts map[string]talkerCount, limit int, byRequests bool) []Talker {
+	out := make([]Talker, 0, len(counts))
+	for name, c := range counts {
+		out = append(out, Talker{Name: name, Bytes: c.bytes, Requests: c.requests})
+	}
+	slices.SortFunc(out, func(a, b Talker) int {
+		if byRequests {
+			return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Name, b.Name))
+		}
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Name, b.Name))
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// TopTalkers reports the limit clients and destination hosts that
+// transferred the most bytes, or sent the most requests if byRequests is
+// set, over window, one of TalkerWindows.
+func (s *Server) TopTalkers(window string, limit int, byRequests bool) TopTalkers {
+	return s.talkers.top(window, limit, byRequests)
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTopTalkers(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tk := newTalkers()
+	tk.now = func() time.Time { return now }
+
+	tk.add("alice", "old.example", 5000)
+	now = now.Add(2 * time.Hour)
+	tk.add("bob", "hour.example", 3000)
+	now = now.Add(50 * time.Minute)
+	for range 3 {
+		tk.add("alice", "recent.example", 100)
+	}
+	tk.add("carol", "recent.example", 1000)
+
+	tests := []struct {
+		window       string
+		byRequests   bool
+		clients      string
+		destinations string
+		bytes        int64
+	}{
+		{"5m", false, "[carol alice]", "[recent.example]", 1300},
+		{"5m", true, "[alice carol]", "[recent.example]", 1300},
+		{"1h", false, "[bob carol]", "[hour.example recent.example]", 4300},
+		{"24h", false, "[alice bob]", "[old.example hour.example]", 9300},
+	}
+	names := func(talkers []Talker) string {
+		var out []string
+		for _, talker := range talkers {
+			out = append(out, talker.Name)
+		}
+		return fmt.Sprint(out)
+	}
+	for _, tt := range tests {
+		got := tk.top(tt.window, 2, tt.byRequests)
+		if names(got.Clients) != tt.clients || names(got.Destinations) != tt.destinations || got.Bytes != tt.bytes {
+			t.Errorf("top %s (by requests %v) = %s %s with %d bytes; expected %s %s with %d", tt.window, tt.byRequests, names(got.Clients), names(got.Destinations), got.Bytes, tt.clients, tt.destinations, tt.bytes)
+		}
+	}
+}
+
+func TestTopTalkersOverflow(t *testing.T) {
+	tk := newTalkers()
+	for i := range maxTalkersPerBucket + 5 {
+		tk.add(fmt.Sprintf("client-%d", i), "example.com", 1)
+	}
+	got := tk.top("5m", 0, true)
+	if len(got.Clients) != maxTalkersPerBucket+1 || got.Clients[0].Name != talkerOther || got.Clients[0].Requests != 5 {
+		t.Errorf("got %d clients, first %+v; expected the overflow counted as %s", len(got.Clients), got.Clients[0], talkerOther)
+	}
+}
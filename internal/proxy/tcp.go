@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// tuneTunnelConn applies the TCP_* socket options to one side of a CONNECT
+// tunnel. Options left at zero keep the operating system's defaults, and
+// connections that are not TCP, such as named pipes, are left alone.
+func tuneTunnelConn(conn net.Conn, cfg config.Config) {
+	tcp, ok := tcpConn(conn)
+	if !ok {
+		return
+	}
+	var errs []error
+	if cfg.TCPKeepAlive != 0 || cfg.TCPKeepAliveInterval != 0 || cfg.TCPKeepAliveCount != 0 {
+		errs = append(errs, tcp.SetKeepAliveConfig(net.KeepAliveConfig{
+			Enable:   cfg.TCPKeepAlive >= 0,
+			Idle:     cfg.TCPKeepAlive,
+			Interval: cfg.TCPKeepAliveInterval,
+			Count:    cfg.TCPKeepAliveCount,
+		}))
+	}
+	errs = append(errs, tcp.SetNoDelay(cfg.TCPNoDelay))
+	if cfg.TCPReadBuffer > 0 {
+		errs = append(errs, tcp.SetReadBuffer(cfg.TCPReadBuffer))
+	}
+	if cfg.TCPWriteBuffer > 0 {
+		errs = append(errs, tcp.SetWriteBuffer(cfg.TCPWriteBuffer))
+	}
+	if err := errors.Join(errs...); err != nil {
+		Warn.Printf("Failed to set TCP options on %s: %v", logClient(conn.RemoteAddr().String()), err)
+	}
+}
+
+// bufferedConn is a hijacked client connection whose first bytes, e.g. a
+// TLS ClientHello sent right after CONNECT without waiting for the answer,
+// were already read into the HTTP server's buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// withBuffered returns conn reading what r holds first, if anything.
+func withBuffered(conn net.Conn, r *bufio.Reader) net.Conn {
+	if r == nil || r.Buffered() == 0 {
+		return conn
+	}
+	return &bufferedConn{Conn: conn, r: r}
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	if c.r.Buffered() > 0 {
+		return c.r.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+// NetConn returns the wrapped connection.
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// idleConn is one side of a tunnel that is closed once neither side carried
+// data for timeout. Each read waits at most timeout, and a read that timed
+// out is retried as long as the other side was active in the meantime.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+	// active is when either side of the tunnel last read data, in Unix
+	// nanoseconds.
+	active *atomic.Int64
+}
+
+// withIdleTimeout applies TUNNEL_IDLE_TIMEOUT to both sides of a tunnel.
+func withIdleTimeout(client, backend net.Conn, cfg config.Config) (net.Conn, net.Conn) {
+	if cfg.TunnelIdleTimeout <= 0 {
+		return client, backend
+	}
+	active := new(atomic.Int64)
+	active.Store(time.Now().UnixNano())
+	return &idleConn{Conn: client, timeout: cfg.TunnelIdleTimeout, active: active},
+		&idleConn{Conn: backend, timeout: cfg.TunnelIdleTimeout, active: active}
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	for {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			return 0, err
+		}
+		n, err := c.Conn.Read(p)
+		if n > 0 {
+			c.active.Store(time.Now().UnixNano())
+		}
+		var ne net.Error
+		if n == 0 && errors.As(err, &ne) && ne.Timeout() && time.Since(time.Unix(0, c.active.Load())) < c.timeout {
+			continue
+		}
+		return n, err
+	}
+}
+
+// NetConn returns the wrapped connection.
+func (c *idleConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// tcpConn returns the TCP connection underneath conn, looking through TLS.
+func tcpConn(conn net.Conn) (*net.TCPConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// closeWrite shuts down the write side of conn, or of the first connection
+// underneath it that supports it, and reports whether that succeeded.
+func closeWrite(conn net.Conn) bool {
+	for {
+		switch c := conn.(type) {
+		case interface{ CloseWrite() error }:
+			return c.CloseWrite() == nil
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return false
+		}
+	}
+}
+
+// lingerReader resets the timer of a half-closed tunnel, if one is running,
+// whenever it reads data.
+type lingerReader struct {
+	io.Reader
+	linger  *atomic.Pointer[time.Timer]
+	timeout time.Duration
+}
+
+func (r *lingerReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if t := r.linger.Load(); t != nil && n > 0 {
+		t.Reset(r.timeout)
+	}
+	return n, err
+}
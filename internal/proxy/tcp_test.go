@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestTCPConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if got, ok := tcpConn(conn); !ok || got != conn {
+		t.Fatalf("tcpConn(*net.TCPConn) = %v, %t; expected the connection itself", got, ok)
+	}
+	if got, ok := tcpConn(tls.Client(conn, &tls.Config{})); !ok || got != conn {
+		t.Fatalf("tcpConn(*tls.Conn) = %v, %t; expected the underlying connection", got, ok)
+	}
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if _, ok := tcpConn(a); ok {
+		t.Fatal("tcpConn(net.Pipe) reported a TCP connection")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.TCPKeepAlive = 20 * time.Second
+	cfg.TCPKeepAliveInterval = 5 * time.Second
+	cfg.TCPKeepAliveCount = 3
+	cfg.TCPNoDelay = false
+	cfg.TCPReadBuffer = 256 << 10
+	cfg.TCPWriteBuffer = 256 << 10
+	tuneTunnelConn(conn, cfg)
+	tuneTunnelConn(a, cfg)
+}
+
+func TestTunnelIdleTimeout(t *testing.T) {
+	// The destination sends a byte every 50ms until told to stop.
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer echo.Close()
+	stop := make(chan struct{})
+	go func() {
+		c, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			select {
+			case <-stop:
+				time.Sleep(time.Second)
+				return
+			case <-time.After(50 * time.Millisecond):
+				if _, err := c.Write([]byte("x")); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	cfg.TunnelIdleTimeout = 200 * time.Millisecond
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	target := echo.Addr().String()
+	conn.Write([]byte("CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read CONNECT response: %v", err)
+	}
+
+	// Traffic in one direction keeps the tunnel open, although the client
+	// sends nothing for longer than the idle timeout.
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		if _, err := conn.Read(buf); err != nil {
+			t.Fatalf("tunnel closed while the destination was sending: %v", err)
+		}
+	}
+
+	close(stop)
+	idle := time.Now()
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	if elapsed := time.Since(idle); elapsed > 800*time.Millisecond {
+		t.Errorf("idle tunnel closed after %v; expected about 200ms", elapsed)
+	}
+}
+
+func TestTunnelPipelinedData(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	for _, strict := range []bool{true, false} {
+		cfg := config.DefaultConfig()
+		cfg.ProxyExceptions = []string{"*"}
+		cfg.StrictHTTP = strict
+		server := NewServer(cfg)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		go func() { _ = server.Serve(l) }()
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial proxy: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		// The client does not wait for the CONNECT response before sending
+		// its first bytes, as TLS clients with TCP fast open or false start
+		// may.
+		target := echo.Addr().String()
+		conn.Write([]byte("CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\nhello"))
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("CONNECT response: %v, %v", resp, err)
+		}
+		got := make([]byte, 5)
+		if _, err := io.ReadFull(r, got); err != nil || string(got) != "hello" {
+			t.Errorf("strict=%v: echoed %q, %v; expected the bytes sent with the CONNECT request", strict, got, err)
+		}
+	}
+}
+
+func TestTunnelHalfClose(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer backend.Close()
+	go func() {
+		c, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		// Answer only once the client has finished sending, as e.g. git
+		// does over some transports.
+		request, err := io.ReadAll(c)
+		if err != nil {
+			return
+		}
+		c.Write([]byte("received " + string(request)))
+	}()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	target := backend.Addr().String()
+	conn.Write([]byte("CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\n"))
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT response: %v, %v", resp, err)
+	}
+	conn.Write([]byte("request"))
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "received request" {
+		t.Errorf("read %q, %v after half-closing the tunnel; expected the backend's answer", got, err)
+	}
+}
+
+func TestTunnelHalfCloseTimeout(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer backend.Close()
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		c, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		// Neither answer nor close after the client is done.
+		defer c.Close()
+		<-release
+	}()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"*"}
+	cfg.TunnelHalfCloseTimeout = 100 * time.Millisecond
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	target := backend.Addr().String()
+	conn.Write([]byte("CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\n"))
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT response: %v, %v", resp, err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite: %v", err)
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Errorf("tunnel not closed after TUNNEL_HALF_CLOSE_TIMEOUT: %v", err)
+	}
+}
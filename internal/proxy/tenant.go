@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+type tenantKey struct{}
+
+// withTenant wraps next so that requests are served with the policy of
+// tenant.
+func withTenant(next http.Handler, tenant string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), tenantKey{}, tenant)))
+	})
+}
+
+// tenantOf returns the tenant of the listener req came in on, or "".
+func tenantOf(req *http.Request) string {
+	tenant, _ := req.Context().Value(tenantKey{}).(string)
+	return tenant
+}
+
+// stateFor returns the state to serve req with: that of the tenant of its
+// listener, if any.
+func (s *Server) stateFor(req *http.Request) *serverState {
+	state := s.state.Load()
+	if tenant, ok := state.tenants[tenantOf(req)]; ok {
+		return tenant
+	}
+	return state
+}
+
+// flowLogFor returns the flow log of requests to tenant.
+func (s *Server) flowLogFor(tenant string) *flowLog {
+	if tenant != "" {
+		if flows, ok := s.tenantFlows.Load(tenant); ok {
+			return flows.(*flowLog)
+		}
+	}
+	return s.flows.Load()
+}
+
+// SetTenantFlowLog makes the server write the flow records of requests to
+// the listeners of tenant to w rather than to the flow log set with
+// SetFlowLog. A nil w disables the flow log for the tenant.
+func (s *Server) SetTenantFlowLog(tenant string, w io.Writer) {
+	var flows *flowLog
+	if w != nil {
+		flows = &flowLog{w: w}
+	}
+	s.tenantFlows.Store(tenant, flows)
+}
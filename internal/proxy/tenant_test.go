@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestTenantListeners(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer backend.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ci upstream")
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.Tenants = []config.Tenant{{Name: "ci", Settings: map[string]string{
+		"UPSTREAM_PROXY":    upstream.Listener.Addr().String(),
+		"PROXY_EXCEPTIONS":  "",
+		"CLIENT_AUTH_USERS": "runner:token",
+	}}}
+	server := NewServer(cfg)
+	defer server.Close()
+	var flows, ciFlows syncBuffer
+	server.SetFlowLog(&flows)
+	server.SetTenantFlowLog("ci", &ciFlows)
+	serve := func(listener config.Listener) string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		go func() { _ = server.ServeListener(l, listener) }()
+		return l.Addr().String()
+	}
+	localhost := serve(config.Listener{})
+	ci := serve(config.Listener{Auth: true, Tenant: "ci"})
+
+	get := func(proxyURL *url.URL) (int, string) {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("GET via %s: %v", proxyURL.Host, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if status, body := get(&url.URL{Scheme: "http", Host: localhost}); body != "direct" {
+		t.Errorf("GET via the default listener = %d %q; expected it to go direct", status, body)
+	}
+	if status, _ := get(&url.URL{Scheme: "http", Host: ci}); status != http.StatusProxyAuthRequired {
+		t.Errorf("GET via the ci listener without credentials = %d; expected 407", status)
+	}
+	if status, body := get(&url.URL{Scheme: "http", Host: ci, User: url.UserPassword("alice", "s3cret")}); status != http.StatusProxyAuthRequired {
+		t.Errorf("GET via the ci listener as a user of another listener = %d %q; expected 407", status, body)
+	}
+	if status, body := get(&url.URL{Scheme: "http", Host: ci, User: url.UserPassword("runner", "token")}); body != "ci upstream" {
+		t.Errorf("GET via the ci listener = %d %q; expected it to go through the tenant's upstream", status, body)
+	}
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && len(ciFlows.lines()) == 0; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lines := flows.lines(); len(lines) != 1 {
+		t.Errorf("flow log = %q; expected only the request to the default listener", lines)
+	}
+	if lines := ciFlows.lines(); len(lines) != 1 {
+		t.Errorf("flow log of ci = %q; expected only the authenticated request to the ci listener", lines)
+	}
+}
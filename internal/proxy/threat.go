@@ -0,0 +1,471 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+const (
+	// threatFeedCheckInterval is how often feeds are checked for being due
+	// and feed files for changes.
+	threatFeedCheckInterval = time.Minute
+	// maxThreatFeedSize bounds the feeds read.
+	maxThreatFeedSize = 64 << 20
+)
+
+// ThreatFeedStats reports the state of one THREAT_FEEDS feed.
+type ThreatFeedStats struct {
+	Feed    string `json:"feed"`
+	Entries int    `json:"entries"`
+	// Hits counts the requests and tunnels to destinations the feed lists.
+	Hits int64 `json:"hits"`
+	// Updated is when the feed was last loaded or found unchanged.
+	Updated time.Time `json:"updated,omitzero"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// threatFeeds holds the THREAT_FEEDS feeds loaded so far, keyed by source.
+type threatFeeds struct {
+	client *http.Client
+	now    func() time.Time
+	notify func(event, subject, message string)
+
+	// refreshing serializes refresh.
+	refreshing sync.Mutex
+
+	mu    sync.RWMutex
+	feeds map[string]*threatFeed
+}
+
+type threatFeed struct {
+	// domains and prefixes are swapped under threatFeeds.mu; the other
+	// fields belong to refresh.
+	domains  map[string]struct{}
+	prefixes []netip.Prefix
+	updated  time.Time
+	err      string
+	hits     atomic.Int64
+
+	checked      time.Time
+	modTime      time.Time
+	etag         string
+	lastModified string
+}
+
+func newThreatFeeds() *threatFeeds {
+	return &threatFeeds{
+		client: &http.Client{Timeout: time.Minute},
+		now:    time.Now,
+		notify: func(string, string, string) {},
+		feeds:  make(map[string]*threatFeed),
+	}
+}
+
+// feedName names a feed in logs and stats without the credentials or API
+// keys its URL may carry.
+func feedName(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return source
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
+
+// refresh loads the feeds that are due: URLs every THREAT_FEED_INTERVAL and
+// files whenever they changed. A feed that fails to load keeps its previous
+// entries and is retried on the next call.
+func (t *threatFeeds) refresh(ctx context.Context, cfg config.Config) {
+	t.refreshing.Lock()
+	defer t.refreshing.Unlock()
+	t.mu.Lock()
+	configured := make(map[string]bool, len(cfg.ThreatFeeds))
+	for _, source := range cfg.ThreatFeeds {
+		configured[source] = true
+		if _, ok := t.feeds[source]; !ok {
+			t.feeds[source] = &threatFeed{}
+		}
+	}
+	for source := range t.feeds {
+		if !configured[source] {
+			delete(t.feeds, source)
+		}
+	}
+	feeds := make(map[string]*threatFeed, len(t.feeds))
+	for source, f := range t.feeds {
+		feeds[source] = f
+	}
+	t.mu.Unlock()
+
+	for source, f := range feeds {
+		now := t.now()
+		isURL := strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+		if isURL && f.err == "" && !f.checked.IsZero() && now.Sub(f.checked) < cfg.ThreatFeedInterval {
+			continue
+		}
+		f.checked = now
+		var data []byte
+		var err error
+		if isURL {
+			data, err = t.fetch(ctx, source, f)
+		} else {
+			data, err = readThreatFile(source, f)
+		}
+		var domains map[string]struct{}
+		var prefixes []netip.Prefix
+		if err == nil && data != nil {
+			domains, prefixes, err = parseThreatFeed(data, now)
+		}
+
+		t.mu.Lock()
+		switch {
+		case err != nil:
+			if f.err != err.Error() {
+				Warn.Printf("Failed to load threat feed %s: %v", feedName(source), err)
+			}
+			f.err = err.Error()
+		case data != nil:
+			f.domains, f.prefixes, f.updated, f.err = domains, prefixes, now, ""
+			Info.Printf("Loaded threat feed %s: %d entries", feedName(source), len(domains)+len(prefixes))
+		default:
+			f.updated, f.err = now, ""
+		}
+		t.mu.Unlock()
+	}
+}
+
+// fetch downloads a feed, returning nil data if it did not change since the
+// last download.
+func (t *threatFeeds) fetch(ctx context.Context, source string, f *threatFeed) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("server answered %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxThreatFeedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxThreatFeedSize {
+		return nil, fmt.Errorf("feed larger than %d bytes", maxThreatFeedSize)
+	}
+	f.etag, f.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return data, nil
+}
+
+// readThreatFile reads a feed file, returning nil data if it did not change
+// since it was last read.
+func readThreatFile(path string, f *threatFeed) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.ModTime().Equal(f.modTime) && f.err == "" {
+		return nil, nil
+	}
+	if info.Size() > maxThreatFeedSize {
+		return nil, fmt.Errorf("feed larger than %d bytes", maxThreatFeedSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f.modTime = info.ModTime()
+	return data, nil
+}
+
+// stixPattern matches the comparisons of a STIX indicator pattern that name
+// a destination, e.g. [domain-name:value = 'example.com'].
+var stixPattern = regexp.MustCompile(`(domain-name|ipv4-addr|ipv6-addr|url):value\s*=\s*'([^']*)'`)
+
+// sinkholes are the addresses hosts-file style feeds point listed names at.
+var sinkholes = map[string]bool{"0.0.0.0": true, "127.0.0.1": true, "::": true, "::1": true}
+
+// parseThreatFeed reads the domains, IP addresses and networks a feed lists.
+// It understands STIX 2 bundles of indicators (revoked and expired ones are
+// skipped) and line-based feeds: one entry per line, hosts files, and CSV,
+// of which the first column holding a domain, address, network or URL is
+// used. Lines starting with # or ; are comments.
+func parseThreatFeed(data []byte, now time.Time) (map[string]struct{}, []netip.Prefix, error) {
+	domains := make(map[string]struct{})
+	var prefixes []netip.Prefix
+	add := func(entry string) bool {
+		entry = strings.ToLower(strings.Trim(entry, "\"' "))
+		if strings.Contains(entry, "://") {
+			u, err := url.Parse(entry)
+			if err != nil {
+				return false
+			}
+			entry = u.Hostname()
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			return true
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.WithZone("").Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			return true
+		}
+		entry = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(entry, "*"), "."), ".")
+		if !isDomain(entry) {
+			return false
+		}
+		domains[entry] = struct{}{}
+		return true
+	}
+
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var bundle struct {
+			Objects []struct {
+				Type       string    `json:"type"`
+				Pattern    string    `json:"pattern"`
+				Revoked    bool      `json:"revoked"`
+				ValidUntil time.Time `json:"valid_until"`
+			} `json:"objects"`
+		}
+		if err := json.Unmarshal(trimmed, &bundle); err != nil {
+			return nil, nil, fmt.Errorf("invalid STIX bundle: %w", err)
+		}
+		for _, obj := range bundle.Objects {
+			if obj.Type != "indicator" || obj.Revoked || (!obj.ValidUntil.IsZero() && now.After(obj.ValidUntil)) {
+				continue
+			}
+			for _, m := range stixPattern.FindAllStringSubmatch(obj.Pattern, -1) {
+				add(m[2])
+			}
+		}
+		return domains, prefixes, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) > 1 && sinkholes[fields[0]] {
+			for _, name := range fields[1:] {
+				add(name)
+			}
+			continue
+		}
+		for _, field := range fields {
+			if add(field) {
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(domains) == 0 && len(prefixes) == 0 && len(bytes.TrimSpace(data)) > 0 {
+		return nil, nil, errors.New("no domains or addresses found")
+	}
+	return domains, prefixes, nil
+}
+
+// isDomain reports whether s looks like a domain name with at least two
+// labels, as opposed to the other columns of a CSV feed.
+func isDomain(s string) bool {
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	return strings.Trim(tld, "0123456789") != ""
+}
+
+// match returns the first feed listing host, its domain or one of its
+// parent domains, or the address it is or resolves to. Hosts left to the
+// upstream to resolve are only matched by name.
+func (t *threatFeeds) match(host string, cfg config.Config) (string, bool) {
+	if t == nil || len(cfg.ThreatFeeds) == 0 {
+		return "", false
+	}
+	name := strings.TrimSuffix(strings.ToLower(hostName(host)), ".")
+	addr, literal := literalAddr(host)
+	var addrs []netip.Addr
+	if literal {
+		addrs = []netip.Addr{addr}
+	}
+
+	t.mu.RLock()
+	listsAddrs := false
+	for _, source := range cfg.ThreatFeeds {
+		f := t.feeds[source]
+		if f == nil {
+			continue
+		}
+		listed := f.listsDomain(name)
+		if literal {
+			listed = f.listsAddr(addrs)
+		}
+		if listed {
+			t.mu.RUnlock()
+			f.hits.Add(1)
+			return feedName(source), true
+		}
+		listsAddrs = listsAddrs || len(f.prefixes) > 0
+	}
+	t.mu.RUnlock()
+	if literal || !listsAddrs || resolvesRemotely(host, cfg) {
+		return "", false
+	}
+
+	for _, resolved := range resolveName(name, cfg) {
+		if a, ok := literalAddr(resolved); ok {
+			addrs = append(addrs, a)
+		}
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, source := range cfg.ThreatFeeds {
+		if f := t.feeds[source]; f != nil && f.listsAddr(addrs) {
+			f.hits.Add(1)
+			return feedName(source), true
+		}
+	}
+	return "", false
+}
+
+func (f *threatFeed) listsDomain(name string) bool {
+	for {
+		if _, ok := f.domains[name]; ok {
+			return true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+}
+
+func (f *threatFeed) listsAddr(addrs []netip.Addr) bool {
+	for _, prefix := range f.prefixes {
+		for _, addr := range addrs {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snapshot reports the configured feeds in the order of THREAT_FEEDS.
+func (t *threatFeeds) snapshot(cfg config.Config) []ThreatFeedStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]ThreatFeedStats, 0, len(cfg.ThreatFeeds))
+	for _, source := range cfg.ThreatFeeds {
+		stats := ThreatFeedStats{Feed: feedName(source)}
+		if f := t.feeds[source]; f != nil {
+			stats.Entries = len(f.domains) + len(f.prefixes)
+			stats.Hits = f.hits.Load()
+			stats.Updated = f.updated
+			stats.Error = f.err
+		}
+		out = append(out, stats)
+	}
+	return out
+}
+
+// threatBlocked checks the destination of req against THREAT_FEEDS. Listed
+// destinations are flagged in the logs, the connection list and the flow
+// log and, with THREAT_FEED_ACTION=block, refused with 403 Forbidden, in
+// which case threatBlocked reports true.
+func threatBlocked(w http.ResponseWriter, req *http.Request, cfg config.Config, threats *threatFeeds, decisions *decisionCounts) bool {
+	feed, ok := threats.match(req.Host, cfg)
+	if !ok {
+		return false
+	}
+	trackedConnFrom(req).setThreat(feed)
+	client := logClient(usageClient(req))
+	if cfg.ThreatFeedAction != config.ThreatActionBlock {
+		Warn.Printf("Flagged %s %s from %s: listed in threat feed %s", req.Method, req.Host, client, feed)
+		threats.notify(EventThreatMatch, hostName(req.Host), fmt.Sprintf("Flagged %s from %s: listed in threat feed %s", req.Host, client, feed))
+		return false
+	}
+	Warn.Printf("Blocked %s %s from %s: listed in threat feed %s", req.Method, req.Host, client, feed)
+	threats.notify(EventThreatMatch, hostName(req.Host), fmt.Sprintf("Blocked %s from %s: listed in threat feed %s", req.Host, client, feed))
+	decisions.decide(w, routeBlocked, "threat:"+feed, cfg)
+	w.Header().Set(ErrorHeader, "threat-blocked")
+	http.Error(w, "Destination blocked", http.StatusForbidden)
+	return true
+}
+
+// runThreatFeeds keeps the THREAT_FEEDS feeds up to date until the server is
+// stopped.
+func (s *Server) runThreatFeeds() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), threatFeedCheckInterval)
+		s.threats.refresh(ctx, s.state.Load().cfg)
+		cancel()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(threatFeedCheckInterval):
+		}
+	}
+}
+
+// ThreatFeeds reports the entries, hits and last update of each THREAT_FEEDS
+// feed.
+func (s *Server) ThreatFeeds() []ThreatFeedStats {
+	return s.threats.snapshot(s.state.Load().cfg)
+}
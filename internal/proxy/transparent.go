@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// transparentPeekTimeout bounds how long a transparent connection waits for
+// the client's TLS ClientHello, which names the destination, before it is
+// tunneled to the original address. Protocols where the server speaks first
+// wait this long once.
+const transparentPeekTimeout = time.Second
+
+var (
+	errTransparentUnsupported = errors.New("transparent listeners are only supported on Linux")
+	errNotRedirected          = errors.New("connection was not redirected")
+)
+
+// transparentListener accepts the connections nftables or iptables redirect
+// to a transparent listener. Each one is handed to the proxy as a CONNECT to
+// its original destination, so that it is routed, logged and limited like
+// any other tunnel.
+type transparentListener struct {
+	net.Listener
+}
+
+func (l transparentListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		dst, err := originalDst(conn)
+		if err == nil && unmapped(dst) == unmapped(conn.LocalAddr().(*net.TCPAddr).AddrPort()) {
+			// Tunneling a connection made to the listener itself would
+			// loop back to it.
+			err = errNotRedirected
+		}
+		if err != nil {
+			Warn.Printf("Dropped connection from %s on transparent listener %s: %v", conn.RemoteAddr(), l.Addr(), err)
+			conn.Close()
+			continue
+		}
+		return &transparentConn{Conn: conn, dst: dst}, nil
+	}
+}
+
+func unmapped(addr netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+}
+
+// transparentConn presents a redirected connection to the proxy as a
+// CONNECT to dst followed by the client's data, and keeps the proxy's
+// response to the CONNECT from the client, who only sees the tunnel, or
+// the connection closed if it was refused.
+type transparentConn struct {
+	net.Conn
+	dst netip.AddrPort
+
+	started bool
+	pending []byte
+
+	head    []byte
+	passing bool
+	refused bool
+}
+
+func (c *transparentConn) Read(p []byte) (int, error) {
+	if !c.started {
+		c.started = true
+		c.pending = c.connectRequest()
+	}
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// connectRequest returns the CONNECT for the connection, followed by what
+// the client sent first. The destination is named by the server name of a
+// TLS ClientHello, so that PROXY_EXCEPTIONS and the other host patterns
+// match it, and by the original address otherwise.
+func (c *transparentConn) connectRequest() []byte {
+	peeked := c.peek()
+	host := c.dst.Addr().Unmap().String()
+	if hello, _ := parseClientHello(peeked); hello.serverName != "" {
+		host = hello.serverName
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(c.dst.Port())))
+	return append(fmt.Appendf(nil, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target), peeked...)
+}
+
+// peek reads until the client's first bytes tell whether a ClientHello
+// follows, and the whole ClientHello if so.
+func (c *transparentConn) peek() []byte {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(transparentPeekTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 0, 2048)
+	for len(buf) < maxClientHello {
+		if _, complete := parseClientHello(buf); complete {
+			break
+		}
+		if len(buf) == cap(buf) {
+			buf = append(buf, make([]byte, len(buf))...)[:len(buf)]
+		}
+		n, err := c.Conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err != nil {
+			break
+		}
+	}
+	return buf
+}
+
+var connectEstablished = []byte("HTTP/1.1 200 ")
+
+func (c *transparentConn) Write(p []byte) (int, error) {
+	if c.passing {
+		return c.Conn.Write(p)
+	}
+	if c.refused {
+		return len(p), nil
+	}
+	c.head = append(c.head, p...)
+	if !bytes.HasPrefix(c.head, connectEstablished[:min(len(c.head), len(connectEstablished))]) {
+		// The client cannot make sense of the proxy's error response.
+		c.refused, c.head = true, nil
+		c.Conn.Close()
+		return len(p), nil
+	}
+	end := bytes.Index(c.head, []byte("\r\n\r\n"))
+	if end < 0 {
+		return len(p), nil
+	}
+	c.passing = true
+	rest := c.head[end+4:]
+	c.head = nil
+	if len(rest) > 0 {
+		if _, err := c.Conn.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// NetConn returns the wrapped connection.
+func (c *transparentConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// soOriginalDst is SO_ORIGINAL_DST of <linux/netfilter_ipv4.h>, which has
+// the same value as IP6T_SO_ORIGINAL_DST for IPv6.
+const soOriginalDst = 80
+
+// originalDst returns the destination conn had before nftables or iptables
+// redirected it to the listener.
+func originalDst(conn net.Conn) (netip.AddrPort, error) {
+	tcp, ok := tcpConn(conn)
+	if !ok {
+		return netip.AddrPort{}, errors.New("not a TCP connection")
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	local := tcp.LocalAddr().(*net.TCPAddr).AddrPort().Addr()
+	var dst netip.AddrPort
+	if cerr := raw.Control(func(fd uintptr) {
+		if local.Unmap().Is4() {
+			// sockaddr_in fits the struct ip6_mreq returns.
+			var addr *syscall.IPv6Mreq
+			if addr, err = syscall.GetsockoptIPv6Mreq(int(fd), syscall.SOL_IP, soOriginalDst); err == nil {
+				b := addr.Multiaddr
+				dst = netip.AddrPortFrom(netip.AddrFrom4([4]byte(b[4:8])), binary.BigEndian.Uint16(b[2:4]))
+			}
+			return
+		}
+		// sockaddr_in6 fits the struct ip6_mtuinfo returns.
+		var info *syscall.IPv6MTUInfo
+		if info, err = syscall.GetsockoptIPv6MTUInfo(int(fd), syscall.SOL_IPV6, soOriginalDst); err == nil {
+			var port [2]byte
+			binary.NativeEndian.PutUint16(port[:], info.Addr.Port)
+			dst = netip.AddrPortFrom(netip.AddrFrom16(info.Addr.Addr), binary.BigEndian.Uint16(port[:]))
+		}
+	}); cerr != nil {
+		return netip.AddrPort{}, cerr
+	}
+	if errors.Is(err, syscall.ENOENT) {
+		// Connection tracking knows nothing about it.
+		return netip.AddrPort{}, errNotRedirected
+	}
+	return dst, err
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"net"
+	"net/netip"
+)
+
+// originalDst is only available on Linux.
+func originalDst(conn net.Conn) (netip.AddrPort, error) {
+	return netip.AddrPort{}, errTransparentUnsupported
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// redirectedListener hands out connections as transparentListener does
+// for connections redirected from dst.
+type redirectedListener struct {
+	net.Listener
+	dst netip.AddrPort
+}
+
+func (l redirectedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &transparentConn{Conn: conn, dst: l.dst}, nil
+}
+
+func TestTransparentConn(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	_, backendPort, _ := net.SplitHostPort(backend.Listener.Addr().String())
+
+	cfg := config.DefaultConfig()
+	cfg.DirectOnly = true
+	cfg.HostMap = map[string]string{"sni.test": "127.0.0.1"}
+	redirect := func(dst string) net.Conn {
+		t.Helper()
+		server := NewServer(cfg)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		go func() { _ = server.Serve(redirectedListener{Listener: l, dst: netip.MustParseAddrPort(dst)}) }()
+		t.Cleanup(func() { server.Close() })
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	// Data passes through without the proxy's response to the CONNECT.
+	conn := redirect(echo.Addr().String())
+	io.WriteString(conn, "hello\n")
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello\n" {
+		t.Errorf("read %q, %v through the tunnel; expected the echo", buf, err)
+	}
+
+	// TLS clients are tunneled to the server they name.
+	conn = redirect("192.0.2.1:" + backendPort)
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "sni.test", InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		t.Errorf("TLS handshake through the tunnel to sni.test: %v", err)
+	}
+
+	// Refused connections are closed without the proxy's error response.
+	conn = redirect(deadAddr(t))
+	io.WriteString(conn, "hello\n")
+	if data, err := io.ReadAll(conn); len(data) != 0 || err != nil {
+		t.Errorf("refused connection read %q, %v; expected it closed", data, err)
+	}
+}
+
+func TestTransparentListenerDropsDirectConnections(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("transparent listeners need Linux")
+	}
+	server := NewServer(config.DefaultConfig())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.ServeListener(l, config.Listener{Addr: l.Addr().String(), Transparent: true}) }()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "CONNECT "+l.Addr().String()+" HTTP/1.1\r\n\r\n")
+	if data, err := io.ReadAll(conn); len(data) != 0 || err != nil {
+		t.Errorf("direct connection read %q, %v; expected it dropped", data, err)
+	}
+}
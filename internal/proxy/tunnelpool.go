@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// tunnelPool keeps a spare CONNECT tunnel to destinations that are
+// connected to repeatedly through the same upstream, for at most
+// TUNNEL_POOL_IDLE, and hands it to the next client connecting to them.
+// Tunnels that carried a client's traffic are never reused: the
+// destination's end of them holds the state of that client's session. It
+// outlives configuration reloads, but its spares are closed with the idle
+// connections of the old configuration.
+type tunnelPool struct {
+	mu      sync.Mutex
+	spares  map[tunnelKey]*spareTunnel
+	dialing map[tunnelKey]bool
+	// recent is when each destination was last connected to.
+	recent map[tunnelKey]time.Time
+}
+
+type tunnelKey struct {
+	upstream, target string
+}
+
+type spareTunnel struct {
+	conn  net.Conn
+	timer *time.Timer
+}
+
+// maxTunnelPoolRecent bounds the destinations remembered as recently
+// connected to before the ones older than TUNNEL_POOL_IDLE are swept.
+const maxTunnelPoolRecent = 4096
+
+// tunnelAliveProbe is how long take waits for a spare tunnel's destination
+// to show that it closed the connection.
+const tunnelAliveProbe = time.Millisecond
+
+func newTunnelPool() *tunnelPool {
+	return &tunnelPool{
+		spares:  make(map[tunnelKey]*spareTunnel),
+		dialing: make(map[tunnelKey]bool),
+		recent:  make(map[tunnelKey]time.Time),
+	}
+}
+
+// take returns the spare tunnel to target through upstream, or nil if there
+// is none or the destination has closed it.
+func (p *tunnelPool) take(upstream, target string) net.Conn {
+	if p == nil {
+		return nil
+	}
+	key := tunnelKey{upstream, target}
+	p.mu.Lock()
+	spare := p.spares[key]
+	delete(p.spares, key)
+	p.mu.Unlock()
+	if spare == nil || !spare.timer.Stop() {
+		return nil
+	}
+	return aliveTunnel(spare.conn)
+}
+
+// aliveTunnel returns conn unless reading from it shows that it was
+// closed. Data the destination already sent, such as a banner, is kept.
+func aliveTunnel(conn net.Conn) net.Conn {
+	if err := conn.SetReadDeadline(time.Now().Add(tunnelAliveProbe)); err != nil {
+		conn.Close()
+		return nil
+	}
+	br := bufio.NewReader(conn)
+	_, err := br.Peek(1)
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) || conn.SetReadDeadline(time.Time{}) != nil {
+		conn.Close()
+		return nil
+	}
+	return withBuffered(conn, br)
+}
+
+// used records a tunnel opened to target through upstream. If the
+// destination was connected to within TUNNEL_POOL_IDLE before, a spare
+// tunnel to it is opened in the background.
+func (p *tunnelPool) used(upstream, target string, cfg config.Config) {
+	if p == nil || cfg.TunnelPoolIdle <= 0 {
+		return
+	}
+	key := tunnelKey{upstream, target}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.recent) >= maxTunnelPoolRecent {
+		for k, last := range p.recent {
+			if now.Sub(last) > cfg.TunnelPoolIdle {
+				delete(p.recent, k)
+			}
+		}
+	}
+	last, ok := p.recent[key]
+	p.recent[key] = now
+	if !ok || now.Sub(last) > cfg.TunnelPoolIdle || p.spares[key] != nil || p.dialing[key] {
+		return
+	}
+	p.dialing[key] = true
+	go p.open(key, cfg)
+}
+
+func (p *tunnelPool) open(key tunnelKey, cfg config.Config) {
+	conn, err := DialViaUpstream(key.upstream, key.target, cfg)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.dialing, key)
+	if err != nil {
+		return
+	}
+	spare := &spareTunnel{conn: conn}
+	spare.timer = time.AfterFunc(cfg.TunnelPoolIdle, func() {
+		p.mu.Lock()
+		if p.spares[key] == spare {
+			delete(p.spares, key)
+		}
+		p.mu.Unlock()
+		conn.Close()
+	})
+	p.spares[key] = spare
+}
+
+// closeAll closes all spare tunnels.
+func (p *tunnelPool) closeAll() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, spare := range p.spares {
+		if spare.timer.Stop() {
+			spare.conn.Close()
+		}
+		delete(p.spares, key)
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestTunnelPool(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer upstream.Close()
+	var connects, closed atomic.Int32
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+					return
+				}
+				fmt.Fprintf(conn, "HTTP/1.1 200 Connection Established\r\n\r\nbanner-%d", connects.Add(1))
+				io.Copy(io.Discard, conn)
+				closed.Add(1)
+			}()
+		}
+	}()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = upstream.Addr().String()
+	cfg.TunnelPoolIdle = 5 * time.Second
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	connect := func() string {
+		client, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial proxy: %v", err)
+		}
+		defer client.Close()
+		fmt.Fprint(client, "CONNECT example.test:443 HTTP/1.1\r\nHost: example.test:443\r\n\r\n")
+		br := bufio.NewReader(client)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("CONNECT failed: %v %v", resp, err)
+		}
+		banner := make([]byte, len("banner-1"))
+		if _, err := io.ReadFull(br, banner); err != nil {
+			t.Fatalf("read banner: %v", err)
+		}
+		return string(banner)
+	}
+	waitFor := func(what string, n func() int, expected int) {
+		for deadline := time.Now().Add(2 * time.Second); n() != expected; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d %s; expected %d", n(), what, expected)
+			}
+		}
+	}
+	spares := func() int {
+		server.tunnels.mu.Lock()
+		defer server.tunnels.mu.Unlock()
+		return len(server.tunnels.spares)
+	}
+	closes := func() int { return int(closed.Load()) }
+
+	if got := connect(); got != "banner-1" {
+		t.Fatalf("first tunnel read %q", got)
+	}
+	if got := connect(); got != "banner-2" {
+		t.Fatalf("second tunnel read %q", got)
+	}
+	// The repeated destination gets a spare tunnel, which the next client
+	// is handed along with what the destination sent on it.
+	waitFor("spare tunnels", spares, 1)
+	if got := connect(); got != "banner-3" {
+		t.Errorf("third tunnel read %q; expected the spare tunnel", got)
+	}
+
+	waitFor("spare tunnels", spares, 1)
+	waitFor("tunnels closed", closes, 3)
+	server.SetConfig(cfg)
+	waitFor("tunnels closed after a reload", closes, 4)
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// errUpstreamsExcluded is returned for destinations UPSTREAM_EXCEPTIONS
+// keeps away from every upstream.
+var errUpstreamsExcluded = errors.New("every upstream is excluded for the destination")
+
+// withUpstreamExceptions returns t without the upstreams UPSTREAM_EXCEPTIONS
+// keeps req's destination away from. It applies to whichever upstreams the
+// routing before it picked, including those of UPSTREAM_PAC and the canary.
+func (t requestTransports) withUpstreamExceptions(req *http.Request, cfg config.Config) requestTransports {
+	if len(cfg.UpstreamExceptions) == 0 {
+		return t
+	}
+	upstreams := make([]upstreamTransport, 0, len(t.upstreams))
+	for _, u := range t.upstreams {
+		if !config.ExcludesUpstream(req.Host, u.addr, cfg.UpstreamExceptions) {
+			upstreams = append(upstreams, u)
+		}
+	}
+	t.upstreams = upstreams
+	return t
+}
+
+// errNoUpstream is the error of a request that no upstream was tried for.
+func (t requestTransports) errNoUpstream() error {
+	if len(t.upstreams) == 0 {
+		return errUpstreamsExcluded
+	}
+	return errCircuitOpen
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestUpstreamExceptions(t *testing.T) {
+	upstream := func(name string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.Listener.Addr().String()
+	}
+	a, b := upstream("a"), upstream("b")
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = a + "," + b
+	cfg.UpstreamExceptions = []config.UpstreamException{
+		{Pattern: "*.partner.test", Upstream: a},
+		{Pattern: "secret.test", Upstream: a},
+		{Pattern: "secret.test", Upstream: b},
+	}
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+	proxyURL, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	tests := []struct {
+		url      string
+		status   int
+		expected string
+	}{
+		{"http://example.test/", http.StatusOK, "a"},
+		{"http://api.partner.test/", http.StatusOK, "b"},
+		{"http://secret.test/", http.StatusBadGateway, "upstream-excluded"},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		got := string(body)
+		if resp.StatusCode != http.StatusOK {
+			got = resp.Header.Get(ErrorHeader)
+		}
+		if resp.StatusCode != tt.status || got != tt.expected {
+			t.Errorf("GET %s = %d %q; expected %d %q", tt.url, resp.StatusCode, got, tt.status, tt.expected)
+		}
+	}
+}
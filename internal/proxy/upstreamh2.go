@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+
+	"golang.org/x/net/http2"
+)
+
+// upstreamH2 holds the HTTP/2 connections to secure upstream proxies that
+// CONNECT tunnels are multiplexed over, one per upstream address.
+var upstreamH2 = &h2Pool{conns: map[string]*http2.ClientConn{}}
+
+type h2Pool struct {
+	mu    sync.Mutex
+	conns map[string]*http2.ClientConn
+}
+
+// get returns a connection to the https:// upstream addr that can take
+// another tunnel. If the upstream does not negotiate HTTP/2, it returns the
+// new TLS connection instead, for a CONNECT over HTTP/1.1.
+func (p *h2Pool) get(ctx context.Context, addr string, cfg config.Config) (*http2.ClientConn, net.Conn, error) {
+	p.mu.Lock()
+	cc := p.conns[addr]
+	p.mu.Unlock()
+	if cc != nil && cc.CanTakeNewRequest() {
+		return cc, nil, nil
+	}
+	conn, err := dialUpstreamTLS(ctx, addr, cfg, []string{http2.NextProtoTLS, "http/1.1"})
+	if err != nil {
+		return nil, nil, err
+	}
+	if conn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		return nil, conn, nil
+	}
+	t := &http2.Transport{IdleConnTimeout: cfg.TransportIdleConnTimeout}
+	cc, err = t.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to start HTTP/2 with upstream %s: %w", addr, err)
+	}
+	p.mu.Lock()
+	p.conns[addr] = cc
+	p.mu.Unlock()
+	return cc, nil, nil
+}
+
+// connectH2 opens a tunnel to target as a stream of cc, the HTTP/2
+// connection to an upstream proxy.
+func connectH2(cc *http2.ClientConn, target string, cfg config.Config) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	req := &http.Request{
+		Method:        http.MethodConnect,
+		URL:           &url.URL{Host: target},
+		Host:          target,
+		Header:        http.Header{"Via": {viaValue(2, 0)}},
+		Body:          pr,
+		ContentLength: -1,
+	}
+	timer := time.AfterFunc(cfg.TunnelConnectReadWriteTimeout, cancel)
+	resp, err := cc.RoundTrip(req.WithContext(ctx))
+	if err != nil || !timer.Stop() {
+		cancel()
+		pw.Close()
+		if err == nil {
+			resp.Body.Close()
+			err = context.DeadlineExceeded
+		}
+		return nil, fmt.Errorf("bad CONNECT response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		cancel()
+		pw.Close()
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusProxyAuthRequired {
+			return nil, fmt.Errorf("%w: %w", errUpstreamRejected, errUpstreamAuth)
+		}
+		return nil, fmt.Errorf("%w: %s", errUpstreamRejected, resp.Status)
+	}
+	return newH2Conn(resp.Body, pw, cancel), nil
+}
+
+// h2Conn is a tunnel over an HTTP/2 stream: what is written to it is sent
+// as the request body, and the response body is read from it. Reads go
+// through a net.Pipe, so that they honour the deadlines idle tunnels are
+// closed with; writes block until the stream takes the data.
+type h2Conn struct {
+	net.Conn
+	pw     *io.PipeWriter
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func newH2Conn(body io.ReadCloser, pw *io.PipeWriter, cancel context.CancelFunc) *h2Conn {
+	local, remote := net.Pipe()
+	go func() {
+		_, _ = io.Copy(remote, body)
+		remote.Close()
+	}()
+	return &h2Conn{Conn: local, pw: pw, body: body, cancel: cancel}
+}
+
+func (c *h2Conn) Write(b []byte) (int, error) {
+	return c.pw.Write(b)
+}
+
+// CloseWrite ends the request body, which half-closes the tunnel.
+func (c *h2Conn) CloseWrite() error {
+	return c.pw.Close()
+}
+
+// Close resets the stream; the HTTP/2 connection stays open for other
+// tunnels.
+func (c *h2Conn) Close() error {
+	c.once.Do(func() {
+		c.pw.Close()
+		c.body.Close()
+		c.cancel()
+	})
+	return c.Conn.Close()
+}
+
+// SetWriteDeadline is not supported: writes are bounded by HTTP/2 flow
+// control instead.
+func (c *h2Conn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *h2Conn) SetDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(t)
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestUpstreamHTTP2Tunnels(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.ProtoMajor != 2 {
+			http.Error(w, "expected an HTTP/2 CONNECT", http.StatusBadRequest)
+			return
+		}
+		if r.Host == "denied.test:443" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		rc.Flush()
+		buf := make([]byte, 1024)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				w.Write(buf[:n])
+				rc.Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}))
+	var conns atomic.Int32
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = "https://" + upstream.Listener.Addr().String()
+	cfg.UpstreamTLSCA = ca
+	cfg.UpstreamHTTP2 = true
+
+	var tunnels []net.Conn
+	for _, msg := range []string{"first", "second", "third"} {
+		conn, err := DialViaUpstream(cfg.UpstreamProxy, "example.test:443", cfg)
+		if err != nil {
+			t.Fatalf("CONNECT over HTTP/2: %v", err)
+		}
+		defer conn.Close()
+		tunnels = append(tunnels, conn)
+		if _, err := io.WriteString(conn, msg); err != nil {
+			t.Fatalf("write to tunnel: %v", err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != msg {
+			t.Fatalf("tunnel echoed %q, %v; expected %q", buf, err, msg)
+		}
+	}
+	if !closeWrite(tunnels[0]) {
+		t.Fatal("failed to half-close the tunnel")
+	}
+	if data, err := io.ReadAll(tunnels[0]); err != nil || len(data) != 0 {
+		t.Errorf("read after half-close = %q, %v; expected EOF", data, err)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connections to the upstream; expected the tunnels to share one", n)
+	}
+
+	if conn, err := DialViaUpstream(cfg.UpstreamProxy, "denied.test:443", cfg); !errors.Is(err, errUpstreamAuth) {
+		if conn != nil {
+			conn.Close()
+		}
+		t.Errorf("CONNECT answered with 407 = %v; expected an upstream auth error", err)
+	}
+}
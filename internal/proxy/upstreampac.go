@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/pac"
+)
+
+const (
+	// upstreamPACCheckInterval is how often UPSTREAM_PAC is checked for
+	// being due and, for a file, for changes.
+	upstreamPACCheckInterval = time.Minute
+	// maxUpstreamPACSize bounds the PAC file read.
+	maxUpstreamPACSize = 4 << 20
+)
+
+// upstreamPAC holds the corporate PAC file of UPSTREAM_PAC, which picks the
+// upstreams to try, or DIRECT, per destination while clients keep using
+// this proxy alone.
+type upstreamPAC struct {
+	client *http.Client
+	now    func() time.Time
+
+	script atomic.Pointer[pac.Script]
+
+	// refreshing serializes refresh, to which the other fields belong.
+	refreshing sync.Mutex
+	source     string
+	checked    time.Time
+	modTime    time.Time
+	etag       string
+	err        string
+}
+
+func newUpstreamPAC() *upstreamPAC {
+	return &upstreamPAC{
+		client: &http.Client{Timeout: time.Minute},
+		now:    time.Now,
+	}
+}
+
+// refresh loads UPSTREAM_PAC if it is due: a URL every
+// UPSTREAM_PAC_INTERVAL and a file whenever it changed. If it fails to load
+// or parse, the script loaded before stays in effect.
+func (p *upstreamPAC) refresh(ctx context.Context, cfg config.Config) {
+	p.refreshing.Lock()
+	defer p.refreshing.Unlock()
+	if cfg.UpstreamPAC != p.source {
+		p.source, p.checked, p.modTime, p.etag, p.err = cfg.UpstreamPAC, time.Time{}, time.Time{}, "", ""
+		p.script.Store(nil)
+	}
+	if p.source == "" {
+		return
+	}
+	now := p.now()
+	isURL := strings.HasPrefix(p.source, "http://") || strings.HasPrefix(p.source, "https://")
+	if isURL && p.err == "" && !p.checked.IsZero() && now.Sub(p.checked) < cfg.UpstreamPACInterval {
+		return
+	}
+	p.checked = now
+	var data []byte
+	var err error
+	if isURL {
+		data, err = p.fetch(ctx)
+	} else {
+		data, err = p.readFile()
+	}
+	var script *pac.Script
+	if err == nil && data != nil {
+		script, err = pac.Parse(string(data))
+	}
+	switch {
+	case err != nil:
+		if p.err != err.Error() {
+			Warn.Printf("Failed to load upstream PAC %s: %v", feedName(p.source), err)
+		}
+		p.err = err.Error()
+	case script != nil:
+		script.Alert = func(message string) { Info.Printf("Upstream PAC alert: %s", message) }
+		p.script.Store(script)
+		p.err = ""
+		Info.Printf("Loaded upstream PAC %s", feedName(p.source))
+	default:
+		p.err = ""
+	}
+}
+
+// fetch downloads the PAC file, returning nil data if it did not change
+// since the last download.
+func (p *upstreamPAC) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.etag != "" && p.script.Load() != nil {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("server answered %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamPACSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUpstreamPACSize {
+		return nil, fmt.Errorf("PAC file larger than %d bytes", maxUpstreamPACSize)
+	}
+	p.etag = resp.Header.Get("ETag")
+	return data, nil
+}
+
+// readFile reads the PAC file, returning nil data if it did not change since
+// it was last read.
+func (p *upstreamPAC) readFile() ([]byte, error) {
+	info, err := os.Stat(p.source)
+	if err != nil {
+		return nil, err
+	}
+	if info.ModTime().Equal(p.modTime) && p.err == "" {
+		return nil, nil
+	}
+	if info.Size() > maxUpstreamPACSize {
+		return nil, fmt.Errorf("PAC file larger than %d bytes", maxUpstreamPACSize)
+	}
+	data, err := os.ReadFile(p.source)
+	if err != nil {
+		return nil, err
+	}
+	p.modTime = info.ModTime()
+	return data, nil
+}
+
+// resolvePAC resolves host for dnsResolve and isInNet the way the direct
+// dialer would, preferring IPv4 as PAC files expect.
+func resolvePAC(host string, cfg config.Config) (string, bool) {
+	addrs := resolveName(host, cfg)
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			return addr, true
+		}
+	}
+	if len(addrs) == 0 {
+		return "", false
+	}
+	return addrs[0], true
+}
+
+// route evaluates the PAC file for req, resolving names as cfg, the
+// configuration req is handled with, does. It returns false if there is no
+// PAC file loaded or it failed for req.
+func (p *upstreamPAC) route(req *http.Request, cfg config.Config) ([]pac.Proxy, bool) {
+	if p == nil {
+		return nil, false
+	}
+	loaded := p.script.Load()
+	if loaded == nil {
+		return nil, false
+	}
+	// The hooks of a Script are fixed once it is used, so DNS_SERVERS and
+	// HOST_MAP are applied to a copy of it.
+	script := *loaded
+	script.Resolve = func(host string) (string, bool) { return resolvePAC(host, cfg) }
+	url := req.URL.String()
+	if req.Method == http.MethodConnect {
+		// Browsers pass only the origin of https URLs.
+		url = "https://" + strings.TrimSuffix(req.Host, ":443") + "/"
+	}
+	result, err := script.FindProxyForURL(url, hostName(req.Host))
+	if err != nil {
+		Warn.Printf("Upstream PAC failed for %s, using the configured upstreams: %v", req.Host, err)
+		return nil, false
+	}
+	return pac.ParseResult(result), true
+}
+
+// withPAC returns t with the upstreams UPSTREAM_PAC lists for req, unless
+// an exception already sends req direct or APP_ROUTES routes it, and with
+// pacRouted set. If the PAC file lists DIRECT first, pacDirect is set
+// instead; if it lists DIRECT after its proxies, pacFailOpen is. Without a
+// usable answer, t is returned unchanged.
+func (t requestTransports) withPAC(req *http.Request, cfg config.Config) requestTransports {
+	if cfg.UpstreamPAC == "" || t.appRoute != "" || t.pac == nil || t.pac.script.Load() == nil || Decide(req.Host, cfg).Direct() {
+		return t
+	}
+	proxies, ok := t.pac.route(req, cfg)
+	if !ok {
+		return t
+	}
+	var upstreams []upstreamTransport
+	for _, p := range proxies {
+		switch p.Type {
+		case "DIRECT":
+			if len(upstreams) == 0 {
+				t.pacDirect = true
+				return t
+			}
+			t.pacFailOpen = true
+		case "PROXY", "HTTP":
+			upstreams = append(upstreams, t.pacUpstream(p.Addr, cfg))
+		case "HTTPS":
+			upstreams = append(upstreams, t.pacUpstream("https://"+p.Addr, cfg))
+		case "SOCKS", "SOCKS4":
+			// Browsers take SOCKS to mean SOCKS4 as well.
+			upstreams = append(upstreams, t.pacUpstream("socks4://"+p.Addr, cfg))
+		}
+		if t.pacFailOpen {
+			break
+		}
+	}
+	if len(upstreams) == 0 {
+		Warn.Printf("Upstream PAC returned no usable proxy for %s (%v), using the configured upstreams", req.Host, proxies)
+		return t
+	}
+	t.upstreams = upstreams
+	t.pacRouted = true
+	return t
+}
+
+// pacUpstream returns the transport for a proxy the PAC file named: the
+// configured one if it is an upstream anyway, or one made on first use.
+func (t requestTransports) pacUpstream(addr string, cfg config.Config) upstreamTransport {
+	for _, u := range t.upstreams {
+		if u.addr == addr {
+			return u
+		}
+	}
+	if u, ok := t.pacUpstreams.Load(addr); ok {
+		return u.(upstreamTransport)
+	}
+	u, _ := t.pacUpstreams.LoadOrStore(addr, upstreamTransport{addr: addr, transport: newUpstreamTransport(cfg, addr)})
+	return u.(upstreamTransport)
+}
+
+// failsOpen reports whether host may fall back to a direct connection when
+// the upstreams cannot be reached, by FAIL_OPEN or the PAC file.
+func (t requestTransports) failsOpen(host string, cfg config.Config) bool {
+	return canFailOpen(host, cfg) || t.pacFailOpen && !resolvesRemotely(host, cfg)
+}
+
+// runUpstreamPAC keeps UPSTREAM_PAC up to date until the server is stopped.
+func (s *Server) runUpstreamPAC() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), upstreamPACCheckInterval)
+		s.pac.refresh(ctx, s.state.Load().cfg)
+		cancel()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(upstreamPACCheckInterval):
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestUpstreamPACRoutes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(backend.Listener.Addr().String())
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	deadAddr := dead.Addr().String()
+	dead.Close()
+
+	configured, sales := fakeUpstream(t, "configured"), fakeUpstream(t, "sales")
+	script := fmt.Sprintf(`function FindProxyForURL(url, host) {
+  if (dnsDomainIs(host, ".sales.test")) return "PROXY %[1]s; PROXY %[2]s";
+  if (host == "fallback.test") return "PROXY %[1]s; DIRECT";
+  if (host == "socks.test") return "SOCKS5 %[2]s";
+  return "DIRECT";
+}`, deadAddr, sales)
+	path := filepath.Join(t.TempDir(), "corp.pac")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = configured
+	cfg.UpstreamPAC = path
+	cfg.HostMap = map[string]string{"fallback.test": "127.0.0.1", "intranet.test": "127.0.0.1"}
+	server := NewServer(cfg)
+	server.pac.refresh(context.Background(), cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"http://crm.sales.test/", "sales"},
+		{"http://fallback.test:" + port + "/", "direct"},
+		{"http://intranet.test:" + port + "/", "direct"},
+		{"http://socks.test/", "configured"},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.target)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.target, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.expected {
+			t.Errorf("GET %s went %q; expected %q", tt.target, body, tt.expected)
+		}
+	}
+}
+
+func TestUpstreamPACRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corp.pac")
+	write := func(script string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.UpstreamPAC = path
+	route := func(p *upstreamPAC) string {
+		proxies, ok := p.route(httptest.NewRequest(http.MethodConnect, "a.test:443", nil), cfg)
+		if !ok {
+			return "none"
+		}
+		return fmt.Sprint(proxies)
+	}
+	p := newUpstreamPAC()
+	start := time.Now().Add(-time.Hour)
+
+	write(`function FindProxyForURL(url, host) { return url == "https://a.test/" ? "PROXY one:1" : "DIRECT"; }`, start)
+	p.refresh(context.Background(), cfg)
+	if got := route(p); got != "[PROXY one:1]" {
+		t.Fatalf("route = %s; expected PROXY one:1 for the origin of the CONNECT target", got)
+	}
+
+	write(`function FindProxyForURL(url, host) { return "PROXY two:2" `, start.Add(time.Minute))
+	p.refresh(context.Background(), cfg)
+	if got := route(p); got != "[PROXY one:1]" {
+		t.Errorf("route after a broken update = %s; expected the previous script to stay", got)
+	}
+
+	write(`function FindProxyForURL(url, host) { return "PROXY two:2"; }`, start.Add(2*time.Minute))
+	p.refresh(context.Background(), cfg)
+	if got := route(p); got != "[PROXY two:2]" {
+		t.Errorf("route after a fix = %s; expected PROXY two:2", got)
+	}
+
+	cfg.UpstreamPAC = ""
+	p.refresh(context.Background(), cfg)
+	if got := route(p); got != "none" {
+		t.Errorf("route without UPSTREAM_PAC = %s; expected none", got)
+	}
+}
+
+func TestUpstreamPACURL(t *testing.T) {
+	requests := 0
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, `function FindProxyForURL(url, host) { return "PROXY corp:8080"; }`)
+	}))
+	defer pacServer.Close()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := config.DefaultConfig()
+	cfg.UpstreamPAC = pacServer.URL + "/proxy.pac"
+	p := newUpstreamPAC()
+	p.now = func() time.Time { return now }
+
+	p.refresh(context.Background(), cfg)
+	p.refresh(context.Background(), cfg)
+	if requests != 1 {
+		t.Errorf("PAC requested %d times within UPSTREAM_PAC_INTERVAL; expected once", requests)
+	}
+	now = now.Add(cfg.UpstreamPACInterval)
+	p.refresh(context.Background(), cfg)
+	if requests != 2 {
+		t.Errorf("PAC requested %d times; expected again after UPSTREAM_PAC_INTERVAL", requests)
+	}
+	proxies, ok := p.route(httptest.NewRequest(http.MethodGet, "http://a.test/", nil), cfg)
+	if !ok || len(proxies) != 1 || !strings.EqualFold(proxies[0].String(), "PROXY corp:8080") {
+		t.Errorf("route = %v, %v; expected the script to survive 304 Not Modified", proxies, ok)
+	}
+}
+
+func TestUpstreamPACResolvesWithCurrentConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corp.pac")
+	script := `function FindProxyForURL(url, host) {
+  if (!isResolvable(host)) return "DIRECT";
+  return "PROXY " + dnsResolve(host) + ":8080";
+}`
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.UpstreamPAC = path
+	cfg.HostMap = map[string]string{"a.test": "10.0.0.1"}
+	p := newUpstreamPAC()
+	p.refresh(context.Background(), cfg)
+
+	// A reload changes HOST_MAP, but not the PAC file.
+	cfg.HostMap = map[string]string{"a.test": "10.0.0.2"}
+	proxies, ok := p.route(httptest.NewRequest(http.MethodGet, "http://a.test/", nil), cfg)
+	if !ok || fmt.Sprint(proxies) != "[PROXY 10.0.0.2:8080]" {
+		t.Errorf("route = %v, %v; expected the address HOST_MAP maps a.test to now", proxies, ok)
+	}
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// splitUpstream returns the host:port of an upstream address and whether
+// the upstream is spoken to over TLS: https://host[:port] is, host:port,
+// http://host[:port] and SOCKS upstreams are not.
+func splitUpstream(addr string) (hostport string, useTLS bool) {
+	if s, ok := parseSOCKSUpstream(addr); ok {
+		return s.hostport, false
+	}
+	port := "80"
+	if rest, ok := strings.CutPrefix(addr, "https://"); ok {
+		addr, useTLS, port = rest, true, "443"
+	} else if rest, ok := strings.CutPrefix(addr, "http://"); ok {
+		addr = rest
+	} else {
+		return addr, false
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), port)
+	}
+	return addr, useTLS
+}
+
+// dialUpstreamConn connects to the upstream addr, completing the TLS
+// handshake for https:// upstreams.
+func dialUpstreamConn(ctx context.Context, addr string, cfg config.Config) (net.Conn, error) {
+	hostport, useTLS := splitUpstream(addr)
+	if useTLS {
+		return dialUpstreamTLS(ctx, addr, cfg, nil)
+	}
+	return newUpstreamDialer(cfg, hostport).DialContext(ctx, "tcp", hostport)
+}
+
+// dialUpstreamTLS connects to the https:// upstream addr, offering the
+// application protocols nextProtos.
+func dialUpstreamTLS(ctx context.Context, addr string, cfg config.Config, nextProtos []string) (*tls.Conn, error) {
+	hostport, _ := splitUpstream(addr)
+	conn, err := newUpstreamDialer(cfg, hostport).DialContext(ctx, "tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := upstreamTLSConfig(hostport, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConfig.NextProtos = nextProtos
+	tlsConn := tls.Client(conn, tlsConfig)
+	if cfg.TransportTLSHandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.TransportTLSHandshakeTimeout)
+		defer cancel()
+	}
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with upstream %s failed: %w", hostport, err)
+	}
+	return tlsConn, nil
+}
+
+// upstreamTLSConfig returns the TLS configuration for the https:// upstream
+// at hostport: verified against UPSTREAM_TLS_CA, or the system roots, and
+// presenting the client certificate UPSTREAM_TLS_CERT and UPSTREAM_TLS_KEY
+// to upstreams that require mutual TLS.
+func upstreamTLSConfig(hostport string, cfg config.Config) (*tls.Config, error) {
+	host, _, _ := net.SplitHostPort(hostport)
+	tlsConfig := &tls.Config{ServerName: host}
+	if cfg.UpstreamTLSCA != "" {
+		roots, err := upstreamCAs.load(cfg.UpstreamTLSCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if cfg.UpstreamTLSCert != "" || cfg.UpstreamTLSKey != "" {
+		cert, err := upstreamCerts.load(cfg.UpstreamTLSCert, cfg.UpstreamTLSKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+	return tlsConfig, nil
+}
+
+// upstreamCerts and upstreamCAs keep the parsed UPSTREAM_TLS_CERT and
+// UPSTREAM_TLS_CA files, read again once they change on disk, so that
+// renewed certificates are picked up without a restart.
+var (
+	upstreamCerts = &fileCache[*tls.Certificate]{parse: func(paths []string) (*tls.Certificate, error) {
+		if paths[0] == "" || paths[1] == "" {
+			return nil, errors.New("UPSTREAM_TLS_CERT and UPSTREAM_TLS_KEY must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(paths[0], paths[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the upstream client certificate: %w", err)
+		}
+		return &cert, nil
+	}}
+	upstreamCAs = &fileCache[*x509.CertPool]{parse: func(paths []string) (*x509.CertPool, error) {
+		data, err := os.ReadFile(paths[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read UPSTREAM_TLS_CA: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates in UPSTREAM_TLS_CA %s", paths[0])
+		}
+		return roots, nil
+	}}
+)
+
+// fileCache holds the result of parsing a set of files until one of them
+// is modified or the paths change.
+type fileCache[T any] struct {
+	parse func(paths []string) (T, error)
+
+	mu       sync.Mutex
+	paths    string
+	modTimes []time.Time
+	value    T
+}
+
+func (c *fileCache[T]) load(paths ...string) (T, error) {
+	modTimes := make([]time.Time, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	key := strings.Join(paths, "\x00")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paths == key && slices.EqualFunc(c.modTimes, modTimes, time.Time.Equal) {
+		return c.value, nil
+	}
+	value, err := c.parse(paths)
+	if err != nil {
+		return value, err
+	}
+	c.paths, c.modTimes, c.value = key, modTimes, value
+	return value, nil
+}
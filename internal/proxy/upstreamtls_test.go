@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestSplitUpstream(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+		useTLS   bool
+	}{
+		{"proxy:3128", "proxy:3128", false},
+		{"http://proxy:3128", "proxy:3128", false},
+		{"http://proxy", "proxy:80", false},
+		{"https://proxy:8443/", "proxy:8443", true},
+		{"https://proxy", "proxy:443", true},
+		{"https://[2001:db8::1]", "[2001:db8::1]:443", true},
+	}
+	for _, tt := range tests {
+		if got, useTLS := splitUpstream(tt.addr); got != tt.expected || useTLS != tt.useTLS {
+			t.Errorf("splitUpstream(%q) = %q, %v; expected %q, %v", tt.addr, got, useTLS, tt.expected, tt.useTLS)
+		}
+	}
+}
+
+func TestUpstreamMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	writePEM := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dynamicproxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, _ := x509.ParseCertificate(der)
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCert)
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			io.WriteString(w, "forwarded")
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\ntunneled")
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.UpstreamProxy = "https://" + upstream.Listener.Addr().String()
+	cfg.UpstreamTLSCert = writePEM("client.pem", "CERTIFICATE", der)
+	cfg.UpstreamTLSKey = writePEM("client-key.pem", "PRIVATE KEY", keyDER)
+	cfg.UpstreamTLSCA = writePEM("ca.pem", "CERTIFICATE", upstream.Certificate().Raw)
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+	proxyURL, _ := url.Parse(srv.URL)
+	resp, err := (&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}).Get("http://example.test/")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "forwarded" {
+		t.Errorf("GET through the mutual TLS upstream = %d %q; expected it forwarded", resp.StatusCode, body)
+	}
+
+	conn, err := DialViaUpstream(cfg.UpstreamProxy, "example.test:443", cfg)
+	if err != nil {
+		t.Fatalf("CONNECT through the mutual TLS upstream: %v", err)
+	}
+	data, _ := io.ReadAll(conn)
+	conn.Close()
+	if string(data) != "tunneled" {
+		t.Errorf("tunnel read %q; expected tunneled", data)
+	}
+
+	cfg.UpstreamTLSCert, cfg.UpstreamTLSKey = "", ""
+	if conn, err := DialViaUpstream(cfg.UpstreamProxy, "example.test:443", cfg); err == nil {
+		conn.Close()
+		t.Error("CONNECT without a client certificate succeeded")
+	}
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// Usage is counted in hourly buckets covering the longest window reported.
+const (
+	usageBucket  = time.Hour
+	usageBuckets = 30 * 24
+)
+
+// ClientUsage reports the bytes a client transferred, in both directions,
+// over rolling windows ending now.
+type ClientUsage struct {
+	Client        string `json:"client"`
+	LastHour      int64  `json:"lastHour"`
+	LastDay       int64  `json:"lastDay"`
+	Last30Days    int64  `json:"last30Days"`
+	QuotaExceeded bool   `json:"quotaExceeded,omitempty"`
+}
+
+// usageTracker accounts the traffic of each client, identified by its
+// authenticated user or else its IP address. Connections are accounted when
+// they finish.
+type usageTracker struct {
+	mu      sync.Mutex
+	clients map[string]*clientUsage
+	now     func() time.Time
+}
+
+type clientUsage struct {
+	bytes [usageBuckets]int64
+	// hours holds the hour, since the Unix epoch, each bucket counts.
+	hours [usageBuckets]int64
+}
+
+type clientUserKey struct{}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{clients: make(map[string]*clientUsage), now: time.Now}
+}
+
+// usageClient returns the name req's traffic is accounted to.
+func usageClient(req *http.Request) string {
+	if user, ok := req.Context().Value(clientUserKey{}).(string); ok {
+		return user
+	}
+	return clientIP(req)
+}
+
+func withClientUser(req *http.Request, user string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), clientUserKey{}, user))
+}
+
+func (t *usageTracker) add(client string, n int64) {
+	if n <= 0 {
+		return
+	}
+	hour := t.now().Unix() / int64(usageBucket/time.Second)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.clients[client]
+	if u == nil {
+		u = &clientUsage{}
+		t.clients[client] = u
+	}
+	i := hour % usageBuckets
+	if u.hours[i] != hour {
+		u.hours[i], u.bytes[i] = hour, 0
+	}
+	u.bytes[i] += n
+}
+
+// total returns the bytes of the last hours hours. t.mu must be held.
+func (u *clientUsage) total(now int64, hours int64) int64 {
+	var total int64
+	for i, hour := range u.hours {
+		if hour > now-hours && hour <= now {
+			total += u.bytes[i]
+		}
+	}
+	return total
+}
+
+func (t *usageTracker) usage(client string, u *clientUsage, cfg config.Config) ClientUsage {
+	now := t.now().Unix() / int64(usageBucket/time.Second)
+	usage := ClientUsage{
+		Client:     client,
+		LastHour:   u.total(now, 1),
+		LastDay:    u.total(now, 24),
+		Last30Days: u.total(now, usageBuckets),
+	}
+	usage.QuotaExceeded = (cfg.ClientQuotaDaily > 0 && usage.LastDay >= cfg.ClientQuotaDaily) ||
+		(cfg.ClientQuotaMonthly > 0 && usage.Last30Days >= cfg.ClientQuotaMonthly)
+	return usage
+}
+
+// overQuota reports whether client has used up CLIENT_QUOTA_DAILY or
+// CLIENT_QUOTA_MONTHLY.
+func (t *usageTracker) overQuota(client string, cfg config.Config) bool {
+	if cfg.ClientQuotaDaily <= 0 && cfg.ClientQuotaMonthly <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.clients[client]
+	return u != nil && t.usage(client, u, cfg).QuotaExceeded
+}
+
+// snapshot returns the usage of every client with traffic in the last 30
+// days, heaviest first, and forgets the others.
+func (t *usageTracker) snapshot(cfg config.Config) []ClientUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]ClientUsage, 0, len(t.clients))
+	for client, u := range t.clients {
+		usage := t.usage(client, u, cfg)
+		if usage.Last30Days == 0 {
+			delete(t.clients, client)
+			continue
+		}
+		out = append(out, usage)
+	}
+	slices.SortFunc(out, func(a, b ClientUsage) int {
+		return cmp.Or(cmp.Compare(b.Last30Days, a.Last30Days), cmp.Compare(a.Client, b.Client))
+	})
+	return out
+}
+
+// ClientUsage reports the traffic of each client over rolling windows.
+func (s *Server) ClientUsage() []ClientUsage {
+	return s.usage.snapshot(s.state.Load().cfg)
+}
+
+func writeQuotaExceeded(w http.ResponseWriter, req *http.Request, client string) {
+	Warn.Printf("Rejected %s %s from %s: quota exceeded", req.Method, req.Host, logClient(client))
+	w.Header().Set(ErrorHeader, "quota-exceeded")
+	http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestUsageTrackerWindows(t *testing.T) {
+	tracker := newUsageTracker()
+	now := time.Date(2026, 10, 15, 12, 30, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	cfg := config.DefaultConfig()
+
+	at := func(ago time.Duration, client string, n int64) {
+		now = now.Add(-ago)
+		tracker.add(client, n)
+		now = now.Add(ago)
+	}
+	at(0, "10.0.0.1", 1)
+	at(2*time.Hour, "10.0.0.1", 10)
+	at(3*24*time.Hour, "10.0.0.1", 100)
+	at(40*24*time.Hour, "10.0.0.1", 1000)
+	at(0, "alice", 5)
+
+	got := tracker.snapshot(cfg)
+	expected := []ClientUsage{
+		{Client: "10.0.0.1", LastHour: 1, LastDay: 11, Last30Days: 111},
+		{Client: "alice", LastHour: 5, LastDay: 5, Last30Days: 5},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("snapshot = %+v; expected %+v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("snapshot[%d] = %+v; expected %+v", i, got[i], expected[i])
+		}
+	}
+
+	// A month later the clients are forgotten.
+	now = now.Add(31 * 24 * time.Hour)
+	if got := tracker.snapshot(cfg); len(got) != 0 || len(tracker.clients) != 0 {
+		t.Errorf("snapshot a month later = %+v; expected none", got)
+	}
+}
+
+func TestUsageTrackerQuota(t *testing.T) {
+	tracker := newUsageTracker()
+	cfg := config.DefaultConfig()
+	tracker.add("10.0.0.1", 100)
+
+	tests := []struct {
+		daily, monthly int64
+		expected       bool
+	}{
+		{0, 0, false},
+		{200, 0, false},
+		{100, 0, true},
+		{0, 100, true},
+		{200, 1000, false},
+	}
+	for _, tt := range tests {
+		cfg.ClientQuotaDaily, cfg.ClientQuotaMonthly = tt.daily, tt.monthly
+		if got := tracker.overQuota("10.0.0.1", cfg); got != tt.expected {
+			t.Errorf("overQuota(daily=%d, monthly=%d) = %v; expected %v", tt.daily, tt.monthly, got, tt.expected)
+		}
+	}
+	if tracker.overQuota("10.0.0.2", cfg) {
+		t.Errorf("overQuota for a client without traffic = true")
+	}
+}
+
+func TestServerEnforcesQuota(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 1000))
+	}))
+	defer backend.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.ProxyExceptions = []string{"127.0.0.1"}
+	cfg.ClientQuotaDaily = 500
+	server := NewServer(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()})}}
+
+	get := func() *http.Response {
+		t.Helper()
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := get(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first GET status = %d; expected 200", resp.StatusCode)
+	}
+	// The first request is accounted once its handler has returned.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.ClientUsage()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("first request was not accounted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	usage := server.ClientUsage()
+	if usage[0].Client != "127.0.0.1" || usage[0].LastDay < 1000 || !usage[0].QuotaExceeded {
+		t.Fatalf("usage = %+v; expected 127.0.0.1 over its quota", usage)
+	}
+	resp := get()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get(ErrorHeader) != "quota-exceeded" {
+		t.Fatalf("GET over quota = %d %q; expected 429 quota-exceeded", resp.StatusCode, resp.Header.Get(ErrorHeader))
+	}
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+// Events sent to WEBHOOK_URL.
+const (
+	EventUpstreamUnhealthy = "upstream-unhealthy"
+	EventUpstreamHealthy   = "upstream-healthy"
+	EventUpstreamDemoted   = "upstream-demoted"
+	EventAuthFailures      = "auth-failures"
+	EventConfigReloaded    = "config-reloaded"
+	EventQuotaExceeded     = "quota-exceeded"
+	EventThreatMatch       = "threat-match"
+	EventMemoryPressure    = "memory-pressure"
+)
+
+const (
+	// webhookCooldown is how long repeats of an event about the same
+	// subject (an upstream, a client) are held back, so that a flapping
+	// upstream or a client hammering its quota does not flood the channel.
+	webhookCooldown = 15 * time.Minute
+	// webhookTimeout bounds each delivery.
+	webhookTimeout = 10 * time.Second
+	// maxQueuedWebhooks bounds the events waiting for delivery; further
+	// events are dropped.
+	maxQueuedWebhooks = 64
+	// authFailureWindow is the window WEBHOOK_AUTH_FAILURES counts in.
+	authFailureWindow = time.Minute
+)
+
+// webhookEvent is the JSON body of a generic webhook.
+type webhookEvent struct {
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host,omitempty"`
+}
+
+// notifier delivers events to the configured webhooks in the background.
+type notifier struct {
+	cfg    func() config.Config
+	client *http.Client
+	now    func() time.Time
+	done   <-chan struct{}
+
+	startOnce sync.Once
+	queue     chan webhookEvent
+
+	mu            sync.Mutex
+	sent          map[string]time.Time
+	authFailures  int
+	authWindowEnd time.Time
+}
+
+func newNotifier(cfg func() config.Config, done <-chan struct{}) *notifier {
+	return &notifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: webhookTimeout},
+		now:    time.Now,
+		done:   done,
+		queue:  make(chan webhookEvent, maxQueuedWebhooks),
+		sent:   make(map[string]time.Time),
+	}
+}
+
+// notify queues event for delivery. Events with a subject are dropped if the
+// same event about the same subject was sent within webhookCooldown.
+func (n *notifier) notify(event, subject, message string) {
+	cfg := n.cfg()
+	if len(cfg.WebhookURLs) == 0 || (len(cfg.WebhookEvents) > 0 && !slices.Contains(cfg.WebhookEvents, event)) {
+		return
+	}
+	now := n.now()
+	if subject != "" {
+		key := event + " " + subject
+		n.mu.Lock()
+		last, ok := n.sent[key]
+		if ok && now.Sub(last) < webhookCooldown {
+			n.mu.Unlock()
+			return
+		}
+		n.sent[key] = now
+		for k, t := range n.sent {
+			if now.Sub(t) >= webhookCooldown {
+				delete(n.sent, k)
+			}
+		}
+		n.mu.Unlock()
+	}
+
+	n.startOnce.Do(func() { go n.run() })
+	host, _ := os.Hostname()
+	select {
+	case n.queue <- webhookEvent{Event: event, Message: message, Time: now.UTC(), Host: host}:
+	default:
+		Warn.Printf("Dropped %s webhook: too many queued", event)
+	}
+}
+
+// authFailure counts a rejected proxy authentication and raises
+// EventAuthFailures when WEBHOOK_AUTH_FAILURES are reached within a minute.
+func (n *notifier) authFailure(client string) {
+	threshold := n.cfg().WebhookAuthFailures
+	if threshold <= 0 {
+		return
+	}
+	now := n.now()
+	n.mu.Lock()
+	if !now.Before(n.authWindowEnd) {
+		n.authFailures, n.authWindowEnd = 0, now.Add(authFailureWindow)
+	}
+	n.authFailures++
+	spike := n.authFailures == threshold
+	n.mu.Unlock()
+	if spike {
+		n.notify(EventAuthFailures, "", fmt.Sprintf("%d failed proxy authentications within a minute, the latest from %s", threshold, logClient(client)))
+	}
+}
+
+func (n *notifier) run() {
+	for {
+		select {
+		case <-n.done:
+			return
+		case event := <-n.queue:
+			cfg := n.cfg()
+			for _, target := range cfg.WebhookURLs {
+				if err := n.deliver(target, event, cfg); err != nil {
+					Warn.Printf("Failed to deliver %s webhook: %v", event.Event, err)
+				}
+			}
+		}
+	}
+}
+
+// deliver posts event to target. Errors name only the host of target, since
+// webhook URLs carry their secret in the path.
+func (n *notifier) deliver(target string, event webhookEvent, cfg config.Config) error {
+	var body any = event
+	if cfg.WebhookFormat == config.WebhookFormatSlack {
+		text := "DynamicProxy: " + event.Message
+		if event.Host != "" {
+			text = fmt.Sprintf("DynamicProxy on %s: %s", event.Host, event.Message)
+		}
+		body = map[string]string{"text": text}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	host := target
+	if u, err := url.Parse(target); err == nil {
+		host = u.Host
+	}
+	resp, err := n.client.Post(target, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", host, resp.Status)
+	}
+	return nil
+}
+
+// Notify sends event to the configured webhooks, e.g. EventConfigReloaded
+// from the admin API.
+func (s *Server) Notify(event, message string) {
+	s.webhooks.notify(event, "", message)
+}
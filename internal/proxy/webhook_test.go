@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+)
+
+func TestNotifier(t *testing.T) {
+	received := make(chan map[string]any, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode webhook: %v", err)
+		}
+		received <- body
+	}))
+	defer hook.Close()
+	next := func() map[string]any {
+		t.Helper()
+		select {
+		case body := <-received:
+			return body
+		case <-time.After(5 * time.Second):
+			t.Fatal("no webhook received")
+			return nil
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.WebhookURLs = []string{hook.URL}
+	cfg.WebhookAuthFailures = 3
+	done := make(chan struct{})
+	defer close(done)
+	now := time.Unix(1700000000, 0)
+	n := newNotifier(func() config.Config { return cfg }, done)
+	n.now = func() time.Time { return now }
+
+	n.notify(EventUpstreamUnhealthy, "proxy-a:3128", "Upstream proxy-a:3128 failed its health check")
+	if body := next(); body["event"] != EventUpstreamUnhealthy || !strings.Contains(body["message"].(string), "proxy-a:3128") {
+		t.Errorf("webhook = %v; expected upstream-unhealthy for proxy-a:3128", body)
+	}
+
+	// Repeats about the same upstream are held back for the cooldown.
+	n.notify(EventUpstreamUnhealthy, "proxy-a:3128", "again")
+	n.notify(EventUpstreamUnhealthy, "proxy-b:3128", "Upstream proxy-b:3128 failed its health check")
+	if body := next(); !strings.Contains(body["message"].(string), "proxy-b:3128") {
+		t.Errorf("webhook = %v; expected the repeat for proxy-a to be held back", body)
+	}
+	now = now.Add(webhookCooldown)
+	n.notify(EventUpstreamUnhealthy, "proxy-a:3128", "after cooldown")
+	if body := next(); body["message"] != "after cooldown" {
+		t.Errorf("webhook = %v; expected a repeat after the cooldown", body)
+	}
+
+	for range 5 {
+		n.authFailure("10.0.0.9")
+	}
+	if body := next(); body["event"] != EventAuthFailures || !strings.Contains(body["message"].(string), "10.0.0.9") {
+		t.Errorf("webhook = %v; expected one auth-failures event", body)
+	}
+
+	cfg.WebhookEvents = []string{EventConfigReloaded}
+	n.notify(EventQuotaExceeded, "10.0.0.9", "filtered")
+	cfg.WebhookFormat = config.WebhookFormatSlack
+	n.notify(EventConfigReloaded, "", "Configuration reloaded (2 changes)")
+	if body := next(); !strings.HasSuffix(body["text"].(string), "Configuration reloaded (2 changes)") {
+		t.Errorf("webhook = %v; expected a Slack message about the reload", body)
+	}
+	select {
+	case body := <-received:
+		t.Errorf("unexpected webhook %v", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,103 @@
+package proxyproto
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Listener accepts connections that start with a PROXY protocol header.
+type Listener struct {
+	net.Listener
+	// Timeout bounds reading the header; zero means no limit.
+	Timeout time.Duration
+	// Trusted lists the networks allowed to send headers; connections from
+	// elsewhere fail. All senders are trusted if it is empty.
+	Trusted []*net.IPNet
+}
+
+// Accept returns the next connection. Its header is read on the first call
+// to Read or RemoteAddr, in the connection's own goroutine, so a slow
+// client does not hold up the others.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, timeout: l.Timeout, trusted: l.Trusted}, nil
+}
+
+// Conn is a connection whose remote address is the client's address from
+// the PROXY protocol header.
+type Conn struct {
+	net.Conn
+	timeout time.Duration
+	trusted []*net.IPNet
+
+	once   sync.Once
+	r      *bufio.Reader
+	header Header
+	err    error
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		if !c.trustedPeer() {
+			c.err = fmt.Errorf("proxyproto: %s is not a trusted sender of PROXY protocol headers", c.Conn.RemoteAddr())
+			return
+		}
+		if c.timeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.r = bufio.NewReader(c.Conn)
+		c.header, c.err = ReadHeader(c.r)
+	})
+}
+
+func (c *Conn) trustedPeer() bool {
+	if len(c.trusted) == 0 {
+		return true
+	}
+	addr, ok := c.Conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range c.trusted {
+		if network.Contains(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the address
+// of the sender if the header carries none.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// Header returns the connection's PROXY protocol header.
+func (c *Conn) Header() (Header, error) {
+	c.init()
+	return c.header, c.err
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
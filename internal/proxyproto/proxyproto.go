@@ -0,0 +1,134 @@
+// Package proxyproto reads and writes HAProxy PROXY protocol headers
+// (versions 1 and 2), which load balancers put in front of a connection to
+// pass on the address of the client they accepted it from.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// signature starts every version 2 header.
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrNoHeader is returned when a connection does not start with a PROXY
+// protocol header.
+var ErrNoHeader = errors.New("proxyproto: missing PROXY protocol header")
+
+// Header is a parsed PROXY protocol header. Source and Destination are nil
+// for connections the sender opened itself (LOCAL, or UNKNOWN in version
+// 1), e.g. health checks.
+type Header struct {
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// ReadHeader reads a version 1 or version 2 header from r.
+func ReadHeader(r *bufio.Reader) (Header, error) {
+	peek, err := r.Peek(len(signature))
+	switch {
+	case bytes.Equal(peek, signature):
+		return readV2(r)
+	case bytes.HasPrefix(peek, []byte("PROXY ")):
+		return readV1(r)
+	case len(peek) == 0:
+		return Header{}, err
+	}
+	return Header{}, ErrNoHeader
+}
+
+// readV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n", at most
+// 107 bytes.
+func readV1(r *bufio.Reader) (Header, error) {
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Header{}, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return Header{}, errors.New("proxyproto: version 1 header too long or not terminated by CRLF")
+	}
+	fields := strings.Split(text, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return Header{}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return Header{}, fmt.Errorf("proxyproto: malformed version 1 header %q", text)
+	}
+	src, err := parseV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return Header{}, err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return Header{}, err
+	}
+	return Header{Source: src, Destination: dst}, nil
+}
+
+func parseV1Addr(host, port string, v4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || strings.Contains(host, ":") == v4 {
+		return nil, fmt.Errorf("proxyproto: invalid address %q in version 1 header", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid port %q in version 1 header", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readV2 parses the binary header: the signature, version and command,
+// address family and protocol, length and the addresses, followed by TLVs
+// that are skipped.
+func readV2(r *bufio.Reader) (Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return Header{}, err
+	}
+	if fixed[12]>>4 != 2 {
+		return Header{}, fmt.Errorf("proxyproto: unsupported version %d", fixed[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Header{}, err
+	}
+	switch fixed[12] & 0x0f {
+	case 0x0: // LOCAL
+		return Header{}, nil
+	case 0x1: // PROXY
+	default:
+		return Header{}, fmt.Errorf("proxyproto: unsupported command %d", fixed[12]&0x0f)
+	}
+
+	var size int
+	switch fixed[13] {
+	case 0x11: // TCP over IPv4
+		size = net.IPv4len
+	case 0x21: // TCP over IPv6
+		size = net.IPv6len
+	default:
+		// UDP or Unix sockets: nothing a TCP proxy can use.
+		return Header{}, nil
+	}
+	if len(body) < 2*size+4 {
+		return Header{}, errors.New("proxyproto: version 2 header too short for its addresses")
+	}
+	src := &net.TCPAddr{IP: net.IP(append([]byte(nil), body[:size]...)), Port: int(binary.BigEndian.Uint16(body[2*size:]))}
+	dst := &net.TCPAddr{IP: net.IP(append([]byte(nil), body[size:2*size]...)), Port: int(binary.BigEndian.Uint16(body[2*size+2:]))}
+	return Header{Source: src, Destination: dst}, nil
+}
@@ -0,0 +1,167 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func v2Header(cmd, family byte, addrs []byte) string {
+	h := append([]byte(nil), signature...)
+	h = append(h, 0x20|cmd, family)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(addrs)))
+	return string(append(h, addrs...))
+}
+
+func TestReadHeader(t *testing.T) {
+	v4 := []byte{192, 0, 2, 1, 198, 51, 100, 7, 0xd4, 0x31, 0x1f, 0x90}
+	v6 := make([]byte, 36)
+	copy(v6, net.ParseIP("2001:db8::1"))
+	copy(v6[16:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(v6[32:], 40000)
+	binary.BigEndian.PutUint16(v6[34:], 443)
+
+	tests := []struct {
+		name    string
+		input   string
+		src     string
+		wantErr error
+	}{
+		{name: "v1 TCP4", input: "PROXY TCP4 192.0.2.1 198.51.100.7 54321 8080\r\n", src: "192.0.2.1:54321"},
+		{name: "v1 TCP6", input: "PROXY TCP6 2001:db8::1 2001:db8::2 40000 443\r\n", src: "[2001:db8::1]:40000"},
+		{name: "v1 UNKNOWN", input: "PROXY UNKNOWN\r\n"},
+		{name: "v2 TCP4", input: v2Header(0x1, 0x11, v4), src: "192.0.2.1:54321"},
+		{name: "v2 TCP6 with TLV", input: v2Header(0x1, 0x21, append(v6, 0x04, 0x00, 0x01, 0x00)), src: "[2001:db8::1]:40000"},
+		{name: "v2 LOCAL", input: v2Header(0x0, 0x00, nil)},
+		{name: "no header", input: "GET / HTTP/1.1\r\n\r\n", wantErr: ErrNoHeader},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.input + "payload"))
+		h, err := ReadHeader(r)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: err = %v; expected %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReadHeader = %v", tt.name, err)
+			continue
+		}
+		src := ""
+		if h.Source != nil {
+			src = h.Source.String()
+		}
+		if src != tt.src {
+			t.Errorf("%s: source = %q; expected %q", tt.name, src, tt.src)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+			t.Errorf("%s: data after the header = %q; expected \"payload\"", tt.name, rest)
+		}
+	}
+}
+
+func TestReadHeaderMalformed(t *testing.T) {
+	for _, input := range []string{
+		"PROXY TCP4 192.0.2.1 198.51.100.7 54321\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.7 54321 8080\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.7 54321 99999\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.7 54321 8080\n",
+		"PROXY " + strings.Repeat("x", 200),
+		v2Header(0x1, 0x11, []byte{192, 0, 2, 1}),
+	} {
+		if _, err := ReadHeader(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("ReadHeader(%q) succeeded", input)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, elsewhere, _ := net.ParseCIDR("192.0.2.0/24")
+	l := &Listener{Listener: inner, Trusted: []*net.IPNet{loopback}}
+	defer l.Close()
+
+	send := func(data string) {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Errorf("dial: %v", err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, data)
+	}
+
+	go send("PROXY TCP4 192.0.2.1 198.51.100.7 54321 8080\r\nhello")
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if got := conn.RemoteAddr().String(); got != "192.0.2.1:54321" {
+		t.Errorf("RemoteAddr = %s; expected the client from the header", got)
+	}
+	if data, _ := io.ReadAll(conn); string(data) != "hello" {
+		t.Errorf("read %q; expected \"hello\"", data)
+	}
+	conn.Close()
+
+	l.Trusted = []*net.IPNet{elsewhere}
+	go send("PROXY TCP4 192.0.2.1 198.51.100.7 54321 8080\r\nhello")
+	conn, err = l.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("read from an untrusted sender succeeded")
+	}
+}
+
+func TestWriteHeaderRoundTrip(t *testing.T) {
+	v4src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 54321}
+	v4dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 8080}
+	v6dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+	tests := []struct {
+		name string
+		h    Header
+		v1   string
+	}{
+		{"IPv4", Header{Source: v4src, Destination: v4dst}, "PROXY TCP4 192.0.2.1 198.51.100.7 54321 8080\r\n"},
+		{"mixed families", Header{Source: v4src, Destination: v6dst}, "PROXY TCP6 ::ffff:192.0.2.1 2001:db8::2 54321 443\r\n"},
+		{"unknown", Header{}, "PROXY UNKNOWN\r\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := WriteHeader(&b, tt.h, 1); err != nil {
+			t.Fatalf("%s: WriteHeader v1 = %v", tt.name, err)
+		}
+		if b.String() != tt.v1 {
+			t.Errorf("%s: v1 header = %q; expected %q", tt.name, b.String(), tt.v1)
+		}
+		for version := 1; version <= 2; version++ {
+			var b strings.Builder
+			if err := WriteHeader(&b, tt.h, version); err != nil {
+				t.Fatalf("%s: WriteHeader v%d = %v", tt.name, version, err)
+			}
+			got, err := ReadHeader(bufio.NewReader(strings.NewReader(b.String())))
+			if err != nil {
+				t.Fatalf("%s: reading back v%d = %v", tt.name, version, err)
+			}
+			if (got.Source == nil) != (tt.h.Source == nil) ||
+				got.Source != nil && (!got.Source.IP.Equal(tt.h.Source.IP) || got.Source.Port != tt.h.Source.Port) {
+				t.Errorf("%s: v%d source = %v; expected %v", tt.name, version, got.Source, tt.h.Source)
+			}
+		}
+	}
+	if err := WriteHeader(io.Discard, Header{}, 3); err == nil {
+		t.Error("WriteHeader with version 3 succeeded")
+	}
+}
@@ -0,0 +1,78 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// WriteHeader writes h to w as a version 1 or version 2 header. A header
+// without addresses is sent as UNKNOWN (version 1) or LOCAL (version 2).
+// If only one address is IPv6, both are sent as IPv6.
+func WriteHeader(w io.Writer, h Header, version int) error {
+	var b []byte
+	switch version {
+	case 1:
+		b = appendV1(b, h)
+	case 2:
+		b = appendV2(b, h)
+	default:
+		return fmt.Errorf("proxyproto: unsupported version %d", version)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// addrs returns the source and destination IPs in a common family.
+func (h Header) addrs() (src, dst net.IP, v4 bool) {
+	src, dst = h.Source.IP.To4(), h.Destination.IP.To4()
+	if src != nil && dst != nil {
+		return src, dst, true
+	}
+	return h.Source.IP.To16(), h.Destination.IP.To16(), false
+}
+
+func appendV1(b []byte, h Header) []byte {
+	if h.Source == nil || h.Destination == nil {
+		return append(b, "PROXY UNKNOWN\r\n"...)
+	}
+	src, dst, v4 := h.addrs()
+	proto := "TCP6"
+	if v4 {
+		proto = "TCP4"
+	}
+	b = append(b, "PROXY "+proto+" "+v1Addr(src, v4)+" "+v1Addr(dst, v4)+" "...)
+	b = strconv.AppendInt(b, int64(h.Source.Port), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(h.Destination.Port), 10)
+	return append(b, "\r\n"...)
+}
+
+// v1Addr formats ip, keeping IPv4-mapped addresses in IPv6 notation for
+// TCP6 headers.
+func v1Addr(ip net.IP, v4 bool) string {
+	if !v4 && ip.To4() != nil {
+		return "::ffff:" + ip.To4().String()
+	}
+	return ip.String()
+}
+
+func appendV2(b []byte, h Header) []byte {
+	b = append(b, signature...)
+	if h.Source == nil || h.Destination == nil {
+		return append(b, 0x20, 0x00, 0x00, 0x00)
+	}
+	src, dst, v4 := h.addrs()
+	family := byte(0x21)
+	if v4 {
+		family = 0x11
+	}
+	b = append(b, 0x21, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(2*len(src)+4))
+	b = append(b, src...)
+	b = append(b, dst...)
+	b = binary.BigEndian.AppendUint16(b, uint16(h.Source.Port))
+	return binary.BigEndian.AppendUint16(b, uint16(h.Destination.Port))
+}
@@ -0,0 +1,233 @@
+// Package redirect builds the nftables or iptables rules that send the TCP
+// connections of chosen users, cgroups and interfaces to a transparent
+// listener, and installs and removes them.
+package redirect
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Backends that install the rules.
+const (
+	NFTables = "nftables"
+	IPTables = "iptables"
+)
+
+// nftTable is the nftables table holding the rules, so that they are
+// removed without touching other rules.
+const nftTable = "dynamicproxy"
+
+// iptablesChains are the iptables chains holding the rules, jumped to from
+// the built-in chain they are named after: owner and cgroup matches only
+// work for local processes, interfaces only for forwarded traffic.
+var iptablesChains = [][2]string{{"OUTPUT", "DYNAMICPROXY_OUTPUT"}, {"PREROUTING", "DYNAMICPROXY_PREROUTING"}}
+
+// Rules selects the connections redirected to a transparent listener.
+// Only connections of local processes run by Users or in Cgroups, and
+// connections forwarded from Interfaces, to one of Ports are redirected;
+// connections to local addresses never are.
+type Rules struct {
+	// Port is the port of the transparent listener.
+	Port int
+	// Ports are the destination ports redirected.
+	Ports []int
+	// Users are user names or IDs, Cgroups cgroup v2 paths, e.g.
+	// "system.slice/build.service", and Interfaces the names of the
+	// interfaces whose forwarded traffic is redirected, for a gateway.
+	Users      []string
+	Cgroups    []string
+	Interfaces []string
+}
+
+// Command is one command run to install or remove rules.
+type Command struct {
+	Args []string
+	// Stdin is written to the command's standard input.
+	Stdin string
+	// MayFail is set for commands that clean up rules which may not exist.
+	MayFail bool
+}
+
+// String returns the command as it would be typed into a shell.
+func (c Command) String() string {
+	s := strings.Join(c.Args, " ")
+	if c.Stdin != "" {
+		s += " <<'EOF'\n" + c.Stdin + "EOF"
+	}
+	return s
+}
+
+var (
+	// Names are checked so that they cannot break out of the rules.
+	validName   = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.@-]*$`)
+	validCgroup = regexp.MustCompile(`^[A-Za-z0-9_.@:-]+(/[A-Za-z0-9_.@:-]+)*$`)
+)
+
+func (r Rules) validate() error {
+	if r.Port < 1 || r.Port > 65535 {
+		return fmt.Errorf("invalid listener port %d", r.Port)
+	}
+	if len(r.Ports) == 0 {
+		return errors.New("no destination ports to redirect")
+	}
+	for _, p := range r.Ports {
+		if p < 1 || p > 65535 {
+			return fmt.Errorf("invalid destination port %d", p)
+		}
+	}
+	if len(r.Users) == 0 && len(r.Cgroups) == 0 && len(r.Interfaces) == 0 {
+		return errors.New("no users, cgroups or interfaces to redirect")
+	}
+	for _, u := range r.Users {
+		if !validName.MatchString(u) {
+			return fmt.Errorf("invalid user %q", u)
+		}
+	}
+	for _, c := range r.Cgroups {
+		if !validCgroup.MatchString(strings.Trim(c, "/")) {
+			return fmt.Errorf("invalid cgroup %q", c)
+		}
+	}
+	for _, i := range r.Interfaces {
+		if !validName.MatchString(i) {
+			return fmt.Errorf("invalid interface %q", i)
+		}
+	}
+	return nil
+}
+
+// Install returns the commands that install r with backend, replacing
+// rules installed before.
+func Install(backend string, r Rules) ([]Command, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	switch backend {
+	case NFTables:
+		return []Command{{Args: []string{"nft", "-f", "-"}, Stdin: r.nftables()}}, nil
+	case IPTables:
+		cmds, _ := Remove(IPTables)
+		for _, tool := range []string{"iptables", "ip6tables"} {
+			cmds = append(cmds, r.iptables(tool)...)
+		}
+		return cmds, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", backend)
+}
+
+// Remove returns the commands that remove the rules installed with
+// backend.
+func Remove(backend string) ([]Command, error) {
+	switch backend {
+	case NFTables:
+		return []Command{{Args: []string{"nft", "delete", "table", "inet", nftTable}, MayFail: true}}, nil
+	case IPTables:
+		var cmds []Command
+		for _, tool := range []string{"iptables", "ip6tables"} {
+			for _, c := range iptablesChains {
+				cmds = append(cmds,
+					Command{Args: []string{tool, "-t", "nat", "-D", c[0], "-j", c[1]}, MayFail: true},
+					Command{Args: []string{tool, "-t", "nat", "-F", c[1]}, MayFail: true},
+					Command{Args: []string{tool, "-t", "nat", "-X", c[1]}, MayFail: true})
+			}
+		}
+		return cmds, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", backend)
+}
+
+// DefaultBackend is nftables if nft is installed, and iptables otherwise.
+func DefaultBackend() string {
+	if _, err := exec.LookPath("nft"); err == nil {
+		return NFTables
+	}
+	return IPTables
+}
+
+// Run runs cmds in order, stopping at the first one that fails unless it
+// may.
+func Run(cmds []Command) error {
+	for _, c := range cmds {
+		cmd := exec.Command(c.Args[0], c.Args[1:]...)
+		cmd.Stdin = strings.NewReader(c.Stdin)
+		if out, err := cmd.CombinedOutput(); err != nil && !c.MayFail {
+			return fmt.Errorf("%s: %w: %s", strings.Join(c.Args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// nftables returns an nft script that replaces the dynamicproxy table with
+// one holding r. The table is added first so that deleting it cannot fail.
+func (r Rules) nftables() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "add table inet %s\ndelete table inet %s\ntable inet %s {\n", nftTable, nftTable, nftTable)
+	redirect := fmt.Sprintf("tcp dport { %s } redirect to :%d", joinPorts(r.Ports, ", "), r.Port)
+	if len(r.Users) > 0 || len(r.Cgroups) > 0 {
+		b.WriteString("\tchain output {\n\t\ttype nat hook output priority -100; policy accept;\n\t\tfib daddr type local return\n")
+		for _, u := range r.Users {
+			fmt.Fprintf(&b, "\t\tmeta skuid %s %s\n", u, redirect)
+		}
+		for _, c := range r.Cgroups {
+			c = strings.Trim(c, "/")
+			fmt.Fprintf(&b, "\t\tsocket cgroupv2 level %d %q %s\n", strings.Count(c, "/")+1, c, redirect)
+		}
+		b.WriteString("\t}\n")
+	}
+	if len(r.Interfaces) > 0 {
+		b.WriteString("\tchain prerouting {\n\t\ttype nat hook prerouting priority -100; policy accept;\n\t\tfib daddr type local return\n")
+		for _, i := range r.Interfaces {
+			fmt.Fprintf(&b, "\t\tiifname %q %s\n", i, redirect)
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// iptables returns the commands that install r with tool, iptables or
+// ip6tables.
+func (r Rules) iptables(tool string) []Command {
+	nat := func(args ...string) Command {
+		return Command{Args: append([]string{tool, "-t", "nat"}, args...)}
+	}
+	redirect := []string{"-m", "multiport", "--dports", joinPorts(r.Ports, ","), "-j", "REDIRECT", "--to-ports", strconv.Itoa(r.Port)}
+	var matches [2][][]string
+	for _, u := range r.Users {
+		matches[0] = append(matches[0], []string{"-m", "owner", "--uid-owner", u})
+	}
+	for _, c := range r.Cgroups {
+		matches[0] = append(matches[0], []string{"-m", "cgroup", "--path", strings.Trim(c, "/")})
+	}
+	for _, i := range r.Interfaces {
+		matches[1] = append(matches[1], []string{"-i", i})
+	}
+	var cmds []Command
+	for i, c := range iptablesChains {
+		if len(matches[i]) == 0 {
+			continue
+		}
+		cmds = append(cmds,
+			nat("-N", c[1]),
+			nat("-A", c[1], "-m", "addrtype", "--dst-type", "LOCAL", "-j", "RETURN"))
+		for _, m := range matches[i] {
+			cmds = append(cmds, nat(slices.Concat([]string{"-A", c[1], "-p", "tcp"}, m, redirect)...))
+		}
+		cmds = append(cmds, nat("-A", c[0], "-j", c[1]))
+	}
+	return cmds
+}
+
+func joinPorts(ports []int, sep string) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, sep)
+}
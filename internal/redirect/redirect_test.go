@@ -0,0 +1,94 @@
+package redirect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstallNFTables(t *testing.T) {
+	cmds, err := Install(NFTables, Rules{
+		Port:       3129,
+		Ports:      []int{80, 443},
+		Users:      []string{"build", "1001"},
+		Cgroups:    []string{"/system.slice/ci.service"},
+		Interfaces: []string{"lan0"},
+	})
+	if err != nil {
+		t.Fatalf("Install = %v", err)
+	}
+	expected := `add table inet dynamicproxy
+delete table inet dynamicproxy
+table inet dynamicproxy {
+	chain output {
+		type nat hook output priority -100; policy accept;
+		fib daddr type local return
+		meta skuid build tcp dport { 80, 443 } redirect to :3129
+		meta skuid 1001 tcp dport { 80, 443 } redirect to :3129
+		socket cgroupv2 level 2 "system.slice/ci.service" tcp dport { 80, 443 } redirect to :3129
+	}
+	chain prerouting {
+		type nat hook prerouting priority -100; policy accept;
+		fib daddr type local return
+		iifname "lan0" tcp dport { 80, 443 } redirect to :3129
+	}
+}
+`
+	if len(cmds) != 1 || strings.Join(cmds[0].Args, " ") != "nft -f -" || cmds[0].Stdin != expected {
+		t.Errorf("Install = %v; expected nft -f - with\n%s", cmds, expected)
+	}
+
+	cmds, _ = Remove(NFTables)
+	if len(cmds) != 1 || cmds[0].String() != "nft delete table inet dynamicproxy" || !cmds[0].MayFail {
+		t.Errorf("Remove = %+v; expected the table deleted", cmds)
+	}
+}
+
+func TestInstallIPTables(t *testing.T) {
+	cmds, err := Install(IPTables, Rules{Port: 3129, Ports: []int{443}, Users: []string{"build"}})
+	if err != nil {
+		t.Fatalf("Install = %v", err)
+	}
+	var installed []string
+	for _, c := range cmds {
+		if !c.MayFail {
+			installed = append(installed, c.String())
+		}
+	}
+	expected := []string{
+		"iptables -t nat -N DYNAMICPROXY_OUTPUT",
+		"iptables -t nat -A DYNAMICPROXY_OUTPUT -m addrtype --dst-type LOCAL -j RETURN",
+		"iptables -t nat -A DYNAMICPROXY_OUTPUT -p tcp -m owner --uid-owner build -m multiport --dports 443 -j REDIRECT --to-ports 3129",
+		"iptables -t nat -A OUTPUT -j DYNAMICPROXY_OUTPUT",
+		"ip6tables -t nat -N DYNAMICPROXY_OUTPUT",
+		"ip6tables -t nat -A DYNAMICPROXY_OUTPUT -m addrtype --dst-type LOCAL -j RETURN",
+		"ip6tables -t nat -A DYNAMICPROXY_OUTPUT -p tcp -m owner --uid-owner build -m multiport --dports 443 -j REDIRECT --to-ports 3129",
+		"ip6tables -t nat -A OUTPUT -j DYNAMICPROXY_OUTPUT",
+	}
+	if strings.Join(installed, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Install =\n%s\nexpected\n%s", strings.Join(installed, "\n"), strings.Join(expected, "\n"))
+	}
+	// Rules installed before are removed first.
+	removed, _ := Remove(IPTables)
+	if len(cmds) != len(removed)+len(expected) || cmds[0].String() != removed[0].String() {
+		t.Errorf("Install does not start by removing the old rules: %v", cmds)
+	}
+}
+
+func TestInstallRejectsInvalidRules(t *testing.T) {
+	for _, r := range []Rules{
+		{Port: 3129, Ports: []int{443}},
+		{Port: 0, Ports: []int{443}, Users: []string{"build"}},
+		{Port: 3129, Users: []string{"build"}},
+		{Port: 3129, Ports: []int{70000}, Users: []string{"build"}},
+		{Port: 3129, Ports: []int{443}, Users: []string{"build; flush ruleset"}},
+		{Port: 3129, Ports: []int{443}, Cgroups: []string{`ci"`}},
+		{Port: 3129, Ports: []int{443}, Interfaces: []string{"lan 0"}},
+	} {
+		if _, err := Install(NFTables, r); err == nil {
+			t.Errorf("Install(%+v) succeeded", r)
+		}
+	}
+	if _, err := Install("ebpf", Rules{Port: 3129, Ports: []int{443}, Users: []string{"build"}}); err == nil {
+		t.Error("Install with an unknown backend succeeded")
+	}
+}
@@ -0,0 +1,174 @@
+package sysproxy
+
+import (
+	"net"
+	"strings"
+)
+
+// gnomeSnapshot holds the GNOME proxy settings that Set changes, as the
+// GVariant text printed by "gsettings get", which "gsettings set" accepts
+// back.
+type gnomeSnapshot map[string]string
+
+// gnomeKeys are the schema and key pairs of the GNOME proxy settings.
+var gnomeKeys = [][2]string{
+	{"org.gnome.system.proxy", "mode"},
+	{"org.gnome.system.proxy", "ignore-hosts"},
+	{"org.gnome.system.proxy.http", "host"},
+	{"org.gnome.system.proxy.http", "port"},
+	{"org.gnome.system.proxy.https", "host"},
+	{"org.gnome.system.proxy.https", "port"},
+}
+
+// kdeSnapshot holds the KDE kioslaverc file as it was before Set.
+type kdeSnapshot struct {
+	Exists  bool   `json:"exists"`
+	Content string `json:"content"`
+}
+
+type desktopSnapshot struct {
+	GNOME gnomeSnapshot `json:"gnome,omitempty"`
+	KDE   *kdeSnapshot  `json:"kde,omitempty"`
+}
+
+// gnomeSettings reads a snapshot as system proxy settings.
+func gnomeSettings(s gnomeSnapshot) Settings {
+	var settings Settings
+	if parseGVariantString(s["org.gnome.system.proxy mode"]) != "manual" {
+		return settings
+	}
+	for _, scheme := range []string{"https", "http"} {
+		host := parseGVariantString(s["org.gnome.system.proxy."+scheme+" host"])
+		port := strings.TrimSpace(s["org.gnome.system.proxy."+scheme+" port"])
+		if host != "" && port != "" && port != "0" {
+			settings.Proxy = net.JoinHostPort(host, port)
+			break
+		}
+	}
+	settings.Bypass = parseGVariantStrings(s["org.gnome.system.proxy ignore-hosts"])
+	return settings
+}
+
+// parseGVariantString unquotes a GVariant string such as 'manual'.
+func parseGVariantString(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// parseGVariantStrings parses a GVariant string array such as
+// ['localhost', '127.0.0.0/8'] or @as [].
+func parseGVariantStrings(v string) []string {
+	v = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(v), "@as"))
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = parseGVariantString(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// kdeSettings reads the proxy from kioslaverc content. ProxyType 1 is a
+// manually configured proxy.
+func kdeSettings(content string) Settings {
+	values := iniSection(content, "Proxy Settings")
+	var settings Settings
+	if values["ProxyType"] != "1" {
+		return settings
+	}
+	for _, key := range []string{"httpsProxy", "httpProxy"} {
+		if proxy := parseKDEProxy(values[key]); proxy != "" {
+			settings.Proxy = proxy
+			break
+		}
+	}
+	for _, pattern := range strings.Split(values["NoProxyFor"], ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			settings.Bypass = append(settings.Bypass, pattern)
+		}
+	}
+	return settings
+}
+
+// parseKDEProxy turns "http://proxy 8080" or "http://proxy:8080" into
+// host:port.
+func parseKDEProxy(v string) string {
+	v = trimScheme(v)
+	if host, port, ok := strings.Cut(v, " "); ok {
+		return net.JoinHostPort(host, strings.TrimSpace(port))
+	}
+	return v
+}
+
+// iniSection returns the keys of section in an INI file.
+func iniSection(content, section string) map[string]string {
+	values := map[string]string{}
+	current := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = line[1 : len(line)-1]
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && current == section {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// setINIKeys sets keys in section of an INI file, replacing existing lines
+// in place, appending missing ones to the section and adding the section if
+// there is none.
+func setINIKeys(content, section string, keys [][2]string) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+	done := map[string]bool{}
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			if start >= 0 {
+				end = i
+				break
+			}
+			if trimmed == "["+section+"]" {
+				start = i
+			}
+			continue
+		}
+		if start < 0 {
+			continue
+		}
+		key, _, ok := strings.Cut(trimmed, "=")
+		for _, kv := range keys {
+			if ok && strings.TrimSpace(key) == kv[0] {
+				lines[i] = kv[0] + "=" + kv[1]
+				done[kv[0]] = true
+			}
+		}
+	}
+
+	var missing []string
+	for _, kv := range keys {
+		if !done[kv[0]] {
+			missing = append(missing, kv[0]+"="+kv[1])
+		}
+	}
+	if start < 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+section+"]")
+		lines = append(lines, missing...)
+	} else {
+		lines = append(lines[:end], append(missing, lines[end:]...)...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,75 @@
+package sysproxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGNOMESettings(t *testing.T) {
+	snapshot := gnomeSnapshot{
+		"org.gnome.system.proxy mode":         "'manual'",
+		"org.gnome.system.proxy ignore-hosts": "['localhost', '127.0.0.0/8', '*.corp']",
+		"org.gnome.system.proxy.http host":    "'proxy.corp'",
+		"org.gnome.system.proxy.http port":    "8080",
+		"org.gnome.system.proxy.https host":   "''",
+		"org.gnome.system.proxy.https port":   "0",
+	}
+	expected := Settings{Proxy: "proxy.corp:8080", Bypass: []string{"localhost", "127.0.0.0/8", "*.corp"}}
+	if got := gnomeSettings(snapshot); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("gnomeSettings = %+v; expected %+v", got, expected)
+	}
+
+	snapshot["org.gnome.system.proxy mode"] = "'none'"
+	if got := gnomeSettings(snapshot); !reflect.DeepEqual(got, Settings{}) {
+		t.Fatalf("gnomeSettings without a manual proxy = %+v; expected zero", got)
+	}
+}
+
+func TestParseGVariantStrings(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected []string
+	}{
+		{"['localhost', '::1']", []string{"localhost", "::1"}},
+		{"@as []", nil},
+		{"[]", nil},
+	}
+	for _, tt := range tests {
+		if got := parseGVariantStrings(tt.in); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("parseGVariantStrings(%q) = %v; expected %v", tt.in, got, tt.expected)
+		}
+	}
+}
+
+func TestKDESettings(t *testing.T) {
+	content := "[General]\nfoo=bar\n\n[Proxy Settings]\nNoProxyFor=localhost, .corp\nProxyType=1\nhttpProxy=http://proxy.corp 3128\nhttpsProxy=\n"
+	expected := Settings{Proxy: "proxy.corp:3128", Bypass: []string{"localhost", ".corp"}}
+	if got := kdeSettings(content); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("kdeSettings = %+v; expected %+v", got, expected)
+	}
+	if got := kdeSettings("[Proxy Settings]\nProxyType=0\nhttpProxy=http://proxy.corp 3128\n"); !reflect.DeepEqual(got, Settings{}) {
+		t.Fatalf("kdeSettings without a manual proxy = %+v; expected zero", got)
+	}
+}
+
+func TestSetINIKeys(t *testing.T) {
+	keys := [][2]string{{"ProxyType", "1"}, {"httpProxy", "http://127.0.0.1 8080"}}
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"empty", "", "[Proxy Settings]\nProxyType=1\nhttpProxy=http://127.0.0.1 8080\n"},
+		{"other section", "[General]\nfoo=bar\n", "[General]\nfoo=bar\n\n[Proxy Settings]\nProxyType=1\nhttpProxy=http://127.0.0.1 8080\n"},
+		{
+			"existing keys",
+			"[Proxy Settings]\nProxyType=0\nNoProxyFor=localhost\n[General]\nProxyType=5\n",
+			"[Proxy Settings]\nProxyType=1\nNoProxyFor=localhost\nhttpProxy=http://127.0.0.1 8080\n[General]\nProxyType=5\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := setINIKeys(tt.content, "Proxy Settings", keys); got != tt.expected {
+			t.Errorf("%s: setINIKeys = %q; expected %q", tt.name, got, tt.expected)
+		}
+	}
+}
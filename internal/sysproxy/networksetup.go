@@ -0,0 +1,118 @@
+package sysproxy
+
+import (
+	"bufio"
+	"net"
+	"strings"
+)
+
+// proxyState is one proxy setting of a macOS network service, as printed by
+// "networksetup -getwebproxy".
+type proxyState struct {
+	Enabled bool   `json:"enabled"`
+	Server  string `json:"server"`
+	Port    string `json:"port"`
+}
+
+// serviceSnapshot holds the settings of a macOS network service that Set
+// changes.
+type serviceSnapshot struct {
+	Service string     `json:"service"`
+	Web     proxyState `json:"web"`
+	Secure  proxyState `json:"secure"`
+}
+
+// parseNetworkServices lists the enabled services printed by
+// "networksetup -listallnetworkservices": the first line is a note, and
+// disabled services are marked with an asterisk.
+func parseNetworkServices(out string) []string {
+	var services []string
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if i == 0 && strings.Contains(line, "asterisk") || line == "" || strings.HasPrefix(line, "*") {
+			continue
+		}
+		services = append(services, line)
+	}
+	return services
+}
+
+func parseProxyState(out string) proxyState {
+	var state proxyState
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Enabled":
+			state.Enabled = value == "Yes"
+		case "Server":
+			state.Server = value
+		case "Port":
+			state.Port = value
+		}
+	}
+	if state.Port == "0" {
+		state.Port = ""
+	}
+	return state
+}
+
+// parseScutilProxy reads the effective proxy settings printed by
+// "scutil --proxy".
+func parseScutilProxy(out string) Settings {
+	values := map[string]string{}
+	var settings Settings
+	inExceptions := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inExceptions {
+			if line == "}" {
+				inExceptions = false
+			} else if _, value, ok := strings.Cut(line, " : "); ok {
+				settings.Bypass = append(settings.Bypass, expandPrefix(value))
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		if key == "ExceptionsList" {
+			inExceptions = true
+			continue
+		}
+		values[key] = value
+	}
+
+	for _, scheme := range []string{"HTTPS", "HTTP"} {
+		if values[scheme+"Enable"] == "1" && values[scheme+"Proxy"] != "" {
+			settings.Proxy = values[scheme+"Proxy"]
+			if port := values[scheme+"Port"]; port != "" {
+				settings.Proxy = net.JoinHostPort(settings.Proxy, port)
+			}
+			break
+		}
+	}
+	if values["ExcludeSimpleHostnames"] == "1" {
+		settings.Bypass = append(settings.Bypass, "<local>")
+	}
+	return settings
+}
+
+// expandPrefix completes abbreviated IPv4 ranges such as "169.254/16",
+// which macOS accepts, to CIDR notation.
+func expandPrefix(pattern string) string {
+	addr, bits, ok := strings.Cut(pattern, "/")
+	if !ok || strings.Count(addr, ".") >= 3 || strings.Trim(addr, "0123456789.") != "" {
+		return pattern
+	}
+	for strings.Count(addr, ".") < 3 {
+		addr += ".0"
+	}
+	return addr + "/" + bits
+}
@@ -0,0 +1,49 @@
+package sysproxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetworkServices(t *testing.T) {
+	out := "An asterisk (*) denotes that a network service is disabled.\nWi-Fi\n*Bluetooth PAN\nThunderbolt Bridge\n"
+	expected := []string{"Wi-Fi", "Thunderbolt Bridge"}
+	if got := parseNetworkServices(out); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parseNetworkServices = %v; expected %v", got, expected)
+	}
+}
+
+func TestParseProxyState(t *testing.T) {
+	out := "Enabled: Yes\nServer: proxy.corp\nPort: 8080\nAuthenticated Proxy Enabled: 0\n"
+	expected := proxyState{Enabled: true, Server: "proxy.corp", Port: "8080"}
+	if got := parseProxyState(out); got != expected {
+		t.Fatalf("parseProxyState = %+v; expected %+v", got, expected)
+	}
+	if got := parseProxyState("Enabled: No\nServer: \nPort: 0\n"); got != (proxyState{}) {
+		t.Fatalf("parseProxyState of a disabled proxy = %+v; expected zero", got)
+	}
+}
+
+func TestParseScutilProxy(t *testing.T) {
+	out := `<dictionary> {
+  ExceptionsList : <array> {
+    0 : *.local
+    1 : 169.254/16
+  }
+  ExcludeSimpleHostnames : 1
+  HTTPEnable : 1
+  HTTPPort : 3128
+  HTTPProxy : web.corp
+  HTTPSEnable : 1
+  HTTPSPort : 8443
+  HTTPSProxy : secure.corp
+}
+`
+	expected := Settings{Proxy: "secure.corp:8443", Bypass: []string{"*.local", "169.254.0.0/16", "<local>"}}
+	if got := parseScutilProxy(out); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parseScutilProxy = %+v; expected %+v", got, expected)
+	}
+	if got := parseScutilProxy("<dictionary> {\n  HTTPEnable : 0\n}\n"); got.Proxy != "" {
+		t.Fatalf("parseScutilProxy without a proxy = %+v; expected none", got)
+	}
+}
@@ -0,0 +1,195 @@
+// Package sysproxy reads the proxy settings of the operating system, so
+// that the proxy can pick up the upstream and bypass list a managed machine
+// is already configured with, and points the system at the proxy while it
+// runs.
+package sysproxy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotSupported is returned on platforms without a system proxy
+// configuration the proxy knows how to read or change.
+var ErrNotSupported = errors.New("system proxy settings are not supported on this platform")
+
+// savedState is written by Set so that Restore can put the original
+// settings back, even from a later process after an upgrade or a crash.
+type savedState struct {
+	// Original is what Read reports while the system points at the proxy.
+	Original Settings `json:"original"`
+	// Restore is the platform's snapshot of the settings Set changed.
+	Restore json.RawMessage `json:"restore"`
+}
+
+// Read returns the system proxy settings. While Set is in effect these are
+// the settings from before it, not the proxy itself.
+func Read() (Settings, error) {
+	if state, ok := loadState(); ok {
+		return state.Original, nil
+	}
+	return readSystem()
+}
+
+// Set points the system proxy settings at addr (host:port). The settings
+// found the first time are saved and put back by Restore.
+func Set(addr string) error {
+	if _, ok := loadState(); !ok {
+		original, err := readSystem()
+		if err != nil {
+			return err
+		}
+		snapshot, err := saveSystem()
+		if err != nil {
+			return err
+		}
+		if err := writeState(savedState{Original: original, Restore: snapshot}); err != nil {
+			return err
+		}
+	}
+	return setSystem(addr)
+}
+
+// Restore puts back the settings saved by Set, if any.
+func Restore() error {
+	state, ok := loadState()
+	if !ok {
+		return nil
+	}
+	if err := restoreSystem(state.Restore); err != nil {
+		return err
+	}
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func statePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dynamicproxy", "system-proxy.json"), nil
+}
+
+func loadState() (savedState, bool) {
+	var state savedState
+	path, err := statePath()
+	if err != nil {
+		return state, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, false
+	}
+	return state, json.Unmarshal(data, &state) == nil
+}
+
+func writeState(state savedState) error {
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save system proxy settings: %w", err)
+	}
+	return nil
+}
+
+// Settings is a system proxy configuration.
+type Settings struct {
+	// Proxy is the host:port of the proxy, empty if none is enabled.
+	Proxy string `json:"proxy"`
+	// Bypass lists the exception patterns, "<local>" standing for host
+	// names without a dot.
+	Bypass []string `json:"bypass"`
+}
+
+// parseProxyServer picks the proxy for web traffic from a Windows
+// ProxyServer value, which is either host:port or per-protocol entries such
+// as "http=proxy:8080;https=proxy:8443".
+func parseProxyServer(value string) string {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "=") {
+		return trimScheme(value)
+	}
+	byScheme := map[string]string{}
+	for _, entry := range strings.Split(value, ";") {
+		scheme, addr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok {
+			byScheme[strings.ToLower(scheme)] = trimScheme(addr)
+		}
+	}
+	for _, scheme := range []string{"https", "http"} {
+		if addr := byScheme[scheme]; addr != "" {
+			return addr
+		}
+	}
+	return ""
+}
+
+func trimScheme(addr string) string {
+	addr = strings.TrimSpace(addr)
+	for _, scheme := range []string{"http://", "https://"} {
+		if len(addr) >= len(scheme) && strings.EqualFold(addr[:len(scheme)], scheme) {
+			addr = addr[len(scheme):]
+		}
+	}
+	return strings.TrimSuffix(addr, "/")
+}
+
+// parseBypass splits a Windows bypass list, separated by semicolons (or
+// by commas or whitespace as some tools write them).
+func parseBypass(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// parseWinHTTPSettings decodes the WinHttpSettings registry value written by
+// "netsh winhttp set proxy": three little-endian uint32 fields (version,
+// counter, flags), then the proxy and the bypass list, each a uint32 length
+// followed by that many bytes.
+func parseWinHTTPSettings(b []byte) (Settings, bool) {
+	const flagProxy = 0x2
+	if len(b) < 12 {
+		return Settings{}, false
+	}
+	flags := binary.LittleEndian.Uint32(b[8:])
+	rest := b[12:]
+	readString := func() (string, bool) {
+		if len(rest) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(rest)
+		if uint64(len(rest)-4) < uint64(n) {
+			return "", false
+		}
+		s := string(rest[4 : 4+n])
+		rest = rest[4+n:]
+		return s, true
+	}
+	proxy, ok := readString()
+	if !ok {
+		return Settings{}, false
+	}
+	bypass, _ := readString()
+	if flags&flagProxy == 0 {
+		return Settings{}, true
+	}
+	return Settings{Proxy: parseProxyServer(proxy), Bypass: parseBypass(bypass)}, true
+}
@@ -0,0 +1,101 @@
+package sysproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// readSystem returns the effective proxy settings reported by scutil.
+func readSystem() (Settings, error) {
+	out, err := exec.Command("scutil", "--proxy").Output()
+	if err != nil {
+		return Settings{}, fmt.Errorf("scutil --proxy: %w", err)
+	}
+	return parseScutilProxy(string(out)), nil
+}
+
+// saveSystem records the web and secure web proxy of every enabled network
+// service.
+func saveSystem() (json.RawMessage, error) {
+	services, err := networkServices()
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []serviceSnapshot
+	for _, service := range services {
+		web, err := networksetup("-getwebproxy", service)
+		if err != nil {
+			return nil, err
+		}
+		secure, err := networksetup("-getsecurewebproxy", service)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, serviceSnapshot{Service: service, Web: parseProxyState(web), Secure: parseProxyState(secure)})
+	}
+	return json.Marshal(snapshots)
+}
+
+// setSystem sets addr as the web and secure web proxy of every enabled
+// network service.
+func setSystem(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	services, err := networkServices()
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		for _, kind := range []string{"webproxy", "securewebproxy"} {
+			if _, err := networksetup("-set"+kind, service, host, port); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func restoreSystem(snapshot json.RawMessage) error {
+	var snapshots []serviceSnapshot
+	if err := json.Unmarshal(snapshot, &snapshots); err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		for kind, state := range map[string]proxyState{"webproxy": s.Web, "securewebproxy": s.Secure} {
+			if state.Server != "" && state.Port != "" {
+				if _, err := networksetup("-set"+kind, s.Service, state.Server, state.Port); err != nil {
+					return err
+				}
+			}
+			onOff := "off"
+			if state.Enabled {
+				onOff = "on"
+			}
+			if _, err := networksetup("-set"+kind+"state", s.Service, onOff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func networkServices() ([]string, error) {
+	out, err := networksetup("-listallnetworkservices")
+	if err != nil {
+		return nil, err
+	}
+	return parseNetworkServices(out), nil
+}
+
+func networksetup(args ...string) (string, error) {
+	out, err := exec.Command("networksetup", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("networksetup %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
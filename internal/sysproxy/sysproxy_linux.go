@@ -0,0 +1,191 @@
+package sysproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// readSystem returns the manual proxy configured in GNOME, or else in KDE.
+func readSystem() (Settings, error) {
+	gnome, kde := hasGNOME(), kioslavercPath()
+	if !gnome && kde == "" {
+		return Settings{}, ErrNotSupported
+	}
+	if gnome {
+		snapshot, err := readGNOME()
+		if err != nil {
+			return Settings{}, err
+		}
+		if settings := gnomeSettings(snapshot); settings.Proxy != "" {
+			return settings, nil
+		}
+	}
+	if kde != "" {
+		content, err := os.ReadFile(kde)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Settings{}, err
+		}
+		return kdeSettings(string(content)), nil
+	}
+	return Settings{}, nil
+}
+
+// saveSystem records the GNOME proxy keys and the KDE kioslaverc file.
+func saveSystem() (json.RawMessage, error) {
+	var snapshot desktopSnapshot
+	if hasGNOME() {
+		gnome, err := readGNOME()
+		if err != nil {
+			return nil, err
+		}
+		snapshot.GNOME = gnome
+	}
+	if path := kioslavercPath(); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		snapshot.KDE = &kdeSnapshot{Exists: err == nil, Content: string(content)}
+	}
+	if snapshot.GNOME == nil && snapshot.KDE == nil {
+		return nil, ErrNotSupported
+	}
+	return json.Marshal(snapshot)
+}
+
+// setSystem sets addr as the manual HTTP and HTTPS proxy of GNOME and KDE.
+func setSystem(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if hasGNOME() {
+		for _, kv := range [][3]string{
+			{"org.gnome.system.proxy.http", "host", host},
+			{"org.gnome.system.proxy.http", "port", port},
+			{"org.gnome.system.proxy.https", "host", host},
+			{"org.gnome.system.proxy.https", "port", port},
+			{"org.gnome.system.proxy", "mode", "manual"},
+		} {
+			if err := gsettings("set", kv[0], kv[1], kv[2]); err != nil {
+				return err
+			}
+		}
+	}
+	if path := kioslavercPath(); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		proxy := "http://" + host + " " + port
+		content = []byte(setINIKeys(string(content), "Proxy Settings", [][2]string{
+			{"ProxyType", "1"},
+			{"httpProxy", proxy},
+			{"httpsProxy", proxy},
+		}))
+		if err := writeKioslaverc(path, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreSystem(snapshot json.RawMessage) error {
+	var s desktopSnapshot
+	if err := json.Unmarshal(snapshot, &s); err != nil {
+		return err
+	}
+	for _, key := range gnomeKeys {
+		if value, ok := s.GNOME[key[0]+" "+key[1]]; ok {
+			if err := gsettings("set", key[0], key[1], value); err != nil {
+				return err
+			}
+		}
+	}
+	if s.KDE != nil {
+		path := kioslavercPath()
+		if path == "" {
+			return nil
+		}
+		if !s.KDE.Exists {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			notifyKIO()
+			return nil
+		}
+		return writeKioslaverc(path, []byte(s.KDE.Content))
+	}
+	return nil
+}
+
+func hasGNOME() bool {
+	_, err := exec.LookPath("gsettings")
+	return err == nil
+}
+
+func readGNOME() (gnomeSnapshot, error) {
+	snapshot := gnomeSnapshot{}
+	for _, key := range gnomeKeys {
+		out, err := exec.Command("gsettings", "get", key[0], key[1]).Output()
+		if err != nil {
+			return nil, fmt.Errorf("gsettings get %s %s: %w", key[0], key[1], err)
+		}
+		snapshot[key[0]+" "+key[1]] = strings.TrimSpace(string(out))
+	}
+	return snapshot, nil
+}
+
+func gsettings(args ...string) error {
+	out, err := exec.Command("gsettings", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gsettings %s: %w: %s", strings.Join(args[:3], " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// kioslavercPath returns the KDE proxy configuration file when running
+// under KDE or when the file already exists, and "" otherwise.
+func kioslavercPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	path := filepath.Join(dir, "kioslaverc")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	if strings.Contains(strings.ToUpper(os.Getenv("XDG_CURRENT_DESKTOP")), "KDE") {
+		return path
+	}
+	return ""
+}
+
+func writeKioslaverc(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return err
+	}
+	notifyKIO()
+	return nil
+}
+
+// notifyKIO asks running KDE applications to reload their proxy settings.
+// It is best effort: without a session bus they pick the file up on their
+// next start.
+func notifyKIO() {
+	_ = exec.Command("dbus-send", "--type=signal", "/KIO/Scheduler",
+		"org.kde.KIO.Scheduler.reparseSlaveConfiguration", "string:").Run()
+}
@@ -0,0 +1,21 @@
+//go:build !windows && !darwin && !linux
+
+package sysproxy
+
+import "encoding/json"
+
+func readSystem() (Settings, error) {
+	return Settings{}, ErrNotSupported
+}
+
+func saveSystem() (json.RawMessage, error) {
+	return nil, ErrNotSupported
+}
+
+func setSystem(addr string) error {
+	return ErrNotSupported
+}
+
+func restoreSystem(snapshot json.RawMessage) error {
+	return ErrNotSupported
+}
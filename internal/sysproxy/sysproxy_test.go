@@ -0,0 +1,72 @@
+package sysproxy
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestParseProxyServer(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"proxy.corp:8080", "proxy.corp:8080"},
+		{"http://proxy.corp:8080/", "proxy.corp:8080"},
+		{"http=web.corp:8080;https=secure.corp:8443;ftp=ftp.corp:21", "secure.corp:8443"},
+		{"ftp=ftp.corp:21;http=web.corp:8080", "web.corp:8080"},
+		{"socks=socks.corp:1080", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseProxyServer(tt.value); got != tt.expected {
+			t.Errorf("parseProxyServer(%q) = %q; expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestParseBypass(t *testing.T) {
+	expected := []string{"*.corp.example", "10.*", "<local>"}
+	if got := parseBypass("*.corp.example; 10.*;<local>;"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parseBypass = %v; expected %v", got, expected)
+	}
+}
+
+func TestParseWinHTTPSettings(t *testing.T) {
+	encode := func(flags uint32, proxy, bypass string) []byte {
+		b := binary.LittleEndian.AppendUint32(nil, 0x28)
+		b = binary.LittleEndian.AppendUint32(b, 7)
+		b = binary.LittleEndian.AppendUint32(b, flags)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(proxy)))
+		b = append(b, proxy...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(bypass)))
+		return append(b, bypass...)
+	}
+
+	got, ok := parseWinHTTPSettings(encode(0x3, "proxy.corp:8080", "*.corp.example;<local>"))
+	expected := Settings{Proxy: "proxy.corp:8080", Bypass: []string{"*.corp.example", "<local>"}}
+	if !ok || !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parseWinHTTPSettings = %+v, %v; expected %+v", got, ok, expected)
+	}
+
+	if got, ok := parseWinHTTPSettings(encode(0x1, "", "")); !ok || got.Proxy != "" {
+		t.Fatalf("direct WinHTTP settings = %+v, %v; expected no proxy", got, ok)
+	}
+	if _, ok := parseWinHTTPSettings([]byte{1, 2, 3}); ok {
+		t.Fatalf("expected truncated settings to be rejected")
+	}
+}
+
+func TestReadReturnsSavedOriginal(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	original := Settings{Proxy: "proxy.corp:8080", Bypass: []string{"<local>"}}
+	if err := writeState(savedState{Original: original, Restore: []byte("null")}); err != nil {
+		t.Fatalf("writeState: %v", err)
+	}
+	got, err := Read()
+	if err != nil || !reflect.DeepEqual(got, original) {
+		t.Fatalf("Read = %+v, %v; expected the saved original %+v", got, err, original)
+	}
+}
@@ -0,0 +1,72 @@
+package sysproxy
+
+import (
+	"encoding/json"
+	"errors"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	userSettingsKey    = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+	winHTTPSettingsKey = `SOFTWARE\Microsoft\Windows\CurrentVersion\Internet Settings\Connections`
+)
+
+// readSystem returns the proxy configured for the current user (Internet
+// Options, as used by browsers), falling back to the machine-wide WinHTTP
+// proxy set with "netsh winhttp set proxy".
+func readSystem() (Settings, error) {
+	if s, ok, err := readUserSettings(); err != nil || ok {
+		return s, err
+	}
+	return readWinHTTPSettings()
+}
+
+func readUserSettings() (Settings, bool, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, userSettingsKey, registry.QUERY_VALUE)
+	if err != nil {
+		return Settings{}, false, nil
+	}
+	defer k.Close()
+	if enabled, _, err := k.GetIntegerValue("ProxyEnable"); err != nil || enabled == 0 {
+		return Settings{}, false, nil
+	}
+	server, _, err := k.GetStringValue("ProxyServer")
+	if err != nil {
+		return Settings{}, false, err
+	}
+	override, _, err := k.GetStringValue("ProxyOverride")
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return Settings{}, false, err
+	}
+	return Settings{Proxy: parseProxyServer(server), Bypass: parseBypass(override)}, true, nil
+}
+
+func readWinHTTPSettings() (Settings, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, winHTTPSettingsKey, registry.QUERY_VALUE)
+	if err != nil {
+		return Settings{}, nil
+	}
+	defer k.Close()
+	value, _, err := k.GetBinaryValue("WinHttpSettings")
+	if err != nil {
+		return Settings{}, nil
+	}
+	s, ok := parseWinHTTPSettings(value)
+	if !ok {
+		return Settings{}, errors.New("malformed WinHttpSettings registry value")
+	}
+	return s, nil
+}
+
+func saveSystem() (json.RawMessage, error) {
+	return nil, ErrNotSupported
+}
+
+func setSystem(addr string) error {
+	return ErrNotSupported
+}
+
+func restoreSystem(snapshot json.RawMessage) error {
+	return ErrNotSupported
+}
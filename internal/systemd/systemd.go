@@ -0,0 +1,116 @@
+// Package systemd implements the parts of the systemd service protocol the
+// proxy uses: socket activation (sd_listen_fds), readiness and status
+// notifications (sd_notify) and watchdog keep-alives. Outside of systemd
+// every function is a no-op.
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification states, see sd_notify(3).
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+	Watchdog  = "WATCHDOG=1"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed in by systemd socket activation, keyed
+// by their FileDescriptorName=. Sockets without a name are called "proxy",
+// "proxy2" and so on, so that a plain .socket unit activates the proxy port.
+// The environment variables are cleared so that child processes do not
+// inherit them.
+func Listeners() map[string]*os.File {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	fds := listenFDs(os.Getpid(), os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+	files := make(map[string]*os.File, len(fds))
+	for name, fd := range fds {
+		files[name] = os.NewFile(uintptr(fd), name)
+	}
+	return files
+}
+
+// listenFDs maps socket names to file descriptors from the LISTEN_*
+// variables, which only apply if LISTEN_PID is this process.
+func listenFDs(pid int, listenPID, listenFDs, listenFDNames string) map[string]int {
+	if p, err := strconv.Atoi(listenPID); err != nil || p != pid {
+		return nil
+	}
+	n, err := strconv.Atoi(listenFDs)
+	if err != nil || n <= 0 {
+		return nil
+	}
+	names := strings.Split(listenFDNames, ":")
+	fds := make(map[string]int, n)
+	unnamed := 0
+	for i := range n {
+		name := ""
+		if i < len(names) && names[i] != "unknown" {
+			name = names[i]
+		}
+		if name == "" {
+			unnamed++
+			name = "proxy"
+			if unnamed > 1 {
+				name += strconv.Itoa(unnamed)
+			}
+		}
+		fds[name] = listenFDsStart + i
+	}
+	return fds
+}
+
+// Notify sends newline-separated state assignments to the service manager.
+// It does nothing if the process was not started with NOTIFY_SOCKET.
+func Notify(state ...string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(state, "\n")))
+	return err
+}
+
+// MainPID tells the service manager that pid is now the main process, as
+// after a binary upgrade. The unit needs NotifyAccess=all for it to be
+// accepted from a new process.
+func MainPID(pid int) string {
+	return "MAINPID=" + strconv.Itoa(pid)
+}
+
+// WatchdogInterval returns how often the service manager expects a Watchdog
+// notification, or 0 if the watchdog is not enabled for this process.
+// WATCHDOG_PID is cleared, so that a process started by a binary upgrade,
+// which takes over as the main process, keeps the watchdog fed.
+func WatchdogInterval() time.Duration {
+	pid := os.Getenv("WATCHDOG_PID")
+	os.Unsetenv("WATCHDOG_PID")
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListenFDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		pid      string
+		fds      string
+		names    string
+		expected map[string]int
+	}{
+		{"named", "42", "3", "proxy:admin:grpc", map[string]int{"proxy": 3, "admin": 4, "grpc": 5}},
+		{"unnamed", "42", "2", "", map[string]int{"proxy": 3, "proxy2": 4}},
+		{"unknown names", "42", "2", "unknown:admin", map[string]int{"proxy": 3, "admin": 4}},
+		{"other process", "41", "1", "proxy", nil},
+		{"no sockets", "42", "0", "", nil},
+	}
+
+	for _, tt := range tests {
+		if got := listenFDs(42, tt.pid, tt.fds, tt.names); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: listenFDs = %v; expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if err := Notify(Ready, MainPID(1234)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := string(buf[:n]); got != "READY=1\nMAINPID=1234" {
+		t.Fatalf("notification = %q; expected READY=1 and MAINPID", got)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify(Ready); err != nil {
+		t.Fatalf("Notify outside systemd = %v; expected nil", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if got := WatchdogInterval(); got != 30*time.Second {
+		t.Fatalf("WatchdogInterval = %v; expected 30s", got)
+	}
+	t.Setenv("WATCHDOG_PID", "1")
+	if got := WatchdogInterval(); got != 0 {
+		t.Fatalf("WatchdogInterval for another process = %v; expected 0", got)
+	}
+}
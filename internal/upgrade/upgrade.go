@@ -0,0 +1,209 @@
+// Package upgrade implements zero-downtime binary upgrades. The running
+// process starts the new binary with its listening sockets inherited as
+// file descriptors, waits until the new process is serving and then drains
+// and exits, so no connection is refused and no tunnel is cut during a
+// fleet upgrade.
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// envListeners lists inherited listeners as name:fd pairs.
+	envListeners = "DYNAMICPROXY_LISTEN_FDS"
+	// envReady names the fd the new process writes to once it is serving.
+	envReady = "DYNAMICPROXY_READY_FD"
+)
+
+// ErrNotSupported is returned by Upgrade on platforms that cannot pass
+// sockets to a child process.
+var ErrNotSupported = errors.New("binary upgrade is not supported on this platform")
+
+// Upgrader hands listeners from one process generation to the next.
+type Upgrader struct {
+	mu        sync.Mutex
+	inherited map[string]*os.File
+	listeners map[string]net.Listener
+	ready     *os.File
+}
+
+// New returns an Upgrader that picks up the listeners and readiness pipe
+// passed in by a parent process, if any.
+func New() *Upgrader {
+	u := &Upgrader{inherited: map[string]*os.File{}, listeners: map[string]net.Listener{}}
+	for _, pair := range strings.Split(os.Getenv(envListeners), ",") {
+		name, fd, ok := parseFD(pair)
+		if ok {
+			u.inherited[name] = os.NewFile(fd, name)
+		}
+	}
+	if fd, err := strconv.ParseUint(os.Getenv(envReady), 10, 64); err == nil {
+		u.ready = os.NewFile(uintptr(fd), "ready")
+	}
+	os.Unsetenv(envListeners)
+	os.Unsetenv(envReady)
+	return u
+}
+
+// Inherit adds f as the listener called name unless the parent process
+// already handed one over, e.g. for sockets passed by systemd.
+func (u *Upgrader) Inherit(name string, f *os.File) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.inherited[name]; ok {
+		f.Close()
+		return
+	}
+	u.inherited[name] = f
+}
+
+func parseFD(pair string) (string, uintptr, bool) {
+	name, fd, ok := strings.Cut(strings.TrimSpace(pair), ":")
+	if !ok || name == "" {
+		return "", 0, false
+	}
+	n, err := strconv.ParseUint(fd, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return name, uintptr(n), true
+}
+
+// Listen returns the listener called name handed over by the parent
+// process, or opens a new TCP listener on addr.
+func (u *Upgrader) Listen(name, addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var l net.Listener
+	var err error
+	if f, ok := u.inherited[name]; ok {
+		delete(u.inherited, name)
+		l, err = net.FileListener(f)
+		f.Close()
+	} else {
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.listeners[name] = l
+	return l, nil
+}
+
+// Ready tells the parent process, if any, that this process is serving and
+// the parent may start draining.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, f := range u.inherited {
+		f.Close()
+	}
+	u.inherited = map[string]*os.File{}
+	if u.ready == nil {
+		return nil
+	}
+	defer func() { u.ready = nil }()
+	defer u.ready.Close()
+	_, err := u.ready.Write([]byte{1})
+	return err
+}
+
+// Upgrade starts the current executable with the same arguments and the
+// listeners opened through Listen, and waits up to timeout for it to call
+// Ready. When Upgrade returns nil the caller should stop accepting, drain
+// its connections and exit.
+func (u *Upgrader) Upgrade(timeout time.Duration) error {
+	if !supported {
+		return ErrNotSupported
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	names := make([]string, 0, len(u.listeners))
+	for name := range u.listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var files []*os.File
+	var fds []string
+	for i, name := range names {
+		f, err := listenerFile(u.listeners[name])
+		if err != nil {
+			u.mu.Unlock()
+			closeAll(files)
+			return fmt.Errorf("listener %s: %w", name, err)
+		}
+		files = append(files, f)
+		fds = append(fds, fmt.Sprintf("%s:%d", name, 3+i))
+	}
+	u.mu.Unlock()
+	defer closeAll(files)
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(os.Environ(),
+		envListeners+"="+strings.Join(fds, ","),
+		fmt.Sprintf("%s=%d", envReady, 3+len(files)),
+	)
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := readyR.Read(buf); err != nil {
+			result <- fmt.Errorf("new process exited before it was ready: %w", err)
+			return
+		}
+		result <- nil
+	}()
+	select {
+	case err = <-result:
+	case <-time.After(timeout):
+		err = fmt.Errorf("new process not ready after %v", timeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		go func() { _ = cmd.Wait() }()
+		return err
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+func listenerFile(l net.Listener) (*os.File, error) {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("%T cannot be passed on", l)
+	}
+	return fl.File()
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package upgrade
+
+import "os"
+
+const supported = false
+
+// Signal is nil where upgrades are not supported.
+var Signal os.Signal
@@ -0,0 +1,64 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestListenTakesOverInheritedListener(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("listener file: %v", err)
+	}
+
+	t.Setenv(envListeners, fmt.Sprintf("proxy:%d", f.Fd()))
+	u := New()
+
+	l, err := u.Listen("proxy", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	if l.Addr().String() != parent.Addr().String() {
+		t.Fatalf("inherited listener on %s; expected %s", l.Addr(), parent.Addr())
+	}
+
+	other, err := u.Listen("admin", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen without inherited socket: %v", err)
+	}
+	defer other.Close()
+	if other.Addr().String() == parent.Addr().String() {
+		t.Fatal("listener without inherited socket reused the proxy socket")
+	}
+}
+
+func TestParseFD(t *testing.T) {
+	tests := []struct {
+		pair string
+		name string
+		fd   uintptr
+		ok   bool
+	}{
+		{"proxy:3", "proxy", 3, true},
+		{" admin:4 ", "admin", 4, true},
+		{"proxy", "", 0, false},
+		{":3", "", 0, false},
+		{"proxy:x", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		name, fd, ok := parseFD(tt.pair)
+		if name != tt.name || fd != tt.fd || ok != tt.ok {
+			t.Errorf("parseFD(%q) = %q, %d, %v; expected %q, %d, %v", tt.pair, name, fd, ok, tt.name, tt.fd, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"os"
+	"syscall"
+)
+
+const supported = true
+
+// Signal requests an upgrade of a running process.
+var Signal os.Signal = syscall.SIGUSR2
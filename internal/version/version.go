@@ -0,0 +1,78 @@
+// Package version reports build metadata of the running binary.
+//
+// Release builds set the variables below via ldflags:
+//
+//	go build -ldflags "-X github.com/cavoq/DynamicProxy/internal/version.Version=v1.2.3 \
+//	  -X github.com/cavoq/DynamicProxy/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/cavoq/DynamicProxy/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Values left empty are filled in from the module and VCS information Go
+// embeds in the binary, where available.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				if s.Value == "true" && Commit == "" && info.Commit != "" {
+					info.Commit += "-dirty"
+				}
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("dynamicproxy %s (commit %s, built %s, %s, %s)", i.Version, i.Commit, i.Date, i.GoVersion, i.Platform)
+}
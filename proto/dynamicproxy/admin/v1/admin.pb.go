@@ -0,0 +1,2954 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: dynamicproxy/admin/v1/admin.proto
+
+package adminv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ConnEvent_Type int32
+
+const (
+	ConnEvent_TYPE_UNSPECIFIED ConnEvent_Type = 0
+	ConnEvent_TYPE_STARTED     ConnEvent_Type = 1
+	ConnEvent_TYPE_FINISHED    ConnEvent_Type = 2
+)
+
+// Enum value maps for ConnEvent_Type.
+var (
+	ConnEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_STARTED",
+		2: "TYPE_FINISHED",
+	}
+	ConnEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"TYPE_STARTED":     1,
+		"TYPE_FINISHED":    2,
+	}
+)
+
+func (x ConnEvent_Type) Enum() *ConnEvent_Type {
+	p := new(ConnEvent_Type)
+	*p = x
+	return p
+}
+
+func (x ConnEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ConnEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_dynamicproxy_admin_v1_admin_proto_enumTypes[0].Descriptor()
+}
+
+func (ConnEvent_Type) Type() protoreflect.EnumType {
+	return &file_dynamicproxy_admin_v1_admin_proto_enumTypes[0]
+}
+
+func (x ConnEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ConnEvent_Type.Descriptor instead.
+func (ConnEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{28, 0}
+}
+
+type Config struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	UpstreamProxy   string                 `protobuf:"bytes,1,opt,name=upstream_proxy,json=upstreamProxy,proto3" json:"upstream_proxy,omitempty"`
+	ProxyExceptions []string               `protobuf:"bytes,2,rep,name=proxy_exceptions,json=proxyExceptions,proto3" json:"proxy_exceptions,omitempty"`
+	ListenAddr      string                 `protobuf:"bytes,3,opt,name=listen_addr,json=listenAddr,proto3" json:"listen_addr,omitempty"`
+	ProxyAuth       string                 `protobuf:"bytes,4,opt,name=proxy_auth,json=proxyAuth,proto3" json:"proxy_auth,omitempty"`
+	FailOpen        bool                   `protobuf:"varint,5,opt,name=fail_open,json=failOpen,proto3" json:"fail_open,omitempty"`
+	ConfigFile      string                 `protobuf:"bytes,6,opt,name=config_file,json=configFile,proto3" json:"config_file,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Config) Reset() {
+	*x = Config{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Config) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Config) ProtoMessage() {}
+
+func (x *Config) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Config.ProtoReflect.Descriptor instead.
+func (*Config) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Config) GetUpstreamProxy() string {
+	if x != nil {
+		return x.UpstreamProxy
+	}
+	return ""
+}
+
+func (x *Config) GetProxyExceptions() []string {
+	if x != nil {
+		return x.ProxyExceptions
+	}
+	return nil
+}
+
+func (x *Config) GetListenAddr() string {
+	if x != nil {
+		return x.ListenAddr
+	}
+	return ""
+}
+
+func (x *Config) GetProxyAuth() string {
+	if x != nil {
+		return x.ProxyAuth
+	}
+	return ""
+}
+
+func (x *Config) GetFailOpen() bool {
+	if x != nil {
+		return x.FailOpen
+	}
+	return false
+}
+
+func (x *Config) GetConfigFile() string {
+	if x != nil {
+		return x.ConfigFile
+	}
+	return ""
+}
+
+type GetVersionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetVersionRequest) Reset() {
+	*x = GetVersionRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetVersionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetVersionRequest) ProtoMessage() {}
+
+func (x *GetVersionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetVersionRequest.ProtoReflect.Descriptor instead.
+func (*GetVersionRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{1}
+}
+
+type VersionInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Commit        string                 `protobuf:"bytes,2,opt,name=commit,proto3" json:"commit,omitempty"`
+	Date          string                 `protobuf:"bytes,3,opt,name=date,proto3" json:"date,omitempty"`
+	GoVersion     string                 `protobuf:"bytes,4,opt,name=go_version,json=goVersion,proto3" json:"go_version,omitempty"`
+	Platform      string                 `protobuf:"bytes,5,opt,name=platform,proto3" json:"platform,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VersionInfo) Reset() {
+	*x = VersionInfo{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VersionInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VersionInfo) ProtoMessage() {}
+
+func (x *VersionInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VersionInfo.ProtoReflect.Descriptor instead.
+func (*VersionInfo) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *VersionInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *VersionInfo) GetCommit() string {
+	if x != nil {
+		return x.Commit
+	}
+	return ""
+}
+
+func (x *VersionInfo) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *VersionInfo) GetGoVersion() string {
+	if x != nil {
+		return x.GoVersion
+	}
+	return ""
+}
+
+func (x *VersionInfo) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+type GetConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigRequest) Reset() {
+	*x = GetConfigRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigRequest) ProtoMessage() {}
+
+func (x *GetConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetConfigRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{3}
+}
+
+type ListExceptionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListExceptionsRequest) Reset() {
+	*x = ListExceptionsRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListExceptionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListExceptionsRequest) ProtoMessage() {}
+
+func (x *ListExceptionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListExceptionsRequest.ProtoReflect.Descriptor instead.
+func (*ListExceptionsRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{4}
+}
+
+type ListExceptionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Patterns      []string               `protobuf:"bytes,1,rep,name=patterns,proto3" json:"patterns,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListExceptionsResponse) Reset() {
+	*x = ListExceptionsResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListExceptionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListExceptionsResponse) ProtoMessage() {}
+
+func (x *ListExceptionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListExceptionsResponse.ProtoReflect.Descriptor instead.
+func (*ListExceptionsResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListExceptionsResponse) GetPatterns() []string {
+	if x != nil {
+		return x.Patterns
+	}
+	return nil
+}
+
+type AddExceptionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pattern       string                 `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddExceptionRequest) Reset() {
+	*x = AddExceptionRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddExceptionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddExceptionRequest) ProtoMessage() {}
+
+func (x *AddExceptionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddExceptionRequest.ProtoReflect.Descriptor instead.
+func (*AddExceptionRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AddExceptionRequest) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+type DeleteExceptionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pattern       string                 `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteExceptionRequest) Reset() {
+	*x = DeleteExceptionRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteExceptionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteExceptionRequest) ProtoMessage() {}
+
+func (x *DeleteExceptionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteExceptionRequest.ProtoReflect.Descriptor instead.
+func (*DeleteExceptionRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteExceptionRequest) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+type SetUpstreamRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Upstream      string                 `protobuf:"bytes,1,opt,name=upstream,proto3" json:"upstream,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetUpstreamRequest) Reset() {
+	*x = SetUpstreamRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetUpstreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetUpstreamRequest) ProtoMessage() {}
+
+func (x *SetUpstreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetUpstreamRequest.ProtoReflect.Descriptor instead.
+func (*SetUpstreamRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SetUpstreamRequest) GetUpstream() string {
+	if x != nil {
+		return x.Upstream
+	}
+	return ""
+}
+
+type ListUpstreamsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUpstreamsRequest) Reset() {
+	*x = ListUpstreamsRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUpstreamsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUpstreamsRequest) ProtoMessage() {}
+
+func (x *ListUpstreamsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUpstreamsRequest.ProtoReflect.Descriptor instead.
+func (*ListUpstreamsRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{9}
+}
+
+type ListUpstreamsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Upstreams     []*UpstreamHealth      `protobuf:"bytes,1,rep,name=upstreams,proto3" json:"upstreams,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUpstreamsResponse) Reset() {
+	*x = ListUpstreamsResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUpstreamsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUpstreamsResponse) ProtoMessage() {}
+
+func (x *ListUpstreamsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUpstreamsResponse.ProtoReflect.Descriptor instead.
+func (*ListUpstreamsResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListUpstreamsResponse) GetUpstreams() []*UpstreamHealth {
+	if x != nil {
+		return x.Upstreams
+	}
+	return nil
+}
+
+type UpstreamHealth struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Addr    string                 `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Healthy bool                   `protobuf:"varint,2,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	// "closed", "open" or "half-open".
+	Circuit       string                 `protobuf:"bytes,3,opt,name=circuit,proto3" json:"circuit,omitempty"`
+	LastCheck     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_check,json=lastCheck,proto3" json:"last_check,omitempty"`
+	Latency       *durationpb.Duration   `protobuf:"bytes,5,opt,name=latency,proto3" json:"latency,omitempty"`
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpstreamHealth) Reset() {
+	*x = UpstreamHealth{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpstreamHealth) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpstreamHealth) ProtoMessage() {}
+
+func (x *UpstreamHealth) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpstreamHealth.ProtoReflect.Descriptor instead.
+func (*UpstreamHealth) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UpstreamHealth) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *UpstreamHealth) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+func (x *UpstreamHealth) GetCircuit() string {
+	if x != nil {
+		return x.Circuit
+	}
+	return ""
+}
+
+func (x *UpstreamHealth) GetLastCheck() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastCheck
+	}
+	return nil
+}
+
+func (x *UpstreamHealth) GetLatency() *durationpb.Duration {
+	if x != nil {
+		return x.Latency
+	}
+	return nil
+}
+
+func (x *UpstreamHealth) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type SetFailOpenRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Enabled       bool                   `protobuf:"varint,1,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetFailOpenRequest) Reset() {
+	*x = SetFailOpenRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetFailOpenRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetFailOpenRequest) ProtoMessage() {}
+
+func (x *SetFailOpenRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetFailOpenRequest.ProtoReflect.Descriptor instead.
+func (*SetFailOpenRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SetFailOpenRequest) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+type GetDNSCacheRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDNSCacheRequest) Reset() {
+	*x = GetDNSCacheRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDNSCacheRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDNSCacheRequest) ProtoMessage() {}
+
+func (x *GetDNSCacheRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDNSCacheRequest.ProtoReflect.Descriptor instead.
+func (*GetDNSCacheRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{13}
+}
+
+type DNSCacheStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       int64                  `protobuf:"varint,1,opt,name=entries,proto3" json:"entries,omitempty"`
+	Hits          uint64                 `protobuf:"varint,2,opt,name=hits,proto3" json:"hits,omitempty"`
+	Misses        uint64                 `protobuf:"varint,3,opt,name=misses,proto3" json:"misses,omitempty"`
+	NegativeHits  uint64                 `protobuf:"varint,4,opt,name=negative_hits,json=negativeHits,proto3" json:"negative_hits,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DNSCacheStats) Reset() {
+	*x = DNSCacheStats{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DNSCacheStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSCacheStats) ProtoMessage() {}
+
+func (x *DNSCacheStats) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSCacheStats.ProtoReflect.Descriptor instead.
+func (*DNSCacheStats) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *DNSCacheStats) GetEntries() int64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *DNSCacheStats) GetHits() uint64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *DNSCacheStats) GetMisses() uint64 {
+	if x != nil {
+		return x.Misses
+	}
+	return 0
+}
+
+func (x *DNSCacheStats) GetNegativeHits() uint64 {
+	if x != nil {
+		return x.NegativeHits
+	}
+	return 0
+}
+
+type PurgeDNSCacheRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurgeDNSCacheRequest) Reset() {
+	*x = PurgeDNSCacheRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgeDNSCacheRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgeDNSCacheRequest) ProtoMessage() {}
+
+func (x *PurgeDNSCacheRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgeDNSCacheRequest.ProtoReflect.Descriptor instead.
+func (*PurgeDNSCacheRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{15}
+}
+
+type PurgeDNSCacheResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The number of entries removed.
+	Purged        int64 `protobuf:"varint,1,opt,name=purged,proto3" json:"purged,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurgeDNSCacheResponse) Reset() {
+	*x = PurgeDNSCacheResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgeDNSCacheResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgeDNSCacheResponse) ProtoMessage() {}
+
+func (x *PurgeDNSCacheResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgeDNSCacheResponse.ProtoReflect.Descriptor instead.
+func (*PurgeDNSCacheResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *PurgeDNSCacheResponse) GetPurged() int64 {
+	if x != nil {
+		return x.Purged
+	}
+	return 0
+}
+
+type ReloadRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadRequest) Reset() {
+	*x = ReloadRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadRequest) ProtoMessage() {}
+
+func (x *ReloadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadRequest.ProtoReflect.Descriptor instead.
+func (*ReloadRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{17}
+}
+
+type ReloadResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Changes       []*ConfigChange        `protobuf:"bytes,1,rep,name=changes,proto3" json:"changes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadResponse) Reset() {
+	*x = ReloadResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadResponse) ProtoMessage() {}
+
+func (x *ReloadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadResponse.ProtoReflect.Descriptor instead.
+func (*ReloadResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ReloadResponse) GetChanges() []*ConfigChange {
+	if x != nil {
+		return x.Changes
+	}
+	return nil
+}
+
+type ConfigChange struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Field string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Old   string                 `protobuf:"bytes,2,opt,name=old,proto3" json:"old,omitempty"`
+	New   string                 `protobuf:"bytes,3,opt,name=new,proto3" json:"new,omitempty"`
+	// Set for settings that only take effect after a restart.
+	RestartRequired bool `protobuf:"varint,4,opt,name=restart_required,json=restartRequired,proto3" json:"restart_required,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ConfigChange) Reset() {
+	*x = ConfigChange{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigChange) ProtoMessage() {}
+
+func (x *ConfigChange) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigChange.ProtoReflect.Descriptor instead.
+func (*ConfigChange) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ConfigChange) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *ConfigChange) GetOld() string {
+	if x != nil {
+		return x.Old
+	}
+	return ""
+}
+
+func (x *ConfigChange) GetNew() string {
+	if x != nil {
+		return x.New
+	}
+	return ""
+}
+
+func (x *ConfigChange) GetRestartRequired() bool {
+	if x != nil {
+		return x.RestartRequired
+	}
+	return false
+}
+
+type GetActivityRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetActivityRequest) Reset() {
+	*x = GetActivityRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetActivityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetActivityRequest) ProtoMessage() {}
+
+func (x *GetActivityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetActivityRequest.ProtoReflect.Descriptor instead.
+func (*GetActivityRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{20}
+}
+
+type Activity struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Active        []*ConnInfo            `protobuf:"bytes,1,rep,name=active,proto3" json:"active,omitempty"`
+	Recent        []*ConnInfo            `protobuf:"bytes,2,rep,name=recent,proto3" json:"recent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Activity) Reset() {
+	*x = Activity{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Activity) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Activity) ProtoMessage() {}
+
+func (x *Activity) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Activity.ProtoReflect.Descriptor instead.
+func (*Activity) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *Activity) GetActive() []*ConnInfo {
+	if x != nil {
+		return x.Active
+	}
+	return nil
+}
+
+func (x *Activity) GetRecent() []*ConnInfo {
+	if x != nil {
+		return x.Recent
+	}
+	return nil
+}
+
+type ConnInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// "http" or "tunnel".
+	Kind   string `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Client string `protobuf:"bytes,3,opt,name=client,proto3" json:"client,omitempty"`
+	Method string `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`
+	Host   string `protobuf:"bytes,5,opt,name=host,proto3" json:"host,omitempty"`
+	// "direct", "upstream" or "direct (fail-open)".
+	Route    string                 `protobuf:"bytes,6,opt,name=route,proto3" json:"route,omitempty"`
+	Status   int32                  `protobuf:"varint,7,opt,name=status,proto3" json:"status,omitempty"`
+	Error    string                 `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	Started  *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=started,proto3" json:"started,omitempty"`
+	Duration *durationpb.Duration   `protobuf:"bytes,10,opt,name=duration,proto3" json:"duration,omitempty"`
+	// Bytes from the client to the destination.
+	BytesSent int64 `protobuf:"varint,11,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`
+	// Bytes from the destination to the client.
+	BytesReceived int64 `protobuf:"varint,12,opt,name=bytes_received,json=bytesReceived,proto3" json:"bytes_received,omitempty"`
+	// The address connected to, the destination itself or an upstream.
+	Destination string `protobuf:"bytes,13,opt,name=destination,proto3" json:"destination,omitempty"`
+	// The server name a tunnel's TLS client asked for.
+	Sni string `protobuf:"bytes,14,opt,name=sni,proto3" json:"sni,omitempty"`
+	// The configured upstream that carried the connection.
+	Upstream string `protobuf:"bytes,15,opt,name=upstream,proto3" json:"upstream,omitempty"`
+	// How long it took to get the response headers, or to establish the
+	// tunnel.
+	Setup *durationpb.Duration `protobuf:"bytes,16,opt,name=setup,proto3" json:"setup,omitempty"`
+	// Fingerprints of the TLS client of a tunnel.
+	Ja3 string `protobuf:"bytes,17,opt,name=ja3,proto3" json:"ja3,omitempty"`
+	Ja4 string `protobuf:"bytes,18,opt,name=ja4,proto3" json:"ja4,omitempty"`
+	// Location of the destination host when GEOIP_DB is set.
+	Country string `protobuf:"bytes,19,opt,name=country,proto3" json:"country,omitempty"`
+	Asn     uint32 `protobuf:"varint,20,opt,name=asn,proto3" json:"asn,omitempty"`
+	// The THREAT_FEEDS feed listing the destination.
+	Threat string `protobuf:"bytes,21,opt,name=threat,proto3" json:"threat,omitempty"`
+	// The executable of the local client process when APP_ROUTES is set.
+	App           string `protobuf:"bytes,22,opt,name=app,proto3" json:"app,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnInfo) Reset() {
+	*x = ConnInfo{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnInfo) ProtoMessage() {}
+
+func (x *ConnInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnInfo.ProtoReflect.Descriptor instead.
+func (*ConnInfo) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ConnInfo) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ConnInfo) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *ConnInfo) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetStarted() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Started
+	}
+	return nil
+}
+
+func (x *ConnInfo) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *ConnInfo) GetBytesSent() int64 {
+	if x != nil {
+		return x.BytesSent
+	}
+	return 0
+}
+
+func (x *ConnInfo) GetBytesReceived() int64 {
+	if x != nil {
+		return x.BytesReceived
+	}
+	return 0
+}
+
+func (x *ConnInfo) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetSni() string {
+	if x != nil {
+		return x.Sni
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetUpstream() string {
+	if x != nil {
+		return x.Upstream
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetSetup() *durationpb.Duration {
+	if x != nil {
+		return x.Setup
+	}
+	return nil
+}
+
+func (x *ConnInfo) GetJa3() string {
+	if x != nil {
+		return x.Ja3
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetJa4() string {
+	if x != nil {
+		return x.Ja4
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetAsn() uint32 {
+	if x != nil {
+		return x.Asn
+	}
+	return 0
+}
+
+func (x *ConnInfo) GetThreat() string {
+	if x != nil {
+		return x.Threat
+	}
+	return ""
+}
+
+func (x *ConnInfo) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+type ListConnectionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsRequest) Reset() {
+	*x = ListConnectionsRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsRequest) ProtoMessage() {}
+
+func (x *ListConnectionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsRequest.ProtoReflect.Descriptor instead.
+func (*ListConnectionsRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{23}
+}
+
+type ListConnectionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Connections   []*ConnInfo            `protobuf:"bytes,1,rep,name=connections,proto3" json:"connections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsResponse) Reset() {
+	*x = ListConnectionsResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsResponse) ProtoMessage() {}
+
+func (x *ListConnectionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsResponse.ProtoReflect.Descriptor instead.
+func (*ListConnectionsResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ListConnectionsResponse) GetConnections() []*ConnInfo {
+	if x != nil {
+		return x.Connections
+	}
+	return nil
+}
+
+type CloseConnectionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseConnectionRequest) Reset() {
+	*x = CloseConnectionRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseConnectionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseConnectionRequest) ProtoMessage() {}
+
+func (x *CloseConnectionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseConnectionRequest.ProtoReflect.Descriptor instead.
+func (*CloseConnectionRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *CloseConnectionRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type CloseConnectionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseConnectionResponse) Reset() {
+	*x = CloseConnectionResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseConnectionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseConnectionResponse) ProtoMessage() {}
+
+func (x *CloseConnectionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseConnectionResponse.ProtoReflect.Descriptor instead.
+func (*CloseConnectionResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{26}
+}
+
+type StreamEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only events for destinations matching this pattern, written as in
+	// PROXY_EXCEPTIONS.
+	Host string `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	// Only events of this client, an address with or without the port.
+	Client        string `protobuf:"bytes,2,opt,name=client,proto3" json:"client,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *StreamEventsRequest) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *StreamEventsRequest) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+type ConnEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          ConnEvent_Type         `protobuf:"varint,1,opt,name=type,proto3,enum=dynamicproxy.admin.v1.ConnEvent_Type" json:"type,omitempty"`
+	Conn          *ConnInfo              `protobuf:"bytes,2,opt,name=conn,proto3" json:"conn,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnEvent) Reset() {
+	*x = ConnEvent{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnEvent) ProtoMessage() {}
+
+func (x *ConnEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnEvent.ProtoReflect.Descriptor instead.
+func (*ConnEvent) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *ConnEvent) GetType() ConnEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return ConnEvent_TYPE_UNSPECIFIED
+}
+
+func (x *ConnEvent) GetConn() *ConnInfo {
+	if x != nil {
+		return x.Conn
+	}
+	return nil
+}
+
+type ListClientsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListClientsRequest) Reset() {
+	*x = ListClientsRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListClientsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListClientsRequest) ProtoMessage() {}
+
+func (x *ListClientsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListClientsRequest.ProtoReflect.Descriptor instead.
+func (*ListClientsRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{29}
+}
+
+type ListClientsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Clients       []*ClientUsage         `protobuf:"bytes,1,rep,name=clients,proto3" json:"clients,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListClientsResponse) Reset() {
+	*x = ListClientsResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListClientsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListClientsResponse) ProtoMessage() {}
+
+func (x *ListClientsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListClientsResponse.ProtoReflect.Descriptor instead.
+func (*ListClientsResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *ListClientsResponse) GetClients() []*ClientUsage {
+	if x != nil {
+		return x.Clients
+	}
+	return nil
+}
+
+type ClientUsage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The authenticated user, or else the IP address.
+	Client        string `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	LastHour      int64  `protobuf:"varint,2,opt,name=last_hour,json=lastHour,proto3" json:"last_hour,omitempty"`
+	LastDay       int64  `protobuf:"varint,3,opt,name=last_day,json=lastDay,proto3" json:"last_day,omitempty"`
+	Last30Days    int64  `protobuf:"varint,4,opt,name=last30_days,json=last30Days,proto3" json:"last30_days,omitempty"`
+	QuotaExceeded bool   `protobuf:"varint,5,opt,name=quota_exceeded,json=quotaExceeded,proto3" json:"quota_exceeded,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClientUsage) Reset() {
+	*x = ClientUsage{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClientUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientUsage) ProtoMessage() {}
+
+func (x *ClientUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientUsage.ProtoReflect.Descriptor instead.
+func (*ClientUsage) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *ClientUsage) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *ClientUsage) GetLastHour() int64 {
+	if x != nil {
+		return x.LastHour
+	}
+	return 0
+}
+
+func (x *ClientUsage) GetLastDay() int64 {
+	if x != nil {
+		return x.LastDay
+	}
+	return 0
+}
+
+func (x *ClientUsage) GetLast30Days() int64 {
+	if x != nil {
+		return x.Last30Days
+	}
+	return 0
+}
+
+func (x *ClientUsage) GetQuotaExceeded() bool {
+	if x != nil {
+		return x.QuotaExceeded
+	}
+	return false
+}
+
+type ListThreatFeedsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListThreatFeedsRequest) Reset() {
+	*x = ListThreatFeedsRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListThreatFeedsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListThreatFeedsRequest) ProtoMessage() {}
+
+func (x *ListThreatFeedsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListThreatFeedsRequest.ProtoReflect.Descriptor instead.
+func (*ListThreatFeedsRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{32}
+}
+
+type ListThreatFeedsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Feeds         []*ThreatFeed          `protobuf:"bytes,1,rep,name=feeds,proto3" json:"feeds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListThreatFeedsResponse) Reset() {
+	*x = ListThreatFeedsResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListThreatFeedsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListThreatFeedsResponse) ProtoMessage() {}
+
+func (x *ListThreatFeedsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListThreatFeedsResponse.ProtoReflect.Descriptor instead.
+func (*ListThreatFeedsResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *ListThreatFeedsResponse) GetFeeds() []*ThreatFeed {
+	if x != nil {
+		return x.Feeds
+	}
+	return nil
+}
+
+type ThreatFeed struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The URL, without its query, or file path.
+	Feed    string `protobuf:"bytes,1,opt,name=feed,proto3" json:"feed,omitempty"`
+	Entries int64  `protobuf:"varint,2,opt,name=entries,proto3" json:"entries,omitempty"`
+	// Requests and tunnels to destinations the feed lists.
+	Hits int64 `protobuf:"varint,3,opt,name=hits,proto3" json:"hits,omitempty"`
+	// When the feed was last loaded or found unchanged; unset before then.
+	Updated       *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=updated,proto3" json:"updated,omitempty"`
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ThreatFeed) Reset() {
+	*x = ThreatFeed{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ThreatFeed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ThreatFeed) ProtoMessage() {}
+
+func (x *ThreatFeed) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ThreatFeed.ProtoReflect.Descriptor instead.
+func (*ThreatFeed) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *ThreatFeed) GetFeed() string {
+	if x != nil {
+		return x.Feed
+	}
+	return ""
+}
+
+func (x *ThreatFeed) GetEntries() int64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *ThreatFeed) GetHits() int64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *ThreatFeed) GetUpdated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Updated
+	}
+	return nil
+}
+
+func (x *ThreatFeed) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type GetLatencyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLatencyRequest) Reset() {
+	*x = GetLatencyRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLatencyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLatencyRequest) ProtoMessage() {}
+
+func (x *GetLatencyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLatencyRequest.ProtoReflect.Descriptor instead.
+func (*GetLatencyRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{35}
+}
+
+type GetLatencyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Histograms    []*LatencyHistogram    `protobuf:"bytes,1,rep,name=histograms,proto3" json:"histograms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLatencyResponse) Reset() {
+	*x = GetLatencyResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLatencyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLatencyResponse) ProtoMessage() {}
+
+func (x *GetLatencyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLatencyResponse.ProtoReflect.Descriptor instead.
+func (*GetLatencyResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *GetLatencyResponse) GetHistograms() []*LatencyHistogram {
+	if x != nil {
+		return x.Histograms
+	}
+	return nil
+}
+
+type LatencyHistogram struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "http" or "tunnel".
+	Kind  string `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Route string `protobuf:"bytes,2,opt,name=route,proto3" json:"route,omitempty"`
+	// Set for the upstream route.
+	Upstream string               `protobuf:"bytes,3,opt,name=upstream,proto3" json:"upstream,omitempty"`
+	Count    int64                `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
+	Sum      *durationpb.Duration `protobuf:"bytes,5,opt,name=sum,proto3" json:"sum,omitempty"`
+	// Cumulative, as in Prometheus: each bucket counts the setups that took at
+	// most le. count includes the slower ones.
+	Buckets       []*LatencyBucket `protobuf:"bytes,6,rep,name=buckets,proto3" json:"buckets,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LatencyHistogram) Reset() {
+	*x = LatencyHistogram{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LatencyHistogram) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LatencyHistogram) ProtoMessage() {}
+
+func (x *LatencyHistogram) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LatencyHistogram.ProtoReflect.Descriptor instead.
+func (*LatencyHistogram) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *LatencyHistogram) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *LatencyHistogram) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *LatencyHistogram) GetUpstream() string {
+	if x != nil {
+		return x.Upstream
+	}
+	return ""
+}
+
+func (x *LatencyHistogram) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *LatencyHistogram) GetSum() *durationpb.Duration {
+	if x != nil {
+		return x.Sum
+	}
+	return nil
+}
+
+func (x *LatencyHistogram) GetBuckets() []*LatencyBucket {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
+
+type LatencyBucket struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Le            *durationpb.Duration   `protobuf:"bytes,1,opt,name=le,proto3" json:"le,omitempty"`
+	Count         int64                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LatencyBucket) Reset() {
+	*x = LatencyBucket{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LatencyBucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LatencyBucket) ProtoMessage() {}
+
+func (x *LatencyBucket) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LatencyBucket.ProtoReflect.Descriptor instead.
+func (*LatencyBucket) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *LatencyBucket) GetLe() *durationpb.Duration {
+	if x != nil {
+		return x.Le
+	}
+	return nil
+}
+
+func (x *LatencyBucket) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type GetTopTalkersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "5m", "1h" or "24h"; "1h" if empty.
+	Window string `protobuf:"bytes,1,opt,name=window,proto3" json:"window,omitempty"`
+	// How many clients and destinations to return; 10 if unset.
+	Limit int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	// "bytes" or "requests"; "bytes" if empty.
+	By            string `protobuf:"bytes,3,opt,name=by,proto3" json:"by,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTopTalkersRequest) Reset() {
+	*x = GetTopTalkersRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTopTalkersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTopTalkersRequest) ProtoMessage() {}
+
+func (x *GetTopTalkersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTopTalkersRequest.ProtoReflect.Descriptor instead.
+func (*GetTopTalkersRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *GetTopTalkersRequest) GetWindow() string {
+	if x != nil {
+		return x.Window
+	}
+	return ""
+}
+
+func (x *GetTopTalkersRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *GetTopTalkersRequest) GetBy() string {
+	if x != nil {
+		return x.By
+	}
+	return ""
+}
+
+type TopTalkers struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Window        string                 `protobuf:"bytes,1,opt,name=window,proto3" json:"window,omitempty"`
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Requests      int64                  `protobuf:"varint,3,opt,name=requests,proto3" json:"requests,omitempty"`
+	Clients       []*Talker              `protobuf:"bytes,4,rep,name=clients,proto3" json:"clients,omitempty"`
+	Destinations  []*Talker              `protobuf:"bytes,5,rep,name=destinations,proto3" json:"destinations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopTalkers) Reset() {
+	*x = TopTalkers{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[40]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopTalkers) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopTalkers) ProtoMessage() {}
+
+func (x *TopTalkers) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[40]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopTalkers.ProtoReflect.Descriptor instead.
+func (*TopTalkers) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{40}
+}
+
+func (x *TopTalkers) GetWindow() string {
+	if x != nil {
+		return x.Window
+	}
+	return ""
+}
+
+func (x *TopTalkers) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *TopTalkers) GetRequests() int64 {
+	if x != nil {
+		return x.Requests
+	}
+	return 0
+}
+
+func (x *TopTalkers) GetClients() []*Talker {
+	if x != nil {
+		return x.Clients
+	}
+	return nil
+}
+
+func (x *TopTalkers) GetDestinations() []*Talker {
+	if x != nil {
+		return x.Destinations
+	}
+	return nil
+}
+
+type Talker struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Requests      int64                  `protobuf:"varint,3,opt,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Talker) Reset() {
+	*x = Talker{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[41]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Talker) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Talker) ProtoMessage() {}
+
+func (x *Talker) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[41]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Talker.ProtoReflect.Descriptor instead.
+func (*Talker) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{41}
+}
+
+func (x *Talker) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Talker) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *Talker) GetRequests() int64 {
+	if x != nil {
+		return x.Requests
+	}
+	return 0
+}
+
+type WriteDumpRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteDumpRequest) Reset() {
+	*x = WriteDumpRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[42]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteDumpRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteDumpRequest) ProtoMessage() {}
+
+func (x *WriteDumpRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[42]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteDumpRequest.ProtoReflect.Descriptor instead.
+func (*WriteDumpRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{42}
+}
+
+type WriteDumpResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The path of the dump on the proxy's host.
+	File          string `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteDumpResponse) Reset() {
+	*x = WriteDumpResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[43]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteDumpResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteDumpResponse) ProtoMessage() {}
+
+func (x *WriteDumpResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[43]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteDumpResponse.ProtoReflect.Descriptor instead.
+func (*WriteDumpResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{43}
+}
+
+func (x *WriteDumpResponse) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+type GetDecisionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDecisionsRequest) Reset() {
+	*x = GetDecisionsRequest{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[44]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDecisionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDecisionsRequest) ProtoMessage() {}
+
+func (x *GetDecisionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[44]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDecisionsRequest.ProtoReflect.Descriptor instead.
+func (*GetDecisionsRequest) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{44}
+}
+
+type GetDecisionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Decisions     []*DecisionCount       `protobuf:"bytes,1,rep,name=decisions,proto3" json:"decisions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDecisionsResponse) Reset() {
+	*x = GetDecisionsResponse{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[45]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDecisionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDecisionsResponse) ProtoMessage() {}
+
+func (x *GetDecisionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[45]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDecisionsResponse.ProtoReflect.Descriptor instead.
+func (*GetDecisionsResponse) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{45}
+}
+
+func (x *GetDecisionsResponse) GetDecisions() []*DecisionCount {
+	if x != nil {
+		return x.Decisions
+	}
+	return nil
+}
+
+type DecisionCount struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "direct", "upstream" or "blocked".
+	Route string `protobuf:"bytes,1,opt,name=route,proto3" json:"route,omitempty"`
+	// e.g. a PROXY_EXCEPTIONS pattern, "default", "pac" or "threat:<feed>".
+	Rule          string `protobuf:"bytes,2,opt,name=rule,proto3" json:"rule,omitempty"`
+	Count         int64  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DecisionCount) Reset() {
+	*x = DecisionCount{}
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[46]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DecisionCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecisionCount) ProtoMessage() {}
+
+func (x *DecisionCount) ProtoReflect() protoreflect.Message {
+	mi := &file_dynamicproxy_admin_v1_admin_proto_msgTypes[46]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecisionCount.ProtoReflect.Descriptor instead.
+func (*DecisionCount) Descriptor() ([]byte, []int) {
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP(), []int{46}
+}
+
+func (x *DecisionCount) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *DecisionCount) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *DecisionCount) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+var File_dynamicproxy_admin_v1_admin_proto protoreflect.FileDescriptor
+
+const file_dynamicproxy_admin_v1_admin_proto_rawDesc = "" +
+	"\n" +
+	"!dynamicproxy/admin/v1/admin.proto\x12\x15dynamicproxy.admin.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd8\x01\n" +
+	"\x06Config\x12%\n" +
+	"\x0eupstream_proxy\x18\x01 \x01(\tR\rupstreamProxy\x12)\n" +
+	"\x10proxy_exceptions\x18\x02 \x03(\tR\x0fproxyExceptions\x12\x1f\n" +
+	"\vlisten_addr\x18\x03 \x01(\tR\n" +
+	"listenAddr\x12\x1d\n" +
+	"\n" +
+	"proxy_auth\x18\x04 \x01(\tR\tproxyAuth\x12\x1b\n" +
+	"\tfail_open\x18\x05 \x01(\bR\bfailOpen\x12\x1f\n" +
+	"\vconfig_file\x18\x06 \x01(\tR\n" +
+	"configFile\"\x13\n" +
+	"\x11GetVersionRequest\"\x8e\x01\n" +
+	"\vVersionInfo\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12\x16\n" +
+	"\x06commit\x18\x02 \x01(\tR\x06commit\x12\x12\n" +
+	"\x04date\x18\x03 \x01(\tR\x04date\x12\x1d\n" +
+	"\n" +
+	"go_version\x18\x04 \x01(\tR\tgoVersion\x12\x1a\n" +
+	"\bplatform\x18\x05 \x01(\tR\bplatform\"\x12\n" +
+	"\x10GetConfigRequest\"\x17\n" +
+	"\x15ListExceptionsRequest\"4\n" +
+	"\x16ListExceptionsResponse\x12\x1a\n" +
+	"\bpatterns\x18\x01 \x03(\tR\bpatterns\"/\n" +
+	"\x13AddExceptionRequest\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\"2\n" +
+	"\x16DeleteExceptionRequest\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\"0\n" +
+	"\x12SetUpstreamRequest\x12\x1a\n" +
+	"\bupstream\x18\x01 \x01(\tR\bupstream\"\x16\n" +
+	"\x14ListUpstreamsRequest\"\\\n" +
+	"\x15ListUpstreamsResponse\x12C\n" +
+	"\tupstreams\x18\x01 \x03(\v2%.dynamicproxy.admin.v1.UpstreamHealthR\tupstreams\"\xde\x01\n" +
+	"\x0eUpstreamHealth\x12\x12\n" +
+	"\x04addr\x18\x01 \x01(\tR\x04addr\x12\x18\n" +
+	"\ahealthy\x18\x02 \x01(\bR\ahealthy\x12\x18\n" +
+	"\acircuit\x18\x03 \x01(\tR\acircuit\x129\n" +
+	"\n" +
+	"last_check\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tlastCheck\x123\n" +
+	"\alatency\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\alatency\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\".\n" +
+	"\x12SetFailOpenRequest\x12\x18\n" +
+	"\aenabled\x18\x01 \x01(\bR\aenabled\"\x14\n" +
+	"\x12GetDNSCacheRequest\"z\n" +
+	"\rDNSCacheStats\x12\x18\n" +
+	"\aentries\x18\x01 \x01(\x03R\aentries\x12\x12\n" +
+	"\x04hits\x18\x02 \x01(\x04R\x04hits\x12\x16\n" +
+	"\x06misses\x18\x03 \x01(\x04R\x06misses\x12#\n" +
+	"\rnegative_hits\x18\x04 \x01(\x04R\fnegativeHits\"\x16\n" +
+	"\x14PurgeDNSCacheRequest\"/\n" +
+	"\x15PurgeDNSCacheResponse\x12\x16\n" +
+	"\x06purged\x18\x01 \x01(\x03R\x06purged\"\x0f\n" +
+	"\rReloadRequest\"O\n" +
+	"\x0eReloadResponse\x12=\n" +
+	"\achanges\x18\x01 \x03(\v2#.dynamicproxy.admin.v1.ConfigChangeR\achanges\"s\n" +
+	"\fConfigChange\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x10\n" +
+	"\x03old\x18\x02 \x01(\tR\x03old\x12\x10\n" +
+	"\x03new\x18\x03 \x01(\tR\x03new\x12)\n" +
+	"\x10restart_required\x18\x04 \x01(\bR\x0frestartRequired\"\x14\n" +
+	"\x12GetActivityRequest\"|\n" +
+	"\bActivity\x127\n" +
+	"\x06active\x18\x01 \x03(\v2\x1f.dynamicproxy.admin.v1.ConnInfoR\x06active\x127\n" +
+	"\x06recent\x18\x02 \x03(\v2\x1f.dynamicproxy.admin.v1.ConnInfoR\x06recent\"\xe4\x04\n" +
+	"\bConnInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x16\n" +
+	"\x06client\x18\x03 \x01(\tR\x06client\x12\x16\n" +
+	"\x06method\x18\x04 \x01(\tR\x06method\x12\x12\n" +
+	"\x04host\x18\x05 \x01(\tR\x04host\x12\x14\n" +
+	"\x05route\x18\x06 \x01(\tR\x05route\x12\x16\n" +
+	"\x06status\x18\a \x01(\x05R\x06status\x12\x14\n" +
+	"\x05error\x18\b \x01(\tR\x05error\x124\n" +
+	"\astarted\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\astarted\x125\n" +
+	"\bduration\x18\n" +
+	" \x01(\v2\x19.google.protobuf.DurationR\bduration\x12\x1d\n" +
+	"\n" +
+	"bytes_sent\x18\v \x01(\x03R\tbytesSent\x12%\n" +
+	"\x0ebytes_received\x18\f \x01(\x03R\rbytesReceived\x12 \n" +
+	"\vdestination\x18\r \x01(\tR\vdestination\x12\x10\n" +
+	"\x03sni\x18\x0e \x01(\tR\x03sni\x12\x1a\n" +
+	"\bupstream\x18\x0f \x01(\tR\bupstream\x12/\n" +
+	"\x05setup\x18\x10 \x01(\v2\x19.google.protobuf.DurationR\x05setup\x12\x10\n" +
+	"\x03ja3\x18\x11 \x01(\tR\x03ja3\x12\x10\n" +
+	"\x03ja4\x18\x12 \x01(\tR\x03ja4\x12\x18\n" +
+	"\acountry\x18\x13 \x01(\tR\acountry\x12\x10\n" +
+	"\x03asn\x18\x14 \x01(\rR\x03asn\x12\x16\n" +
+	"\x06threat\x18\x15 \x01(\tR\x06threat\x12\x10\n" +
+	"\x03app\x18\x16 \x01(\tR\x03app\"\x18\n" +
+	"\x16ListConnectionsRequest\"\\\n" +
+	"\x17ListConnectionsResponse\x12A\n" +
+	"\vconnections\x18\x01 \x03(\v2\x1f.dynamicproxy.admin.v1.ConnInfoR\vconnections\"(\n" +
+	"\x16CloseConnectionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"\x19\n" +
+	"\x17CloseConnectionResponse\"A\n" +
+	"\x13StreamEventsRequest\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x16\n" +
+	"\x06client\x18\x02 \x01(\tR\x06client\"\xbe\x01\n" +
+	"\tConnEvent\x129\n" +
+	"\x04type\x18\x01 \x01(\x0e2%.dynamicproxy.admin.v1.ConnEvent.TypeR\x04type\x123\n" +
+	"\x04conn\x18\x02 \x01(\v2\x1f.dynamicproxy.admin.v1.ConnInfoR\x04conn\"A\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fTYPE_STARTED\x10\x01\x12\x11\n" +
+	"\rTYPE_FINISHED\x10\x02\"\x14\n" +
+	"\x12ListClientsRequest\"S\n" +
+	"\x13ListClientsResponse\x12<\n" +
+	"\aclients\x18\x01 \x03(\v2\".dynamicproxy.admin.v1.ClientUsageR\aclients\"\xa5\x01\n" +
+	"\vClientUsage\x12\x16\n" +
+	"\x06client\x18\x01 \x01(\tR\x06client\x12\x1b\n" +
+	"\tlast_hour\x18\x02 \x01(\x03R\blastHour\x12\x19\n" +
+	"\blast_day\x18\x03 \x01(\x03R\alastDay\x12\x1f\n" +
+	"\vlast30_days\x18\x04 \x01(\x03R\n" +
+	"last30Days\x12%\n" +
+	"\x0equota_exceeded\x18\x05 \x01(\bR\rquotaExceeded\"\x18\n" +
+	"\x16ListThreatFeedsRequest\"R\n" +
+	"\x17ListThreatFeedsResponse\x127\n" +
+	"\x05feeds\x18\x01 \x03(\v2!.dynamicproxy.admin.v1.ThreatFeedR\x05feeds\"\x9a\x01\n" +
+	"\n" +
+	"ThreatFeed\x12\x12\n" +
+	"\x04feed\x18\x01 \x01(\tR\x04feed\x12\x18\n" +
+	"\aentries\x18\x02 \x01(\x03R\aentries\x12\x12\n" +
+	"\x04hits\x18\x03 \x01(\x03R\x04hits\x124\n" +
+	"\aupdated\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\aupdated\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"\x13\n" +
+	"\x11GetLatencyRequest\"]\n" +
+	"\x12GetLatencyResponse\x12G\n" +
+	"\n" +
+	"histograms\x18\x01 \x03(\v2'.dynamicproxy.admin.v1.LatencyHistogramR\n" +
+	"histograms\"\xdb\x01\n" +
+	"\x10LatencyHistogram\x12\x12\n" +
+	"\x04kind\x18\x01 \x01(\tR\x04kind\x12\x14\n" +
+	"\x05route\x18\x02 \x01(\tR\x05route\x12\x1a\n" +
+	"\bupstream\x18\x03 \x01(\tR\bupstream\x12\x14\n" +
+	"\x05count\x18\x04 \x01(\x03R\x05count\x12+\n" +
+	"\x03sum\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\x03sum\x12>\n" +
+	"\abuckets\x18\x06 \x03(\v2$.dynamicproxy.admin.v1.LatencyBucketR\abuckets\"P\n" +
+	"\rLatencyBucket\x12)\n" +
+	"\x02le\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\x02le\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x03R\x05count\"T\n" +
+	"\x14GetTopTalkersRequest\x12\x16\n" +
+	"\x06window\x18\x01 \x01(\tR\x06window\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x0e\n" +
+	"\x02by\x18\x03 \x01(\tR\x02by\"\xd2\x01\n" +
+	"\n" +
+	"TopTalkers\x12\x16\n" +
+	"\x06window\x18\x01 \x01(\tR\x06window\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\x12\x1a\n" +
+	"\brequests\x18\x03 \x01(\x03R\brequests\x127\n" +
+	"\aclients\x18\x04 \x03(\v2\x1d.dynamicproxy.admin.v1.TalkerR\aclients\x12A\n" +
+	"\fdestinations\x18\x05 \x03(\v2\x1d.dynamicproxy.admin.v1.TalkerR\fdestinations\"N\n" +
+	"\x06Talker\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\x12\x1a\n" +
+	"\brequests\x18\x03 \x01(\x03R\brequests\"\x12\n" +
+	"\x10WriteDumpRequest\"'\n" +
+	"\x11WriteDumpResponse\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\"\x15\n" +
+	"\x13GetDecisionsRequest\"Z\n" +
+	"\x14GetDecisionsResponse\x12B\n" +
+	"\tdecisions\x18\x01 \x03(\v2$.dynamicproxy.admin.v1.DecisionCountR\tdecisions\"O\n" +
+	"\rDecisionCount\x12\x14\n" +
+	"\x05route\x18\x01 \x01(\tR\x05route\x12\x12\n" +
+	"\x04rule\x18\x02 \x01(\tR\x04rule\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x03R\x05count2\xaf\x10\n" +
+	"\fAdminService\x12Z\n" +
+	"\n" +
+	"GetVersion\x12(.dynamicproxy.admin.v1.GetVersionRequest\x1a\".dynamicproxy.admin.v1.VersionInfo\x12S\n" +
+	"\tGetConfig\x12'.dynamicproxy.admin.v1.GetConfigRequest\x1a\x1d.dynamicproxy.admin.v1.Config\x12m\n" +
+	"\x0eListExceptions\x12,.dynamicproxy.admin.v1.ListExceptionsRequest\x1a-.dynamicproxy.admin.v1.ListExceptionsResponse\x12Y\n" +
+	"\fAddException\x12*.dynamicproxy.admin.v1.AddExceptionRequest\x1a\x1d.dynamicproxy.admin.v1.Config\x12_\n" +
+	"\x0fDeleteException\x12-.dynamicproxy.admin.v1.DeleteExceptionRequest\x1a\x1d.dynamicproxy.admin.v1.Config\x12W\n" +
+	"\vSetUpstream\x12).dynamicproxy.admin.v1.SetUpstreamRequest\x1a\x1d.dynamicproxy.admin.v1.Config\x12j\n" +
+	"\rListUpstreams\x12+.dynamicproxy.admin.v1.ListUpstreamsRequest\x1a,.dynamicproxy.admin.v1.ListUpstreamsResponse\x12W\n" +
+	"\vSetFailOpen\x12).dynamicproxy.admin.v1.SetFailOpenRequest\x1a\x1d.dynamicproxy.admin.v1.Config\x12^\n" +
+	"\vGetDNSCache\x12).dynamicproxy.admin.v1.GetDNSCacheRequest\x1a$.dynamicproxy.admin.v1.DNSCacheStats\x12j\n" +
+	"\rPurgeDNSCache\x12+.dynamicproxy.admin.v1.PurgeDNSCacheRequest\x1a,.dynamicproxy.admin.v1.PurgeDNSCacheResponse\x12U\n" +
+	"\x06Reload\x12$.dynamicproxy.admin.v1.ReloadRequest\x1a%.dynamicproxy.admin.v1.ReloadResponse\x12Y\n" +
+	"\vGetActivity\x12).dynamicproxy.admin.v1.GetActivityRequest\x1a\x1f.dynamicproxy.admin.v1.Activity\x12p\n" +
+	"\x0fListConnections\x12-.dynamicproxy.admin.v1.ListConnectionsRequest\x1a..dynamicproxy.admin.v1.ListConnectionsResponse\x12p\n" +
+	"\x0fCloseConnection\x12-.dynamicproxy.admin.v1.CloseConnectionRequest\x1a..dynamicproxy.admin.v1.CloseConnectionResponse\x12^\n" +
+	"\fStreamEvents\x12*.dynamicproxy.admin.v1.StreamEventsRequest\x1a .dynamicproxy.admin.v1.ConnEvent0\x01\x12d\n" +
+	"\vListClients\x12).dynamicproxy.admin.v1.ListClientsRequest\x1a*.dynamicproxy.admin.v1.ListClientsResponse\x12p\n" +
+	"\x0fListThreatFeeds\x12-.dynamicproxy.admin.v1.ListThreatFeedsRequest\x1a..dynamicproxy.admin.v1.ListThreatFeedsResponse\x12a\n" +
+	"\n" +
+	"GetLatency\x12(.dynamicproxy.admin.v1.GetLatencyRequest\x1a).dynamicproxy.admin.v1.GetLatencyResponse\x12_\n" +
+	"\rGetTopTalkers\x12+.dynamicproxy.admin.v1.GetTopTalkersRequest\x1a!.dynamicproxy.admin.v1.TopTalkers\x12^\n" +
+	"\tWriteDump\x12'.dynamicproxy.admin.v1.WriteDumpRequest\x1a(.dynamicproxy.admin.v1.WriteDumpResponse\x12g\n" +
+	"\fGetDecisions\x12*.dynamicproxy.admin.v1.GetDecisionsRequest\x1a+.dynamicproxy.admin.v1.GetDecisionsResponseBCZAgithub.com/cavoq/DynamicProxy/proto/dynamicproxy/admin/v1;adminv1b\x06proto3"
+
+var (
+	file_dynamicproxy_admin_v1_admin_proto_rawDescOnce sync.Once
+	file_dynamicproxy_admin_v1_admin_proto_rawDescData []byte
+)
+
+func file_dynamicproxy_admin_v1_admin_proto_rawDescGZIP() []byte {
+	file_dynamicproxy_admin_v1_admin_proto_rawDescOnce.Do(func() {
+		file_dynamicproxy_admin_v1_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_dynamicproxy_admin_v1_admin_proto_rawDesc), len(file_dynamicproxy_admin_v1_admin_proto_rawDesc)))
+	})
+	return file_dynamicproxy_admin_v1_admin_proto_rawDescData
+}
+
+var file_dynamicproxy_admin_v1_admin_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_dynamicproxy_admin_v1_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 47)
+var file_dynamicproxy_admin_v1_admin_proto_goTypes = []any{
+	(ConnEvent_Type)(0),             // 0: dynamicproxy.admin.v1.ConnEvent.Type
+	(*Config)(nil),                  // 1: dynamicproxy.admin.v1.Config
+	(*GetVersionRequest)(nil),       // 2: dynamicproxy.admin.v1.GetVersionRequest
+	(*VersionInfo)(nil),             // 3: dynamicproxy.admin.v1.VersionInfo
+	(*GetConfigRequest)(nil),        // 4: dynamicproxy.admin.v1.GetConfigRequest
+	(*ListExceptionsRequest)(nil),   // 5: dynamicproxy.admin.v1.ListExceptionsRequest
+	(*ListExceptionsResponse)(nil),  // 6: dynamicproxy.admin.v1.ListExceptionsResponse
+	(*AddExceptionRequest)(nil),     // 7: dynamicproxy.admin.v1.AddExceptionRequest
+	(*DeleteExceptionRequest)(nil),  // 8: dynamicproxy.admin.v1.DeleteExceptionRequest
+	(*SetUpstreamRequest)(nil),      // 9: dynamicproxy.admin.v1.SetUpstreamRequest
+	(*ListUpstreamsRequest)(nil),    // 10: dynamicproxy.admin.v1.ListUpstreamsRequest
+	(*ListUpstreamsResponse)(nil),   // 11: dynamicproxy.admin.v1.ListUpstreamsResponse
+	(*UpstreamHealth)(nil),          // 12: dynamicproxy.admin.v1.UpstreamHealth
+	(*SetFailOpenRequest)(nil),      // 13: dynamicproxy.admin.v1.SetFailOpenRequest
+	(*GetDNSCacheRequest)(nil),      // 14: dynamicproxy.admin.v1.GetDNSCacheRequest
+	(*DNSCacheStats)(nil),           // 15: dynamicproxy.admin.v1.DNSCacheStats
+	(*PurgeDNSCacheRequest)(nil),    // 16: dynamicproxy.admin.v1.PurgeDNSCacheRequest
+	(*PurgeDNSCacheResponse)(nil),   // 17: dynamicproxy.admin.v1.PurgeDNSCacheResponse
+	(*ReloadRequest)(nil),           // 18: dynamicproxy.admin.v1.ReloadRequest
+	(*ReloadResponse)(nil),          // 19: dynamicproxy.admin.v1.ReloadResponse
+	(*ConfigChange)(nil),            // 20: dynamicproxy.admin.v1.ConfigChange
+	(*GetActivityRequest)(nil),      // 21: dynamicproxy.admin.v1.GetActivityRequest
+	(*Activity)(nil),                // 22: dynamicproxy.admin.v1.Activity
+	(*ConnInfo)(nil),                // 23: dynamicproxy.admin.v1.ConnInfo
+	(*ListConnectionsRequest)(nil),  // 24: dynamicproxy.admin.v1.ListConnectionsRequest
+	(*ListConnectionsResponse)(nil), // 25: dynamicproxy.admin.v1.ListConnectionsResponse
+	(*CloseConnectionRequest)(nil),  // 26: dynamicproxy.admin.v1.CloseConnectionRequest
+	(*CloseConnectionResponse)(nil), // 27: dynamicproxy.admin.v1.CloseConnectionResponse
+	(*StreamEventsRequest)(nil),     // 28: dynamicproxy.admin.v1.StreamEventsRequest
+	(*ConnEvent)(nil),               // 29: dynamicproxy.admin.v1.ConnEvent
+	(*ListClientsRequest)(nil),      // 30: dynamicproxy.admin.v1.ListClientsRequest
+	(*ListClientsResponse)(nil),     // 31: dynamicproxy.admin.v1.ListClientsResponse
+	(*ClientUsage)(nil),             // 32: dynamicproxy.admin.v1.ClientUsage
+	(*ListThreatFeedsRequest)(nil),  // 33: dynamicproxy.admin.v1.ListThreatFeedsRequest
+	(*ListThreatFeedsResponse)(nil), // 34: dynamicproxy.admin.v1.ListThreatFeedsResponse
+	(*ThreatFeed)(nil),              // 35: dynamicproxy.admin.v1.ThreatFeed
+	(*GetLatencyRequest)(nil),       // 36: dynamicproxy.admin.v1.GetLatencyRequest
+	(*GetLatencyResponse)(nil),      // 37: dynamicproxy.admin.v1.GetLatencyResponse
+	(*LatencyHistogram)(nil),        // 38: dynamicproxy.admin.v1.LatencyHistogram
+	(*LatencyBucket)(nil),           // 39: dynamicproxy.admin.v1.LatencyBucket
+	(*GetTopTalkersRequest)(nil),    // 40: dynamicproxy.admin.v1.GetTopTalkersRequest
+	(*TopTalkers)(nil),              // 41: dynamicproxy.admin.v1.TopTalkers
+	(*Talker)(nil),                  // 42: dynamicproxy.admin.v1.Talker
+	(*WriteDumpRequest)(nil),        // 43: dynamicproxy.admin.v1.WriteDumpRequest
+	(*WriteDumpResponse)(nil),       // 44: dynamicproxy.admin.v1.WriteDumpResponse
+	(*GetDecisionsRequest)(nil),     // 45: dynamicproxy.admin.v1.GetDecisionsRequest
+	(*GetDecisionsResponse)(nil),    // 46: dynamicproxy.admin.v1.GetDecisionsResponse
+	(*DecisionCount)(nil),           // 47: dynamicproxy.admin.v1.DecisionCount
+	(*timestamppb.Timestamp)(nil),   // 48: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),     // 49: google.protobuf.Duration
+}
+var file_dynamicproxy_admin_v1_admin_proto_depIdxs = []int32{
+	12, // 0: dynamicproxy.admin.v1.ListUpstreamsResponse.upstreams:type_name -> dynamicproxy.admin.v1.UpstreamHealth
+	48, // 1: dynamicproxy.admin.v1.UpstreamHealth.last_check:type_name -> google.protobuf.Timestamp
+	49, // 2: dynamicproxy.admin.v1.UpstreamHealth.latency:type_name -> google.protobuf.Duration
+	20, // 3: dynamicproxy.admin.v1.ReloadResponse.changes:type_name -> dynamicproxy.admin.v1.ConfigChange
+	23, // 4: dynamicproxy.admin.v1.Activity.active:type_name -> dynamicproxy.admin.v1.ConnInfo
+	23, // 5: dynamicproxy.admin.v1.Activity.recent:type_name -> dynamicproxy.admin.v1.ConnInfo
+	48, // 6: dynamicproxy.admin.v1.ConnInfo.started:type_name -> google.protobuf.Timestamp
+	49, // 7: dynamicproxy.admin.v1.ConnInfo.duration:type_name -> google.protobuf.Duration
+	49, // 8: dynamicproxy.admin.v1.ConnInfo.setup:type_name -> google.protobuf.Duration
+	23, // 9: dynamicproxy.admin.v1.ListConnectionsResponse.connections:type_name -> dynamicproxy.admin.v1.ConnInfo
+	0,  // 10: dynamicproxy.admin.v1.ConnEvent.type:type_name -> dynamicproxy.admin.v1.ConnEvent.Type
+	23, // 11: dynamicproxy.admin.v1.ConnEvent.conn:type_name -> dynamicproxy.admin.v1.ConnInfo
+	32, // 12: dynamicproxy.admin.v1.ListClientsResponse.clients:type_name -> dynamicproxy.admin.v1.ClientUsage
+	35, // 13: dynamicproxy.admin.v1.ListThreatFeedsResponse.feeds:type_name -> dynamicproxy.admin.v1.ThreatFeed
+	48, // 14: dynamicproxy.admin.v1.ThreatFeed.updated:type_name -> google.protobuf.Timestamp
+	38, // 15: dynamicproxy.admin.v1.GetLatencyResponse.histograms:type_name -> dynamicproxy.admin.v1.LatencyHistogram
+	49, // 16: dynamicproxy.admin.v1.LatencyHistogram.sum:type_name -> google.protobuf.Duration
+	39, // 17: dynamicproxy.admin.v1.LatencyHistogram.buckets:type_name -> dynamicproxy.admin.v1.LatencyBucket
+	49, // 18: dynamicproxy.admin.v1.LatencyBucket.le:type_name -> google.protobuf.Duration
+	42, // 19: dynamicproxy.admin.v1.TopTalkers.clients:type_name -> dynamicproxy.admin.v1.Talker
+	42, // 20: dynamicproxy.admin.v1.TopTalkers.destinations:type_name -> dynamicproxy.admin.v1.Talker
+	47, // 21: dynamicproxy.admin.v1.GetDecisionsResponse.decisions:type_name -> dynamicproxy.admin.v1.DecisionCount
+	2,  // 22: dynamicproxy.admin.v1.AdminService.GetVersion:input_type -> dynamicproxy.admin.v1.GetVersionRequest
+	4,  // 23: dynamicproxy.admin.v1.AdminService.GetConfig:input_type -> dynamicproxy.admin.v1.GetConfigRequest
+	5,  // 24: dynamicproxy.admin.v1.AdminService.ListExceptions:input_type -> dynamicproxy.admin.v1.ListExceptionsRequest
+	7,  // 25: dynamicproxy.admin.v1.AdminService.AddException:input_type -> dynamicproxy.admin.v1.AddExceptionRequest
+	8,  // 26: dynamicproxy.admin.v1.AdminService.DeleteException:input_type -> dynamicproxy.admin.v1.DeleteExceptionRequest
+	9,  // 27: dynamicproxy.admin.v1.AdminService.SetUpstream:input_type -> dynamicproxy.admin.v1.SetUpstreamRequest
+	10, // 28: dynamicproxy.admin.v1.AdminService.ListUpstreams:input_type -> dynamicproxy.admin.v1.ListUpstreamsRequest
+	13, // 29: dynamicproxy.admin.v1.AdminService.SetFailOpen:input_type -> dynamicproxy.admin.v1.SetFailOpenRequest
+	14, // 30: dynamicproxy.admin.v1.AdminService.GetDNSCache:input_type -> dynamicproxy.admin.v1.GetDNSCacheRequest
+	16, // 31: dynamicproxy.admin.v1.AdminService.PurgeDNSCache:input_type -> dynamicproxy.admin.v1.PurgeDNSCacheRequest
+	18, // 32: dynamicproxy.admin.v1.AdminService.Reload:input_type -> dynamicproxy.admin.v1.ReloadRequest
+	21, // 33: dynamicproxy.admin.v1.AdminService.GetActivity:input_type -> dynamicproxy.admin.v1.GetActivityRequest
+	24, // 34: dynamicproxy.admin.v1.AdminService.ListConnections:input_type -> dynamicproxy.admin.v1.ListConnectionsRequest
+	26, // 35: dynamicproxy.admin.v1.AdminService.CloseConnection:input_type -> dynamicproxy.admin.v1.CloseConnectionRequest
+	28, // 36: dynamicproxy.admin.v1.AdminService.StreamEvents:input_type -> dynamicproxy.admin.v1.StreamEventsRequest
+	30, // 37: dynamicproxy.admin.v1.AdminService.ListClients:input_type -> dynamicproxy.admin.v1.ListClientsRequest
+	33, // 38: dynamicproxy.admin.v1.AdminService.ListThreatFeeds:input_type -> dynamicproxy.admin.v1.ListThreatFeedsRequest
+	36, // 39: dynamicproxy.admin.v1.AdminService.GetLatency:input_type -> dynamicproxy.admin.v1.GetLatencyRequest
+	40, // 40: dynamicproxy.admin.v1.AdminService.GetTopTalkers:input_type -> dynamicproxy.admin.v1.GetTopTalkersRequest
+	43, // 41: dynamicproxy.admin.v1.AdminService.WriteDump:input_type -> dynamicproxy.admin.v1.WriteDumpRequest
+	45, // 42: dynamicproxy.admin.v1.AdminService.GetDecisions:input_type -> dynamicproxy.admin.v1.GetDecisionsRequest
+	3,  // 43: dynamicproxy.admin.v1.AdminService.GetVersion:output_type -> dynamicproxy.admin.v1.VersionInfo
+	1,  // 44: dynamicproxy.admin.v1.AdminService.GetConfig:output_type -> dynamicproxy.admin.v1.Config
+	6,  // 45: dynamicproxy.admin.v1.AdminService.ListExceptions:output_type -> dynamicproxy.admin.v1.ListExceptionsResponse
+	1,  // 46: dynamicproxy.admin.v1.AdminService.AddException:output_type -> dynamicproxy.admin.v1.Config
+	1,  // 47: dynamicproxy.admin.v1.AdminService.DeleteException:output_type -> dynamicproxy.admin.v1.Config
+	1,  // 48: dynamicproxy.admin.v1.AdminService.SetUpstream:output_type -> dynamicproxy.admin.v1.Config
+	11, // 49: dynamicproxy.admin.v1.AdminService.ListUpstreams:output_type -> dynamicproxy.admin.v1.ListUpstreamsResponse
+	1,  // 50: dynamicproxy.admin.v1.AdminService.SetFailOpen:output_type -> dynamicproxy.admin.v1.Config
+	15, // 51: dynamicproxy.admin.v1.AdminService.GetDNSCache:output_type -> dynamicproxy.admin.v1.DNSCacheStats
+	17, // 52: dynamicproxy.admin.v1.AdminService.PurgeDNSCache:output_type -> dynamicproxy.admin.v1.PurgeDNSCacheResponse
+	19, // 53: dynamicproxy.admin.v1.AdminService.Reload:output_type -> dynamicproxy.admin.v1.ReloadResponse
+	22, // 54: dynamicproxy.admin.v1.AdminService.GetActivity:output_type -> dynamicproxy.admin.v1.Activity
+	25, // 55: dynamicproxy.admin.v1.AdminService.ListConnections:output_type -> dynamicproxy.admin.v1.ListConnectionsResponse
+	27, // 56: dynamicproxy.admin.v1.AdminService.CloseConnection:output_type -> dynamicproxy.admin.v1.CloseConnectionResponse
+	29, // 57: dynamicproxy.admin.v1.AdminService.StreamEvents:output_type -> dynamicproxy.admin.v1.ConnEvent
+	31, // 58: dynamicproxy.admin.v1.AdminService.ListClients:output_type -> dynamicproxy.admin.v1.ListClientsResponse
+	34, // 59: dynamicproxy.admin.v1.AdminService.ListThreatFeeds:output_type -> dynamicproxy.admin.v1.ListThreatFeedsResponse
+	37, // 60: dynamicproxy.admin.v1.AdminService.GetLatency:output_type -> dynamicproxy.admin.v1.GetLatencyResponse
+	41, // 61: dynamicproxy.admin.v1.AdminService.GetTopTalkers:output_type -> dynamicproxy.admin.v1.TopTalkers
+	44, // 62: dynamicproxy.admin.v1.AdminService.WriteDump:output_type -> dynamicproxy.admin.v1.WriteDumpResponse
+	46, // 63: dynamicproxy.admin.v1.AdminService.GetDecisions:output_type -> dynamicproxy.admin.v1.GetDecisionsResponse
+	43, // [43:64] is the sub-list for method output_type
+	22, // [22:43] is the sub-list for method input_type
+	22, // [22:22] is the sub-list for extension type_name
+	22, // [22:22] is the sub-list for extension extendee
+	0,  // [0:22] is the sub-list for field type_name
+}
+
+func init() { file_dynamicproxy_admin_v1_admin_proto_init() }
+func file_dynamicproxy_admin_v1_admin_proto_init() {
+	if File_dynamicproxy_admin_v1_admin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_dynamicproxy_admin_v1_admin_proto_rawDesc), len(file_dynamicproxy_admin_v1_admin_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   47,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_dynamicproxy_admin_v1_admin_proto_goTypes,
+		DependencyIndexes: file_dynamicproxy_admin_v1_admin_proto_depIdxs,
+		EnumInfos:         file_dynamicproxy_admin_v1_admin_proto_enumTypes,
+		MessageInfos:      file_dynamicproxy_admin_v1_admin_proto_msgTypes,
+	}.Build()
+	File_dynamicproxy_admin_v1_admin_proto = out.File
+	file_dynamicproxy_admin_v1_admin_proto_goTypes = nil
+	file_dynamicproxy_admin_v1_admin_proto_depIdxs = nil
+}
@@ -0,0 +1,108 @@
+// Package proxytest runs DynamicProxy inside the test process.
+//
+// It is the in-process counterpart of net/http/httptest: New starts the proxy
+// on an ephemeral loopback port and registers its teardown with t.Cleanup, so
+// tests need neither a built binary nor a fixed listen port.
+package proxytest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cavoq/DynamicProxy/internal/config"
+	"github.com/cavoq/DynamicProxy/internal/proxy"
+)
+
+// Config is the proxy configuration accepted by New and Proxy.Update.
+type Config = config.Config
+
+// Proxy is a DynamicProxy instance listening on a loopback port.
+type Proxy struct {
+	// URL is the proxy URL, suitable for http.ProxyURL, e.g. "http://127.0.0.1:41234".
+	URL string
+	// Addr is the host:port the proxy listens on.
+	Addr string
+
+	server *proxy.Server
+}
+
+// DefaultConfig returns the configuration the proxy uses when no environment
+// variables are set.
+func DefaultConfig() Config {
+	return config.DefaultConfig()
+}
+
+// New starts a proxy with cfg on 127.0.0.1 with an ephemeral port. cfg.ListenAddr
+// is ignored. The proxy is shut down when the test and its subtests complete.
+func New(t testing.TB, cfg Config) *Proxy {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("proxytest: failed to listen: %v", err)
+	}
+	cfg.ListenAddr = l.Addr().String()
+
+	server := proxy.NewServer(cfg)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			t.Errorf("proxytest: serve failed: %v", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			_ = server.Close()
+		}
+		<-done
+	})
+
+	return &Proxy{
+		URL:    "http://" + cfg.ListenAddr,
+		Addr:   cfg.ListenAddr,
+		server: server,
+	}
+}
+
+// Config returns the configuration currently in effect.
+func (p *Proxy) Config() Config {
+	return p.server.Config()
+}
+
+// Update applies fn to a copy of the current configuration and swaps it in
+// atomically. Requests already in flight are not affected.
+func (p *Proxy) Update(fn func(cfg *Config)) {
+	_, _ = p.server.Update(func(cfg *Config) error {
+		fn(cfg)
+		return nil
+	})
+}
+
+// SetUpstream switches the upstream proxy address, e.g. "127.0.0.1:3128".
+func (p *Proxy) SetUpstream(addr string) {
+	p.Update(func(cfg *Config) { cfg.UpstreamProxy = addr })
+}
+
+// SetExceptions replaces the list of hosts that bypass the upstream proxy.
+func (p *Proxy) SetExceptions(exceptions ...string) {
+	p.Update(func(cfg *Config) { cfg.ProxyExceptions = exceptions })
+}
+
+// Client returns an HTTP client that sends all requests through the proxy.
+// Its Transport is an *http.Transport and may be adjusted, e.g. to trust a
+// test server certificate.
+func (p *Proxy) Client() *http.Client {
+	proxyURL, _ := url.Parse(p.URL)
+	return &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+		Timeout:   10 * time.Second,
+	}
+}
@@ -0,0 +1,114 @@
+package proxytest_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cavoq/DynamicProxy/proxytest"
+)
+
+func newUpstream(t *testing.T) (*httptest.Server, *int64) {
+	t.Helper()
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		resp, err := http.Get(r.URL.String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func get(t *testing.T, client *http.Client, target string) string {
+	t.Helper()
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	return string(body)
+}
+
+func TestProxyRoutesAndReconfigures(t *testing.T) {
+	upstream, upstreamRequests := newUpstream(t)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	t.Cleanup(target.Close)
+
+	cfg := proxytest.DefaultConfig()
+	cfg.UpstreamProxy = strings.TrimPrefix(upstream.URL, "http://")
+	p := proxytest.New(t, cfg)
+	client := p.Client()
+
+	if got := get(t, client, target.URL); got != "hello" {
+		t.Fatalf("unexpected body %q", got)
+	}
+	if n := atomic.LoadInt64(upstreamRequests); n != 1 {
+		t.Fatalf("expected request via upstream, upstream saw %d", n)
+	}
+
+	p.SetExceptions(strings.TrimPrefix(target.URL, "http://"))
+	if got := get(t, client, target.URL); got != "hello" {
+		t.Fatalf("unexpected body %q", got)
+	}
+	if n := atomic.LoadInt64(upstreamRequests); n != 1 {
+		t.Fatalf("expected bypassed request to skip upstream, upstream saw %d", n)
+	}
+	if got := p.Config().ProxyExceptions; len(got) != 1 {
+		t.Fatalf("expected updated exceptions, got %v", got)
+	}
+}
+
+func TestNewUsesEphemeralPort(t *testing.T) {
+	a := proxytest.New(t, proxytest.DefaultConfig())
+	b := proxytest.New(t, proxytest.DefaultConfig())
+	if a.Addr == b.Addr {
+		t.Fatalf("expected distinct listen addresses, both got %s", a.Addr)
+	}
+	if !strings.HasPrefix(a.URL, "http://127.0.0.1:") {
+		t.Fatalf("unexpected proxy URL %q", a.URL)
+	}
+}
+
+func TestFailOpenFallsBackToDirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "direct")
+	}))
+	t.Cleanup(target.Close)
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	cfg := proxytest.DefaultConfig()
+	cfg.UpstreamProxy = strings.TrimPrefix(unreachable.URL, "http://")
+	p := proxytest.New(t, cfg)
+
+	resp, err := p.Client().Get(target.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 without fail-open, got %d", resp.StatusCode)
+	}
+
+	p.Update(func(cfg *proxytest.Config) { cfg.FailOpen = true })
+	if got := get(t, p.Client(), target.URL); got != "direct" {
+		t.Fatalf("unexpected body %q", got)
+	}
+}